@@ -0,0 +1,241 @@
+// Package client is a Go client for the controller's status API, so that
+// platform tooling can query the state of kpNodes and scale events, approve
+// scale downs and request scale ups without parsing its JSON by hand.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// The most of an error response kept in an APIError
+const maxErrorBodySize = 1 << 12
+
+// The outcome of the controller's most recent scale up or scale down
+// assessment and the reasons for it.
+type Assessment struct {
+	Assessed time.Time `json:"assessed"`
+	Decision string    `json:"decision"`
+	Reasons  []string  `json:"reasons,omitempty"`
+	// Only set when the scaler was consulted during the assessment
+	ScaleUp   *scaler.ScaleUpExplanation   `json:"scaleUp,omitempty"`
+	ScaleDown *scaler.ScaleDownExplanation `json:"scaleDown,omitempty"`
+}
+
+// Why the cluster was or wasn't last scaled, served from /explain.
+type Explanation struct {
+	ScaleUp   Assessment `json:"scaleUp"`
+	ScaleDown Assessment `json:"scaleDown"`
+}
+
+// A scale down awaiting approval when scaleDownApproval is set.
+type ScaleDownProposal struct {
+	ScaleEvent *scaler.ScaleEvent `json:"scaleEvent"`
+	Reason     string             `json:"reason,omitempty"`
+	Proposed   time.Time          `json:"proposed"`
+}
+
+// A scale event an observer mode controller would have published.
+type Decision struct {
+	QueueName  string             `json:"queueName"`
+	ScaleEvent *scaler.ScaleEvent `json:"scaleEvent"`
+	Observed   time.Time          `json:"observed"`
+}
+
+// The progress of an evacuation of every kpNode.
+type Evacuation struct {
+	Active    bool      `json:"active"`
+	Cancelled bool      `json:"cancelled,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	// The kpNode being drained and removed
+	Current   string   `json:"current,omitempty"`
+	Remaining []string `json:"remaining"`
+	Evacuated []string `json:"evacuated"`
+	// kpNodes whose scale down failed, which are left in place
+	Failed []string `json:"failed"`
+}
+
+// Returned for responses from the controller other than success.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("kproximate controller responded %d: %s", e.StatusCode, e.Message)
+}
+
+// Calls the status API of a kproximate controller.
+type Client struct {
+	// The base URL of the controller, e.g. http://kproximate.kproximate.svc
+	URL string
+	// Sent as a bearer token with every request when set
+	Token      string
+	HTTPClient *http.Client
+}
+
+func New(controllerUrl string) *Client {
+	return &Client{
+		URL:        strings.TrimSuffix(controllerUrl, "/"),
+		HTTPClient: http.DefaultClient,
+	}
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, body any, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, reqBody)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(message)),
+		}
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Returns the latest progress reported by workers for recent scale events,
+// most recently updated first.
+func (c *Client) ScaleEvents(ctx context.Context) ([]scaler.ScaleEventStatus, error) {
+	var statuses []scaler.ScaleEventStatus
+	err := c.do(ctx, http.MethodGet, "/status/scaleevents", nil, &statuses)
+	return statuses, err
+}
+
+// Returns the estimated running cost of the kpNodes.
+func (c *Client) Cost(ctx context.Context) (scaler.CostEstimate, error) {
+	var estimate scaler.CostEstimate
+	err := c.do(ctx, http.MethodGet, "/status/cost", nil, &estimate)
+	return estimate, err
+}
+
+// Returns why the cluster was or wasn't last scaled.
+func (c *Client) Explain(ctx context.Context) (Explanation, error) {
+	var explanation Explanation
+	err := c.do(ctx, http.MethodGet, "/explain", nil, &explanation)
+	return explanation, err
+}
+
+// Returns the scale events an observer mode controller would have published,
+// most recent first.
+func (c *Client) Decisions(ctx context.Context) ([]Decision, error) {
+	var decisions []Decision
+	err := c.do(ctx, http.MethodGet, "/status/decisions", nil, &decisions)
+	return decisions, err
+}
+
+// Returns the scale downs awaiting approval.
+func (c *Client) ScaleDownProposals(ctx context.Context) ([]ScaleDownProposal, error) {
+	var proposals []ScaleDownProposal
+	err := c.do(ctx, http.MethodGet, "/status/approvals", nil, &proposals)
+	return proposals, err
+}
+
+// Approves the proposed scale down of the kpNode. An APIError with a status
+// of 404 is returned if no scale down of the kpNode is awaiting approval.
+func (c *Client) ApproveScaleDown(ctx context.Context, kpNodeName string) error {
+	return c.do(ctx, http.MethodPost, "/status/approvals/"+url.PathEscape(kpNodeName), nil, nil)
+}
+
+// Requests a scale up of a kpNode of the node class, or the first node class
+// if empty, and returns the queued scale event. An APIError with a status of
+// 409 is returned if the scale up would exceed maxKpNodes or the capacity of
+// the Proxmox cluster.
+func (c *Client) ScaleUp(ctx context.Context, nodeClass string) (*scaler.ScaleEvent, error) {
+	var scaleEvent scaler.ScaleEvent
+	err := c.do(ctx, http.MethodPost, "/status/scaleup", map[string]string{"nodeClass": nodeClass}, &scaleEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scaleEvent, nil
+}
+
+// Returns each kpNode along with the Proxmox VM backing it, ordered by name.
+func (c *Client) KpNodes(ctx context.Context) ([]scaler.KpNodeStatus, error) {
+	var statuses []scaler.KpNodeStatus
+	err := c.do(ctx, http.MethodGet, "/status/kpnodes", nil, &statuses)
+	return statuses, err
+}
+
+// Requests the kpNode be drained and removed and returns the queued scale
+// event. An APIError with a status of 404 is returned if it is not a kpNode.
+func (c *Client) Drain(ctx context.Context, kpNodeName string) (*scaler.ScaleEvent, error) {
+	var scaleEvent scaler.ScaleEvent
+	err := c.do(ctx, http.MethodPost, "/status/kpnodes/"+url.PathEscape(kpNodeName)+"/drain", nil, &scaleEvent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &scaleEvent, nil
+}
+
+// Returns the progress of the current or most recent evacuation.
+func (c *Client) Evacuation(ctx context.Context) (Evacuation, error) {
+	var evacuation Evacuation
+	err := c.do(ctx, http.MethodGet, "/status/evacuate", nil, &evacuation)
+	return evacuation, err
+}
+
+// Starts draining and removing every kpNode, one at a time, with autoscaling
+// suspended until it finishes. The evacuation is confirmed with the number of
+// kpNodes to be removed. An APIError with a status of 409 is returned if the
+// number doesn't match or an evacuation is already in progress.
+func (c *Client) Evacuate(ctx context.Context, confirm int) (Evacuation, error) {
+	var evacuation Evacuation
+	err := c.do(ctx, http.MethodPost, "/status/evacuate", map[string]int{"confirm": confirm}, &evacuation)
+	return evacuation, err
+}
+
+// Cancels the evacuation in progress once the kpNode being removed has been.
+// An APIError with a status of 409 is returned if there is none.
+func (c *Client) CancelEvacuation(ctx context.Context) error {
+	return c.do(ctx, http.MethodDelete, "/status/evacuate", nil, nil)
+}
@@ -0,0 +1,211 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+func TestScaleEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/scaleevents" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]scaler.ScaleEventStatus{
+			{NodeName: "kp-node-1", State: scaler.ScaleEventJoined},
+		})
+	}))
+	defer server.Close()
+
+	statusClient := New(server.URL + "/")
+	statusClient.Token = "secret"
+
+	statuses, err := statusClient.ScaleEvents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 1 || statuses[0].NodeName != "kp-node-1" || statuses[0].State != scaler.ScaleEventJoined {
+		t.Errorf("Unexpected scale events: %+v", statuses)
+	}
+}
+
+func TestScaleUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			NodeClass string `json:"nodeClass"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if r.Method != http.MethodPost || r.URL.Path != "/status/scaleup" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		if request.NodeClass != "large" {
+			http.Error(w, "scale up refused, unknown node class "+request.NodeClass, http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(scaler.ScaleEvent{
+			ScaleType: scaler.ScaleTypeUp,
+			NodeName:  "kp-node-1",
+			NodeClass: request.NodeClass,
+		})
+	}))
+	defer server.Close()
+
+	statusClient := New(server.URL)
+
+	scaleEvent, err := statusClient.ScaleUp(context.Background(), "large")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.NodeName != "kp-node-1" || scaleEvent.NodeClass != "large" {
+		t.Errorf("Unexpected scale event: %+v", scaleEvent)
+	}
+
+	_, err = statusClient.ScaleUp(context.Background(), "gpu")
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict || apiErr.Message != "scale up refused, unknown node class gpu" {
+		t.Errorf("Expected a conflict, got %v", err)
+	}
+}
+
+func TestApproveScaleDown(t *testing.T) {
+	approved := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		approved = r.URL.Path
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	err := New(server.URL).ApproveScaleDown(context.Background(), "kp-node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if approved != "/status/approvals/kp-node-1" {
+		t.Errorf("Expected kp-node-1 to be approved, got %s", approved)
+	}
+}
+
+func TestKpNodes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/kpnodes" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+
+		json.NewEncoder(w).Encode([]scaler.KpNodeStatus{
+			{Name: "kp-node-1", NodeClass: "default", Ready: true, VmID: 101, Host: "pve-01", VmStatus: "running"},
+		})
+	}))
+	defer server.Close()
+
+	kpNodes, err := New(server.URL).KpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 1 || kpNodes[0].VmID != 101 || kpNodes[0].Host != "pve-01" {
+		t.Errorf("Unexpected kpNodes: %+v", kpNodes)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/status/kpnodes/kp-node-1/drain" {
+			http.Error(w, "unknown kpNode", http.StatusNotFound)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(scaler.ScaleEvent{
+			ScaleType: scaler.ScaleTypeDown,
+			NodeName:  "kp-node-1",
+		})
+	}))
+	defer server.Close()
+
+	statusClient := New(server.URL)
+
+	scaleEvent, err := statusClient.Drain(context.Background(), "kp-node-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.ScaleType != scaler.ScaleTypeDown || scaleEvent.NodeName != "kp-node-1" {
+		t.Errorf("Unexpected scale event: %+v", scaleEvent)
+	}
+
+	_, err = statusClient.Drain(context.Background(), "control-plane-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected a 404 APIError, got %v", err)
+	}
+}
+
+func TestEvacuate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status/evacuate" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var request map[string]int
+			json.NewDecoder(r.Body).Decode(&request)
+			if request["confirm"] != 2 {
+				http.Error(w, "evacuation refused, confirm the evacuation with the number of kpNodes, 2", http.StatusConflict)
+				return
+			}
+
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(Evacuation{Active: true, Current: "kp-node-1", Remaining: []string{"kp-node-2"}})
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	statusClient := New(server.URL)
+
+	_, err := statusClient.Evacuate(context.Background(), 3)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a 409 APIError, got %v", err)
+	}
+
+	evacuation, err := statusClient.Evacuate(context.Background(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !evacuation.Active || evacuation.Current != "kp-node-1" || len(evacuation.Remaining) != 1 {
+		t.Errorf("Unexpected evacuation: %+v", evacuation)
+	}
+
+	err = statusClient.CancelEvacuation(context.Background())
+	if err != nil {
+		t.Errorf("Expected the evacuation to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"sigs.k8s.io/yaml"
+)
+
+// A node class described for generating its configuration, along with the
+// number of kpNodes a NodePool should hold of it, if any.
+type NodeClassSpec struct {
+	NodeClass
+	Replicas *int `json:"replicas,omitempty"`
+}
+
+// Reads the node classes described by a Helm values file, a kproximate
+// ConfigMap or a plain map of settings. Node classes are read from
+// kpNodeClasses, given as a list or JSON encoded, otherwise a single default
+// class is built from the top level kpNode settings as the controller would.
+func NodeClassesFromValues(values []byte) ([]NodeClassSpec, error) {
+	document := map[string]any{}
+	err := yaml.Unmarshal(values, &document)
+	if err != nil {
+		return nil, err
+	}
+
+	settings := document
+	if kproximate, ok := document["kproximate"].(map[string]any); ok {
+		settings, _ = kproximate["config"].(map[string]any)
+	} else if data, ok := document["data"].(map[string]any); ok && document["kind"] == "ConfigMap" {
+		settings = data
+	}
+
+	nodeClasses := []NodeClassSpec{}
+	switch kpNodeClasses := settings["kpNodeClasses"].(type) {
+	case string:
+		if kpNodeClasses != "" {
+			err = json.Unmarshal([]byte(kpNodeClasses), &nodeClasses)
+		}
+	case []any:
+		var encoded []byte
+		encoded, err = json.Marshal(kpNodeClasses)
+		if err == nil {
+			err = json.Unmarshal(encoded, &nodeClasses)
+		}
+	case nil:
+	default:
+		err = fmt.Errorf("expected a list, got %T", kpNodeClasses)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid kpNodeClasses: %w", err)
+	}
+
+	if len(nodeClasses) == 0 {
+		defaultClass := NodeClassSpec{NodeClass: NodeClass{Name: "default"}}
+		for setting, field := range map[string]*int{
+			"kpNodeCores":  &defaultClass.Cores,
+			"kpNodeMemory": &defaultClass.Memory,
+			"warmPoolSize": &defaultClass.WarmPoolSize,
+		} {
+			*field, err = intSetting(settings, setting)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		defaultClass.TemplateName, _ = settings["kpNodeTemplateName"].(string)
+
+		nodeClasses = append(nodeClasses, defaultClass)
+	}
+
+	names := map[string]bool{}
+	for _, nodeClass := range nodeClasses {
+		switch {
+		case nodeClass.Name == "":
+			return nil, fmt.Errorf("a node class has no name")
+		case names[nodeClass.Name]:
+			return nil, fmt.Errorf("node class %s is described more than once", nodeClass.Name)
+		case nodeClass.Replicas != nil && *nodeClass.Replicas < 0:
+			return nil, fmt.Errorf("node class %s has negative replicas", nodeClass.Name)
+		}
+
+		names[nodeClass.Name] = true
+	}
+
+	return nodeClasses, nil
+}
+
+// Reads a whole number setting given either as a number, as in a values
+// file, or as a string, as in a ConfigMap. Missing settings are 0.
+func intSetting(settings map[string]any, setting string) (int, error) {
+	switch value := settings[setting].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return int(value), nil
+	case string:
+		if value == "" {
+			return 0, nil
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %w", setting, err)
+		}
+
+		return number, nil
+	default:
+		return 0, fmt.Errorf("invalid %s: expected a number, got %T", setting, value)
+	}
+}
@@ -2,36 +2,373 @@ package config
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
 
+	"github.com/lupinelab/kproximate/identity"
 	"github.com/sethvargo/go-envconfig"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
+// A node class describes a shape of kpNode that can be provisioned. Unset
+// fields are inherited from the top level kpNode settings.
+type NodeClass struct {
+	Name         string `json:"name"`
+	Cores        int    `json:"cores"`
+	Memory       int    `json:"memory"`
+	TemplateName string `json:"templateName"`
+	// The maximum number of kpNodes of this class, 0 means only the global
+	// maxKpNodes limit applies
+	MaxNodes int `json:"maxNodes"`
+	// Higher priority classes are preferred by the priority expander
+	Priority int `json:"priority"`
+	// Scale ups of this class are consumed by workers ahead of those with a
+	// lower priority, e.g. for GPU node classes. Between 0 and 9.
+	EventPriority int `json:"eventPriority"`
+	// Applied to kpNodes of this class and matched against the topology of
+	// pending pods' volumes
+	Labels map[string]string `json:"labels"`
+	// Restricts kpNodes of this class to a single Proxmox host
+	TargetHost string `json:"targetHost"`
+	// In GiB, the root disk is grown to this size after cloning, 0 keeps the
+	// template's disk size
+	DiskSize int `json:"diskSize"`
+	// The disk resized by diskSize, defaults to scsi0
+	RootDisk string `json:"rootDisk"`
+	// Additional disks created on kpNodes of this class
+	DataDisks []DataDisk `json:"dataDisks"`
+	// Memory ballooning for kpNodes of this class, disabled unless enabled
+	Balloon Balloon `json:"balloon"`
+	// The cpu type and topology of kpNodes of this class
+	Cpu Cpu `json:"cpu"`
+	// Proxmox firewall settings for kpNodes of this class
+	Firewall Firewall `json:"firewall"`
+	// The format of the user-data passed to kpNodes of this class, either
+	// cloud-init or ignition for Flatcar and Fedora CoreOS templates
+	UserDataFormat string `json:"userDataFormat"`
+	// The number of stopped kpNodes of this class kept cloned and ready to
+	// be started by scale up events
+	WarmPoolSize int `json:"warmPoolSize"`
+	// The extended resources, such as nvidia.com/gpu or hugepages-2Mi, each
+	// kpNode of this class provides, e.g. through PCI passthrough in its
+	// template. Only these node classes are scaled up for pods requesting them.
+	ExtendedResources map[string]resource.Quantity `json:"extendedResources"`
+	// The taints kpNodes of this class register with, e.g. using the
+	// kubelet's --register-with-taints in the template. Pending pods which do
+	// not tolerate them are not scaled up for.
+	Taints []apiv1.Taint `json:"taints"`
+	// The kubelet's maxPods on kpNodes of this class, defaults to 110
+	MaxPods int `json:"maxPods"`
+}
+
+// Proxmox memory ballooning settings. The node class memory is the most
+// memory the VM can use and the balloon driver may reclaim memory from the
+// VM down to MinMemory when the Proxmox host is under memory pressure.
+type Balloon struct {
+	Enabled bool `json:"enabled"`
+	// In MiB, defaults to the node class memory
+	MinMemory int `json:"minMemory"`
+	// The weight given to the VM when the host reclaims memory, 0 uses the
+	// Proxmox default
+	Shares int `json:"shares"`
+}
+
+// Proxmox cpu settings, those left unset keep the template's settings. The
+// node class cores are the total across all sockets.
+type Cpu struct {
+	// The emulated cpu type, e.g. host or x86-64-v3
+	Type string `json:"type"`
+	// Exposes the sockets to the guest as NUMA nodes
+	Numa bool `json:"numa"`
+	// Must divide the node class cores, otherwise a single socket is used
+	Sockets int `json:"sockets"`
+	// The weight given to the VM's cpu time relative to other VMs, 0 uses
+	// the Proxmox default
+	Units int `json:"units"`
+	// The most host cpu time the VM may use in cores, 0 is unlimited
+	Limit float64 `json:"limit"`
+}
+
+// An additional disk created on kpNodes after cloning, e.g. for Longhorn or
+// OpenEBS. Disks with a mountPath are formatted and mounted by cloud-init.
+type DataDisk struct {
+	// In GiB
+	Size int `json:"size"`
+	// Defaults to the storage of the root disk
+	Storage string `json:"storage"`
+	// scsi, virtio or sata, defaults to scsi
+	Bus string `json:"bus"`
+	// Left unformatted and unmounted when empty
+	MountPath string `json:"mountPath"`
+	// Defaults to ext4
+	Filesystem string `json:"filesystem"`
+}
+
+// Proxmox firewall settings applied to kpNodes when they are cloned, before
+// they are first started.
+type Firewall struct {
+	Enabled bool `json:"enabled"`
+	// Proxmox cluster security groups assigned to the VM
+	SecurityGroups []string `json:"securityGroups"`
+	// ACCEPT, REJECT or DROP, the Proxmox default is used when unset
+	PolicyIn  string `json:"policyIn"`
+	PolicyOut string `json:"policyOut"`
+}
+
+func firewallPolicy(policy string) string {
+	policy = strings.ToUpper(policy)
+	switch policy {
+	case "ACCEPT", "REJECT", "DROP":
+		return policy
+	default:
+		return ""
+	}
+}
+
+type NodeClasses []NodeClass
+
+// Node classes are configured as a JSON encoded list
+func (n *NodeClasses) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), n)
+}
+
+// A PromQL expression evaluated against prometheusUrl on each poll, which
+// must return a single sample. Thresholds left unset are ignored.
+type ScalingQuery struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// A kpNode is requested while the result is above this
+	ScaleUpThreshold *float64 `json:"scaleUpThreshold"`
+	// Scale down is held off while the result is at or above this
+	ScaleDownThreshold *float64 `json:"scaleDownThreshold"`
+	// The node class scaled up, chosen by priority when empty
+	NodeClass string `json:"nodeClass"`
+}
+
+type ScalingQueries []ScalingQuery
+
+// Scaling queries are configured as a JSON encoded list
+func (q *ScalingQueries) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), q)
+}
+
+// Keeps at least Nodes kpNodes of a node class during a daily window, e.g. to
+// have capacity ready ahead of a known busy period.
+type ScaleSchedule struct {
+	Name string `json:"name"`
+	// Abbreviated days of the week, e.g. ["Mon", "Fri"], every day when empty
+	Days []string `json:"days"`
+	// The window in the controller's local time as "15:04", an end before the
+	// start spans midnight and an equal start and end spans the whole day
+	Start string `json:"start"`
+	End   string `json:"end"`
+	Nodes int    `json:"nodes"`
+	// Defaults to the first node class
+	NodeClass string `json:"nodeClass"`
+}
+
+type ScaleSchedules []ScaleSchedule
+
+// Scale schedules are configured as a JSON encoded list
+func (s *ScaleSchedules) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), s)
+}
+
+// Timeouts, in seconds, of the steps of provisioning a kpNode. 0 leaves a step
+// bounded only by waitSecondsForProvision.
+type OperationTimeouts struct {
+	// Cloning and configuring the VM
+	CloneSeconds int `json:"cloneSeconds"`
+	// Proxmox reporting the VM as running once it has been started
+	StartSeconds int `json:"startSeconds"`
+	// The qemu guest agent responding, only waited for with kpQemuExecJoin
+	AgentReadySeconds int `json:"agentReadySeconds"`
+}
+
+// Probabilities, between 0 and 1, of simulated failures for testing alerts and
+// the retry and cleanup paths in staging. Never set in production.
+type FailureInjection struct {
+	// A scale up fails as if its clone timed out, after the VM is created
+	CloneFailure float64 `json:"cloneFailure"`
+	// A scale up fails as if its kpNode did not join in time
+	JoinTimeout float64 `json:"joinTimeout"`
+	// A worker loses its queue connection on receiving a scale event
+	QueueDisconnect float64 `json:"queueDisconnect"`
+	// A Proxmox API request fails with a 500 response
+	ProxmoxError float64 `json:"proxmoxError"`
+}
+
+// Failure injection is configured as a JSON encoded object
+func (f *FailureInjection) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), f)
+}
+
+func (f FailureInjection) Enabled() bool {
+	return f != (FailureInjection{})
+}
+
+// Whether a failure injected with the probability occurs
+func Injected(probability float64) bool {
+	return probability > 0 && rand.Float64() < probability
+}
+
+// Operation timeouts by the Proxmox storage kpNodes are cloned to. The
+// "default" entry applies to storages without their own.
+type StorageTimeouts map[string]OperationTimeouts
+
+// Storage timeouts are configured as a JSON encoded object
+func (t *StorageTimeouts) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	return json.Unmarshal([]byte(value), t)
+}
+
 type KproximateConfig struct {
-	Debug                   bool   `env:"debug"`
-	KpJoinCommand           string `env:"kpJoinCommand"`
-	KpNodeCores             int    `env:"kpNodeCores"`
-	KpNodeDisableSsh        bool   `env:"kpNodeDisableSsh"`
-	KpNodeMemory            int    `env:"kpNodeMemory"`
-	KpNodeLabels            string `env:"kpNodeLabels"`
-	KpNodeNamePrefix        string `env:"kpNodeNamePrefix"`
-	KpNodeNameRegex         regexp.Regexp
-	KpNodeParams            map[string]interface{}
-	KpNodeTemplateName      string  `env:"kpNodeTemplateName"`
-	KpQemuExecJoin          bool    `env:"kpQemuExecJoin"`
-	KpLocalTemplateStorage  bool    `env:"kpLocalTemplateStorage"`
-	LoadHeadroom            float64 `env:"loadHeadroom"`
-	MaxKpNodes              int     `env:"maxKpNodes"`
-	PmAllowInsecure         bool    `env:"pmAllowInsecure"`
-	PmDebug                 bool    `env:"pmDebug"`
-	PmPassword              string  `env:"pmPassword"`
-	PmToken                 string  `env:"pmToken"`
-	PmUrl                   string  `env:"pmUrl"`
-	PmUserID                string  `env:"pmUserID"`
-	PollInterval            int     `env:"pollInterval"`
-	SshKey                  string  `env:"sshKey"`
-	WaitSecondsForJoin      int     `env:"waitSecondsForJoin"`
-	WaitSecondsForProvision int     `env:"waitSecondsForProvision"`
+	AllowLocalStorageEviction   bool             `env:"allowLocalStorageEviction"`
+	ApiAuth                     string           `env:"apiAuth"`
+	ApiReadToken                string           `env:"apiReadToken"`
+	ApiScaleToken               string           `env:"apiScaleToken"`
+	Bootstrap                   bool             `env:"bootstrap"`
+	BootstrapKpNodes            int              `env:"bootstrapKpNodes"`
+	BootstrapNodeClass          string           `env:"bootstrapNodeClass"`
+	BurstConcurrency            int              `env:"burstConcurrency"`
+	BurstThreshold              int              `env:"burstThreshold"`
+	ChatOpsSigningSecret        string           `env:"chatOpsSigningSecret"`
+	ChatOpsUsers                string           `env:"chatOpsUsers"`
+	ClusterName                 string           `env:"clusterName"`
+	ConfigDir                   string           `env:"configDir"`
+	CostPerCoreHour             float64          `env:"costPerCoreHour"`
+	CostPerGiBHour              float64          `env:"costPerGiBHour"`
+	CpuOvercommitRatio          float64          `env:"cpuOvercommitRatio"`
+	Debug                       bool             `env:"debug"`
+	DisablePermissionCheck      bool             `env:"disablePermissionCheck"`
+	DisableProxmoxHealthCheck   bool             `env:"disableProxmoxHealthCheck"`
+	DrainForceDeleteSeconds     int              `env:"drainForceDeleteSeconds"`
+	DrainGracePeriodSeconds     int              `env:"drainGracePeriodSeconds"`
+	DrainHosts                  bool             `env:"drainHosts"`
+	Expander                    string           `env:"expander"`
+	FailureInjection            FailureInjection `env:"failureInjection"`
+	GrpcAddress                 string           `env:"grpcAddress"`
+	GrpcCAFile                  string           `env:"grpcCAFile"`
+	GrpcCertFile                string           `env:"grpcCertFile"`
+	GrpcKeyFile                 string           `env:"grpcKeyFile"`
+	GrpcListenAddress           string           `env:"grpcListenAddress"`
+	HibernateKpNodes            int              `env:"hibernateKpNodes"`
+	HibernateMaxAgeSeconds      int              `env:"hibernateMaxAgeSeconds"`
+	HostPreference              []string         `env:"hostPreference"`
+	HostWeights                 map[string]int   `env:"hostWeights"`
+	InstanceID                  string           `env:"instanceID"`
+	InformerResyncSeconds       int              `env:"informerResyncSeconds"`
+	InitFailedSeconds           int              `env:"initFailedSeconds"`
+	KpJoinCommand               string           `env:"kpJoinCommand"`
+	KpJoinCommandTemplate       bool             `env:"kpJoinCommandTemplate"`
+	KpJoinSecret                string           `env:"kpJoinSecret"`
+	KpNodeClasses               NodeClasses      `env:"kpNodeClasses"`
+	KpNodeCores                 int              `env:"kpNodeCores"`
+	KpNodeDisableSsh            bool             `env:"kpNodeDisableSsh"`
+	KpNodeDisableTopologyLabels bool             `env:"kpNodeDisableTopologyLabels"`
+	KpNodeIgnitionConfig        string           `env:"kpNodeIgnitionConfig"`
+	KpNodeMemory                int              `env:"kpNodeMemory"`
+	KpNodeLabels                string           `env:"kpNodeLabels"`
+	KpNodeNamePrefix            string           `env:"kpNodeNamePrefix"`
+	KpNodeNameRegex             regexp.Regexp
+	KpNodeNameScheme            string          `env:"kpNodeNameScheme"`
+	KpNodeOsType                string          `env:"kpNodeOsType"`
+	KpNodeNetworkConfig         string          `env:"kpNodeNetworkConfig"`
+	KpNodeParams                KpNodeParams    `env:"kpNodeParams"`
+	KpNodeSnippetDir            string          `env:"kpNodeSnippetDir"`
+	KpNodeSnippetStorage        string          `env:"kpNodeSnippetStorage"`
+	KpNodeStartupTaint          bool            `env:"kpNodeStartupTaint"`
+	KpNodeTalosConfig           string          `env:"kpNodeTalosConfig"`
+	KpNodeTemplateName          string          `env:"kpNodeTemplateName"`
+	KpNodeUserData              string          `env:"kpNodeUserData"`
+	KpNodeVendorData            string          `env:"kpNodeVendorData"`
+	KpQemuExecJoin              bool            `env:"kpQemuExecJoin"`
+	KpTemplateGCRegex           string          `env:"kpTemplateGCRegex"`
+	KpLocalTemplateStorage      bool            `env:"kpLocalTemplateStorage"`
+	KubeBurst                   int             `env:"kubeBurst"`
+	KubeContext                 string          `env:"kubeContext"`
+	KubeInCluster               bool            `env:"kubeInCluster"`
+	KubeQps                     float64         `env:"kubeQps"`
+	KubeRequestTimeoutSeconds   int             `env:"kubeRequestTimeoutSeconds"`
+	Kubeconfig                  string          `env:"kubeconfig"`
+	LoadHeadroom                float64         `env:"loadHeadroom"`
+	MaxKpNodes                  int             `env:"maxKpNodes"`
+	MaxKpNodesAuto              bool            `env:"maxKpNodesAuto"`
+	MaxKpNodesHeadroom          float64         `env:"maxKpNodesHeadroom"`
+	MaxScaleDownPerInterval     int             `env:"maxScaleDownPerInterval"`
+	MemoryOvercommitRatio       float64         `env:"memoryOvercommitRatio"`
+	NodePools                   bool            `env:"nodePools"`
+	ObserverMode                bool            `env:"observerMode"`
+	OverprovisionCpu            string          `env:"overprovisionCpu"`
+	OverprovisionMemory         string          `env:"overprovisionMemory"`
+	OverprovisionPriority       int             `env:"overprovisionPriority"`
+	OverprovisionReplicas       int             `env:"overprovisionReplicas"`
+	PatchCommand                string          `env:"patchCommand"`
+	PatchIntervalHours          int             `env:"patchIntervalHours"`
+	PatchReboot                 bool            `env:"patchReboot"`
+	PatchTimeoutSeconds         int             `env:"patchTimeoutSeconds"`
+	PmAllowInsecure             bool            `env:"pmAllowInsecure"`
+	PmCaBundle                  string          `env:"pmCaBundle"`
+	PmCacheSeconds              int             `env:"pmCacheSeconds"`
+	PmDebug                     bool            `env:"pmDebug"`
+	PmPassword                  string          `env:"pmPassword"`
+	PmProxyUrl                  string          `env:"pmProxyUrl"`
+	PmToken                     string          `env:"pmToken"`
+	PmUrl                       string          `env:"pmUrl"`
+	PmUserID                    string          `env:"pmUserID"`
+	PodName                     string          `env:"podName"`
+	PodNamespace                string          `env:"podNamespace"`
+	PollInterval                int             `env:"pollInterval"`
+	PrometheusUrl               string          `env:"prometheusUrl"`
+	RebalanceSkew               int             `env:"rebalanceSkew"`
+	ReplaceStrandedNodes        bool            `env:"replaceStrandedNodes"`
+	RoutingRules                RoutingRules    `env:"routingRules"`
+	ScaleDownApproval           bool            `env:"scaleDownApproval"`
+	ScaleDownOnUsage            bool            `env:"scaleDownOnUsage"`
+	ScaleDownTriggerPods        int             `env:"scaleDownTriggerPods"`
+	ScaleEventPriorities        map[string]int  `env:"scaleEventPriorities"`
+	ScaleEventVersion           int             `env:"scaleEventVersion"`
+	ScaleSchedules              ScaleSchedules  `env:"scaleSchedules"`
+	ScaleTriggers               []string        `env:"scaleTriggers"`
+	ScaleUpDebounceSeconds      int             `env:"scaleUpDebounceSeconds"`
+	ScalingQueries              ScalingQueries  `env:"scalingQueries"`
+	SecretsDir                  string          `env:"secretsDir"`
+	SshKey                      string          `env:"sshKey"`
+	StorageTimeouts             StorageTimeouts `env:"storageTimeouts"`
+	StuckScaleEventSeconds      int             `env:"stuckScaleEventSeconds"`
+	Transport                   string          `env:"transport"`
+	WaitSecondsForJoin          int             `env:"waitSecondsForJoin"`
+	WaitSecondsForNetwork       int             `env:"waitSecondsForNetwork"`
+	WaitSecondsForProvision     int             `env:"waitSecondsForProvision"`
+	WarmPoolSize                int             `env:"warmPoolSize"`
+	WorkerConcurrency           int             `env:"workerConcurrency"`
 }
 
 type RabbitConfig struct {
@@ -41,23 +378,215 @@ type RabbitConfig struct {
 	User     string `env:"rabbitMQUser"`
 }
 
+// Reads the config from the environment, with any settings in the secretsDir
+// taking precedence.
 func GetKpConfig() (KproximateConfig, error) {
 	config := &KproximateConfig{}
 
-	err := envconfig.Process(context.Background(), config)
+	err := envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target:   config,
+		Lookuper: withSecrets(envconfig.OsLookuper()),
+	})
 	if err != nil {
 		return *config, err
 	}
 
 	*config = validateConfig(config)
 
+	err = config.KpNodeParams.Validate()
+	if err != nil {
+		return *config, fmt.Errorf("invalid kpNodeParams: %w", err)
+	}
+
 	return *config, nil
 }
 
+// Reads the config from a directory containing a file per setting, such as a
+// mounted ConfigMap, falling back to the environment for any missing settings.
+// Settings in the secretsDir take precedence over both.
+func GetKpConfigFromDir(dir string) (KproximateConfig, error) {
+	config := &KproximateConfig{}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return *config, err
+	}
+
+	values := map[string]string{}
+	for _, file := range files {
+		// Skip the hidden files and directories kubernetes uses to manage
+		// mounted ConfigMaps
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		value, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return *config, err
+		}
+
+		values[file.Name()] = strings.TrimSpace(string(value))
+	}
+
+	err = envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target: config,
+		Lookuper: withSecrets(
+			envconfig.MapLookuper(values),
+			envconfig.OsLookuper(),
+		),
+	})
+	if err != nil {
+		return *config, err
+	}
+
+	*config = validateConfig(config)
+
+	err = config.KpNodeParams.Validate()
+	if err != nil {
+		return *config, fmt.Errorf("invalid kpNodeParams: %w", err)
+	}
+
+	return *config, nil
+}
+
+// Returns the names of the settings kproximate does not recognise, e.g. the
+// files of a ConfigMap about to be deployed, so that typos can be caught.
+func UnknownSettings(settings []string) []string {
+	known := map[string]bool{}
+	configType := reflect.TypeOf(KproximateConfig{})
+	for i := range configType.NumField() {
+		name, _, _ := strings.Cut(configType.Field(i).Tag.Get("env"), ",")
+		if name != "" {
+			known[name] = true
+		}
+	}
+
+	unknown := []string{}
+	for _, setting := range settings {
+		if !known[setting] {
+			unknown = append(unknown, setting)
+		}
+	}
+
+	return unknown
+}
+
+// Copies the settings which can be changed at runtime from updated to current
+// and returns a description of each setting that changed.
+func ApplyReloadableSettings(current *KproximateConfig, updated KproximateConfig) []string {
+	changes := []string{}
+
+	if current.CpuOvercommitRatio != updated.CpuOvercommitRatio {
+		changes = append(changes, fmt.Sprintf("cpuOvercommitRatio: %v -> %v", current.CpuOvercommitRatio, updated.CpuOvercommitRatio))
+		current.CpuOvercommitRatio = updated.CpuOvercommitRatio
+	}
+
+	if current.LoadHeadroom != updated.LoadHeadroom {
+		changes = append(changes, fmt.Sprintf("loadHeadroom: %v -> %v", current.LoadHeadroom, updated.LoadHeadroom))
+		current.LoadHeadroom = updated.LoadHeadroom
+	}
+
+	if current.MaxKpNodes != updated.MaxKpNodes {
+		changes = append(changes, fmt.Sprintf("maxKpNodes: %d -> %d", current.MaxKpNodes, updated.MaxKpNodes))
+		current.MaxKpNodes = updated.MaxKpNodes
+	}
+
+	if current.MaxKpNodesAuto != updated.MaxKpNodesAuto {
+		changes = append(changes, fmt.Sprintf("maxKpNodesAuto: %t -> %t", current.MaxKpNodesAuto, updated.MaxKpNodesAuto))
+		current.MaxKpNodesAuto = updated.MaxKpNodesAuto
+	}
+
+	if current.MaxKpNodesHeadroom != updated.MaxKpNodesHeadroom {
+		changes = append(changes, fmt.Sprintf("maxKpNodesHeadroom: %v -> %v", current.MaxKpNodesHeadroom, updated.MaxKpNodesHeadroom))
+		current.MaxKpNodesHeadroom = updated.MaxKpNodesHeadroom
+	}
+
+	if current.MaxScaleDownPerInterval != updated.MaxScaleDownPerInterval {
+		changes = append(changes, fmt.Sprintf("maxScaleDownPerInterval: %d -> %d", current.MaxScaleDownPerInterval, updated.MaxScaleDownPerInterval))
+		current.MaxScaleDownPerInterval = updated.MaxScaleDownPerInterval
+	}
+
+	if current.MemoryOvercommitRatio != updated.MemoryOvercommitRatio {
+		changes = append(changes, fmt.Sprintf("memoryOvercommitRatio: %v -> %v", current.MemoryOvercommitRatio, updated.MemoryOvercommitRatio))
+		current.MemoryOvercommitRatio = updated.MemoryOvercommitRatio
+	}
+
+	if current.OverprovisionReplicas != updated.OverprovisionReplicas {
+		changes = append(changes, fmt.Sprintf("overprovisionReplicas: %d -> %d", current.OverprovisionReplicas, updated.OverprovisionReplicas))
+		current.OverprovisionReplicas = updated.OverprovisionReplicas
+	}
+
+	if current.PollInterval != updated.PollInterval {
+		changes = append(changes, fmt.Sprintf("pollInterval: %d -> %d", current.PollInterval, updated.PollInterval))
+		current.PollInterval = updated.PollInterval
+	}
+
+	return changes
+}
+
+// Returns the configured node classes, or a single default class built from
+// the top level kpNode settings if none are configured.
+func (config KproximateConfig) NodeClasses() []NodeClass {
+	if len(config.KpNodeClasses) > 0 {
+		return config.KpNodeClasses
+	}
+
+	return []NodeClass{
+		{
+			Name:         "default",
+			Cores:        config.KpNodeCores,
+			Memory:       config.KpNodeMemory,
+			TemplateName: config.KpNodeTemplateName,
+			WarmPoolSize: config.WarmPoolSize,
+		},
+	}
+}
+
+// Returns the operation timeouts of kpNodes cloned to the storage.
+func (config KproximateConfig) OperationTimeouts(storage string) OperationTimeouts {
+	if timeouts, ok := config.StorageTimeouts[storage]; ok {
+		return timeouts
+	}
+
+	return config.StorageTimeouts["default"]
+}
+
+// Returns the named node class, or the first node class if it does not exist.
+func (config KproximateConfig) NodeClass(name string) NodeClass {
+	nodeClasses := config.NodeClasses()
+	for _, nodeClass := range nodeClasses {
+		if nodeClass.Name == name {
+			return nodeClass
+		}
+	}
+
+	return nodeClasses[0]
+}
+
+// Returns the name of a queue scoped to this kproximate instance.
+func (config KproximateConfig) QueueName(name string) string {
+	if config.InstanceID == "" {
+		return name
+	}
+
+	return fmt.Sprintf("%s-%s", name, config.InstanceID)
+}
+
+// Returns how this kproximate instance names its kpNodes.
+func (config KproximateConfig) KpNodeNaming() identity.Naming {
+	return identity.Naming{
+		Prefix: config.KpNodeNamePrefix,
+		Scheme: config.KpNodeNameScheme,
+	}
+}
+
 func GetRabbitConfig() (RabbitConfig, error) {
 	config := &RabbitConfig{}
 
-	err := envconfig.Process(context.Background(), config)
+	err := envconfig.ProcessWith(context.Background(), &envconfig.Config{
+		Target:   config,
+		Lookuper: withSecrets(envconfig.OsLookuper()),
+	})
 	if err != nil {
 		return *config, err
 	}
@@ -65,7 +594,339 @@ func GetRabbitConfig() (RabbitConfig, error) {
 	return *config, nil
 }
 
+// The highest priority of a scale event, AMQP priorities are a single byte
+// but RabbitMQ recommends using no more than 10 levels
+const MaxScaleEventPriority = 9
+
+func clampScaleEventPriority(priority int) int {
+	return min(max(priority, 0), MaxScaleEventPriority)
+}
+
 func validateConfig(config *KproximateConfig) KproximateConfig {
+	// A misspelt mode requires tokens rather than leaving the API open
+	switch config.ApiAuth = strings.ToLower(config.ApiAuth); config.ApiAuth {
+	case "", "none":
+		config.ApiAuth = "none"
+	case "kubernetes":
+	default:
+		config.ApiAuth = "token"
+	}
+
+	switch config.KpNodeOsType {
+	case "windows", "talos":
+	default:
+		config.KpNodeOsType = "linux"
+	}
+
+	// Windows templates are joined by executing the join command via the
+	// guest agent once cloudbase-init has finished
+	if config.KpNodeOsType == "windows" {
+		config.KpQemuExecJoin = true
+	}
+
+	// The join command is only rendered as a go template when it needs values
+	// known per node, so braces in a plain join command are left alone
+	if config.KpNodeOsType == "windows" || config.KpJoinSecret != "" {
+		config.KpJoinCommandTemplate = true
+	}
+
+	// Talos has no shell, nodes join using the machine config passed as
+	// user-data
+	if config.KpNodeOsType == "talos" {
+		config.KpQemuExecJoin = false
+	}
+
+	if config.MaxKpNodes < 0 {
+		config.MaxKpNodes = 0
+	}
+
+	// The share of each Proxmox host's memory kept free by maxKpNodesAuto
+	if config.MaxKpNodesHeadroom <= 0 || config.MaxKpNodesHeadroom >= 1 {
+		config.MaxKpNodesHeadroom = 0.1
+	}
+
+	if config.WarmPoolSize < 0 {
+		config.WarmPoolSize = 0
+	}
+
+	if config.OverprovisionReplicas < 0 {
+		config.OverprovisionReplicas = 0
+	}
+
+	if _, err := resource.ParseQuantity(config.OverprovisionCpu); err != nil {
+		config.OverprovisionCpu = "500m"
+	}
+
+	if _, err := resource.ParseQuantity(config.OverprovisionMemory); err != nil {
+		config.OverprovisionMemory = "512Mi"
+	}
+
+	// Placeholder pods must be preempted by every workload, including those
+	// without a PriorityClass which have a priority of 0
+	if config.OverprovisionPriority >= 0 {
+		config.OverprovisionPriority = -10
+	}
+
+	if config.PmCacheSeconds < 0 {
+		config.PmCacheSeconds = 0
+	}
+
+	if config.KubeRequestTimeoutSeconds <= 0 {
+		config.KubeRequestTimeoutSeconds = 30
+	}
+
+	// client-go's defaults
+	if config.KubeQps <= 0 {
+		config.KubeQps = 5
+	}
+
+	if config.KubeBurst <= 0 {
+		config.KubeBurst = 10
+	}
+
+	// A burst below the rate would throttle every request
+	config.KubeBurst = max(config.KubeBurst, int(math.Ceil(config.KubeQps)))
+
+	if config.DrainGracePeriodSeconds < 0 {
+		config.DrainGracePeriodSeconds = 0
+	}
+
+	if config.DrainForceDeleteSeconds < 0 {
+		config.DrainForceDeleteSeconds = 0
+	}
+
+	for host, weight := range config.HostWeights {
+		config.HostWeights[host] = max(weight, 0)
+	}
+
+	// Moving a kpNode between pHosts whose counts differ by 1 only swaps them
+	if config.RebalanceSkew < 0 {
+		config.RebalanceSkew = 0
+	} else if config.RebalanceSkew == 1 {
+		config.RebalanceSkew = 2
+	}
+
+	if config.BootstrapKpNodes <= 0 {
+		config.BootstrapKpNodes = 1
+	}
+
+	if config.BurstThreshold < 0 {
+		config.BurstThreshold = 0
+	}
+
+	if config.BurstConcurrency < 0 {
+		config.BurstConcurrency = 0
+	}
+
+	if config.CostPerCoreHour < 0 {
+		config.CostPerCoreHour = 0
+	}
+
+	if config.CostPerGiBHour < 0 {
+		config.CostPerGiBHour = 0
+	}
+
+	if config.ScaleEventVersion < 0 {
+		config.ScaleEventVersion = 0
+	}
+
+	for priorityClass, priority := range config.ScaleEventPriorities {
+		config.ScaleEventPriorities[priorityClass] = clampScaleEventPriority(priority)
+	}
+
+	if config.PatchIntervalHours < 0 {
+		config.PatchIntervalHours = 0
+	}
+
+	if config.PatchTimeoutSeconds <= 0 {
+		config.PatchTimeoutSeconds = 1800
+	}
+
+	if config.HibernateKpNodes < 0 {
+		config.HibernateKpNodes = 0
+	}
+
+	if config.HibernateMaxAgeSeconds <= 0 {
+		config.HibernateMaxAgeSeconds = 604800
+	}
+
+	config.Expander = strings.ToLower(config.Expander)
+	switch config.Expander {
+	case "least-waste", "most-pods", "random":
+	default:
+		config.Expander = "priority"
+	}
+
+	for idx := range config.KpNodeClasses {
+		nodeClass := &config.KpNodeClasses[idx]
+
+		if nodeClass.Name == "" {
+			nodeClass.Name = fmt.Sprintf("class-%d", idx)
+		}
+
+		if nodeClass.Cores == 0 {
+			nodeClass.Cores = config.KpNodeCores
+		}
+
+		if nodeClass.Memory == 0 {
+			nodeClass.Memory = config.KpNodeMemory
+		}
+
+		if nodeClass.TemplateName == "" {
+			nodeClass.TemplateName = config.KpNodeTemplateName
+		}
+
+		if nodeClass.MaxNodes < 0 {
+			nodeClass.MaxNodes = 0
+		}
+
+		nodeClass.EventPriority = clampScaleEventPriority(nodeClass.EventPriority)
+
+		if nodeClass.Balloon.MinMemory <= 0 || nodeClass.Balloon.MinMemory > nodeClass.Memory {
+			nodeClass.Balloon.MinMemory = nodeClass.Memory
+		}
+
+		if nodeClass.Balloon.Shares < 0 {
+			nodeClass.Balloon.Shares = 0
+		}
+
+		nodeClass.Cpu.Type = strings.TrimSpace(nodeClass.Cpu.Type)
+
+		if nodeClass.Cpu.Sockets < 0 {
+			nodeClass.Cpu.Sockets = 0
+		}
+
+		if nodeClass.Cpu.Sockets > 0 && nodeClass.Cores%nodeClass.Cpu.Sockets != 0 {
+			nodeClass.Cpu.Sockets = 1
+		}
+
+		if nodeClass.Cpu.Units < 0 {
+			nodeClass.Cpu.Units = 0
+		}
+
+		if nodeClass.Cpu.Limit < 0 || nodeClass.Cpu.Limit > float64(nodeClass.Cores) {
+			nodeClass.Cpu.Limit = 0
+		}
+
+		if nodeClass.DiskSize < 0 {
+			nodeClass.DiskSize = 0
+		}
+
+		if nodeClass.WarmPoolSize < 0 {
+			nodeClass.WarmPoolSize = 0
+		}
+
+		if nodeClass.RootDisk == "" {
+			nodeClass.RootDisk = "scsi0"
+		}
+
+		dataDisks := []DataDisk{}
+		for _, dataDisk := range nodeClass.DataDisks {
+			if dataDisk.Size <= 0 {
+				continue
+			}
+
+			dataDisk.Bus = strings.ToLower(dataDisk.Bus)
+			if dataDisk.Bus != "virtio" && dataDisk.Bus != "sata" {
+				dataDisk.Bus = "scsi"
+			}
+
+			if dataDisk.Filesystem == "" {
+				dataDisk.Filesystem = "ext4"
+			}
+
+			dataDisks = append(dataDisks, dataDisk)
+		}
+		nodeClass.DataDisks = dataDisks
+
+		nodeClass.UserDataFormat = strings.ToLower(nodeClass.UserDataFormat)
+		if nodeClass.UserDataFormat != "ignition" {
+			nodeClass.UserDataFormat = "cloud-init"
+		}
+
+		nodeClass.Firewall.PolicyIn = firewallPolicy(nodeClass.Firewall.PolicyIn)
+		nodeClass.Firewall.PolicyOut = firewallPolicy(nodeClass.Firewall.PolicyOut)
+	}
+
+	scalingQueries := ScalingQueries{}
+	for idx, scalingQuery := range config.ScalingQueries {
+		if strings.TrimSpace(scalingQuery.Query) == "" {
+			continue
+		}
+
+		if scalingQuery.Name == "" {
+			scalingQuery.Name = fmt.Sprintf("query-%d", idx)
+		}
+
+		scalingQueries = append(scalingQueries, scalingQuery)
+	}
+	config.ScalingQueries = scalingQueries
+
+	for idx := range config.ScaleSchedules {
+		scaleSchedule := &config.ScaleSchedules[idx]
+		if scaleSchedule.Name == "" {
+			scaleSchedule.Name = fmt.Sprintf("schedule-%d", idx)
+		}
+
+		if scaleSchedule.Nodes < 0 {
+			scaleSchedule.Nodes = 0
+		}
+	}
+
+	if config.Transport != "grpc" {
+		config.Transport = "rabbitmq"
+	}
+
+	if config.GrpcListenAddress == "" {
+		config.GrpcListenAddress = ":50051"
+	}
+
+	if config.KpNodeSnippetStorage != "" && config.KpNodeSnippetDir == "" {
+		config.KpNodeSnippetDir = "/var/lib/kproximate/snippets"
+	}
+
+	// Instances are distinguished by their kpNode names so that several
+	// kproximate deployments can share a kubernetes cluster
+	config.InstanceID = strings.ToLower(strings.TrimSpace(config.InstanceID))
+	if config.InstanceID != "" {
+		config.KpNodeNamePrefix = fmt.Sprintf("%s-%s", config.KpNodeNamePrefix, config.InstanceID)
+	}
+
+	config.KpNodeNameScheme = strings.ToLower(strings.TrimSpace(config.KpNodeNameScheme))
+	if !identity.ValidScheme(config.KpNodeNameScheme) {
+		config.KpNodeNameScheme = identity.SchemeUUID
+	}
+
+	config.KpNodeNameRegex = *config.KpNodeNaming().Regex()
+
+	if config.WorkerConcurrency < 1 {
+		config.WorkerConcurrency = 1
+	}
+
+	if config.InformerResyncSeconds <= 0 {
+		config.InformerResyncSeconds = 300
+	}
+
+	if config.ScaleDownTriggerPods < 0 {
+		config.ScaleDownTriggerPods = 0
+	}
+
+	if config.ScaleUpDebounceSeconds <= 0 {
+		config.ScaleUpDebounceSeconds = 30
+	}
+
+	if config.MaxScaleDownPerInterval < 1 {
+		config.MaxScaleDownPerInterval = 1
+	}
+
+	if config.CpuOvercommitRatio <= 0 {
+		config.CpuOvercommitRatio = 1
+	}
+
+	if config.MemoryOvercommitRatio <= 0 {
+		config.MemoryOvercommitRatio = 1
+	}
+
 	if config.LoadHeadroom < 0.2 {
 		config.LoadHeadroom = 0.2
 	}
@@ -82,5 +943,35 @@ func validateConfig(config *KproximateConfig) KproximateConfig {
 		config.WaitSecondsForProvision = 60
 	}
 
+	if config.WaitSecondsForNetwork < 0 {
+		config.WaitSecondsForNetwork = 0
+	}
+
+	// kpNodes are only recycled once any scale up could have finished
+	// joining them, so that a worker isn't still waiting for them to be ready
+	if config.InitFailedSeconds < 0 {
+		config.InitFailedSeconds = 0
+	} else if config.InitFailedSeconds > 0 {
+		config.InitFailedSeconds = max(config.InitFailedSeconds, config.WaitSecondsForProvision+config.WaitSecondsForJoin)
+	}
+
+	// A scale event outstanding for longer than it could take to provision
+	// and join a node has most likely been lost by a crashed worker
+	if config.StuckScaleEventSeconds <= 0 {
+		config.StuckScaleEventSeconds = config.WaitSecondsForProvision + config.WaitSecondsForJoin + 300
+	}
+
+	for storage, timeouts := range config.StorageTimeouts {
+		timeouts.CloneSeconds = max(timeouts.CloneSeconds, 0)
+		timeouts.StartSeconds = max(timeouts.StartSeconds, 0)
+		timeouts.AgentReadySeconds = max(timeouts.AgentReadySeconds, 0)
+		config.StorageTimeouts[storage] = timeouts
+	}
+
+	config.FailureInjection.CloneFailure = min(max(config.FailureInjection.CloneFailure, 0), 1)
+	config.FailureInjection.JoinTimeout = min(max(config.FailureInjection.JoinTimeout, 0), 1)
+	config.FailureInjection.QueueDisconnect = min(max(config.FailureInjection.QueueDisconnect, 0), 1)
+	config.FailureInjection.ProxmoxError = min(max(config.FailureInjection.ProxmoxError, 0), 1)
+
 	return *config
 }
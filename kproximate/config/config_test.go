@@ -1,7 +1,14 @@
 package config
 
 import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateConfig(t *testing.T) {
@@ -22,6 +29,10 @@ func TestValidateConfig(t *testing.T) {
 		t.Errorf("Expected \"PollInterval\" to be10, got %d", cfg.PollInterval)
 	}
 
+	if cfg.MaxKpNodesHeadroom != 0.1 {
+		t.Errorf("Expected \"MaxKpNodesHeadroom\" to be 0.1, got %f", cfg.MaxKpNodesHeadroom)
+	}
+
 	if cfg.WaitSecondsForJoin != 60 {
 		t.Errorf("Expected \"WaitSecondsForJoin\" to be 60, got %d", cfg.WaitSecondsForJoin)
 	}
@@ -30,3 +41,738 @@ func TestValidateConfig(t *testing.T) {
 		t.Errorf("Expected \"WaitSecondsForProvision\" to be 60, got %d", cfg.WaitSecondsForProvision)
 	}
 }
+
+func TestValidateConfigOverprovisioning(t *testing.T) {
+	cfg := &KproximateConfig{
+		OverprovisionCpu:      "lots",
+		OverprovisionMemory:   "1Gi",
+		OverprovisionPriority: 5,
+		OverprovisionReplicas: -1,
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.OverprovisionReplicas != 0 {
+		t.Errorf("Expected \"OverprovisionReplicas\" to be 0, got %d", cfg.OverprovisionReplicas)
+	}
+
+	if cfg.OverprovisionCpu != "500m" {
+		t.Errorf("Expected \"OverprovisionCpu\" to be 500m, got %s", cfg.OverprovisionCpu)
+	}
+
+	if cfg.OverprovisionMemory != "1Gi" {
+		t.Errorf("Expected \"OverprovisionMemory\" to be 1Gi, got %s", cfg.OverprovisionMemory)
+	}
+
+	if cfg.OverprovisionPriority != -10 {
+		t.Errorf("Expected \"OverprovisionPriority\" to be -10, got %d", cfg.OverprovisionPriority)
+	}
+}
+
+func TestValidateConfigInitFailedSeconds(t *testing.T) {
+	cfg := &KproximateConfig{
+		InitFailedSeconds:       60,
+		WaitSecondsForJoin:      120,
+		WaitSecondsForProvision: 300,
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.InitFailedSeconds != 420 {
+		t.Errorf("Expected \"InitFailedSeconds\" to allow for provisioning and joining, got %d", cfg.InitFailedSeconds)
+	}
+}
+
+func TestGetKpConfigFromDir(t *testing.T) {
+	dir := t.TempDir()
+
+	settings := map[string]string{
+		"loadHeadroom": "0.3",
+		"maxKpNodes":   "5\n",
+		"pollInterval": "2",
+	}
+
+	for key, value := range settings {
+		err := os.WriteFile(filepath.Join(dir, key), []byte(value), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := os.Mkdir(filepath.Join(dir, "..data"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := GetKpConfigFromDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.LoadHeadroom != 0.3 {
+		t.Errorf("Expected \"LoadHeadroom\" to be 0.3, got %f", cfg.LoadHeadroom)
+	}
+
+	if cfg.MaxKpNodes != 5 {
+		t.Errorf("Expected \"MaxKpNodes\" to be 5, got %d", cfg.MaxKpNodes)
+	}
+
+	if cfg.PollInterval != 10 {
+		t.Errorf("Expected \"PollInterval\" to be validated to 10, got %d", cfg.PollInterval)
+	}
+}
+
+func TestApplyReloadableSettings(t *testing.T) {
+	current := &KproximateConfig{
+		KpNodeCores:  2,
+		LoadHeadroom: 0.2,
+		MaxKpNodes:   3,
+		PollInterval: 10,
+	}
+
+	updated := KproximateConfig{
+		KpNodeCores:  4,
+		LoadHeadroom: 0.2,
+		MaxKpNodes:   6,
+		PollInterval: 30,
+	}
+
+	changes := ApplyReloadableSettings(current, updated)
+
+	if len(changes) != 2 {
+		t.Errorf("Expected 2 changes, got %d: %v", len(changes), changes)
+	}
+
+	if current.MaxKpNodes != 6 {
+		t.Errorf("Expected \"MaxKpNodes\" to be 6, got %d", current.MaxKpNodes)
+	}
+
+	if current.PollInterval != 30 {
+		t.Errorf("Expected \"PollInterval\" to be 30, got %d", current.PollInterval)
+	}
+
+	if current.KpNodeCores != 2 {
+		t.Errorf("Expected \"KpNodeCores\" to be unchanged, got %d", current.KpNodeCores)
+	}
+}
+
+func TestApiAuth(t *testing.T) {
+	for apiAuth, expected := range map[string]string{
+		"":           "none",
+		"Kubernetes": "kubernetes",
+		"token":      "token",
+		"oidc":       "token",
+	} {
+		cfg := &KproximateConfig{ApiAuth: apiAuth}
+		*cfg = validateConfig(cfg)
+
+		if cfg.ApiAuth != expected {
+			t.Errorf("Expected apiAuth %q to be %q, got %q", apiAuth, expected, cfg.ApiAuth)
+		}
+	}
+}
+
+func TestNodeClassesInheritDefaults(t *testing.T) {
+	cfg := &KproximateConfig{
+		KpNodeCores:        2,
+		KpNodeMemory:       2048,
+		KpNodeTemplateName: "kproximate-template",
+	}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "large", "cores": 8}, {"memory": 4096, "maxNodes": 2}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	large := cfg.NodeClass("large")
+	if large.Cores != 8 || large.Memory != 2048 || large.TemplateName != "kproximate-template" {
+		t.Errorf("Unexpected node class: %+v", large)
+	}
+
+	unnamed := cfg.NodeClass("class-1")
+	if unnamed.Cores != 2 || unnamed.Memory != 4096 || unnamed.MaxNodes != 2 {
+		t.Errorf("Unexpected node class: %+v", unnamed)
+	}
+}
+
+func TestNodeClassBalloonDefaults(t *testing.T) {
+	cfg := &KproximateConfig{
+		KpNodeMemory: 2048,
+	}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "default", "balloon": {"enabled": true}}, {"name": "large", "memory": 8192, "balloon": {"enabled": true, "minMemory": 16384}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if balloon := cfg.NodeClass("default").Balloon; !balloon.Enabled || balloon.MinMemory != 2048 {
+		t.Errorf("Expected the balloon minimum to default to the node class memory, got %+v", balloon)
+	}
+
+	if balloon := cfg.NodeClass("large").Balloon; balloon.MinMemory != 8192 {
+		t.Errorf("Expected the balloon minimum to be limited to the node class memory, got %+v", balloon)
+	}
+}
+
+func TestNodeClassCpuDefaults(t *testing.T) {
+	cfg := &KproximateConfig{
+		KpNodeCores: 4,
+	}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "default", "cpu": {"type": " host ", "sockets": 2, "limit": 8}}, {"name": "uneven", "cores": 6, "cpu": {"sockets": 4, "units": -1}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cpu := cfg.NodeClass("default").Cpu; cpu.Type != "host" || cpu.Sockets != 2 || cpu.Limit != 0 {
+		t.Errorf("Expected a host cpu with 2 sockets and no limit above the node class cores, got %+v", cpu)
+	}
+
+	if cpu := cfg.NodeClass("uneven").Cpu; cpu.Sockets != 1 || cpu.Units != 0 {
+		t.Errorf("Expected a single socket when the cores can't be divided between sockets, got %+v", cpu)
+	}
+}
+
+func TestNodeClassDiskSize(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "default"}, {"name": "storage", "diskSize": 100, "rootDisk": "virtio0"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if nodeClass := cfg.NodeClass("default"); nodeClass.DiskSize != 0 || nodeClass.RootDisk != "scsi0" {
+		t.Errorf("Expected the template disk size and scsi0, got %d and %s", nodeClass.DiskSize, nodeClass.RootDisk)
+	}
+
+	if nodeClass := cfg.NodeClass("storage"); nodeClass.DiskSize != 100 || nodeClass.RootDisk != "virtio0" {
+		t.Errorf("Expected 100 and virtio0, got %d and %s", nodeClass.DiskSize, nodeClass.RootDisk)
+	}
+}
+
+func TestNodeClassDataDiskDefaults(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "storage", "dataDisks": [{"size": 100, "mountPath": "/var/lib/longhorn"}, {"size": 0}, {"size": 50, "bus": "VirtIO", "filesystem": "xfs"}]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	dataDisks := cfg.NodeClass("storage").DataDisks
+	if len(dataDisks) != 2 {
+		t.Fatalf("Expected disks without a size to be ignored, got %+v", dataDisks)
+	}
+
+	if dataDisks[0].Bus != "scsi" || dataDisks[0].Filesystem != "ext4" {
+		t.Errorf("Expected the scsi bus and ext4, got %+v", dataDisks[0])
+	}
+
+	if dataDisks[1].Bus != "virtio" || dataDisks[1].Filesystem != "xfs" {
+		t.Errorf("Expected the virtio bus and xfs, got %+v", dataDisks[1])
+	}
+}
+
+func TestNodeClassFirewall(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "default", "firewall": {"enabled": true, "securityGroups": ["kubernetes"], "policyIn": "drop", "policyOut": "allow"}}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	firewall := cfg.NodeClass("default").Firewall
+	if !firewall.Enabled || len(firewall.SecurityGroups) != 1 || firewall.SecurityGroups[0] != "kubernetes" {
+		t.Errorf("Expected the firewall to be decoded, got %+v", firewall)
+	}
+
+	if firewall.PolicyIn != "DROP" {
+		t.Errorf("Expected policyIn to be DROP, got %s", firewall.PolicyIn)
+	}
+
+	if firewall.PolicyOut != "" {
+		t.Errorf("Expected an invalid policyOut to be ignored, got %s", firewall.PolicyOut)
+	}
+}
+
+func TestDefaultNodeClass(t *testing.T) {
+	cfg := KproximateConfig{
+		KpNodeCores:        2,
+		KpNodeMemory:       2048,
+		KpNodeTemplateName: "kproximate-template",
+	}
+
+	nodeClasses := cfg.NodeClasses()
+	if len(nodeClasses) != 1 {
+		t.Fatalf("Expected a single default node class, got %d", len(nodeClasses))
+	}
+
+	if nodeClasses[0].Cores != 2 || nodeClasses[0].Memory != 2048 || nodeClasses[0].TemplateName != "kproximate-template" {
+		t.Errorf("Unexpected default node class: %+v", nodeClasses[0])
+	}
+}
+
+func TestInstanceIDScopesNamesAndQueues(t *testing.T) {
+	cfg := &KproximateConfig{
+		InstanceID:       "Team-A",
+		KpNodeNamePrefix: "kp-node",
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.KpNodeNamePrefix != "kp-node-team-a" {
+		t.Errorf("Expected kpNodeNamePrefix to be kp-node-team-a, got %s", cfg.KpNodeNamePrefix)
+	}
+
+	if cfg.QueueName("scaleUpEvents") != "scaleUpEvents-team-a" {
+		t.Errorf("Expected queue name scaleUpEvents-team-a, got %s", cfg.QueueName("scaleUpEvents"))
+	}
+
+	if (KproximateConfig{}).QueueName("scaleUpEvents") != "scaleUpEvents" {
+		t.Error("Expected the queue name to be unchanged without an instance ID")
+	}
+}
+
+func TestKpNodeNaming(t *testing.T) {
+	cfg := &KproximateConfig{
+		InstanceID:       "team-a",
+		KpNodeNamePrefix: "kp-node",
+		KpNodeNameScheme: "Short",
+	}
+
+	*cfg = validateConfig(cfg)
+
+	name := cfg.KpNodeNaming().NewName()
+	if !cfg.KpNodeNameRegex.MatchString(name) || len(name) != len("kp-node-team-a-")+8 {
+		t.Errorf("Expected a short name recognised as a kpNode, got %s", name)
+	}
+
+	if cfg.KpNodeNameRegex.MatchString("kp-node-0a1b2c3d") {
+		t.Error("Expected kpNodes of the default instance not to be recognised")
+	}
+
+	cfg = &KproximateConfig{
+		KpNodeNamePrefix: "kp-node",
+		KpNodeNameScheme: "sequential",
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.KpNodeNameScheme != "uuid" {
+		t.Errorf("Expected an unknown scheme to default to uuid, got %s", cfg.KpNodeNameScheme)
+	}
+}
+
+func TestStuckScaleEventSecondsDefault(t *testing.T) {
+	cfg := &KproximateConfig{
+		WaitSecondsForJoin:      120,
+		WaitSecondsForProvision: 300,
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.StuckScaleEventSeconds != 720 {
+		t.Errorf("Expected stuckScaleEventSeconds to be 720, got %d", cfg.StuckScaleEventSeconds)
+	}
+
+	cfg.StuckScaleEventSeconds = 60
+	*cfg = validateConfig(cfg)
+
+	if cfg.StuckScaleEventSeconds != 60 {
+		t.Errorf("Expected stuckScaleEventSeconds to be 60, got %d", cfg.StuckScaleEventSeconds)
+	}
+}
+
+func TestKubeRateLimits(t *testing.T) {
+	cfg := &KproximateConfig{}
+	*cfg = validateConfig(cfg)
+
+	if cfg.KubeQps != 5 || cfg.KubeBurst != 10 {
+		t.Errorf("Expected client-go's default rate limits, got %v %d", cfg.KubeQps, cfg.KubeBurst)
+	}
+
+	cfg = &KproximateConfig{KubeQps: 50.5, KubeBurst: 20}
+	*cfg = validateConfig(cfg)
+
+	if cfg.KubeBurst != 51 {
+		t.Errorf("Expected kubeBurst to be raised to 51, got %d", cfg.KubeBurst)
+	}
+}
+
+func TestHibernateDefaults(t *testing.T) {
+	cfg := &KproximateConfig{
+		HibernateKpNodes: -1,
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.HibernateKpNodes != 0 {
+		t.Errorf("Expected hibernateKpNodes to be 0, got %d", cfg.HibernateKpNodes)
+	}
+
+	if cfg.HibernateMaxAgeSeconds != 604800 {
+		t.Errorf("Expected hibernateMaxAgeSeconds to be 604800, got %d", cfg.HibernateMaxAgeSeconds)
+	}
+}
+
+func TestNodeClassUserDataFormat(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.KpNodeClasses.EnvDecode(`[{"name": "flatcar", "userDataFormat": "Ignition"}, {"name": "ubuntu"}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.NodeClass("flatcar").UserDataFormat != "ignition" {
+		t.Errorf("Expected ignition, got %s", cfg.NodeClass("flatcar").UserDataFormat)
+	}
+
+	if cfg.NodeClass("ubuntu").UserDataFormat != "cloud-init" {
+		t.Errorf("Expected cloud-init, got %s", cfg.NodeClass("ubuntu").UserDataFormat)
+	}
+}
+
+func TestScaleEventPriorities(t *testing.T) {
+	cfg := &KproximateConfig{
+		KpNodeClasses: NodeClasses{
+			{Name: "gpu", EventPriority: 12},
+			{Name: "general", EventPriority: -1},
+		},
+		ScaleEventPriorities: map[string]int{
+			"system-cluster-critical": 20,
+			"high":                    5,
+		},
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if cfg.NodeClass("gpu").EventPriority != MaxScaleEventPriority || cfg.NodeClass("general").EventPriority != 0 {
+		t.Errorf("Expected node class event priorities between 0 and %d, got %+v", MaxScaleEventPriority, cfg.KpNodeClasses)
+	}
+
+	if cfg.ScaleEventPriorities["system-cluster-critical"] != MaxScaleEventPriority || cfg.ScaleEventPriorities["high"] != 5 {
+		t.Errorf("Expected scale event priorities between 0 and %d, got %v", MaxScaleEventPriority, cfg.ScaleEventPriorities)
+	}
+}
+
+func TestScalingQueries(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.ScalingQueries.EnvDecode(`[{"query": "sum(queue_depth)", "scaleUpThreshold": 0}, {"name": "empty", "query": " "}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if len(cfg.ScalingQueries) != 1 {
+		t.Fatalf("Expected 1 scaling query, got %d", len(cfg.ScalingQueries))
+	}
+
+	if cfg.ScalingQueries[0].Name != "query-0" {
+		t.Errorf("Expected query-0, got %s", cfg.ScalingQueries[0].Name)
+	}
+
+	if cfg.ScalingQueries[0].ScaleUpThreshold == nil || *cfg.ScalingQueries[0].ScaleUpThreshold != 0 {
+		t.Errorf("Expected a scale up threshold of 0, got %v", cfg.ScalingQueries[0].ScaleUpThreshold)
+	}
+
+	if cfg.ScalingQueries[0].ScaleDownThreshold != nil {
+		t.Errorf("Expected no scale down threshold, got %v", *cfg.ScalingQueries[0].ScaleDownThreshold)
+	}
+}
+
+func TestScaleSchedules(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.ScaleSchedules.EnvDecode(`[{"days": ["Mon"], "start": "08:00", "end": "18:00", "nodes": -1}, {"name": "nightly", "nodes": 2}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if len(cfg.ScaleSchedules) != 2 {
+		t.Fatalf("Expected 2 scale schedules, got %d", len(cfg.ScaleSchedules))
+	}
+
+	if cfg.ScaleSchedules[0].Name != "schedule-0" || cfg.ScaleSchedules[1].Name != "nightly" {
+		t.Errorf("Expected schedule-0 and nightly, got %s and %s", cfg.ScaleSchedules[0].Name, cfg.ScaleSchedules[1].Name)
+	}
+
+	if cfg.ScaleSchedules[0].Nodes != 0 {
+		t.Errorf("Expected a negative number of nodes to be clamped to 0, got %d", cfg.ScaleSchedules[0].Nodes)
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.RoutingRules.EnvDecode(`[{"namespaces": ["team-ml"], "selector": "tier!=batch", "nodeClasses": ["gpu"]}, {"name": "high", "priorityClasses": ["high"], "nodeClasses": ["large"]}, {"nodeClasses": ["default"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		namespace     string
+		labels        map[string]string
+		priorityClass string
+		rule          string
+	}{
+		{"team-ml", nil, "", "rule-0"},
+		{"team-ml", map[string]string{"tier": "batch"}, "high", "high"},
+		{"default", nil, "high", "high"},
+		{"default", map[string]string{"tier": "batch"}, "", "rule-2"},
+	}
+
+	for _, test := range tests {
+		rule, ok := cfg.RoutingRules.Route(test.namespace, test.labels, test.priorityClass)
+		if !ok || rule.Name != test.rule {
+			t.Errorf("Expected a pod in %s with %v and priority class %q to be routed by %s, got %s", test.namespace, test.labels, test.priorityClass, test.rule, rule.Name)
+		}
+	}
+
+	invalid := RoutingRules{}
+	err = invalid.EnvDecode(`[{"selector": "team in (ml", "nodeClasses": ["gpu"]}, {"namespaces": ["team-ml"]}]`)
+	if err == nil || !strings.Contains(err.Error(), "invalid selector") || !strings.Contains(err.Error(), "has no node classes") {
+		t.Errorf("Expected an invalid selector and a rule without node classes to be rejected, got %v", err)
+	}
+}
+
+func TestStorageTimeouts(t *testing.T) {
+	cfg := &KproximateConfig{}
+
+	err := cfg.StorageTimeouts.EnvDecode(`{"default": {"cloneSeconds": 60}, "ceph-rbd": {"cloneSeconds": 300, "startSeconds": -1}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	*cfg = validateConfig(cfg)
+
+	if timeouts := cfg.OperationTimeouts("ceph-rbd"); timeouts.CloneSeconds != 300 || timeouts.StartSeconds != 0 {
+		t.Errorf("Expected the ceph-rbd timeouts with no negative start timeout, got %+v", timeouts)
+	}
+
+	if timeouts := cfg.OperationTimeouts("local-lvm"); timeouts.CloneSeconds != 60 {
+		t.Errorf("Expected the default timeouts for a storage without its own, got %+v", timeouts)
+	}
+}
+
+func TestFailureInjection(t *testing.T) {
+	cfg := &KproximateConfig{}
+	err := cfg.FailureInjection.EnvDecode(`{"cloneFailure": 0.5, "proxmoxError": 2, "joinTimeout": -1}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validated := validateConfig(cfg)
+	if validated.FailureInjection.CloneFailure != 0.5 || validated.FailureInjection.ProxmoxError != 1 || validated.FailureInjection.JoinTimeout != 0 {
+		t.Errorf("Expected probabilities to be clamped between 0 and 1, got %+v", validated.FailureInjection)
+	}
+
+	if !validated.FailureInjection.Enabled() || (FailureInjection{}).Enabled() {
+		t.Error("Expected failure injection to be enabled only when a probability is set")
+	}
+
+	if Injected(0) || !Injected(1) {
+		t.Error("Expected failures to be injected with certainty at 1 and never at 0")
+	}
+}
+
+func TestKpNodeParams(t *testing.T) {
+	params := KpNodeParams{}
+	err := params.EnvDecode(`{"network": {"net0": "virtio,bridge=vmbr1"}, "onboot": false, "tags": ["k8s"]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if params.Network["net0"] != "virtio,bridge=vmbr1" || params.OnBoot == nil || *params.OnBoot || len(params.Tags) != 1 {
+		t.Errorf("Unexpected params: %+v", params)
+	}
+
+	if err := params.Validate(); err != nil {
+		t.Errorf("Expected the params to be valid, got %v", err)
+	}
+
+	if !params.ExcludeBackup() {
+		t.Error("Expected kpNodes to be excluded from backup by default")
+	}
+
+	backup := KpNodeParams{}
+	err = backup.EnvDecode(`{"backup": true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if backup.ExcludeBackup() {
+		t.Error("Expected kpNodes to be backed up when backup is true")
+	}
+
+	err = (&KpNodeParams{}).EnvDecode(`{"nameservers": "10.0.0.53"}`)
+	if err == nil {
+		t.Error("Expected an unknown field to be rejected")
+	}
+
+	err = KpNodeParams{
+		Network:    map[string]string{"eth0": "virtio"},
+		OsType:     "linux",
+		Tags:       []string{"K8s"},
+		Nameserver: "10.0.0.53 dns.local",
+	}.Validate()
+	if err == nil || len(strings.Split(err.Error(), "\n")) != 4 {
+		t.Errorf("Expected 4 problems, got %v", err)
+	}
+}
+
+func TestKpNodeParamsSchema(t *testing.T) {
+	schema := struct {
+		Properties map[string]any `json:"properties"`
+	}{}
+	err := json.Unmarshal(KpNodeParamsSchema, &schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	paramsType := reflect.TypeOf(KpNodeParams{})
+	if len(schema.Properties) != paramsType.NumField() {
+		t.Errorf("Expected a schema property for each of the %d fields, got %d", paramsType.NumField(), len(schema.Properties))
+	}
+
+	for i := range paramsType.NumField() {
+		name, _, _ := strings.Cut(paramsType.Field(i).Tag.Get("json"), ",")
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("Expected %s in the schema", name)
+		}
+	}
+}
+
+func TestUnknownSettings(t *testing.T) {
+	unknown := UnknownSettings([]string{"kpNodeParams", "kpNodeParam", "maxKpNodes"})
+	if len(unknown) != 1 || unknown[0] != "kpNodeParam" {
+		t.Errorf("Expected kpNodeParam to be unknown, got %v", unknown)
+	}
+}
+
+func TestSecretsDir(t *testing.T) {
+	dir := t.TempDir()
+
+	for key, value := range map[string]string{
+		"pmToken":          "file-token\n",
+		"rabbitMQPassword": "file-password",
+	} {
+		err := os.WriteFile(filepath.Join(dir, key), []byte(value), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("secretsDir", dir)
+	t.Setenv("pmToken", "env-token")
+	t.Setenv("pmUserID", "kproximate@pve!kproximate")
+
+	cfg, err := GetKpConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.PmToken != "file-token" {
+		t.Errorf("Expected pmToken to be read from the secrets dir, got %s", cfg.PmToken)
+	}
+
+	if cfg.PmUserID != "kproximate@pve!kproximate" {
+		t.Errorf("Expected pmUserID to be read from the environment, got %s", cfg.PmUserID)
+	}
+
+	rabbitConfig, err := GetRabbitConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rabbitConfig.Password != "file-password" {
+		t.Errorf("Expected rabbitMQPassword to be read from the secrets dir, got %s", rabbitConfig.Password)
+	}
+}
+
+func TestWatchSecrets(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "pmToken"), []byte("token"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	changed := make(chan error)
+	go func() {
+		changed <- WatchSecrets(ctx, dir, time.Millisecond*10)
+	}()
+
+	time.Sleep(time.Millisecond * 50)
+	err = os.WriteFile(filepath.Join(dir, "pmToken"), []byte("rotated"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = <-changed
+	if err != nil {
+		t.Errorf("Expected the change to be detected, got %v", err)
+	}
+}
+
+func TestNodeClassesFromValues(t *testing.T) {
+	nodeClasses, err := NodeClassesFromValues([]byte(`
+kproximate:
+  config:
+    kpNodeClasses:
+      - name: small
+        maxNodes: 2
+      - name: gpu
+        cores: 8
+        replicas: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodeClasses) != 2 || nodeClasses[0].MaxNodes != 2 || nodeClasses[1].Cores != 8 {
+		t.Fatalf("Unexpected node classes: %+v", nodeClasses)
+	}
+
+	if nodeClasses[0].Replicas != nil || nodeClasses[1].Replicas == nil || *nodeClasses[1].Replicas != 2 {
+		t.Error("Expected only the gpu node class to have replicas")
+	}
+
+	nodeClasses, err = NodeClassesFromValues([]byte(`
+kind: ConfigMap
+data:
+  kpNodeCores: "4"
+  kpNodeMemory: "8192"
+  kpNodeTemplateName: kproximate-template
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodeClasses) != 1 || nodeClasses[0].Name != "default" || nodeClasses[0].Cores != 4 || nodeClasses[0].Memory != 8192 || nodeClasses[0].TemplateName != "kproximate-template" {
+		t.Errorf("Expected a default node class from the top level settings, got %+v", nodeClasses)
+	}
+
+	_, err = NodeClassesFromValues([]byte(`kpNodeClasses: '[{"name": "small"}, {"name": "small"}]'`))
+	if err == nil {
+		t.Error("Expected duplicate node classes to be invalid")
+	}
+}
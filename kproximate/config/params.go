@@ -0,0 +1,154 @@
+package config
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// The JSON schema of the kpNodeParams setting
+//
+//go:embed kpnodeparams.schema.json
+var KpNodeParamsSchema []byte
+
+var (
+	networkDeviceName = regexp.MustCompile(`^net\d+$`)
+	agentSetting      = regexp.MustCompile(`^(0|1|enabled=[01])(,[a-z_-]+=[^,]+)*$`)
+	// Proxmox only accepts lower case tags
+	proxmoxTag = regexp.MustCompile(`^[a-z0-9_][a-z0-9_\-+.]*$`)
+)
+
+// The guest OS types accepted by Proxmox
+var osTypes = []string{
+	"other", "wxp", "w2k", "w2k3", "w2k8", "wvista", "win7", "win8", "win10", "win11", "l24", "l26", "solaris",
+}
+
+// Proxmox VM settings applied to kpNodes when they are cloned, overriding
+// those of the template. Unset fields keep kproximate's defaults, or the
+// template's settings where kproximate has none.
+type KpNodeParams struct {
+	// Network devices by name, e.g. {"net0": "virtio,bridge=vmbr1,tag=20"}
+	Network map[string]string `json:"network,omitempty"`
+	// The qemu guest agent setting, defaults to enabled=1
+	Agent string `json:"agent,omitempty"`
+	// Whether the VM is started when its Proxmox host boots, defaults to true
+	OnBoot *bool `json:"onboot,omitempty"`
+	// Whether the VM's disks are included in Proxmox backup jobs, defaults to
+	// false as kpNodes are replaced rather than restored
+	Backup *bool `json:"backup,omitempty"`
+	// The guest OS type, e.g. l26 or win11
+	OsType string `json:"ostype,omitempty"`
+	// Added to the tags kproximate manages
+	Tags []string `json:"tags,omitempty"`
+	// The cloud-init DNS search domain, the Proxmox host's when unset
+	SearchDomain string `json:"searchdomain,omitempty"`
+	// Space separated cloud-init DNS servers, the Proxmox host's when unset
+	Nameserver string `json:"nameserver,omitempty"`
+}
+
+// kpNode params are configured as a JSON encoded object. Unknown fields are
+// rejected so that typos are not silently ignored.
+func (p *KpNodeParams) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode(p)
+}
+
+// Returns every problem found with the params, or nil if they are valid.
+func (p KpNodeParams) Validate() error {
+	problems := []error{}
+
+	names := make([]string, 0, len(p.Network))
+	for name := range p.Network {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		device := p.Network[name]
+		if !networkDeviceName.MatchString(name) {
+			problems = append(problems, fmt.Errorf("network: %q is not a network device, expected net0, net1...", name))
+		}
+
+		if device == "" {
+			problems = append(problems, fmt.Errorf("network: %s has no device settings", name))
+		}
+	}
+
+	if p.Agent != "" && !agentSetting.MatchString(p.Agent) {
+		problems = append(problems, fmt.Errorf("agent: %q should be 0, 1 or enabled=0|1 followed by options", p.Agent))
+	}
+
+	if p.OsType != "" && !slices.Contains(osTypes, p.OsType) {
+		problems = append(problems, fmt.Errorf("ostype: %q is not one of %s", p.OsType, strings.Join(osTypes, ", ")))
+	}
+
+	for _, tag := range p.Tags {
+		if !proxmoxTag.MatchString(tag) {
+			problems = append(problems, fmt.Errorf("tags: %q is not a valid Proxmox tag", tag))
+		}
+	}
+
+	if strings.ContainsAny(p.SearchDomain, " ,;") {
+		problems = append(problems, fmt.Errorf("searchdomain: %q should be a single domain", p.SearchDomain))
+	}
+
+	for _, nameserver := range strings.Fields(p.Nameserver) {
+		if net.ParseIP(nameserver) == nil {
+			problems = append(problems, fmt.Errorf("nameserver: %q is not an IP address", nameserver))
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+// Whether the disks of kpNodes are excluded from Proxmox backup jobs. Backup
+// is set per disk rather than in the VM config so isn't in ProxmoxParams.
+func (p KpNodeParams) ExcludeBackup() bool {
+	return p.Backup == nil || !*p.Backup
+}
+
+// Returns the Proxmox VM config for the params, excluding tags which are
+// merged with those kproximate manages.
+func (p KpNodeParams) ProxmoxParams() map[string]interface{} {
+	params := map[string]interface{}{
+		"agent":  "enabled=1",
+		"onboot": 1,
+	}
+
+	if p.Agent != "" {
+		params["agent"] = p.Agent
+	}
+
+	if p.OnBoot != nil && !*p.OnBoot {
+		params["onboot"] = 0
+	}
+
+	if p.OsType != "" {
+		params["ostype"] = p.OsType
+	}
+
+	for name, device := range p.Network {
+		params[name] = device
+	}
+
+	if p.SearchDomain != "" {
+		params["searchdomain"] = p.SearchDomain
+	}
+
+	if p.Nameserver != "" {
+		params["nameserver"] = p.Nameserver
+	}
+
+	return params
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Restricts the node classes scaled up for the pending pods it matches. A pod
+// matches a rule if it matches each of the rule's criteria which are set, so a
+// rule without any matches every pod.
+type RoutingRule struct {
+	Name       string   `json:"name"`
+	Namespaces []string `json:"namespaces"`
+	// A label selector, e.g. "team=ml,tier!=batch"
+	Selector        string   `json:"selector"`
+	PriorityClasses []string `json:"priorityClasses"`
+	// The node classes the matching pods are scaled up with
+	NodeClasses []string `json:"nodeClasses"`
+}
+
+type RoutingRules []RoutingRule
+
+// Routing rules are configured as a JSON encoded list, rules without node
+// classes or with an invalid selector are rejected.
+func (r *RoutingRules) EnvDecode(value string) error {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+
+	err := json.Unmarshal([]byte(value), r)
+	if err != nil {
+		return err
+	}
+
+	problems := []error{}
+	for idx := range *r {
+		rule := &(*r)[idx]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule-%d", idx)
+		}
+
+		if len(rule.NodeClasses) == 0 {
+			problems = append(problems, fmt.Errorf("routing rule %s has no node classes", rule.Name))
+		}
+
+		_, err := labels.Parse(rule.Selector)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("routing rule %s has an invalid selector: %w", rule.Name, err))
+		}
+	}
+
+	return errors.Join(problems...)
+}
+
+func (rule RoutingRule) matches(namespace string, podLabels map[string]string, priorityClass string) bool {
+	if len(rule.Namespaces) > 0 && !slices.Contains(rule.Namespaces, namespace) {
+		return false
+	}
+
+	if len(rule.PriorityClasses) > 0 && !slices.Contains(rule.PriorityClasses, priorityClass) {
+		return false
+	}
+
+	if rule.Selector == "" {
+		return true
+	}
+
+	selector, err := labels.Parse(rule.Selector)
+	if err != nil {
+		return false
+	}
+
+	return selector.Matches(labels.Set(podLabels))
+}
+
+// Returns the first rule matching a pod in the namespace with the labels and
+// priority class, if any.
+func (rules RoutingRules) Route(namespace string, podLabels map[string]string, priorityClass string) (RoutingRule, bool) {
+	for _, rule := range rules {
+		if rule.matches(namespace, podLabels, priorityClass) {
+			return rule, true
+		}
+	}
+
+	return RoutingRule{}, false
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sethvargo/go-envconfig"
+)
+
+// Looks up settings from a directory containing a file per setting, such as a
+// mounted Secret, so that sensitive settings like pmToken, sshKey and
+// rabbitMQPassword need not be set in the environment.
+type secretsLookuper struct {
+	dir string
+}
+
+func (l secretsLookuper) Lookup(key string) (string, bool) {
+	value, err := os.ReadFile(filepath.Join(l.dir, key))
+	if err != nil {
+		return "", false
+	}
+
+	return strings.TrimSpace(string(value)), true
+}
+
+// Looks up settings from the secretsDir set in the environment, if any, before
+// the given lookupers.
+func withSecrets(lookupers ...envconfig.Lookuper) envconfig.Lookuper {
+	if dir := os.Getenv("secretsDir"); dir != "" {
+		lookupers = append([]envconfig.Lookuper{secretsLookuper{dir: dir}}, lookupers...)
+	}
+
+	return envconfig.MultiLookuper(lookupers...)
+}
+
+// A checksum of the files in the directory, which changes whenever a mounted
+// Secret is updated.
+func secretsChecksum(dir string) (string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		value, err := os.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return "", err
+		}
+
+		hash.Write([]byte(file.Name()))
+		hash.Write([]byte{0})
+		hash.Write(value)
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Checks the secrets directory every interval, returning nil once its
+// contents change or the context's error once it is cancelled. Secrets such
+// as Proxmox credentials are only read on startup, so the caller is expected
+// to restart to apply them.
+func WatchSecrets(ctx context.Context, dir string, interval time.Duration) error {
+	initial, err := secretsChecksum(dir)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+			// A Secret is briefly unreadable while kubernetes swaps in its
+			// new contents
+			checksum, err := secretsChecksum(dir)
+			if err != nil {
+				continue
+			}
+
+			if checksum != initial {
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/client"
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// A scale down held until an operator approves it.
+type proposedScaleDown struct {
+	ScaleEvent *scaler.ScaleEvent `json:"scaleEvent"`
+	Reason     string             `json:"reason,omitempty"`
+	Proposed   time.Time          `json:"proposed"`
+}
+
+// The scale downs awaiting approval when scaleDownApproval is set. Proposals
+// are replaced by each scale down assessment, so only scale downs which are
+// still acceptable can be approved.
+type scaleDownApprovals struct {
+	mu       sync.Mutex
+	proposed map[string]proposedScaleDown
+}
+
+func newScaleDownApprovals() *scaleDownApprovals {
+	return &scaleDownApprovals{
+		proposed: map[string]proposedScaleDown{},
+	}
+}
+
+// Replaces the proposed scale downs, keeping when each kpNode was first
+// proposed for removal.
+func (a *scaleDownApprovals) propose(scaleEvents []*scaler.ScaleEvent, explanation *scaler.ScaleDownExplanation, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	proposed := map[string]proposedScaleDown{}
+	for _, scaleEvent := range scaleEvents {
+		proposal := proposedScaleDown{
+			ScaleEvent: scaleEvent,
+			Proposed:   now,
+		}
+
+		if previous, ok := a.proposed[scaleEvent.NodeName]; ok {
+			proposal.Proposed = previous.Proposed
+		}
+
+		if explanation != nil {
+			for _, explained := range explanation.ScaleEvents {
+				if explained.NodeName == scaleEvent.NodeName {
+					proposal.Reason = explained.Reason
+				}
+			}
+		}
+
+		proposed[scaleEvent.NodeName] = proposal
+	}
+
+	a.proposed = proposed
+}
+
+// Removes and returns the proposed scale down of the kpNode.
+func (a *scaleDownApprovals) approve(kpNodeName string) (*scaler.ScaleEvent, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	proposal, ok := a.proposed[kpNodeName]
+	if !ok {
+		return nil, false
+	}
+
+	delete(a.proposed, kpNodeName)
+
+	return proposal.ScaleEvent, true
+}
+
+// The proposed scale downs, oldest first.
+func (a *scaleDownApprovals) list() []proposedScaleDown {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	proposals := make([]proposedScaleDown, 0, len(a.proposed))
+	for _, proposal := range a.proposed {
+		proposals = append(proposals, proposal)
+	}
+
+	slices.SortFunc(proposals, func(a, b proposedScaleDown) int {
+		if c := a.Proposed.Compare(b.Proposed); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.ScaleEvent.NodeName, b.ScaleEvent.NodeName)
+	})
+
+	return proposals
+}
+
+var errNotProposed = errors.New("no scale down is awaiting approval")
+
+// Queues the approved scale down of the kpNode.
+func approveScaleDown(ctx context.Context, approvals *scaleDownApprovals, queue scaleEventQueue, kpNodeName string, approver string) error {
+	scaleEvent, ok := approvals.approve(kpNodeName)
+	if !ok {
+		return fmt.Errorf("%w for %s", errNotProposed, kpNodeName)
+	}
+
+	err := queue.queueScaleEvent(ctx, scaleEvent, scaleDownQueueName)
+	if err != nil {
+		return fmt.Errorf("failed to queue scale down event: %w", err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Requested approved scale down event: %s", kpNodeName), "approver", approver)
+
+	return nil
+}
+
+// Keeps a ScaleDownProposal for each scale down awaiting approval, so that
+// they can be approved by annotating the ScaleDownProposal with
+// kubernetes.ScaleDownApprovedAnnotation. Annotated proposals are approved,
+// and those no longer proposed or already approved are deleted.
+func syncScaleDownProposals(
+	ctx context.Context,
+	kubeClient kubernetes.ControllerKubernetes,
+	queue scaleEventQueue,
+	approvals *scaleDownApprovals,
+) {
+	existing, err := kubeClient.GetScaleDownProposals(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to get scale down proposals", "error", err)
+		return
+	}
+
+	proposals := approvals.list()
+	proposed := map[string]bool{}
+	for _, proposal := range proposals {
+		proposed[proposal.ScaleEvent.NodeName] = true
+	}
+
+	generated := map[string]bool{}
+	for _, proposal := range existing {
+		if proposed[proposal.Name] && proposal.Approved {
+			err := approveScaleDown(ctx, approvals, queue, proposal.Name, "annotation")
+			if err != nil {
+				logger.ErrorLog("Failed to approve scale down", "error", err)
+				continue
+			}
+
+			delete(proposed, proposal.Name)
+		}
+
+		if !proposed[proposal.Name] {
+			err := kubeClient.DeleteScaleDownProposal(ctx, proposal.Name)
+			if err != nil {
+				logger.ErrorLog("Failed to delete scale down proposal", "error", err)
+			}
+			continue
+		}
+
+		generated[proposal.Name] = true
+	}
+
+	for _, proposal := range proposals {
+		if !proposed[proposal.ScaleEvent.NodeName] || generated[proposal.ScaleEvent.NodeName] {
+			continue
+		}
+
+		err := kubeClient.CreateScaleDownProposal(ctx, kubernetes.ScaleDownProposal{
+			Name:     proposal.ScaleEvent.NodeName,
+			Reason:   proposal.Reason,
+			Proposed: proposal.Proposed,
+		})
+		if err != nil {
+			logger.ErrorLog("Failed to create scale down proposal", "error", err)
+		}
+	}
+}
+
+// Serves the scale downs awaiting approval and approves them on request.
+func registerApprovalHandlers(approvals *scaleDownApprovals, queue scaleEventQueue, actions operatorActions) {
+	http.HandleFunc("/status/approvals", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(approvals.list())
+	})
+
+	http.HandleFunc("/status/approvals/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		kpNodeName := strings.TrimPrefix(r.URL.Path, "/status/approvals/")
+		result := actions.run(func(ctx context.Context) (string, error) {
+			return "", approveScaleDown(ctx, approvals, queue, kpNodeName, "api")
+		})
+
+		var res operatorResult
+		select {
+		case res = <-result:
+		case <-r.Context().Done():
+			return
+		}
+
+		switch {
+		case errors.Is(res.err, errNotProposed):
+			http.Error(w, res.err.Error(), http.StatusNotFound)
+		case res.err != nil:
+			http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+}
+
+// Lists the scale downs awaiting approval from the controller, or approves
+// the scale down of the kpNode if one is given. Run from within the
+// controller's pod, e.g. with kubectl exec, unless the controller's URL is
+// given. Returns the exit code for the process.
+func runApprove(args []string) int {
+	controllerUrl := "http://localhost"
+	if len(args) > 1 {
+		controllerUrl = args[1]
+	}
+
+	statusClient := client.New(controllerUrl)
+
+	// Run within the controller's pod the scale token is at hand
+	kpConfig, err := config.GetKpConfig()
+	if err == nil && kpConfig.ApiAuth == "token" {
+		statusClient.Token = kpConfig.ApiScaleToken
+	}
+
+	if len(args) == 0 {
+		proposals, err := statusClient.ScaleDownProposals(context.Background())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to list scale downs awaiting approval: %s\n", err.Error())
+			return 1
+		}
+
+		for _, proposal := range proposals {
+			fmt.Printf("%s\t%s\t%s\n", proposal.ScaleEvent.NodeName, proposal.Proposed.Format(time.RFC3339), proposal.Reason)
+		}
+
+		return 0
+	}
+
+	err = statusClient.ApproveScaleDown(context.Background(), args[0])
+	if err != nil {
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) {
+			err = errors.New(apiErr.Message)
+		}
+
+		fmt.Fprintf(os.Stderr, "Failed to approve scale down: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Printf("Approved scale down of %s\n", args[0])
+	return 0
+}
+
+// Actions requested by operators, run by the main loop between assessments so
+// that they never race them for the scaler or the queue.
+type operatorActions chan func(context.Context)
+
+type operatorResult struct {
+	message string
+	err     error
+}
+
+// Hands the action to the main loop, its result is sent on the returned
+// channel once it has run.
+func (a operatorActions) run(action func(context.Context) (string, error)) <-chan operatorResult {
+	result := make(chan operatorResult, 1)
+	go func() {
+		a <- func(ctx context.Context) {
+			message, err := action(ctx)
+			result <- operatorResult{message: message, err: err}
+		}
+	}()
+
+	return result
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+func scaleDownEvents(kpNodeNames ...string) []*scaler.ScaleEvent {
+	scaleEvents := []*scaler.ScaleEvent{}
+	for _, kpNodeName := range kpNodeNames {
+		scaleEvents = append(scaleEvents, &scaler.ScaleEvent{
+			ScaleType: scaler.ScaleTypeDown,
+			NodeName:  kpNodeName,
+		})
+	}
+
+	return scaleEvents
+}
+
+func TestScaleDownApprovalsPropose(t *testing.T) {
+	approvals := newScaleDownApprovals()
+	first := time.Now()
+
+	approvals.propose(scaleDownEvents("kp-node-a"), &scaler.ScaleDownExplanation{
+		ScaleEvents: []scaler.ScaleEventExplanation{{NodeName: "kp-node-a", Reason: "least loaded"}},
+	}, first)
+	approvals.propose(scaleDownEvents("kp-node-a", "kp-node-b"), nil, first.Add(time.Minute))
+
+	proposals := approvals.list()
+	if len(proposals) != 2 {
+		t.Fatalf("Expected 2 proposals, got %d", len(proposals))
+	}
+
+	// Listed oldest first, keeping when each was first proposed
+	if proposals[0].ScaleEvent.NodeName != "kp-node-a" || !proposals[0].Proposed.Equal(first) {
+		t.Errorf("Expected kp-node-a to have been proposed at %s, got %+v", first, proposals[0])
+	}
+
+	if proposals[1].ScaleEvent.NodeName != "kp-node-b" || !proposals[1].Proposed.Equal(first.Add(time.Minute)) {
+		t.Errorf("Expected kp-node-b to have been proposed a minute later, got %+v", proposals[1])
+	}
+}
+
+func TestScaleDownApprovalsExpire(t *testing.T) {
+	approvals := newScaleDownApprovals()
+	approvals.propose(scaleDownEvents("kp-node-a", "kp-node-b"), nil, time.Now())
+
+	// Proposals not made again by the next assessment are withdrawn
+	approvals.propose(scaleDownEvents("kp-node-b"), nil, time.Now())
+
+	proposals := approvals.list()
+	if len(proposals) != 1 || proposals[0].ScaleEvent.NodeName != "kp-node-b" {
+		t.Errorf("Expected only kp-node-b to be proposed, got %+v", proposals)
+	}
+
+	if _, ok := approvals.approve("kp-node-a"); ok {
+		t.Error("Expected the withdrawn proposal not to be approvable")
+	}
+
+	approvals.propose(nil, nil, time.Now())
+	if len(approvals.list()) != 0 {
+		t.Errorf("Expected no proposals, got %+v", approvals.list())
+	}
+}
+
+func TestApproveScaleDown(t *testing.T) {
+	approvals := newScaleDownApprovals()
+	approvals.propose(scaleDownEvents("kp-node-a"), nil, time.Now())
+	queue := &fakeScaleEventQueue{}
+
+	err := approveScaleDown(context.Background(), approvals, queue, "kp-node-a", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued := queue.queued[scaleDownQueueName]
+	if len(queued) != 1 || queued[0].NodeName != "kp-node-a" {
+		t.Errorf("Expected the scale down of kp-node-a to be queued, got %v", queued)
+	}
+
+	err = approveScaleDown(context.Background(), approvals, queue, "kp-node-a", "test")
+	if !errors.Is(err, errNotProposed) {
+		t.Errorf("Expected a scale down to be approved only once, got %v", err)
+	}
+}
+
+func TestSyncScaleDownProposals(t *testing.T) {
+	approvals := newScaleDownApprovals()
+	approvals.propose(scaleDownEvents("kp-node-a", "kp-node-b"), nil, time.Now())
+	queue := &fakeScaleEventQueue{}
+	kubeClient := &kubernetes.KubernetesMock{}
+
+	syncScaleDownProposals(context.Background(), kubeClient, queue, approvals)
+
+	if len(kubeClient.ScaleDownProposals) != 2 {
+		t.Fatalf("Expected a ScaleDownProposal for each proposal, got %+v", kubeClient.ScaleDownProposals)
+	}
+
+	if len(queue.queued) != 0 {
+		t.Fatalf("Expected nothing to be approved, got %v", queue.queued)
+	}
+
+	// Approve kp-node-a and withdraw kp-node-b
+	proposal := kubeClient.ScaleDownProposals["kp-node-a"]
+	proposal.Approved = true
+	kubeClient.ScaleDownProposals["kp-node-a"] = proposal
+	approvals.propose(scaleDownEvents("kp-node-a"), nil, time.Now())
+
+	syncScaleDownProposals(context.Background(), kubeClient, queue, approvals)
+
+	queued := queue.queued[scaleDownQueueName]
+	if len(queued) != 1 || queued[0].NodeName != "kp-node-a" {
+		t.Errorf("Expected the annotated scale down of kp-node-a to be queued, got %v", queued)
+	}
+
+	if len(kubeClient.ScaleDownProposals) != 0 {
+		t.Errorf("Expected the approved and withdrawn ScaleDownProposals to be deleted, got %+v", kubeClient.ScaleDownProposals)
+	}
+
+	if len(approvals.list()) != 0 {
+		t.Errorf("Expected no scale downs to await approval, got %+v", approvals.list())
+	}
+}
+
+func TestSyncScaleDownProposalsIgnoresApprovalOfWithdrawnProposal(t *testing.T) {
+	approvals := newScaleDownApprovals()
+	queue := &fakeScaleEventQueue{}
+	kubeClient := &kubernetes.KubernetesMock{
+		ScaleDownProposals: map[string]kubernetes.ScaleDownProposal{
+			"kp-node-a": {Name: "kp-node-a", Approved: true},
+		},
+	}
+
+	syncScaleDownProposals(context.Background(), kubeClient, queue, approvals)
+
+	if len(queue.queued) != 0 {
+		t.Errorf("Expected nothing to be approved, got %v", queue.queued)
+	}
+
+	if len(kubeClient.ScaleDownProposals) != 0 {
+		t.Errorf("Expected the withdrawn ScaleDownProposal to be deleted, got %+v", kubeClient.ScaleDownProposals)
+	}
+}
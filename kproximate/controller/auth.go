@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// What a caller of the status API may do. Holding scale implies read.
+type apiPrivilege int
+
+const (
+	apiPrivilegeNone apiPrivilege = iota
+	// Querying the controller
+	apiPrivilegeRead
+	// Anything changing the state of the cluster or of the controller
+	apiPrivilegeScale
+)
+
+// The privilege required for the request. Slack requests are authenticated
+// by their signature, and neither the metrics nor the schemas reveal anything
+// about the cluster.
+func requiredPrivilege(r *http.Request) apiPrivilege {
+	switch {
+	case r.URL.Path == "/metrics", r.URL.Path == "/chatops/slack", strings.HasPrefix(r.URL.Path, "/schema/"):
+		return apiPrivilegeNone
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return apiPrivilegeRead
+	default:
+		return apiPrivilegeScale
+	}
+}
+
+// Asks the apiserver whether the holder of a token may use the verb on the
+// path, see kubernetes.ReviewAccess.
+type accessReviewer interface {
+	ReviewAccess(ctx context.Context, token string, path string, verb string) (string, bool, error)
+}
+
+// Whether the token is the expected one, which must be set.
+func tokenMatches(token string, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// The privilege granted to a bearer token when apiAuth is "token".
+func tokenPrivilege(kpConfig config.KproximateConfig, token string) apiPrivilege {
+	switch {
+	case tokenMatches(token, kpConfig.ApiScaleToken):
+		return apiPrivilegeScale
+	case tokenMatches(token, kpConfig.ApiReadToken):
+		return apiPrivilegeRead
+	default:
+		return apiPrivilegeNone
+	}
+}
+
+// Requires requests to the handler to carry a bearer token granting the
+// privilege the route requires, according to apiAuth. With "token" the token
+// must be apiReadToken or apiScaleToken, with "kubernetes" it must be a token
+// the apiserver authenticates whose user is authorized to use the request's
+// method, e.g. get or post, on its path as a non-resource URL. With "none"
+// reads are left open and anything requiring scale privileges is refused, so
+// that an unauthenticated API can never change the cluster.
+func requireApiAuth(kpConfig config.KproximateConfig, reviewer accessReviewer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		required := requiredPrivilege(r)
+		if required == apiPrivilegeNone {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if kpConfig.ApiAuth == "none" {
+			if required == apiPrivilegeScale {
+				http.Error(w, "the API is read-only as apiAuth is none", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch kpConfig.ApiAuth {
+		case "token":
+			granted := tokenPrivilege(kpConfig, token)
+			if granted == apiPrivilegeNone {
+				logger.WarnLog("Rejected status API request with an unknown token", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if granted < required {
+				logger.WarnLog("Rejected status API request with a read-only token", "method", r.Method, "path", r.URL.Path)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		case "kubernetes":
+			user, allowed, err := reviewer.ReviewAccess(r.Context(), token, r.URL.Path, strings.ToLower(r.Method))
+			if err != nil {
+				logger.ErrorLog("Failed to review access to the status API", "error", err)
+				http.Error(w, "failed to review access", http.StatusInternalServerError)
+				return
+			}
+
+			if user == "" {
+				logger.WarnLog("Rejected status API request with an invalid token", "path", r.URL.Path)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			if !allowed {
+				logger.WarnLog("Rejected status API request", "user", user, "method", r.Method, "path", r.URL.Path)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			if required == apiPrivilegeScale {
+				logger.InfoLog("Authorized status API request", "user", user, "method", r.Method, "path", r.URL.Path)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+)
+
+// Answers access reviews with a fixed result, recording whether it was asked.
+type fakeAccessReviewer struct {
+	user     string
+	allowed  bool
+	err      error
+	reviewed bool
+}
+
+func (f *fakeAccessReviewer) ReviewAccess(ctx context.Context, token string, path string, verb string) (string, bool, error) {
+	f.reviewed = true
+	return f.user, f.allowed, f.err
+}
+
+func TestRequireApiAuth(t *testing.T) {
+	tokenConfig := config.KproximateConfig{
+		ApiAuth:       "token",
+		ApiReadToken:  "read-token",
+		ApiScaleToken: "scale-token",
+	}
+	kubernetesConfig := config.KproximateConfig{ApiAuth: "kubernetes"}
+
+	tests := []struct {
+		name     string
+		kpConfig config.KproximateConfig
+		reviewer *fakeAccessReviewer
+		method   string
+		path     string
+		token    string
+		expected int
+	}{
+		{
+			name:     "none allows reads",
+			kpConfig: config.KproximateConfig{ApiAuth: "none"},
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "none refuses scaling",
+			kpConfig: config.KproximateConfig{ApiAuth: "none"},
+			method:   http.MethodPost,
+			path:     "/status/scaleup",
+			token:    "scale-token",
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "metrics are never protected",
+			kpConfig: tokenConfig,
+			method:   http.MethodGet,
+			path:     "/metrics",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "missing token",
+			kpConfig: tokenConfig,
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong token",
+			kpConfig: tokenConfig,
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			token:    "guess",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "read token reads",
+			kpConfig: tokenConfig,
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			token:    "read-token",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "read token scaling",
+			kpConfig: tokenConfig,
+			method:   http.MethodPost,
+			path:     "/status/scaleup",
+			token:    "read-token",
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "scale token scaling",
+			kpConfig: tokenConfig,
+			method:   http.MethodPost,
+			path:     "/status/scaleup",
+			token:    "scale-token",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "kubernetes allowed",
+			kpConfig: kubernetesConfig,
+			reviewer: &fakeAccessReviewer{user: "operator", allowed: true},
+			method:   http.MethodPost,
+			path:     "/status/scaleup",
+			token:    "service-account-token",
+			expected: http.StatusOK,
+		},
+		{
+			name:     "kubernetes missing token",
+			kpConfig: kubernetesConfig,
+			reviewer: &fakeAccessReviewer{user: "operator", allowed: true},
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "kubernetes token review denied",
+			kpConfig: kubernetesConfig,
+			reviewer: &fakeAccessReviewer{},
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			token:    "expired-token",
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:     "kubernetes read-only user scaling",
+			kpConfig: kubernetesConfig,
+			reviewer: &fakeAccessReviewer{user: "viewer", allowed: false},
+			method:   http.MethodPost,
+			path:     "/status/scaleup",
+			token:    "service-account-token",
+			expected: http.StatusForbidden,
+		},
+		{
+			name:     "kubernetes review error",
+			kpConfig: kubernetesConfig,
+			reviewer: &fakeAccessReviewer{err: errors.New("apiserver unavailable")},
+			method:   http.MethodGet,
+			path:     "/status/scaleevents",
+			token:    "service-account-token",
+			expected: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reviewer := tt.reviewer
+			if reviewer == nil {
+				reviewer = &fakeAccessReviewer{}
+			}
+
+			handler := requireApiAuth(tt.kpConfig, reviewer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expected {
+				t.Errorf("Expected %d, got %d", tt.expected, rec.Code)
+			}
+
+			if tt.kpConfig.ApiAuth != "kubernetes" && reviewer.reviewed {
+				t.Errorf("Expected no access review with apiAuth %s", tt.kpConfig.ApiAuth)
+			}
+		})
+	}
+}
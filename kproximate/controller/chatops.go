@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+const (
+	// Slack rejects requests whose timestamp is further than this from now
+	slackRequestMaxAge = time.Minute * 5
+	// Slack expects a reply to a slash command within 3 seconds, the result
+	// of slower commands is posted to the command's response_url
+	slackResponseTimeout = time.Millisecond * 2500
+	slackRequestMaxSize  = 1 << 16
+)
+
+const chatOpsHelp = "Usage: status | scale-up [nodeClass] | approve <kpNode>"
+
+// Verifies the request was signed by Slack using the app's signing secret.
+func verifySlackSignature(signingSecret string, timestamp string, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > slackRequestMaxAge || age < -slackRequestMaxAge {
+		return errors.New("timestamp is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+// The Slack user IDs allowed to scale up and approve scale downs
+func chatOpsUsers(kpConfig config.KproximateConfig) []string {
+	users := []string{}
+	for _, user := range strings.Split(kpConfig.ChatOpsUsers, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			users = append(users, user)
+		}
+	}
+
+	return users
+}
+
+type slackResponse struct {
+	ResponseType string `json:"response_type"`
+	Text         string `json:"text"`
+}
+
+func postSlackResponse(responseUrl string, text string) {
+	body, _ := json.Marshal(slackResponse{ResponseType: "in_channel", Text: text})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseUrl, bytes.NewReader(body))
+	if err != nil {
+		logger.WarnLog("Failed to post chat-ops response", "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		logger.WarnLog("Failed to post chat-ops response", "error", err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func registerChatOpsHandlers(
+	kpConfig *config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+	approvals *scaleDownApprovals,
+	explainer *decisionExplainer,
+	actions operatorActions,
+) {
+	http.Handle("/chatops/slack", slackCommandHandler(kpConfig, kpScaler, queue, approvals, explainer, actions))
+}
+
+// Serves Slack slash commands for reporting status, requesting a scale up and
+// approving proposed scale downs. Commands which change the cluster are only
+// accepted from chatOpsUsers.
+func slackCommandHandler(
+	kpConfig *config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+	approvals *scaleDownApprovals,
+	explainer *decisionExplainer,
+	actions operatorActions,
+) http.HandlerFunc {
+	signingSecret := kpConfig.ChatOpsSigningSecret
+	users := chatOpsUsers(*kpConfig)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, slackRequestMaxSize))
+		if err != nil {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		err = verifySlackSignature(
+			signingSecret,
+			r.Header.Get("X-Slack-Request-Timestamp"),
+			r.Header.Get("X-Slack-Signature"),
+			body,
+			time.Now(),
+		)
+		if err != nil {
+			logger.WarnLog("Rejected chat-ops request", "error", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+
+		user := form.Get("user_id")
+		args := strings.Fields(form.Get("text"))
+		if len(args) == 0 {
+			args = []string{"help"}
+		}
+
+		var action func(context.Context) (string, error)
+		switch args[0] {
+		case "status":
+			action = func(ctx context.Context) (string, error) {
+				return chatOpsStatus(ctx, *kpConfig, kpScaler, queue, approvals, explainer)
+			}
+		case "scale-up", "approve":
+			if !slices.Contains(users, user) {
+				logger.WarnLog("Rejected chat-ops command from unauthorized user", "user", user, "command", args[0])
+				respondSlack(w, fmt.Sprintf("<@%s> is not allowed to %s", user, args[0]))
+				return
+			}
+
+			if args[0] == "scale-up" {
+				nodeClass := ""
+				if len(args) > 1 {
+					nodeClass = args[1]
+				}
+
+				action = func(ctx context.Context) (string, error) {
+					scaleEvent, err := manualScaleUp(ctx, *kpConfig, kpScaler, queue, nodeClass, user)
+					if err != nil {
+						return "", err
+					}
+
+					return fmt.Sprintf("Requested scale up of %s (%s) on %s", scaleEvent.NodeName, scaleEvent.NodeClass, scaleEvent.TargetHost.Node), nil
+				}
+			} else {
+				if len(args) != 2 {
+					respondSlack(w, chatOpsHelp)
+					return
+				}
+
+				action = func(ctx context.Context) (string, error) {
+					err := approveScaleDown(ctx, approvals, queue, args[1], user)
+					if err != nil {
+						return "", err
+					}
+
+					return fmt.Sprintf("Approved scale down of %s", args[1]), nil
+				}
+			}
+		default:
+			respondSlack(w, chatOpsHelp)
+			return
+		}
+
+		result := actions.run(action)
+		select {
+		case res := <-result:
+			respondSlack(w, res.text())
+		case <-time.After(slackResponseTimeout):
+			respondSlack(w, "Waiting for the current assessment to finish, the result will follow")
+			responseUrl := form.Get("response_url")
+			go func() {
+				res := <-result
+				if responseUrl != "" {
+					postSlackResponse(responseUrl, res.text())
+				}
+			}()
+		}
+	}
+}
+
+func (r operatorResult) text() string {
+	if r.err != nil {
+		return fmt.Sprintf("Failed: %s", r.err)
+	}
+
+	return r.message
+}
+
+func respondSlack(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(slackResponse{ResponseType: "in_channel", Text: text})
+}
+
+func chatOpsStatus(
+	ctx context.Context,
+	kpConfig config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+	approvals *scaleDownApprovals,
+	explainer *decisionExplainer,
+) (string, error) {
+	numKpNodes, err := kpScaler.NumReadyNodes(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to get kproximate nodes: %w", err)
+	}
+
+	maxKpNodes, err := kpScaler.MaxKpNodes()
+	if err != nil {
+		return "", fmt.Errorf("failed to assess proxmox capacity: %w", err)
+	}
+
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to count scale events: %w", err)
+	}
+
+	explainer.mu.Lock()
+	scaleUp := explainer.scaleUp
+	scaleDown := explainer.scaleDown
+	explainer.mu.Unlock()
+
+	var status strings.Builder
+	fmt.Fprintf(&status, "kpNodes: %d of %d\n", numKpNodes, maxKpNodes)
+	fmt.Fprintf(&status, "Scale events in progress: %d\n", allScaleEvents)
+	fmt.Fprintf(&status, "Last scale up assessment: %s\n", scaleUp.Decision)
+	fmt.Fprintf(&status, "Last scale down assessment: %s\n", scaleDown.Decision)
+
+	for _, proposal := range approvals.list() {
+		fmt.Fprintf(&status, "Awaiting approval: scale down of %s", proposal.ScaleEvent.NodeName)
+		if proposal.Reason != "" {
+			fmt.Fprintf(&status, ", %s", proposal.Reason)
+		}
+		status.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(status.String(), "\n"), nil
+}
+
+// Returned when an operator's scale up cannot be requested as it would exceed
+// maxKpNodes or the capacity of the Proxmox cluster, or names an unknown node
+// class.
+var errScaleUpRefused = errors.New("scale up refused")
+
+// Queues a scale up requested by an operator, within maxKpNodes and the
+// capacity of the Proxmox cluster.
+func manualScaleUp(
+	ctx context.Context,
+	kpConfig config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+	nodeClass string,
+	requester string,
+) (*scaler.ScaleEvent, error) {
+	allScaleEvents, err := queue.countScalingEvents([]string{scaleUpQueueName})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count scale events: %w", err)
+	}
+
+	numKpNodes, err := kpScaler.NumReadyNodes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get kproximate nodes: %w", err)
+	}
+
+	maxKpNodes, err := kpScaler.MaxKpNodes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to assess proxmox capacity: %w", err)
+	}
+
+	if numKpNodes+allScaleEvents >= maxKpNodes {
+		return nil, fmt.Errorf("%w, reached maxKpNodes, %d kpNodes and %d queued scale up events", errScaleUpRefused, numKpNodes, allScaleEvents)
+	}
+
+	scaleEvent, err := kpScaler.ManualScaleEvent(nodeClass)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %w", errScaleUpRefused, err)
+	}
+
+	numPlaceable, err := kpScaler.NumPlaceableScaleEvents([]*scaler.ScaleEvent{scaleEvent})
+	if err != nil {
+		return nil, fmt.Errorf("failed to assess proxmox capacity: %w", err)
+	}
+
+	if numPlaceable == 0 {
+		return nil, fmt.Errorf("%w, the proxmox cluster has no capacity for a %s kpNode", errScaleUpRefused, scaleEvent.NodeClass)
+	}
+
+	err = kpScaler.SelectTargetHosts([]*scaler.ScaleEvent{scaleEvent})
+	if err != nil {
+		return nil, fmt.Errorf("failed to select target host: %w", err)
+	}
+
+	err = queue.queueScaleEvent(ctx, scaleEvent, scaleUpQueueName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue scale up event: %w", err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Requested manual scale up event: %s", scaleEvent.NodeName), "requester", requester)
+
+	return scaleEvent, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+func signSlackRequest(signingSecret string, timestamp string, body string) string {
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:%s", timestamp, body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := "command=%2Fkproximate&text=status&user_id=U1"
+	timestamp := fmt.Sprint(now.Unix())
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		valid     bool
+	}{
+		{
+			name:      "valid signature",
+			secret:    "secret",
+			timestamp: timestamp,
+			signature: signSlackRequest("secret", timestamp, body),
+			body:      body,
+			valid:     true,
+		},
+		{
+			name:      "tampered body",
+			secret:    "secret",
+			timestamp: timestamp,
+			signature: signSlackRequest("secret", timestamp, body),
+			body:      strings.Replace(body, "status", "scale-up", 1),
+			valid:     false,
+		},
+		{
+			name:      "wrong secret",
+			secret:    "secret",
+			timestamp: timestamp,
+			signature: signSlackRequest("other", timestamp, body),
+			body:      body,
+			valid:     false,
+		},
+		{
+			name:      "stale timestamp",
+			secret:    "secret",
+			timestamp: fmt.Sprint(now.Add(-slackRequestMaxAge - time.Second).Unix()),
+			signature: signSlackRequest("secret", fmt.Sprint(now.Add(-slackRequestMaxAge-time.Second).Unix()), body),
+			body:      body,
+			valid:     false,
+		},
+		{
+			name:      "future timestamp",
+			secret:    "secret",
+			timestamp: fmt.Sprint(now.Add(slackRequestMaxAge + time.Second).Unix()),
+			signature: signSlackRequest("secret", fmt.Sprint(now.Add(slackRequestMaxAge+time.Second).Unix()), body),
+			body:      body,
+			valid:     false,
+		},
+		{
+			name:      "missing timestamp",
+			secret:    "secret",
+			timestamp: "",
+			signature: signSlackRequest("secret", "", body),
+			body:      body,
+			valid:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifySlackSignature(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), now)
+			if tt.valid && err != nil {
+				t.Errorf("Expected a valid signature, got %v", err)
+			}
+
+			if !tt.valid && err == nil {
+				t.Error("Expected the signature to be rejected")
+			}
+		})
+	}
+}
+
+func TestChatOpsUsers(t *testing.T) {
+	users := chatOpsUsers(config.KproximateConfig{ChatOpsUsers: " U1, ,U2 "})
+	if len(users) != 2 || users[0] != "U1" || users[1] != "U2" {
+		t.Errorf("Expected [U1 U2], got %v", users)
+	}
+}
+
+func TestSlackCommandAllowList(t *testing.T) {
+	kpConfig := &config.KproximateConfig{
+		ChatOpsSigningSecret: "secret",
+		ChatOpsUsers:         "U1",
+	}
+
+	tests := []struct {
+		name     string
+		user     string
+		approved bool
+	}{
+		{
+			name:     "listed user",
+			user:     "U1",
+			approved: true,
+		},
+		{
+			name:     "user not on the allow-list",
+			user:     "U2",
+			approved: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queue := &fakeScaleEventQueue{}
+			approvals := newScaleDownApprovals()
+			approvals.propose([]*scaler.ScaleEvent{{ScaleType: scaler.ScaleTypeDown, NodeName: "kp-node-1"}}, nil, time.Now())
+
+			actions := make(operatorActions)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			go func() {
+				for {
+					select {
+					case action := <-actions:
+						action(ctx)
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+
+			handler := slackCommandHandler(kpConfig, nil, queue, approvals, &decisionExplainer{}, actions)
+
+			body := url.Values{"user_id": {tt.user}, "text": {"approve kp-node-1"}}.Encode()
+			timestamp := fmt.Sprint(time.Now().Unix())
+			req := httptest.NewRequest(http.MethodPost, "/chatops/slack", strings.NewReader(body))
+			req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+			req.Header.Set("X-Slack-Signature", signSlackRequest("secret", timestamp, body))
+
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			var response slackResponse
+			err := json.NewDecoder(rec.Body).Decode(&response)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			numQueued := len(queue.queued[scaleDownQueueName])
+			if tt.approved && numQueued != 1 {
+				t.Errorf("Expected the scale down to be approved, got %q", response.Text)
+			}
+
+			if !tt.approved {
+				if numQueued != 0 || !strings.Contains(response.Text, "not allowed") {
+					t.Errorf("Expected the command to be refused, got %q", response.Text)
+				}
+
+				if len(approvals.list()) != 1 {
+					t.Error("Expected the scale down to still await approval")
+				}
+			}
+		})
+	}
+}
+
+func TestSlackCommandRejectsUnsignedRequest(t *testing.T) {
+	kpConfig := &config.KproximateConfig{
+		ChatOpsSigningSecret: "secret",
+		ChatOpsUsers:         "U1",
+	}
+	handler := slackCommandHandler(kpConfig, nil, &fakeScaleEventQueue{}, newScaleDownApprovals(), &decisionExplainer{}, make(operatorActions))
+
+	body := url.Values{"user_id": {"U1"}, "text": {"scale-up"}}.Encode()
+	timestamp := fmt.Sprint(time.Now().Unix())
+	req := httptest.NewRequest(http.MethodPost, "/chatops/slack", strings.NewReader(body))
+	req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+	req.Header.Set("X-Slack-Signature", signSlackRequest("other", timestamp, body))
+
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
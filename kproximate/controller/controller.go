@@ -2,23 +2,42 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/grpcqueue"
+	"github.com/lupinelab/kproximate/kubernetes"
 	"github.com/lupinelab/kproximate/logger"
 	"github.com/lupinelab/kproximate/metrics"
 	"github.com/lupinelab/kproximate/rabbitmq"
 	"github.com/lupinelab/kproximate/scaler"
-	amqp "github.com/rabbitmq/amqp091-go"
+	apiv1 "k8s.io/api/core/v1"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rbac" {
+		os.Exit(runRBAC(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "approve" {
+		os.Exit(runApprove(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		os.Exit(runValidate(os.Args[2:]))
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "generate" {
+		os.Exit(runGenerate(os.Args[2:]))
+	}
+
 	kpConfig, err := config.GetKpConfig()
 	if err != nil {
 		logger.FatalLog("Failed to get config", err)
@@ -26,26 +45,24 @@ func main() {
 
 	logger.ConfigureLogger("controller", kpConfig.Debug)
 
-	scaler, err := scaler.NewProxmoxScaler(kpConfig)
+	// Shared by the scaler and the controller's own watches and events
+	kubeClient, err := kubernetes.NewKubernetesClient(scaler.KubernetesClientOptions(kpConfig))
 	if err != nil {
-		logger.FatalLog("Failed to initialise scaler", err)
+		logger.FatalLog("Failed to initialise kubernetes client", err)
 	}
 
-	rabbitConfig, err := config.GetRabbitConfig()
+	scaler, err := scaler.NewProxmoxScaler(kpConfig, &kubeClient)
 	if err != nil {
-		logger.FatalLog("Failed to get rabbit config", err)
+		logger.FatalLog("Failed to initialise scaler", err)
 	}
 
-	conn, mgmtClient := rabbitmq.NewRabbitmqConnection(rabbitConfig)
-	defer conn.Close()
-
-	scaleUpChannel := rabbitmq.NewChannel(conn)
-	defer scaleUpChannel.Close()
-	scaleUpQueue := rabbitmq.DeclareQueue(scaleUpChannel, "scaleUpEvents")
-
-	scaleDownChannel := rabbitmq.NewChannel(conn)
-	defer scaleDownChannel.Close()
-	scaleDownQueue := rabbitmq.DeclareQueue(scaleDownChannel, "scaleDownEvents")
+	// Observers make no changes in Proxmox
+	if !kpConfig.ObserverMode {
+		err = scaler.CheckProxmoxPermissions()
+		if err != nil {
+			logger.FatalLog("Failed to check Proxmox permissions", err)
+		}
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -57,81 +74,523 @@ func main() {
 
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	go metrics.Serve(ctx, scaler, kpConfig)
+	// Secrets are only read on startup, so restart to apply any changes
+	if kpConfig.SecretsDir != "" {
+		go func() {
+			err := config.WatchSecrets(ctx, kpConfig.SecretsDir, time.Second*10)
+			if err == nil {
+				logger.InfoLog("Secrets changed, restarting to apply them")
+				cancel()
+			} else if ctx.Err() == nil {
+				logger.WarnLog("Failed to watch secrets", "error", err)
+			}
+		}()
+	}
+
+	closeTransport := func() {}
+	defer func() {
+		closeTransport()
+	}()
+
+	queue := observeOr(kpConfig, func() scaleEventQueue {
+		if kpConfig.Transport == "grpc" {
+			grpcQueue := newGrpcQueue(ctx, kpConfig)
+			registerDeadLetterHandlers(&grpcDeadLetters{server: grpcQueue.server})
+			return grpcQueue
+		}
+
+		rabbitQueue, closeRabbit := newRabbitQueue(ctx, kpConfig)
+		closeTransport = closeRabbit
+		return rabbitQueue
+	})
+	if observer, ok := queue.(*observerQueue); ok {
+		registerObserverHandlers(observer)
+	}
+
+	monitor := newQueueMonitor(time.Second * time.Duration(kpConfig.StuckScaleEventSeconds))
+	queue = &monitoredQueue{
+		scaleEventQueue: queue,
+		monitor:         monitor,
+	}
+	go monitorQueues(ctx, queue, monitor)
+
+	tracker := newScaleEventTracker(scaleEventStatusRetention)
+	go trackProgress(ctx, queue.progressReports(), tracker, monitor)
+	registerStatusHandlers(tracker)
+	registerCostHandlers(scaler)
+
+	explainer := &decisionExplainer{}
+	registerExplainHandlers(explainer)
+
+	configUpdates := make(chan config.KproximateConfig)
+	if kpConfig.ConfigDir != "" {
+		go watchConfig(ctx, kpConfig.ConfigDir, kpConfig, configUpdates)
+	}
+
+	approvals := newScaleDownApprovals()
+	actions := make(operatorActions)
+	registerApprovalHandlers(approvals, queue, actions)
+	registerScaleUpHandlers(&kpConfig, scaler, queue, actions)
+	registerKpNodeHandlers(scaler, queue, actions)
+	evacuating := &evacuation{}
+	registerEvacuationHandlers(&kpConfig, scaler, queue, evacuating, actions)
+	if kpConfig.ChatOpsSigningSecret != "" {
+		registerChatOpsHandlers(&kpConfig, scaler, queue, approvals, explainer, actions)
+	}
+
+	registerSchemaHandlers()
+
+	err = scaler.StartInformers(ctx)
+	if err != nil {
+		logger.FatalLog("Failed to start kubernetes informers", err)
+	}
+
+	currentConfig := &sharedConfig{config: kpConfig}
+	go metrics.Serve(ctx, scaler, currentConfig.get, requireApiAuth(kpConfig, &kubeClient, http.DefaultServeMux))
 	logger.InfoLog("Started")
+
+	// Assess for scale up as soon as a pod fails to schedule rather than
+	// waiting for the next poll
+	unschedulablePods := make(chan struct{}, 1)
+	go kubeClient.WatchUnschedulablePods(ctx, unschedulablePods)
+
+	// Assess for scale down shortly after a large workload shrinks rather
+	// than waiting for the next poll
+	shrunkWorkloads := make(chan struct{}, 1)
+	if kpConfig.ScaleDownTriggerPods > 0 {
+		go kubeClient.WatchWorkloadShrinkage(ctx, kpConfig.ScaleDownTriggerPods, shrunkWorkloads)
+	}
+	var scaleDownSoon <-chan time.Time
+
+	debouncer := &scaleUpDebouncer{
+		window: time.Second * time.Duration(kpConfig.ScaleUpDebounceSeconds),
+	}
+
+	health := &proxmoxHealthGate{
+		kubeClient: &kubeClient,
+		config:     kpConfig,
+	}
+
+	pollTicker := time.NewTicker(time.Second * time.Duration(kpConfig.PollInterval))
+	defer pollTicker.Stop()
+
+	var lastTemplateGC time.Time
+	// Placeholder pods are only removed once overprovisioning is disabled
+	// after being enabled, the controller is otherwise not granted access to
+	// them
+	overprovisioning := false
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			time.Sleep(time.Second * time.Duration(kpConfig.PollInterval))
+		case updatedConfig := <-configUpdates:
+			changes := config.ApplyReloadableSettings(&kpConfig, updatedConfig)
+			if len(changes) > 0 {
+				scaler.ReloadConfig(kpConfig)
+				currentConfig.set(kpConfig)
+				health.config = kpConfig
+				pollTicker.Reset(time.Second * time.Duration(kpConfig.PollInterval))
+				logger.InfoLog("Reloaded config", "changes", strings.Join(changes, ", "))
+				recordEvent(ctx, &kubeClient, kpConfig, apiv1.EventTypeNormal, "ConfigReloaded", strings.Join(changes, ", "))
+			}
+		case action := <-actions:
+			action(ctx)
+		case <-unschedulablePods:
+			logger.DebugLog("Found unschedulable pod")
+			// Health is only assessed each poll
+			if health.degraded != "" || evacuating.active() {
+				continue
+			}
+			assessScaleUp(ctx, scaler, kpConfig, queue, monitor, debouncer, explainer)
+		case <-shrunkWorkloads:
+			logger.DebugLog("Found shrunk workload")
+			if scaleDownSoon == nil {
+				scaleDownSoon = time.After(workloadSettleTime)
+			}
+		case <-scaleDownSoon:
+			scaleDownSoon = nil
+			// Health is only assessed each poll
+			if health.degraded != "" || evacuating.active() {
+				continue
+			}
+			assessScaleDown(ctx, scaler, kpConfig, queue, explainer, approvals)
 
-			assessScaleUp(ctx, scaler, kpConfig, rabbitConfig, scaleUpChannel, scaleUpQueue, mgmtClient)
-			assessScaleDown(ctx, scaler, rabbitConfig, scaleDownChannel, scaleDownQueue, mgmtClient)
+			if kpConfig.ScaleDownApproval {
+				syncScaleDownProposals(ctx, &kubeClient, queue, approvals)
+			}
+		case <-pollTicker.C:
+			if !health.healthy(ctx, scaler, explainer) {
+				approvals.propose(nil, nil, time.Now())
+				continue
+			}
+
+			if evacuating.active() {
+				approvals.propose(nil, nil, time.Now())
+				evacuating.step(ctx, scaler, queue)
+				evacuating.explain(explainer)
+				continue
+			}
+
+			assessScaleUp(ctx, scaler, kpConfig, queue, monitor, debouncer, explainer)
+			assessScaleDown(ctx, scaler, kpConfig, queue, explainer, approvals)
+
+			if kpConfig.ScaleDownApproval {
+				syncScaleDownProposals(ctx, &kubeClient, queue, approvals)
+			}
+
+			if kpConfig.NodePools {
+				assessNodePools(ctx, scaler, kpConfig, queue)
+			}
+
+			if kpConfig.InitFailedSeconds > 0 {
+				assessInitFailedNodes(ctx, scaler, queue)
+			}
+
+			if kpConfig.DrainHosts {
+				assessDrainingHosts(ctx, kpConfig, scaler, queue)
+			}
+
+			if kpConfig.RebalanceSkew > 0 {
+				assessRebalance(ctx, kpConfig, scaler, queue)
+			}
+
+			if kpConfig.PatchIntervalHours > 0 {
+				assessPatching(ctx, kpConfig, scaler, queue)
+			}
+
+			if kpConfig.KpTemplateGCRegex != "" && !kpConfig.ObserverMode && time.Since(lastTemplateGC) > templateGCInterval {
+				deleteObsoleteTemplates(scaler)
+				lastTemplateGC = time.Now()
+			}
+
+			if !kpConfig.ObserverMode {
+				collectHibernatedKpNodes(ctx, scaler)
+				replenishWarmPool(ctx, scaler, queue, monitor)
+			}
+
+			if !kpConfig.ObserverMode && (kpConfig.OverprovisionReplicas > 0 || overprovisioning) {
+				maintainOverprovisioning(ctx, &kubeClient, kpConfig)
+				overprovisioning = kpConfig.OverprovisionReplicas > 0
+			}
+		}
+	}
+
+}
+
+func newGrpcQueue(ctx context.Context, kpConfig config.KproximateConfig) *grpcQueue {
+	tlsConfig, err := grpcqueue.NewTLSConfig(kpConfig.GrpcCertFile, kpConfig.GrpcKeyFile, kpConfig.GrpcCAFile, true)
+	if err != nil {
+		logger.FatalLog("Failed to load gRPC TLS config", err)
+	}
+
+	// A worker which has neither renewed the lease of a scale event nor
+	// acknowledged it by the time it could have provisioned and joined a node
+	// is assumed to have died
+	leaseDuration := time.Second * time.Duration(kpConfig.WaitSecondsForProvision+kpConfig.WaitSecondsForJoin+300)
+	server := grpcqueue.NewServer(leaseDuration, rabbitmq.DeliveryLimit)
+
+	go func() {
+		err := server.Serve(ctx, kpConfig.GrpcListenAddress, tlsConfig)
+		if err != nil {
+			logger.FatalLog("Failed to serve gRPC queue", err)
 		}
+	}()
+
+	return &grpcQueue{
+		server:    server,
+		queueName: kpConfig.QueueName,
+	}
+}
+
+// Returns the queue along with a function closing its connection to RabbitMQ.
+func newRabbitQueue(ctx context.Context, kpConfig config.KproximateConfig) (*rabbitQueue, func()) {
+	rabbitConfig, err := config.GetRabbitConfig()
+	if err != nil {
+		logger.FatalLog("Failed to get rabbit config", err)
+	}
+
+	conn, mgmtClient := rabbitmq.NewRabbitmqConnection(rabbitConfig)
+
+	channel := rabbitmq.NewChannel(conn)
+	deadLetterQueue := kpConfig.QueueName(rabbitmq.DeadLetterQueue)
+	for _, queueName := range []string{scaleUpQueueName, scaleDownQueueName} {
+		err = rabbitmq.MigrateQueue(ctx, conn, kpConfig.QueueName(queueName))
+		if err != nil {
+			logger.FatalLog("Failed to migrate queue", err)
+		}
+
+		rabbitmq.DeclareQueue(channel, kpConfig.QueueName(queueName), deadLetterQueue)
+	}
+
+	// Scale events which have not finished by then are reported as stuck
+	inFlightExpiry := time.Second * time.Duration(kpConfig.StuckScaleEventSeconds)
+
+	deadLetterChannel := rabbitmq.NewChannel(conn)
+	registerDeadLetterHandlers(&rabbitDeadLetters{
+		channel:         deadLetterChannel,
+		mgmtClient:      mgmtClient,
+		rabbitConfig:    rabbitConfig,
+		deadLetterQueue: deadLetterQueue,
+		inFlightExpiry:  inFlightExpiry,
+	})
+
+	statusChannel := rabbitmq.NewChannel(conn)
+	statusQueue := rabbitmq.DeclareStatusQueue(statusChannel, kpConfig.QueueName(rabbitmq.StatusQueue))
+
+	queue := &rabbitQueue{
+		channel:        channel,
+		mgmtClient:     mgmtClient,
+		rabbitConfig:   rabbitConfig,
+		queueName:      kpConfig.QueueName,
+		reports:        consumeStatusQueue(ctx, statusChannel, statusQueue.Name),
+		inFlightExpiry: inFlightExpiry,
+	}
+
+	return queue, func() {
+		statusChannel.Close()
+		deadLetterChannel.Close()
+		channel.Close()
+		conn.Close()
+	}
+}
+
+const templateGCInterval = time.Hour
+
+// How long after a workload shrinks scale down is assessed, giving its pods
+// time to terminate
+const workloadSettleTime = time.Second * 30
+
+// Returns how many of a cut down batch of scale up events to queue. Part of
+// a batch scaling up for gangs would only let part of them schedule, so none
+// of it is queued until there is room for all of it.
+func wholeGangs(numScaleEvents int, gangs []string, assessed *assessment) int {
+	if len(gangs) == 0 {
+		return numScaleEvents
+	}
+
+	assessed.reason("Holding back the scale events until there is room for the whole of gangs %s", strings.Join(gangs, ", "))
+	return 0
+}
+
+func deleteObsoleteTemplates(kpScaler scaler.Scaler) {
+	logger.DebugLog("Collecting obsolete templates")
+	deletedTemplates, err := kpScaler.DeleteObsoleteTemplates()
+	for _, template := range deletedTemplates {
+		logger.InfoLog(fmt.Sprintf("Deleted obsolete template %s", template))
+	}
+
+	if err != nil {
+		logger.ErrorLog("Failed to delete obsolete templates", "error", err)
+	}
+}
+
+func collectHibernatedKpNodes(ctx context.Context, kpScaler scaler.Scaler) {
+	deletedKpNodes, err := kpScaler.CollectHibernatedKpNodes(ctx)
+	for _, kpNode := range deletedKpNodes {
+		logger.InfoLog(fmt.Sprintf("Deleted hibernated kpNode %s", kpNode))
 	}
 
+	if err != nil {
+		logger.ErrorLog("Failed to delete hibernated kpNodes", "error", err)
+	}
+}
+
+// Holds the config last applied by the control loop for goroutines that
+// read it concurrently, such as the metrics recorder.
+type sharedConfig struct {
+	mu     sync.RWMutex
+	config config.KproximateConfig
+}
+
+func (c *sharedConfig) get() config.KproximateConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+func (c *sharedConfig) set(updated config.KproximateConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = updated
+}
+
+// Records an Event against the controller's own pod when it knows its name.
+func recordEvent(ctx context.Context, kubeClient kubernetes.ControllerKubernetes, kpConfig config.KproximateConfig, eventType string, reason string, message string) {
+	if kpConfig.PodName == "" || kpConfig.PodNamespace == "" {
+		return
+	}
+
+	err := kubeClient.RecordPodEvent(ctx, kpConfig.PodNamespace, kpConfig.PodName, eventType, reason, message)
+	if err != nil {
+		logger.WarnLog("Failed to record event", "reason", reason, "error", err)
+	}
+}
+
+// Polls the config directory and sends the config only when a reloadable
+// setting differs from the last one sent.
+func watchConfig(ctx context.Context, configDir string, current config.KproximateConfig, configUpdates chan<- config.KproximateConfig) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second * 10):
+			updatedConfig, err := config.GetKpConfigFromDir(configDir)
+			if err != nil {
+				logger.WarnLog("Failed to reload config, keeping current settings", "error", err)
+				continue
+			}
+
+			if len(config.ApplyReloadableSettings(&current, updatedConfig)) == 0 {
+				continue
+			}
+
+			select {
+			case configUpdates <- updatedConfig:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
 }
 
 func assessScaleUp(
 	ctx context.Context,
 	scaler scaler.Scaler,
 	config config.KproximateConfig,
-	rabbitConfig config.RabbitConfig,
-	scaleUpChannel *amqp.Channel,
-	scaleUpQueue *amqp.Queue,
-	mgmtClient *http.Client,
+	queue scaleEventQueue,
+	monitor *queueMonitor,
+	debouncer *scaleUpDebouncer,
+	explainer *decisionExplainer,
 ) {
+	assessed := assessment{Assessed: time.Now()}
+	defer func() {
+		explainer.recordScaleUp(assessed)
+	}()
 
 	logger.DebugLog("Assessing for scale up")
-	allScaleEvents, err := countScalingEvents(
-		[]string{"scaleUpEvents"},
-		scaleUpChannel,
-		mgmtClient,
-		rabbitConfig,
-	)
+	allScaleEvents, err := queue.countScalingEvents([]string{scaleUpQueueName})
 	if err != nil {
 		logger.FatalLog("Failed to count scaling events", err)
 	}
 
-	numKpNodes, err := scaler.NumReadyNodes()
+	numKpNodes, err := scaler.NumReadyNodes(ctx)
 	if err != nil {
 		logger.FatalLog("Failed to get kproximate nodes", err)
 	}
 
-	if numKpNodes+allScaleEvents < config.MaxKpNodes {
+	maxKpNodes, err := scaler.MaxKpNodes()
+	if err != nil {
+		logger.ErrorLog(fmt.Sprintf("Failed to assess Proxmox capacity: %s", err))
+		assessed.Decision = "Failed to assess Proxmox capacity"
+		assessed.reason("Could not derive maxKpNodes from Proxmox free capacity: %s", err)
+		return
+	}
+	metrics.SetMaxKpNodes(maxKpNodes)
+
+	if numKpNodes+allScaleEvents < maxKpNodes {
+		unschedulableResources, err := scaler.GetUnschedulableResources(ctx)
+		if err != nil {
+			logger.FatalLog("Failed to get unschedulable resources", err)
+		}
+
 		logger.DebugLog("Calculating required scale events")
-		scaleUpEvents, err := scaler.RequiredScaleEvents(allScaleEvents)
+		scaleUpEvents, err := scaler.RequiredScaleEvents(ctx, allScaleEvents, monitor.inFlightByClass(scaleUpQueueName))
 		if err != nil {
 			logger.FatalLog("Failed to calculate required scale events", err)
 		}
 
+		explanation := scaler.Explain()
+		assessed.ScaleUp = &explanation.ScaleUp
+
+		metrics.SetBootstrapping(explanation.ScaleUp.Bootstrapping)
+		if explanation.ScaleUp.Bootstrapping && len(scaleUpEvents) > 0 {
+			logger.InfoLog("The cluster only has control-plane nodes, bootstrapping its first workers")
+		}
+
+		numRequired := len(scaleUpEvents)
+		scaleUpEvents = debouncer.filter(unschedulableResources, scaleUpEvents)
+		if len(scaleUpEvents) < numRequired {
+			logger.DebugLog("Suppressing scale up, already scaled up for these unschedulable resources", "resources", fmt.Sprintf("%+v", unschedulableResources))
+			assessed.reason("%d scale events were suppressed as their node classes were already scaled up for these unschedulable resources within %ds", numRequired-len(scaleUpEvents), config.ScaleUpDebounceSeconds)
+			if len(scaleUpEvents) == 0 {
+				assessed.Decision = "Suppressed"
+				return
+			}
+		}
+
+		// A large backlog of pending pods is provisioned for in a burst,
+		// with workers exceeding their usual concurrency
+		burst := config.BurstThreshold > 0 && len(scaleUpEvents) >= config.BurstThreshold
+		metrics.SetScaleUpBurst(burst)
+		if burst {
+			logger.InfoLog(fmt.Sprintf("%d scale events required, scaling up in a burst", len(scaleUpEvents)))
+			assessed.reason("%d scale events are required, at least burstThreshold of %d", len(scaleUpEvents), config.BurstThreshold)
+			for _, scaleUpEvent := range scaleUpEvents {
+				scaleUpEvent.Burst = true
+			}
+		}
+
 		if len(scaleUpEvents) > 0 {
-			maxScaleEvents := config.MaxKpNodes - (numKpNodes + allScaleEvents)
+			maxScaleEvents := maxKpNodes - (numKpNodes + allScaleEvents)
 			numScaleEvents := min(maxScaleEvents, len(scaleUpEvents))
+			if numScaleEvents < len(scaleUpEvents) {
+				assessed.reason("%d scale events are required but only %d more kpNodes are allowed by maxKpNodes", len(scaleUpEvents), numScaleEvents)
+				numScaleEvents = wholeGangs(numScaleEvents, explanation.ScaleUp.Gangs, &assessed)
+			}
 			scaleUpEvents = scaleUpEvents[0:numScaleEvents]
+
+			// Hold back scale events that no pHost has the capacity for rather
+			// than queueing events that are bound to fail
+			numPlaceable, err := scaler.NumPlaceableScaleEvents(scaleUpEvents)
+			if err != nil {
+				logger.FatalLog("Failed to assess proxmox capacity", err)
+			}
+
+			metrics.SetScaleUpPaused(numPlaceable < len(scaleUpEvents))
+			if numPlaceable < len(scaleUpEvents) {
+				logger.WarnLog(
+					"Proxmox cluster is saturated, pausing scale up",
+					"required", len(scaleUpEvents),
+					"placeable", numPlaceable,
+				)
+				assessed.reason("The proxmox cluster only has capacity for %d of the scale events", numPlaceable)
+				scaleUpEvents = scaleUpEvents[0:wholeGangs(numPlaceable, explanation.ScaleUp.Gangs, &assessed)]
+			}
+
 			logger.DebugLog("Selecting target hosts")
 			err = scaler.SelectTargetHosts(scaleUpEvents)
 			if err != nil {
 				logger.FatalLog("Failed to select target host", err)
 			}
 		} else {
+			metrics.SetScaleUpPaused(false)
 			logger.DebugLog("No scale up events required")
 		}
 
+		assessed.Decision = fmt.Sprintf("Requested %d scale up events", len(scaleUpEvents))
+		debouncer.record(unschedulableResources, scaleUpEvents)
+
 		for _, scaleUpEvent := range scaleUpEvents {
 			logger.DebugLog("Generated scale event", "scaleEvent", fmt.Sprintf("%+v", scaleUpEvent))
-			err = queueScaleEvent(ctx, scaleUpEvent, scaleUpChannel, scaleUpQueue.Name)
+			err = queue.queueScaleEvent(ctx, scaleUpEvent, scaleUpQueueName)
 			if err != nil {
 				logger.ErrorLog("Failed to queue scale up event", err)
 			}
 
 			logger.InfoLog(fmt.Sprintf("Requested scale up event: %s", scaleUpEvent.NodeName))
 
-			time.Sleep(time.Second * 1)
+			if explanation.ScaleUp.Bootstrapping {
+				metrics.IncBootstrapScaleEvents()
+			}
+
+			if !scaleUpEvent.Burst {
+				time.Sleep(time.Second * 1)
+			}
 		}
 	} else {
 		logger.DebugLog("Reached maxKpNodes")
+		assessed.Decision = "Reached maxKpNodes"
+		assessed.reason("%d kpNodes and %d queued scale up events, maxKpNodes is %d", numKpNodes, allScaleEvents, maxKpNodes)
 	}
 
 }
@@ -139,95 +598,320 @@ func assessScaleUp(
 func assessScaleDown(
 	ctx context.Context,
 	scaler scaler.Scaler,
-	rabbitConfig config.RabbitConfig,
-	scaleDownChannel *amqp.Channel,
-	scaleDownQueue *amqp.Queue,
-	mgmtClient *http.Client,
+	config config.KproximateConfig,
+	queue scaleEventQueue,
+	explainer *decisionExplainer,
+	approvals *scaleDownApprovals,
 ) {
+	assessed := assessment{Assessed: time.Now()}
+	defer func() {
+		explainer.recordScaleDown(assessed)
+	}()
+
 	logger.DebugLog("Assessing for scale down")
-	allScaleEvents, err := countScalingEvents(
-		[]string{
-			"scaleUpEvents",
-			"scaleDownEvents",
-		},
-		scaleDownChannel,
-		mgmtClient,
-		rabbitConfig,
-	)
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
 	if err != nil {
 		logger.FatalLog("Failed to count scale events", err)
 	}
 
-	numKpNodes, err := scaler.NumReadyNodes()
+	numKpNodes, err := scaler.NumReadyNodes(ctx)
 	if err != nil {
 		logger.FatalLog("Failed to get kproximate nodes", err)
 	}
 
 	if allScaleEvents == 0 && numKpNodes > 0 {
 		logger.DebugLog("Calculating required scale events")
-		scaleDownEvent, err := scaler.AssessScaleDown()
+		scaleDownEvents, err := scaler.AssessScaleDown(ctx)
 		if err != nil {
 			logger.ErrorLog(fmt.Sprintf("Failed to assess scale down: %s", err))
+			assessed.reason("Failed to assess scale down: %s", err)
+		} else {
+			explanation := scaler.Explain()
+			assessed.ScaleDown = &explanation.ScaleDown
 		}
-		if scaleDownEvent != nil {
-			err = queueScaleEvent(ctx, scaleDownEvent, scaleDownChannel, scaleDownQueue.Name)
-			if err != nil {
-				logger.ErrorLog(fmt.Sprintf("Failed to queue scale down event: %s", err))
-			}
+		assessed.Decision = fmt.Sprintf("Requested %d scale down events", len(scaleDownEvents))
 
-			logger.InfoLog(fmt.Sprintf("Requested scale down event: %s", scaleDownEvent.NodeName))
+		if config.ScaleDownApproval {
+			approvals.propose(scaleDownEvents, assessed.ScaleDown, assessed.Assessed)
+		}
+
+		if len(scaleDownEvents) > 0 && config.ScaleDownApproval {
+			assessed.Decision = fmt.Sprintf("Proposed %d scale down events for approval", len(scaleDownEvents))
+			logger.DebugLog("Scale down awaiting approval", "scaleEvents", len(scaleDownEvents))
+		} else if len(scaleDownEvents) > 0 {
+			for _, scaleDownEvent := range scaleDownEvents {
+				err = queue.queueScaleEvent(ctx, scaleDownEvent, scaleDownQueueName)
+				if err != nil {
+					logger.ErrorLog(fmt.Sprintf("Failed to queue scale down event: %s", err))
+					continue
+				}
+
+				logger.InfoLog(fmt.Sprintf("Requested scale down event: %s", scaleDownEvent.NodeName))
+			}
 		} else {
 			logger.DebugLog("No scale down events required")
+
+			// Replacing a node temporarily requires an additional kpNode
+			maxKpNodes, err := scaler.MaxKpNodes()
+			if err != nil {
+				logger.ErrorLog(fmt.Sprintf("Failed to assess Proxmox capacity: %s", err))
+			} else if numKpNodes < maxKpNodes {
+				assessReplacement(ctx, scaler, queue)
+			}
 		}
 	} else {
 		logger.DebugLog("Cannot scale down, scale event in progress or 0 kpNodes in cluster")
+		approvals.propose(nil, nil, assessed.Assessed)
+		assessed.Decision = "Cannot scale down"
+		if allScaleEvents > 0 {
+			assessed.reason("%d scale events are in progress", allScaleEvents)
+		} else {
+			assessed.reason("There are no kpNodes")
+		}
 	}
 }
 
-func countScalingEvents(
-	queueNames []string,
-	channel *amqp.Channel,
-	mgmtClient *http.Client,
-	rabbitConfig config.RabbitConfig,
-) (int, error) {
-	numScalingEvents := 0
+// Recycles kpNodes which joined but never became schedulable. Waits for
+// scale down events in flight to finish so kpNodes are not removed twice.
+func assessInitFailedNodes(
+	ctx context.Context,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+) {
+	scaleDownEvents, err := queue.countScalingEvents([]string{scaleDownQueueName})
+	if err != nil {
+		logger.FatalLog("Failed to count scale events", err)
+	}
 
-	for _, queueName := range queueNames {
-		pendingScaleEvents, err := rabbitmq.GetPendingScaleEvents(channel, queueName)
+	if scaleDownEvents > 0 {
+		return
+	}
+
+	logger.DebugLog("Assessing for init-failed nodes")
+	recycleEvents, err := kpScaler.AssessInitFailedKpNodes(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to assess init-failed nodes", "error", err)
+		return
+	}
+
+	for _, recycleEvent := range recycleEvents {
+		err = queue.queueScaleEvent(ctx, recycleEvent, scaleDownQueueName)
 		if err != nil {
-			return numScalingEvents, err
+			logger.ErrorLog("Failed to queue scale down event", "error", err)
+			continue
 		}
 
-		numScalingEvents += pendingScaleEvents
+		metrics.IncInitFailedKpNodes()
+		logger.InfoLog(fmt.Sprintf("Requested recycling of init-failed node: %s", recycleEvent.NodeName))
+	}
+}
+
+// Moves kpNodes off pHosts which are shutting down or in maintenance. Waits
+// for scale events in flight to finish so kpNodes are not moved twice.
+func assessDrainingHosts(
+	ctx context.Context,
+	kpConfig config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+) {
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
+	if err != nil {
+		logger.FatalLog("Failed to count scale events", err)
+	}
+
+	if allScaleEvents > 0 {
+		return
+	}
+
+	logger.DebugLog("Assessing for draining hosts")
+	migrateEvents, err := kpScaler.AssessDrainingHosts(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to assess draining hosts", "error", err)
+		return
+	}
 
-		runningScaleEvents, err := rabbitmq.GetRunningScaleEvents(mgmtClient, rabbitConfig, queueName)
+	for _, migrateEvent := range migrateEvents {
+		if !workersSupport(kpConfig, migrateEvent) {
+			continue
+		}
+
+		// Migrate events may provision a replacement so are processed with
+		// scale up events
+		err = queue.queueScaleEvent(ctx, migrateEvent, scaleUpQueueName)
 		if err != nil {
-			return numScalingEvents, err
+			logger.ErrorLog("Failed to queue migrate event", "error", err)
+			continue
 		}
 
-		numScalingEvents += runningScaleEvents
+		logger.InfoLog(fmt.Sprintf("Requested migration of %s to %s", migrateEvent.NodeName, migrateEvent.TargetHost.Node))
+	}
+}
+
+// Whether the scale event can be processed by workers of the scale event
+// version they were configured with, which is raised once all workers have
+// been upgraded during a rolling upgrade.
+func workersSupport(kpConfig config.KproximateConfig, scaleEvent *scaler.ScaleEvent) bool {
+	if kpConfig.ScaleEventVersion == 0 || scaler.RequiredScaleEventVersion(scaleEvent) <= kpConfig.ScaleEventVersion {
+		return true
+	}
+
+	logger.DebugLog(fmt.Sprintf("Not requesting %s event for %s, workers support scale event version %d", scaleTypeName(scaleEvent.ScaleType), scaleEvent.NodeName, kpConfig.ScaleEventVersion))
+	return false
+}
+
+// Live migrates a kpNode from the pHost with the most kpNodes to the pHost
+// with the fewest when they differ by rebalanceSkew or more. One kpNode is
+// moved at a time, once no other scale events are in flight.
+func assessRebalance(
+	ctx context.Context,
+	kpConfig config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+) {
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
+	if err != nil {
+		logger.FatalLog("Failed to count scale events", err)
+	}
+
+	if allScaleEvents > 0 {
+		return
+	}
+
+	logger.DebugLog("Assessing host balance")
+	migrateEvent, err := kpScaler.AssessRebalance(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to assess host balance", "error", err)
+		return
+	}
+
+	if migrateEvent == nil || !workersSupport(kpConfig, migrateEvent) {
+		return
+	}
+
+	err = queue.queueScaleEvent(ctx, migrateEvent, scaleUpQueueName)
+	if err != nil {
+		logger.ErrorLog("Failed to queue migrate event", "error", err)
+		return
+	}
+
+	logger.InfoLog(fmt.Sprintf("Requested rebalancing of %s to %s", migrateEvent.NodeName, migrateEvent.TargetHost.Node))
+}
+
+func assessReplacement(
+	ctx context.Context,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+) {
+	logger.DebugLog("Assessing for stranded nodes")
+	replaceEvent, err := kpScaler.AssessReplacement(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to assess stranded nodes", "error", err)
+		return
+	}
+
+	if replaceEvent == nil {
+		return
+	}
+
+	numPlaceable, err := kpScaler.NumPlaceableScaleEvents([]*scaler.ScaleEvent{replaceEvent})
+	if err != nil {
+		logger.ErrorLog("Failed to assess proxmox capacity", "error", err)
+		return
+	}
+
+	if numPlaceable == 0 {
+		logger.DebugLog("Proxmox cluster is saturated, skipping replacement", "node", replaceEvent.ReplaceNodeName)
+		return
+	}
+
+	err = kpScaler.SelectTargetHosts([]*scaler.ScaleEvent{replaceEvent})
+	if err != nil {
+		logger.ErrorLog("Failed to select target host", "error", err)
+		return
 	}
 
-	return numScalingEvents, nil
+	// Replace events provision a node so are processed with scale up events
+	err = queue.queueScaleEvent(ctx, replaceEvent, scaleUpQueueName)
+	if err != nil {
+		logger.ErrorLog("Failed to queue replace event", "error", err)
+		return
+	}
+
+	logger.InfoLog(fmt.Sprintf("Requested replacement of %s with %s (%s)", replaceEvent.ReplaceNodeName, replaceEvent.NodeName, replaceEvent.NodeClass))
 }
 
-func queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, channel *amqp.Channel, queueName string) error {
-	msg, err := json.Marshal(scaleEvent)
+// Patches or replaces the kpNode which has gone longest without being
+// patched once patchIntervalHours has passed. One kpNode is patched at a
+// time, once no other scale events are in flight.
+func assessPatching(
+	ctx context.Context,
+	kpConfig config.KproximateConfig,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+) {
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
+	if err != nil {
+		logger.FatalLog("Failed to count scale events", err)
+	}
+
+	if allScaleEvents > 0 {
+		return
+	}
+
+	logger.DebugLog("Assessing for unpatched nodes")
+	patchEvent, err := kpScaler.AssessPatching(ctx)
 	if err != nil {
-		return err
+		logger.ErrorLog("Failed to assess unpatched nodes", "error", err)
+		return
+	}
+
+	if patchEvent == nil || !workersSupport(kpConfig, patchEvent) {
+		return
+	}
+
+	if patchEvent.ScaleType == scaler.ScaleTypeReplace {
+		numPlaceable, err := kpScaler.NumPlaceableScaleEvents([]*scaler.ScaleEvent{patchEvent})
+		if err != nil {
+			logger.ErrorLog("Failed to assess proxmox capacity", "error", err)
+			return
+		}
+
+		if numPlaceable == 0 {
+			logger.DebugLog("Proxmox cluster is saturated, skipping patching", "node", patchEvent.ReplaceNodeName)
+			return
+		}
+
+		err = kpScaler.SelectTargetHosts([]*scaler.ScaleEvent{patchEvent})
+		if err != nil {
+			logger.ErrorLog("Failed to select target host", "error", err)
+			return
+		}
+	}
+
+	// Patch events are processed with scale up events, as are the replace
+	// events used when there is no patchCommand
+	err = queue.queueScaleEvent(ctx, patchEvent, scaleUpQueueName)
+	if err != nil {
+		logger.ErrorLog("Failed to queue patch event", "error", err)
+		return
+	}
+
+	if patchEvent.ScaleType == scaler.ScaleTypeReplace {
+		logger.InfoLog(fmt.Sprintf("Requested patching of %s by replacing it with %s", patchEvent.ReplaceNodeName, patchEvent.NodeName))
+		return
 	}
 
-	queueCtx, queueCancel := context.WithTimeout(ctx, 5*time.Second)
-	defer queueCancel()
-	return channel.PublishWithContext(
-		queueCtx,
-		"",
-		queueName,
-		false,
-		false,
-		amqp.Publishing{
-			DeliveryMode: amqp.Persistent,
-			ContentType:  "application/json",
-			Body:         []byte(msg),
-		})
+	logger.InfoLog(fmt.Sprintf("Requested patching of %s", patchEvent.NodeName))
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/grpcqueue"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/rabbitmq"
+)
+
+// Where the transport keeps scale events which reached the delivery limit
+type deadLetters interface {
+	// Lists the dead lettered scale events without removing them
+	list(ctx context.Context) (any, error)
+	// Moves the dead lettered scale events back onto their queues
+	requeue(ctx context.Context) (int, error)
+}
+
+type rabbitDeadLetters struct {
+	channel         rabbitmq.Channel
+	mgmtClient      *http.Client
+	rabbitConfig    config.RabbitConfig
+	deadLetterQueue string
+	// How long a requeued scale event counts as in flight, see rabbitQueue
+	inFlightExpiry time.Duration
+}
+
+func (d *rabbitDeadLetters) list(ctx context.Context) (any, error) {
+	return rabbitmq.GetDeadLetterEvents(d.mgmtClient, d.rabbitConfig, d.deadLetterQueue)
+}
+
+func (d *rabbitDeadLetters) requeue(ctx context.Context) (int, error) {
+	return rabbitmq.RequeueDeadLetterEvents(ctx, d.channel, d.deadLetterQueue, d.inFlightExpiry)
+}
+
+type grpcDeadLetters struct {
+	server *grpcqueue.Server
+}
+
+func (d *grpcDeadLetters) list(ctx context.Context) (any, error) {
+	return d.server.DeadLetterEvents(), nil
+}
+
+func (d *grpcDeadLetters) requeue(ctx context.Context) (int, error) {
+	return d.server.RequeueDeadLetterEvents(), nil
+}
+
+func registerDeadLetterHandlers(deadLetters deadLetters) {
+	http.HandleFunc("/deadletters", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		deadLetterEvents, err := deadLetters.list(r.Context())
+		if err != nil {
+			logger.ErrorLog("Failed to get dead letter events", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deadLetterEvents)
+	})
+
+	http.HandleFunc("/deadletters/requeue", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		numRequeued, err := deadLetters.requeue(r.Context())
+		if err != nil {
+			logger.ErrorLog("Failed to requeue dead letter events", "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoLog("Requeued dead letter events", "count", numRequeued)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"requeued": numRequeued})
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Suppresses repeated scale ups of a node class for the same unschedulable
+// resources within a window. Counts of in-progress scale events can lag
+// behind, so assessing frequently could otherwise provision twice for the
+// same pending pods.
+type scaleUpDebouncer struct {
+	window time.Duration
+	// The system clock unless set
+	clock scaler.Clock
+	// The unschedulable resources each node class was last scaled up for
+	lastScaleUps map[string]debouncedScaleUp
+}
+
+type debouncedScaleUp struct {
+	resources kubernetes.UnschedulableResources
+	at        time.Time
+}
+
+func (d *scaleUpDebouncer) now() time.Time {
+	if d.clock == nil {
+		return time.Now()
+	}
+
+	return d.clock.Now()
+}
+
+func (d *scaleUpDebouncer) suppress(nodeClass string, resources kubernetes.UnschedulableResources) bool {
+	last, ok := d.lastScaleUps[nodeClass]
+	return ok && resources.Equal(last.resources) && d.now().Sub(last.at) < d.window
+}
+
+// Removes the scale events of node classes already scaled up for the
+// resources within the window.
+func (d *scaleUpDebouncer) filter(resources kubernetes.UnschedulableResources, scaleEvents []*scaler.ScaleEvent) []*scaler.ScaleEvent {
+	if resources.IsZero() {
+		return scaleEvents
+	}
+
+	return slices.DeleteFunc(scaleEvents, func(scaleEvent *scaler.ScaleEvent) bool {
+		return d.suppress(scaleEvent.NodeClass, resources)
+	})
+}
+
+// Records the node classes of the scale events as scaled up for the resources.
+func (d *scaleUpDebouncer) record(resources kubernetes.UnschedulableResources, scaleEvents []*scaler.ScaleEvent) {
+	if d.lastScaleUps == nil {
+		d.lastScaleUps = map[string]debouncedScaleUp{}
+	}
+
+	for _, scaleEvent := range scaleEvents {
+		d.lastScaleUps[scaleEvent.NodeClass] = debouncedScaleUp{
+			resources: resources,
+			at:        d.now(),
+		}
+	}
+}
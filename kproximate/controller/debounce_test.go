@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// A clock only moved by the test.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	ch := make(chan time.Time, 1)
+	ch <- c.now.Add(d)
+	return ch
+}
+
+func scaleUpEvents(nodeClasses ...string) []*scaler.ScaleEvent {
+	scaleEvents := []*scaler.ScaleEvent{}
+	for _, nodeClass := range nodeClasses {
+		scaleEvents = append(scaleEvents, &scaler.ScaleEvent{
+			ScaleType: scaler.ScaleTypeUp,
+			NodeClass: nodeClass,
+		})
+	}
+
+	return scaleEvents
+}
+
+func TestScaleUpDebouncer(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)}
+	debouncer := &scaleUpDebouncer{
+		window: time.Minute,
+		clock:  clock,
+	}
+	resources := kubernetes.UnschedulableResources{Cpu: 2}
+
+	// A first event fires
+	filtered := debouncer.filter(resources, scaleUpEvents("default"))
+	if len(filtered) != 1 {
+		t.Fatalf("Expected the first scale up to fire, got %d scale events", len(filtered))
+	}
+	debouncer.record(resources, filtered)
+
+	// Repeats are suppressed inside the window
+	clock.now = clock.now.Add(30 * time.Second)
+	filtered = debouncer.filter(resources, scaleUpEvents("default"))
+	if len(filtered) != 0 {
+		t.Errorf("Expected the repeated scale up to be suppressed, got %d scale events", len(filtered))
+	}
+
+	// Separate node classes are tracked independently
+	filtered = debouncer.filter(resources, scaleUpEvents("default", "gpu"))
+	if len(filtered) != 1 || filtered[0].NodeClass != "gpu" {
+		t.Fatalf("Expected only the gpu scale up to fire, got %v", filtered)
+	}
+	debouncer.record(resources, filtered)
+
+	// An event fires after the window
+	clock.now = clock.now.Add(31 * time.Second)
+	filtered = debouncer.filter(resources, scaleUpEvents("default", "gpu"))
+	if len(filtered) != 1 || filtered[0].NodeClass != "default" {
+		t.Errorf("Expected only the default scale up to fire after its window, got %v", filtered)
+	}
+}
+
+func TestScaleUpDebouncerDifferentResources(t *testing.T) {
+	debouncer := &scaleUpDebouncer{
+		window: time.Minute,
+		clock:  &fakeClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	debouncer.record(kubernetes.UnschedulableResources{Cpu: 2}, scaleUpEvents("default"))
+
+	filtered := debouncer.filter(kubernetes.UnschedulableResources{Cpu: 4}, scaleUpEvents("default"))
+	if len(filtered) != 1 {
+		t.Errorf("Expected a scale up for different unschedulable resources to fire, got %d scale events", len(filtered))
+	}
+
+	filtered = debouncer.filter(kubernetes.UnschedulableResources{}, scaleUpEvents("default"))
+	if len(filtered) != 1 {
+		t.Errorf("Expected scale ups without unschedulable resources never to be suppressed, got %d scale events", len(filtered))
+	}
+}
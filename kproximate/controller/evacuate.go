@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// The progress of an evacuation, served from /status/evacuate.
+type evacuationStatus struct {
+	Active    bool      `json:"active"`
+	Cancelled bool      `json:"cancelled,omitempty"`
+	Started   time.Time `json:"started"`
+	Finished  time.Time `json:"finished"`
+	// The kpNode being drained and removed
+	Current string `json:"current,omitempty"`
+	// The kpNodes still to be evacuated, including any which joined since the
+	// evacuation started
+	Remaining []string `json:"remaining"`
+	Evacuated []string `json:"evacuated"`
+	// kpNodes whose scale down failed, which are left in place
+	Failed []string `json:"failed"`
+}
+
+// Drains and removes every kpNode, one at a time, on an operator's request.
+// Autoscaling is suspended until the evacuation finishes or is cancelled, so
+// that the evicted pods don't scale the cluster back up.
+type evacuation struct {
+	mu     sync.Mutex
+	status evacuationStatus
+}
+
+var (
+	errEvacuationRefused  = errors.New("evacuation refused")
+	errEvacuationInactive = errors.New("no evacuation is in progress")
+)
+
+func (e *evacuation) active() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.status.Active
+}
+
+func (e *evacuation) get() evacuationStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	status := e.status
+	status.Remaining = slices.Clone(status.Remaining)
+	status.Evacuated = slices.Clone(status.Evacuated)
+	status.Failed = slices.Clone(status.Failed)
+
+	return status
+}
+
+// Starts evacuating the kpNodes. The operator confirms the evacuation with the
+// number of kpNodes they expect to be removed, so that an evacuation is never
+// started by a request which wasn't meant for this cluster or is out of date.
+func (e *evacuation) start(ctx context.Context, kpConfig config.KproximateConfig, kpScaler scaler.Scaler, queue scaleEventQueue, confirm int, requester string) error {
+	if kpConfig.ObserverMode {
+		return fmt.Errorf("%w, observer mode makes no changes", errEvacuationRefused)
+	}
+
+	if e.active() {
+		return fmt.Errorf("%w, an evacuation is already in progress", errEvacuationRefused)
+	}
+
+	statuses, err := kpScaler.KpNodeStatuses(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) == 0 {
+		return fmt.Errorf("%w, there are no kpNodes", errEvacuationRefused)
+	}
+
+	if confirm != len(statuses) {
+		return fmt.Errorf("%w, confirm the evacuation with the number of kpNodes, %d", errEvacuationRefused, len(statuses))
+	}
+
+	e.mu.Lock()
+	e.status = evacuationStatus{
+		Active:    true,
+		Started:   time.Now(),
+		Evacuated: []string{},
+		Failed:    []string{},
+	}
+	e.mu.Unlock()
+
+	logger.InfoLog(fmt.Sprintf("Evacuating %d kpNodes, autoscaling is suspended", len(statuses)), "requester", requester)
+	e.step(ctx, kpScaler, queue)
+
+	return nil
+}
+
+// Stops the evacuation, the kpNode being removed is still removed and
+// autoscaling resumes with the next poll.
+func (e *evacuation) cancel(requester string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.status.Active {
+		return errEvacuationInactive
+	}
+
+	e.status.Active = false
+	e.status.Cancelled = true
+	e.status.Finished = time.Now()
+	logger.InfoLog("Cancelled evacuation, resuming autoscaling", "requester", requester, "evacuated", len(e.status.Evacuated))
+
+	return nil
+}
+
+// Queues the scale down of the next kpNode once the previous has finished. A
+// kpNode which remains once its scale down has left the queue has failed to
+// be removed, and is skipped.
+func (e *evacuation) step(ctx context.Context, kpScaler scaler.Scaler, queue scaleEventQueue) {
+	queued, err := queue.countScalingEvents([]string{scaleDownQueueName})
+	if err != nil {
+		logger.ErrorLog("Failed to count scale down events", "error", err)
+		return
+	}
+
+	if queued > 0 {
+		return
+	}
+
+	statuses, err := kpScaler.KpNodeStatuses(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to get kpNodes", "error", err)
+		return
+	}
+
+	kpNodes := []string{}
+	for _, status := range statuses {
+		kpNodes = append(kpNodes, status.Name)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.status.Active {
+		return
+	}
+
+	if e.status.Current != "" {
+		if slices.Contains(kpNodes, e.status.Current) {
+			logger.WarnLog(fmt.Sprintf("Failed to evacuate %s, skipping it", e.status.Current))
+			e.status.Failed = append(e.status.Failed, e.status.Current)
+		} else {
+			e.status.Evacuated = append(e.status.Evacuated, e.status.Current)
+		}
+		e.status.Current = ""
+	}
+
+	e.status.Remaining = slices.DeleteFunc(kpNodes, func(kpNode string) bool {
+		return slices.Contains(e.status.Failed, kpNode)
+	})
+
+	if len(e.status.Remaining) == 0 {
+		e.status.Active = false
+		e.status.Finished = time.Now()
+		logger.InfoLog("Finished evacuating kpNodes, resuming autoscaling", "evacuated", len(e.status.Evacuated), "failed", len(e.status.Failed))
+		return
+	}
+
+	next := e.status.Remaining[0]
+	scaleEvent, err := kpScaler.ManualScaleDownEvent(ctx, next)
+	if err != nil {
+		logger.ErrorLog("Failed to generate scale down event", "error", err)
+		return
+	}
+
+	err = queue.queueScaleEvent(ctx, scaleEvent, scaleDownQueueName)
+	if err != nil {
+		logger.ErrorLog("Failed to queue scale down event", "error", err)
+		return
+	}
+
+	e.status.Current = next
+	e.status.Remaining = e.status.Remaining[1:]
+	logger.InfoLog(fmt.Sprintf("Requested evacuation scale down event: %s", next), "remaining", len(e.status.Remaining))
+}
+
+// Records that autoscaling is suspended as the explanation of both scaling
+// decisions.
+func (e *evacuation) explain(explainer *decisionExplainer) {
+	status := e.get()
+
+	suspended := assessment{
+		Assessed: time.Now(),
+		Decision: "Evacuating",
+	}
+	suspended.reason("Autoscaling is suspended while kpNodes are evacuated, %d evacuated and %d remaining", len(status.Evacuated), len(status.Remaining))
+	explainer.recordScaleUp(suspended)
+	explainer.recordScaleDown(suspended)
+}
+
+type evacuateRequest struct {
+	Confirm int `json:"confirm"`
+}
+
+// Serves the progress of an evacuation, starts one on a POST confirming the
+// number of kpNodes and cancels it on a DELETE.
+func registerEvacuationHandlers(kpConfig *config.KproximateConfig, kpScaler scaler.Scaler, queue scaleEventQueue, evacuating *evacuation, actions operatorActions) {
+	http.HandleFunc("/status/evacuate", func(w http.ResponseWriter, r *http.Request) {
+		var result <-chan operatorResult
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(evacuating.get())
+			return
+
+		case http.MethodPost:
+			var request evacuateRequest
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			result = actions.run(func(ctx context.Context) (string, error) {
+				return "", evacuating.start(ctx, *kpConfig, kpScaler, queue, request.Confirm, "api")
+			})
+
+		case http.MethodDelete:
+			result = actions.run(func(ctx context.Context) (string, error) {
+				return "", evacuating.cancel("api")
+			})
+
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var res operatorResult
+		select {
+		case res = <-result:
+		case <-r.Context().Done():
+			return
+		}
+
+		switch {
+		case errors.Is(res.err, errEvacuationRefused), errors.Is(res.err, errEvacuationInactive):
+			http.Error(w, res.err.Error(), http.StatusConflict)
+		case res.err != nil:
+			http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(evacuating.get())
+		}
+	})
+}
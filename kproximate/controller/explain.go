@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// The outcome of the most recent scale up or scale down assessment and the
+// reasons for it.
+type assessment struct {
+	Assessed time.Time `json:"assessed"`
+	Decision string    `json:"decision"`
+	Reasons  []string  `json:"reasons,omitempty"`
+	// Only set when the scaler was consulted during the assessment
+	ScaleUp   *scaler.ScaleUpExplanation   `json:"scaleUp,omitempty"`
+	ScaleDown *scaler.ScaleDownExplanation `json:"scaleDown,omitempty"`
+}
+
+func (a *assessment) reason(format string, args ...any) {
+	a.Reasons = append(a.Reasons, fmt.Sprintf(format, args...))
+}
+
+// Keeps the most recent assessments for the /explain endpoint.
+type decisionExplainer struct {
+	mu        sync.Mutex
+	scaleUp   assessment
+	scaleDown assessment
+}
+
+func (e *decisionExplainer) recordScaleUp(a assessment) {
+	logger.DebugLog("Assessed scale up", "decision", a.Decision)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scaleUp = a
+}
+
+func (e *decisionExplainer) recordScaleDown(a assessment) {
+	logger.DebugLog("Assessed scale down", "decision", a.Decision)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.scaleDown = a
+}
+
+func registerExplainHandlers(explainer *decisionExplainer) {
+	http.HandleFunc("/explain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		explainer.mu.Lock()
+		explanation := struct {
+			ScaleUp   assessment `json:"scaleUp"`
+			ScaleDown assessment `json:"scaleDown"`
+		}{
+			ScaleUp:   explainer.scaleUp,
+			ScaleDown: explainer.scaleDown,
+		}
+		explainer.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(explanation)
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// Generates configuration from a description of it. Returns the exit code for
+// the process.
+func runGenerate(args []string) int {
+	if len(args) == 0 || args[0] != "classes" {
+		fmt.Fprintln(os.Stderr, "Usage: kproximate-controller generate classes [file] [name] [namespace]")
+		return 1
+	}
+
+	return generateClasses(args[1:])
+}
+
+// Converts the node classes described by a Helm values file, a kproximate
+// ConfigMap or a plain map of settings, read from the file or stdin if it is
+// "-" or not given, into a ConfigMap holding the kpNodeClasses setting and a
+// NodePool for each node class given replicas. The ConfigMap is named name,
+// kproximate unless given, in the namespace, kproximate unless given.
+func generateClasses(args []string) int {
+	input := os.Stdin
+	if len(args) > 0 && args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %s: %s\n", args[0], err.Error())
+			return 1
+		}
+		defer file.Close()
+
+		input = file
+	}
+
+	name := "kproximate"
+	if len(args) > 1 {
+		name = args[1]
+	}
+
+	namespace := "kproximate"
+	if len(args) > 2 {
+		namespace = args[2]
+	}
+
+	values, err := io.ReadAll(input)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read node classes: %s\n", err.Error())
+		return 1
+	}
+
+	nodeClassSpecs, err := config.NodeClassesFromValues(values)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid node classes: %s\n", err.Error())
+		return 1
+	}
+
+	nodeClasses := []any{}
+	nodePools := []kubernetes.NodePool{}
+	for _, spec := range nodeClassSpecs {
+		nodeClass, err := withoutZeroValues(spec.NodeClass)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode node class %s: %s\n", spec.Name, err.Error())
+			return 1
+		}
+
+		nodeClasses = append(nodeClasses, nodeClass)
+
+		if spec.Replicas != nil {
+			nodePools = append(nodePools, kubernetes.NodePool{
+				Name:      spec.Name,
+				NodeClass: spec.Name,
+				Replicas:  *spec.Replicas,
+			})
+		}
+	}
+
+	kpNodeClasses, err := json.MarshalIndent(nodeClasses, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode node classes: %s\n", err.Error())
+		return 1
+	}
+
+	manifests, err := kubernetes.NodeClassManifests(name, namespace, string(kpNodeClasses), nodePools)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render node classes: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Print(string(manifests))
+	return 0
+}
+
+// Encodes the value as JSON and decodes it leaving out any fields which are
+// unset, so that only the settings a node class overrides are generated.
+func withoutZeroValues(value any) (any, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded any
+	err = json.Unmarshal(encoded, &decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return pruneZeroValues(decoded), nil
+}
+
+func pruneZeroValues(value any) any {
+	switch value := value.(type) {
+	case map[string]any:
+		for key, field := range value {
+			field = pruneZeroValues(field)
+			if field == nil {
+				delete(value, key)
+				continue
+			}
+
+			value[key] = field
+		}
+
+		if len(value) == 0 {
+			return nil
+		}
+	case []any:
+		if len(value) == 0 {
+			return nil
+		}
+	case string:
+		if value == "" {
+			return nil
+		}
+	case float64:
+		if value == 0 {
+			return nil
+		}
+	case bool:
+		if !value {
+			return nil
+		}
+	}
+
+	return value
+}
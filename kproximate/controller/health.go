@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/metrics"
+	"github.com/lupinelab/kproximate/scaler"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Pauses scaling while the Proxmox cluster is degraded, rather than queueing
+// scale events whose clones would hang until they time out.
+type proxmoxHealthGate struct {
+	kubeClient kubernetes.ControllerKubernetes
+	config     config.KproximateConfig
+	// Why the cluster was last found degraded, empty while healthy
+	degraded string
+}
+
+// Returns whether scaling may proceed, reporting any change in the health of
+// the Proxmox cluster.
+func (g *proxmoxHealthGate) healthy(ctx context.Context, kpScaler scaler.Scaler, explainer *decisionExplainer) bool {
+	degraded, err := kpScaler.AssessProxmoxHealth()
+	if err != nil {
+		degraded = fmt.Sprintf("Failed to get the Proxmox cluster status: %s", err)
+	}
+
+	metrics.SetProxmoxDegraded(degraded != "")
+
+	if degraded != g.degraded {
+		if degraded != "" {
+			logger.WarnLog("Proxmox cluster is degraded, pausing scaling", "reason", degraded)
+			g.recordEvent(ctx, apiv1.EventTypeWarning, "ProxmoxDegraded", fmt.Sprintf("Scaling paused: %s", degraded))
+		} else {
+			logger.InfoLog("Proxmox cluster has recovered, resuming scaling")
+			g.recordEvent(ctx, apiv1.EventTypeNormal, "ProxmoxRecovered", "Scaling resumed")
+		}
+	}
+	g.degraded = degraded
+
+	if degraded == "" {
+		return true
+	}
+
+	paused := assessment{
+		Assessed: time.Now(),
+		Decision: "Paused",
+	}
+	paused.reason("%s", degraded)
+	explainer.recordScaleUp(paused)
+	explainer.recordScaleDown(paused)
+
+	return false
+}
+
+func (g *proxmoxHealthGate) recordEvent(ctx context.Context, eventType string, reason string, message string) {
+	recordEvent(ctx, g.kubeClient, g.config, eventType, reason, message)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Serves the kpNodes along with their Proxmox VMs and drains and removes a
+// kpNode on request, e.g. for the kubectl plugin.
+func registerKpNodeHandlers(kpScaler scaler.Scaler, queue scaleEventQueue, actions operatorActions) {
+	http.HandleFunc("/status/kpnodes", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		statuses, err := kpScaler.KpNodeStatuses(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(statuses)
+	})
+
+	http.HandleFunc("/status/kpnodes/", func(w http.ResponseWriter, r *http.Request) {
+		kpNodeName, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/status/kpnodes/"), "/drain")
+		if !ok || kpNodeName == "" || strings.Contains(kpNodeName, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var scaleEvent *scaler.ScaleEvent
+		result := actions.run(func(ctx context.Context) (string, error) {
+			var err error
+			scaleEvent, err = manualScaleDown(ctx, kpScaler, queue, kpNodeName, "api")
+			return "", err
+		})
+
+		var res operatorResult
+		select {
+		case res = <-result:
+		case <-r.Context().Done():
+			return
+		}
+
+		switch {
+		case errors.Is(res.err, scaler.ErrUnknownKpNode):
+			http.Error(w, res.err.Error(), http.StatusNotFound)
+		case res.err != nil:
+			http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(scaleEvent)
+		}
+	})
+}
+
+// Queues a scale down event draining and removing the kpNode requested by an
+// operator.
+func manualScaleDown(
+	ctx context.Context,
+	kpScaler scaler.Scaler,
+	queue scaleEventQueue,
+	kpNodeName string,
+	requester string,
+) (*scaler.ScaleEvent, error) {
+	scaleEvent, err := kpScaler.ManualScaleDownEvent(ctx, kpNodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	err = queue.queueScaleEvent(ctx, scaleEvent, scaleDownQueueName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to queue scale down event: %w", err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Requested manual scale down event: %s", scaleEvent.NodeName), "requester", requester)
+
+	return scaleEvent, nil
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/metrics"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// How often queue depth and scale event ages are exported
+const queueMonitorInterval = time.Second * 15
+
+// Queue depths reported by RabbitMQ lag behind publishing, so scale events
+// are only forgotten once they have had time to show up in them
+const queueDepthLag = queueMonitorInterval
+
+// A scale event published by the controller which has not yet finished.
+type outstandingScaleEvent struct {
+	queueName string
+	nodeClass string
+	// Whether the scale event clones a warm kpNode, which is not a kpNode
+	// until a later scale event starts it
+	warm      bool
+	published time.Time
+	// Whether a worker has reported progress for the scale event
+	delivered bool
+	// Whether the scale event has been reported as stuck
+	reported bool
+}
+
+// Tracks the age of the scale events the controller has published until
+// workers report that they have finished, so that scale events lost by a
+// stuck or crashed worker can be alerted on.
+type queueMonitor struct {
+	mu          sync.Mutex
+	outstanding map[string]*outstandingScaleEvent
+	stuckAfter  time.Duration
+}
+
+func newQueueMonitor(stuckAfter time.Duration) *queueMonitor {
+	return &queueMonitor{
+		outstanding: map[string]*outstandingScaleEvent{},
+		stuckAfter:  stuckAfter,
+	}
+}
+
+func (m *queueMonitor) published(scaleEvent *scaler.ScaleEvent, queueName string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outstanding[scaleEvent.NodeName] = &outstandingScaleEvent{
+		queueName: queueName,
+		nodeClass: scaleEvent.NodeClass,
+		warm:      scaleEvent.Warm,
+		published: now,
+	}
+}
+
+func (m *queueMonitor) progressed(status scaler.ScaleEventStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event, ok := m.outstanding[status.NodeName]
+	if !ok {
+		return
+	}
+
+	if status.Finished() {
+		delete(m.outstanding, status.NodeName)
+		return
+	}
+
+	event.delivered = true
+}
+
+// The age of the oldest outstanding scale event of the queue and the scale
+// events which have been outstanding for longer than stuckAfter, along with
+// those which have not previously been returned as stuck.
+func (m *queueMonitor) ages(queueName string, now time.Time) (time.Duration, int, []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var oldest time.Duration
+	stuck := 0
+	newlyStuck := []string{}
+	for nodeName, event := range m.outstanding {
+		if event.queueName != queueName {
+			continue
+		}
+
+		age := now.Sub(event.published)
+		oldest = max(oldest, age)
+
+		if age < m.stuckAfter {
+			continue
+		}
+
+		stuck++
+		if !event.reported {
+			event.reported = true
+			newlyStuck = append(newlyStuck, nodeName)
+		}
+	}
+
+	return oldest, stuck, newlyStuck
+}
+
+// Stops tracking scale events which are no longer in any queue, e.g. those
+// which were dead lettered or lost without a final report.
+func (m *queueMonitor) forget(queueName string, now time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for nodeName, event := range m.outstanding {
+		if event.queueName == queueName && now.Sub(event.published) > queueDepthLag {
+			delete(m.outstanding, nodeName)
+		}
+	}
+}
+
+// The number of scale events of each node class published to the queue which
+// have not yet finished, leaving out those cloning warm kpNodes.
+func (m *queueMonitor) inFlightByClass(queueName string) map[string]int {
+	return m.countByClass(queueName, false)
+}
+
+// The number of scale events cloning warm kpNodes of each node class
+// published to the queue which have not yet finished.
+func (m *queueMonitor) warmInFlight(queueName string) map[string]int {
+	return m.countByClass(queueName, true)
+}
+
+func (m *queueMonitor) countByClass(queueName string, warm bool) map[string]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	inFlight := map[string]int{}
+	for _, event := range m.outstanding {
+		if event.queueName == queueName && event.warm == warm {
+			inFlight[event.nodeClass]++
+		}
+	}
+
+	return inFlight
+}
+
+// Records the publish time of scale events queued through it.
+type monitoredQueue struct {
+	scaleEventQueue
+	monitor *queueMonitor
+}
+
+func (q *monitoredQueue) queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error {
+	err := q.scaleEventQueue.queueScaleEvent(ctx, scaleEvent, queueName)
+	if err != nil {
+		return err
+	}
+
+	q.monitor.published(scaleEvent, queueName, time.Now())
+
+	return nil
+}
+
+// Exports the depth of the scale event queues and the age of their oldest
+// scale events until the context is cancelled.
+func monitorQueues(ctx context.Context, queue scaleEventQueue, monitor *queueMonitor) {
+	ticker := time.NewTicker(queueMonitorInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for _, queueName := range []string{scaleUpQueueName, scaleDownQueueName} {
+				pending, running, err := queue.queueDepth(queueName)
+				if err != nil {
+					logger.WarnLog("Failed to get queue depth", "queue", queueName, "error", err)
+					continue
+				}
+
+				metrics.SetQueueDepth(queueName, pending, running)
+
+				if pending+running == 0 {
+					monitor.forget(queueName, now)
+				}
+
+				oldest, stuck, newlyStuck := monitor.ages(queueName, now)
+				metrics.SetQueueOldestScaleEventAge(queueName, oldest)
+				metrics.SetStuckScaleEvents(queueName, stuck)
+
+				for _, nodeName := range newlyStuck {
+					logger.WarnLog(
+						fmt.Sprintf("Scale event for %s has not finished after %s, its worker may be stuck or have crashed", nodeName, monitor.stuckAfter),
+						"queue", queueName,
+					)
+				}
+			}
+		}
+	}
+}
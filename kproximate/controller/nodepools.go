@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Queues the scale events which bring each node pool to its replicas. Node
+// pools are only reconciled once earlier scale events have finished as
+// kpNodes are not counted until they have joined.
+func assessNodePools(
+	ctx context.Context,
+	kpScaler scaler.Scaler,
+	kpConfig config.KproximateConfig,
+	queue scaleEventQueue,
+) {
+	logger.DebugLog("Assessing node pools")
+	allScaleEvents, err := queue.countScalingEvents([]string{
+		scaleUpQueueName,
+		scaleDownQueueName,
+	})
+	if err != nil {
+		logger.ErrorLog("Failed to count scale events", "error", err)
+		return
+	}
+
+	if allScaleEvents > 0 {
+		logger.DebugLog("Cannot reconcile node pools, scale event in progress")
+		return
+	}
+
+	scaleEvents, err := kpScaler.NodePoolScaleEvents(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to assess node pools", "error", err)
+		return
+	}
+
+	numKpNodes, err := kpScaler.NumReadyNodes(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to get kproximate nodes", "error", err)
+		return
+	}
+
+	maxKpNodes, err := kpScaler.MaxKpNodes()
+	if err != nil {
+		logger.ErrorLog("Failed to assess proxmox capacity", "error", err)
+		return
+	}
+
+	scaleUpEvents := []*scaler.ScaleEvent{}
+	for _, scaleEvent := range scaleEvents {
+		if scaleEvent.ScaleType == scaler.ScaleTypeDown {
+			err = queue.queueScaleEvent(ctx, scaleEvent, scaleDownQueueName)
+			if err != nil {
+				logger.ErrorLog("Failed to queue scale down event", "error", err)
+				continue
+			}
+
+			logger.InfoLog(fmt.Sprintf("Requested scale down event for node pool: %s (%s)", scaleEvent.NodeName, scaleEvent.NodeClass))
+			continue
+		}
+
+		scaleUpEvents = append(scaleUpEvents, scaleEvent)
+	}
+
+	if len(scaleUpEvents) == 0 {
+		return
+	}
+
+	maxScaleEvents := max(maxKpNodes-numKpNodes, 0)
+	if len(scaleUpEvents) > maxScaleEvents {
+		logger.WarnLog("Node pools exceed maxKpNodes", "required", len(scaleUpEvents), "allowed", maxScaleEvents)
+		scaleUpEvents = scaleUpEvents[:maxScaleEvents]
+	}
+
+	numPlaceable, err := kpScaler.NumPlaceableScaleEvents(scaleUpEvents)
+	if err != nil {
+		logger.ErrorLog("Failed to assess proxmox capacity", "error", err)
+		return
+	}
+
+	if numPlaceable < len(scaleUpEvents) {
+		logger.WarnLog("Proxmox cluster is saturated, deferring node pool scale up", "required", len(scaleUpEvents), "placeable", numPlaceable)
+		scaleUpEvents = scaleUpEvents[:numPlaceable]
+	}
+
+	err = kpScaler.SelectTargetHosts(scaleUpEvents)
+	if err != nil {
+		logger.ErrorLog("Failed to select target host", "error", err)
+		return
+	}
+
+	for _, scaleEvent := range scaleUpEvents {
+		err = queue.queueScaleEvent(ctx, scaleEvent, scaleUpQueueName)
+		if err != nil {
+			logger.ErrorLog("Failed to queue scale up event", "error", err)
+			continue
+		}
+
+		logger.InfoLog(fmt.Sprintf("Requested scale up event for node pool: %s (%s)", scaleEvent.NodeName, scaleEvent.NodeClass))
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/metrics"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// The number of decisions kept for listing
+const observedDecisionLimit = 100
+
+// A scale event the controller would have queued had it not been observing.
+type observedDecision struct {
+	QueueName  string             `json:"queueName"`
+	ScaleEvent *scaler.ScaleEvent `json:"scaleEvent"`
+	Observed   time.Time          `json:"observed"`
+}
+
+// Takes the place of the scale event transport in observer mode, recording
+// the scale events that would have been queued without ever publishing them.
+type observerQueue struct {
+	mu        sync.Mutex
+	decisions []observedDecision
+}
+
+// Returns an observerQueue in observer mode, otherwise connects to the
+// transport. Observers never connect to it, so cannot publish scale events.
+func observeOr(kpConfig config.KproximateConfig, connect func() scaleEventQueue) scaleEventQueue {
+	if !kpConfig.ObserverMode {
+		return connect()
+	}
+
+	logger.InfoLog("Running in observer mode, scale events will not be published")
+	return &observerQueue{}
+}
+
+func scaleTypeName(scaleType int) string {
+	switch scaleType {
+	case scaler.ScaleTypeUp:
+		return "up"
+	case scaler.ScaleTypeDown:
+		return "down"
+	case scaler.ScaleTypeReplace:
+		return "replace"
+	case scaler.ScaleTypeMigrate:
+		return "migrate"
+	case scaler.ScaleTypePatch:
+		return "patch"
+	default:
+		return fmt.Sprintf("%d", scaleType)
+	}
+}
+
+func (q *observerQueue) queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.decisions = append(q.decisions, observedDecision{
+		QueueName:  queueName,
+		ScaleEvent: scaleEvent,
+		Observed:   time.Now().UTC(),
+	})
+	if len(q.decisions) > observedDecisionLimit {
+		q.decisions = q.decisions[len(q.decisions)-observedDecisionLimit:]
+	}
+
+	metrics.IncObservedScaleEvents(scaleTypeName(scaleEvent.ScaleType))
+	logger.InfoLog("Observed scale event, not publishing", "type", scaleTypeName(scaleEvent.ScaleType), "node", scaleEvent.NodeName, "nodeClass", scaleEvent.NodeClass, "targetHost", scaleEvent.TargetHost.Node)
+
+	return nil
+}
+
+// Nothing is ever queued so no scale events are in progress.
+func (q *observerQueue) countScalingEvents(queueNames []string) (int, error) {
+	return 0, nil
+}
+
+func (q *observerQueue) queueDepth(queueName string) (int, int, error) {
+	return 0, 0, nil
+}
+
+// No workers process observed scale events so there is no progress to report.
+func (q *observerQueue) progressReports() <-chan []byte {
+	return nil
+}
+
+// The observed decisions, most recent first.
+func (q *observerQueue) list() []observedDecision {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	decisions := slices.Clone(q.decisions)
+	slices.Reverse(decisions)
+
+	return decisions
+}
+
+func registerObserverHandlers(queue *observerQueue) {
+	http.HandleFunc("/status/decisions", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(queue.list())
+	})
+}
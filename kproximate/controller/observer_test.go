@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Requires a scale up for each of its node classes and the scale down of
+// each of its kpNodes. Calling any other method of the scaler panics.
+type fakeScaler struct {
+	scaler.Scaler
+	nodeClasses []string
+	kpNodes     []string
+}
+
+func (s *fakeScaler) NumReadyNodes(ctx context.Context) (int, error) {
+	return len(s.kpNodes), nil
+}
+
+func (s *fakeScaler) MaxKpNodes() (int, error) {
+	return 10, nil
+}
+
+func (s *fakeScaler) GetUnschedulableResources(ctx context.Context) (kubernetes.UnschedulableResources, error) {
+	return kubernetes.UnschedulableResources{Cpu: 2}, nil
+}
+
+func (s *fakeScaler) RequiredScaleEvents(ctx context.Context, numCurrentEvents int, currentEventsByClass map[string]int) ([]*scaler.ScaleEvent, error) {
+	return scaleUpEvents(s.nodeClasses...), nil
+}
+
+func (s *fakeScaler) NumPlaceableScaleEvents(scaleEvents []*scaler.ScaleEvent) (int, error) {
+	return len(scaleEvents), nil
+}
+
+func (s *fakeScaler) SelectTargetHosts(scaleEvents []*scaler.ScaleEvent) error {
+	return nil
+}
+
+func (s *fakeScaler) AssessScaleDown(ctx context.Context) ([]*scaler.ScaleEvent, error) {
+	return scaleDownEvents(s.kpNodes...), nil
+}
+
+func (s *fakeScaler) Explain() scaler.Explanation {
+	return scaler.Explanation{}
+}
+
+func TestObserverModeNeverPublishes(t *testing.T) {
+	kpConfig := config.KproximateConfig{
+		ObserverMode: true,
+		// Queue scale ups without pausing between them
+		BurstThreshold: 1,
+	}
+	kpScaler := &fakeScaler{
+		nodeClasses: []string{"default", "gpu"},
+		kpNodes:     []string{"kp-node-a"},
+	}
+
+	transport := &fakeScaleEventQueue{}
+	connected := false
+	queue := observeOr(kpConfig, func() scaleEventQueue {
+		connected = true
+		return transport
+	})
+
+	assessScaleUp(context.Background(), kpScaler, kpConfig, queue, newQueueMonitor(time.Minute), &scaleUpDebouncer{}, &decisionExplainer{})
+	assessScaleDown(context.Background(), kpScaler, kpConfig, queue, &decisionExplainer{}, newScaleDownApprovals())
+
+	if connected || len(transport.queued) != 0 {
+		t.Errorf("Expected no scale events to be published in observer mode, got %v", transport.queued)
+	}
+
+	observed := queue.(*observerQueue).list()
+	if len(observed) != 3 {
+		t.Errorf("Expected the 3 scale events to be observed, got %+v", observed)
+	}
+}
+
+func TestObserveOrConnectsWhenNotObserving(t *testing.T) {
+	transport := &fakeScaleEventQueue{}
+	queue := observeOr(config.KproximateConfig{}, func() scaleEventQueue {
+		return transport
+	})
+
+	if queue != transport {
+		t.Errorf("Expected scale events to be published to the transport, got %T", queue)
+	}
+}
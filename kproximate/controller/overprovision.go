@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Keeps the placeholder pods reserving spare capacity at their configured
+// number, removing them once overprovisioning is disabled.
+func maintainOverprovisioning(ctx context.Context, kubeClient kubernetes.ControllerKubernetes, kpConfig config.KproximateConfig) {
+	err := kubeClient.EnsureOverprovisioning(ctx, kubernetes.Overprovisioning{
+		Namespace: kpConfig.PodNamespace,
+		Replicas:  kpConfig.OverprovisionReplicas,
+		Cpu:       resource.MustParse(kpConfig.OverprovisionCpu),
+		Memory:    resource.MustParse(kpConfig.OverprovisionMemory),
+		Priority:  int32(kpConfig.OverprovisionPriority),
+	})
+	if err != nil {
+		logger.ErrorLog("Failed to maintain overprovisioning", "error", err)
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/grpcqueue"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/rabbitmq"
+	"github.com/lupinelab/kproximate/scaler"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	scaleUpQueueName   = "scaleUpEvents"
+	scaleDownQueueName = "scaleDownEvents"
+)
+
+// The transport used to pass scale events from the controller to workers,
+// queue names are scoped to the kproximate instance by the implementation
+type scaleEventQueue interface {
+	queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error
+	countScalingEvents(queueNames []string) (int, error)
+	// The number of scale events waiting to be consumed from the queue and
+	// the number being processed by workers
+	queueDepth(queueName string) (int, int, error)
+	// Progress reports for scale events published by workers
+	progressReports() <-chan []byte
+}
+
+type rabbitQueue struct {
+	channel      rabbitmq.Channel
+	mgmtClient   *http.Client
+	rabbitConfig config.RabbitConfig
+	queueName    func(string) string
+	reports      <-chan []byte
+	// How long a scale event counts as in flight without a worker settling it
+	inFlightExpiry time.Duration
+}
+
+func (q *rabbitQueue) progressReports() <-chan []byte {
+	return q.reports
+}
+
+// Consumes progress reports from the status queue until the context is
+// cancelled. Reports are acknowledged on receipt as they are informational.
+func consumeStatusQueue(ctx context.Context, channel *amqp.Channel, queueName string) <-chan []byte {
+	reports := make(chan []byte)
+
+	msgs, err := channel.Consume(
+		queueName,
+		"",
+		true,
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		logger.ErrorLog("Failed to register scale event status consumer", "error", err)
+		return reports
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+
+				select {
+				case reports <- msg.Body:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return reports
+}
+
+// Scale events count from when they are published until a worker settles
+// them, rather than only once they show up in the queue depth, so that
+// repeated assessments can't exceed maxKpNodes while it catches up.
+func (q *rabbitQueue) countScalingEvents(queueNames []string) (int, error) {
+	numScalingEvents := 0
+
+	for _, queueName := range queueNames {
+		pendingScaleEvents, runningScaleEvents, err := q.queueDepth(queueName)
+		if err != nil {
+			return numScalingEvents, err
+		}
+
+		inFlightScaleEvents, err := rabbitmq.GetInFlightScaleEvents(q.channel, q.queueName(queueName))
+		if err != nil {
+			return numScalingEvents, err
+		}
+
+		numScalingEvents += max(pendingScaleEvents+runningScaleEvents, inFlightScaleEvents)
+	}
+
+	return numScalingEvents, nil
+}
+
+func (q *rabbitQueue) queueDepth(queueName string) (int, int, error) {
+	queueName = q.queueName(queueName)
+
+	pendingScaleEvents, err := rabbitmq.GetPendingScaleEvents(q.channel, queueName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	runningScaleEvents, err := rabbitmq.GetRunningScaleEvents(q.mgmtClient, q.rabbitConfig, queueName)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return pendingScaleEvents, runningScaleEvents, nil
+}
+
+func (q *rabbitQueue) queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error {
+	msg, err := scaler.EncodeScaleEvent(scaleEvent)
+	if err != nil {
+		return err
+	}
+
+	queueName = q.queueName(queueName)
+
+	// Marked before publishing so the scale event is never uncounted
+	err = rabbitmq.MarkInFlight(ctx, q.channel, queueName, q.inFlightExpiry)
+	if err != nil {
+		return err
+	}
+
+	queueCtx, queueCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer queueCancel()
+	err = q.channel.PublishWithContext(
+		queueCtx,
+		"",
+		queueName,
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Priority:     uint8(scaleEvent.Priority),
+			Body:         []byte(msg),
+		})
+	if err != nil {
+		settleErr := rabbitmq.SettleInFlight(q.channel, queueName)
+		if settleErr != nil {
+			logger.WarnLog("Failed to settle unpublished scale event", "error", settleErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+type grpcQueue struct {
+	server    *grpcqueue.Server
+	queueName func(string) string
+}
+
+func (q *grpcQueue) progressReports() <-chan []byte {
+	return q.server.Reports()
+}
+
+// The server counts a scale event as pending as soon as it is published, so
+// it can be counted straight from the queue depth.
+func (q *grpcQueue) countScalingEvents(queueNames []string) (int, error) {
+	numScalingEvents := 0
+
+	for _, queueName := range queueNames {
+		pendingScaleEvents, runningScaleEvents, _ := q.queueDepth(queueName)
+		numScalingEvents += pendingScaleEvents + runningScaleEvents
+	}
+
+	return numScalingEvents, nil
+}
+
+func (q *grpcQueue) queueDepth(queueName string) (int, int, error) {
+	pendingScaleEvents, runningScaleEvents := q.server.Count(q.queueName(queueName))
+	return pendingScaleEvents, runningScaleEvents, nil
+}
+
+func (q *grpcQueue) queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error {
+	msg, err := scaler.EncodeScaleEvent(scaleEvent)
+	if err != nil {
+		return err
+	}
+
+	q.server.PublishWithPriority(q.queueName(queueName), scaleEvent.NodeClass, scaleEvent.Priority, msg)
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/rabbitmq"
+	"github.com/lupinelab/kproximate/scaler"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Answers requests to the RabbitMQ management API with the number of
+// unacknowledged scale events of each queue.
+type managementAPIStub map[string]int
+
+func (s managementAPIStub) RoundTrip(req *http.Request) (*http.Response, error) {
+	body := fmt.Sprintf(`{"messages_unacknowledged": %d}`, s[path.Base(req.URL.Path)])
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+// Records the scale events queued by the controller.
+type fakeScaleEventQueue struct {
+	queued map[string][]*scaler.ScaleEvent
+	// Returned by countScalingEvents
+	scaling int
+}
+
+func (q *fakeScaleEventQueue) queueScaleEvent(ctx context.Context, scaleEvent *scaler.ScaleEvent, queueName string) error {
+	if q.queued == nil {
+		q.queued = map[string][]*scaler.ScaleEvent{}
+	}
+
+	q.queued[queueName] = append(q.queued[queueName], scaleEvent)
+	return nil
+}
+
+func (q *fakeScaleEventQueue) countScalingEvents(queueNames []string) (int, error) {
+	return q.scaling, nil
+}
+
+func (q *fakeScaleEventQueue) queueDepth(queueName string) (int, int, error) {
+	return 0, 0, nil
+}
+
+func (q *fakeScaleEventQueue) progressReports() <-chan []byte {
+	return nil
+}
+
+func newTestRabbitQueue(ch *rabbitmq.ChannelMock, running managementAPIStub) *rabbitQueue {
+	rabbitmq.DeclareQueue(ch, scaleUpQueueName, rabbitmq.DeadLetterQueue)
+
+	return &rabbitQueue{
+		channel:        ch,
+		mgmtClient:     &http.Client{Transport: running},
+		queueName:      func(name string) string { return name },
+		inFlightExpiry: time.Minute,
+	}
+}
+
+func TestRabbitQueueCountScalingEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		pending  int
+		running  int
+		inFlight int
+		expected int
+	}{
+		{
+			name:     "published events not yet in the queue depth",
+			pending:  0,
+			running:  0,
+			inFlight: 2,
+			expected: 2,
+		},
+		{
+			name:     "queue depth including events whose markers expired",
+			pending:  2,
+			running:  1,
+			inFlight: 1,
+			expected: 3,
+		},
+		{
+			name:     "every event both queued and in flight",
+			pending:  1,
+			running:  1,
+			inFlight: 2,
+			expected: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := rabbitmq.NewChannelMock()
+			queue := newTestRabbitQueue(ch, managementAPIStub{scaleUpQueueName: tt.running})
+
+			for i := 0; i < tt.pending; i++ {
+				ch.PublishWithContext(context.Background(), "", scaleUpQueueName, false, false, amqp.Publishing{})
+			}
+
+			for i := 0; i < tt.inFlight; i++ {
+				rabbitmq.MarkInFlight(context.Background(), ch, scaleUpQueueName, time.Minute)
+			}
+
+			numScalingEvents, err := queue.countScalingEvents([]string{scaleUpQueueName})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if numScalingEvents != tt.expected {
+				t.Errorf("Expected %d scaling events, got %d", tt.expected, numScalingEvents)
+			}
+		})
+	}
+}
+
+func TestRabbitQueueSettlesUnpublishedScaleEvent(t *testing.T) {
+	ch := rabbitmq.NewChannelMock()
+	queue := newTestRabbitQueue(ch, managementAPIStub{})
+	ch.PublishErrs = map[string]error{scaleUpQueueName: errors.New("channel closed")}
+
+	err := queue.queueScaleEvent(context.Background(), &scaler.ScaleEvent{ScaleType: scaler.ScaleTypeUp, NodeName: "kp-node-1"}, scaleUpQueueName)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	numScalingEvents, err := queue.countScalingEvents([]string{scaleUpQueueName})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if numScalingEvents != 0 {
+		t.Errorf("Expected the unpublished scale event to be settled, got %d scaling events", numScalingEvents)
+	}
+}
+
+func TestRabbitQueueInFlightExpiry(t *testing.T) {
+	now := time.Now()
+	ch := rabbitmq.NewChannelMock()
+	ch.Now = func() time.Time { return now }
+	queue := newTestRabbitQueue(ch, managementAPIStub{})
+
+	err := queue.queueScaleEvent(context.Background(), &scaler.ScaleEvent{ScaleType: scaler.ScaleTypeUp, NodeName: "kp-node-1"}, scaleUpQueueName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A worker which crashes after acknowledging the scale event never
+	// settles it
+	msg, _, _ := ch.Get(scaleUpQueueName, false)
+	msg.Ack(false)
+
+	now = now.Add(queue.inFlightExpiry - time.Second)
+	numScalingEvents, _ := queue.countScalingEvents([]string{scaleUpQueueName})
+	if numScalingEvents != 1 {
+		t.Errorf("Expected the scale event to count until inFlightExpiry, got %d scaling events", numScalingEvents)
+	}
+
+	now = now.Add(time.Second)
+	numScalingEvents, _ = queue.countScalingEvents([]string{scaleUpQueueName})
+	if numScalingEvents != 0 {
+		t.Errorf("Expected the marker to expire after inFlightExpiry, got %d scaling events", numScalingEvents)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// Prints the ClusterRoles and ClusterRoleBindings kproximate requires, for
+// installations not using the chart. The controller runs as the service
+// account name, kproximate unless given, and workers as name-worker, both in
+// the namespace, kproximate unless given. Workers are only granted reading
+// the join secret when it is given as namespace/name, and the controller
+// maintaining placeholder pods with -overprovisioning. Returns the exit code
+// for the process.
+func runRBAC(args []string) int {
+	flags := flag.NewFlagSet("rbac", flag.ContinueOnError)
+	overprovisioning := flags.Bool("overprovisioning", false, "grant maintaining placeholder pods, see overprovisionReplicas")
+	err := flags.Parse(args)
+	if err != nil {
+		return 2
+	}
+	args = flags.Args()
+
+	name := "kproximate"
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	namespace := "kproximate"
+	if len(args) > 1 {
+		namespace = args[1]
+	}
+
+	kpJoinSecret := ""
+	if len(args) > 2 {
+		kpJoinSecret = args[2]
+	}
+
+	manifests, err := kubernetes.RBACManifests(name, namespace, kpJoinSecret, *overprovisioning)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to render RBAC manifests: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Print(string(manifests))
+	return 0
+}
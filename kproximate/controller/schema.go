@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+func registerSchemaHandlers() {
+	http.HandleFunc("/schema/scaleevent.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(scaler.ScaleEventSchema)
+	})
+
+	http.HandleFunc("/schema/kpnodeparams.json", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/schema+json")
+		w.Write(config.KpNodeParamsSchema)
+	})
+}
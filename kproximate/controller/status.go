@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/metrics"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// How long the status of a finished scale event is kept
+const scaleEventStatusRetention = time.Hour
+
+// The latest progress reported by workers for each recent scale event
+type scaleEventTracker struct {
+	mu        sync.Mutex
+	events    map[string]scaler.ScaleEventStatus
+	retention time.Duration
+}
+
+func newScaleEventTracker(retention time.Duration) *scaleEventTracker {
+	return &scaleEventTracker{
+		events:    map[string]scaler.ScaleEventStatus{},
+		retention: retention,
+	}
+}
+
+func (t *scaleEventTracker) record(status scaler.ScaleEventStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Reports from concurrent workers may arrive out of order
+	if current, ok := t.events[status.NodeName]; ok && current.Updated.After(status.Updated) {
+		return
+	}
+
+	t.events[status.NodeName] = status
+}
+
+// Forgets finished scale events older than the retention period, along with
+// unfinished events whose worker has not reported for as long.
+func (t *scaleEventTracker) prune(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for nodeName, status := range t.events {
+		if now.Sub(status.Updated) > t.retention {
+			delete(t.events, nodeName)
+		}
+	}
+}
+
+// The tracked scale events, most recently updated first.
+func (t *scaleEventTracker) list() []scaler.ScaleEventStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	events := make([]scaler.ScaleEventStatus, 0, len(t.events))
+	for _, status := range t.events {
+		events = append(events, status)
+	}
+
+	slices.SortFunc(events, func(a, b scaler.ScaleEventStatus) int {
+		return b.Updated.Compare(a.Updated)
+	})
+
+	return events
+}
+
+func (t *scaleEventTracker) stateCounts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, status := range t.events {
+		counts[status.State]++
+	}
+
+	return counts
+}
+
+// Records progress reports from workers until the context is cancelled.
+func trackProgress(ctx context.Context, reports <-chan []byte, tracker *scaleEventTracker, monitor *queueMonitor) {
+	pruneTicker := time.NewTicker(time.Minute)
+	defer pruneTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-pruneTicker.C:
+			tracker.prune(now)
+		case report := <-reports:
+			status, err := scaler.DecodeScaleEventStatus(report)
+			if err != nil {
+				logger.WarnLog("Received invalid scale event status", "error", err, "status", string(report))
+				continue
+			}
+
+			logger.DebugLog("Scale event progress", "node", status.NodeName, "state", status.State, "reason", status.Reason, "category", status.Category)
+			tracker.record(status)
+			monitor.progressed(status)
+
+			if status.State == scaler.ScaleEventFailed {
+				metrics.IncScaleEventFailures(status.Category)
+			}
+
+			if status.VmIDCollision != 0 {
+				metrics.IncVmIDCollisions()
+			}
+		}
+
+		metrics.SetScaleEventStates(tracker.stateCounts())
+	}
+}
+
+func registerStatusHandlers(tracker *scaleEventTracker) {
+	http.HandleFunc("/status/scaleevents", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tracker.list())
+	})
+}
+
+// Serves the estimated cost of the kpNodes, see scaler.CostEstimate.
+func registerCostHandlers(kpScaler scaler.Scaler) {
+	http.HandleFunc("/status/cost", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		estimate, err := kpScaler.EstimateCost(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(estimate)
+	})
+}
+
+// The body of a scale up requested through the API, the first node class is
+// used if none is named.
+type scaleUpRequest struct {
+	NodeClass string `json:"nodeClass"`
+}
+
+// Queues a scale up requested through the API, within maxKpNodes and the
+// capacity of the Proxmox cluster, and responds with its scale event.
+func registerScaleUpHandlers(kpConfig *config.KproximateConfig, kpScaler scaler.Scaler, queue scaleEventQueue, actions operatorActions) {
+	http.HandleFunc("/status/scaleup", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var request scaleUpRequest
+		if r.ContentLength != 0 {
+			err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16)).Decode(&request)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		var scaleEvent *scaler.ScaleEvent
+		result := actions.run(func(ctx context.Context) (string, error) {
+			var err error
+			scaleEvent, err = manualScaleUp(ctx, *kpConfig, kpScaler, queue, request.NodeClass, "api")
+			return "", err
+		})
+
+		var res operatorResult
+		select {
+		case res = <-result:
+		case <-r.Context().Done():
+			return
+		}
+
+		switch {
+		case errors.Is(res.err, errScaleUpRefused):
+			http.Error(w, res.err.Error(), http.StatusConflict)
+		case res.err != nil:
+			http.Error(w, res.err.Error(), http.StatusInternalServerError)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(scaleEvent)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lupinelab/kproximate/config"
+)
+
+// Checks the config in the directory, e.g. the rendered ConfigMap of a
+// deployment, or the environment when no directory is given, so that
+// mistakes such as misspelt settings or invalid kpNodeParams are caught
+// before deploying. Returns the exit code for the process.
+func runValidate(args []string) int {
+	if len(args) == 0 {
+		_, err := config.GetKpConfig()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid config: %s\n", err.Error())
+			return 1
+		}
+
+		fmt.Println("Config is valid")
+		return 0
+	}
+
+	dir := args[0]
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s: %s\n", dir, err.Error())
+		return 1
+	}
+
+	settings := []string{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		settings = append(settings, file.Name())
+	}
+
+	exitCode := 0
+	for _, setting := range config.UnknownSettings(settings) {
+		fmt.Fprintf(os.Stderr, "Unknown setting: %s\n", setting)
+		exitCode = 1
+	}
+
+	_, err = config.GetKpConfigFromDir(dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config: %s\n", err.Error())
+		return 1
+	}
+
+	if exitCode == 0 {
+		fmt.Println("Config is valid")
+	}
+
+	return exitCode
+}
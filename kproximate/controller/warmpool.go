@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Keeps the warm pools of each node class at their configured size by
+// queueing scale events which workers clone warm kpNodes for, like any other
+// kpNode. Warm kpNodes still being cloned count towards their warm pool.
+func replenishWarmPool(ctx context.Context, kpScaler scaler.Scaler, queue scaleEventQueue, monitor *queueMonitor) {
+	warmEvents, err := kpScaler.WarmPoolScaleEvents(ctx, monitor.warmInFlight(scaleUpQueueName))
+	if err != nil {
+		logger.ErrorLog("Failed to assess warm pools", "error", err)
+		return
+	}
+
+	for _, warmEvent := range warmEvents {
+		err = queue.queueScaleEvent(ctx, warmEvent, scaleUpQueueName)
+		if err != nil {
+			logger.ErrorLog("Failed to queue warm kpNode", "error", err)
+			continue
+		}
+
+		logger.InfoLog(fmt.Sprintf("Requested warm kpNode %s (%s) on %s", warmEvent.NodeName, warmEvent.NodeClass, warmEvent.TargetHost.Node))
+	}
+}
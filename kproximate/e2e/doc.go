@@ -0,0 +1,11 @@
+// Package e2e holds the end-to-end tests, which run the controller and worker
+// against a kind cluster and the fake Proxmox API server and assert on whole
+// scaling lifecycles. They need kind, and docker or podman, and are built with
+// the e2e tag:
+//
+//	go test -tags e2e -v -timeout 30m ./e2e/
+//
+// Set KPROXIMATE_E2E_KUBECONFIG to run them against an existing cluster rather
+// than creating one, and KPROXIMATE_E2E_KEEP to keep the kind cluster and the
+// controller and worker logs afterwards.
+package e2e
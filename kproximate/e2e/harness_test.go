@@ -0,0 +1,614 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox/proxmoxtest"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+const (
+	kindClusterName  = "kproximate-e2e"
+	kpNodeNamePrefix = "kp-node"
+	templateName     = "kproximate-template"
+	testNamespace    = "kproximate-e2e"
+	// The memory of each kpNode in MiB
+	kpNodeMemory = 4096
+)
+
+// A control plane and a worker, as kpNodes are only scaled down while the
+// remaining worker nodes have enough headroom
+const kindConfig = `kind: Cluster
+apiVersion: kind.x-k8s.io/v1alpha4
+nodes:
+  - role: control-plane
+  - role: worker
+`
+
+// Set up by TestMain and shared by the tests
+var h = &harness{}
+
+type harness struct {
+	workDir        string
+	kubeconfig     string
+	createdCluster bool
+	kube           clientset.Interface
+	proxmox        *proxmoxtest.Server
+	stopKubelet    context.CancelFunc
+	processes      []*process
+	// Each test pod requests more cpu than any node of the cluster can
+	// allocate, so that it only fits on a kpNode of its own
+	podCpu      int64
+	kpNodeCores int64
+}
+
+func TestMain(m *testing.M) {
+	code := 1
+	err := h.setup(context.Background())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to set up the e2e harness: %s\n", err)
+	} else {
+		code = m.Run()
+	}
+
+	h.teardown(context.Background(), code != 0)
+	os.Exit(code)
+}
+
+func (h *harness) setup(ctx context.Context) error {
+	var err error
+	h.workDir, err = os.MkdirTemp("", "kproximate-e2e-")
+	if err != nil {
+		return err
+	}
+
+	h.kubeconfig = os.Getenv("KPROXIMATE_E2E_KUBECONFIG")
+	if h.kubeconfig == "" {
+		h.kubeconfig = filepath.Join(h.workDir, "kubeconfig")
+		err = h.createKindCluster()
+		if err != nil {
+			return err
+		}
+	}
+
+	restConfig, err := kubernetes.RestConfig(kubernetes.ClientOptions{Kubeconfig: h.kubeconfig})
+	if err != nil {
+		return err
+	}
+
+	h.kube, err = clientset.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+
+	err = h.sizeKpNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = h.kube.CoreV1().Namespaces().Create(ctx, &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{Name: testNamespace},
+	}, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+
+	h.proxmox = newFakeProxmox(h.kpNodeCores)
+
+	kubeletCtx, stopKubelet := context.WithCancel(context.Background())
+	h.stopKubelet = stopKubelet
+	go newFakeKubelet(h.kube, h.proxmox).run(kubeletCtx)
+
+	return h.startKproximate()
+}
+
+func (h *harness) createKindCluster() error {
+	configFile := filepath.Join(h.workDir, "kind.yaml")
+	err := os.WriteFile(configFile, []byte(kindConfig), 0600)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command("kind", "create", "cluster",
+		"--name", kindClusterName,
+		"--config", configFile,
+		"--kubeconfig", h.kubeconfig,
+		"--wait", "3m",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to create kind cluster: %w: %s", err, output)
+	}
+
+	h.createdCluster = true
+	return nil
+}
+
+// Sizes kpNodes and the test pods, the scheduler only reports insufficient
+// cpu, which kproximate scales up for, when a pod fits no node.
+func (h *harness) sizeKpNodes(ctx context.Context) error {
+	nodes, err := h.kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	var maxCpu int64
+	for _, node := range nodes.Items {
+		maxCpu = max(maxCpu, node.Status.Allocatable.Cpu().MilliValue())
+	}
+
+	h.podCpu = maxCpu/1000 + 1
+	// Room for the cluster's DaemonSets alongside a test pod, but not for a
+	// second test pod
+	h.kpNodeCores = h.podCpu + 1
+
+	return nil
+}
+
+func newFakeProxmox(kpNodeCores int64) *proxmoxtest.Server {
+	hosts := []proxmoxtest.Host{}
+	for _, name := range []string{"pve-01", "pve-02"} {
+		hosts = append(hosts, proxmoxtest.Host{
+			Name:   name,
+			Cpu:    0.05,
+			Maxcpu: int(kpNodeCores) * 4,
+			Mem:    4 << 30,
+			Maxmem: 128 << 30,
+			Status: "online",
+		})
+	}
+
+	return proxmoxtest.NewServer(hosts, []proxmoxtest.VM{
+		{
+			VmID:     9000,
+			Name:     templateName,
+			Node:     "pve-01",
+			Status:   "stopped",
+			Template: true,
+			Config: map[string]string{
+				"scsi0": "local-lvm:base-9000-disk-0,size=20G",
+				"net0":  "virtio=BC:24:11:00:00:01,bridge=vmbr0",
+			},
+		},
+	})
+}
+
+// Builds the controller and worker from this checkout and runs them, with
+// the gRPC transport so that no RabbitMQ is needed.
+func (h *harness) startKproximate() error {
+	controller, err := build(h.workDir, "controller")
+	if err != nil {
+		return err
+	}
+
+	worker, err := build(h.workDir, "worker")
+	if err != nil {
+		return err
+	}
+
+	grpcAddress, err := freeAddress()
+	if err != nil {
+		return err
+	}
+
+	tlsFiles, err := writeTLSFiles(h.workDir)
+	if err != nil {
+		return err
+	}
+
+	env := h.env(grpcAddress, tlsFiles)
+
+	process, err := start(h.workDir, "controller", controller, env)
+	if err != nil {
+		return err
+	}
+	h.processes = append(h.processes, process)
+
+	err = waitForListener(grpcAddress, process, time.Minute)
+	if err != nil {
+		return err
+	}
+
+	process, err = start(h.workDir, "worker", worker, env)
+	if err != nil {
+		return err
+	}
+	h.processes = append(h.processes, process)
+
+	return nil
+}
+
+func (h *harness) env(grpcAddress string, tlsFiles tlsFiles) []string {
+	settings := map[string]string{
+		"debug":                  "true",
+		"disablePermissionCheck": "true",
+		"grpcAddress":            grpcAddress,
+		"grpcCAFile":             tlsFiles.ca,
+		"grpcCertFile":           tlsFiles.cert,
+		"grpcKeyFile":            tlsFiles.key,
+		"grpcListenAddress":      grpcAddress,
+		"kpNodeCores":            strconv.FormatInt(h.kpNodeCores, 10),
+		"kpNodeMemory":           strconv.Itoa(kpNodeMemory),
+		"kpNodeNamePrefix":       kpNodeNamePrefix,
+		"kpNodeTemplateName":     templateName,
+		"kubeconfig":             h.kubeconfig,
+		"maxKpNodes":             "4",
+		"pmToken":                "token",
+		"pmUrl":                  h.proxmox.ApiUrl(),
+		"pmUserID":               "root@pam!kproximate",
+		"pollInterval":           "5",
+		"transport":              "grpc",
+		"waitSecondsForJoin":     "120",
+	}
+
+	env := os.Environ()
+	for key, value := range settings {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	return env
+}
+
+func (h *harness) teardown(ctx context.Context, failed bool) {
+	keep := os.Getenv("KPROXIMATE_E2E_KEEP") != ""
+
+	// The worker is stopped before the controller
+	for i := len(h.processes) - 1; i >= 0; i-- {
+		h.processes[i].stop()
+	}
+
+	if h.stopKubelet != nil {
+		h.stopKubelet()
+	}
+
+	if h.createdCluster && !keep {
+		output, err := exec.Command("kind", "delete", "cluster", "--name", kindClusterName).CombinedOutput()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to delete kind cluster: %s: %s\n", err, output)
+		}
+	} else if h.kube != nil && !h.createdCluster {
+		h.cleanUpCluster(ctx)
+	}
+
+	if h.proxmox != nil {
+		h.proxmox.Close()
+	}
+
+	if h.workDir == "" {
+		return
+	}
+
+	// A kept kind cluster's kubeconfig is in the work dir
+	if keep || failed && len(h.processes) > 0 {
+		fmt.Fprintf(os.Stderr, "The kubeconfig and the controller and worker logs are in %s\n", h.workDir)
+		return
+	}
+
+	os.RemoveAll(h.workDir)
+}
+
+// Removes what the tests left in an existing cluster, the kpNodes' VMs are
+// gone along with the fake Proxmox server.
+func (h *harness) cleanUpCluster(ctx context.Context) {
+	err := h.kube.CoreV1().Namespaces().Delete(ctx, testNamespace, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		fmt.Fprintf(os.Stderr, "Failed to delete namespace %s: %s\n", testNamespace, err)
+	}
+
+	nodes, err := h.kpNodes(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to list kpNodes: %s\n", err)
+		return
+	}
+
+	for _, node := range nodes {
+		err := h.kube.CoreV1().Nodes().Delete(ctx, node, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			fmt.Fprintf(os.Stderr, "Failed to delete node %s: %s\n", node, err)
+		}
+	}
+}
+
+// The names of the kpNodes registered in the cluster.
+func (h *harness) kpNodes(ctx context.Context) ([]string, error) {
+	nodes, err := h.kube.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	kpNodes := []string{}
+	for _, node := range nodes.Items {
+		if isKpNodeName(node.Name) {
+			kpNodes = append(kpNodes, node.Name)
+		}
+	}
+
+	return kpNodes, nil
+}
+
+// The names of the kpNode VMs in the fake Proxmox cluster.
+func (h *harness) kpNodeVMs() []string {
+	vms := []string{}
+	for _, vm := range h.proxmox.VMs() {
+		if !vm.Template && isKpNodeName(vm.Name) {
+			vms = append(vms, vm.Name)
+		}
+	}
+
+	return vms
+}
+
+func isKpNodeName(name string) bool {
+	return strings.HasPrefix(name, kpNodeNamePrefix+"-")
+}
+
+// Fails the test if the controller or worker has exited.
+func (h *harness) checkProcesses(t *testing.T) {
+	t.Helper()
+
+	for _, process := range h.processes {
+		if process.exited() {
+			t.Fatalf("The %s exited: %v\n%s", process.name, process.err, process.tail(50))
+		}
+	}
+}
+
+// Polls condition until it is met, failing the test if it isn't within the
+// timeout or kproximate exits. The error explains why the condition is not
+// yet met.
+func waitFor(t *testing.T, timeout time.Duration, description string, condition func(ctx context.Context) (bool, error)) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var lastErr error
+	for {
+		h.checkProcesses(t)
+
+		met, err := condition(ctx)
+		if met {
+			return
+		}
+		if err != nil {
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			t.Fatalf("Timed out after %s waiting for %s, last observed: %v", timeout, description, lastErr)
+		case <-time.After(time.Second * 2):
+		}
+	}
+}
+
+// Builds a kproximate command from this checkout into the work dir.
+func build(workDir string, command string) (string, error) {
+	binary := filepath.Join(workDir, "kproximate-"+command)
+
+	cmd := exec.Command("go", "build", "-o", binary, "./"+command)
+	cmd.Dir = ".."
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("failed to build the %s: %w: %s", command, err, output)
+	}
+
+	return binary, nil
+}
+
+type process struct {
+	name    string
+	cmd     *exec.Cmd
+	logFile string
+	done    chan struct{}
+	err     error
+}
+
+// Starts the binary with its output written to a log file in the work dir.
+func start(workDir string, name string, binary string, env []string) (*process, error) {
+	logFile := filepath.Join(workDir, name+".log")
+	log, err := os.Create(logFile)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(binary)
+	cmd.Env = env
+	cmd.Stdout = log
+	cmd.Stderr = log
+
+	err = cmd.Start()
+	if err != nil {
+		log.Close()
+		return nil, fmt.Errorf("failed to start the %s: %w", name, err)
+	}
+
+	p := &process{
+		name:    name,
+		cmd:     cmd,
+		logFile: logFile,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		p.err = cmd.Wait()
+		log.Close()
+		close(p.done)
+	}()
+
+	return p, nil
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *process) stop() {
+	if p.exited() {
+		return
+	}
+
+	_ = p.cmd.Process.Signal(syscall.SIGTERM)
+
+	select {
+	case <-p.done:
+	case <-time.After(time.Second * 30):
+		_ = p.cmd.Process.Kill()
+		<-p.done
+	}
+}
+
+// The last lines the process logged.
+func (p *process) tail(lines int) string {
+	file, err := os.Open(p.logFile)
+	if err != nil {
+		return err.Error()
+	}
+	defer file.Close()
+
+	logged := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		logged = append(logged, scanner.Text())
+		if len(logged) > lines {
+			logged = logged[1:]
+		}
+	}
+
+	return strings.Join(logged, "\n")
+}
+
+func freeAddress() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer listener.Close()
+
+	return listener.Addr().String(), nil
+}
+
+func waitForListener(address string, process *process, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+
+		if process.exited() {
+			return fmt.Errorf("the %s exited: %v\n%s", process.name, process.err, process.tail(50))
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the %s is not listening on %s: %w", process.name, address, err)
+		}
+
+		time.Sleep(time.Second)
+	}
+}
+
+type tlsFiles struct {
+	ca   string
+	cert string
+	key  string
+}
+
+// Writes a CA and a certificate signed by it which is valid for both ends of
+// the gRPC connection on localhost, as the transport requires mutual TLS.
+func writeTLSFiles(dir string) (tlsFiles, error) {
+	files := tlsFiles{
+		ca:   filepath.Join(dir, "ca.crt"),
+		cert: filepath.Join(dir, "tls.crt"),
+		key:  filepath.Join(dir, "tls.key"),
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return files, err
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kproximate-e2e-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour * 24),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return files, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return files, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "kproximate"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour * 24),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		return files, err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return files, err
+	}
+
+	for file, block := range map[string]*pem.Block{
+		files.ca:   {Type: "CERTIFICATE", Bytes: caDER},
+		files.cert: {Type: "CERTIFICATE", Bytes: certDER},
+		files.key:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+	} {
+		err = os.WriteFile(file, pem.EncodeToMemory(block), 0600)
+		if err != nil {
+			return files, err
+		}
+	}
+
+	return files, nil
+}
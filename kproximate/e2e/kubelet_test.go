@@ -0,0 +1,266 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/lupinelab/kproximate/proxmox/proxmoxtest"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	clientset "k8s.io/client-go/kubernetes"
+)
+
+// How often registered nodes report that they are still ready, well within
+// the node monitor grace period
+const heartbeatInterval = time.Second * 10
+
+// Stands in for the kubelet of each kpNode, as the VMs of the fake Proxmox
+// server never boot. It registers a ready node for each running kpNode VM,
+// keeps it ready, reports the pods bound to it as running and completes the
+// deletion of its terminating pods.
+type fakeKubelet struct {
+	kube    clientset.Interface
+	proxmox *proxmoxtest.Server
+	// The last heartbeat of each running kpNode VM's node, by VM ID
+	heartbeats map[int]time.Time
+}
+
+func newFakeKubelet(kube clientset.Interface, proxmox *proxmoxtest.Server) *fakeKubelet {
+	return &fakeKubelet{
+		kube:       kube,
+		proxmox:    proxmox,
+		heartbeats: map[int]time.Time{},
+	}
+}
+
+func (k *fakeKubelet) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		k.sync(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (k *fakeKubelet) sync(ctx context.Context) {
+	running := map[int]proxmoxtest.VM{}
+	for _, vm := range k.proxmox.VMs() {
+		if !vm.Template && vm.Status == "running" && isKpNodeName(vm.Name) {
+			running[vm.VmID] = vm
+		}
+	}
+
+	// A node is registered once each time its VM starts, so that a node
+	// deleted while scaling down is not registered again before its VM is
+	for vmID := range k.heartbeats {
+		if _, ok := running[vmID]; !ok {
+			delete(k.heartbeats, vmID)
+		}
+	}
+
+	for vmID, vm := range running {
+		if _, registered := k.heartbeats[vmID]; !registered {
+			err := k.register(ctx, vm)
+			if err != nil {
+				k.warn(ctx, "Failed to register node %s: %s", vm.Name, err)
+				continue
+			}
+
+			k.heartbeats[vmID] = time.Now()
+		}
+
+		if time.Since(k.heartbeats[vmID]) >= heartbeatInterval {
+			err := k.heartbeat(ctx, vm.Name)
+			if err != nil {
+				k.warn(ctx, "Failed to update node %s: %s", vm.Name, err)
+			} else {
+				k.heartbeats[vmID] = time.Now()
+			}
+		}
+
+		err := k.syncPods(ctx, vm.Name)
+		if err != nil {
+			k.warn(ctx, "Failed to sync the pods of node %s: %s", vm.Name, err)
+		}
+	}
+}
+
+// Errors are expected once the harness is being torn down.
+func (k *fakeKubelet) warn(ctx context.Context, format string, args ...interface{}) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "fake kubelet: "+format+"\n", args...)
+}
+
+// Registers a ready node with the resources of the VM's config.
+func (k *fakeKubelet) register(ctx context.Context, vm proxmoxtest.VM) error {
+	cpu, err := resource.ParseQuantity(vm.Config["cores"])
+	if err != nil {
+		return fmt.Errorf("invalid cores %q: %w", vm.Config["cores"], err)
+	}
+
+	memory, err := resource.ParseQuantity(vm.Config["memory"] + "Mi")
+	if err != nil {
+		return fmt.Errorf("invalid memory %q: %w", vm.Config["memory"], err)
+	}
+
+	capacity := apiv1.ResourceList{
+		apiv1.ResourceCPU:    cpu,
+		apiv1.ResourceMemory: memory,
+		apiv1.ResourcePods:   resource.MustParse("110"),
+	}
+
+	node, err := k.kube.CoreV1().Nodes().Create(ctx, &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: vm.Name,
+			Labels: map[string]string{
+				"kubernetes.io/arch":     runtime.GOARCH,
+				"kubernetes.io/hostname": vm.Name,
+				"kubernetes.io/os":       "linux",
+			},
+		},
+	}, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		node, err = k.kube.CoreV1().Nodes().Get(ctx, vm.Name, metav1.GetOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	node.Status.Capacity = capacity
+	node.Status.Allocatable = capacity
+	node.Status.Conditions = nodeConditions(metav1.Now())
+
+	_, err = k.kube.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+	return err
+}
+
+func nodeConditions(now metav1.Time) []apiv1.NodeCondition {
+	conditions := []apiv1.NodeCondition{}
+	for _, conditionType := range []apiv1.NodeConditionType{
+		apiv1.NodeMemoryPressure,
+		apiv1.NodeDiskPressure,
+		apiv1.NodePIDPressure,
+	} {
+		conditions = append(conditions, apiv1.NodeCondition{
+			Type:               conditionType,
+			Status:             apiv1.ConditionFalse,
+			LastHeartbeatTime:  now,
+			LastTransitionTime: now,
+		})
+	}
+
+	return append(conditions, apiv1.NodeCondition{
+		Type:               apiv1.NodeReady,
+		Status:             apiv1.ConditionTrue,
+		Reason:             "KubeletReady",
+		Message:            "fake kubelet is posting ready status",
+		LastHeartbeatTime:  now,
+		LastTransitionTime: now,
+	})
+}
+
+// Renews the node's conditions so that it is not marked unreachable. A node
+// deleted by a scale down is left deleted.
+func (k *fakeKubelet) heartbeat(ctx context.Context, nodeName string) error {
+	node, err := k.kube.CoreV1().Nodes().Get(ctx, nodeName, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	for i := range node.Status.Conditions {
+		node.Status.Conditions[i].LastHeartbeatTime = now
+	}
+
+	_, err = k.kube.CoreV1().Nodes().UpdateStatus(ctx, node, metav1.UpdateOptions{})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+
+	return err
+}
+
+// Reports the pods bound to the node as running and ready, as their
+// containers never start, and deletes its terminating pods at once.
+func (k *fakeKubelet) syncPods(ctx context.Context, nodeName string) error {
+	pods, err := k.kube.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("spec.nodeName", nodeName).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pod := range pods.Items {
+		switch {
+		case pod.DeletionTimestamp != nil:
+			gracePeriod := int64(0)
+			err = k.kube.CoreV1().Pods(pod.Namespace).Delete(ctx, pod.Name, metav1.DeleteOptions{
+				GracePeriodSeconds: &gracePeriod,
+			})
+		case pod.Status.Phase == apiv1.PodPending:
+			_, err = k.kube.CoreV1().Pods(pod.Namespace).UpdateStatus(ctx, runningPod(pod), metav1.UpdateOptions{})
+		default:
+			continue
+		}
+
+		if err != nil && !apierrors.IsNotFound(err) && !apierrors.IsConflict(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runningPod(pod apiv1.Pod) *apiv1.Pod {
+	now := metav1.Now()
+
+	pod.Status.Phase = apiv1.PodRunning
+	pod.Status.StartTime = &now
+	pod.Status.Conditions = []apiv1.PodCondition{}
+	for _, conditionType := range []apiv1.PodConditionType{
+		apiv1.PodScheduled,
+		apiv1.PodInitialized,
+		apiv1.ContainersReady,
+		apiv1.PodReady,
+	} {
+		pod.Status.Conditions = append(pod.Status.Conditions, apiv1.PodCondition{
+			Type:               conditionType,
+			Status:             apiv1.ConditionTrue,
+			LastTransitionTime: now,
+		})
+	}
+
+	pod.Status.ContainerStatuses = []apiv1.ContainerStatus{}
+	for _, container := range pod.Spec.Containers {
+		pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, apiv1.ContainerStatus{
+			Name:  container.Name,
+			Image: container.Image,
+			Ready: true,
+			State: apiv1.ContainerState{
+				Running: &apiv1.ContainerStateRunning{StartedAt: now},
+			},
+		})
+	}
+
+	return &pod
+}
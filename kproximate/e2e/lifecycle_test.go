@@ -0,0 +1,195 @@
+//go:build e2e
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	scaleUpTimeout   = time.Minute * 5
+	scaleDownTimeout = time.Minute * 10
+)
+
+func TestScaleUpAndDown(t *testing.T) {
+	h.createDeployment(t, "scale-up-and-down", 2)
+
+	h.waitForKpNodes(t, "scale-up-and-down", 2)
+
+	h.deleteDeployment(t, "scale-up-and-down")
+
+	h.waitForScaleDown(t)
+}
+
+func TestScaleUpRecoversFromFailedStart(t *testing.T) {
+	h.proxmox.FailTask("qmstart", "start failed: e2e test")
+	t.Cleanup(h.proxmox.ClearFailures)
+
+	previousStarts := h.startRequests()
+	h.createDeployment(t, "failed-start", 1)
+
+	waitFor(t, scaleUpTimeout, "a kpNode to fail to start", func(ctx context.Context) (bool, error) {
+		return h.startRequests() > previousStarts, fmt.Errorf("no kpNode has been started")
+	})
+
+	kpNodes, err := h.kpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) > 0 {
+		t.Errorf("Expected no kpNodes to join while they fail to start, got %v", kpNodes)
+	}
+
+	h.proxmox.ClearFailures()
+
+	// The VMs which failed to start are removed rather than joining or
+	// being left behind
+	h.waitForKpNodes(t, "failed-start", 1)
+
+	h.deleteDeployment(t, "failed-start")
+
+	h.waitForScaleDown(t)
+}
+
+// The number of requests to start VMs the fake Proxmox server has received.
+func (h *harness) startRequests() int {
+	starts := 0
+	for _, request := range h.proxmox.Requests() {
+		if strings.HasSuffix(request, "/status/start") {
+			starts++
+		}
+	}
+
+	return starts
+}
+
+// Creates a deployment of pods which each need a kpNode of their own.
+func (h *harness) createDeployment(t *testing.T, name string, replicas int32) {
+	t.Helper()
+
+	labels := map[string]string{"app": name}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: testNamespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: apiv1.PodSpec{
+					Containers: []apiv1.Container{
+						{
+							Name:  "pause",
+							Image: "registry.k8s.io/pause:3.9",
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{
+									apiv1.ResourceCPU:    *resource.NewQuantity(h.podCpu, resource.DecimalSI),
+									apiv1.ResourceMemory: resource.MustParse("64Mi"),
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	_, err := h.kube.AppsV1().Deployments(testNamespace).Create(context.Background(), deployment, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// For tests which fail before deleting it
+	t.Cleanup(func() {
+		err := h.kube.AppsV1().Deployments(testNamespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			t.Errorf("Failed to delete deployment %s: %s", name, err)
+		}
+	})
+}
+
+func (h *harness) deleteDeployment(t *testing.T, name string) {
+	t.Helper()
+
+	err := h.kube.AppsV1().Deployments(testNamespace).Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Waits for each of the deployment's pods to be scheduled on a kpNode of
+// its own, then checks that exactly those kpNodes were provisioned.
+func (h *harness) waitForKpNodes(t *testing.T, deployment string, replicas int) {
+	t.Helper()
+
+	waitFor(t, scaleUpTimeout, "the pods to be scheduled on kpNodes", func(ctx context.Context) (bool, error) {
+		pods, err := h.kube.CoreV1().Pods(testNamespace).List(ctx, metav1.ListOptions{
+			LabelSelector: "app=" + deployment,
+		})
+		if err != nil {
+			return false, err
+		}
+
+		nodes := map[string]bool{}
+		for _, pod := range pods.Items {
+			if pod.DeletionTimestamp != nil {
+				continue
+			}
+
+			if !isKpNodeName(pod.Spec.NodeName) {
+				return false, fmt.Errorf("pod %s is not scheduled on a kpNode", pod.Name)
+			}
+
+			nodes[pod.Spec.NodeName] = true
+		}
+
+		return len(nodes) == replicas, fmt.Errorf("pods are scheduled on %d kpNodes", len(nodes))
+	})
+
+	kpNodes, err := h.kpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vms := h.kpNodeVMs()
+	slices.Sort(kpNodes)
+	slices.Sort(vms)
+
+	if len(kpNodes) != replicas {
+		t.Errorf("Expected %d kpNodes, got %v", replicas, kpNodes)
+	}
+
+	if !slices.Equal(kpNodes, vms) {
+		t.Errorf("Expected a VM for each kpNode %v, got %v", kpNodes, vms)
+	}
+}
+
+// Waits for every kpNode to be drained, deleted and its VM destroyed.
+func (h *harness) waitForScaleDown(t *testing.T) {
+	t.Helper()
+
+	waitFor(t, scaleDownTimeout, "the kpNodes to be scaled down", func(ctx context.Context) (bool, error) {
+		kpNodes, err := h.kpNodes(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		vms := h.kpNodeVMs()
+
+		return len(kpNodes) == 0 && len(vms) == 0, fmt.Errorf("kpNodes %v and VMs %v remain", kpNodes, vms)
+	})
+}
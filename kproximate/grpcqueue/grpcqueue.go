@@ -0,0 +1,591 @@
+package grpcqueue
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/status"
+)
+
+const serviceName = "kproximate.ScaleEventQueue"
+
+type NextRequest struct {
+	Queues []string `json:"queues"`
+}
+
+type Delivery struct {
+	Id    uint64 `json:"id"`
+	Queue string `json:"queue"`
+	Body  []byte `json:"body"`
+	Key   string `json:"key,omitempty"`
+	// Deliveries with a higher priority are served first
+	Priority      int  `json:"priority,omitempty"`
+	Redelivered   bool `json:"redelivered"`
+	DeliveryCount int  `json:"deliveryCount"`
+}
+
+type AckRequest struct {
+	Id            uint64 `json:"id"`
+	Requeue       bool   `json:"requeue"`
+	FailureReason string `json:"failureReason,omitempty"`
+	// Returns the event to the back of its queue without counting a failed
+	// delivery. Sent along with Requeue so older controllers still requeue it.
+	Release bool `json:"release,omitempty"`
+}
+
+type AckResponse struct{}
+
+// Extends the lease of a running scale event so that a slow provision is not
+// handed to another worker
+type RenewRequest struct {
+	Id uint64 `json:"id"`
+}
+
+type RenewResponse struct{}
+
+// How often workers renew the leases of the scale events they are processing,
+// leases must be several times longer
+const RenewInterval = time.Minute
+
+// A scale event which reached the delivery limit, kept until it is requeued
+// or the controller restarts
+type DeadLetterEvent struct {
+	Queue         string          `json:"queue"`
+	FailureReason string          `json:"failureReason"`
+	Payload       json.RawMessage `json:"payload"`
+	delivery      *Delivery
+}
+
+// A progress update for a scale event published by a worker
+type ReportRequest struct {
+	Body []byte `json:"body"`
+}
+
+type ReportResponse struct{}
+
+// Messages are encoded as JSON so that no generated protobuf code is required
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func init() {
+	encoding.RegisterCodec(jsonCodec{})
+}
+
+type queueService interface {
+	next(ctx context.Context, req *NextRequest) (*Delivery, error)
+	ack(ctx context.Context, req *AckRequest) (*AckResponse, error)
+	report(ctx context.Context, req *ReportRequest) (*ReportResponse, error)
+	renew(ctx context.Context, req *RenewRequest) (*RenewResponse, error)
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: serviceName,
+	HandlerType: (*queueService)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Next",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(NextRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(queueService).next(ctx, req)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: fmt.Sprintf("/%s/Next", serviceName),
+				}
+
+				return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(queueService).next(ctx, req.(*NextRequest))
+				})
+			},
+		},
+		{
+			MethodName: "Ack",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(AckRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(queueService).ack(ctx, req)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: fmt.Sprintf("/%s/Ack", serviceName),
+				}
+
+				return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(queueService).ack(ctx, req.(*AckRequest))
+				})
+			},
+		},
+		{
+			MethodName: "Report",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(ReportRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(queueService).report(ctx, req)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: fmt.Sprintf("/%s/Report", serviceName),
+				}
+
+				return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(queueService).report(ctx, req.(*ReportRequest))
+				})
+			},
+		},
+		{
+			MethodName: "Renew",
+			Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+				req := new(RenewRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+
+				if interceptor == nil {
+					return srv.(queueService).renew(ctx, req)
+				}
+
+				info := &grpc.UnaryServerInfo{
+					Server:     srv,
+					FullMethod: fmt.Sprintf("/%s/Renew", serviceName),
+				}
+
+				return interceptor(ctx, req, info, func(ctx context.Context, req any) (any, error) {
+					return srv.(queueService).renew(ctx, req.(*RenewRequest))
+				})
+			},
+		},
+	},
+}
+
+type lease struct {
+	delivery *Delivery
+	expires  time.Time
+}
+
+// An in-memory queue of scale events served to workers over gRPC, allowing
+// the controller and workers to communicate without a message broker. Scale
+// events are not durable, they are lost when the controller restarts.
+type Server struct {
+	mu            sync.Mutex
+	queues        map[string][]*Delivery
+	running       map[uint64]*lease
+	deadLetters   []*DeadLetterEvent
+	lastKeys      map[string]string
+	nextId        uint64
+	changed       chan struct{}
+	leaseDuration time.Duration
+	deliveryLimit int
+	reports       chan []byte
+}
+
+// The number of progress reports buffered before further reports are dropped
+const reportBuffer = 100
+
+func NewServer(leaseDuration time.Duration, deliveryLimit int) *Server {
+	return &Server{
+		queues:        map[string][]*Delivery{},
+		running:       map[uint64]*lease{},
+		lastKeys:      map[string]string{},
+		changed:       make(chan struct{}),
+		leaseDuration: leaseDuration,
+		deliveryLimit: deliveryLimit,
+		reports:       make(chan []byte, reportBuffer),
+	}
+}
+
+// The progress reports published by workers.
+func (s *Server) Reports() <-chan []byte {
+	return s.reports
+}
+
+// Wakes any workers waiting for a scale event. Must be called with the lock held.
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// Publishes a scale event to the queue. Events are served round-robin across
+// their keys, eg node classes, so that a burst of events with one key does
+// not starve the others.
+func (s *Server) Publish(queueName string, key string, body []byte) {
+	s.PublishWithPriority(queueName, key, 0, body)
+}
+
+// Publishes a scale event which is served before any of a lower priority in
+// the queue, round-robin across the keys of events of the same priority.
+func (s *Server) PublishWithPriority(queueName string, key string, priority int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextId++
+	s.queues[queueName] = append(s.queues[queueName], &Delivery{
+		Id:       s.nextId,
+		Queue:    queueName,
+		Body:     body,
+		Key:      key,
+		Priority: priority,
+	})
+
+	s.notify()
+}
+
+// Returns the number of scale events waiting to be consumed and the number
+// currently being processed by a worker.
+func (s *Server) Count(queueName string) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	running := 0
+	for _, lease := range s.running {
+		if lease.delivery.Queue == queueName {
+			running++
+		}
+	}
+
+	return len(s.queues[queueName]), running
+}
+
+// Requeues a delivery at the front of its queue, or dead letters it if it has
+// reached the delivery limit. Must be called with the lock held.
+func (s *Server) requeue(delivery *Delivery, failureReason string) {
+	delivery.Redelivered = true
+	delivery.DeliveryCount++
+
+	if delivery.DeliveryCount > s.deliveryLimit {
+		logger.ErrorLog("Dead lettering scale event which reached the delivery limit", "queue", delivery.Queue, "event", string(delivery.Body), "reason", failureReason)
+
+		payload := json.RawMessage(delivery.Body)
+		if !json.Valid(payload) {
+			payload, _ = json.Marshal(string(delivery.Body))
+		}
+
+		s.deadLetters = append(s.deadLetters, &DeadLetterEvent{
+			Queue:         delivery.Queue,
+			FailureReason: failureReason,
+			Payload:       payload,
+			delivery:      delivery,
+		})
+		return
+	}
+
+	s.queues[delivery.Queue] = append([]*Delivery{delivery}, s.queues[delivery.Queue]...)
+	s.notify()
+}
+
+// Lists the dead lettered scale events without removing them.
+func (s *Server) DeadLetterEvents() []DeadLetterEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deadLetterEvents := []DeadLetterEvent{}
+	for _, deadLetterEvent := range s.deadLetters {
+		deadLetterEvents = append(deadLetterEvents, *deadLetterEvent)
+	}
+
+	return deadLetterEvents
+}
+
+// Moves all dead lettered scale events back onto the queue they came from,
+// with a fresh delivery count, and returns the number of events requeued.
+func (s *Server) RequeueDeadLetterEvents() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, deadLetterEvent := range s.deadLetters {
+		delivery := deadLetterEvent.delivery
+		delivery.DeliveryCount = 0
+		s.queues[delivery.Queue] = append(s.queues[delivery.Queue], delivery)
+	}
+
+	numRequeued := len(s.deadLetters)
+	s.deadLetters = nil
+	if numRequeued > 0 {
+		s.notify()
+	}
+
+	return numRequeued
+}
+
+// Requeues the scale events of workers which have not acknowledged them
+// within the lease duration, eg because the worker crashed.
+func (s *Server) expireLeases(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, lease := range s.running {
+		if now.After(lease.expires) {
+			delete(s.running, id)
+			s.requeue(lease.delivery, "lease expired")
+		}
+	}
+}
+
+// Removes the next delivery from the queue, the first of the highest priority
+// with the key following the last key served in sort order. Must be called
+// with the lock held.
+func (s *Server) dequeue(queueName string) *Delivery {
+	queue := s.queues[queueName]
+
+	next := 0
+	for idx, delivery := range queue {
+		if delivery.Priority > queue[next].Priority {
+			next = idx
+		}
+	}
+
+	for idx, delivery := range queue {
+		if delivery.Priority != queue[next].Priority || delivery.Key == queue[next].Key {
+			continue
+		}
+
+		// Prefer the smallest key after the last one served, wrapping
+		// around to the smallest key overall
+		after := delivery.Key > s.lastKeys[queueName]
+		nextAfter := queue[next].Key > s.lastKeys[queueName]
+		if after != nextAfter {
+			if after {
+				next = idx
+			}
+		} else if delivery.Key < queue[next].Key {
+			next = idx
+		}
+	}
+
+	delivery := queue[next]
+	s.queues[queueName] = slices.Delete(queue, next, next+1)
+	s.lastKeys[queueName] = delivery.Key
+
+	return delivery
+}
+
+func (s *Server) next(ctx context.Context, req *NextRequest) (*Delivery, error) {
+	for {
+		s.mu.Lock()
+		for _, queueName := range req.Queues {
+			if len(s.queues[queueName]) > 0 {
+				delivery := s.dequeue(queueName)
+				s.running[delivery.Id] = &lease{
+					delivery: delivery,
+					expires:  time.Now().Add(s.leaseDuration),
+				}
+
+				s.mu.Unlock()
+				return delivery, nil
+			}
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-changed:
+		}
+	}
+}
+
+func (s *Server) ack(ctx context.Context, req *AckRequest) (*AckResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.running[req.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no running scale event with id %d", req.Id)
+	}
+
+	delete(s.running, req.Id)
+
+	if req.Release {
+		s.queues[lease.delivery.Queue] = append(s.queues[lease.delivery.Queue], lease.delivery)
+		s.notify()
+	} else if req.Requeue {
+		s.requeue(lease.delivery, req.FailureReason)
+	}
+
+	return &AckResponse{}, nil
+}
+
+func (s *Server) renew(ctx context.Context, req *RenewRequest) (*RenewResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lease, ok := s.running[req.Id]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no running scale event with id %d", req.Id)
+	}
+
+	lease.expires = time.Now().Add(s.leaseDuration)
+
+	return &RenewResponse{}, nil
+}
+
+// Progress reports are informational so they are dropped rather than blocking
+// the worker when they are not being consumed.
+func (s *Server) report(ctx context.Context, req *ReportRequest) (*ReportResponse, error) {
+	select {
+	case s.reports <- req.Body:
+	default:
+		logger.WarnLog("Dropping scale event progress report, too many reports are waiting to be processed")
+	}
+
+	return &ReportResponse{}, nil
+}
+
+// Serves the queue to workers until the context is cancelled.
+func (s *Server) Serve(ctx context.Context, address string, tlsConfig *tls.Config) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	grpcServer.RegisterService(&serviceDesc, s)
+
+	go func() {
+		ticker := time.NewTicker(time.Second * 10)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				grpcServer.Stop()
+				return
+			case now := <-ticker.C:
+				s.expireLeases(now)
+			}
+		}
+	}()
+
+	return grpcServer.Serve(listener)
+}
+
+type Client struct {
+	conn *grpc.ClientConn
+}
+
+func NewClient(address string, tlsConfig *tls.Config) (*Client, error) {
+	conn, err := grpc.NewClient(
+		address,
+		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+		grpc.WithDefaultCallOptions(
+			grpc.CallContentSubtype(jsonCodec{}.Name()),
+			// Wait for the controller to become available rather than failing
+			grpc.WaitForReady(true),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		conn: conn,
+	}, nil
+}
+
+// Blocks until a scale event is available on one of the queues, queues are
+// checked in the order given.
+func (c *Client) Next(ctx context.Context, queueNames []string) (*Delivery, error) {
+	delivery := new(Delivery)
+	err := c.conn.Invoke(ctx, fmt.Sprintf("/%s/Next", serviceName), &NextRequest{Queues: queueNames}, delivery)
+	return delivery, err
+}
+
+func (c *Client) Ack(ctx context.Context, id uint64) error {
+	return c.conn.Invoke(ctx, fmt.Sprintf("/%s/Ack", serviceName), &AckRequest{Id: id}, new(AckResponse))
+}
+
+func (c *Client) Requeue(ctx context.Context, id uint64, failureReason string) error {
+	return c.conn.Invoke(ctx, fmt.Sprintf("/%s/Ack", serviceName), &AckRequest{Id: id, Requeue: true, FailureReason: failureReason}, new(AckResponse))
+}
+
+// Returns a scale event the worker cannot process, eg one published for a
+// newer worker, to the back of its queue for another worker.
+func (c *Client) Release(ctx context.Context, id uint64) error {
+	return c.conn.Invoke(ctx, fmt.Sprintf("/%s/Ack", serviceName), &AckRequest{Id: id, Requeue: true, Release: true}, new(AckResponse))
+}
+
+func (c *Client) Renew(ctx context.Context, id uint64) error {
+	return c.conn.Invoke(ctx, fmt.Sprintf("/%s/Renew", serviceName), &RenewRequest{Id: id}, new(RenewResponse))
+}
+
+func (c *Client) Report(ctx context.Context, body []byte) error {
+	return c.conn.Invoke(ctx, fmt.Sprintf("/%s/Report", serviceName), &ReportRequest{Body: body}, new(ReportResponse))
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Builds a mutual TLS config, the server requires clients to present a
+// certificate signed by the CA and clients verify the server in the same way.
+func NewTLSConfig(certFile string, keyFile string, caFile string, server bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("failed to parse CA certificate %s", caFile)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if server {
+		tlsConfig.ClientCAs = caPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	} else {
+		tlsConfig.RootCAs = caPool
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,356 @@
+package grpcqueue
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNextReturnsEventsInQueueOrder(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+
+	s.Publish("scaleDownEvents", "", []byte("down"))
+	s.Publish("scaleUpEvents", "", []byte("up"))
+
+	delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents", "scaleDownEvents"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(delivery.Body) != "up" {
+		t.Errorf("Expected the scale up event first, got %s", delivery.Body)
+	}
+
+	pending, running := s.Count("scaleUpEvents")
+	if pending != 0 || running != 1 {
+		t.Errorf("Expected 0 pending and 1 running, got %d and %d", pending, running)
+	}
+}
+
+func TestRequeueDeadLettersEventsAtDeliveryLimit(t *testing.T) {
+	s := NewServer(time.Minute, 1)
+	s.Publish("scaleUpEvents", "", []byte(`{"nodeName": "kp-node-1"}`))
+
+	for attempt := 0; attempt < 2; attempt++ {
+		delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if attempt == 1 && !delivery.Redelivered {
+			t.Error("Expected the event to be marked as redelivered")
+		}
+
+		_, err = s.ack(context.Background(), &AckRequest{Id: delivery.Id, Requeue: true, FailureReason: "failed"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, running := s.Count("scaleUpEvents")
+	if pending != 0 || running != 0 {
+		t.Errorf("Expected the event to be removed from the queue, got %d pending and %d running", pending, running)
+	}
+
+	deadLetterEvents := s.DeadLetterEvents()
+	if len(deadLetterEvents) != 1 || deadLetterEvents[0].FailureReason != "failed" || string(deadLetterEvents[0].Payload) != `{"nodeName": "kp-node-1"}` {
+		t.Fatalf("Expected the event to be dead lettered, got %+v", deadLetterEvents)
+	}
+
+	if numRequeued := s.RequeueDeadLetterEvents(); numRequeued != 1 {
+		t.Errorf("Expected 1 event to be requeued, got %d", numRequeued)
+	}
+
+	pending, _ = s.Count("scaleUpEvents")
+	if pending != 1 || len(s.DeadLetterEvents()) != 0 {
+		t.Errorf("Expected the dead lettered event to be back on its queue, got %d pending", pending)
+	}
+}
+
+func TestReleaseDoesNotCountDeliveries(t *testing.T) {
+	s := NewServer(time.Minute, 1)
+	s.Publish("scaleUpEvents", "", []byte("first"))
+	s.Publish("scaleUpEvents", "", []byte("second"))
+
+	for attempt := 0; attempt < 3; attempt++ {
+		delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = s.ack(context.Background(), &AckRequest{Id: delivery.Id, Requeue: true, Release: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pending, _ := s.Count("scaleUpEvents")
+	if pending != 2 {
+		t.Fatalf("Expected released events to be kept, got %d pending", pending)
+	}
+
+	delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(delivery.Body) != "second" || delivery.DeliveryCount != 0 {
+		t.Errorf("Expected the second event with no failed deliveries, got %s with %d", delivery.Body, delivery.DeliveryCount)
+	}
+}
+
+func TestExpireLeasesRequeuesEvents(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+	s.Publish("scaleUpEvents", "", []byte("up"))
+
+	_, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.expireLeases(time.Now().Add(time.Minute * 2))
+
+	pending, running := s.Count("scaleUpEvents")
+	if pending != 1 || running != 0 {
+		t.Errorf("Expected the event to be requeued, got %d pending and %d running", pending, running)
+	}
+}
+
+func TestRenewExtendsLease(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+	s.Publish("scaleUpEvents", "", []byte("up"))
+
+	delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.mu.Lock()
+	s.running[delivery.Id].expires = time.Now()
+	s.mu.Unlock()
+
+	_, err = s.renew(context.Background(), &RenewRequest{Id: delivery.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.expireLeases(time.Now().Add(time.Second * 30))
+
+	pending, running := s.Count("scaleUpEvents")
+	if pending != 0 || running != 1 {
+		t.Errorf("Expected the renewed event to still be running, got %d pending and %d running", pending, running)
+	}
+
+	_, err = s.renew(context.Background(), &RenewRequest{Id: delivery.Id + 1})
+	if err == nil {
+		t.Error("Expected renewing an unknown event to fail")
+	}
+}
+
+func TestNextServesKeysRoundRobin(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+
+	for _, event := range []string{"default-1", "default-2", "default-3"} {
+		s.Publish("scaleUpEvents", "default", []byte(event))
+	}
+	s.Publish("scaleUpEvents", "gpu", []byte("gpu-1"))
+	s.Publish("scaleUpEvents", "large", []byte("large-1"))
+
+	expected := []string{"default-1", "gpu-1", "large-1", "default-2", "default-3"}
+	for _, body := range expected {
+		delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(delivery.Body) != body {
+			t.Errorf("Expected %s, got %s", body, delivery.Body)
+		}
+	}
+}
+
+func TestNextServesHigherPriorityFirst(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+
+	s.Publish("scaleUpEvents", "default", []byte("default-1"))
+	s.Publish("scaleUpEvents", "large", []byte("large-1"))
+	s.PublishWithPriority("scaleUpEvents", "gpu", 5, []byte("gpu-1"))
+	s.PublishWithPriority("scaleUpEvents", "default", 5, []byte("default-urgent"))
+	s.PublishWithPriority("scaleUpEvents", "gpu", 5, []byte("gpu-2"))
+
+	expected := []string{"default-urgent", "gpu-1", "gpu-2", "large-1", "default-1"}
+	for _, body := range expected {
+		delivery, err := s.next(context.Background(), &NextRequest{Queues: []string{"scaleUpEvents"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(delivery.Body) != body {
+			t.Errorf("Expected %s, got %s", body, delivery.Body)
+		}
+	}
+}
+
+func writePEM(t *testing.T, path string, blockType string, bytes []byte) {
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: bytes}), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Generates a CA and a certificate signed by it which is valid for localhost
+// as both a server and client.
+func generateCerts(t *testing.T) (string, string, string) {
+	dir := t.TempDir()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kproximate-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "kproximate"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, caTemplate, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(dir, "ca.crt")
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writePEM(t, caFile, "CERTIFICATE", caDer)
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDer)
+
+	return certFile, keyFile, caFile
+}
+
+func TestReportDropsReportsWhenFull(t *testing.T) {
+	s := NewServer(time.Minute, 2)
+
+	for i := 0; i < reportBuffer+1; i++ {
+		_, err := s.report(context.Background(), &ReportRequest{Body: []byte("joined")})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(s.Reports()) != reportBuffer {
+		t.Errorf("Expected %d buffered reports, got %d", reportBuffer, len(s.Reports()))
+	}
+
+	if string(<-s.Reports()) != "joined" {
+		t.Error("Expected the report body to be passed through")
+	}
+}
+
+func TestClientServerOverMutualTLS(t *testing.T) {
+	certFile, keyFile, caFile := generateCerts(t)
+
+	serverTLS, err := NewTLSConfig(certFile, keyFile, caFile, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientTLS, err := NewTLSConfig(certFile, keyFile, caFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s := NewServer(time.Minute, 2)
+	go s.Serve(ctx, address, serverTLS)
+
+	client, err := NewClient(address, clientTLS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	s.Publish("scaleUpEvents", "", []byte(`{"NodeName":"kp-node"}`))
+
+	nextCtx, nextCancel := context.WithTimeout(ctx, time.Second*5)
+	defer nextCancel()
+
+	delivery, err := client.Next(nextCtx, []string{"scaleUpEvents"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(delivery.Body) != `{"NodeName":"kp-node"}` {
+		t.Errorf("Unexpected delivery body: %s", delivery.Body)
+	}
+
+	err = client.Ack(nextCtx, delivery.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, running := s.Count("scaleUpEvents")
+	if pending != 0 || running != 0 {
+		t.Errorf("Expected the event to be acknowledged, got %d pending and %d running", pending, running)
+	}
+
+	err = client.Report(nextCtx, []byte(`{"nodeName":"kp-node","state":"joined"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report := <-s.Reports(); string(report) != `{"nodeName":"kp-node","state":"joined"}` {
+		t.Errorf("Unexpected report: %s", report)
+	}
+}
@@ -0,0 +1,103 @@
+// Package identity names kpNodes and recognises the names it gives them, so
+// that the scaler, workers and the kubernetes and Proxmox clients agree on
+// which nodes and VMs are kpNodes.
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/uuid"
+)
+
+const (
+	// Names kpNodes "<prefix>-<uuid>"
+	SchemeUUID = "uuid"
+	// Names kpNodes "<prefix>-<8 hex characters>", e.g. for operating systems
+	// that limit the length of hostnames
+	SchemeShort = "short"
+)
+
+// The infix separating the prefix of a warm kpNode's name from its ID
+const warmInfix = "warm-"
+
+const (
+	uuidID  = `\w{8}-\w{4}-\w{4}-\w{4}-\w{12}`
+	shortID = `[0-9a-f]{8}`
+)
+
+var id = regexp.MustCompile(fmt.Sprintf(`^(%s|%s)$`, uuidID, shortID))
+
+// How kpNodes are named, a prefix followed by a unique ID generated according
+// to the scheme. The VM backing a kpNode and its kubernetes node share the
+// name. Names of either scheme are recognised whatever the scheme, so that the
+// scheme can be changed without orphaning existing kpNodes.
+type Naming struct {
+	Prefix string
+	Scheme string
+}
+
+// A kpNode's name broken into its parts.
+type Identity struct {
+	Prefix string
+	// The unique part of the name, a UUID or hex characters
+	ID string
+	// Whether the name is that of a stopped VM in a warm pool, which is not
+	// yet a kpNode
+	Warm bool
+}
+
+// Whether the scheme is one kpNodes can be named with.
+func ValidScheme(scheme string) bool {
+	return scheme == SchemeUUID || scheme == SchemeShort
+}
+
+func (n Naming) newID() string {
+	if n.Scheme == SchemeShort {
+		id := make([]byte, 4)
+		_, err := rand.Read(id)
+		if err == nil {
+			return hex.EncodeToString(id)
+		}
+	}
+
+	return string(uuid.NewUUID())
+}
+
+// A new, unique, kpNode name.
+func (n Naming) NewName() string {
+	return fmt.Sprintf("%s-%s", n.Prefix, n.newID())
+}
+
+// A new, unique, name for a VM in a warm pool.
+func (n Naming) NewWarmName() string {
+	return fmt.Sprintf("%s-%s%s", n.Prefix, warmInfix, n.newID())
+}
+
+// Matches the names of kpNodes, but not those of warm VMs.
+func (n Naming) Regex() *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`^%s-(%s|%s)$`, regexp.QuoteMeta(n.Prefix), uuidID, shortID))
+}
+
+// Breaks the name of a kpNode or warm VM into its parts, returning false if it
+// is neither.
+func (n Naming) Parse(name string) (Identity, bool) {
+	suffix, found := strings.CutPrefix(name, n.Prefix+"-")
+	if !found {
+		return Identity{}, false
+	}
+
+	suffix, warm := strings.CutPrefix(suffix, warmInfix)
+	if !id.MatchString(suffix) {
+		return Identity{}, false
+	}
+
+	return Identity{
+		Prefix: n.Prefix,
+		ID:     suffix,
+		Warm:   warm,
+	}, true
+}
@@ -0,0 +1,72 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewName(t *testing.T) {
+	for _, scheme := range []string{SchemeUUID, SchemeShort, ""} {
+		naming := Naming{Prefix: "kp-node", Scheme: scheme}
+
+		name := naming.NewName()
+		if !naming.Regex().MatchString(name) {
+			t.Errorf("Expected %s to be recognised as a kpNode name", name)
+		}
+
+		warmName := naming.NewWarmName()
+		if naming.Regex().MatchString(warmName) {
+			t.Errorf("Expected warm VM %s not to be recognised as a kpNode name", warmName)
+		}
+
+		identity, ok := naming.Parse(warmName)
+		if !ok || !identity.Warm {
+			t.Errorf("Expected %s to be parsed as a warm VM, got %+v", warmName, identity)
+		}
+	}
+
+	short := Naming{Prefix: "kp-node", Scheme: SchemeShort}.NewName()
+	if len(short) != len("kp-node-")+8 {
+		t.Errorf("Expected a short name, got %s", short)
+	}
+}
+
+func TestParse(t *testing.T) {
+	naming := Naming{Prefix: "kp-node"}
+
+	identity, ok := naming.Parse("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd")
+	if !ok || identity.ID != "163c3d58-4c4d-426d-baef-e0c30ecb5fcd" || identity.Warm {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+
+	identity, ok = naming.Parse("kp-node-0a1b2c3d")
+	if !ok || identity.ID != "0a1b2c3d" {
+		t.Errorf("Expected a short name to be parsed whatever the scheme, got %+v", identity)
+	}
+
+	for _, name := range []string{
+		"kp-node",
+		"kp-node-team-a-0a1b2c3d",
+		"other-node-0a1b2c3d",
+		"kp-node-0A1B2C3D-extra",
+	} {
+		if _, ok := naming.Parse(name); ok {
+			t.Errorf("Expected %s not to be parsed", name)
+		}
+
+		if naming.Regex().MatchString(name) {
+			t.Errorf("Expected %s not to be recognised as a kpNode name", name)
+		}
+	}
+}
+
+func TestRegexQuotesPrefix(t *testing.T) {
+	naming := Naming{Prefix: "kp.node"}
+	if naming.Regex().MatchString("kpxnode-0a1b2c3d") {
+		t.Error("Expected the prefix to be matched literally")
+	}
+
+	if !strings.HasPrefix(naming.NewName(), "kp.node-") {
+		t.Error("Expected names to start with the prefix")
+	}
+}
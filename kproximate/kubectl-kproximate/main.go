@@ -0,0 +1,351 @@
+// The kubectl-kproximate kubectl plugin, run as "kubectl kproximate", reports
+// the status of kproximate and its kpNodes, requests scale ups and drains
+// kpNodes through the controller's status API.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lupinelab/kproximate/client"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const usage = `Usage: kubectl kproximate [flags] <command>
+
+Commands:
+  status               Show why the cluster was or wasn't last scaled and recent scale events
+  nodes                List kpNodes along with the Proxmox VMs backing them
+  scale-up [nodeClass] Request a scale up of a kpNode of the node class
+  drain <kpNode>       Drain and remove the kpNode
+  evacuate             Drain and remove every kpNode one at a time, after confirmation
+  evacuate status      Show the progress of an evacuation
+  evacuate cancel      Stop an evacuation, the kpNode being removed is still removed
+
+Flags:
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("kubectl-kproximate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		flags.PrintDefaults()
+	}
+
+	namespace := flags.String("namespace", "kproximate", "The namespace of the kproximate controller")
+	flags.StringVar(namespace, "n", "kproximate", "Shorthand for --namespace")
+	service := flags.String("service", "kproximate", "The name of the kproximate controller's Service")
+	controllerUrl := flags.String("url", "", "The controller's URL, e.g. from kubectl port-forward, in place of the apiserver's service proxy")
+	token := flags.String("token", os.Getenv("KPROXIMATE_TOKEN"), "The bearer token for the status API when apiAuth is set, defaults to $KPROXIMATE_TOKEN")
+	kubeconfig := flags.String("kubeconfig", "", "The kubeconfig file")
+	kubeContext := flags.String("context", "", "The kubeconfig context")
+	timeout := flags.Duration("request-timeout", time.Second*30, "The time allowed for each request")
+	yes := flags.Bool("yes", false, "Evacuate without asking for confirmation")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	statusClient, err := newStatusClient(*controllerUrl, *namespace, *service, *kubeconfig, *kubeContext)
+	if err != nil {
+		fmt.Fprintf(stderr, "Failed to connect to the kproximate controller: %s\n", err.Error())
+		return 1
+	}
+	statusClient.Token = *token
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+	switch {
+	case command == "status" && len(commandArgs) == 0:
+		err = status(ctx, statusClient, stdout)
+	case command == "nodes" && len(commandArgs) == 0:
+		err = nodes(ctx, statusClient, stdout)
+	case command == "scale-up" && len(commandArgs) <= 1:
+		nodeClass := ""
+		if len(commandArgs) == 1 {
+			nodeClass = commandArgs[0]
+		}
+		err = scaleUp(ctx, statusClient, nodeClass, stdout)
+	case command == "drain" && len(commandArgs) == 1:
+		err = drain(ctx, statusClient, commandArgs[0], stdout)
+	case command == "evacuate" && len(commandArgs) == 0:
+		err = evacuate(ctx, statusClient, *timeout, *yes, stdin, stdout)
+	case command == "evacuate" && len(commandArgs) == 1 && commandArgs[0] == "status":
+		err = evacuationStatus(ctx, statusClient, stdout)
+	case command == "evacuate" && len(commandArgs) == 1 && commandArgs[0] == "cancel":
+		err = cancelEvacuation(ctx, statusClient, stdout)
+	default:
+		flags.Usage()
+		return 2
+	}
+
+	if err != nil {
+		var apiErr *client.APIError
+		if errors.As(err, &apiErr) {
+			err = errors.New(apiErr.Message)
+		}
+
+		fmt.Fprintf(stderr, "Failed to run %s: %s\n", command, err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+// Connects to the controller at its URL if given, otherwise through the
+// apiserver's proxy to its Service using the kubeconfig's credentials.
+func newStatusClient(controllerUrl string, namespace string, service string, kubeconfig string, kubeContext string) (*client.Client, error) {
+	if controllerUrl != "" {
+		return client.New(controllerUrl), nil
+	}
+
+	restConfig, err := kubernetes.RestConfig(kubernetes.ClientOptions{
+		Kubeconfig: kubeconfig,
+		Context:    kubeContext,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpClient, err := rest.HTTPClientFor(restConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	proxyUrl, err := url.JoinPath(restConfig.Host, "api/v1/namespaces", namespace, "services", service+":http", "proxy")
+	if err != nil {
+		return nil, err
+	}
+
+	statusClient := client.New(proxyUrl)
+	statusClient.HTTPClient = httpClient
+
+	return statusClient, nil
+}
+
+func status(ctx context.Context, statusClient *client.Client, stdout io.Writer) error {
+	explanation, err := statusClient.Explain(ctx)
+	if err != nil {
+		return err
+	}
+
+	scaleEvents, err := statusClient.ScaleEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, assessment := range []struct {
+		name string
+		client.Assessment
+	}{
+		{"Scale up", explanation.ScaleUp},
+		{"Scale down", explanation.ScaleDown},
+	} {
+		if assessment.Assessed.IsZero() {
+			fmt.Fprintf(stdout, "%s: not yet assessed\n", assessment.name)
+			continue
+		}
+
+		fmt.Fprintf(stdout, "%s: %s (%s ago)\n", assessment.name, assessment.Decision, since(assessment.Assessed))
+		for _, reason := range assessment.Reasons {
+			fmt.Fprintf(stdout, "  %s\n", reason)
+		}
+	}
+
+	if len(scaleEvents) == 0 {
+		return nil
+	}
+
+	fmt.Fprintln(stdout)
+	w := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NODE\tCLASS\tSTATE\tUPDATED\tREASON")
+	for _, scaleEvent := range scaleEvents {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", scaleEvent.NodeName, orNone(scaleEvent.NodeClass), scaleEvent.State, since(scaleEvent.Updated), scaleEvent.Reason)
+	}
+
+	return w.Flush()
+}
+
+func nodes(ctx context.Context, statusClient *client.Client, stdout io.Writer) error {
+	kpNodes, err := statusClient.KpNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCLASS\tSTATUS\tVMID\tHOST\tVM STATUS\tCPU\tMEMORY\tAGE")
+	for _, kpNode := range kpNodes {
+		nodeStatus := "NotReady"
+		if kpNode.Ready {
+			nodeStatus = "Ready"
+		}
+
+		if kpNode.Cordoned {
+			nodeStatus += ",SchedulingDisabled"
+		}
+
+		vmID := "<none>"
+		if kpNode.VmID != 0 {
+			vmID = fmt.Sprint(kpNode.VmID)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%g\t%dMi\t%s\n",
+			kpNode.Name,
+			kpNode.NodeClass,
+			nodeStatus,
+			vmID,
+			orNone(kpNode.Host),
+			orNone(kpNode.VmStatus),
+			kpNode.Cpu,
+			kpNode.Memory>>20,
+			since(kpNode.Created),
+		)
+	}
+
+	return w.Flush()
+}
+
+func scaleUp(ctx context.Context, statusClient *client.Client, nodeClass string, stdout io.Writer) error {
+	scaleEvent, err := statusClient.ScaleUp(ctx, nodeClass)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Requested scale up of %s (%s)\n", scaleEvent.NodeName, scaleEvent.NodeClass)
+	return nil
+}
+
+func drain(ctx context.Context, statusClient *client.Client, kpNodeName string, stdout io.Writer) error {
+	scaleEvent, err := statusClient.Drain(ctx, kpNodeName)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Requested drain and removal of %s\n", scaleEvent.NodeName)
+	return nil
+}
+
+// Lists the kpNodes and asks for the number of them to be typed to confirm
+// their evacuation, which the controller checks against its own count.
+func evacuate(ctx context.Context, statusClient *client.Client, timeout time.Duration, yes bool, stdin io.Reader, stdout io.Writer) error {
+	kpNodes, err := statusClient.KpNodes(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(kpNodes) == 0 {
+		return errors.New("there are no kpNodes")
+	}
+
+	confirm := len(kpNodes)
+	if !yes {
+		fmt.Fprintf(stdout, "The following %d kpNodes will be drained and removed one at a time, with autoscaling suspended until they are gone:\n", len(kpNodes))
+		for _, kpNode := range kpNodes {
+			fmt.Fprintf(stdout, "  %s\n", kpNode.Name)
+		}
+		fmt.Fprint(stdout, "Type the number of kpNodes to confirm: ")
+
+		answer, _ := bufio.NewReader(stdin).ReadString('\n')
+		confirm, err = strconv.Atoi(strings.TrimSpace(answer))
+		if err != nil || confirm != len(kpNodes) {
+			return errors.New("not confirmed")
+		}
+	}
+
+	// Confirming may have outlasted the request timeout
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	_, err = statusClient.Evacuate(ctx, confirm)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(stdout, "Evacuating %d kpNodes, follow the progress with \"kubectl kproximate evacuate status\"\n", confirm)
+	return nil
+}
+
+func evacuationStatus(ctx context.Context, statusClient *client.Client, stdout io.Writer) error {
+	evacuation, err := statusClient.Evacuation(ctx)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case evacuation.Started.IsZero():
+		fmt.Fprintln(stdout, "No evacuation has been started")
+		return nil
+	case evacuation.Active:
+		fmt.Fprintf(stdout, "Evacuating since %s ago, removing %s\n", since(evacuation.Started), orNone(evacuation.Current))
+	case evacuation.Cancelled:
+		fmt.Fprintf(stdout, "Evacuation cancelled %s ago\n", since(evacuation.Finished))
+	default:
+		fmt.Fprintf(stdout, "Evacuation finished %s ago\n", since(evacuation.Finished))
+	}
+
+	fmt.Fprintf(stdout, "Evacuated: %s\n", orNone(strings.Join(evacuation.Evacuated, ", ")))
+	fmt.Fprintf(stdout, "Remaining: %s\n", orNone(strings.Join(evacuation.Remaining, ", ")))
+	fmt.Fprintf(stdout, "Failed: %s\n", orNone(strings.Join(evacuation.Failed, ", ")))
+
+	return nil
+}
+
+func cancelEvacuation(ctx context.Context, statusClient *client.Client, stdout io.Writer) error {
+	err := statusClient.CancelEvacuation(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "Cancelled the evacuation, the kpNode being removed will still be removed")
+	return nil
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+
+	return value
+}
+
+// The time since t rounded for display, as kubectl shows ages.
+func since(t time.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+
+	age := time.Since(t)
+	switch {
+	case age < time.Minute*2:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour*2:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < time.Hour*48:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
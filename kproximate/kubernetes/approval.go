@@ -0,0 +1,101 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ScaleDownProposals are generated by the controller for each scale down
+// awaiting approval when scaleDownApproval is set, named after the kpNode
+// proposed for removal.
+var ScaleDownProposalResource = schema.GroupVersionResource{
+	Group:    "kproximate.io",
+	Version:  "v1alpha1",
+	Resource: "scaledownproposals",
+}
+
+// Annotating a ScaleDownProposal with this annotation set to "true" approves
+// the removal of its kpNode.
+const ScaleDownApprovedAnnotation = "kproximate.io/scale-down-approved"
+
+type ScaleDownProposal struct {
+	// The kpNode proposed for removal
+	Name     string
+	Reason   string
+	Proposed time.Time
+	Approved bool
+}
+
+func scaleDownProposalFromUnstructured(obj unstructured.Unstructured) ScaleDownProposal {
+	reason, _, _ := unstructured.NestedString(obj.Object, "spec", "reason")
+	proposed, _, _ := unstructured.NestedString(obj.Object, "spec", "proposed")
+	proposedTime, _ := time.Parse(time.RFC3339, proposed)
+
+	return ScaleDownProposal{
+		Name:     obj.GetName(),
+		Reason:   reason,
+		Proposed: proposedTime,
+		Approved: obj.GetAnnotations()[ScaleDownApprovedAnnotation] == "true",
+	}
+}
+
+func (k *KubernetesClient) GetScaleDownProposals(ctx context.Context) ([]ScaleDownProposal, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	list, err := k.dynamicClient.Resource(ScaleDownProposalResource).List(rctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	proposals := []ScaleDownProposal{}
+	for _, obj := range list.Items {
+		proposals = append(proposals, scaleDownProposalFromUnstructured(obj))
+	}
+
+	return proposals, nil
+}
+
+func (k *KubernetesClient) CreateScaleDownProposal(ctx context.Context, proposal ScaleDownProposal) error {
+	obj := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": ScaleDownProposalResource.GroupVersion().String(),
+			"kind":       "ScaleDownProposal",
+			"metadata": map[string]interface{}{
+				"name": proposal.Name,
+			},
+			"spec": map[string]interface{}{
+				"reason":   proposal.Reason,
+				"proposed": proposal.Proposed.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	_, err := k.dynamicClient.Resource(ScaleDownProposalResource).Create(rctx, obj, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create scale down proposal %s: %w", proposal.Name, err)
+	}
+
+	return nil
+}
+
+func (k *KubernetesClient) DeleteScaleDownProposal(ctx context.Context, name string) error {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	err := k.dynamicClient.Resource(ScaleDownProposalResource).Delete(rctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete scale down proposal %s: %w", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Authenticates the bearer token with a TokenReview and, when it is valid,
+// asks the apiserver whether its user may use the verb, e.g. "get" or "post",
+// on the non-resource path with a SubjectAccessReview. Returns the name of
+// the token's user, which is empty if the token is not valid.
+func (k *KubernetesClient) ReviewAccess(ctx context.Context, token string, path string, verb string) (string, bool, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	tokenReview, err := k.client.AuthenticationV1().TokenReviews().Create(
+		rctx,
+		&authenticationv1.TokenReview{
+			Spec: authenticationv1.TokenReviewSpec{Token: token},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to review token: %w", err)
+	}
+
+	if !tokenReview.Status.Authenticated {
+		return "", false, nil
+	}
+
+	user := tokenReview.Status.User
+
+	extra := map[string]authorizationv1.ExtraValue{}
+	for key, values := range user.Extra {
+		extra[key] = authorizationv1.ExtraValue(values)
+	}
+
+	accessReview, err := k.client.AuthorizationV1().SubjectAccessReviews().Create(
+		rctx,
+		&authorizationv1.SubjectAccessReview{
+			Spec: authorizationv1.SubjectAccessReviewSpec{
+				User:   user.Username,
+				UID:    user.UID,
+				Groups: user.Groups,
+				Extra:  extra,
+				NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+					Path: path,
+					Verb: verb,
+				},
+			},
+		},
+		metav1.CreateOptions{},
+	)
+	if err != nil {
+		return user.Username, false, fmt.Errorf("failed to review access of %s: %w", user.Username, err)
+	}
+
+	return user.Username, accessReview.Status.Allowed, nil
+}
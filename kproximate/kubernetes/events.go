@@ -0,0 +1,46 @@
+package kubernetes
+
+import (
+	"context"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const eventSource = "kproximate-controller"
+
+// Records a Kubernetes Event against a pod, usually the controller's own, so
+// that conditions affecting all scaling are visible with "kubectl get events".
+func (k *KubernetesClient) RecordPodEvent(ctx context.Context, namespace string, podName string, eventType string, reason string, message string) error {
+	now := metav1.NewTime(time.Now())
+
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	_, err := k.client.CoreV1().Events(namespace).Create(
+		rctx,
+		&apiv1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				GenerateName: podName + ".",
+				Namespace:    namespace,
+			},
+			InvolvedObject: apiv1.ObjectReference{
+				APIVersion: "v1",
+				Kind:       "Pod",
+				Namespace:  namespace,
+				Name:       podName,
+			},
+			Reason:         reason,
+			Message:        message,
+			Type:           eventType,
+			Source:         apiv1.EventSource{Component: eventSource},
+			FirstTimestamp: now,
+			LastTimestamp:  now,
+			Count:          1,
+		},
+		metav1.CreateOptions{},
+	)
+
+	return err
+}
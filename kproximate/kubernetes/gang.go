@@ -0,0 +1,105 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Pods with the same value of this annotation in a namespace are a gang,
+// which must all be scheduled before any of them can make progress
+const GangAnnotation = "kproximate.io/gang"
+
+// The pod group label and annotation of the scheduler-plugins coscheduling
+// plugin, and the labels of JobSet and Job pods
+const (
+	podGroupLabel = "scheduling.x-k8s.io/pod-group"
+	jobSetLabel   = "jobset.sigs.k8s.io/jobset-name"
+	jobNameLabel  = "batch.kubernetes.io/job-name"
+)
+
+// Returns the gang the pod belongs to, or an empty string if it belongs to
+// none. An explicit gang annotation or pod group takes precedence over the
+// JobSet or Job the pod was created by.
+func podGang(pod apiv1.Pod) string {
+	if gang, ok := pod.Annotations[GangAnnotation]; ok && gang != "" {
+		return gang
+	}
+
+	for _, podGroup := range []string{pod.Labels[podGroupLabel], pod.Annotations[podGroupLabel]} {
+		if podGroup != "" {
+			return fmt.Sprintf("podgroup/%s", podGroup)
+		}
+	}
+
+	if jobSet := pod.Labels[jobSetLabel]; jobSet != "" {
+		return fmt.Sprintf("jobset/%s", jobSet)
+	}
+
+	if job := pod.Labels[jobNameLabel]; job != "" {
+		return fmt.Sprintf("job/%s", job)
+	}
+
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "Job" && owner.Controller != nil && *owner.Controller {
+			return fmt.Sprintf("job/%s", owner.Name)
+		}
+	}
+
+	return ""
+}
+
+// Whether the pod is waiting to be scheduled, whether or not the scheduler
+// has tried to schedule it yet.
+func isPendingUnscheduled(pod apiv1.Pod) bool {
+	return pod.Status.Phase == apiv1.PodPending && pod.Spec.NodeName == "" && pod.DeletionTimestamp == nil
+}
+
+// Records the gang of a pod no kpNode could satisfy.
+func markUnsatisfiableGang(unsatisfiable map[string]bool, pod apiv1.Pod) {
+	if gang := podGang(pod); gang != "" {
+		unsatisfiable[pod.Namespace+"/"+gang] = true
+	}
+}
+
+// Adds the pending pods of each gang with an unschedulable pod to the
+// unschedulable pods with the whole of their requests, so that enough
+// kpNodes for the entire gang are scaled up for at once. Members the
+// scheduler has not yet tried, or rejected while waiting for the rest of
+// their gang, would otherwise only be scaled up for one poll at a time,
+// leaving part of the gang scheduled and waiting on the rest. Gangs with a
+// member no kpNode could satisfy are not scaled up for at all.
+func withPendingGangMembers(pods []apiv1.Pod, unschedulablePods []UnschedulablePod, unsatisfiable map[string]bool) []UnschedulablePod {
+	gangs := map[string]bool{}
+	listed := map[string]bool{}
+	for _, pod := range unschedulablePods {
+		listed[pod.Namespace+"/"+pod.Name] = true
+		if pod.Gang != "" {
+			gangs[pod.Namespace+"/"+pod.Gang] = true
+		}
+	}
+
+	for _, pod := range pods {
+		gang := podGang(pod)
+		if gang == "" || !gangs[pod.Namespace+"/"+gang] || listed[pod.Namespace+"/"+pod.Name] || !isPendingUnscheduled(pod) {
+			continue
+		}
+
+		unschedulablePods = append(unschedulablePods, newUnschedulablePod(pod, PodRequests(pod)))
+	}
+
+	if len(unsatisfiable) == 0 {
+		return unschedulablePods
+	}
+
+	satisfiable := []UnschedulablePod{}
+	for _, pod := range unschedulablePods {
+		if pod.Gang != "" && unsatisfiable[pod.Namespace+"/"+pod.Gang] {
+			continue
+		}
+
+		satisfiable = append(satisfiable, pod)
+	}
+
+	return satisfiable
+}
@@ -0,0 +1,48 @@
+package kubernetes
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Taints which are only present while a node initialises
+var initTaints = []string{
+	StartupTaintKey,
+	"node.cloudprovider.kubernetes.io/uninitialized",
+	apiv1.TaintNodeNetworkUnavailable,
+}
+
+// The kubelet reports the ready condition of a node shortly after it
+// registers, a node whose condition last changed within this window of
+// registering has never been ready
+const nodeRegistrationWindow = time.Minute * 2
+
+// Why the node has not become schedulable since it registered, e.g. because
+// its CNI failed to start, or an empty string if it has. Nodes which were
+// ready before and are now unready, e.g. while their pHost is unreachable,
+// have not failed to initialise.
+func NodeInitFailure(node apiv1.Node) string {
+	for _, taint := range node.Spec.Taints {
+		if slices.Contains(initTaints, taint.Key) {
+			return fmt.Sprintf("still has the %s taint", taint.Key)
+		}
+	}
+
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != apiv1.NodeReady {
+			continue
+		}
+
+		if condition.Status == apiv1.ConditionTrue || condition.LastTransitionTime.Sub(node.CreationTimestamp.Time) > nodeRegistrationWindow {
+			return ""
+		}
+
+		_, observed := nodeReadyCondition(&node)
+		return fmt.Sprintf("has not been ready since it registered, %s", observed)
+	}
+
+	return "has never reported a Ready condition"
+}
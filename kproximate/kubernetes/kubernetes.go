@@ -1,13 +1,13 @@
 package kubernetes
 
 import (
+	"cmp"
 	"context"
 	"errors"
-	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
+	"maps"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -15,142 +15,477 @@ import (
 	apiv1 "k8s.io/api/core/v1"
 	policyv1 "k8s.io/api/policy/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
 	"k8s.io/client-go/util/retry"
 )
 
-type Kubernetes interface {
-	GetUnschedulableResources(kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error)
-	IsUnschedulableDueToControlPlaneTaint() (bool, error)
-	GetWorkerNodes() ([]apiv1.Node, error)
-	GetWorkerNodesAllocatableResources() (WorkerNodesAllocatableResources, error)
-	GetKpNodes(kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error)
-	LabelKpNode(kpNodeName string, kpNodeLabels map[string]string) error
-	GetKpNodesAllocatedResources(kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error)
-	CheckForNodeJoin(ctx context.Context, ok chan<- bool, newKpNodeName string)
+// The operations the controller uses to assess scaling, which need only the
+// permissions of ControllerRules.
+type ControllerKubernetes interface {
+	GetUnschedulableResources(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error)
+	GetUnschedulablePods(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) ([]UnschedulablePod, error)
+	IsUnschedulableDueToControlPlaneTaint(ctx context.Context) (bool, error)
+	GetVolumeTopologyConflicts(ctx context.Context) ([]VolumeTopology, error)
+	GetWorkerNodes(ctx context.Context) ([]apiv1.Node, error)
+	GetWorkerNodesAllocatableResources(ctx context.Context) (WorkerNodesAllocatableResources, error)
+	GetKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error)
+	GetKpNodesAllocatedResources(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error)
+	GetKpNodesUsage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error)
+	GetEmptyKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]string, error)
+	GetKpNodesWithLocalStorage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]string, error)
+	WatchUnschedulablePods(ctx context.Context, unschedulable chan<- struct{})
+	WatchWorkloadShrinkage(ctx context.Context, minPods int, shrunk chan<- struct{})
+	StartInformers(ctx context.Context, resync time.Duration) error
+	GetNodePools(ctx context.Context) ([]NodePool, error)
+	UpdateNodePoolStatus(ctx context.Context, name string, status NodePoolStatus) error
+	RecordPodEvent(ctx context.Context, namespace string, podName string, eventType string, reason string, message string) error
+	EnsureOverprovisioning(ctx context.Context, overprovisioning Overprovisioning) error
+	GetScaleDownProposals(ctx context.Context) ([]ScaleDownProposal, error)
+	CreateScaleDownProposal(ctx context.Context, proposal ScaleDownProposal) error
+	DeleteScaleDownProposal(ctx context.Context, name string) error
+}
+
+// The operations workers use to add and remove kpNodes, which need the
+// permissions of WorkerRules.
+type WorkerKubernetes interface {
+	CheckForNodeJoin(ctx context.Context, newKpNodeName string) error
+	LabelKpNode(ctx context.Context, kpNodeName string, kpNodeLabels map[string]string) error
+	UntaintKpNode(ctx context.Context, kpNodeName string) error
+	CordonKpNode(ctx context.Context, kpNodeName string) error
+	UncordonKpNode(ctx context.Context, kpNodeName string) error
+	DrainKpNode(ctx context.Context, kpNodeName string) error
+	AnnotateKpNode(ctx context.Context, kpNodeName string, annotations map[string]string) error
 	DeleteKpNode(ctx context.Context, kpNodeName string) error
+	GetSecretData(ctx context.Context, namespace string, name string) (map[string]string, error)
+}
+
+type Kubernetes interface {
+	ControllerKubernetes
+	WorkerKubernetes
 }
 
 type KubernetesClient struct {
 	client kubernetes.Interface
+	// Used for kproximate's custom resources
+	dynamicClient dynamic.Interface
+	// Set once StartInformers has synced, until then nodes and pods are
+	// listed from the apiserver
+	nodeLister corelisters.NodeLister
+	podIndexer cache.Indexer
+	// Bounds each request to the apiserver, 0 leaves them unbounded
+	requestTimeout time.Duration
+	drain          DrainOptions
+}
+
+// How pods are removed from a kpNode before it is deleted.
+type DrainOptions struct {
+	// Overrides the termination grace period of evicted pods, 0 keeps each
+	// pod's own
+	GracePeriod time.Duration
+	// Evicted pods still terminating after this long are force deleted so a
+	// broken workload can't hold up the drain, 0 never force deletes
+	ForceDeleteTimeout time.Duration
 }
 
 type UnschedulableResources struct {
 	Cpu    float64
 	Memory int64
+	// Extended resources such as nvidia.com/gpu or hugepages-2Mi, by name
+	Extended map[string]int64 `json:",omitempty"`
+}
+
+// A pending pod and the resources it could not be scheduled for.
+type UnschedulablePod struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+	UnschedulableResources
+	// The scheduling constraints of the pod which a new node must satisfy
+	NodeSelector map[string]string   `json:"nodeSelector,omitempty"`
+	NodeAffinity *apiv1.NodeSelector `json:"nodeAffinity,omitempty"`
+	Tolerations  []apiv1.Toleration  `json:"tolerations,omitempty"`
+	// Matched by routing rules
+	Labels            map[string]string `json:"labels,omitempty"`
+	PriorityClassName string            `json:"priorityClassName,omitempty"`
+	// The gang the pod belongs to, e.g. its Job, which is scaled up for as a
+	// whole, see GangAnnotation
+	Gang string `json:"gang,omitempty"`
 }
 
+// The node label values a pending pod's volumes are restricted to, a node
+// must have one of the values for every key.
+type VolumeTopology map[string][]string
+
 type WorkerNodesAllocatableResources struct {
-	Cpu    int64
-	Memory int64
+	Cpu      int64
+	Memory   int64
+	Extended map[string]int64
 }
 
 type AllocatedResources struct {
-	Cpu    float64
-	Memory float64
+	Cpu      float64
+	Memory   float64
+	Extended map[string]int64
 }
 
-func NewKubernetesClient() (KubernetesClient, error) {
-	var kubeconfig *string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = flag.String("kubeconfig", filepath.Join(home, ".kube", "config"), "(optional) absolute path to the kubeconfig file")
-		flag.Parse()
-	}
+// How to connect to the apiserver.
+type ClientOptions struct {
+	// The kubeconfig file, $KUBECONFIG or ~/.kube/config are used when empty,
+	// falling back to the pod's service account if neither exist
+	Kubeconfig string
+	// The kubeconfig context, its current context is used when empty
+	Context string
+	// Use the pod's service account even if a kubeconfig is found
+	InCluster bool
+	// Client-side rate limits on requests to the apiserver, client-go's
+	// defaults are used when 0
+	QPS   float32
+	Burst int
+	// Bounds each request to the apiserver, 0 leaves them unbounded
+	RequestTimeout time.Duration
+	Drain          DrainOptions
+}
 
+// Returns the rest config for the options.
+func RestConfig(options ClientOptions) (*rest.Config, error) {
 	var config *rest.Config
+	var err error
 
-	if _, err := os.Stat(*kubeconfig); err == nil {
-		config, err = clientcmd.BuildConfigFromFlags("", *kubeconfig)
-		if err != nil {
-			return KubernetesClient{}, err
-		}
-	} else {
+	if options.InCluster {
 		config, err = rest.InClusterConfig()
-		if err != nil {
-			panic(err.Error())
+	} else {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = options.Kubeconfig
+
+		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+			loadingRules,
+			&clientcmd.ConfigOverrides{CurrentContext: options.Context},
+		).ClientConfig()
+
+		if clientcmd.IsEmptyConfig(err) && options.Kubeconfig == "" && options.Context == "" {
+			config, err = rest.InClusterConfig()
 		}
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	if options.QPS > 0 {
+		config.QPS = options.QPS
+	}
+
+	if options.Burst > 0 {
+		config.Burst = options.Burst
+	}
+
+	return config, nil
+}
+
+func NewKubernetesClient(options ClientOptions) (KubernetesClient, error) {
+	config, err := RestConfig(options)
+	if err != nil {
+		return KubernetesClient{}, err
+	}
 
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		panic(err.Error())
+		return KubernetesClient{}, err
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return KubernetesClient{}, err
 	}
 
 	kubernetes := KubernetesClient{
-		client: clientset,
+		client:         clientset,
+		dynamicClient:  dynamicClient,
+		requestTimeout: options.RequestTimeout,
+		drain:          options.Drain,
 	}
 
 	return kubernetes, nil
 }
 
+// Derives the context of a single request to the apiserver from the caller's,
+// so that a hung apiserver can't stall the caller for longer than the
+// request timeout.
+func (k *KubernetesClient) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if k.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, k.requestTimeout)
+}
+
+// Indexes cached pods by the node they are bound to
+const podNodeNameIndex = "spec.nodeName"
+
+func podNodeName(obj interface{}) ([]string, error) {
+	pod, ok := obj.(*apiv1.Pod)
+	if !ok || pod.Spec.NodeName == "" {
+		return []string{}, nil
+	}
+
+	return []string{pod.Spec.NodeName}, nil
+}
+
+// Managed fields are never read and can make up a large part of each cached
+// object
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+
+	return obj, nil
+}
+
+// Starts a shared informer cache of nodes and pods which is used in place of
+// listing them from the apiserver on every assessment. Blocks until the cache
+// has synced.
+func (k *KubernetesClient) StartInformers(ctx context.Context, resync time.Duration) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		k.client,
+		resync,
+		informers.WithTransform(stripManagedFields),
+	)
+
+	// Informers must be requested before the factory is started
+	nodeLister := factory.Core().V1().Nodes().Lister()
+	podInformer := factory.Core().V1().Pods().Informer()
+
+	err := podInformer.AddIndexers(cache.Indexers{podNodeNameIndex: podNodeName})
+	if err != nil {
+		return err
+	}
+
+	factory.Start(ctx.Done())
+
+	for informerType, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			return fmt.Errorf("failed to sync %s informer", informerType)
+		}
+	}
+
+	k.nodeLister = nodeLister
+	k.podIndexer = podInformer.GetIndexer()
+
+	return nil
+}
+
+func (k *KubernetesClient) listNodes(ctx context.Context, selector labels.Selector) ([]apiv1.Node, error) {
+	if k.nodeLister == nil {
+		rctx, cancel := k.requestContext(ctx)
+		defer cancel()
+
+		nodes, err := k.client.CoreV1().Nodes().List(
+			rctx,
+			metav1.ListOptions{
+				LabelSelector: selector.String(),
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return nodes.Items, nil
+	}
+
+	cachedNodes, err := k.nodeLister.List(selector)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]apiv1.Node, 0, len(cachedNodes))
+	for _, node := range cachedNodes {
+		nodes = append(nodes, *node)
+	}
+
+	return nodes, nil
+}
+
+func (k *KubernetesClient) listPodsOnNode(ctx context.Context, nodeName string) ([]apiv1.Pod, error) {
+	if k.podIndexer == nil {
+		rctx, cancel := k.requestContext(ctx)
+		defer cancel()
+
+		pods, err := k.client.CoreV1().Pods("").List(
+			rctx,
+			metav1.ListOptions{
+				FieldSelector: fmt.Sprintf("spec.nodeName=%s", nodeName),
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		return pods.Items, nil
+	}
+
+	cachedPods, err := k.podIndexer.ByIndex(podNodeNameIndex, nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	pods := make([]apiv1.Pod, 0, len(cachedPods))
+	for _, obj := range cachedPods {
+		if pod, ok := obj.(*apiv1.Pod); ok {
+			pods = append(pods, *pod)
+		}
+	}
+
+	return pods, nil
+}
+
 func isUnschedulable(condition apiv1.PodCondition) bool {
 	return condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse && condition.Reason == apiv1.PodReasonUnschedulable
 }
 
-func (k *KubernetesClient) GetUnschedulableResources(kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error) {
-	var rCpu float64
-	var rMemory float64
+// How long to wait before re-establishing a watch, doubling while watches
+// fail or close without delivering any events
+const (
+	minRewatchBackoff = time.Second
+	maxRewatchBackoff = time.Second * 30
+)
+
+// Signals on unschedulable whenever a pod is added or updated and fails to
+// schedule, until the context is done. Signals are dropped while a previous
+// signal is still waiting to be received.
+func (k *KubernetesClient) WatchUnschedulablePods(ctx context.Context, unschedulable chan<- struct{}) {
+	backoff := minRewatchBackoff
+	for ctx.Err() == nil {
+		watcher, err := k.client.CoreV1().Pods("").Watch(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("status.phase", string(apiv1.PodPending)).String(),
+		})
+		if err != nil {
+			logger.WarnLog("Failed to watch pods", "error", err)
+		} else {
+			if signalUnschedulablePods(watcher.ResultChan(), unschedulable) {
+				backoff = minRewatchBackoff
+			}
+			watcher.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRewatchBackoff)
+	}
+}
+
+// Signals for each added or modified pod which has failed to schedule until
+// the events are closed, returning whether any events were received.
+func signalUnschedulablePods(events <-chan watch.Event, unschedulable chan<- struct{}) bool {
+	received := false
+	for event := range events {
+		received = true
+
+		if event.Type != watch.Added && event.Type != watch.Modified {
+			continue
+		}
+
+		pod, ok := event.Object.(*apiv1.Pod)
+		if !ok || pod.Spec.NodeName != "" || !slices.ContainsFunc(pod.Status.Conditions, isUnschedulable) {
+			continue
+		}
+
+		select {
+		case unschedulable <- struct{}{}:
+		default:
+		}
+	}
+
+	return received
+}
+
+func (k *KubernetesClient) GetUnschedulableResources(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error) {
+	pods, err := k.GetUnschedulablePods(ctx, kpNodeCores, kpNodeNameRegex)
+	if err != nil {
+		return UnschedulableResources{}, err
+	}
+
+	return SumUnschedulableResources(pods), nil
+}
+
+// Returns the resources each pending pod could not be scheduled for, pods
+// requesting more than a kpNode could provide are ignored.
+func (k *KubernetesClient) GetUnschedulablePods(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) ([]UnschedulablePod, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
 
 	pods, err := k.client.CoreV1().Pods("").List(
-		context.TODO(),
+		rctx,
 		metav1.ListOptions{},
 	)
 	if err != nil {
-		return UnschedulableResources{}, err
+		return nil, err
 	}
 
-	maxAllocatableMemoryForSinglePod, err := k.getMaxAllocatableMemoryForSinglePod(kpNodeNameRegex)
+	maxAllocatableMemoryForSinglePod, err := k.getMaxAllocatableMemoryForSinglePod(ctx, kpNodeNameRegex)
 	if err != nil {
-		return UnschedulableResources{}, err
+		return nil, err
 	}
 
-PODLOOP:
-	for _, pod := range pods.Items {
-		for _, condition := range pod.Status.Conditions {
-			if isUnschedulable(condition) {
-				if strings.Contains(condition.Message, "Insufficient cpu") {
-					for _, container := range pod.Spec.Containers {
-						if container.Resources.Requests.Cpu().CmpInt64(kpNodeCores) >= 0 {
-							logger.WarnLog(fmt.Sprintf("Ignoring pod (%s) with unsatisfiable Cpu request: %f", pod.Name, container.Resources.Requests.Cpu().AsApproximateFloat64()))
-							continue PODLOOP
-						}
-
-						rCpu += container.Resources.Requests.Cpu().AsApproximateFloat64()
-					}
-				}
+	unschedulablePods := []UnschedulablePod{}
+	// Gangs with a member no kpNode could satisfy
+	unsatisfiable := map[string]bool{}
 
-				if strings.Contains(condition.Message, "Insufficient memory") {
-					for _, container := range pod.Spec.Containers {
-						if container.Resources.Requests.Memory().AsApproximateFloat64() >= maxAllocatableMemoryForSinglePod {
-							logger.WarnLog(fmt.Sprintf("Ignoring pod (%s) with unsatisfiable Memory request: %f", pod.Name, container.Resources.Requests.Memory().AsApproximateFloat64()))
-							continue PODLOOP
-						}
+	for _, pod := range pods.Items {
+		resources, err := PodUnschedulableResources(pod, kpNodeCores, maxAllocatableMemoryForSinglePod)
+		if err != nil {
+			logger.WarnLog(fmt.Sprintf("Ignoring pod (%s) with %s", pod.Name, err))
+			markUnsatisfiableGang(unsatisfiable, pod)
+			continue
+		}
 
-						rMemory += container.Resources.Requests.Memory().AsApproximateFloat64()
-					}
-				}
-			}
+		if resources.IsZero() {
+			continue
 		}
+
+		unschedulablePods = append(unschedulablePods, newUnschedulablePod(pod, resources))
 	}
 
-	unschedulableResources := UnschedulableResources{
-		Cpu:    rCpu,
-		Memory: int64(rMemory),
+	return withPendingGangMembers(pods.Items, unschedulablePods, unsatisfiable), nil
+}
+
+func newUnschedulablePod(pod apiv1.Pod, resources UnschedulableResources) UnschedulablePod {
+	var nodeAffinity *apiv1.NodeSelector
+	if pod.Spec.Affinity != nil && pod.Spec.Affinity.NodeAffinity != nil {
+		nodeAffinity = pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
 	}
 
-	return unschedulableResources, err
+	return UnschedulablePod{
+		Namespace:              pod.Namespace,
+		Name:                   pod.Name,
+		UnschedulableResources: resources,
+		NodeSelector:           pod.Spec.NodeSelector,
+		NodeAffinity:           nodeAffinity,
+		Tolerations:            pod.Spec.Tolerations,
+		Labels:                 pod.Labels,
+		PriorityClassName:      pod.Spec.PriorityClassName,
+		Gang:                   podGang(pod),
+	}
 }
 
-func (k *KubernetesClient) IsUnschedulableDueToControlPlaneTaint() (bool, error) {
+func (k *KubernetesClient) IsUnschedulableDueToControlPlaneTaint(ctx context.Context) (bool, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
 	pods, err := k.client.CoreV1().Pods("").List(
-		context.TODO(),
+		rctx,
 		metav1.ListOptions{},
 	)
 	if err != nil {
@@ -170,9 +505,106 @@ func (k *KubernetesClient) IsUnschedulableDueToControlPlaneTaint() (bool, error)
 	return false, nil
 }
 
+// Returns the volume topology of pending pods which failed to schedule
+// because no node satisfies the node affinity of their persistent volumes.
+func (k *KubernetesClient) GetVolumeTopologyConflicts(ctx context.Context) ([]VolumeTopology, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	pods, err := k.client.CoreV1().Pods("").List(
+		rctx,
+		metav1.ListOptions{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []VolumeTopology{}
+
+	for _, pod := range pods.Items {
+		for _, condition := range pod.Status.Conditions {
+			if !isUnschedulable(condition) || !strings.Contains(condition.Message, "volume node affinity conflict") {
+				continue
+			}
+
+			topology, err := k.podVolumeTopology(ctx, pod)
+			if err != nil {
+				return nil, err
+			}
+
+			if len(topology) > 0 {
+				conflicts = append(conflicts, topology)
+			}
+		}
+	}
+
+	return conflicts, nil
+}
+
+// Combines the node affinity of the persistent volumes bound to a pod's
+// claims. Only the first node selector term of each volume is considered.
+func (k *KubernetesClient) podVolumeTopology(ctx context.Context, pod apiv1.Pod) (VolumeTopology, error) {
+	topology := VolumeTopology{}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		rctx, cancel := k.requestContext(ctx)
+		pvc, err := k.client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(
+			rctx,
+			volume.PersistentVolumeClaim.ClaimName,
+			metav1.GetOptions{},
+		)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+
+		rctx, cancel = k.requestContext(ctx)
+		pv, err := k.client.CoreV1().PersistentVolumes().Get(rctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+
+		if pv.Spec.NodeAffinity == nil || pv.Spec.NodeAffinity.Required == nil || len(pv.Spec.NodeAffinity.Required.NodeSelectorTerms) == 0 {
+			continue
+		}
+
+		for _, expression := range pv.Spec.NodeAffinity.Required.NodeSelectorTerms[0].MatchExpressions {
+			if expression.Operator != apiv1.NodeSelectorOpIn {
+				continue
+			}
+
+			existing, ok := topology[expression.Key]
+			if !ok {
+				topology[expression.Key] = expression.Values
+				continue
+			}
+
+			// Every volume must be satisfied by the same node
+			values := []string{}
+			for _, value := range existing {
+				if slices.Contains(expression.Values, value) {
+					values = append(values, value)
+				}
+			}
+			topology[expression.Key] = values
+		}
+	}
+
+	return topology, nil
+}
+
 // Worker nodes should comprise of all kpNodes and any additional worker nodes
 // in the cluster that are not managed by kproximate
-func (k *KubernetesClient) GetWorkerNodes() ([]apiv1.Node, error) {
+func (k *KubernetesClient) GetWorkerNodes(ctx context.Context) ([]apiv1.Node, error) {
 	noControlPlaneLabel, err := labels.NewRequirement(
 		"node-role.kubernetes.io/control-plane",
 		selection.DoesNotExist,
@@ -196,18 +628,13 @@ func (k *KubernetesClient) GetWorkerNodes() ([]apiv1.Node, error) {
 		*noMasterLabel,
 	)
 
-	nodes, err := k.client.CoreV1().Nodes().List(
-		context.TODO(),
-		metav1.ListOptions{
-			LabelSelector: labelSelector.String(),
-		},
-	)
+	nodes, err := k.listNodes(ctx, labelSelector)
 	if err != nil {
 		return nil, err
 	}
 
 	workerNodes := []apiv1.Node{}
-	for _, node := range nodes.Items {
+	for _, node := range nodes {
 		for _, condition := range node.Status.Conditions {
 			if condition.Type == apiv1.NodeReady && condition.Status == apiv1.ConditionTrue {
 				workerNodes = append(workerNodes, node)
@@ -218,23 +645,17 @@ func (k *KubernetesClient) GetWorkerNodes() ([]apiv1.Node, error) {
 	return workerNodes, err
 }
 
-func (k *KubernetesClient) GetWorkerNodesAllocatableResources() (WorkerNodesAllocatableResources, error) {
-	var workerNodesAllocatableResources WorkerNodesAllocatableResources
-	workerNodes, err := k.GetWorkerNodes()
+func (k *KubernetesClient) GetWorkerNodesAllocatableResources(ctx context.Context) (WorkerNodesAllocatableResources, error) {
+	workerNodes, err := k.GetWorkerNodes(ctx)
 	if err != nil {
-		return workerNodesAllocatableResources, err
+		return WorkerNodesAllocatableResources{}, err
 	}
 
-	for _, workerNode := range workerNodes {
-		workerNodesAllocatableResources.Cpu += int64(workerNode.Status.Allocatable.Cpu().AsApproximateFloat64())
-		workerNodesAllocatableResources.Memory += int64(workerNode.Status.Allocatable.Memory().AsApproximateFloat64())
-	}
-
-	return workerNodesAllocatableResources, err
+	return NodesAllocatableResources(workerNodes), nil
 }
 
-func (k *KubernetesClient) GetKpNodes(kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error) {
-	workerNodes, err := k.GetWorkerNodes()
+func (k *KubernetesClient) GetKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error) {
+	workerNodes, err := k.GetWorkerNodes(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -250,8 +671,8 @@ func (k *KubernetesClient) GetKpNodes(kpNodeNameRegex regexp.Regexp) ([]apiv1.No
 	return kpNodes, err
 }
 
-func (k *KubernetesClient) GetKpNodesAllocatedResources(kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
-	kpNodes, err := k.GetKpNodes(kpNodeNameRegex)
+func (k *KubernetesClient) GetKpNodesAllocatedResources(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
+	kpNodes, err := k.GetKpNodes(ctx, kpNodeNameRegex)
 	if err != nil {
 		return nil, err
 	}
@@ -259,51 +680,270 @@ func (k *KubernetesClient) GetKpNodesAllocatedResources(kpNodeNameRegex regexp.R
 	allocatedResources := map[string]AllocatedResources{}
 
 	for _, kpNode := range kpNodes {
-		nodeResources := AllocatedResources{}
+		pods, err := k.listPodsOnNode(ctx, kpNode.Name)
+		if err != nil {
+			return nil, err
+		}
 
-		pods, err := k.client.CoreV1().Pods("").List(
-			context.TODO(),
-			metav1.ListOptions{
-				FieldSelector: fmt.Sprintf("spec.nodeName=%s", kpNode.Name),
-			},
+		allocatedResources[kpNode.Name] = PodsAllocatedResources(pods)
+	}
+
+	return allocatedResources, err
+}
+
+// Pods which are not evicted when a kpNode is drained
+func isNodeBoundPod(pod apiv1.Pod) bool {
+	if _, mirror := pod.Annotations[apiv1.MirrorPodAnnotationKey]; mirror {
+		return true
+	}
+
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Pods annotated like this are evicted from kpNodes being scaled down even
+// if they use local storage, as with the cluster-autoscaler
+const SafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+
+// Returns why the pod's data would be lost if it were evicted, or "" if it
+// uses no hostPath volumes or local PersistentVolumes.
+func (k *KubernetesClient) podLocalStorage(ctx context.Context, pod apiv1.Pod) (string, error) {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.HostPath != nil {
+			return fmt.Sprintf("pod %s/%s uses hostPath volume %s", pod.Namespace, pod.Name, volume.Name), nil
+		}
+
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		rctx, cancel := k.requestContext(ctx)
+		pvc, err := k.client.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(
+			rctx,
+			volume.PersistentVolumeClaim.ClaimName,
+			metav1.GetOptions{},
 		)
+		cancel()
+		if err != nil {
+			return "", err
+		}
+
+		if pvc.Spec.VolumeName == "" {
+			continue
+		}
+
+		rctx, cancel = k.requestContext(ctx)
+		pv, err := k.client.CoreV1().PersistentVolumes().Get(rctx, pvc.Spec.VolumeName, metav1.GetOptions{})
+		cancel()
+		if err != nil {
+			return "", err
+		}
+
+		if pv.Spec.Local != nil || pv.Spec.HostPath != nil {
+			return fmt.Sprintf("pod %s/%s uses local PersistentVolume %s", pod.Namespace, pod.Name, pv.Name), nil
+		}
+	}
+
+	return "", nil
+}
+
+// Returns the kpNodes running pods whose data would be lost if they were
+// evicted, along with why. Pods bound to their node, finished pods and pods
+// annotated safe to evict are ignored.
+func (k *KubernetesClient) GetKpNodesWithLocalStorage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]string, error) {
+	kpNodes, err := k.GetKpNodes(ctx, kpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	localStorage := map[string]string{}
+
+KPNODES:
+	for _, kpNode := range kpNodes {
+		pods, err := k.listPodsOnNode(ctx, kpNode.Name)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, pod := range pods.Items {
-			for _, container := range pod.Spec.Containers {
-				nodeResources.Cpu += container.Resources.Requests.Cpu().AsApproximateFloat64()
-				nodeResources.Memory += container.Resources.Requests.Memory().AsApproximateFloat64()
+		for _, pod := range pods {
+			finished := pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed
+			if finished || isNodeBoundPod(pod) || pod.Annotations[SafeToEvictAnnotation] == "true" {
+				continue
+			}
+
+			reason, err := k.podLocalStorage(ctx, pod)
+			if err != nil {
+				return nil, err
+			}
+
+			if reason != "" {
+				localStorage[kpNode.Name] = reason
+				continue KPNODES
 			}
 		}
+	}
+
+	return localStorage, nil
+}
 
-		allocatedResources[kpNode.Name] = nodeResources
+// Returns the names of kpNodes running no pods other than DaemonSet and
+// static pods, which can be removed without evicting any workloads.
+func (k *KubernetesClient) GetEmptyKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]string, error) {
+	kpNodes, err := k.GetKpNodes(ctx, kpNodeNameRegex)
+	if err != nil {
+		return nil, err
 	}
 
-	return allocatedResources, err
+	emptyKpNodes := []string{}
+
+KPNODES:
+	for _, kpNode := range kpNodes {
+		pods, err := k.listPodsOnNode(ctx, kpNode.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pod := range pods {
+			finished := pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed
+			if !finished && !isNodeBoundPod(pod) {
+				continue KPNODES
+			}
+		}
+
+		emptyKpNodes = append(emptyKpNodes, kpNode.Name)
+	}
+
+	slices.Sort(emptyKpNodes)
+
+	return emptyKpNodes, nil
+}
+
+const (
+	// How long a watch for a joining node is held open before it is
+	// re-established, in case any events were missed
+	nodeJoinResync = time.Second * 30
+	// Bounds for the backoff between attempts to check a joining node
+	nodeJoinMinBackoff = time.Second
+	nodeJoinMaxBackoff = time.Second * 10
+)
+
+// Returns whether a node is ready and a description of its ready condition.
+func nodeReadyCondition(node *apiv1.Node) (bool, string) {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type != apiv1.NodeReady {
+			continue
+		}
+
+		if condition.Status == apiv1.ConditionTrue {
+			return true, "Ready=True"
+		}
+
+		return false, fmt.Sprintf("Ready=%s (%s: %s)", condition.Status, condition.Reason, condition.Message)
+	}
+
+	return false, "node has no Ready condition"
 }
 
-func (k *KubernetesClient) CheckForNodeJoin(ctx context.Context, ok chan<- bool, newKpNodeName string) {
+// Waits for a node to join the cluster and become ready, or for the context
+// to be done. The node is watched for changes, with the watch re-established
+// every nodeJoinResync, and checks back off when the API server cannot be
+// reached. On timeout the returned error describes the node's last observed
+// ready condition.
+func (k *KubernetesClient) CheckForNodeJoin(ctx context.Context, newKpNodeName string) error {
+	lastObserved := "node has not registered"
+	backoff := nodeJoinMinBackoff
+
 	for {
-		newkpNode, _ := k.client.CoreV1().Nodes().Get(
-			context.TODO(),
-			newKpNodeName,
-			metav1.GetOptions{},
-		)
+		rctx, cancel := k.requestContext(ctx)
+		node, err := k.client.CoreV1().Nodes().Get(rctx, newKpNodeName, metav1.GetOptions{})
+		cancel()
+		switch {
+		case err == nil:
+			ready, observed := nodeReadyCondition(node)
+			if ready {
+				return nil
+			}
+			lastObserved = observed
+		case !apierrors.IsNotFound(err) && ctx.Err() == nil:
+			lastObserved = fmt.Sprintf("failed to get node: %s", err)
+		}
 
-		for _, condition := range newkpNode.Status.Conditions {
-			if condition.Type == apiv1.NodeReady && condition.Status == apiv1.ConditionTrue {
-				ok <- true
-				return
+		ready, err := k.watchForNodeReady(ctx, newKpNodeName, &lastObserved)
+		if ready {
+			return nil
+		}
+
+		if err == nil {
+			backoff = nodeJoinMinBackoff
+		} else {
+			logger.DebugLog("Failed to watch joining node", "node", newKpNodeName, "error", err)
+			backoff = min(backoff*2, nodeJoinMaxBackoff)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s to join kubernetes cluster, last observed: %s", newKpNodeName, lastObserved)
+		case <-time.After(backoff):
+		}
+	}
+}
+
+func (k *KubernetesClient) watchForNodeReady(ctx context.Context, nodeName string, lastObserved *string) (bool, error) {
+	watchCtx, cancel := context.WithTimeout(ctx, nodeJoinResync)
+	defer cancel()
+
+	watcher, err := k.client.CoreV1().Nodes().Watch(watchCtx, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", nodeName).String(),
+	})
+	if err != nil {
+		return false, err
+	}
+	defer watcher.Stop()
+
+	for {
+		select {
+		case <-watchCtx.Done():
+			return false, nil
+		case event, ok := <-watcher.ResultChan():
+			if !ok {
+				return false, nil
+			}
+
+			node, isNode := event.Object.(*apiv1.Node)
+			if !isNode || node.Name != nodeName {
+				continue
+			}
+
+			ready, observed := nodeReadyCondition(node)
+			if ready {
+				return true, nil
 			}
+			*lastObserved = observed
 		}
 	}
 }
 
-func (k *KubernetesClient) cordonKpNode(ctx context.Context, kpNodeName string) error {
+// Marks the kpNode unschedulable so no new pods are placed on it
+func (k *KubernetesClient) CordonKpNode(ctx context.Context, kpNodeName string) error {
+	return k.setKpNodeUnschedulable(ctx, kpNodeName, true)
+}
+
+// Lets pods be scheduled on the kpNode again
+func (k *KubernetesClient) UncordonKpNode(ctx context.Context, kpNodeName string) error {
+	return k.setKpNodeUnschedulable(ctx, kpNodeName, false)
+}
+
+func (k *KubernetesClient) setKpNodeUnschedulable(ctx context.Context, kpNodeName string, unschedulable bool) error {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
 	kpNode, err := k.client.CoreV1().Nodes().Get(
-		ctx,
+		rctx,
 		kpNodeName,
 		metav1.GetOptions{},
 	)
@@ -311,10 +951,10 @@ func (k *KubernetesClient) cordonKpNode(ctx context.Context, kpNodeName string)
 		return err
 	}
 
-	kpNode.Spec.Unschedulable = true
+	kpNode.Spec.Unschedulable = unschedulable
 
 	_, err = k.client.CoreV1().Nodes().Update(
-		ctx,
+		rctx,
 		kpNode,
 		metav1.UpdateOptions{},
 	)
@@ -322,29 +962,34 @@ func (k *KubernetesClient) cordonKpNode(ctx context.Context, kpNodeName string)
 	return err
 }
 
-func (k *KubernetesClient) waitForPodsDelete(ctx context.Context, evictedPods *apiv1.PodList, kpNodeName string) error {
+func (k *KubernetesClient) waitForPodsDelete(ctx context.Context, evictedPods []apiv1.Pod, kpNodeName string) error {
 	err := wait.PollUntilContextCancel(
 		ctx,
 		time.Duration(time.Second*5),
 		true,
 		func(ctx context.Context) (bool, error) {
-			var err error
-			deleted := true
-			for _, evictedPod := range evictedPods.Items {
+			for _, evictedPod := range evictedPods {
+				rctx, cancel := k.requestContext(ctx)
 				pod, err := k.client.CoreV1().Pods(evictedPod.Namespace).Get(
-					ctx,
+					rctx,
 					evictedPod.Name,
 					metav1.GetOptions{},
 				)
-
-				if pod.Spec.NodeName != kpNodeName || apierrors.IsNotFound(err) {
+				cancel()
+				if apierrors.IsNotFound(err) {
 					continue
-				} else {
-					deleted = false
+				}
+
+				if err != nil {
+					return false, err
+				}
+
+				if pod.Spec.NodeName == kpNodeName {
+					return false, nil
 				}
 			}
 
-			return deleted, err
+			return true, nil
 		},
 	)
 
@@ -355,9 +1000,121 @@ func (k *KubernetesClient) waitForPodsDelete(ctx context.Context, evictedPods *a
 	return err
 }
 
+// Force deletes the evicted pods which are still terminating on the node.
+func (k *KubernetesClient) forceDeletePods(ctx context.Context, evictedPods []apiv1.Pod, kpNodeName string) error {
+	for _, evictedPod := range evictedPods {
+		rctx, cancel := k.requestContext(ctx)
+		pod, err := k.client.CoreV1().Pods(evictedPod.Namespace).Get(
+			rctx,
+			evictedPod.Name,
+			metav1.GetOptions{},
+		)
+		cancel()
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if pod.Spec.NodeName != kpNodeName || pod.DeletionTimestamp == nil {
+			continue
+		}
+
+		logger.WarnLog("Force deleting pod stuck terminating", "pod", fmt.Sprintf("%s/%s", pod.Namespace, pod.Name), "node", kpNodeName)
+
+		rctx, cancel = k.requestContext(ctx)
+		err = k.client.CoreV1().Pods(pod.Namespace).Delete(
+			rctx,
+			pod.Name,
+			metav1.DeleteOptions{GracePeriodSeconds: new(int64)},
+		)
+		cancel()
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// The built in priority classes of pods the cluster depends on
+const (
+	systemClusterCritical = "system-cluster-critical"
+	systemNodeCritical    = "system-node-critical"
+	// The lowest priority of the built in system priority classes
+	systemCriticalPriority = 2000000000
+)
+
+// Pods in kube-system which the cluster depends on, these are only evicted
+// once every other pod has left the node.
+func isSystemCriticalPod(pod apiv1.Pod) bool {
+	if pod.Namespace != metav1.NamespaceSystem {
+		return false
+	}
+
+	if pod.Spec.PriorityClassName == systemClusterCritical || pod.Spec.PriorityClassName == systemNodeCritical {
+		return true
+	}
+
+	return podPriority(pod) >= systemCriticalPriority
+}
+
+func podPriority(pod apiv1.Pod) int32 {
+	if pod.Spec.Priority == nil {
+		return 0
+	}
+
+	return *pod.Spec.Priority
+}
+
+// Groups the pods to evict from a node into waves, lowest priority first,
+// with system critical pods in the final wave.
+func drainWaves(pods []apiv1.Pod) [][]apiv1.Pod {
+	evictable := []apiv1.Pod{}
+	critical := []apiv1.Pod{}
+	for _, pod := range pods {
+		if isNodeBoundPod(pod) || pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+
+		if isSystemCriticalPod(pod) {
+			critical = append(critical, pod)
+			continue
+		}
+
+		evictable = append(evictable, pod)
+	}
+
+	slices.SortStableFunc(evictable, func(a, b apiv1.Pod) int {
+		return cmp.Compare(podPriority(a), podPriority(b))
+	})
+
+	waves := [][]apiv1.Pod{}
+	for idx, pod := range evictable {
+		if idx == 0 || podPriority(pod) != podPriority(evictable[idx-1]) {
+			waves = append(waves, []apiv1.Pod{})
+		}
+		waves[len(waves)-1] = append(waves[len(waves)-1], pod)
+	}
+
+	if len(critical) > 0 {
+		waves = append(waves, critical)
+	}
+
+	return waves
+}
+
+// Evicts the pods from the node a wave at a time, waiting for each wave to
+// leave the node before evicting the next so that higher priority workloads
+// keep running for as long as possible.
 func (k *KubernetesClient) drainKpNode(ctx context.Context, kpNodeName string) error {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
 	pods, err := k.client.CoreV1().Pods("").List(
-		ctx,
+		rctx,
 		metav1.ListOptions{
 			FieldSelector: fmt.Sprintf("spec.nodeName=%s", kpNodeName),
 		},
@@ -366,47 +1123,84 @@ func (k *KubernetesClient) drainKpNode(ctx context.Context, kpNodeName string) e
 		return err
 	}
 
-	evictedPods := &apiv1.PodList{}
-	for _, pod := range pods.Items {
-		if pod.OwnerReferences[0].Kind != "DaemonSet" {
-			err = k.client.PolicyV1().Evictions(pod.Namespace).Evict(
-				ctx,
-				&policyv1.Eviction{
-					ObjectMeta: metav1.ObjectMeta{
-						Name:      pod.Name,
-						Namespace: pod.Namespace,
-					},
+	for _, wave := range drainWaves(pods.Items) {
+		// The node is removed regardless once the drain has run out of time
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		for _, pod := range wave {
+			eviction := &policyv1.Eviction{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      pod.Name,
+					Namespace: pod.Namespace,
 				},
-			)
+			}
+
+			if k.drain.GracePeriod > 0 {
+				gracePeriodSeconds := int64(k.drain.GracePeriod.Seconds())
+				eviction.DeleteOptions = &metav1.DeleteOptions{GracePeriodSeconds: &gracePeriodSeconds}
+			}
+
+			rctx, cancel := k.requestContext(ctx)
+			err = k.client.PolicyV1().Evictions(pod.Namespace).Evict(rctx, eviction)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+
+		if k.drain.ForceDeleteTimeout <= 0 {
+			err = k.waitForPodsDelete(ctx, wave, kpNodeName)
 			if err != nil {
 				return err
 			}
 
-			evictedPods.Items = append(evictedPods.Items, pod)
+			continue
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, k.drain.ForceDeleteTimeout)
+		err = k.waitForPodsDelete(waitCtx, wave, kpNodeName)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		err = k.forceDeletePods(ctx, wave, kpNodeName)
+		if err != nil {
+			return err
 		}
 	}
 
-	err = k.waitForPodsDelete(ctx, evictedPods, kpNodeName)
+	return nil
+}
+
+// Cordons the kpNode and evicts its pods, leaving it in the cluster, eg so
+// that it can be patched.
+func (k *KubernetesClient) DrainKpNode(ctx context.Context, kpNodeName string) error {
+	err := k.CordonKpNode(ctx, kpNodeName)
 	if err != nil {
 		return err
 	}
 
-	return err
+	return k.drainKpNode(ctx, kpNodeName)
 }
 
 func (k *KubernetesClient) DeleteKpNode(ctx context.Context, kpNodeName string) error {
-	err := k.cordonKpNode(ctx, kpNodeName)
+	err := k.DrainKpNode(ctx, kpNodeName)
 	if err != nil {
 		return err
 	}
 
-	err = k.drainKpNode(ctx, kpNodeName)
-	if err != nil {
-		return err
-	}
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
 
 	err = k.client.CoreV1().Nodes().Delete(
-		ctx,
+		rctx,
 		kpNodeName,
 		metav1.DeleteOptions{},
 	)
@@ -417,12 +1211,15 @@ func (k *KubernetesClient) DeleteKpNode(ctx context.Context, kpNodeName string)
 	return err
 }
 
-func (k *KubernetesClient) LabelKpNode(kpNodeName string, newKpNodeLabels map[string]string) error {
+func (k *KubernetesClient) LabelKpNode(ctx context.Context, kpNodeName string, newKpNodeLabels map[string]string) error {
 	return retry.RetryOnConflict(
 		retry.DefaultRetry,
 		func() error {
+			rctx, cancel := k.requestContext(ctx)
+			defer cancel()
+
 			kpNode, err := k.client.CoreV1().Nodes().Get(
-				context.TODO(),
+				rctx,
 				kpNodeName,
 				metav1.GetOptions{},
 			)
@@ -438,7 +1235,41 @@ func (k *KubernetesClient) LabelKpNode(kpNodeName string, newKpNodeLabels map[st
 			kpNode.SetLabels(kpNodeLabels)
 
 			_, err = k.client.CoreV1().Nodes().Update(
-				context.TODO(),
+				rctx,
+				kpNode,
+				metav1.UpdateOptions{},
+			)
+
+			return err
+		},
+	)
+}
+
+func (k *KubernetesClient) AnnotateKpNode(ctx context.Context, kpNodeName string, annotations map[string]string) error {
+	return retry.RetryOnConflict(
+		retry.DefaultRetry,
+		func() error {
+			rctx, cancel := k.requestContext(ctx)
+			defer cancel()
+
+			kpNode, err := k.client.CoreV1().Nodes().Get(
+				rctx,
+				kpNodeName,
+				metav1.GetOptions{},
+			)
+			if err != nil {
+				return err
+			}
+
+			kpNodeAnnotations := kpNode.GetAnnotations()
+			if kpNodeAnnotations == nil {
+				kpNodeAnnotations = map[string]string{}
+			}
+			maps.Copy(kpNodeAnnotations, annotations)
+			kpNode.SetAnnotations(kpNodeAnnotations)
+
+			_, err = k.client.CoreV1().Nodes().Update(
+				rctx,
 				kpNode,
 				metav1.UpdateOptions{},
 			)
@@ -448,18 +1279,11 @@ func (k *KubernetesClient) LabelKpNode(kpNodeName string, newKpNodeLabels map[st
 	)
 }
 
-func (k *KubernetesClient) getMaxAllocatableMemoryForSinglePod(kpNodeNameRegex regexp.Regexp) (float64, error) {
-	kpNodes, err := k.GetKpNodes(kpNodeNameRegex)
+func (k *KubernetesClient) getMaxAllocatableMemoryForSinglePod(ctx context.Context, kpNodeNameRegex regexp.Regexp) (float64, error) {
+	kpNodes, err := k.GetKpNodes(ctx, kpNodeNameRegex)
 	if err != nil {
 		return 0.0, err
 	}
 
-	var maxAllocatable float64
-	for _, node := range kpNodes {
-		if node.Status.Allocatable.Memory().AsApproximateFloat64() > maxAllocatable {
-			maxAllocatable = node.Status.Allocatable.Memory().AsApproximateFloat64()
-		}
-	}
-
-	return maxAllocatable, nil
+	return MaxAllocatableMemory(kpNodes), nil
 }
@@ -2,41 +2,76 @@ package kubernetes
 
 import (
 	"context"
+	"maps"
 	"regexp"
+	"slices"
+	"time"
 
 	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 type KubernetesMock struct {
-	CordonedNodes                          []string
-	DeletedNodes                           []string
-	AllocatedResources                     map[string]AllocatedResources
+	CordonedNodes      []string
+	DeletedNodes       []string
+	AllocatedResources map[string]AllocatedResources
+	// Reported by metrics-server
+	Usage                                  map[string]AllocatedResources
 	UnschedulableResources                 UnschedulableResources
+	UnschedulablePods                      []UnschedulablePod
 	WorkerNodesAllocatableResources        WorkerNodesAllocatableResources
 	FailedSchedulingDueToControlPlaneTaint bool
 	KpNodes                                []apiv1.Node
+	WorkerNodes                            []apiv1.Node
+	VolumeTopologyConflicts                []VolumeTopology
+	EmptyKpNodes                           []string
+	LocalStorageKpNodes                    map[string]string
+	NodeJoinErr                            error
+	UntaintedNodes                         []string
+	NodePools                              []NodePool
+	NodePoolStatuses                       map[string]NodePoolStatus
+	UncordonedNodes                        []string
+	DrainedNodes                           []string
+	Annotations                            map[string]map[string]string
+	// The data of Secrets by namespace/name
+	Secrets map[string]map[string]string
+	// The reasons of recorded events
+	RecordedEvents []string
+	// Set by EnsureOverprovisioning
+	Overprovisioning *Overprovisioning
+	// By name
+	ScaleDownProposals map[string]ScaleDownProposal
 }
 
-func (m *KubernetesMock) GetUnschedulableResources(kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error) {
+func (m *KubernetesMock) GetUnschedulableResources(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) (UnschedulableResources, error) {
 	return m.UnschedulableResources, nil
 }
 
-func (m *KubernetesMock) IsUnschedulableDueToControlPlaneTaint() (bool, error) {
+func (m *KubernetesMock) GetUnschedulablePods(ctx context.Context, kpNodeCores int64, kpNodeNameRegex regexp.Regexp) ([]UnschedulablePod, error) {
+	return m.UnschedulablePods, nil
+}
+
+func (m *KubernetesMock) IsUnschedulableDueToControlPlaneTaint(ctx context.Context) (bool, error) {
 	return m.FailedSchedulingDueToControlPlaneTaint, nil
 }
 
-func (m *KubernetesMock) GetWorkerNodes() ([]apiv1.Node, error) {
-	return nil, nil
+func (m *KubernetesMock) GetVolumeTopologyConflicts(ctx context.Context) ([]VolumeTopology, error) {
+	return m.VolumeTopologyConflicts, nil
 }
 
-func (m *KubernetesMock) GetWorkerNodesAllocatableResources() (WorkerNodesAllocatableResources, error) {
+func (m *KubernetesMock) GetWorkerNodes(ctx context.Context) ([]apiv1.Node, error) {
+	return m.WorkerNodes, nil
+}
+
+func (m *KubernetesMock) GetWorkerNodesAllocatableResources(ctx context.Context) (WorkerNodesAllocatableResources, error) {
 	return m.WorkerNodesAllocatableResources, nil
 }
 
-func (m *KubernetesMock) GetKpNodes(kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error) {
+func (m *KubernetesMock) GetKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]apiv1.Node, error) {
+	// Like the client, each call returns a new slice the caller may modify
 	if m.KpNodes != nil {
-		return m.KpNodes, nil
+		return slices.Clone(m.KpNodes), nil
 	}
 
 	nodes := make([]apiv1.Node, len(m.AllocatedResources))
@@ -55,11 +90,61 @@ func (m *KubernetesMock) GetKpNodes(kpNodeNameRegex regexp.Regexp) ([]apiv1.Node
 	return nodes, nil
 }
 
-func (m *KubernetesMock) GetKpNodesAllocatedResources(kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
+func (m *KubernetesMock) GetKpNodesAllocatedResources(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
 	return m.AllocatedResources, nil
 }
 
-func (m *KubernetesMock) CheckForNodeJoin(ctx context.Context, ok chan<- bool, newKpNodeName string) {
+func (m *KubernetesMock) GetKpNodesUsage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
+	return m.Usage, nil
+}
+
+func (m *KubernetesMock) GetEmptyKpNodes(ctx context.Context, kpNodeNameRegex regexp.Regexp) ([]string, error) {
+	return m.EmptyKpNodes, nil
+}
+
+func (m *KubernetesMock) GetKpNodesWithLocalStorage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]string, error) {
+	return m.LocalStorageKpNodes, nil
+}
+
+func (m *KubernetesMock) CheckForNodeJoin(ctx context.Context, newKpNodeName string) error {
+	return m.NodeJoinErr
+}
+
+func (m *KubernetesMock) WatchUnschedulablePods(ctx context.Context, unschedulable chan<- struct{}) {
+}
+
+func (m *KubernetesMock) WatchWorkloadShrinkage(ctx context.Context, minPods int, shrunk chan<- struct{}) {
+}
+
+func (m *KubernetesMock) CordonKpNode(ctx context.Context, kpNodeName string) error {
+	m.CordonedNodes = append(m.CordonedNodes, kpNodeName)
+	return nil
+}
+
+func (m *KubernetesMock) UncordonKpNode(ctx context.Context, kpNodeName string) error {
+	m.UncordonedNodes = append(m.UncordonedNodes, kpNodeName)
+	return nil
+}
+
+func (m *KubernetesMock) DrainKpNode(ctx context.Context, kpNodeName string) error {
+	m.DrainedNodes = append(m.DrainedNodes, kpNodeName)
+	return nil
+}
+
+func (m *KubernetesMock) AnnotateKpNode(ctx context.Context, kpNodeName string, annotations map[string]string) error {
+	if m.Annotations == nil {
+		m.Annotations = map[string]map[string]string{}
+	}
+
+	if m.Annotations[kpNodeName] == nil {
+		m.Annotations[kpNodeName] = map[string]string{}
+	}
+
+	for key, value := range annotations {
+		m.Annotations[kpNodeName][key] = value
+	}
+
+	return nil
 }
 
 func (m *KubernetesMock) DeleteKpNode(ctx context.Context, kpNodeName string) error {
@@ -67,6 +152,73 @@ func (m *KubernetesMock) DeleteKpNode(ctx context.Context, kpNodeName string) er
 	return nil
 }
 
-func (k *KubernetesMock) LabelKpNode(kpNodeName string, newKpNodeLabels map[string]string) error {
+func (m *KubernetesMock) GetSecretData(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	data, ok := m.Secrets[namespace+"/"+name]
+	if !ok {
+		return nil, apierrors.NewNotFound(apiv1.Resource("secrets"), name)
+	}
+
+	return maps.Clone(data), nil
+}
+
+func (k *KubernetesMock) LabelKpNode(ctx context.Context, kpNodeName string, newKpNodeLabels map[string]string) error {
+	return nil
+}
+
+func (m *KubernetesMock) UntaintKpNode(ctx context.Context, kpNodeName string) error {
+	m.UntaintedNodes = append(m.UntaintedNodes, kpNodeName)
+	return nil
+}
+
+func (m *KubernetesMock) StartInformers(ctx context.Context, resync time.Duration) error {
+	return nil
+}
+
+func (m *KubernetesMock) GetNodePools(ctx context.Context) ([]NodePool, error) {
+	return m.NodePools, nil
+}
+
+func (m *KubernetesMock) UpdateNodePoolStatus(ctx context.Context, name string, status NodePoolStatus) error {
+	if m.NodePoolStatuses == nil {
+		m.NodePoolStatuses = map[string]NodePoolStatus{}
+	}
+
+	m.NodePoolStatuses[name] = status
+	return nil
+}
+
+func (m *KubernetesMock) RecordPodEvent(ctx context.Context, namespace string, podName string, eventType string, reason string, message string) error {
+	m.RecordedEvents = append(m.RecordedEvents, reason)
+	return nil
+}
+
+func (m *KubernetesMock) EnsureOverprovisioning(ctx context.Context, overprovisioning Overprovisioning) error {
+	m.Overprovisioning = &overprovisioning
+	return nil
+}
+
+func (m *KubernetesMock) GetScaleDownProposals(ctx context.Context) ([]ScaleDownProposal, error) {
+	proposals := []ScaleDownProposal{}
+	for _, proposal := range m.ScaleDownProposals {
+		proposals = append(proposals, proposal)
+	}
+
+	return proposals, nil
+}
+
+func (m *KubernetesMock) CreateScaleDownProposal(ctx context.Context, proposal ScaleDownProposal) error {
+	if m.ScaleDownProposals == nil {
+		m.ScaleDownProposals = map[string]ScaleDownProposal{}
+	}
+
+	if _, ok := m.ScaleDownProposals[proposal.Name]; !ok {
+		m.ScaleDownProposals[proposal.Name] = proposal
+	}
+
+	return nil
+}
+
+func (m *KubernetesMock) DeleteScaleDownProposal(ctx context.Context, name string) error {
+	delete(m.ScaleDownProposals, name)
 	return nil
 }
@@ -2,15 +2,33 @@ package kubernetes
 
 import (
 	"context"
-	"fmt"
-	"regexp"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/lupinelab/kproximate/identity"
+	appsv1 "k8s.io/api/apps/v1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
 	testclient "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"sigs.k8s.io/yaml"
 )
 
 func NewKubernetesMock(objects ...runtime.Object) *KubernetesClient {
@@ -109,9 +127,9 @@ func TestGetUnschedulableResourcesIgnoresUnsatisfiableCpu(t *testing.T) {
 		},
 	)
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
 	kpNodeCores := 2
-	unschedulableResources, err := k.GetUnschedulableResources(int64(kpNodeCores), kpNodeNameRegex)
+	unschedulableResources, err := k.GetUnschedulableResources(context.TODO(), int64(kpNodeCores), kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
 	}
@@ -223,8 +241,8 @@ func TestGetUnschedulableResourcesIgnoresUnsatisfiableMemory(t *testing.T) {
 		},
 	)
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
-	unschedulableResources, err := k.GetUnschedulableResources(2, kpNodeNameRegex)
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	unschedulableResources, err := k.GetUnschedulableResources(context.TODO(), 2, kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
 	}
@@ -234,6 +252,83 @@ func TestGetUnschedulableResourcesIgnoresUnsatisfiableMemory(t *testing.T) {
 	}
 }
 
+func TestGetUnschedulableResourcesCountsExtendedResources(t *testing.T) {
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "inference",
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Resources: apiv1.ResourceRequirements{
+							Requests: apiv1.ResourceList{
+								apiv1.ResourceCPU:                    resource.MustParse("1"),
+								apiv1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+							},
+						},
+					},
+				},
+			},
+			Status: apiv1.PodStatus{
+				Conditions: []apiv1.PodCondition{
+					{
+						Type:    apiv1.PodScheduled,
+						Status:  apiv1.ConditionFalse,
+						Reason:  apiv1.PodReasonUnschedulable,
+						Message: "0/3 nodes are available: 3 Insufficient nvidia.com/gpu.",
+					},
+				},
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "scratch",
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Resources: apiv1.ResourceRequirements{
+							Requests: apiv1.ResourceList{
+								apiv1.ResourceEphemeralStorage: resource.MustParse("100Gi"),
+							},
+						},
+					},
+				},
+			},
+			Status: apiv1.PodStatus{
+				Conditions: []apiv1.PodCondition{
+					{
+						Type:    apiv1.PodScheduled,
+						Status:  apiv1.ConditionFalse,
+						Reason:  apiv1.PodReasonUnschedulable,
+						Message: "0/3 nodes are available: 3 Insufficient ephemeral-storage.",
+					},
+				},
+			},
+		},
+	)
+
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	unschedulableResources, err := k.GetUnschedulableResources(context.TODO(), 2, kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if unschedulableResources.Cpu != 0 {
+		t.Errorf("Expected no cpu as the pod is only short of gpus, got %f", unschedulableResources.Cpu)
+	}
+
+	if len(unschedulableResources.Extended) != 1 || unschedulableResources.Extended["nvidia.com/gpu"] != 2 {
+		t.Errorf("Expected 2 nvidia.com/gpu and no ephemeral-storage, got %v", unschedulableResources.Extended)
+	}
+}
+
 func TestGetKpNodesOnlyReturnsKpNodes(t *testing.T) {
 	k := NewKubernetesMock(
 		&apiv1.Node{
@@ -277,9 +372,9 @@ func TestGetKpNodesOnlyReturnsKpNodes(t *testing.T) {
 		},
 	)
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
 
-	nodes, err := k.GetKpNodes(kpNodeNameRegex)
+	nodes, err := k.GetKpNodes(context.TODO(), kpNodeNameRegex)
 
 	if err != nil {
 		t.Error(err)
@@ -352,7 +447,7 @@ func TestGetWorkerNodes(t *testing.T) {
 		},
 	)
 
-	workerNodes, err := k.GetWorkerNodes()
+	workerNodes, err := k.GetWorkerNodes(context.TODO())
 	if err != nil {
 		t.Error(err)
 	}
@@ -435,8 +530,8 @@ func TestGetKpNodes(t *testing.T) {
 		},
 	)
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
-	kpNodes, err := k.GetKpNodes(kpNodeNameRegex)
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	kpNodes, err := k.GetKpNodes(context.TODO(), kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
 	}
@@ -466,13 +561,13 @@ func TestCordonKpNode(t *testing.T) {
 		},
 	)
 
-	err := k.cordonKpNode(context.TODO(), "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a")
+	err := k.CordonKpNode(context.TODO(), "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a")
 	if err != nil {
 		t.Error(err)
 	}
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
-	nodes, err := k.GetKpNodes(kpNodeNameRegex)
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	nodes, err := k.GetKpNodes(context.TODO(), kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
 	}
@@ -507,8 +602,8 @@ func TestDeleteKpNode(t *testing.T) {
 		t.Error(err)
 	}
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
-	nodes, err := k.GetKpNodes(kpNodeNameRegex)
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	nodes, err := k.GetKpNodes(context.TODO(), kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
 	}
@@ -520,6 +615,208 @@ func TestDeleteKpNode(t *testing.T) {
 	}
 }
 
+func TestDeleteKpNodeEvictsByPriority(t *testing.T) {
+	kpNodeName := "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+	priority := func(value int32) *int32 {
+		return &value
+	}
+
+	pod := func(name string, namespace string, ownerKind string, podPriority *int32, priorityClassName string) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: ownerKind, Name: name},
+				},
+			},
+			Spec: apiv1.PodSpec{
+				NodeName:          kpNodeName,
+				Priority:          podPriority,
+				PriorityClassName: priorityClassName,
+			},
+		}
+	}
+
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: kpNodeName,
+			},
+		},
+		pod("coredns", "kube-system", "ReplicaSet", priority(2000000000), "system-cluster-critical"),
+		pod("database", "default", "StatefulSet", priority(1000), ""),
+		pod("batch", "default", "Job", nil, ""),
+		pod("web", "default", "ReplicaSet", priority(1000), ""),
+		pod("metrics-agent", "kube-system", "DaemonSet", priority(2000001000), "system-node-critical"),
+		pod("tooling", "kube-system", "ReplicaSet", nil, ""),
+	)
+
+	// The fake clientset does not remove evicted pods
+	clientset := k.client.(*testclient.Clientset)
+	evicted := []string{}
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		evicted = append(evicted, eviction.Name)
+
+		return true, nil, clientset.Tracker().Delete(apiv1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	err := k.DeleteKpNode(ctx, kpNodeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"batch", "tooling", "database", "web", "coredns"}
+	if strings.Join(evicted, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected pods to be evicted in the order %v, got %v", expected, evicted)
+	}
+}
+
+func TestDeleteKpNodeForceDeletesTerminatingPods(t *testing.T) {
+	kpNodeName := "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: kpNodeName,
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "stuck",
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: kpNodeName,
+			},
+		},
+	)
+	k.drain = DrainOptions{
+		GracePeriod:        time.Second * 10,
+		ForceDeleteTimeout: time.Millisecond * 100,
+	}
+
+	// Evicted pods are left terminating, as if their finalizers never complete
+	clientset := k.client.(*testclient.Clientset)
+	var gracePeriodSeconds *int64
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		gracePeriodSeconds = eviction.DeleteOptions.GracePeriodSeconds
+
+		pod, err := clientset.Tracker().Get(apiv1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+		if err != nil {
+			return true, nil, err
+		}
+
+		terminating := pod.(*apiv1.Pod).DeepCopy()
+		terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+		return true, nil, clientset.Tracker().Update(apiv1.SchemeGroupVersion.WithResource("pods"), terminating, eviction.Namespace)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	err := k.DeleteKpNode(ctx, kpNodeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gracePeriodSeconds == nil || *gracePeriodSeconds != 10 {
+		t.Errorf("Expected the pod to be evicted with a 10 second grace period, got %v", gracePeriodSeconds)
+	}
+
+	_, err = k.client.CoreV1().Pods("default").Get(context.TODO(), "stuck", metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Expected the terminating pod to be force deleted, got %v", err)
+	}
+}
+
+func TestUntaintKpNodeWaitsForHealthyNode(t *testing.T) {
+	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	cni := &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cni",
+			Namespace: "kube-system",
+		},
+		Spec: apiv1.PodSpec{
+			NodeName: kpNodeName,
+		},
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodRunning,
+			Conditions: []apiv1.PodCondition{
+				{
+					Type:   apiv1.PodReady,
+					Status: apiv1.ConditionFalse,
+				},
+			},
+		},
+	}
+
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: kpNodeName,
+			},
+			Spec: apiv1.NodeSpec{
+				Taints: []apiv1.Taint{
+					{Key: StartupTaintKey, Effect: apiv1.TaintEffectNoSchedule},
+					{Key: "dedicated", Value: "gpu", Effect: apiv1.TaintEffectNoSchedule},
+				},
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:   apiv1.NodeReady,
+						Status: apiv1.ConditionTrue,
+					},
+				},
+			},
+		},
+		cni,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+
+	err := k.UntaintKpNode(ctx, kpNodeName)
+	if err == nil || !strings.Contains(err.Error(), "kube-system/cni is not ready") {
+		t.Fatalf("Expected the kpNode to be unhealthy until its pods are ready, got %v", err)
+	}
+
+	cni.Status.Conditions[0].Status = apiv1.ConditionTrue
+	_, err = k.client.CoreV1().Pods("kube-system").UpdateStatus(context.TODO(), cni, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = k.UntaintKpNode(context.Background(), kpNodeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kpNode, err := k.client.CoreV1().Nodes().Get(context.TODO(), kpNodeName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNode.Spec.Taints) != 1 || kpNode.Spec.Taints[0].Key != "dedicated" {
+		t.Errorf("Expected only the startup taint to be removed, got %v", kpNode.Spec.Taints)
+	}
+}
+
 func TestLabelNode(t *testing.T) {
 	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
 	k := NewKubernetesMock(
@@ -538,7 +835,7 @@ func TestLabelNode(t *testing.T) {
 		"topology.kubernetes.io/zone2":  "tc-01",
 	}
 
-	err := k.LabelKpNode(kpNodeName, newKpNodeLabels)
+	err := k.LabelKpNode(context.TODO(), kpNodeName, newKpNodeLabels)
 	if err != nil {
 		t.Error(err)
 	}
@@ -570,3 +867,1348 @@ func TestLabelNode(t *testing.T) {
 		t.Errorf("Expected %s label: %s:%s", kpNodeName, "node-role.kubernetes.io/control-plane", "true")
 	}
 }
+
+func TestReviewAccess(t *testing.T) {
+	k := NewKubernetesMock()
+	clientset := k.client.(*testclient.Clientset)
+
+	clientset.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if review.Spec.Token == "valid" {
+			review.Status.Authenticated = true
+			review.Status.User.Username = "system:serviceaccount:platform:deployer"
+		}
+
+		return true, review, nil
+	})
+
+	clientset.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		review.Status.Allowed = review.Spec.User == "system:serviceaccount:platform:deployer" &&
+			review.Spec.NonResourceAttributes.Path == "/metrics" &&
+			review.Spec.NonResourceAttributes.Verb == "get"
+
+		return true, review, nil
+	})
+
+	user, allowed, err := k.ReviewAccess(context.TODO(), "valid", "/metrics", "get")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user != "system:serviceaccount:platform:deployer" || !allowed {
+		t.Errorf("Expected the deployer to be allowed, got %q allowed %v", user, allowed)
+	}
+
+	_, allowed, _ = k.ReviewAccess(context.TODO(), "valid", "/metrics", "post")
+	if allowed {
+		t.Error("Expected the deployer not to be allowed to post")
+	}
+
+	user, allowed, _ = k.ReviewAccess(context.TODO(), "expired", "/metrics", "get")
+	if user != "" || allowed {
+		t.Error("Expected an invalid token not to be allowed")
+	}
+
+	for _, action := range clientset.Actions() {
+		if !rulesAllow(ControllerRules, action) {
+			t.Errorf("ControllerRules do not permit %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestCheckForNodeJoinWatchesForReadyNode(t *testing.T) {
+	k := NewKubernetesMock()
+
+	go func() {
+		time.Sleep(time.Millisecond * 100)
+		k.client.CoreV1().Nodes().Create(context.Background(), &apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:   apiv1.NodeReady,
+						Status: apiv1.ConditionTrue,
+					},
+				},
+			},
+		}, metav1.CreateOptions{})
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	err := k.CheckForNodeJoin(ctx, "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckForNodeJoinReportsLastObservedCondition(t *testing.T) {
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:    apiv1.NodeReady,
+						Status:  apiv1.ConditionFalse,
+						Reason:  "KubeletNotReady",
+						Message: "container runtime network not ready",
+					},
+				},
+			},
+		},
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+	defer cancel()
+
+	err := k.CheckForNodeJoin(ctx, "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if !strings.Contains(err.Error(), "Ready=False (KubeletNotReady: container runtime network not ready)") {
+		t.Errorf("Expected the error to describe the node condition, got %s", err)
+	}
+}
+
+func TestGetVolumeTopologyConflicts(t *testing.T) {
+	k := NewKubernetesMock(
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "database",
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				Volumes: []apiv1.Volume{
+					{
+						Name: "data",
+						VolumeSource: apiv1.VolumeSource{
+							PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{
+								ClaimName: "data",
+							},
+						},
+					},
+				},
+			},
+			Status: apiv1.PodStatus{
+				Conditions: []apiv1.PodCondition{
+					{
+						Type:    apiv1.PodScheduled,
+						Status:  apiv1.ConditionFalse,
+						Reason:  apiv1.PodReasonUnschedulable,
+						Message: "0/2 nodes are available: 2 node(s) had volume node affinity conflict.",
+					},
+				},
+			},
+		},
+		&apiv1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "data",
+				Namespace: "default",
+			},
+			Spec: apiv1.PersistentVolumeClaimSpec{
+				VolumeName: "pv-data",
+			},
+		},
+		&apiv1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "pv-data",
+			},
+			Spec: apiv1.PersistentVolumeSpec{
+				NodeAffinity: &apiv1.VolumeNodeAffinity{
+					Required: &apiv1.NodeSelector{
+						NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+							{
+								MatchExpressions: []apiv1.NodeSelectorRequirement{
+									{
+										Key:      "topology.kubernetes.io/zone",
+										Operator: apiv1.NodeSelectorOpIn,
+										Values:   []string{"pve-02"},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	)
+
+	conflicts, err := k.GetVolumeTopologyConflicts(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(conflicts) != 1 {
+		t.Fatalf("Expected 1 volume topology conflict, got %d", len(conflicts))
+	}
+
+	zones := conflicts[0]["topology.kubernetes.io/zone"]
+	if len(zones) != 1 || zones[0] != "pve-02" {
+		t.Errorf("Expected zone pve-02, got %v", zones)
+	}
+}
+
+func TestGetKpNodesAllocatedResourcesFromInformers(t *testing.T) {
+	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	podRequest := func(cpu string, memory string) apiv1.ResourceRequirements {
+		return apiv1.ResourceRequirements{
+			Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse(cpu),
+				apiv1.ResourceMemory: resource.MustParse(memory),
+			},
+		}
+	}
+
+	clientset := testclient.NewSimpleClientset(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: kpNodeName,
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:   apiv1.NodeReady,
+						Status: "True",
+					},
+				},
+			},
+		},
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "k3s-master",
+				Labels: map[string]string{
+					"node-role.kubernetes.io/master": "true",
+				},
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:   apiv1.NodeReady,
+						Status: "True",
+					},
+				},
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod-a",
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: kpNodeName,
+				Containers: []apiv1.Container{
+					{Resources: podRequest("1", "1Gi")},
+				},
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod-b",
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: kpNodeName,
+				Containers: []apiv1.Container{
+					{Resources: podRequest("500m", "1Gi")},
+				},
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "pod-c",
+				Namespace: "kube-system",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: "k3s-master",
+				Containers: []apiv1.Container{
+					{Resources: podRequest("2", "2Gi")},
+				},
+			},
+		},
+	)
+	k := &KubernetesClient{
+		client: clientset,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := k.StartInformers(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientset.ClearActions()
+
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	allocatedResources, err := k.GetKpNodesAllocatedResources(context.TODO(), kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(allocatedResources) != 1 {
+		t.Fatalf("Expected 1 kpNode, got %d", len(allocatedResources))
+	}
+
+	if allocatedResources[kpNodeName].Cpu != 1.5 {
+		t.Errorf("Expected 1.5 cpu allocated, got %f", allocatedResources[kpNodeName].Cpu)
+	}
+
+	if allocatedResources[kpNodeName].Memory != 2147483648 {
+		t.Errorf("Expected 2147483648 memory allocated, got %f", allocatedResources[kpNodeName].Memory)
+	}
+
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "list" {
+			t.Errorf("Expected nodes and pods to be read from the informer cache, got a list of %s", action.GetResource().Resource)
+		}
+	}
+}
+
+func TestGetEmptyKpNodes(t *testing.T) {
+	readyNode := func(name string) *apiv1.Node {
+		return &apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: name,
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:   apiv1.NodeReady,
+						Status: "True",
+					},
+				},
+			},
+		}
+	}
+
+	k := NewKubernetesMock(
+		readyNode("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"),
+		readyNode("kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"),
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "workload",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "ReplicaSet", Name: "workload"},
+				},
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "daemon",
+				Namespace: "kube-system",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "DaemonSet", Name: "daemon"},
+				},
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "completed-job",
+				Namespace: "default",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Job", Name: "job"},
+				},
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+			},
+			Status: apiv1.PodStatus{
+				Phase: apiv1.PodSucceeded,
+			},
+		},
+	)
+
+	// The fake clientset does not filter pods by field selector
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := k.StartInformers(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	emptyKpNodes, err := k.GetEmptyKpNodes(context.TODO(), kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(emptyKpNodes) != 1 || emptyKpNodes[0] != "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a" {
+		t.Errorf("Expected only kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a to be empty, got %v", emptyKpNodes)
+	}
+}
+
+func TestGetKpNodesWithLocalStorage(t *testing.T) {
+	kpNode := func(name string) *apiv1.Node {
+		return &apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue}},
+			},
+		}
+	}
+
+	pod := func(name string, nodeName string, annotations map[string]string, volume apiv1.VolumeSource) *apiv1.Pod {
+		return &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "default",
+				Annotations: annotations,
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: nodeName,
+				Volumes:  []apiv1.Volume{{Name: "data", VolumeSource: volume}},
+			},
+		}
+	}
+
+	k := NewKubernetesMock(
+		kpNode("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"),
+		kpNode("kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"),
+		kpNode("kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38"),
+		pod("cache", "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", nil, apiv1.VolumeSource{
+			HostPath: &apiv1.HostPathVolumeSource{Path: "/var/cache"},
+		}),
+		pod("db", "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a", nil, apiv1.VolumeSource{
+			PersistentVolumeClaim: &apiv1.PersistentVolumeClaimVolumeSource{ClaimName: "db"},
+		}),
+		pod("scratch", "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38", map[string]string{SafeToEvictAnnotation: "true"}, apiv1.VolumeSource{
+			HostPath: &apiv1.HostPathVolumeSource{Path: "/tmp"},
+		}),
+		&apiv1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+			Spec:       apiv1.PersistentVolumeClaimSpec{VolumeName: "local-pv-1"},
+		},
+		&apiv1.PersistentVolume{
+			ObjectMeta: metav1.ObjectMeta{Name: "local-pv-1"},
+			Spec: apiv1.PersistentVolumeSpec{
+				PersistentVolumeSource: apiv1.PersistentVolumeSource{
+					Local: &apiv1.LocalVolumeSource{Path: "/mnt/disks/ssd1"},
+				},
+			},
+		},
+	)
+
+	// The fake clientset does not filter pods by field selector
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	err := k.StartInformers(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	localStorage, err := k.GetKpNodesWithLocalStorage(context.TODO(), kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": "pod default/cache uses hostPath volume data",
+		"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a": "pod default/db uses local PersistentVolume local-pv-1",
+	}
+	if !maps.Equal(localStorage, expected) {
+		t.Errorf("Expected %v, got %v", expected, localStorage)
+	}
+}
+
+func TestNodePools(t *testing.T) {
+	nodePool := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "kproximate.io/v1alpha1",
+			"kind":       "NodePool",
+			"metadata": map[string]interface{}{
+				"name":       "gpu",
+				"generation": int64(2),
+			},
+			"spec": map[string]interface{}{
+				"nodeClass": "gpu",
+				"replicas":  int64(3),
+			},
+		},
+	}
+
+	k := &KubernetesClient{
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{NodePoolResource: "NodePoolList"},
+			nodePool,
+		),
+	}
+
+	nodePools, err := k.GetNodePools(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := NodePool{Name: "gpu", Generation: 2, NodeClass: "gpu", Replicas: 3}
+	if len(nodePools) != 1 || nodePools[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, nodePools)
+	}
+
+	err = k.UpdateNodePoolStatus(context.TODO(), "gpu", NodePoolStatus{Replicas: 1, ReadyReplicas: 1, ObservedGeneration: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := k.dynamicClient.Resource(NodePoolResource).Get(context.TODO(), "gpu", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replicas, _, _ := unstructured.NestedInt64(updated.Object, "status", "replicas")
+	if replicas != 1 {
+		t.Errorf("Expected status.replicas to be 1, got %d", replicas)
+	}
+}
+
+func TestScaleDownProposals(t *testing.T) {
+	k := &KubernetesClient{
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{ScaleDownProposalResource: "ScaleDownProposalList"},
+		),
+	}
+
+	proposed := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	err := k.CreateScaleDownProposal(context.TODO(), ScaleDownProposal{Name: "kp-node-a", Reason: "least loaded", Proposed: proposed})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Creating a proposal which already exists is not an error
+	err = k.CreateScaleDownProposal(context.TODO(), ScaleDownProposal{Name: "kp-node-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proposals, err := k.GetScaleDownProposals(context.TODO())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := ScaleDownProposal{Name: "kp-node-a", Reason: "least loaded", Proposed: proposed}
+	if len(proposals) != 1 || proposals[0] != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, proposals)
+	}
+
+	obj, err := k.dynamicClient.Resource(ScaleDownProposalResource).Get(context.TODO(), "kp-node-a", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj.SetAnnotations(map[string]string{ScaleDownApprovedAnnotation: "true"})
+	_, err = k.dynamicClient.Resource(ScaleDownProposalResource).Update(context.TODO(), obj, metav1.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proposals, _ = k.GetScaleDownProposals(context.TODO())
+	if len(proposals) != 1 || !proposals[0].Approved {
+		t.Fatalf("Expected the annotated proposal to be approved, got %+v", proposals)
+	}
+
+	err = k.DeleteScaleDownProposal(context.TODO(), "kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleting a proposal which no longer exists is not an error
+	err = k.DeleteScaleDownProposal(context.TODO(), "kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	proposals, _ = k.GetScaleDownProposals(context.TODO())
+	if len(proposals) != 0 {
+		t.Errorf("Expected no proposals, got %+v", proposals)
+	}
+}
+
+func TestGetKpNodesUsage(t *testing.T) {
+	nodeMetrics := func(name string, cpu string, memory string) *unstructured.Unstructured {
+		return &unstructured.Unstructured{
+			Object: map[string]interface{}{
+				"apiVersion": "metrics.k8s.io/v1beta1",
+				"kind":       "NodeMetrics",
+				"metadata": map[string]interface{}{
+					"name": name,
+				},
+				"usage": map[string]interface{}{
+					"cpu":    cpu,
+					"memory": memory,
+				},
+			},
+		}
+	}
+
+	k := &KubernetesClient{
+		dynamicClient: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{NodeMetricsResource: "NodeMetricsList"},
+		),
+	}
+
+	for _, obj := range []*unstructured.Unstructured{
+		nodeMetrics("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", "1500m", "2Gi"),
+		nodeMetrics("control-plane", "250m", "1Gi"),
+	} {
+		_, err := k.dynamicClient.Resource(NodeMetricsResource).Create(context.TODO(), obj, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	usage, err := k.GetKpNodesUsage(context.TODO(), *identity.Naming{Prefix: "kp-node"}.Regex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]AllocatedResources{
+		"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {Cpu: 1.5, Memory: 2147483648},
+	}
+	if !reflect.DeepEqual(usage, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, usage)
+	}
+}
+
+func TestRecordPodEvent(t *testing.T) {
+	k := NewKubernetesMock()
+
+	err := k.RecordPodEvent(context.TODO(), "kproximate", "kproximate-controller-abc", apiv1.EventTypeWarning, "ProxmoxDegraded", "The Proxmox cluster has lost quorum")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := k.client.CoreV1().Events("kproximate").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events.Items) != 1 {
+		t.Fatalf("Expected 1 event, got %d", len(events.Items))
+	}
+
+	event := events.Items[0]
+	if event.InvolvedObject.Name != "kproximate-controller-abc" || event.Reason != "ProxmoxDegraded" || event.Type != apiv1.EventTypeWarning {
+		t.Errorf("Expected a ProxmoxDegraded warning on the controller pod, got %+v", event)
+	}
+}
+
+func TestRequestContextTimeout(t *testing.T) {
+	k := &KubernetesClient{requestTimeout: time.Second * 5}
+
+	ctx, cancel := k.requestContext(context.TODO())
+	defer cancel()
+
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Second*5 {
+		t.Errorf("Expected requests to be bounded by the request timeout, got %v", deadline)
+	}
+
+	unbounded := &KubernetesClient{}
+	ctx, cancel = unbounded.requestContext(context.TODO())
+	defer cancel()
+
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected requests without a request timeout to be unbounded")
+	}
+}
+
+// Whether the rules permit the action recorded by a fake clientset.
+func rulesAllow(rules []rbacv1.PolicyRule, action k8stesting.Action) bool {
+	resource := action.GetResource().Resource
+	if action.GetSubresource() != "" {
+		resource += "/" + action.GetSubresource()
+	}
+
+	verb := action.GetVerb()
+	if verb == "delete-collection" {
+		verb = "deletecollection"
+	}
+
+	name := ""
+	switch action := action.(type) {
+	case k8stesting.GetAction:
+		name = action.GetName()
+	case k8stesting.UpdateAction:
+		if object, ok := action.GetObject().(metav1.Object); ok {
+			name = object.GetName()
+		}
+	}
+
+	for _, rule := range rules {
+		if slices.Contains(rule.APIGroups, action.GetResource().Group) &&
+			slices.Contains(rule.Resources, resource) &&
+			slices.Contains(rule.Verbs, verb) &&
+			(len(rule.ResourceNames) == 0 || slices.Contains(rule.ResourceNames, name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestWorkerRulesPermitScaling(t *testing.T) {
+	kpNodeName := "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   kpNodeName,
+				Labels: map[string]string{},
+			},
+		},
+		&apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web",
+				Namespace: "default",
+			},
+			Spec: apiv1.PodSpec{
+				NodeName: kpNodeName,
+			},
+		},
+	)
+	k.drain = DrainOptions{ForceDeleteTimeout: time.Millisecond * 100}
+
+	clientset := k.client.(*testclient.Clientset)
+	clientset.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+
+		// Leave the pod terminating so that it is force deleted
+		eviction := action.(k8stesting.CreateAction).GetObject().(*policyv1.Eviction)
+		pod, err := clientset.Tracker().Get(apiv1.SchemeGroupVersion.WithResource("pods"), eviction.Namespace, eviction.Name)
+		if err != nil {
+			return true, nil, err
+		}
+
+		terminating := pod.(*apiv1.Pod).DeepCopy()
+		terminating.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+		return true, nil, clientset.Tracker().Update(apiv1.SchemeGroupVersion.WithResource("pods"), terminating, eviction.Namespace)
+	})
+
+	err := k.LabelKpNode(context.TODO(), kpNodeName, map[string]string{"kproximate.io/node-class": "default"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = k.DeleteKpNode(context.TODO(), kpNodeName)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, action := range clientset.Actions() {
+		if !rulesAllow(WorkerRules, action) {
+			t.Errorf("WorkerRules do not permit %s %s/%s", action.GetVerb(), action.GetResource().Resource, action.GetSubresource())
+		}
+	}
+}
+
+func TestControllerRulesDoNotPermitRemovingNodes(t *testing.T) {
+	for _, action := range []k8stesting.Action{
+		k8stesting.NewRootDeleteAction(apiv1.SchemeGroupVersion.WithResource("nodes"), "kp-node"),
+		k8stesting.NewRootUpdateAction(apiv1.SchemeGroupVersion.WithResource("nodes"), &apiv1.Node{}),
+		k8stesting.NewCreateSubresourceAction(apiv1.SchemeGroupVersion.WithResource("pods"), "web", "eviction", "default", &policyv1.Eviction{}),
+	} {
+		if rulesAllow(ControllerRules, action) {
+			t.Errorf("Expected ControllerRules not to permit %s %s/%s", action.GetVerb(), action.GetResource().Resource, action.GetSubresource())
+		}
+	}
+}
+
+func TestRestConfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+current-context: staging
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+- name: production
+  cluster:
+    server: https://production.example.com:6443
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+- name: production
+  context:
+    cluster: production
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := RestConfig(ClientOptions{Kubeconfig: kubeconfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Host != "https://staging.example.com:6443" {
+		t.Errorf("Expected the current context to be used, got %s", config.Host)
+	}
+
+	config, err = RestConfig(ClientOptions{
+		Kubeconfig: kubeconfig,
+		Context:    "production",
+		QPS:        50,
+		Burst:      100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Host != "https://production.example.com:6443" || config.QPS != 50 || config.Burst != 100 {
+		t.Errorf("Expected the production context with the given rate limits, got %s %v %d", config.Host, config.QPS, config.Burst)
+	}
+
+	_, err = RestConfig(ClientOptions{Kubeconfig: kubeconfig, Context: "development"})
+	if err == nil {
+		t.Error("Expected an unknown context to fail")
+	}
+}
+
+func TestRBACManifests(t *testing.T) {
+	manifests, err := RBACManifests("kproximate", "kube-system", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"name: kproximate\n",
+		"name: kproximate-worker\n",
+		"namespace: kube-system\n",
+		"- pods/eviction\n",
+	} {
+		if !strings.Contains(string(manifests), expected) {
+			t.Errorf("Expected the manifests to contain %q", expected)
+		}
+	}
+
+	if strings.Contains(string(manifests), "- secrets\n") {
+		t.Error("Expected no access to Secrets without kpJoinSecret")
+	}
+
+	manifests, err = RBACManifests("kproximate", "kube-system", "kproximate/k3s-join", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(manifests), "resourceNames:\n  - k3s-join\n") {
+		t.Errorf("Expected access to Secrets to be scoped to the join secret, got:\n%s", manifests)
+	}
+
+	// A ClusterRole would grant reading a Secret of that name in every
+	// namespace
+	joinSecret := map[string]unstructured.Unstructured{}
+	for _, object := range parseManifests(t, manifests) {
+		switch object.GetKind() {
+		case "ClusterRole":
+			rules, _, _ := unstructured.NestedSlice(object.Object, "rules")
+			for _, rule := range rules {
+				resources, _, _ := unstructured.NestedStringSlice(rule.(map[string]interface{}), "resources")
+				if slices.Contains(resources, "secrets") {
+					t.Errorf("Expected the ClusterRole %s not to grant access to Secrets", object.GetName())
+				}
+			}
+		case "Role", "RoleBinding":
+			joinSecret[object.GetKind()] = object
+		}
+	}
+
+	for _, kind := range []string{"Role", "RoleBinding"} {
+		object, ok := joinSecret[kind]
+		if !ok || object.GetName() != "kproximate-worker-join-secret" || object.GetNamespace() != "kproximate" {
+			t.Errorf("Expected a %s kproximate-worker-join-secret in the join secret's namespace, got %+v", kind, object.Object)
+		}
+	}
+
+	subjects, _, _ := unstructured.NestedSlice(joinSecret["RoleBinding"].Object, "subjects")
+	if len(subjects) != 1 || subjects[0].(map[string]interface{})["name"] != "kproximate-worker" || subjects[0].(map[string]interface{})["namespace"] != "kube-system" {
+		t.Errorf("Expected the join secret Role to be bound to the workers, got %v", subjects)
+	}
+
+	_, err = RBACManifests("kproximate", "kube-system", "k3s-join", false)
+	if err == nil {
+		t.Error("Expected a kpJoinSecret without a namespace to fail")
+	}
+}
+
+// Splits rendered manifests into their objects.
+func parseManifests(t *testing.T, manifests []byte) []unstructured.Unstructured {
+	objects := []unstructured.Unstructured{}
+	for _, manifest := range strings.Split(string(manifests), "---\n") {
+		object := unstructured.Unstructured{}
+		err := yaml.Unmarshal([]byte(manifest), &object.Object)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		objects = append(objects, object)
+	}
+
+	return objects
+}
+
+func TestRBACManifestsOverprovisioning(t *testing.T) {
+	manifests, err := RBACManifests("kproximate", "kube-system", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, object := range parseManifests(t, manifests) {
+		if object.GetKind() == "Role" {
+			t.Errorf("Expected no Role without overprovisioning, got %s", object.GetName())
+		}
+	}
+
+	if strings.Contains(string(manifests), "- priorityclasses\n") {
+		t.Error("Expected no access to PriorityClasses without overprovisioning")
+	}
+
+	manifests, err = RBACManifests("kproximate", "kube-system", "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roles := map[string]unstructured.Unstructured{}
+	for _, object := range parseManifests(t, manifests) {
+		if object.GetKind() == "Role" || object.GetKind() == "RoleBinding" {
+			roles[object.GetKind()] = object
+		}
+	}
+
+	for _, kind := range []string{"Role", "RoleBinding"} {
+		role, ok := roles[kind]
+		if !ok || role.GetName() != "kproximate-overprovisioning" || role.GetNamespace() != "kube-system" {
+			t.Errorf("Expected a %s kproximate-overprovisioning in kube-system, got %+v", kind, role.Object)
+		}
+	}
+
+	if !strings.Contains(string(manifests), "resourceNames:\n  - "+OverprovisioningName+"\n  resources:\n  - priorityclasses\n") {
+		t.Errorf("Expected access to PriorityClasses to be scoped to the placeholder class, got:\n%s", manifests)
+	}
+}
+
+func TestSignalUnschedulablePods(t *testing.T) {
+	unschedulablePod := &apiv1.Pod{
+		Status: apiv1.PodStatus{
+			Phase: apiv1.PodPending,
+			Conditions: []apiv1.PodCondition{
+				{
+					Type:   apiv1.PodScheduled,
+					Status: apiv1.ConditionFalse,
+					Reason: apiv1.PodReasonUnschedulable,
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		event    watch.Event
+		signaled bool
+	}{
+		{
+			name:     "added unschedulable pod",
+			event:    watch.Event{Type: watch.Added, Object: unschedulablePod},
+			signaled: true,
+		},
+		{
+			name:     "modified unschedulable pod",
+			event:    watch.Event{Type: watch.Modified, Object: unschedulablePod},
+			signaled: true,
+		},
+		{
+			name:     "deleted unschedulable pod",
+			event:    watch.Event{Type: watch.Deleted, Object: unschedulablePod},
+			signaled: false,
+		},
+		{
+			name:     "pending pod not yet considered by the scheduler",
+			event:    watch.Event{Type: watch.Added, Object: &apiv1.Pod{Status: apiv1.PodStatus{Phase: apiv1.PodPending}}},
+			signaled: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := make(chan watch.Event, 1)
+			events <- tt.event
+			close(events)
+
+			unschedulable := make(chan struct{}, 1)
+			if !signalUnschedulablePods(events, unschedulable) {
+				t.Error("Expected the event to be reported as received")
+			}
+
+			if signaled := len(unschedulable) == 1; signaled != tt.signaled {
+				t.Errorf("Expected signaled to be %t, got %t", tt.signaled, signaled)
+			}
+		})
+	}
+}
+
+func TestWatchWorkloadShrinkage(t *testing.T) {
+	k := NewKubernetesMock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	shrunk := make(chan struct{}, 1)
+	go k.WatchWorkloadShrinkage(ctx, 5, shrunk)
+
+	replicas := int32(10)
+	deployment := &appsv1.Deployment{}
+	deployment.Name = "batch"
+	deployment.Namespace = "default"
+	deployment.Spec.Replicas = &replicas
+
+	deployment, err := k.client.AppsV1().Deployments("default").Create(ctx, deployment, metav1.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Scale the deployment down and back up until the informer has synced
+	// and observed a scale down
+	timeout := time.After(time.Second * 5)
+	for {
+		for _, scale := range []int32{0, 10} {
+			deployment.Spec.Replicas = &scale
+			deployment, err = k.client.AppsV1().Deployments("default").Update(ctx, deployment, metav1.UpdateOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		select {
+		case <-shrunk:
+			return
+		case <-timeout:
+			t.Fatal("Expected a signal once the deployment was scaled down")
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+}
+
+func TestNodeClassManifests(t *testing.T) {
+	manifests, err := NodeClassManifests("kproximate", "kube-system", `[{"name":"gpu"}]`, []NodePool{
+		{Name: "gpu", NodeClass: "gpu", Replicas: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"kind: ConfigMap\n",
+		"namespace: kube-system\n",
+		`kpNodeClasses: '[{"name":"gpu"}]'`,
+		"kind: NodePool\n",
+		"replicas: 2\n",
+	} {
+		if !strings.Contains(string(manifests), expected) {
+			t.Errorf("Expected the manifests to contain %q", expected)
+		}
+	}
+}
+
+func TestEnsureOverprovisioning(t *testing.T) {
+	k := NewKubernetesMock()
+	overprovisioning := Overprovisioning{
+		Namespace: "kproximate",
+		Replicas:  2,
+		Cpu:       resource.MustParse("500m"),
+		Memory:    resource.MustParse("512Mi"),
+		Priority:  -10,
+	}
+
+	err := k.EnsureOverprovisioning(context.TODO(), overprovisioning)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priorityClass, err := k.client.SchedulingV1().PriorityClasses().Get(context.TODO(), OverprovisioningName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if priorityClass.Value != -10 {
+		t.Errorf("Expected a priority of -10, got %d", priorityClass.Value)
+	}
+
+	overprovisioning.Replicas = 3
+	overprovisioning.Priority = -20
+	err = k.EnsureOverprovisioning(context.TODO(), overprovisioning)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deployment, err := k.client.AppsV1().Deployments("kproximate").Get(context.TODO(), OverprovisioningName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *deployment.Spec.Replicas != 3 {
+		t.Errorf("Expected 3 replicas, got %d", *deployment.Spec.Replicas)
+	}
+
+	if deployment.Spec.Template.Spec.PriorityClassName != OverprovisioningName {
+		t.Errorf("Expected the placeholder pods to use the %s PriorityClass, got %q", OverprovisioningName, deployment.Spec.Template.Spec.PriorityClassName)
+	}
+
+	priorityClass, err = k.client.SchedulingV1().PriorityClasses().Get(context.TODO(), OverprovisioningName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if priorityClass.Value != -20 {
+		t.Errorf("Expected the PriorityClass to be recreated with a priority of -20, got %d", priorityClass.Value)
+	}
+
+	overprovisioning.Replicas = 0
+	err = k.EnsureOverprovisioning(context.TODO(), overprovisioning)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = k.client.AppsV1().Deployments("kproximate").Get(context.TODO(), OverprovisioningName, metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Expected the placeholder pods to be removed, got %v", err)
+	}
+
+	rules := slices.Concat(ControllerRules, OverprovisioningClusterRules, OverprovisioningRules)
+	for _, action := range k.client.(*testclient.Clientset).Actions() {
+		if !rulesAllow(rules, action) {
+			t.Errorf("The overprovisioning rules do not permit %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	for _, action := range []k8stesting.Action{
+		k8stesting.NewUpdateAction(appsv1.SchemeGroupVersion.WithResource("deployments"), "default", &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web"}}),
+		k8stesting.NewDeleteAction(appsv1.SchemeGroupVersion.WithResource("deployments"), "default", "web"),
+		k8stesting.NewRootDeleteAction(schema.GroupVersionResource{Group: "scheduling.k8s.io", Version: "v1", Resource: "priorityclasses"}, "system-cluster-critical"),
+	} {
+		if rulesAllow(rules, action) {
+			t.Errorf("Expected the overprovisioning rules not to permit %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestGetUnschedulablePodsScalesUpForWholeGangs(t *testing.T) {
+	gangPod := func(name string, job string, cpu string, unschedulable string) *apiv1.Pod {
+		pod := &apiv1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "batch",
+				Labels:    map[string]string{"batch.kubernetes.io/job-name": job},
+			},
+			Spec: apiv1.PodSpec{
+				Containers: []apiv1.Container{
+					{
+						Resources: apiv1.ResourceRequirements{
+							Requests: apiv1.ResourceList{
+								apiv1.ResourceCPU:    resource.MustParse(cpu),
+								apiv1.ResourceMemory: resource.MustParse("1Gi"),
+							},
+						},
+					},
+				},
+			},
+			Status: apiv1.PodStatus{
+				Phase: apiv1.PodPending,
+			},
+		}
+
+		if unschedulable != "" {
+			pod.Status.Conditions = []apiv1.PodCondition{
+				{
+					Type:    apiv1.PodScheduled,
+					Status:  apiv1.ConditionFalse,
+					Reason:  apiv1.PodReasonUnschedulable,
+					Message: unschedulable,
+				},
+			}
+		}
+
+		return pod
+	}
+
+	k := NewKubernetesMock(
+		&apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+			},
+			Status: apiv1.NodeStatus{
+				Allocatable: apiv1.ResourceList{
+					apiv1.ResourceMemory: resource.MustParse("8Gi"),
+				},
+			},
+		},
+		// The scheduler has only tried one member of the training gang
+		gangPod("training-0", "training", "1", "0/3 nodes are available: 3 Insufficient cpu."),
+		gangPod("training-1", "training", "1", ""),
+		gangPod("training-2", "training", "1", "0/3 nodes are available: waiting for the pod group."),
+		// One member of the oversized gang is larger than any kpNode
+		gangPod("oversized-0", "oversized", "1", "0/3 nodes are available: 3 Insufficient cpu."),
+		gangPod("oversized-1", "oversized", "4", "0/3 nodes are available: 3 Insufficient cpu."),
+		// Gangs are only scaled up for once a member is unschedulable
+		gangPod("pending-0", "pending", "1", ""),
+	)
+
+	pods, err := k.GetUnschedulablePods(context.TODO(), 2, *identity.Naming{Prefix: "kp-node"}.Regex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, pod := range pods {
+		names = append(names, pod.Name)
+		if pod.Gang != "job/training" {
+			t.Errorf("Expected %s to be in gang job/training, got %q", pod.Name, pod.Gang)
+		}
+	}
+	slices.Sort(names)
+
+	expected := []string{"training-0", "training-1", "training-2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected %v to be scaled up for, got %v", expected, names)
+	}
+}
+
+func TestNodeInitFailure(t *testing.T) {
+	registered := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	node := func(ready apiv1.ConditionStatus, transitioned time.Duration, taints ...apiv1.Taint) apiv1.Node {
+		return apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				CreationTimestamp: metav1.NewTime(registered),
+			},
+			Spec: apiv1.NodeSpec{
+				Taints: taints,
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:               apiv1.NodeReady,
+						Status:             ready,
+						Reason:             "KubeletNotReady",
+						Message:            "container runtime network not ready",
+						LastTransitionTime: metav1.NewTime(registered.Add(transitioned)),
+					},
+				},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		node     apiv1.Node
+		expected string
+	}{
+		{
+			name:     "ready",
+			node:     node(apiv1.ConditionTrue, time.Minute),
+			expected: "",
+		},
+		{
+			name:     "never ready",
+			node:     node(apiv1.ConditionFalse, time.Second*5),
+			expected: "has not been ready since it registered",
+		},
+		{
+			name:     "ready before",
+			node:     node(apiv1.ConditionUnknown, time.Hour),
+			expected: "",
+		},
+		{
+			name:     "still tainted",
+			node:     node(apiv1.ConditionTrue, time.Minute, apiv1.Taint{Key: StartupTaintKey, Effect: apiv1.TaintEffectNoSchedule}),
+			expected: "still has the kproximate.io/startup taint",
+		},
+		{
+			name:     "no ready condition",
+			node:     apiv1.Node{},
+			expected: "has never reported a Ready condition",
+		},
+	}
+
+	for _, test := range tests {
+		reason := NodeInitFailure(test.node)
+		if test.expected == "" && reason != "" {
+			t.Errorf("%s: expected no init failure, got %q", test.name, reason)
+		}
+
+		if !strings.HasPrefix(reason, test.expected) {
+			t.Errorf("%s: expected %q, got %q", test.name, test.expected, reason)
+		}
+	}
+}
+
+func TestGetSecretData(t *testing.T) {
+	k := NewKubernetesMock(
+		&apiv1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "k3s-join",
+				Namespace: "kproximate",
+			},
+			Data: map[string][]byte{
+				"token": []byte("K10abc::server:def"),
+			},
+		},
+	)
+
+	data, err := k.GetSecretData(context.TODO(), "kproximate", "k3s-join")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data["token"] != "K10abc::server:def" {
+		t.Errorf("Expected the token to be read, got %v", data)
+	}
+
+	for _, action := range k.client.(*testclient.Clientset).Actions() {
+		if !rulesAllow(JoinSecretRules("k3s-join"), action) {
+			t.Errorf("JoinSecretRules do not permit %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+
+		if rulesAllow(WorkerRules, action) {
+			t.Errorf("Expected WorkerRules not to permit %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+
+	_, err = k.GetSecretData(context.TODO(), "kproximate", "missing")
+	if !apierrors.IsNotFound(err) {
+		t.Errorf("Expected a missing Secret to be not found, got %v", err)
+	}
+
+	actions := k.client.(*testclient.Clientset).Actions()
+	if rulesAllow(JoinSecretRules("k3s-join"), actions[len(actions)-1]) {
+		t.Error("Expected JoinSecretRules to only permit reading the join secret")
+	}
+}
@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// NodePools declare the number of kpNodes of a node class, in the manner of a
+// Cluster API MachineDeployment, so that node counts can be driven
+// declaratively, e.g. with "kubectl scale nodepool".
+var NodePoolResource = schema.GroupVersionResource{
+	Group:    "kproximate.io",
+	Version:  "v1alpha1",
+	Resource: "nodepools",
+}
+
+type NodePool struct {
+	Name       string
+	Generation int64
+	NodeClass  string
+	Replicas   int
+}
+
+type NodePoolStatus struct {
+	// The number of joined kpNodes of the node class
+	Replicas int `json:"replicas"`
+	// The number of those kpNodes which are ready
+	ReadyReplicas      int   `json:"readyReplicas"`
+	ObservedGeneration int64 `json:"observedGeneration"`
+}
+
+func nodePoolFromUnstructured(obj unstructured.Unstructured) (NodePool, error) {
+	nodeClass, _, err := unstructured.NestedString(obj.Object, "spec", "nodeClass")
+	if err != nil {
+		return NodePool{}, fmt.Errorf("invalid nodeClass in nodepool %s: %w", obj.GetName(), err)
+	}
+
+	replicas, _, err := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if err != nil {
+		return NodePool{}, fmt.Errorf("invalid replicas in nodepool %s: %w", obj.GetName(), err)
+	}
+
+	return NodePool{
+		Name:       obj.GetName(),
+		Generation: obj.GetGeneration(),
+		NodeClass:  nodeClass,
+		Replicas:   max(int(replicas), 0),
+	}, nil
+}
+
+func (k *KubernetesClient) GetNodePools(ctx context.Context) ([]NodePool, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	list, err := k.dynamicClient.Resource(NodePoolResource).List(rctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	nodePools := []NodePool{}
+	for _, obj := range list.Items {
+		nodePool, err := nodePoolFromUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		nodePools = append(nodePools, nodePool)
+	}
+
+	return nodePools, nil
+}
+
+func (k *KubernetesClient) UpdateNodePoolStatus(ctx context.Context, name string, status NodePoolStatus) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"status": status,
+	})
+	if err != nil {
+		return err
+	}
+
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	_, err = k.dynamicClient.Resource(NodePoolResource).Patch(
+		rctx,
+		name,
+		types.MergePatchType,
+		patch,
+		metav1.PatchOptions{},
+		"status",
+	)
+
+	return err
+}
+
+// Renders a ConfigMap named name in the namespace holding the JSON encoded
+// kpNodeClasses setting, followed by the NodePools.
+func NodeClassManifests(name string, namespace string, kpNodeClasses string, nodePools []NodePool) ([]byte, error) {
+	objects := []interface{}{
+		apiv1.ConfigMap{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: apiv1.SchemeGroupVersion.String(),
+				Kind:       "ConfigMap",
+			},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+			},
+			Data: map[string]string{
+				"kpNodeClasses": kpNodeClasses,
+			},
+		},
+	}
+
+	for _, nodePool := range nodePools {
+		objects = append(objects, map[string]interface{}{
+			"apiVersion": NodePoolResource.GroupVersion().String(),
+			"kind":       "NodePool",
+			"metadata": map[string]interface{}{
+				"name": nodePool.Name,
+			},
+			"spec": map[string]interface{}{
+				"nodeClass": nodePool.NodeClass,
+				"replicas":  nodePool.Replicas,
+			},
+		})
+	}
+
+	manifests := [][]byte{}
+	for _, object := range objects {
+		manifest, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, manifest)
+	}
+
+	return bytes.Join(manifests, []byte("---\n")), nil
+}
@@ -0,0 +1,163 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	schedulingv1 "k8s.io/api/scheduling/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The name of the Deployment of placeholder pods and of their PriorityClass
+const OverprovisioningName = "kproximate-overprovisioning"
+
+// Placeholder pods do nothing but hold their requests
+const overprovisioningImage = "registry.k8s.io/pause:3.9"
+
+// Placeholder pods reserving spare capacity so that pending pods can be
+// scheduled at once, in the manner of the cluster-autoscaler's
+// overprovisioning. Their priority is below that of any workload so that they
+// are preempted to make room, after which they are pending until kproximate
+// scales up to make room for them in turn.
+type Overprovisioning struct {
+	Namespace string
+	// The number of placeholder pods, 0 removes them
+	Replicas int
+	Cpu      resource.Quantity
+	Memory   resource.Quantity
+	// The priority of the placeholder pods, which must be below that of
+	// every workload
+	Priority int32
+}
+
+// Whether the pod is one of the placeholder pods in the namespace.
+func IsOverprovisioningPod(namespace string, pod UnschedulablePod) bool {
+	return pod.Namespace == namespace && strings.HasPrefix(pod.Name, OverprovisioningName+"-")
+}
+
+func (o Overprovisioning) priorityClass() *schedulingv1.PriorityClass {
+	preemptNever := apiv1.PreemptNever
+
+	return &schedulingv1.PriorityClass{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   OverprovisioningName,
+			Labels: map[string]string{"app.kubernetes.io/managed-by": "kproximate"},
+		},
+		Value:            o.Priority,
+		PreemptionPolicy: &preemptNever,
+		Description:      "Placeholder pods reserving spare capacity for kproximate, preempted by any workload",
+	}
+}
+
+func (o Overprovisioning) deployment() *appsv1.Deployment {
+	replicas := int32(o.Replicas)
+	labels := map[string]string{
+		"app.kubernetes.io/name":       OverprovisioningName,
+		"app.kubernetes.io/managed-by": "kproximate",
+	}
+	terminationGracePeriodSeconds := int64(0)
+	automountServiceAccountToken := false
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      OverprovisioningName,
+			Namespace: o.Namespace,
+			Labels:    labels,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: labels},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: apiv1.PodSpec{
+					PriorityClassName:             OverprovisioningName,
+					TerminationGracePeriodSeconds: &terminationGracePeriodSeconds,
+					AutomountServiceAccountToken:  &automountServiceAccountToken,
+					Containers: []apiv1.Container{
+						{
+							Name:  "placeholder",
+							Image: overprovisioningImage,
+							Resources: apiv1.ResourceRequirements{
+								Requests: apiv1.ResourceList{
+									apiv1.ResourceCPU:    o.Cpu,
+									apiv1.ResourceMemory: o.Memory,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Whether the Deployment already has the wanted replicas and requests, the
+// apiserver fills in defaults so its template can't be compared whole.
+func (o Overprovisioning) matches(deployment *appsv1.Deployment) bool {
+	if deployment.Spec.Replicas == nil || int(*deployment.Spec.Replicas) != o.Replicas {
+		return false
+	}
+
+	containers := deployment.Spec.Template.Spec.Containers
+	if len(containers) != 1 {
+		return false
+	}
+
+	requests := containers[0].Resources.Requests
+	return requests.Cpu().Equal(o.Cpu) && requests.Memory().Equal(o.Memory)
+}
+
+// Creates or updates the PriorityClass and Deployment of placeholder pods to
+// match, or deletes the Deployment when no placeholder pods are wanted.
+func (k *KubernetesClient) EnsureOverprovisioning(ctx context.Context, overprovisioning Overprovisioning) error {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	deployments := k.client.AppsV1().Deployments(overprovisioning.Namespace)
+
+	if overprovisioning.Replicas <= 0 {
+		err := deployments.Delete(rctx, OverprovisioningName, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete overprovisioning pods: %w", err)
+		}
+
+		return nil
+	}
+
+	priorityClass := overprovisioning.priorityClass()
+	current, err := k.client.SchedulingV1().PriorityClasses().Get(rctx, OverprovisioningName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = k.client.SchedulingV1().PriorityClasses().Create(rctx, priorityClass, metav1.CreateOptions{})
+	case err == nil && current.Value != priorityClass.Value:
+		// The value of a PriorityClass can't be changed
+		err = k.client.SchedulingV1().PriorityClasses().Delete(rctx, OverprovisioningName, metav1.DeleteOptions{})
+		if err == nil {
+			_, err = k.client.SchedulingV1().PriorityClasses().Create(rctx, priorityClass, metav1.CreateOptions{})
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ensure overprovisioning priority class: %w", err)
+	}
+
+	deployment := overprovisioning.deployment()
+	existing, err := deployments.Get(rctx, OverprovisioningName, metav1.GetOptions{})
+	switch {
+	case apierrors.IsNotFound(err):
+		_, err = deployments.Create(rctx, deployment, metav1.CreateOptions{})
+	case err == nil && !overprovisioning.matches(existing):
+		existing.Spec.Replicas = deployment.Spec.Replicas
+		existing.Spec.Template = deployment.Spec.Template
+		_, err = deployments.Update(rctx, existing, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to ensure overprovisioning pods: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,293 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Reading nodes and pods, through the informer cache or directly, and the
+// topology of pending pods' volumes.
+var readClusterRules = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes", "pods"},
+		Verbs:     []string{"get", "list", "watch"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"persistentvolumeclaims", "persistentvolumes"},
+		Verbs:     []string{"get"},
+	},
+}
+
+// The permissions the controller requires. It only reads the cluster, apart
+// from recording Events and the status of NodePools and reviewing the access
+// of callers of its API.
+var ControllerRules = slices.Concat(readClusterRules, []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"create"},
+	},
+	{
+		APIGroups: []string{NodePoolResource.Group},
+		Resources: []string{NodePoolResource.Resource},
+		Verbs:     []string{"list"},
+	},
+	// Needed to assess scale down as soon as workloads shrink, see
+	// scaleDownTriggerPods
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments"},
+		Verbs:     []string{"list", "watch"},
+	},
+	{
+		APIGroups: []string{"batch"},
+		Resources: []string{"jobs"},
+		Verbs:     []string{"list", "watch"},
+	},
+	{
+		APIGroups: []string{NodePoolResource.Group},
+		Resources: []string{NodePoolResource.Resource + "/status"},
+		Verbs:     []string{"patch"},
+	},
+	// Needed to scale down on actual usage, see scaleDownOnUsage
+	{
+		APIGroups: []string{NodeMetricsResource.Group},
+		Resources: []string{NodeMetricsResource.Resource},
+		Verbs:     []string{"list"},
+	},
+	// Needed to generate ScaleDownProposals, see scaleDownApproval
+	{
+		APIGroups: []string{ScaleDownProposalResource.Group},
+		Resources: []string{ScaleDownProposalResource.Resource},
+		Verbs:     []string{"list", "create", "delete"},
+	},
+	// Needed to authorize requests to the API, see apiAuth
+	{
+		APIGroups: []string{"authentication.k8s.io"},
+		Resources: []string{"tokenreviews"},
+		Verbs:     []string{"create"},
+	},
+	{
+		APIGroups: []string{"authorization.k8s.io"},
+		Resources: []string{"subjectaccessreviews"},
+		Verbs:     []string{"create"},
+	},
+})
+
+// The permissions the controller requires to maintain the PriorityClass of
+// placeholder pods when overprovisionReplicas is set. Creating can't be
+// limited by name.
+var OverprovisioningClusterRules = []rbacv1.PolicyRule{
+	{
+		APIGroups:     []string{"scheduling.k8s.io"},
+		Resources:     []string{"priorityclasses"},
+		ResourceNames: []string{OverprovisioningName},
+		Verbs:         []string{"get", "delete"},
+	},
+	{
+		APIGroups: []string{"scheduling.k8s.io"},
+		Resources: []string{"priorityclasses"},
+		Verbs:     []string{"create"},
+	},
+}
+
+// The permissions the controller requires in its own namespace to maintain
+// the Deployment of placeholder pods when overprovisionReplicas is set.
+var OverprovisioningRules = []rbacv1.PolicyRule{
+	{
+		APIGroups:     []string{"apps"},
+		Resources:     []string{"deployments"},
+		ResourceNames: []string{OverprovisioningName},
+		Verbs:         []string{"get", "update", "delete"},
+	},
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments"},
+		Verbs:     []string{"create"},
+	},
+}
+
+// The permissions workers require to label new kpNodes and to cordon, drain
+// and delete kpNodes which are removed.
+var WorkerRules = slices.Concat(readClusterRules, []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{""},
+		Resources: []string{"nodes"},
+		Verbs:     []string{"update", "delete"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods/eviction"},
+		Verbs:     []string{"create"},
+	},
+	// Needed to force delete pods stuck terminating, see drainForceDeleteSeconds
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"delete"},
+	},
+})
+
+// The permissions workers require in the namespace of the Secret they join
+// with, named by kpJoinSecret, to render credentials into the bootstrap data
+// of new kpNodes.
+func JoinSecretRules(name string) []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups:     []string{""},
+			Resources:     []string{"secrets"},
+			ResourceNames: []string{name},
+			Verbs:         []string{"get"},
+		},
+	}
+}
+
+// Renders a ClusterRole and ClusterRoleBinding granting the rules to the
+// service account.
+func clusterRoleManifests(name string, namespace string, serviceAccount string, rules []rbacv1.PolicyRule) ([]byte, error) {
+	clusterRole := rbacv1.ClusterRole{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRole",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Rules: rules,
+	}
+
+	clusterRoleBinding := rbacv1.ClusterRoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "ClusterRoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      serviceAccount,
+				Namespace: namespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "ClusterRole",
+			Name:     name,
+		},
+	}
+
+	return marshalManifests(clusterRole, clusterRoleBinding)
+}
+
+// Renders a Role and RoleBinding in the namespace granting the rules to the
+// service account in serviceAccountNamespace.
+func roleManifests(name string, namespace string, serviceAccount string, serviceAccountNamespace string, rules []rbacv1.PolicyRule) ([]byte, error) {
+	role := rbacv1.Role{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "Role",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Rules: rules,
+	}
+
+	roleBinding := rbacv1.RoleBinding{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: rbacv1.SchemeGroupVersion.String(),
+			Kind:       "RoleBinding",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Subjects: []rbacv1.Subject{
+			{
+				Kind:      rbacv1.ServiceAccountKind,
+				Name:      serviceAccount,
+				Namespace: serviceAccountNamespace,
+			},
+		},
+		RoleRef: rbacv1.RoleRef{
+			APIGroup: rbacv1.GroupName,
+			Kind:     "Role",
+			Name:     name,
+		},
+	}
+
+	return marshalManifests(role, roleBinding)
+}
+
+func marshalManifests(objects ...interface{}) ([]byte, error) {
+	manifests := [][]byte{}
+	for _, object := range objects {
+		manifest, err := yaml.Marshal(object)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, manifest)
+	}
+
+	return bytes.Join(manifests, []byte("---\n")), nil
+}
+
+// Renders the RBAC for a kproximate installation, where the controller runs
+// as the service account name in the namespace and workers as name-worker.
+// Workers are only granted reading the join secret, in its own namespace, when
+// kpJoinSecret is given as namespace/name. The controller is only granted
+// maintaining placeholder pods in the namespace when overprovisioning.
+func RBACManifests(name string, namespace string, kpJoinSecret string, overprovisioning bool) ([]byte, error) {
+	controllerRules := ControllerRules
+	if overprovisioning {
+		controllerRules = slices.Concat(ControllerRules, OverprovisioningClusterRules)
+	}
+
+	controller, err := clusterRoleManifests(name, namespace, name, controllerRules)
+	if err != nil {
+		return nil, err
+	}
+
+	worker, err := clusterRoleManifests(name+"-worker", namespace, name+"-worker", WorkerRules)
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := [][]byte{controller, worker}
+	if kpJoinSecret != "" {
+		secretNamespace, secretName, ok := strings.Cut(kpJoinSecret, "/")
+		if !ok {
+			return nil, fmt.Errorf("kpJoinSecret should be namespace/name, got %s", kpJoinSecret)
+		}
+
+		joinSecret, err := roleManifests(name+"-worker-join-secret", secretNamespace, name+"-worker", namespace, JoinSecretRules(secretName))
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, joinSecret)
+	}
+
+	if overprovisioning {
+		placeholders, err := roleManifests(name+"-overprovisioning", namespace, name, namespace, OverprovisioningRules)
+		if err != nil {
+			return nil, err
+		}
+
+		manifests = append(manifests, placeholders)
+	}
+
+	return bytes.Join(manifests, []byte("---\n")), nil
+}
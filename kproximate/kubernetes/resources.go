@@ -0,0 +1,202 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Whether the resource is an extended resource, such as nvidia.com/gpu
+// advertised by a device plugin, or hugepages. Other resources within the
+// kubernetes.io namespace, e.g. ephemeral-storage, are not tracked.
+func IsExtendedResource(name apiv1.ResourceName) bool {
+	if strings.HasPrefix(string(name), apiv1.ResourceHugePagesPrefix) {
+		return true
+	}
+
+	return strings.Contains(string(name), "/") && !strings.Contains(string(name), "kubernetes.io/")
+}
+
+// Sums the extended resources in the resource lists, rounding each quantity
+// up to a whole unit. Returns nil when there are none.
+func extendedResources(resourceLists ...apiv1.ResourceList) map[string]int64 {
+	var extended map[string]int64
+	for _, resourceList := range resourceLists {
+		for name, quantity := range resourceList {
+			if !IsExtendedResource(name) || quantity.IsZero() {
+				continue
+			}
+
+			if extended == nil {
+				extended = map[string]int64{}
+			}
+
+			extended[string(name)] += quantity.Value()
+		}
+	}
+
+	return extended
+}
+
+func containerRequests(containers []apiv1.Container) []apiv1.ResourceList {
+	requests := make([]apiv1.ResourceList, 0, len(containers))
+	for _, container := range containers {
+		requests = append(requests, container.Resources.Requests)
+	}
+
+	return requests
+}
+
+// The resources requested by the pod's containers.
+func PodRequests(pod apiv1.Pod) UnschedulableResources {
+	var requests UnschedulableResources
+	for _, container := range pod.Spec.Containers {
+		requests.Cpu += container.Resources.Requests.Cpu().AsApproximateFloat64()
+		requests.Memory += container.Resources.Requests.Memory().Value()
+	}
+	requests.Extended = extendedResources(containerRequests(pod.Spec.Containers)...)
+
+	return requests
+}
+
+// Returned by PodUnschedulableResources for a pod which no kpNode could
+// satisfy.
+var ErrUnsatisfiableRequest = errors.New("unsatisfiable request")
+
+// The resources the pod could not be scheduled for, according to the
+// messages of its Unschedulable conditions, e.g. "Insufficient cpu". A pod
+// with a container requesting at least maxPodCpu cores or maxPodMemory bytes
+// returns ErrUnsatisfiableRequest, as no kpNode could fit it.
+func PodUnschedulableResources(pod apiv1.Pod, maxPodCpu int64, maxPodMemory float64) (UnschedulableResources, error) {
+	var cpu float64
+	var memory float64
+	var extended map[string]int64
+
+	for _, condition := range pod.Status.Conditions {
+		if !isUnschedulable(condition) {
+			continue
+		}
+
+		if strings.Contains(condition.Message, "Insufficient cpu") {
+			for _, container := range pod.Spec.Containers {
+				if container.Resources.Requests.Cpu().CmpInt64(maxPodCpu) >= 0 {
+					return UnschedulableResources{}, fmt.Errorf("%w: Cpu %f", ErrUnsatisfiableRequest, container.Resources.Requests.Cpu().AsApproximateFloat64())
+				}
+
+				cpu += container.Resources.Requests.Cpu().AsApproximateFloat64()
+			}
+		}
+
+		if strings.Contains(condition.Message, "Insufficient memory") {
+			for _, container := range pod.Spec.Containers {
+				if container.Resources.Requests.Memory().AsApproximateFloat64() >= maxPodMemory {
+					return UnschedulableResources{}, fmt.Errorf("%w: Memory %f", ErrUnsatisfiableRequest, container.Resources.Requests.Memory().AsApproximateFloat64())
+				}
+
+				memory += container.Resources.Requests.Memory().AsApproximateFloat64()
+			}
+		}
+
+		for name, quantity := range extendedResources(containerRequests(pod.Spec.Containers)...) {
+			if !strings.Contains(condition.Message, "Insufficient "+name) {
+				continue
+			}
+
+			if extended == nil {
+				extended = map[string]int64{}
+			}
+			extended[name] += quantity
+		}
+	}
+
+	return UnschedulableResources{
+		Cpu:      cpu,
+		Memory:   int64(memory),
+		Extended: extended,
+	}, nil
+}
+
+// The total resources the pods could not be scheduled for.
+func SumUnschedulableResources(pods []UnschedulablePod) UnschedulableResources {
+	var total UnschedulableResources
+	for _, pod := range pods {
+		total.Cpu += pod.Cpu
+		total.Memory += pod.Memory
+		total.Extended = addExtended(total.Extended, pod.Extended)
+	}
+
+	return total
+}
+
+// The resources requested by the pods, which are allocated from the node
+// they are bound to.
+func PodsAllocatedResources(pods []apiv1.Pod) AllocatedResources {
+	var allocated AllocatedResources
+	for _, pod := range pods {
+		for _, container := range pod.Spec.Containers {
+			allocated.Cpu += container.Resources.Requests.Cpu().AsApproximateFloat64()
+			allocated.Memory += container.Resources.Requests.Memory().AsApproximateFloat64()
+		}
+
+		allocated.Extended = addExtended(allocated.Extended, extendedResources(containerRequests(pod.Spec.Containers)...))
+	}
+
+	return allocated
+}
+
+// The total resources the nodes can allocate to pods, rounding each node's
+// cpu and memory down to a whole unit.
+func NodesAllocatableResources(nodes []apiv1.Node) WorkerNodesAllocatableResources {
+	var allocatable WorkerNodesAllocatableResources
+	for _, node := range nodes {
+		allocatable.Cpu += int64(node.Status.Allocatable.Cpu().AsApproximateFloat64())
+		allocatable.Memory += int64(node.Status.Allocatable.Memory().AsApproximateFloat64())
+		allocatable.Extended = addExtended(allocatable.Extended, NodeExtendedResources(node))
+	}
+
+	return allocatable
+}
+
+// The most memory in bytes any one of the nodes can allocate, the largest
+// request a single pod could be scheduled for.
+func MaxAllocatableMemory(nodes []apiv1.Node) float64 {
+	var maxAllocatable float64
+	for _, node := range nodes {
+		maxAllocatable = max(maxAllocatable, node.Status.Allocatable.Memory().AsApproximateFloat64())
+	}
+
+	return maxAllocatable
+}
+
+// The extended resources the node can allocate to pods
+func NodeExtendedResources(node apiv1.Node) map[string]int64 {
+	return extendedResources(node.Status.Allocatable)
+}
+
+// Whether no resources are required
+func (r UnschedulableResources) IsZero() bool {
+	return r.Cpu == 0 && r.Memory == 0 && len(r.Extended) == 0
+}
+
+func (r UnschedulableResources) Equal(other UnschedulableResources) bool {
+	return r.Cpu == other.Cpu && r.Memory == other.Memory && maps.Equal(r.Extended, other.Extended)
+}
+
+func addExtended(total map[string]int64, extended map[string]int64) map[string]int64 {
+	if len(extended) == 0 {
+		return total
+	}
+
+	if total == nil {
+		total = map[string]int64{}
+	}
+
+	for name, quantity := range extended {
+		total[name] += quantity
+	}
+
+	return total
+}
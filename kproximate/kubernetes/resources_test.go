@@ -0,0 +1,275 @@
+package kubernetes
+
+import (
+	"errors"
+	"maps"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func requestingPod(message string, requests ...apiv1.ResourceList) apiv1.Pod {
+	pod := apiv1.Pod{}
+	for _, request := range requests {
+		pod.Spec.Containers = append(pod.Spec.Containers, apiv1.Container{
+			Resources: apiv1.ResourceRequirements{Requests: request},
+		})
+	}
+
+	if message != "" {
+		pod.Status.Conditions = []apiv1.PodCondition{
+			{
+				Type:    apiv1.PodScheduled,
+				Status:  apiv1.ConditionFalse,
+				Reason:  apiv1.PodReasonUnschedulable,
+				Message: message,
+			},
+		}
+	}
+
+	return pod
+}
+
+func resources(cpu string, memory string) apiv1.ResourceList {
+	return apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse(cpu),
+		apiv1.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+func TestPodUnschedulableResources(t *testing.T) {
+	gpu := apiv1.ResourceList{
+		apiv1.ResourceCPU:                    resource.MustParse("500m"),
+		apiv1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+	}
+
+	tests := []struct {
+		name          string
+		pod           apiv1.Pod
+		expected      UnschedulableResources
+		unsatisfiable bool
+	}{
+		{
+			name:     "not unschedulable",
+			pod:      requestingPod("", resources("1", "1Gi")),
+			expected: UnschedulableResources{},
+		},
+		{
+			name:     "insufficient cpu",
+			pod:      requestingPod("0/3 nodes are available: 3 Insufficient cpu.", resources("1", "1Gi"), resources("500m", "1Gi")),
+			expected: UnschedulableResources{Cpu: 1.5},
+		},
+		{
+			name:     "insufficient cpu and memory",
+			pod:      requestingPod("0/3 nodes are available: 3 Insufficient cpu, 3 Insufficient memory.", resources("1", "1Gi")),
+			expected: UnschedulableResources{Cpu: 1, Memory: 1073741824},
+		},
+		{
+			name:     "insufficient extended resource",
+			pod:      requestingPod("0/3 nodes are available: 3 Insufficient nvidia.com/gpu.", gpu),
+			expected: UnschedulableResources{Extended: map[string]int64{"nvidia.com/gpu": 1}},
+		},
+		{
+			name:          "cpu no kpNode could provide",
+			pod:           requestingPod("0/3 nodes are available: 3 Insufficient cpu.", resources("2", "1Gi")),
+			unsatisfiable: true,
+		},
+		{
+			name:          "memory no kpNode could provide",
+			pod:           requestingPod("0/3 nodes are available: 3 Insufficient memory.", resources("1", "4Gi")),
+			unsatisfiable: true,
+		},
+	}
+
+	for _, test := range tests {
+		unschedulable, err := PodUnschedulableResources(test.pod, 2, 4294967296)
+		if test.unsatisfiable {
+			if !errors.Is(err, ErrUnsatisfiableRequest) {
+				t.Errorf("%s: expected ErrUnsatisfiableRequest, got %v", test.name, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+
+		if !unschedulable.Equal(test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, unschedulable)
+		}
+	}
+}
+
+func TestPodRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		pod      apiv1.Pod
+		expected UnschedulableResources
+	}{
+		{
+			name:     "no containers",
+			pod:      apiv1.Pod{},
+			expected: UnschedulableResources{},
+		},
+		{
+			name:     "summed across containers",
+			pod:      requestingPod("", resources("250m", "512Mi"), resources("750m", "512Mi")),
+			expected: UnschedulableResources{Cpu: 1, Memory: 1073741824},
+		},
+		{
+			name: "extended resources",
+			pod: requestingPod("", apiv1.ResourceList{
+				apiv1.ResourceName("nvidia.com/gpu"):    resource.MustParse("2"),
+				apiv1.ResourceName("hugepages-2Mi"):     resource.MustParse("4Mi"),
+				apiv1.ResourceName("ephemeral-storage"): resource.MustParse("1Gi"),
+			}),
+			expected: UnschedulableResources{Extended: map[string]int64{"nvidia.com/gpu": 2, "hugepages-2Mi": 4194304}},
+		},
+	}
+
+	for _, test := range tests {
+		requests := PodRequests(test.pod)
+		if !requests.Equal(test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, requests)
+		}
+	}
+}
+
+func TestSumUnschedulableResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		pods     []UnschedulablePod
+		expected UnschedulableResources
+	}{
+		{
+			name:     "no pods",
+			pods:     nil,
+			expected: UnschedulableResources{},
+		},
+		{
+			name: "summed",
+			pods: []UnschedulablePod{
+				{UnschedulableResources: UnschedulableResources{Cpu: 1.5, Memory: 1024}},
+				{UnschedulableResources: UnschedulableResources{Cpu: 0.5, Extended: map[string]int64{"nvidia.com/gpu": 1}}},
+				{UnschedulableResources: UnschedulableResources{Memory: 2048, Extended: map[string]int64{"nvidia.com/gpu": 2}}},
+			},
+			expected: UnschedulableResources{Cpu: 2, Memory: 3072, Extended: map[string]int64{"nvidia.com/gpu": 3}},
+		},
+	}
+
+	for _, test := range tests {
+		total := SumUnschedulableResources(test.pods)
+		if !total.Equal(test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, total)
+		}
+	}
+}
+
+func TestPodsAllocatedResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		pods     []apiv1.Pod
+		expected AllocatedResources
+	}{
+		{
+			name:     "no pods",
+			pods:     nil,
+			expected: AllocatedResources{},
+		},
+		{
+			name: "summed across pods and containers",
+			pods: []apiv1.Pod{
+				requestingPod("", resources("500m", "1Gi"), resources("250m", "512Mi")),
+				requestingPod("", resources("250m", "512Mi"), apiv1.ResourceList{
+					apiv1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+				}),
+			},
+			expected: AllocatedResources{Cpu: 1, Memory: 2147483648, Extended: map[string]int64{"nvidia.com/gpu": 1}},
+		},
+	}
+
+	for _, test := range tests {
+		allocated := PodsAllocatedResources(test.pods)
+		if allocated.Cpu != test.expected.Cpu || allocated.Memory != test.expected.Memory || !maps.Equal(allocated.Extended, test.expected.Extended) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, allocated)
+		}
+	}
+}
+
+func allocatableNode(allocatable apiv1.ResourceList) apiv1.Node {
+	return apiv1.Node{Status: apiv1.NodeStatus{Allocatable: allocatable}}
+}
+
+func TestNodesAllocatableResources(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []apiv1.Node
+		expected WorkerNodesAllocatableResources
+	}{
+		{
+			name:     "no nodes",
+			nodes:    nil,
+			expected: WorkerNodesAllocatableResources{},
+		},
+		{
+			name: "rounded down per node",
+			nodes: []apiv1.Node{
+				allocatableNode(resources("1900m", "3Gi")),
+				allocatableNode(resources("2", "4Gi")),
+			},
+			expected: WorkerNodesAllocatableResources{Cpu: 3, Memory: 7516192768},
+		},
+		{
+			name: "extended resources",
+			nodes: []apiv1.Node{
+				allocatableNode(apiv1.ResourceList{
+					apiv1.ResourceCPU:                    resource.MustParse("4"),
+					apiv1.ResourceName("nvidia.com/gpu"): resource.MustParse("1"),
+				}),
+				allocatableNode(apiv1.ResourceList{
+					apiv1.ResourceName("nvidia.com/gpu"): resource.MustParse("2"),
+				}),
+			},
+			expected: WorkerNodesAllocatableResources{Cpu: 4, Extended: map[string]int64{"nvidia.com/gpu": 3}},
+		},
+	}
+
+	for _, test := range tests {
+		allocatable := NodesAllocatableResources(test.nodes)
+		if allocatable.Cpu != test.expected.Cpu || allocatable.Memory != test.expected.Memory || !maps.Equal(allocatable.Extended, test.expected.Extended) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, allocatable)
+		}
+	}
+}
+
+func TestMaxAllocatableMemory(t *testing.T) {
+	tests := []struct {
+		name     string
+		nodes    []apiv1.Node
+		expected float64
+	}{
+		{
+			name:     "no nodes",
+			nodes:    nil,
+			expected: 0,
+		},
+		{
+			name: "largest node",
+			nodes: []apiv1.Node{
+				allocatableNode(resources("2", "2Gi")),
+				allocatableNode(resources("2", "8Gi")),
+				allocatableNode(resources("2", "4Gi")),
+			},
+			expected: 8589934592,
+		},
+	}
+
+	for _, test := range tests {
+		maxAllocatable := MaxAllocatableMemory(test.nodes)
+		if maxAllocatable != test.expected {
+			t.Errorf("%s: expected %f, got %f", test.name, test.expected, maxAllocatable)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package kubernetes
+
+import (
+	"context"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Returns the data of the Secret by key, e.g. the join token kpNodes are
+// bootstrapped with. The Secret is read from the apiserver on every call so
+// that a rotated Secret is seen as soon as it is updated.
+func (k *KubernetesClient) GetSecretData(ctx context.Context, namespace string, name string) (map[string]string, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	secret, err := k.client.CoreV1().Secrets(namespace).Get(rctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	data := map[string]string{}
+	for key, value := range secret.Data {
+		data[key] = string(value)
+	}
+
+	for key, value := range secret.StringData {
+		data[key] = value
+	}
+
+	return data, nil
+}
@@ -0,0 +1,123 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+)
+
+// kpNodes registered with this taint, e.g. using the kubelet's
+// --register-with-taints, are kept free of workloads until they are found to
+// be healthy.
+const StartupTaintKey = "kproximate.io/startup"
+
+const nodeHealthCheckInterval = time.Second * 5
+
+// Node conditions which must not be true for a node to be healthy
+var unhealthyNodeConditions = []apiv1.NodeConditionType{
+	apiv1.NodeMemoryPressure,
+	apiv1.NodeDiskPressure,
+	apiv1.NodePIDPressure,
+	apiv1.NodeNetworkUnavailable,
+}
+
+// Why the node is not yet healthy, or empty once it is. A healthy node is
+// ready, under no resource pressure and the pods already running on it, such
+// as its CNI, are ready.
+func (k *KubernetesClient) nodeUnhealthyReason(ctx context.Context, nodeName string) (string, error) {
+	rctx, cancel := k.requestContext(ctx)
+	node, err := k.client.CoreV1().Nodes().Get(rctx, nodeName, metav1.GetOptions{})
+	cancel()
+	if err != nil {
+		return "", err
+	}
+
+	if ready, observed := nodeReadyCondition(node); !ready {
+		return observed, nil
+	}
+
+	for _, condition := range node.Status.Conditions {
+		if slices.Contains(unhealthyNodeConditions, condition.Type) && condition.Status == apiv1.ConditionTrue {
+			return fmt.Sprintf("%s=True (%s)", condition.Type, condition.Reason), nil
+		}
+	}
+
+	pods, err := k.listPodsOnNode(ctx, nodeName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, pod := range pods {
+		if pod.Status.Phase == apiv1.PodSucceeded || pod.Status.Phase == apiv1.PodFailed {
+			continue
+		}
+
+		if !isPodReady(pod) {
+			return fmt.Sprintf("pod %s/%s is not ready", pod.Namespace, pod.Name), nil
+		}
+	}
+
+	return "", nil
+}
+
+func isPodReady(pod apiv1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// Waits for the kpNode to be healthy then removes the startup taint, letting
+// workloads be scheduled on it. On timeout the returned error describes why
+// the kpNode was last found unhealthy.
+func (k *KubernetesClient) UntaintKpNode(ctx context.Context, kpNodeName string) error {
+	for {
+		reason, err := k.nodeUnhealthyReason(ctx, kpNodeName)
+		if err != nil {
+			reason = fmt.Sprintf("failed to check health: %s", err)
+		}
+
+		if err == nil && reason == "" {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s to become healthy, last observed: %s", kpNodeName, reason)
+		case <-time.After(nodeHealthCheckInterval):
+		}
+	}
+
+	return retry.RetryOnConflict(
+		retry.DefaultRetry,
+		func() error {
+			rctx, cancel := k.requestContext(ctx)
+			defer cancel()
+
+			kpNode, err := k.client.CoreV1().Nodes().Get(rctx, kpNodeName, metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+
+			taints := slices.DeleteFunc(slices.Clone(kpNode.Spec.Taints), func(taint apiv1.Taint) bool {
+				return taint.Key == StartupTaintKey
+			})
+			if len(taints) == len(kpNode.Spec.Taints) {
+				return nil
+			}
+
+			kpNode.Spec.Taints = taints
+			_, err = k.client.CoreV1().Nodes().Update(rctx, kpNode, metav1.UpdateOptions{})
+
+			return err
+		},
+	)
+}
@@ -0,0 +1,70 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// The resource usage of nodes reported by metrics-server
+var NodeMetricsResource = schema.GroupVersionResource{
+	Group:    "metrics.k8s.io",
+	Version:  "v1beta1",
+	Resource: "nodes",
+}
+
+func nodeUsageFromUnstructured(obj unstructured.Unstructured) (AllocatedResources, error) {
+	usage, _, err := unstructured.NestedStringMap(obj.Object, "usage")
+	if err != nil {
+		return AllocatedResources{}, fmt.Errorf("invalid usage of node %s: %w", obj.GetName(), err)
+	}
+
+	cpu, err := resource.ParseQuantity(usage["cpu"])
+	if err != nil {
+		return AllocatedResources{}, fmt.Errorf("invalid cpu usage of node %s: %w", obj.GetName(), err)
+	}
+
+	memory, err := resource.ParseQuantity(usage["memory"])
+	if err != nil {
+		return AllocatedResources{}, fmt.Errorf("invalid memory usage of node %s: %w", obj.GetName(), err)
+	}
+
+	return AllocatedResources{
+		Cpu:    cpu.AsApproximateFloat64(),
+		Memory: memory.AsApproximateFloat64(),
+	}, nil
+}
+
+// Returns the cpu and memory each kpNode is actually using according to
+// metrics-server, which must be installed. kpNodes which metrics-server has
+// not yet reported on, e.g. those which have just joined, are left out.
+func (k *KubernetesClient) GetKpNodesUsage(ctx context.Context, kpNodeNameRegex regexp.Regexp) (map[string]AllocatedResources, error) {
+	rctx, cancel := k.requestContext(ctx)
+	defer cancel()
+
+	list, err := k.dynamicClient.Resource(NodeMetricsResource).List(rctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node metrics, is metrics-server installed? %w", err)
+	}
+
+	usage := map[string]AllocatedResources{}
+	for _, obj := range list.Items {
+		if !kpNodeNameRegex.MatchString(obj.GetName()) {
+			continue
+		}
+
+		nodeUsage, err := nodeUsageFromUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		usage[obj.GetName()] = nodeUsage
+	}
+
+	return usage, nil
+}
@@ -0,0 +1,100 @@
+package kubernetes
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lupinelab/kproximate/logger"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+func deploymentReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas == nil {
+		return 1
+	}
+
+	return *deployment.Spec.Replicas
+}
+
+func isJobFinished(job *batchv1.Job) bool {
+	for _, condition := range job.Status.Conditions {
+		if (condition.Type == batchv1.JobComplete || condition.Type == batchv1.JobFailed) && condition.Status == apiv1.ConditionTrue {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The object of a delete notification, which may be a tombstone if the watch
+// missed the deletion.
+func deletedObject[T any](obj any) (T, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	object, ok := obj.(T)
+	return object, ok
+}
+
+// Signals on shrunk whenever a Deployment is scaled down or deleted, or a Job
+// finishes or is deleted, releasing at least minPods pods, until the context
+// is done. Signals are dropped while a previous signal is still waiting to be
+// received.
+func (k *KubernetesClient) WatchWorkloadShrinkage(ctx context.Context, minPods int, shrunk chan<- struct{}) {
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		k.client,
+		0,
+		informers.WithTransform(stripManagedFields),
+	)
+
+	signal := func(workload string, released int32) {
+		if released <= 0 || int(released) < minPods {
+			return
+		}
+
+		logger.DebugLog("Workload shrank", "workload", workload, "released", released)
+		select {
+		case shrunk <- struct{}{}:
+		default:
+		}
+	}
+
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			old, oldOk := oldObj.(*appsv1.Deployment)
+			updated, updatedOk := newObj.(*appsv1.Deployment)
+			if oldOk && updatedOk {
+				signal(fmt.Sprintf("deployment/%s/%s", updated.Namespace, updated.Name), deploymentReplicas(old)-deploymentReplicas(updated))
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if deployment, ok := deletedObject[*appsv1.Deployment](obj); ok {
+				signal(fmt.Sprintf("deployment/%s/%s", deployment.Namespace, deployment.Name), deploymentReplicas(deployment))
+			}
+		},
+	})
+
+	factory.Batch().V1().Jobs().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			old, oldOk := oldObj.(*batchv1.Job)
+			updated, updatedOk := newObj.(*batchv1.Job)
+			if oldOk && updatedOk && !isJobFinished(old) && isJobFinished(updated) {
+				signal(fmt.Sprintf("job/%s/%s", updated.Namespace, updated.Name), old.Status.Active)
+			}
+		},
+		DeleteFunc: func(obj any) {
+			if job, ok := deletedObject[*batchv1.Job](obj); ok && !isJobFinished(job) {
+				signal(fmt.Sprintf("job/%s/%s", job.Namespace, job.Name), job.Status.Active)
+			}
+		},
+	})
+
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	factory.Shutdown()
+}
@@ -25,6 +25,11 @@ var (
 		Help: "The number of running kproximate nodes",
 	})
 
+	maxKpNodes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "kpnodes_max",
+		Help: "The maximum number of kproximate nodes, maxKpNodes or the limit derived from Proxmox free capacity with maxKpNodesAuto",
+	})
+
 	totalProvisionedCpu = promauto.NewGauge(prometheus.GaugeOpts{
 		Name: "cpu_provisioned_total",
 		Help: "The total provisioned cpus",
@@ -54,13 +59,206 @@ var (
 		Name: "memory_allocated_total",
 		Help: "The total memory allocated",
 	})
+
+	scaleUpPaused = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scale_up_paused",
+		Help: "Set to 1 while scale up is held back because the Proxmox cluster cannot fit another kproximate node",
+	})
+
+	scaleUpBurst = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "scale_up_burst",
+		Help: "Set to 1 while scale up events are published in a burst as pending pods require at least burstThreshold kproximate nodes",
+	})
+
+	bootstrapping = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "bootstrapping",
+		Help: "Set to 1 while the cluster has only control-plane nodes and bootstrap is provisioning its first workers",
+	})
+
+	bootstrapScaleEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "bootstrap_scale_events_total",
+		Help: "The number of scale up events published to provision the first workers of a cluster with only control-plane nodes",
+	})
+
+	proxmoxDegraded = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "proxmox_degraded",
+		Help: "Set to 1 while scaling is paused because the Proxmox cluster has lost quorum or a host is offline",
+	})
+
+	scaleEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scale_events",
+		Help: "The number of recent scale events in each state reported by workers",
+	}, []string{"state"})
+
+	scaleEventFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "scale_event_failures_total",
+		Help: "The number of failed scale events reported by workers by failure category",
+	}, []string{"category"})
+
+	queueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scale_event_queue_depth",
+		Help: "The number of scale events in each queue which are pending or running on a worker",
+	}, []string{"queue", "state"})
+
+	queueOldestScaleEventAge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scale_event_queue_oldest_seconds",
+		Help: "The age in seconds of the oldest unfinished scale event published to each queue",
+	}, []string{"queue"})
+
+	stuckScaleEvents = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "scale_events_stuck",
+		Help: "The number of scale events in each queue which have not finished within stuckScaleEventSeconds",
+	}, []string{"queue"})
+
+	vmIDCollisions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "vmid_collisions_total",
+		Help: "The number of times a VMID was taken before a kproximate node could be cloned with it, causing the clone to be retried",
+	})
+
+	initFailedKpNodes = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "init_failed_kpnodes_total",
+		Help: "The number of kproximate nodes recycled because they joined but never became schedulable within initFailedSeconds",
+	})
+
+	costPerHour = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kpnode_cost_per_hour",
+		Help: "The estimated hourly cost of the kproximate nodes of each node class at costPerCoreHour and costPerGiBHour",
+	}, []string{"node_class"})
+
+	accruedCost = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "kpnode_cost_total",
+		Help: "The estimated cost of the kproximate nodes accrued while the controller has been running",
+	})
+
+	observedScaleEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "observed_scale_events_total",
+		Help: "The number of scale events an observer mode controller would have published by type",
+	}, []string{"type"})
 )
 
+func init() {
+	// Categories are exported from the start so alerts see 0 rather than no data
+	for _, category := range scaler.FailureCategories {
+		scaleEventFailures.WithLabelValues(category)
+	}
+}
+
+func IncScaleEventFailures(category string) {
+	if category == "" {
+		category = scaler.FailureUnknown
+	}
+
+	scaleEventFailures.WithLabelValues(category).Inc()
+}
+
+// Sets the number of recent scale events in each state, states which are not
+// given are reset to 0.
+func SetScaleEventStates(counts map[string]int) {
+	for _, state := range []string{
+		scaler.ScaleEventCloning,
+		scaler.ScaleEventStarted,
+		scaler.ScaleEventJoined,
+		scaler.ScaleEventDeleted,
+		scaler.ScaleEventFailed,
+		scaler.ScaleEventCancelled,
+	} {
+		scaleEvents.WithLabelValues(state).Set(float64(counts[state]))
+	}
+}
+
+func SetQueueDepth(queueName string, pending int, running int) {
+	queueDepth.WithLabelValues(queueName, "pending").Set(float64(pending))
+	queueDepth.WithLabelValues(queueName, "running").Set(float64(running))
+}
+
+func SetQueueOldestScaleEventAge(queueName string, age time.Duration) {
+	queueOldestScaleEventAge.WithLabelValues(queueName).Set(age.Seconds())
+}
+
+func SetStuckScaleEvents(queueName string, stuck int) {
+	stuckScaleEvents.WithLabelValues(queueName).Set(float64(stuck))
+}
+
+func IncInitFailedKpNodes() {
+	initFailedKpNodes.Inc()
+}
+
+func IncVmIDCollisions() {
+	vmIDCollisions.Inc()
+}
+
+func IncObservedScaleEvents(scaleType string) {
+	observedScaleEvents.WithLabelValues(scaleType).Inc()
+}
+
+func SetMaxKpNodes(max int) {
+	maxKpNodes.Set(float64(max))
+}
+
+func SetScaleUpPaused(paused bool) {
+	if paused {
+		scaleUpPaused.Set(1)
+		return
+	}
+
+	scaleUpPaused.Set(0)
+}
+
+func SetScaleUpBurst(burst bool) {
+	if burst {
+		scaleUpBurst.Set(1)
+		return
+	}
+
+	scaleUpBurst.Set(0)
+}
+
+func SetBootstrapping(active bool) {
+	if active {
+		bootstrapping.Set(1)
+		return
+	}
+
+	bootstrapping.Set(0)
+}
+
+func IncBootstrapScaleEvents() {
+	bootstrapScaleEvents.Inc()
+}
+
+func SetProxmoxDegraded(degraded bool) {
+	if degraded {
+		proxmoxDegraded.Set(1)
+		return
+	}
+
+	proxmoxDegraded.Set(0)
+}
+
+// Sets the hourly cost of each node class and adds the cost of running the
+// kpNodes for the elapsed time to the accrued cost.
+func recordCost(ctx context.Context, scaler scaler.Scaler, elapsed time.Duration) {
+	estimate, err := scaler.EstimateCost(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to estimate cost", "error", err)
+		return
+	}
+
+	costPerHour.Reset()
+	for nodeClass, hourlyCost := range estimate.NodeClassHourlyCost {
+		costPerHour.WithLabelValues(nodeClass).Set(hourlyCost)
+	}
+
+	accruedCost.Add(estimate.HourlyCost * elapsed.Hours())
+}
+
 func recordMetrics(
 	ctx context.Context,
 	scaler scaler.Scaler,
-	config config.KproximateConfig,
+	currentConfig func() config.KproximateConfig,
 ) {
+	lastRecorded := time.Now()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -68,16 +266,24 @@ func recordMetrics(
 		default:
 			time.Sleep(5 * time.Second)
 
+			config := currentConfig()
+
 			numKpNodes, _ := scaler.NumNodes()
 			totalKpNodes.Set(float64(numKpNodes))
 
-			runningNodes, _ := scaler.NumReadyNodes()
+			runningNodes, _ := scaler.NumReadyNodes(ctx)
 			runningKpNodes.Set(float64(runningNodes))
 
+			if config.CostPerCoreHour > 0 || config.CostPerGiBHour > 0 {
+				now := time.Now()
+				recordCost(ctx, scaler, now.Sub(lastRecorded))
+				lastRecorded = now
+			}
+
 			totalProvisionedCpu.Set(float64(runningNodes * config.KpNodeCores))
 			totalProvisionedMemory.Set(float64(runningNodes * (config.KpNodeMemory << 20)))
 
-			resourceStats, err := scaler.GetResourceStatistics()
+			resourceStats, err := scaler.GetResourceStatistics(ctx)
 			if err != nil {
 				logger.ErrorLog("Failed to get resource stats", "error", err)
 				continue
@@ -92,33 +298,58 @@ func recordMetrics(
 	}
 }
 
+// Registers /metrics on http.DefaultServeMux and serves requests with the
+// handler, which defaults to http.DefaultServeMux when nil. currentConfig is
+// called on each recording so that reloaded settings are picked up.
 func Serve(
 	ctx context.Context,
 	scaler scaler.Scaler,
-	config config.KproximateConfig,
+	currentConfig func() config.KproximateConfig,
+	handler http.Handler,
 ) {
+	go recordMetrics(ctx, scaler, currentConfig)
+
+	http.Handle(
+		"/metrics",
+		promhttp.HandlerFor(
+			newRegistry(),
+			promhttp.HandlerOpts{},
+		),
+	)
+
+	http.ListenAndServe(":80", handler)
+}
+
+// The registry of the metrics served by kproximate.
+func newRegistry() *prometheus.Registry {
 	registry := prometheus.NewRegistry()
 
 	registry.MustRegister(
 		totalKpNodes,
 		runningKpNodes,
+		maxKpNodes,
 		totalProvisionedCpu,
 		totalProvisionedMemory,
 		totalAllocatableCpu,
 		totalAllocatableMemory,
 		totalAllocatedCpu,
 		totalAllocatedMemory,
+		scaleUpPaused,
+		scaleUpBurst,
+		bootstrapping,
+		bootstrapScaleEvents,
+		proxmoxDegraded,
+		scaleEvents,
+		scaleEventFailures,
+		observedScaleEvents,
+		queueDepth,
+		queueOldestScaleEventAge,
+		stuckScaleEvents,
+		initFailedKpNodes,
+		vmIDCollisions,
+		costPerHour,
+		accruedCost,
 	)
 
-	go recordMetrics(ctx, scaler, config)
-
-	http.Handle(
-		"/metrics",
-		promhttp.HandlerFor(
-			registry,
-			promhttp.HandlerOpts{},
-		),
-	)
-
-	http.ListenAndServe(":80", nil)
+	return registry
 }
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func TestRegistryServesVmIDCollisions(t *testing.T) {
+	IncVmIDCollisions()
+
+	recorder := httptest.NewRecorder()
+	promhttp.HandlerFor(newRegistry(), promhttp.HandlerOpts{}).ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	if !strings.Contains(recorder.Body.String(), "vmid_collisions_total 1") {
+		t.Errorf("Expected vmid_collisions_total to be scraped, got:\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,244 @@
+// Package provision provisions and removes kpNodes in the same way as
+// kproximate's workers, so that other Go programs can manage kpNodes
+// directly rather than by publishing scale events to the queue.
+//
+// Progress is reported to the scaler.ProgressReporter of the context, see
+// scaler.WithProgressReporter. Cancelling the context abandons the operation.
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// The most time a kpNode may take to drain and be removed
+const scaleDownTimeout = time.Second * 300
+
+// Returned when a cancellable scale up event is skipped as there are no
+// longer any unschedulable pods.
+var ErrNotRequired = errors.New("scale event is no longer required")
+
+type Provisioner struct {
+	scaler scaler.Scaler
+}
+
+// Connects to Proxmox and Kubernetes using the config, see
+// config.GetKpConfig.
+func New(kpConfig config.KproximateConfig) (*Provisioner, error) {
+	kubeClient, err := kubernetes.NewKubernetesClient(scaler.KubernetesClientOptions(kpConfig))
+	if err != nil {
+		return nil, err
+	}
+
+	kpScaler, err := scaler.NewProxmoxScaler(kpConfig, &kubeClient)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFromScaler(kpScaler), nil
+}
+
+func NewFromScaler(kpScaler scaler.Scaler) *Provisioner {
+	return &Provisioner{
+		scaler: kpScaler,
+	}
+}
+
+// The scaler the Provisioner uses, e.g. to run a preflight check
+func (p *Provisioner) Scaler() scaler.Scaler {
+	return p.scaler
+}
+
+// Clones, starts and joins a kpNode of the node class, the first configured
+// node class if empty, and returns its name. A kpNode which fails to join is
+// deleted.
+func (p *Provisioner) Provision(ctx context.Context, nodeClass string) (string, error) {
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType: scaler.ScaleTypeUp,
+		NodeClass: nodeClass,
+	}
+
+	err := p.ScaleUp(ctx, scaleEvent, false)
+
+	return scaleEvent.NodeName, err
+}
+
+// Drains the kpNode and removes it from the Kubernetes cluster before deleting
+// its VM.
+func (p *Provisioner) Remove(ctx context.Context, nodeName string) error {
+	return p.ScaleDown(ctx, &scaler.ScaleEvent{
+		ScaleType: scaler.ScaleTypeDown,
+		NodeName:  nodeName,
+	})
+}
+
+// Processes a scale up, replace, migrate or patch event. Any kpNode left behind by a
+// previous attempt at the scale event is deleted first when retrying, and the
+// kpNode is deleted again if it fails to join.
+func (p *Provisioner) ScaleUp(ctx context.Context, scaleEvent *scaler.ScaleEvent, retrying bool) error {
+	// Migrate and patch events name an existing kpNode which must not be
+	// deleted
+	switch scaleEvent.ScaleType {
+	case scaler.ScaleTypeMigrate:
+		return p.migrate(ctx, scaleEvent, retrying)
+	case scaler.ScaleTypePatch:
+		return p.patch(ctx, scaleEvent, retrying)
+	}
+
+	// Warm kpNodes never join the cluster, the scaler removes any left behind
+	// by a previous attempt itself
+	if scaleEvent.Warm {
+		return p.warm(ctx, scaleEvent, retrying)
+	}
+
+	if retrying {
+		// A replacement which joined on a previous attempt is kept, only the
+		// removal of the kpNode it replaces is retried
+		if scaleEvent.ScaleType == scaler.ScaleTypeReplace {
+			joined, err := p.scaler.KpNodeJoined(ctx, scaleEvent.NodeName)
+			if err != nil {
+				logger.WarnLog("Failed to check whether the replacement joined", "error", err)
+			} else if joined {
+				logger.InfoLog(fmt.Sprintf("Retrying removal of %s, replaced by %s", scaleEvent.ReplaceNodeName, scaleEvent.NodeName))
+				return p.removeReplaced(ctx, scaleEvent, scaleEvent.ReplaceNodeName)
+			}
+		}
+
+		p.scaler.DeleteNode(ctx, scaleEvent.NodeName)
+		logger.InfoLog(fmt.Sprintf("Retrying scale up event: %s", scaleEvent.NodeName))
+	} else {
+		logger.InfoLog(fmt.Sprintf("Triggered scale up event: %s", scaleEvent.NodeName))
+	}
+
+	// Skip scale up events whose pending pods have been scheduled since the
+	// event was queued, before a kpNode is needlessly provisioned
+	if scaleEvent.ScaleType == scaler.ScaleTypeUp && scaleEvent.Cancellable {
+		required, err := p.scaler.HasUnschedulableResources(ctx)
+		if err != nil {
+			logger.WarnLog("Failed to check for unschedulable resources", "error", err)
+		} else if !required {
+			logger.InfoLog(fmt.Sprintf("Cancelled scale up event, no longer required: %s", scaleEvent.NodeName))
+			scaler.ReportProgress(ctx, scaleEvent, scaler.ScaleEventCancelled, "No longer required")
+			return ErrNotRequired
+		}
+	}
+
+	var err error
+	if scaleEvent.ScaleType == scaler.ScaleTypeReplace {
+		logger.InfoLog(fmt.Sprintf("Replacing %s with %s", scaleEvent.ReplaceNodeName, scaleEvent.NodeName))
+		err = p.scaler.Replace(ctx, scaleEvent)
+	} else {
+		err = p.scaler.ScaleUp(ctx, scaleEvent)
+	}
+
+	var replacedErr *scaler.ReplacedNodeError
+	if errors.As(err, &replacedErr) {
+		logger.WarnLog("Failed to remove replaced kpNode, retrying", "error", err.Error())
+		return p.removeReplaced(ctx, scaleEvent, replacedErr.NodeName)
+	}
+
+	if err != nil {
+		logger.WarnLog("Scale up event failed", "error", err.Error())
+		scaler.ReportFailure(ctx, scaleEvent, err)
+		p.scaler.DeleteNode(ctx, scaleEvent.NodeName)
+		return err
+	}
+
+	return nil
+}
+
+// Retries the removal of a kpNode whose replacement has joined, leaving the
+// replacement in place if it fails again.
+func (p *Provisioner) removeReplaced(ctx context.Context, scaleEvent *scaler.ScaleEvent, replacedNodeName string) error {
+	err := p.scaler.RemoveReplaced(ctx, replacedNodeName)
+	if err != nil {
+		logger.WarnLog("Failed to remove replaced kpNode", "error", err.Error())
+		scaler.ReportFailure(ctx, scaleEvent, err)
+		return err
+	}
+
+	return nil
+}
+
+func (p *Provisioner) migrate(ctx context.Context, migrateEvent *scaler.ScaleEvent, retrying bool) error {
+	if retrying {
+		logger.InfoLog(fmt.Sprintf("Retrying migrate event: %s", migrateEvent.NodeName))
+	} else {
+		logger.InfoLog(fmt.Sprintf("Triggered migrate event: %s", migrateEvent.NodeName))
+	}
+
+	err := p.scaler.Migrate(ctx, migrateEvent)
+	var replacedErr *scaler.ReplacedNodeError
+	if errors.As(err, &replacedErr) {
+		logger.WarnLog("Failed to remove unmigrated kpNode, retrying", "error", err.Error())
+		return p.removeReplaced(ctx, migrateEvent, replacedErr.NodeName)
+	}
+
+	if err != nil {
+		logger.WarnLog("Migrate event failed", "error", err.Error())
+		scaler.ReportFailure(ctx, migrateEvent, err)
+		return err
+	}
+
+	return nil
+}
+
+func (p *Provisioner) warm(ctx context.Context, warmEvent *scaler.ScaleEvent, retrying bool) error {
+	if retrying {
+		logger.InfoLog(fmt.Sprintf("Retrying warm kpNode event: %s", warmEvent.NodeName))
+	} else {
+		logger.InfoLog(fmt.Sprintf("Triggered warm kpNode event: %s", warmEvent.NodeName))
+	}
+
+	err := p.scaler.ScaleUp(ctx, warmEvent)
+	if err != nil {
+		logger.WarnLog("Warm kpNode event failed", "error", err.Error())
+		scaler.ReportFailure(ctx, warmEvent, err)
+		return err
+	}
+
+	return nil
+}
+
+func (p *Provisioner) patch(ctx context.Context, patchEvent *scaler.ScaleEvent, retrying bool) error {
+	if retrying {
+		logger.InfoLog(fmt.Sprintf("Retrying patch event: %s", patchEvent.NodeName))
+	} else {
+		logger.InfoLog(fmt.Sprintf("Triggered patch event: %s", patchEvent.NodeName))
+	}
+
+	err := p.scaler.Patch(ctx, patchEvent)
+	if err != nil {
+		logger.WarnLog("Patch event failed", "error", err.Error())
+		scaler.ReportFailure(ctx, patchEvent, err)
+		return err
+	}
+
+	return nil
+}
+
+// Processes a scale down event, giving up if the kpNode has not been removed
+// within 5 minutes.
+func (p *Provisioner) ScaleDown(ctx context.Context, scaleEvent *scaler.ScaleEvent) error {
+	scaleCtx, scaleCancel := context.WithTimeout(ctx, scaleDownTimeout)
+	defer scaleCancel()
+
+	err := p.scaler.ScaleDown(scaleCtx, scaleEvent)
+	if err != nil {
+		logger.WarnLog(fmt.Sprintf("Scale down event failed: %s", err.Error()))
+		scaler.ReportFailure(ctx, scaleEvent, err)
+		return err
+	}
+
+	logger.InfoLog(fmt.Sprintf("Deleted %s", scaleEvent.NodeName))
+	scaler.ReportProgress(ctx, scaleEvent, scaler.ScaleEventDeleted, "")
+
+	return nil
+}
@@ -0,0 +1,216 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Records the kpNodes it is asked to provision and delete. Calls to any other
+// method of scaler.Scaler panic.
+type scalerMock struct {
+	scaler.Scaler
+	scaleUpErr    error
+	unschedulable bool
+	scaledUp      []string
+	deleted       []string
+	migrated      []string
+	// Whether removing a replaced kpNode fails
+	removeErr error
+	removed   []string
+	joined    bool
+}
+
+func (m *scalerMock) ScaleUp(ctx context.Context, scaleEvent *scaler.ScaleEvent) error {
+	if scaleEvent.NodeName == "" {
+		scaleEvent.NodeName = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	}
+
+	m.scaledUp = append(m.scaledUp, scaleEvent.NodeName)
+	return m.scaleUpErr
+}
+
+func (m *scalerMock) DeleteNode(ctx context.Context, kpNodeName string) error {
+	m.deleted = append(m.deleted, kpNodeName)
+	return nil
+}
+
+func (m *scalerMock) Migrate(ctx context.Context, scaleEvent *scaler.ScaleEvent) error {
+	m.migrated = append(m.migrated, scaleEvent.NodeName)
+	return nil
+}
+
+func (m *scalerMock) Replace(ctx context.Context, scaleEvent *scaler.ScaleEvent) error {
+	err := m.ScaleUp(ctx, scaleEvent)
+	if err != nil {
+		return err
+	}
+
+	return m.RemoveReplaced(ctx, scaleEvent.ReplaceNodeName)
+}
+
+func (m *scalerMock) RemoveReplaced(ctx context.Context, replacedNodeName string) error {
+	m.removed = append(m.removed, replacedNodeName)
+	if m.removeErr != nil {
+		return &scaler.ReplacedNodeError{NodeName: replacedNodeName, Err: m.removeErr}
+	}
+
+	return nil
+}
+
+func (m *scalerMock) KpNodeJoined(ctx context.Context, kpNodeName string) (bool, error) {
+	return m.joined, nil
+}
+
+func (m *scalerMock) HasUnschedulableResources(ctx context.Context) (bool, error) {
+	return m.unschedulable, nil
+}
+
+func TestProvision(t *testing.T) {
+	mock := &scalerMock{}
+
+	nodeName, err := NewFromScaler(mock).Provision(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nodeName != "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd" {
+		t.Errorf("Expected the name of the provisioned kpNode, got %q", nodeName)
+	}
+
+	if len(mock.deleted) != 0 {
+		t.Errorf("Expected no kpNodes to be deleted, got %v", mock.deleted)
+	}
+}
+
+func TestProvisionDeletesFailedKpNode(t *testing.T) {
+	mock := &scalerMock{scaleUpErr: errors.New("timed out waiting for node to join")}
+
+	nodeName, err := NewFromScaler(mock).Provision(context.Background(), "")
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if !slices.Equal(mock.deleted, []string{nodeName}) {
+		t.Errorf("Expected %s to be deleted, got %v", nodeName, mock.deleted)
+	}
+}
+
+func TestScaleUpRetryDeletesPreviousAttempt(t *testing.T) {
+	mock := &scalerMock{}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType: scaler.ScaleTypeUp,
+		NodeName:  "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(mock.deleted, []string{scaleEvent.NodeName}) || !slices.Equal(mock.scaledUp, []string{scaleEvent.NodeName}) {
+		t.Errorf("Expected %s to be deleted then provisioned again, deleted: %v, provisioned: %v", scaleEvent.NodeName, mock.deleted, mock.scaledUp)
+	}
+}
+
+func TestScaleUpCancelled(t *testing.T) {
+	mock := &scalerMock{}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType:   scaler.ScaleTypeUp,
+		NodeName:    "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+		Cancellable: true,
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, false)
+	if !errors.Is(err, ErrNotRequired) {
+		t.Errorf("Expected ErrNotRequired, got %v", err)
+	}
+
+	if len(mock.scaledUp) != 0 {
+		t.Errorf("Expected no kpNode to be provisioned, got %v", mock.scaledUp)
+	}
+}
+
+func TestScaleUpRetriedMigrateKeepsKpNode(t *testing.T) {
+	mock := &scalerMock{}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType: scaler.ScaleTypeMigrate,
+		NodeName:  "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mock.deleted) != 0 || !slices.Equal(mock.migrated, []string{scaleEvent.NodeName}) {
+		t.Errorf("Expected %s to be migrated and not deleted, deleted: %v, migrated: %v", scaleEvent.NodeName, mock.deleted, mock.migrated)
+	}
+}
+
+func TestFailedWarmEventDoesNotDeleteKpNode(t *testing.T) {
+	mock := &scalerMock{scaleUpErr: errors.New("clone failed")}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType: scaler.ScaleTypeUp,
+		NodeName:  "kp-node-warm-a4f77d63-a944-425d-a980-e7be925b8a6a",
+		Warm:      true,
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, true)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if len(mock.deleted) != 0 || !slices.Equal(mock.scaledUp, []string{scaleEvent.NodeName}) {
+		t.Errorf("Expected %s to be cloned and not deleted as a kpNode, deleted: %v, scaled up: %v", scaleEvent.NodeName, mock.deleted, mock.scaledUp)
+	}
+}
+
+func TestReplaceKeepsReplacementWhenRemovalFails(t *testing.T) {
+	mock := &scalerMock{removeErr: errors.New("timed out draining kpNode")}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType:       scaler.ScaleTypeReplace,
+		NodeName:        "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+		ReplaceNodeName: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, false)
+
+	var replacedErr *scaler.ReplacedNodeError
+	if !errors.As(err, &replacedErr) {
+		t.Errorf("Expected a ReplacedNodeError, got %v", err)
+	}
+
+	if len(mock.deleted) != 0 {
+		t.Errorf("Expected the replacement to be kept, deleted: %v", mock.deleted)
+	}
+
+	if !slices.Equal(mock.removed, []string{scaleEvent.ReplaceNodeName, scaleEvent.ReplaceNodeName}) {
+		t.Errorf("Expected the removal of %s to be retried, got %v", scaleEvent.ReplaceNodeName, mock.removed)
+	}
+}
+
+func TestReplaceRetryOnlyRemovesReplacedKpNode(t *testing.T) {
+	mock := &scalerMock{joined: true}
+	scaleEvent := &scaler.ScaleEvent{
+		ScaleType:       scaler.ScaleTypeReplace,
+		NodeName:        "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+		ReplaceNodeName: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+	}
+
+	err := NewFromScaler(mock).ScaleUp(context.Background(), scaleEvent, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mock.deleted) != 0 || len(mock.scaledUp) != 0 {
+		t.Errorf("Expected the joined replacement to be kept, deleted: %v, provisioned: %v", mock.deleted, mock.scaledUp)
+	}
+
+	if !slices.Equal(mock.removed, []string{scaleEvent.ReplaceNodeName}) {
+		t.Errorf("Expected only %s to be removed, got %v", scaleEvent.ReplaceNodeName, mock.removed)
+	}
+}
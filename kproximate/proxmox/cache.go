@@ -0,0 +1,137 @@
+package proxmox
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+)
+
+type cacheEntry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// Caches the cluster resource and VM lists for a short time so that the many
+// lookups made while assessing scaling share a few requests to the Proxmox
+// API. Any request which changes a VM invalidates the cache.
+type cachingClient struct {
+	ProxmoxClientInterface
+	ttl time.Duration
+
+	mu sync.Mutex
+	// Keyed by resource type
+	resources map[string]cacheEntry[[]interface{}]
+	vmList    *cacheEntry[map[string]interface{}]
+}
+
+func newCachingClient(client ProxmoxClientInterface, ttl time.Duration) *cachingClient {
+	return &cachingClient{
+		ProxmoxClientInterface: client,
+		ttl:                    ttl,
+		resources:              map[string]cacheEntry[[]interface{}]{},
+	}
+}
+
+func (c *cachingClient) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.resources = map[string]cacheEntry[[]interface{}]{}
+	c.vmList = nil
+}
+
+func (c *cachingClient) GetResourceList(resourceType string) ([]interface{}, error) {
+	c.mu.Lock()
+	entry, ok := c.resources[resourceType]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	list, err := c.ProxmoxClientInterface.GetResourceList(resourceType)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.resources[resourceType] = cacheEntry[[]interface{}]{value: list, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return list, nil
+}
+
+func (c *cachingClient) GetVmList() (map[string]interface{}, error) {
+	c.mu.Lock()
+	entry := c.vmList
+	c.mu.Unlock()
+	if entry != nil && time.Now().Before(entry.expires) {
+		return entry.value, nil
+	}
+
+	list, err := c.ProxmoxClientInterface.GetVmList()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.vmList = &cacheEntry[map[string]interface{}]{value: list, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+
+	return list, nil
+}
+
+func (c *cachingClient) CloneQemuVm(vmr *proxmox.VmRef, vmParams map[string]interface{}) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.CloneQemuVm(vmr, vmParams)
+}
+
+func (c *cachingClient) DeleteVm(vmr *proxmox.VmRef) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.DeleteVm(vmr)
+}
+
+func (c *cachingClient) MigrateNode(vmr *proxmox.VmRef, newTargetNode string, online bool) (interface{}, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.MigrateNode(vmr, newTargetNode, online)
+}
+
+func (c *cachingClient) Post(params map[string]interface{}, url string) error {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.Post(params, url)
+}
+
+func (c *cachingClient) Put(params map[string]interface{}, url string) error {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.Put(params, url)
+}
+
+func (c *cachingClient) ResizeQemuDiskRaw(vmr *proxmox.VmRef, disk string, size string) (interface{}, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.ResizeQemuDiskRaw(vmr, disk, size)
+}
+
+func (c *cachingClient) RebootVm(vmr *proxmox.VmRef) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.RebootVm(vmr)
+}
+
+func (c *cachingClient) SetVmConfig(vmr *proxmox.VmRef, params map[string]interface{}) (interface{}, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.SetVmConfig(vmr, params)
+}
+
+func (c *cachingClient) ShutdownVm(vmr *proxmox.VmRef) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.ShutdownVm(vmr)
+}
+
+func (c *cachingClient) StartVm(vmr *proxmox.VmRef) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.StartVm(vmr)
+}
+
+func (c *cachingClient) StopVm(vmr *proxmox.VmRef) (string, error) {
+	defer c.invalidate()
+	return c.ProxmoxClientInterface.StopVm(vmr)
+}
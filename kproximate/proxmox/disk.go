@@ -0,0 +1,244 @@
+package proxmox
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+	"github.com/mitchellh/mapstructure"
+)
+
+// The size a kpNode's root disk is grown to after it has been cloned.
+type RootDisk struct {
+	// The disk to resize, e.g. scsi0
+	Device string
+	// In GiB, the disk is left at the template's size when 0
+	Size int
+}
+
+func (p *ProxmoxClient) resizeRootDisk(vmRef *proxmox.VmRef, rootDisk RootDisk) error {
+	_, err := p.client.ResizeQemuDiskRaw(vmRef, rootDisk.Device, fmt.Sprintf("%dG", rootDisk.Size))
+	if err != nil {
+		return fmt.Errorf("could not resize %s to %dG: %w", rootDisk.Device, rootDisk.Size, err)
+	}
+
+	return nil
+}
+
+// The number of disks each bus supports
+var busSlots = map[string]int{
+	"ide":    4,
+	"sata":   6,
+	"scsi":   31,
+	"virtio": 16,
+}
+
+// An additional disk created on a kpNode after it has been cloned.
+type DataDisk struct {
+	// scsi, virtio, sata or ide
+	Bus string
+	// The Proxmox storage the disk is created on, defaults to the storage of
+	// the root disk
+	Storage string
+	// In GiB
+	Size int
+	// Lets the guest identify the disk under /dev/disk/by-id
+	Serial string
+}
+
+// Disk devices in a VM config, e.g. scsi0
+var diskDevice = regexp.MustCompile(`^(ide|sata|scsi|virtio)\d+$`)
+
+type storageResource struct {
+	Storage string `mapstructure:"storage"`
+	Shared  int    `mapstructure:"shared"`
+}
+
+// Returns the storage a disk is stored on from its config, e.g. local-lvm
+// from local-lvm:vm-100-disk-0,size=8G
+func diskStorage(diskConfig string) string {
+	storage, _, _ := strings.Cut(diskConfig, ":")
+	return storage
+}
+
+// Returns the storage the root disk of the template a kpNode on the target
+// node is cloned from is stored on, which the clone is created on too.
+func (p *ProxmoxClient) GetKpNodeTemplateStorage(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string, rootDisk string) (string, error) {
+	kpNodeTemplate, err := p.GetKpNodeTemplateRef(kpNodeTemplateName, localTemplateStorage, cloneTargetNode)
+	if err != nil {
+		return "", err
+	}
+
+	vmConfig, err := p.client.GetVmConfig(kpNodeTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	diskConfig, ok := vmConfig[rootDisk].(string)
+	if !ok {
+		return "", fmt.Errorf("template %s has no %s disk", kpNodeTemplateName, rootDisk)
+	}
+
+	return diskStorage(diskConfig), nil
+}
+
+// Assigns each data disk to the first free slot of its bus and returns the VM
+// config which creates them.
+func dataDiskParams(vmConfig map[string]interface{}, dataDisks []DataDisk, rootDisk string) (map[string]interface{}, error) {
+	params := map[string]interface{}{}
+
+	for _, dataDisk := range dataDisks {
+		slots, ok := busSlots[dataDisk.Bus]
+		if !ok {
+			return nil, fmt.Errorf("unsupported disk bus: %s", dataDisk.Bus)
+		}
+
+		storage := dataDisk.Storage
+		if storage == "" {
+			rootDiskConfig, _ := vmConfig[rootDisk].(string)
+			storage = diskStorage(rootDiskConfig)
+		}
+
+		if storage == "" {
+			return nil, fmt.Errorf("could not determine the storage for data disk %s", dataDisk.Serial)
+		}
+
+		device := ""
+		for slot := 0; slot < slots; slot++ {
+			candidate := fmt.Sprintf("%s%d", dataDisk.Bus, slot)
+			_, inConfig := vmConfig[candidate]
+			_, inParams := params[candidate]
+			if !inConfig && !inParams {
+				device = candidate
+				break
+			}
+		}
+
+		if device == "" {
+			return nil, fmt.Errorf("no free %s slot for data disk %s", dataDisk.Bus, dataDisk.Serial)
+		}
+
+		// Proxmox allocates a new volume when given storage:size
+		params[device] = fmt.Sprintf("%s:%d,serial=%s", storage, dataDisk.Size, dataDisk.Serial)
+	}
+
+	return params, nil
+}
+
+func (p *ProxmoxClient) attachDataDisks(vmRef *proxmox.VmRef, dataDisks []DataDisk, rootDisk string) error {
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return err
+	}
+
+	params, err := dataDiskParams(vmConfig, dataDisks, rootDisk)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.client.SetVmConfig(vmRef, params)
+	if err != nil {
+		return fmt.Errorf("could not attach data disks: %w", err)
+	}
+
+	return nil
+}
+
+// Returns the VM config which excludes each disk from backup jobs. CD drives,
+// including the cloud-init drive, are never backed up so are left alone.
+func backupExclusionParams(vmConfig map[string]interface{}) map[string]interface{} {
+	params := map[string]interface{}{}
+
+	for device, value := range vmConfig {
+		diskConfig, ok := value.(string)
+		if !ok || !diskDevice.MatchString(device) || strings.Contains(diskConfig, "media=cdrom") {
+			continue
+		}
+
+		options := strings.Split(diskConfig, ",")
+		if slices.Contains(options, "backup=0") {
+			continue
+		}
+
+		options = slices.DeleteFunc(options, func(option string) bool {
+			return strings.HasPrefix(option, "backup=")
+		})
+		params[device] = strings.Join(append(options, "backup=0"), ",")
+	}
+
+	return params
+}
+
+// Sets backup=0 on each of the kpNode's disks, so that backup jobs which
+// select every VM on a pHost don't back up ephemeral kpNodes.
+func (p *ProxmoxClient) excludeDisksFromBackup(vmRef *proxmox.VmRef) error {
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return err
+	}
+
+	params := backupExclusionParams(vmConfig)
+	if len(params) == 0 {
+		return nil
+	}
+
+	_, err = p.client.SetVmConfig(vmRef, params)
+	if err != nil {
+		return fmt.Errorf("could not exclude disks from backup: %w", err)
+	}
+
+	return nil
+}
+
+// Whether any disk of the kpNode, including its cloud-init drive, is on
+// storage which is not shared between pHosts, so would have to be copied for
+// the kpNode to be migrated.
+func (p *ProxmoxClient) KpNodeHasLocalDisks(name string) (bool, error) {
+	vmRef, err := p.client.GetVmRefByName(name)
+	if err != nil {
+		return false, err
+	}
+
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return false, err
+	}
+
+	resources, err := p.client.GetResourceList("storage")
+	if err != nil {
+		return false, err
+	}
+
+	var storages []storageResource
+	err = mapstructure.WeakDecode(resources, &storages)
+	if err != nil {
+		return false, err
+	}
+
+	sharedStorages := []string{}
+	for _, storage := range storages {
+		if storage.Shared == 1 {
+			sharedStorages = append(sharedStorages, storage.Storage)
+		}
+	}
+
+	for key, value := range vmConfig {
+		diskConfig, ok := value.(string)
+		if !ok || !diskDevice.MatchString(key) {
+			continue
+		}
+
+		// Empty cd drives, e.g. none,media=cdrom, have no storage
+		if !strings.Contains(diskConfig, ":") {
+			continue
+		}
+
+		if !slices.Contains(sharedStorages, diskStorage(diskConfig)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
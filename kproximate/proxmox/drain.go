@@ -0,0 +1,92 @@
+package proxmox
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// pHosts with this marker in their notes are drained of kpNodes, e.g. ahead
+// of a planned shutdown.
+const DrainHostMarker = "kproximate-drain"
+
+type haStatusEntry struct {
+	Type   string `mapstructure:"type"`
+	Node   string `mapstructure:"node"`
+	Status string `mapstructure:"status"`
+}
+
+// Returns the online pHosts which are being shut down or maintained, those
+// the HA manager reports in maintenance mode and those with DrainHostMarker
+// in their notes.
+func (p *ProxmoxClient) GetDrainingHosts() ([]string, error) {
+	status, err := p.GetClusterStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	draining := []string{}
+
+	// Hosts have no HA status unless the HA manager is in use
+	result, err := p.client.GetItemList("/cluster/ha/status/current")
+	if err == nil {
+		var entries []haStatusEntry
+		err = mapstructure.WeakDecode(result["data"], &entries)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.Type == "node" && strings.Contains(entry.Status, "maintenance") {
+				draining = append(draining, entry.Node)
+			}
+		}
+	}
+
+	for _, host := range status.Hosts {
+		if !host.Online || slices.Contains(draining, host.Name) {
+			continue
+		}
+
+		result, err := p.client.GetItemList(fmt.Sprintf("/nodes/%s/config", host.Name))
+		if err != nil {
+			return nil, err
+		}
+
+		config, _ := result["data"].(map[string]interface{})
+		notes, _ := config["description"].(string)
+		if strings.Contains(notes, DrainHostMarker) {
+			draining = append(draining, host.Name)
+		}
+	}
+
+	slices.Sort(draining)
+
+	return draining, nil
+}
+
+// Live migrates a running kpNode, along with any local disks, to the
+// targetHost.
+func (p *ProxmoxClient) MigrateKpNode(name string, targetHost string) error {
+	vmRef, err := p.client.GetVmRefByName(name)
+	if err != nil {
+		return err
+	}
+
+	if vmRef.Node() == targetHost {
+		return nil
+	}
+
+	exitStatus, err := p.client.MigrateNode(vmRef, targetHost, true)
+	if err != nil {
+		return err
+	}
+
+	if status, ok := exitStatus.(string); ok && !exitStatusSuccess.MatchString(status) {
+		return fmt.Errorf("failed to migrate %s to %s: %s", name, targetHost, status)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package proxmox
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+)
+
+var netInterface = regexp.MustCompile(`^net\d+$`)
+
+// Proxmox firewall settings applied to a kpNode before it is first started.
+type Firewall struct {
+	Enabled bool
+	// Cluster level security groups assigned to the VM
+	SecurityGroups []string
+	// ACCEPT, REJECT or DROP, left to the Proxmox default when empty
+	PolicyIn  string
+	PolicyOut string
+}
+
+// Enables the firewall on each of the network interfaces of a VM, the
+// Proxmox VM firewall has no effect on interfaces without firewall=1.
+func firewallNetParams(vmConfig map[string]interface{}) map[string]interface{} {
+	params := map[string]interface{}{}
+
+	for key, value := range vmConfig {
+		netConfig, ok := value.(string)
+		if !ok || !netInterface.MatchString(key) {
+			continue
+		}
+
+		options := []string{}
+		for _, option := range strings.Split(netConfig, ",") {
+			if !strings.HasPrefix(option, "firewall=") {
+				options = append(options, option)
+			}
+		}
+		params[key] = strings.Join(append(options, "firewall=1"), ",")
+	}
+
+	return params
+}
+
+func (p *ProxmoxClient) configureFirewall(vmRef *proxmox.VmRef, firewall Firewall) error {
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return err
+	}
+
+	netParams := firewallNetParams(vmConfig)
+	if len(netParams) > 0 {
+		_, err = p.client.SetVmConfig(vmRef, netParams)
+		if err != nil {
+			return err
+		}
+	}
+
+	firewallUrl := fmt.Sprintf("/nodes/%s/qemu/%d/firewall", vmRef.Node(), vmRef.VmId())
+
+	options := map[string]interface{}{
+		"enable": 1,
+	}
+	if firewall.PolicyIn != "" {
+		options["policy_in"] = firewall.PolicyIn
+	}
+	if firewall.PolicyOut != "" {
+		options["policy_out"] = firewall.PolicyOut
+	}
+
+	err = p.client.Put(options, firewallUrl+"/options")
+	if err != nil {
+		return fmt.Errorf("could not set firewall options: %w", err)
+	}
+
+	for _, group := range firewall.SecurityGroups {
+		rule := map[string]interface{}{
+			"type":   "group",
+			"action": group,
+			"enable": 1,
+		}
+
+		err = p.client.Post(rule, firewallUrl+"/rules")
+		if err != nil {
+			return fmt.Errorf("could not assign security group %s: %w", group, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,53 @@
+package proxmox
+
+import (
+	"github.com/mitchellh/mapstructure"
+)
+
+// The quorum and membership of the Proxmox cluster.
+type ClusterStatus struct {
+	// Always true for a standalone host
+	Quorate bool
+	Hosts   []ClusterHostStatus
+}
+
+type ClusterHostStatus struct {
+	Name   string
+	Online bool
+}
+
+type clusterStatusEntry struct {
+	Type    string `mapstructure:"type"`
+	Name    string `mapstructure:"name"`
+	Quorate int    `mapstructure:"quorate"`
+	Online  int    `mapstructure:"online"`
+}
+
+func (p *ProxmoxClient) GetClusterStatus() (ClusterStatus, error) {
+	result, err := p.client.GetItemList("/cluster/status")
+	if err != nil {
+		return ClusterStatus{}, err
+	}
+
+	var entries []clusterStatusEntry
+	err = mapstructure.WeakDecode(result["data"], &entries)
+	if err != nil {
+		return ClusterStatus{}, err
+	}
+
+	// A standalone host has no cluster entry
+	status := ClusterStatus{Quorate: true}
+	for _, entry := range entries {
+		switch entry.Type {
+		case "cluster":
+			status.Quorate = entry.Quorate == 1
+		case "node":
+			status.Hosts = append(status.Hosts, ClusterHostStatus{
+				Name:   entry.Name,
+				Online: entry.Online == 1,
+			})
+		}
+	}
+
+	return status, nil
+}
@@ -0,0 +1,101 @@
+package proxmox
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// A kpNode VM shut down by a scale down and kept to be resumed.
+type HibernatedKpNode struct {
+	VmInformation
+	Metadata KpNodeMetadata
+}
+
+// Shuts down a kpNode and tags it as hibernated so that it is no longer
+// considered a kpNode. Falls back to stopping the VM if the guest does not
+// shut down.
+func (p *ProxmoxClient) HibernateKpNode(name string, kpNodeNameRegex regexp.Regexp) error {
+	kpNode, err := p.GetKpNode(name, kpNodeNameRegex)
+	if err != nil {
+		return err
+	}
+
+	if kpNode.Name == "" {
+		return fmt.Errorf("could not find kpNode %s", name)
+	}
+
+	vmRef, err := p.client.GetVmRefByName(kpNode.Name)
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return err
+	}
+
+	description, _ := vmConfig["description"].(string)
+	metadata := ParseKpNodeMetadata(description)
+	metadata.Hibernated = time.Now()
+	metadata.ExtraTags = kpNode.extraTags()
+
+	exitStatus, err := p.client.ShutdownVm(vmRef)
+	if err != nil || !exitStatusSuccess.MatchString(exitStatus) {
+		exitStatus, err = p.client.StopVm(vmRef)
+		if err != nil {
+			return err
+		}
+
+		if !exitStatusSuccess.MatchString(exitStatus) {
+			return errors.New(exitStatus)
+		}
+	}
+
+	_, err = p.client.SetVmConfig(vmRef, map[string]interface{}{
+		"description": metadata.Description(),
+		"tags":        metadata.Tags(),
+	})
+
+	return err
+}
+
+// Returns the hibernated kpNodes of this instance along with the metadata
+// recording when they were hibernated.
+func (p *ProxmoxClient) GetHibernatedKpNodes() ([]HibernatedKpNode, error) {
+	vms, err := p.getTaggedVms(HibernatedKpNodeTag)
+	if err != nil {
+		return nil, err
+	}
+
+	hibernatedKpNodes := []HibernatedKpNode{}
+	for _, vm := range vms {
+		vmRef, err := p.client.GetVmRefByName(vm.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		vmConfig, err := p.client.GetVmConfig(vmRef)
+		if err != nil {
+			return nil, err
+		}
+
+		description, _ := vmConfig["description"].(string)
+		hibernatedKpNodes = append(hibernatedKpNodes, HibernatedKpNode{
+			VmInformation: vm,
+			Metadata:      ParseKpNodeMetadata(description),
+		})
+	}
+
+	return hibernatedKpNodes, nil
+}
+
+func (p *ProxmoxClient) DeleteHibernatedKpNode(name string) error {
+	vms, err := p.getTaggedVms(HibernatedKpNodeTag)
+	if err != nil {
+		return err
+	}
+
+	return p.deleteStoppedVm(name, vms)
+}
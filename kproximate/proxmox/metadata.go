@@ -0,0 +1,187 @@
+package proxmox
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The tag applied to every kpNode VM
+const KpNodeTag = "kproximate"
+
+// The tag applied to stopped kpNode VMs kept in a warm pool. They are not
+// kpNodes until they are started, when the tag is removed.
+const WarmKpNodeTag = "kp-warm"
+
+// The tag applied to kpNode VMs shut down by a scale down and kept to be
+// resumed by a later scale up. They are not kpNodes while hibernated.
+const HibernatedKpNodeTag = "kp-hibernated"
+
+const (
+	clusterNameDescription    = "kproximate-cluster: "
+	nodeClassDescription      = "kproximate-node-class: "
+	instanceDescription       = "kproximate-instance: "
+	createdDescription        = "kproximate-created: "
+	hibernatedDescription     = "kproximate-hibernated: "
+	templateDigestDescription = "kproximate-template-digest: "
+)
+
+const instanceTagPrefix = "kp-instance-"
+
+// Proxmox tags may only contain these characters
+var invalidTagCharacters = regexp.MustCompile(`[^a-z0-9_+.-]`)
+
+// Proxmox accepts tags separated by semicolons, commas or spaces
+var tagSeparators = regexp.MustCompile(`[;, ]+`)
+
+// Identifying information written to the tags and description of kpNode VMs
+// so that operators and kproximate can tell autoscaled VMs apart.
+type KpNodeMetadata struct {
+	ClusterName    string
+	NodeClass      string
+	Instance       string
+	Created        time.Time
+	SourceTemplate int
+	// The digest of the source template's configuration when it was cloned
+	TemplateDigest string
+	// Cloned into the warm pool and left stopped
+	Warm bool
+	// When the kpNode was shut down to be resumed later, zero if running
+	Hibernated time.Time
+	// Tags added by the operator, e.g. through kpNodeParams
+	ExtraTags []string
+}
+
+func tagValue(value string) string {
+	return invalidTagCharacters.ReplaceAllString(strings.ToLower(value), "-")
+}
+
+// Returns the tags in the semicolon separated format expected by Proxmox.
+func (m KpNodeMetadata) Tags() string {
+	tags := []string{KpNodeTag}
+
+	if m.ClusterName != "" {
+		tags = append(tags, fmt.Sprintf("kp-cluster-%s", tagValue(m.ClusterName)))
+	}
+
+	if m.NodeClass != "" {
+		tags = append(tags, fmt.Sprintf("kp-class-%s", tagValue(m.NodeClass)))
+	}
+
+	if m.Instance != "" {
+		tags = append(tags, instanceTagPrefix+tagValue(m.Instance))
+	}
+
+	if m.Warm {
+		tags = append(tags, WarmKpNodeTag)
+	}
+
+	if !m.Hibernated.IsZero() {
+		tags = append(tags, HibernatedKpNodeTag)
+	}
+
+	for _, tag := range m.ExtraTags {
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return strings.Join(tags, ";")
+}
+
+func (vm VmInformation) tags() []string {
+	tags := []string{}
+	for _, tag := range tagSeparators.Split(vm.Tags, -1) {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// The VM's tags which kproximate does not manage
+func (vm VmInformation) extraTags() []string {
+	return slices.DeleteFunc(vm.tags(), func(tag string) bool {
+		return tag == KpNodeTag || strings.HasPrefix(tag, "kp-")
+	})
+}
+
+// Whether the VM's tags record it as a kpNode of the node class.
+func (vm VmInformation) HasNodeClass(nodeClass string) bool {
+	return slices.Contains(vm.tags(), fmt.Sprintf("kp-class-%s", tagValue(nodeClass)))
+}
+
+// Returns the kproximate instance recorded in a VM's tags, or an empty string
+// for the default instance.
+func instanceFromTags(tags []string) string {
+	for _, tag := range tags {
+		if instance, found := strings.CutPrefix(tag, instanceTagPrefix); found {
+			return instance
+		}
+	}
+
+	return ""
+}
+
+func (m KpNodeMetadata) Description() string {
+	lines := []string{
+		fmt.Sprintf("%s%d", sourceTemplateDescription, m.SourceTemplate),
+	}
+
+	if m.TemplateDigest != "" {
+		lines = append(lines, templateDigestDescription+m.TemplateDigest)
+	}
+
+	if m.ClusterName != "" {
+		lines = append(lines, clusterNameDescription+m.ClusterName)
+	}
+
+	if m.NodeClass != "" {
+		lines = append(lines, nodeClassDescription+m.NodeClass)
+	}
+
+	if m.Instance != "" {
+		lines = append(lines, instanceDescription+m.Instance)
+	}
+
+	if !m.Created.IsZero() {
+		lines = append(lines, createdDescription+m.Created.UTC().Format(time.RFC3339))
+	}
+
+	if !m.Hibernated.IsZero() {
+		lines = append(lines, hibernatedDescription+m.Hibernated.UTC().Format(time.RFC3339))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Reads the metadata written to a kpNode's description, any other lines in
+// the description are ignored.
+func ParseKpNodeMetadata(description string) KpNodeMetadata {
+	metadata := KpNodeMetadata{}
+
+	for _, line := range strings.Split(description, "\n") {
+		line = strings.TrimSpace(line)
+
+		if value, found := strings.CutPrefix(line, clusterNameDescription); found {
+			metadata.ClusterName = value
+		} else if value, found := strings.CutPrefix(line, nodeClassDescription); found {
+			metadata.NodeClass = value
+		} else if value, found := strings.CutPrefix(line, instanceDescription); found {
+			metadata.Instance = value
+		} else if value, found := strings.CutPrefix(line, createdDescription); found {
+			metadata.Created, _ = time.Parse(time.RFC3339, value)
+		} else if value, found := strings.CutPrefix(line, hibernatedDescription); found {
+			metadata.Hibernated, _ = time.Parse(time.RFC3339, value)
+		} else if value, found := strings.CutPrefix(line, templateDigestDescription); found {
+			metadata.TemplateDigest = value
+		} else if value, found := strings.CutPrefix(line, sourceTemplateDescription); found {
+			fmt.Sscanf(value, "%d", &metadata.SourceTemplate)
+		}
+	}
+
+	return metadata
+}
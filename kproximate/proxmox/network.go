@@ -0,0 +1,40 @@
+package proxmox
+
+import (
+	"net"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+)
+
+// Returns the addresses the guest agent reports for the kpNode's network
+// interfaces, excluding loopback and link-local addresses which do not show
+// that the kpNode has connectivity. Returns an error until the guest agent is
+// running.
+func (p *ProxmoxClient) GetKpNodeAddresses(nodeName string) ([]net.IP, error) {
+	vmRef, err := p.client.GetVmRefByName(nodeName)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces, err := p.client.GetVmAgentNetworkInterfaces(vmRef)
+	if err != nil {
+		return nil, err
+	}
+
+	return routableAddresses(interfaces), nil
+}
+
+func routableAddresses(interfaces []proxmox.AgentNetworkInterface) []net.IP {
+	addresses := []net.IP{}
+	for _, networkInterface := range interfaces {
+		for _, address := range networkInterface.IPAddresses {
+			if address.IsLoopback() || address.IsLinkLocalUnicast() || address.IsUnspecified() {
+				continue
+			}
+
+			addresses = append(addresses, address)
+		}
+	}
+
+	return addresses
+}
@@ -0,0 +1,22 @@
+package proxmox
+
+import "errors"
+
+// Reboots a kpNode through its guest, eg to apply a kernel update.
+func (p *ProxmoxClient) RebootKpNode(name string) error {
+	vmRef, err := p.client.GetVmRefByName(name)
+	if err != nil {
+		return err
+	}
+
+	exitStatus, err := p.client.RebootVm(vmRef)
+	if err != nil {
+		return err
+	}
+
+	if !exitStatusSuccess.MatchString(exitStatus) {
+		return errors.New(exitStatus)
+	}
+
+	return nil
+}
@@ -0,0 +1,51 @@
+package proxmox
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// A Proxmox privilege, e.g. VM.Clone, on an ACL path, e.g. /vms.
+type Privilege struct {
+	Path string
+	Name string
+}
+
+func (p Privilege) String() string {
+	return fmt.Sprintf("%s on %s", p.Name, p.Path)
+}
+
+// Returns the privileges the API user or token lacks, in the order they are
+// required. Each path's effective privileges are queried, so those inherited
+// from a parent path or granted through a group or role are counted.
+func (p *ProxmoxClient) MissingPrivileges(required []Privilege) ([]Privilege, error) {
+	granted := map[string]map[string]int{}
+	missing := []Privilege{}
+
+	for _, privilege := range required {
+		privileges, ok := granted[privilege.Path]
+		if !ok {
+			result, err := p.client.GetItemList(fmt.Sprintf("/access/permissions?path=%s", url.QueryEscape(privilege.Path)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get privileges on %s: %w", privilege.Path, err)
+			}
+
+			var paths map[string]map[string]int
+			err = mapstructure.WeakDecode(result["data"], &paths)
+			if err != nil {
+				return nil, err
+			}
+
+			privileges = paths[privilege.Path]
+			granted[privilege.Path] = privileges
+		}
+
+		if privileges[privilege.Name] == 0 {
+			missing = append(missing, privilege)
+		}
+	}
+
+	return missing, nil
+}
@@ -2,9 +2,15 @@ package proxmox
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
+	"maps"
+	"net"
+	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Telmate/proxmox-api-go/proxmox"
@@ -14,10 +20,19 @@ import (
 var exitStatusSuccess = regexp.MustCompile(`^(OK|WARNINGS)`)
 var userRequiresTokenRegex = regexp.MustCompile("[a-z0-9]+@[a-z0-9]+![a-z0-9]+")
 
+// Linked clone disks reference the base disk of their template, e.g.
+// "local-lvm:base-9000-disk-0/vm-101-disk-0"
+var linkedCloneBaseDisk = regexp.MustCompile(`base-(\d+)-disk-\d+`)
+
+// Recorded in the description of kpNodes so the template they were cloned
+// from can be determined later
+const sourceTemplateDescription = "kproximate-source-template: "
+
 type HostInformation struct {
 	Id     string  `json:"id"`
 	Node   string  `json:"node"`
 	Cpu    float64 `json:"cpu"`
+	Maxcpu int     `json:"maxcpu"`
 	Mem    int64   `json:"mem"`
 	Maxmem int64   `json:"maxmem"`
 	Status string  `json:"status"`
@@ -40,6 +55,10 @@ type VmInformation struct {
 	NetOut  int64   `json:"netout"`
 	Node    string  `json:"node"`
 	Uptime  int     `json:"uptime"`
+	// Set to 1 for templates
+	Template int `json:"template"`
+	// Semicolon separated
+	Tags string `json:"tags"`
 }
 
 type QemuExecResponse struct {
@@ -55,15 +74,34 @@ type QemuExecStatus struct {
 
 type Proxmox interface {
 	GetClusterStats() ([]HostInformation, error)
+	GetClusterStatus() (ClusterStatus, error)
 	GetRunningKpNodes(regexp.Regexp) ([]VmInformation, error)
 	GetAllKpNodes(regexp.Regexp) ([]VmInformation, error)
 	GetKpNode(name string, kpNodeNameRegex regexp.Regexp) (VmInformation, error)
 	GetKpNodeTemplateRef(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string) (*proxmox.VmRef, error)
-	NewKpNode(ctx context.Context, okchan chan<- bool, errchan chan<- error, newKpNodeName string, targetNode string, kpNodeParams map[string]interface{}, usingLocalStorage bool, kpNodeTemplateName string, kpJoinCommand string)
+	GetKpNodeTemplateDigest(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string) (string, error)
+	GetKpNodeTemplateStorage(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string, rootDisk string) (string, error)
+	GetTemplates(templateNameRegex regexp.Regexp) ([]VmInformation, error)
+	GetKpNodeSourceTemplates(kpNodeNameRegex regexp.Regexp) (map[int]bool, error)
+	DeleteTemplate(template VmInformation) error
+	NewKpNode(ctx context.Context, okchan chan<- bool, errchan chan<- error, newKpNodeName string, targetNode string, kpNodeParams map[string]interface{}, metadata KpNodeMetadata, rootDisk RootDisk, dataDisks []DataDisk, firewall Firewall, excludeBackup bool, usingLocalStorage bool, kpNodeTemplateName string, kpJoinCommand string)
 	DeleteKpNode(name string, kpnodeName regexp.Regexp) error
-	QemuExecJoin(nodeName string, joinCommand string) (int, error)
-	GetQemuExecJoinStatus(nodeName string, pid int) (QemuExecStatus, error)
+	GetWarmKpNodes() ([]VmInformation, error)
+	StartKpNode(vmName string, kpNodeParams map[string]interface{}) error
+	DeleteWarmKpNode(warmKpNodeName string) error
+	HibernateKpNode(name string, kpNodeNameRegex regexp.Regexp) error
+	GetHibernatedKpNodes() ([]HibernatedKpNode, error)
+	DeleteHibernatedKpNode(name string) error
+	QemuExec(nodeName string, command []string) (int, error)
+	GetQemuExecStatus(nodeName string, pid int) (QemuExecStatus, error)
 	CheckNodeReady(ctx context.Context, okchan chan<- bool, errchan chan<- error, nodeName string)
+	GetKpNodeAddresses(nodeName string) ([]net.IP, error)
+	GetDrainingHosts() ([]string, error)
+	MigrateKpNode(name string, targetHost string) error
+	KpNodeHasLocalDisks(name string) (bool, error)
+	RebootKpNode(name string) error
+	MissingPrivileges(required []Privilege) ([]Privilege, error)
+	GetSnippets(host string, storage string) ([]string, error)
 }
 
 type ProxmoxClientInterface interface {
@@ -71,28 +109,48 @@ type ProxmoxClientInterface interface {
 	DeleteVm(vmr *proxmox.VmRef) (exitStatus string, err error)
 	GetExecStatus(vmr *proxmox.VmRef, pid string) (status map[string]interface{}, err error)
 	GetNextID(currentID int) (nextID int, err error)
+	GetVmAgentNetworkInterfaces(vmr *proxmox.VmRef) ([]proxmox.AgentNetworkInterface, error)
+	GetVmConfig(vmr *proxmox.VmRef) (vmConfig map[string]interface{}, err error)
+	GetItemList(url string) (list map[string]interface{}, err error)
 	GetResourceList(resourceType string) (list []interface{}, err error)
 	GetVmList() (map[string]interface{}, error)
 	GetVmRefByName(vmName string) (vmr *proxmox.VmRef, err error)
 	GetVmRefsByName(vmName string) (vmrs []*proxmox.VmRef, err error)
+	MigrateNode(vmr *proxmox.VmRef, newTargetNode string, online bool) (exitStatus interface{}, err error)
+	Post(params map[string]interface{}, url string) (err error)
+	Put(params map[string]interface{}, url string) (err error)
 	QemuAgentExec(vmr *proxmox.VmRef, params map[string]interface{}) (result map[string]interface{}, err error)
 	QemuAgentPing(vmr *proxmox.VmRef) (pingRes map[string]interface{}, err error)
+	RebootVm(vmr *proxmox.VmRef) (exitStatus string, err error)
+	ResizeQemuDiskRaw(vmr *proxmox.VmRef, disk string, size string) (exitStatus interface{}, err error)
 	SetVmConfig(vmr *proxmox.VmRef, params map[string]interface{}) (exitStatus interface{}, err error)
+	ShutdownVm(vmr *proxmox.VmRef) (exitStatus string, err error)
 	StartVm(vmr *proxmox.VmRef) (exitStatus string, err error)
 	StopVm(vmr *proxmox.VmRef) (exitStatus string, err error)
 }
 
 type ProxmoxClient struct {
-	client ProxmoxClientInterface
+	client     ProxmoxClientInterface
+	httpClient *http.Client
+	// The kproximate instance whose kpNodes are discovered
+	instance string
+	vmIDs    *vmIDAllocator
 }
 
 func userRequiresAPIToken(pmUser string) bool {
 	return userRequiresTokenRegex.MatchString(pmUser)
 }
 
-func NewProxmoxClient(pm_url string, allowInsecure bool, pmUser string, pmToken string, pmPassword string, debug bool) (ProxmoxClient, error) {
-	tlsconf := &tls.Config{InsecureSkipVerify: allowInsecure}
-	newClient, err := proxmox.NewClient(pm_url, nil, "", tlsconf, "", 300)
+// Cluster resource and VM lists are cached for cacheTTL, 0 disables caching.
+// The API is reached through proxyUrl when set, trusting the certificates in
+// caBundle as well as the system's.
+func NewProxmoxClient(pm_url string, allowInsecure bool, caBundle string, proxyUrl string, pmUser string, pmToken string, pmPassword string, instance string, debug bool, cacheTTL time.Duration) (ProxmoxClient, error) {
+	httpClient, err := newHttpClient(allowInsecure, caBundle, proxyUrl)
+	if err != nil {
+		return ProxmoxClient{}, err
+	}
+
+	newClient, err := proxmox.NewClient(pm_url, httpClient, "", nil, "", 300)
 	if err != nil {
 		return ProxmoxClient{}, err
 	}
@@ -109,7 +167,14 @@ func NewProxmoxClient(pm_url string, allowInsecure bool, pmUser string, pmToken
 	proxmox.Debug = &debug
 
 	proxmox := ProxmoxClient{
-		client: newClient,
+		client:     newClient,
+		httpClient: httpClient,
+		instance:   instance,
+		vmIDs:      newVmIDAllocator(),
+	}
+
+	if cacheTTL > 0 {
+		proxmox.client = newCachingClient(newClient, cacheTTL)
 	}
 
 	return proxmox, nil
@@ -147,7 +212,7 @@ func (p *ProxmoxClient) GetAllKpNodes(kpNodeNameRegex regexp.Regexp) ([]VmInform
 	var kpNodes []VmInformation
 
 	for _, vm := range vmlist.Data {
-		if kpNodeNameRegex.MatchString(vm.Name) {
+		if p.isKpNode(vm, kpNodeNameRegex) {
 			kpNodes = append(kpNodes, vm)
 		}
 	}
@@ -155,6 +220,22 @@ func (p *ProxmoxClient) GetAllKpNodes(kpNodeNameRegex regexp.Regexp) ([]VmInform
 	return kpNodes, err
 }
 
+// Tagged VMs are kpNodes of this instance if their instance tag matches,
+// regardless of their name. VMs created before kpNodes were tagged are
+// matched by name.
+func (p *ProxmoxClient) isKpNode(vm VmInformation, kpNodeNameRegex regexp.Regexp) bool {
+	tags := vm.tags()
+	if slices.Contains(tags, WarmKpNodeTag) || slices.Contains(tags, HibernatedKpNodeTag) {
+		return false
+	}
+
+	if slices.Contains(tags, KpNodeTag) {
+		return vm.Template != 1 && instanceFromTags(tags) == tagValue(p.instance)
+	}
+
+	return kpNodeNameRegex.MatchString(vm.Name)
+}
+
 func (p *ProxmoxClient) GetRunningKpNodes(kpNodeNameRegex regexp.Regexp) ([]VmInformation, error) {
 	kpNodes, err := p.GetAllKpNodes(kpNodeNameRegex)
 	if err != nil {
@@ -187,7 +268,57 @@ func (p *ProxmoxClient) GetKpNode(kpNodeName string, kpNodeNameRegex regexp.Rege
 	return VmInformation{}, err
 }
 
+// A template name in the format "vm-name@snapshot-name" refers to a snapshot
+// of a regular VM rather than a template.
+func parseTemplateName(kpNodeTemplateName string) (string, string) {
+	name, snapshot, _ := strings.Cut(kpNodeTemplateName, "@")
+	return name, snapshot
+}
+
+// A template name which is a number, optionally followed by "@snapshot-name",
+// pins the template by its VMID rather than looking it up by name.
+func templateVmID(kpNodeTemplateName string) (int, bool) {
+	name, _ := parseTemplateName(kpNodeTemplateName)
+
+	vmID, err := strconv.Atoi(name)
+	if err != nil || vmID <= 0 {
+		return 0, false
+	}
+
+	return vmID, true
+}
+
+func (p *ProxmoxClient) templateRefByVmID(vmID int) (*proxmox.VmRef, error) {
+	result, err := p.client.GetVmList()
+	if err != nil {
+		return nil, err
+	}
+
+	var vmlist vmList
+
+	err = mapstructure.Decode(result, &vmlist)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, vm := range vmlist.Data {
+		if vm.VmID == vmID {
+			return vmRef(vm), nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not find template with VMID %d", vmID)
+}
+
 func (p *ProxmoxClient) GetKpNodeTemplateRef(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string) (*proxmox.VmRef, error) {
+	// A VMID names exactly one VM in the cluster, so there is no copy local
+	// to the clone target to choose
+	if vmID, ok := templateVmID(kpNodeTemplateName); ok {
+		return p.templateRefByVmID(vmID)
+	}
+
+	kpNodeTemplateName, _ = parseTemplateName(kpNodeTemplateName)
+
 	vmRefs, err := p.client.GetVmRefsByName(kpNodeTemplateName)
 	if err != nil {
 		return nil, err
@@ -206,6 +337,28 @@ func (p *ProxmoxClient) GetKpNodeTemplateRef(kpNodeTemplateName string, localTem
 	return nil, fmt.Errorf("could not find template: %s", kpNodeTemplateName)
 }
 
+// Returns the digest Proxmox computes over the template's configuration, it
+// changes whenever the template is modified or replaced by another VM under
+// the same name.
+func (p *ProxmoxClient) GetKpNodeTemplateDigest(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string) (string, error) {
+	kpNodeTemplate, err := p.GetKpNodeTemplateRef(kpNodeTemplateName, localTemplateStorage, cloneTargetNode)
+	if err != nil {
+		return "", err
+	}
+
+	vmConfig, err := p.client.GetVmConfig(kpNodeTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	digest, _ := vmConfig["digest"].(string)
+	if digest == "" {
+		return "", fmt.Errorf("template %s has no digest", kpNodeTemplateName)
+	}
+
+	return digest, nil
+}
+
 func (p *ProxmoxClient) NewKpNode(
 	ctx context.Context,
 	okchan chan<- bool,
@@ -213,6 +366,11 @@ func (p *ProxmoxClient) NewKpNode(
 	newKpNodeName string,
 	targetNode string,
 	kpNodeParams map[string]interface{},
+	metadata KpNodeMetadata,
+	rootDisk RootDisk,
+	dataDisks []DataDisk,
+	firewall Firewall,
+	excludeBackup bool,
 	localTemplateStorage bool,
 	kpNodeTemplateName string,
 	kpJoinCommand string,
@@ -223,25 +381,32 @@ func (p *ProxmoxClient) NewKpNode(
 		return
 	}
 
-	nextID, err := p.client.GetNextID(kpNodeTemplate.VmId())
-	if err != nil {
-		errchan <- err
-		return
-	}
-
 	cloneParams := map[string]interface{}{
 		"name":   newKpNodeName,
-		"newid":  nextID,
 		"target": targetNode,
 		"vmid":   kpNodeTemplate.VmId(),
 	}
 
-	_, err = p.client.CloneQemuVm(kpNodeTemplate, cloneParams)
+	// Linked clones can only be made from templates so a full clone is
+	// required when cloning from a snapshot
+	_, snapshot := parseTemplateName(kpNodeTemplateName)
+	if snapshot != "" {
+		cloneParams["snapname"] = snapshot
+		cloneParams["full"] = 1
+	}
+
+	err = p.cloneWithNewVmID(ctx, kpNodeTemplate, cloneParams)
 	if err != nil {
 		errchan <- err
 		return
 	}
 
+	metadata.SourceTemplate = kpNodeTemplate.VmId()
+
+	kpNodeParams = maps.Clone(kpNodeParams)
+	kpNodeParams["description"] = metadata.Description()
+	kpNodeParams["tags"] = metadata.Tags()
+
 	for {
 		newVmRef, err := p.client.GetVmRefByName(newKpNodeName)
 		if err != nil {
@@ -255,10 +420,45 @@ func (p *ProxmoxClient) NewKpNode(
 			return
 		}
 
-		_, err = p.client.StartVm(newVmRef)
-		if err != nil {
-			errchan <- err
-			return
+		if rootDisk.Size > 0 {
+			err = p.resizeRootDisk(newVmRef, rootDisk)
+			if err != nil {
+				errchan <- err
+				return
+			}
+		}
+
+		if len(dataDisks) > 0 {
+			err = p.attachDataDisks(newVmRef, dataDisks, rootDisk.Device)
+			if err != nil {
+				errchan <- err
+				return
+			}
+		}
+
+		if excludeBackup {
+			err = p.excludeDisksFromBackup(newVmRef)
+			if err != nil {
+				errchan <- err
+				return
+			}
+		}
+
+		if firewall.Enabled {
+			err = p.configureFirewall(newVmRef, firewall)
+			if err != nil {
+				errchan <- err
+				return
+			}
+		}
+
+		// Warm kpNodes are started when they are claimed by a scale event
+		if !metadata.Warm {
+			_, err = p.client.StartVm(newVmRef)
+			if err != nil {
+				errchan <- err
+				return
+			}
 		}
 		break
 	}
@@ -275,6 +475,11 @@ func (p *ProxmoxClient) CheckNodeReady(ctx context.Context, okchan chan<- bool,
 	_, pingErr := p.client.QemuAgentPing(vmRef)
 
 	for pingErr != nil {
+		// The caller has stopped waiting
+		if ctx.Err() != nil {
+			return
+		}
+
 		_, pingErr = p.client.QemuAgentPing(vmRef)
 		time.Sleep(time.Second * 1)
 	}
@@ -282,14 +487,14 @@ func (p *ProxmoxClient) CheckNodeReady(ctx context.Context, okchan chan<- bool,
 	okchan <- true
 }
 
-func (p *ProxmoxClient) QemuExecJoin(kpNodeName string, joinCommand string) (int, error) {
+func (p *ProxmoxClient) QemuExec(kpNodeName string, command []string) (int, error) {
 	vmRef, err := p.client.GetVmRefByName(kpNodeName)
 	if err != nil {
 		return 0, err
 	}
 
 	params := map[string]interface{}{
-		"command": []string{"bash", "-c", joinCommand},
+		"command": command,
 	}
 
 	result, err := p.client.QemuAgentExec(vmRef, params)
@@ -307,7 +512,7 @@ func (p *ProxmoxClient) QemuExecJoin(kpNodeName string, joinCommand string) (int
 	return response.Pid, nil
 }
 
-func (p *ProxmoxClient) GetQemuExecJoinStatus(kpNodeName string, pid int) (QemuExecStatus, error) {
+func (p *ProxmoxClient) GetQemuExecStatus(kpNodeName string, pid int) (QemuExecStatus, error) {
 	vmRef, err := p.client.GetVmRefByName(kpNodeName)
 	if err != nil {
 		return QemuExecStatus{}, err
@@ -345,7 +550,7 @@ func (p *ProxmoxClient) DeleteKpNode(name string, kpNodeName regexp.Regexp) erro
 	}
 
 	if !exitStatusSuccess.MatchString(exitStatus) {
-		err = fmt.Errorf(exitStatus)
+		err = errors.New(exitStatus)
 		return err
 	}
 
@@ -355,9 +560,113 @@ func (p *ProxmoxClient) DeleteKpNode(name string, kpNodeName regexp.Regexp) erro
 	}
 
 	if !exitStatusSuccess.MatchString(exitStatus) {
-		err = fmt.Errorf(exitStatus)
+		err = errors.New(exitStatus)
+		return err
+	}
+
+	return nil
+}
+
+func (p *ProxmoxClient) GetTemplates(templateNameRegex regexp.Regexp) ([]VmInformation, error) {
+	result, err := p.client.GetVmList()
+	if err != nil {
+		return nil, err
+	}
+
+	var vmlist vmList
+
+	err = mapstructure.Decode(result, &vmlist)
+	if err != nil {
+		return nil, err
+	}
+
+	var templates []VmInformation
+
+	for _, vm := range vmlist.Data {
+		if vm.Template == 1 && templateNameRegex.MatchString(vm.Name) {
+			templates = append(templates, vm)
+		}
+	}
+
+	return templates, nil
+}
+
+func vmRef(vm VmInformation) *proxmox.VmRef {
+	vmRef := proxmox.NewVmRef(vm.VmID)
+	vmRef.SetNode(vm.Node)
+	vmRef.SetVmType("qemu")
+	return vmRef
+}
+
+// Returns the VMIDs of the templates that kpNodes were cloned from, either as
+// recorded in their description or referenced by their linked clone disks.
+func sourceTemplates(vmConfig map[string]interface{}) []int {
+	templateIds := []int{}
+
+	for key, value := range vmConfig {
+		value, ok := value.(string)
+		if !ok {
+			continue
+		}
+
+		if key == "description" {
+			for _, line := range strings.Split(value, "\n") {
+				id, found := strings.CutPrefix(strings.TrimSpace(line), sourceTemplateDescription)
+				if !found {
+					continue
+				}
+
+				templateId, err := strconv.Atoi(id)
+				if err == nil {
+					templateIds = append(templateIds, templateId)
+				}
+			}
+
+			continue
+		}
+
+		for _, match := range linkedCloneBaseDisk.FindAllStringSubmatch(value, -1) {
+			templateId, err := strconv.Atoi(match[1])
+			if err == nil {
+				templateIds = append(templateIds, templateId)
+			}
+		}
+	}
+
+	return templateIds
+}
+
+func (p *ProxmoxClient) GetKpNodeSourceTemplates(kpNodeNameRegex regexp.Regexp) (map[int]bool, error) {
+	kpNodes, err := p.GetAllKpNodes(kpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	templateIds := map[int]bool{}
+
+	for _, kpNode := range kpNodes {
+		vmConfig, err := p.client.GetVmConfig(vmRef(kpNode))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, templateId := range sourceTemplates(vmConfig) {
+			templateIds[templateId] = true
+		}
+	}
+
+	return templateIds, nil
+}
+
+func (p *ProxmoxClient) DeleteTemplate(template VmInformation) error {
+	exitStatus, err := p.client.DeleteVm(vmRef(template))
+	if err != nil {
 		return err
 	}
 
+	if !exitStatusSuccess.MatchString(exitStatus) {
+		return errors.New(exitStatus)
+	}
+
 	return nil
 }
@@ -1,19 +1,37 @@
 package proxmox
 
-import "github.com/Telmate/proxmox-api-go/proxmox"
+import (
+	"fmt"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+)
 
 type ProxmoxClientMock struct {
-	ExecStatus            map[string]interface{}
+	CloneParams map[string]interface{}
+	ExecStatus  map[string]interface{}
+	// Responses of GetItemList keyed by URL
+	ItemList              map[string]map[string]interface{}
 	NextID                int
 	ResourceList          []interface{}
+	VmConfig              map[string]interface{}
 	VmList                map[string]interface{}
 	VmRefByName           map[string]*proxmox.VmRef
 	VmRefsByName          map[string][]*proxmox.VmRef
 	QemuExecResponse      map[string]interface{}
 	QemuAgentPingResponse map[string]interface{}
+	// Reported by the guest agent, it is not running when nil
+	AgentNetworkInterfaces []proxmox.AgentNetworkInterface
+	// Params of Post and Put requests keyed by URL
+	PostParams map[string][]map[string]interface{}
+	PutParams  map[string]map[string]interface{}
+	// Disk sizes passed to ResizeQemuDiskRaw keyed by disk
+	ResizedDisks map[string]string
+	// The target host of each migrated VM keyed by VM ID
+	Migrations map[int]string
 }
 
 func (m *ProxmoxClientMock) CloneQemuVm(vmr *proxmox.VmRef, vmParams map[string]interface{}) (exitStatus string, err error) {
+	m.CloneParams = vmParams
 	return "OK", nil
 }
 
@@ -30,6 +48,14 @@ func (m *ProxmoxClientMock) GetNextID(currentID int) (nextID int, err error) {
 	return m.NextID, nil
 }
 
+func (m *ProxmoxClientMock) GetVmConfig(vmr *proxmox.VmRef) (vmConfig map[string]interface{}, err error) {
+	return m.VmConfig, nil
+}
+
+func (m *ProxmoxClientMock) GetItemList(url string) (list map[string]interface{}, err error) {
+	return m.ItemList[url], nil
+}
+
 func (m *ProxmoxClientMock) GetResourceList(resourceType string) (list []interface{}, err error) {
 	return m.ResourceList, nil
 }
@@ -51,14 +77,62 @@ func (m *ProxmoxClientMock) QemuAgentExec(vmr *proxmox.VmRef, params map[string]
 	return m.QemuExecResponse, nil
 }
 
+func (m *ProxmoxClientMock) MigrateNode(vmr *proxmox.VmRef, newTargetNode string, online bool) (exitStatus interface{}, err error) {
+	if m.Migrations == nil {
+		m.Migrations = map[int]string{}
+	}
+	m.Migrations[vmr.VmId()] = newTargetNode
+	return "OK", nil
+}
+
+func (m *ProxmoxClientMock) Post(params map[string]interface{}, url string) (err error) {
+	if m.PostParams == nil {
+		m.PostParams = map[string][]map[string]interface{}{}
+	}
+	m.PostParams[url] = append(m.PostParams[url], params)
+	return nil
+}
+
+func (m *ProxmoxClientMock) Put(params map[string]interface{}, url string) (err error) {
+	if m.PutParams == nil {
+		m.PutParams = map[string]map[string]interface{}{}
+	}
+	m.PutParams[url] = params
+	return nil
+}
+
+func (m *ProxmoxClientMock) GetVmAgentNetworkInterfaces(vmr *proxmox.VmRef) ([]proxmox.AgentNetworkInterface, error) {
+	if m.AgentNetworkInterfaces == nil {
+		return nil, fmt.Errorf("500 QEMU guest agent is not running")
+	}
+
+	return m.AgentNetworkInterfaces, nil
+}
+
 func (m *ProxmoxClientMock) QemuAgentPing(vmr *proxmox.VmRef) (pingRes map[string]interface{}, err error) {
 	return m.QemuAgentPingResponse, nil
 }
 
+func (m *ProxmoxClientMock) ResizeQemuDiskRaw(vmr *proxmox.VmRef, disk string, size string) (exitStatus interface{}, err error) {
+	if m.ResizedDisks == nil {
+		m.ResizedDisks = map[string]string{}
+	}
+	m.ResizedDisks[disk] = size
+	return "OK", nil
+}
+
+func (m *ProxmoxClientMock) RebootVm(vmr *proxmox.VmRef) (exitStatus string, err error) {
+	return "OK", nil
+}
+
 func (m *ProxmoxClientMock) SetVmConfig(vmr *proxmox.VmRef, params map[string]interface{}) (exitStatus interface{}, err error) {
 	return "OK", nil
 }
 
+func (m *ProxmoxClientMock) ShutdownVm(vmr *proxmox.VmRef) (exitStatus string, err error) {
+	return "OK", nil
+}
+
 func (m *ProxmoxClientMock) StartVm(vmr *proxmox.VmRef) (exitStatus string, err error) {
 	return "OK", nil
 }
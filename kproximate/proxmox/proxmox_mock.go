@@ -2,25 +2,73 @@ package proxmox
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"time"
 
 	"github.com/Telmate/proxmox-api-go/proxmox"
 )
 
 type ProxmoxMock struct {
-	ClusterStats       []HostInformation
-	RunningKpNodes     []VmInformation
-	KpNodes            []VmInformation
-	KpNode             VmInformation
-	KpNodeTemplateRef  proxmox.VmRef
+	ClusterStats []HostInformation
+	// Hosts of ClusterStats are online unless their status says otherwise
+	QuorumLost        bool
+	RunningKpNodes    []VmInformation
+	KpNodes           []VmInformation
+	KpNode            VmInformation
+	KpNodeTemplateRef proxmox.VmRef
+	TemplateStorage   string
+	// The digest of each template by its configured name
+	TemplateDigests    map[string]string
+	Templates          []VmInformation
+	SourceTemplates    map[int]bool
+	DeletedTemplates   []int
 	JoinExecPid        int
 	QemuExecJoinStatus QemuExecStatus
+	WarmKpNodes        []VmInformation
+	// The params each stopped kpNode was started with
+	StartedKpNodes           map[string]map[string]interface{}
+	DeletedWarmKpNodes       []string
+	HibernatedKpNodes        []HibernatedKpNode
+	DeletedHibernatedKpNodes []string
+	// Reported for every kpNode by its guest agent
+	KpNodeAddresses []net.IP
+	DrainingHosts   []string
+	// The target host of each migrated kpNode
+	MigratedKpNodes map[string]string
+	// Returned by MigrateKpNode when set
+	MigrationErr error
+	// Whether every kpNode has disks on local storage
+	LocalDisks bool
+	// The kpNodes rebooted by RebootKpNode
+	RebootedKpNodes []string
+	// The privileges reported missing by MissingPrivileges
+	Unprivileged []Privilege
+	// Listed by GetSnippets as the snippets of every storage, standing in for
+	// the storage mounted at kpNodeSnippetDir
+	SnippetDir string
 }
 
 func (p *ProxmoxMock) GetClusterStats() ([]HostInformation, error) {
 	return p.ClusterStats, nil
 }
 
+func (p *ProxmoxMock) GetClusterStatus() (ClusterStatus, error) {
+	status := ClusterStatus{Quorate: !p.QuorumLost}
+	for _, host := range p.ClusterStats {
+		status.Hosts = append(status.Hosts, ClusterHostStatus{
+			Name:   host.Node,
+			Online: host.Status == "" || host.Status == "online",
+		})
+	}
+
+	return status, nil
+}
+
 func (p *ProxmoxMock) GetRunningKpNodes(kpNodeName regexp.Regexp) ([]VmInformation, error) {
 	return p.RunningKpNodes, nil
 }
@@ -37,20 +85,141 @@ func (p *ProxmoxMock) GetKpNodeTemplateRef(kpNodeTemplateName string, LocalTempl
 	return &p.KpNodeTemplateRef, nil
 }
 
-func (p *ProxmoxMock) NewKpNode(ctx context.Context, okchan chan<- bool, errchan chan<- error, newKpNodeName string, targetNode string, kpNodeParams map[string]interface{}, usingLocalStorage bool, kpNodeTemplateName string, kpJoinCommand string) {
+func (p *ProxmoxMock) GetKpNodeTemplateDigest(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string) (string, error) {
+	return p.TemplateDigests[kpNodeTemplateName], nil
+}
+
+func (p *ProxmoxMock) GetKpNodeTemplateStorage(kpNodeTemplateName string, localTemplateStorage bool, cloneTargetNode string, rootDisk string) (string, error) {
+	return p.TemplateStorage, nil
+}
+
+func (p *ProxmoxMock) GetTemplates(templateNameRegex regexp.Regexp) ([]VmInformation, error) {
+	var templates []VmInformation
+	for _, template := range p.Templates {
+		if templateNameRegex.MatchString(template.Name) {
+			templates = append(templates, template)
+		}
+	}
+
+	return templates, nil
+}
+
+func (p *ProxmoxMock) GetKpNodeSourceTemplates(kpNodeNameRegex regexp.Regexp) (map[int]bool, error) {
+	return p.SourceTemplates, nil
+}
+
+func (p *ProxmoxMock) DeleteTemplate(template VmInformation) error {
+	p.DeletedTemplates = append(p.DeletedTemplates, template.VmID)
+	return nil
+}
+
+func (p *ProxmoxMock) NewKpNode(ctx context.Context, okchan chan<- bool, errchan chan<- error, newKpNodeName string, targetNode string, kpNodeParams map[string]interface{}, metadata KpNodeMetadata, rootDisk RootDisk, dataDisks []DataDisk, firewall Firewall, excludeBackup bool, usingLocalStorage bool, kpNodeTemplateName string, kpJoinCommand string) {
+	select {
+	case okchan <- true:
+	case <-ctx.Done():
+	}
 }
 
 func (p *ProxmoxMock) DeleteKpNode(name string, kpNodeName regexp.Regexp) error {
 	return nil
 }
 
-func (p *ProxmoxMock) QemuExecJoin(nodeName string, joinCommand string) (int, error) {
+func (p *ProxmoxMock) QemuExec(nodeName string, command []string) (int, error) {
 	return p.JoinExecPid, nil
 }
 
-func (p *ProxmoxMock) GetQemuExecJoinStatus(nodeName string, pid int) (QemuExecStatus, error) {
+func (p *ProxmoxMock) GetQemuExecStatus(nodeName string, pid int) (QemuExecStatus, error) {
 	return p.QemuExecJoinStatus, nil
 }
 
 func (p *ProxmoxMock) CheckNodeReady(ctx context.Context, okchan chan<- bool, errchan chan<- error, nodeName string) {
 }
+
+func (p *ProxmoxMock) GetKpNodeAddresses(nodeName string) ([]net.IP, error) {
+	return p.KpNodeAddresses, nil
+}
+
+func (p *ProxmoxMock) GetWarmKpNodes() ([]VmInformation, error) {
+	return p.WarmKpNodes, nil
+}
+
+func (p *ProxmoxMock) StartKpNode(vmName string, kpNodeParams map[string]interface{}) error {
+	if p.StartedKpNodes == nil {
+		p.StartedKpNodes = map[string]map[string]interface{}{}
+	}
+
+	p.StartedKpNodes[vmName] = kpNodeParams
+	return nil
+}
+
+func (p *ProxmoxMock) DeleteWarmKpNode(warmKpNodeName string) error {
+	p.DeletedWarmKpNodes = append(p.DeletedWarmKpNodes, warmKpNodeName)
+	return nil
+}
+
+func (p *ProxmoxMock) HibernateKpNode(name string, kpNodeNameRegex regexp.Regexp) error {
+	p.HibernatedKpNodes = append(p.HibernatedKpNodes, HibernatedKpNode{
+		VmInformation: VmInformation{Name: name, Status: "stopped"},
+		Metadata:      KpNodeMetadata{Hibernated: time.Now()},
+	})
+	return nil
+}
+
+func (p *ProxmoxMock) GetHibernatedKpNodes() ([]HibernatedKpNode, error) {
+	return p.HibernatedKpNodes, nil
+}
+
+func (p *ProxmoxMock) DeleteHibernatedKpNode(name string) error {
+	p.DeletedHibernatedKpNodes = append(p.DeletedHibernatedKpNodes, name)
+	return nil
+}
+
+func (p *ProxmoxMock) GetDrainingHosts() ([]string, error) {
+	return p.DrainingHosts, nil
+}
+
+func (p *ProxmoxMock) MigrateKpNode(name string, targetHost string) error {
+	if p.MigrationErr != nil {
+		return p.MigrationErr
+	}
+
+	if p.MigratedKpNodes == nil {
+		p.MigratedKpNodes = map[string]string{}
+	}
+	p.MigratedKpNodes[name] = targetHost
+	return nil
+}
+
+func (p *ProxmoxMock) KpNodeHasLocalDisks(name string) (bool, error) {
+	return p.LocalDisks, nil
+}
+
+func (p *ProxmoxMock) RebootKpNode(name string) error {
+	p.RebootedKpNodes = append(p.RebootedKpNodes, name)
+	return nil
+}
+
+func (p *ProxmoxMock) MissingPrivileges(required []Privilege) ([]Privilege, error) {
+	missing := []Privilege{}
+	for _, privilege := range required {
+		if slices.Contains(p.Unprivileged, privilege) {
+			missing = append(missing, privilege)
+		}
+	}
+
+	return missing, nil
+}
+
+func (p *ProxmoxMock) GetSnippets(host string, storage string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(p.SnippetDir, "snippets"))
+	if err != nil {
+		return nil, err
+	}
+
+	volIDs := []string{}
+	for _, entry := range entries {
+		volIDs = append(volIDs, fmt.Sprintf("%s:snippets/%s", storage, entry.Name()))
+	}
+
+	return volIDs, nil
+}
@@ -0,0 +1,577 @@
+package proxmox
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/proxmox/proxmoxtest"
+)
+
+var serverTestKpNodeRegex = *regexp.MustCompile(`^kp-node-\w+$`)
+
+func newFakeProxmoxServer(t *testing.T) (*proxmoxtest.Server, ProxmoxClient) {
+	server := proxmoxtest.NewServer(
+		[]proxmoxtest.Host{
+			{
+				Name:   "host-01",
+				Cpu:    0.1,
+				Maxcpu: 8,
+				Mem:    4294967296,
+				Maxmem: 17179869184,
+				Status: "online",
+			},
+		},
+		[]proxmoxtest.VM{
+			{
+				VmID:     9000,
+				Name:     "kproximate-template",
+				Node:     "host-01",
+				Status:   "stopped",
+				Template: true,
+				Config: map[string]string{
+					"scsi0": "local-lvm:base-9000-disk-0,size=8G",
+					"net0":  "virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=0",
+				},
+			},
+		},
+	)
+	t.Cleanup(server.Close)
+
+	client, err := NewProxmoxClient(server.ApiUrl(), true, "", "", "root@pam!kproximate", "token", "", "", false, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return server, client
+}
+
+func newKpNodeWithTimeout(t *testing.T, client ProxmoxClient, name string, rootDisk RootDisk, dataDisks []DataDisk, firewall Firewall) error {
+	metadata := KpNodeMetadata{
+		ClusterName: "homelab",
+		NodeClass:   "default",
+		Created:     time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	return newKpNodeWithMetadata(t, client, name, metadata, rootDisk, dataDisks, firewall)
+}
+
+func newKpNodeWithMetadata(t *testing.T, client ProxmoxClient, name string, metadata KpNodeMetadata, rootDisk RootDisk, dataDisks []DataDisk, firewall Firewall) error {
+	return newKpNode(t, client, name, metadata, rootDisk, dataDisks, firewall, false)
+}
+
+func newKpNode(t *testing.T, client ProxmoxClient, name string, metadata KpNodeMetadata, rootDisk RootDisk, dataDisks []DataDisk, firewall Firewall, excludeBackup bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+
+	okChan := make(chan bool, 1)
+	errChan := make(chan error, 1)
+
+	go client.NewKpNode(
+		ctx,
+		okChan,
+		errChan,
+		name,
+		"host-01",
+		map[string]interface{}{
+			"cores":  2,
+			"memory": 2048,
+		},
+		metadata,
+		rootDisk,
+		dataDisks,
+		firewall,
+		excludeBackup,
+		false,
+		"kproximate-template",
+		"",
+	)
+
+	select {
+	case <-okChan:
+		return nil
+	case err := <-errChan:
+		return err
+	case <-ctx.Done():
+		t.Fatal("Timed out waiting for kpNode to be created")
+		return nil
+	}
+}
+
+func TestFakeServerNewKpNode(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-a to have been cloned")
+	}
+
+	if vm.Status != "running" {
+		t.Errorf("Expected kp-node-a to be running, got %s", vm.Status)
+	}
+
+	if vm.Config["cores"] != "2" || vm.Config["memory"] != "2048" {
+		t.Errorf("Expected kpNode params to be applied, got %v", vm.Config)
+	}
+
+	metadata := ParseKpNodeMetadata(vm.Config["description"])
+	if metadata.SourceTemplate != 9000 || metadata.ClusterName != "homelab" || metadata.NodeClass != "default" {
+		t.Errorf("Expected metadata in description, got %s", vm.Config["description"])
+	}
+
+	if vm.Config["tags"] != "kproximate;kp-cluster-homelab;kp-class-default" {
+		t.Errorf("Expected kpNode tags, got %s", vm.Config["tags"])
+	}
+
+	sourceTemplates, err := client.GetKpNodeSourceTemplates(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !sourceTemplates[9000] {
+		t.Errorf("Expected template 9000 to be a source template, got %v", sourceTemplates)
+	}
+}
+
+func TestFakeServerNewKpNodeResizesRootDisk(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{Device: "scsi0", Size: 32}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-a to have been cloned")
+	}
+
+	if !strings.HasSuffix(vm.Config["scsi0"], ",size=32G") {
+		t.Errorf("Expected scsi0 to have been resized to 32G, got %s", vm.Config["scsi0"])
+	}
+}
+
+func TestFakeServerNewKpNodeRootDiskCannotShrink(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{Device: "scsi0", Size: 4}, nil, Firewall{})
+	if err == nil {
+		t.Fatal("Expected shrinking the root disk to fail")
+	}
+
+	if !strings.Contains(err.Error(), "could not resize scsi0") {
+		t.Errorf("Expected a resize error, got %s", err.Error())
+	}
+
+	vm, _ := server.VM("kp-node-a")
+	if vm.Status == "running" {
+		t.Error("Did not expect kp-node-a to have been started")
+	}
+}
+
+func TestFakeServerNewKpNodeDataDisks(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	dataDisks := []DataDisk{
+		{Bus: "scsi", Size: 100, Serial: "kp-data-0"},
+		{Bus: "scsi", Storage: "ceph", Size: 50, Serial: "kp-data-1"},
+		{Bus: "virtio", Size: 20, Serial: "kp-data-2"},
+	}
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{Device: "scsi0"}, dataDisks, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-a to have been cloned")
+	}
+
+	expected := map[string]string{
+		"scsi1":   "local-lvm:100,serial=kp-data-0",
+		"scsi2":   "ceph:50,serial=kp-data-1",
+		"virtio0": "local-lvm:20,serial=kp-data-2",
+	}
+
+	for device, diskConfig := range expected {
+		if vm.Config[device] != diskConfig {
+			t.Errorf("Expected %s to be %s, got %s", device, diskConfig, vm.Config[device])
+		}
+	}
+}
+
+func TestFakeServerNewKpNodeExcludesBackup(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	dataDisks := []DataDisk{
+		{Bus: "scsi", Size: 100, Serial: "kp-data-0"},
+	}
+
+	err := newKpNode(t, client, "kp-node-a", KpNodeMetadata{}, RootDisk{Device: "scsi0"}, dataDisks, Firewall{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-a to have been cloned")
+	}
+
+	for _, device := range []string{"scsi0", "scsi1"} {
+		if !strings.HasSuffix(vm.Config[device], ",backup=0") {
+			t.Errorf("Expected %s to be excluded from backup, got %s", device, vm.Config[device])
+		}
+	}
+
+	if strings.Contains(vm.Config["net0"], "backup") {
+		t.Errorf("Did not expect net0 to be changed, got %s", vm.Config["net0"])
+	}
+}
+
+func TestFakeServerNewKpNodeFirewall(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{}, nil, Firewall{
+		Enabled:        true,
+		SecurityGroups: []string{"kubernetes", "ssh"},
+		PolicyIn:       "DROP",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-a to have been cloned")
+	}
+
+	if vm.Config["net0"] != "virtio=BC:24:11:00:00:01,bridge=vmbr0,firewall=1" {
+		t.Errorf("Expected the firewall to be enabled on net0, got %s", vm.Config["net0"])
+	}
+
+	if vm.FirewallOptions["enable"] != "1" || vm.FirewallOptions["policy_in"] != "DROP" {
+		t.Errorf("Expected firewall options to be set, got %v", vm.FirewallOptions)
+	}
+
+	if _, ok := vm.FirewallOptions["policy_out"]; ok {
+		t.Errorf("Did not expect policy_out to be set, got %v", vm.FirewallOptions)
+	}
+
+	if len(vm.FirewallRules) != 2 {
+		t.Fatalf("Expected 2 firewall rules, got %d", len(vm.FirewallRules))
+	}
+
+	for i, group := range []string{"kubernetes", "ssh"} {
+		rule := vm.FirewallRules[i]
+		if rule["type"] != "group" || rule["action"] != group || rule["enable"] != "1" {
+			t.Errorf("Expected security group %s to be assigned, got %v", group, rule)
+		}
+	}
+}
+
+func TestFakeServerNewKpNodeCloneFailure(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+	server.FailTask("qmclone", "clone failed: no space left on device")
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{}, nil, Firewall{})
+	if err == nil {
+		t.Fatal("Expected the clone failure to be returned")
+	}
+
+	if !strings.Contains(err.Error(), "no space left on device") {
+		t.Errorf("Expected the task exit status in the error, got %s", err.Error())
+	}
+
+	if _, ok := server.VM("kp-node-a"); ok {
+		t.Error("Did not expect kp-node-a to exist")
+	}
+}
+
+func TestFakeServerDeleteKpNode(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteKpNode("kp-node-a", serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.VM("kp-node-a"); ok {
+		t.Error("Expected kp-node-a to have been deleted")
+	}
+
+	kpNodes, err := client.GetAllKpNodes(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 0 {
+		t.Errorf("Expected no kpNodes, got %d", len(kpNodes))
+	}
+}
+
+func TestFakeServerWarmKpNode(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	metadata := KpNodeMetadata{
+		ClusterName: "homelab",
+		NodeClass:   "default",
+		Warm:        true,
+	}
+
+	err := newKpNodeWithMetadata(t, client, "kp-node-warm-a", metadata, RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, _ := server.VM("kp-node-warm-a")
+	if vm.Status != "stopped" {
+		t.Errorf("Expected kp-node-warm-a to be left stopped, got %s", vm.Status)
+	}
+
+	kpNodes, err := client.GetAllKpNodes(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 0 {
+		t.Errorf("Expected warm kpNodes not to be kpNodes, got %d", len(kpNodes))
+	}
+
+	warmKpNodes, err := client.GetWarmKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warmKpNodes) != 1 || !warmKpNodes[0].HasNodeClass("default") {
+		t.Fatalf("Expected 1 warm kpNode of the default class, got %+v", warmKpNodes)
+	}
+
+	err = client.StartKpNode("kp-node-warm-a", map[string]interface{}{
+		"name": "kp-node-a",
+		"tags": KpNodeMetadata{ClusterName: "homelab", NodeClass: "default"}.Tags(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, ok := server.VM("kp-node-a")
+	if !ok {
+		t.Fatal("Expected kp-node-warm-a to have been renamed to kp-node-a")
+	}
+
+	if vm.Status != "running" {
+		t.Errorf("Expected kp-node-a to be running, got %s", vm.Status)
+	}
+
+	kpNodes, err = client.GetAllKpNodes(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 1 {
+		t.Errorf("Expected kp-node-a to be a kpNode once started, got %d kpNodes", len(kpNodes))
+	}
+}
+
+func TestFakeServerDeleteWarmKpNode(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	err := newKpNodeWithMetadata(t, client, "kp-node-warm-a", KpNodeMetadata{Warm: true}, RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DeleteWarmKpNode("kp-node-warm-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.VM("kp-node-warm-a"); ok {
+		t.Error("Expected kp-node-warm-a to have been deleted")
+	}
+
+	err = client.DeleteWarmKpNode("kp-node-warm-a")
+	if err == nil {
+		t.Error("Expected deleting a missing warm kpNode to fail")
+	}
+}
+
+func TestFakeServerHibernateKpNode(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	metadata := KpNodeMetadata{
+		ClusterName: "homelab",
+		NodeClass:   "default",
+	}
+
+	err := newKpNodeWithMetadata(t, client, "kp-node-a", metadata, RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.HibernateKpNode("kp-node-a", serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vm, _ := server.VM("kp-node-a")
+	if vm.Status != "stopped" {
+		t.Errorf("Expected kp-node-a to be stopped, got %s", vm.Status)
+	}
+
+	kpNodes, err := client.GetAllKpNodes(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 0 {
+		t.Errorf("Expected hibernated kpNodes not to be kpNodes, got %d", len(kpNodes))
+	}
+
+	hibernatedKpNodes, err := client.GetHibernatedKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hibernatedKpNodes) != 1 {
+		t.Fatalf("Expected 1 hibernated kpNode, got %d", len(hibernatedKpNodes))
+	}
+
+	if hibernatedKpNodes[0].Metadata.NodeClass != "default" || hibernatedKpNodes[0].Metadata.Hibernated.IsZero() {
+		t.Errorf("Expected the metadata of kp-node-a to record when it was hibernated, got %+v", hibernatedKpNodes[0].Metadata)
+	}
+
+	err = client.DeleteHibernatedKpNode("kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := server.VM("kp-node-a"); ok {
+		t.Error("Expected kp-node-a to have been deleted")
+	}
+}
+
+func TestFakeServerGetClusterStats(t *testing.T) {
+	_, client := newFakeProxmoxServer(t)
+
+	hosts, err := client.GetClusterStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hosts) != 1 {
+		t.Fatalf("Expected 1 host, got %d", len(hosts))
+	}
+
+	if hosts[0].Node != "host-01" || hosts[0].Maxcpu != 8 || hosts[0].Maxmem != 17179869184 {
+		t.Errorf("Unexpected host information: %+v", hosts[0])
+	}
+}
+
+func TestFakeServerGetClusterStatus(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+
+	status, err := client.GetClusterStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Quorate || len(status.Hosts) != 1 || !status.Hosts[0].Online {
+		t.Errorf("Expected a quorate cluster with host-01 online, got %+v", status)
+	}
+
+	server.SetQuorate(false)
+
+	status, err = client.GetClusterStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Quorate {
+		t.Error("Expected the cluster to have lost quorum")
+	}
+}
+
+func countRequests(server *proxmoxtest.Server, request string) int {
+	count := 0
+	for _, r := range server.Requests() {
+		if r == request {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestFakeServerCachesVmList(t *testing.T) {
+	server, client := newFakeProxmoxServer(t)
+	client.client = newCachingClient(client.client, time.Minute)
+
+	for range 3 {
+		_, err := client.GetAllKpNodes(serverTestKpNodeRegex)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if count := countRequests(server, "GET /cluster/resources"); count != 1 {
+		t.Errorf("Expected the VM list to be requested once, got %d", count)
+	}
+
+	err := newKpNodeWithTimeout(t, client, "kp-node-a", RootDisk{}, nil, Firewall{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kpNodes, err := client.GetAllKpNodes(serverTestKpNodeRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 1 {
+		t.Errorf("Expected the cache to be invalidated by the clone, got %d kpNodes", len(kpNodes))
+	}
+}
+
+func TestFakeServerAllocatesDistinctVmIDs(t *testing.T) {
+	_, client := newFakeProxmoxServer(t)
+
+	first, err := client.vmIDs.allocate(client.client, 9000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first VMID is still free in Proxmox until its clone is made
+	second, err := client.vmIDs.allocate(client.client, 9000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first != 9001 || second != 9002 {
+		t.Errorf("Expected VMIDs 9001 and 9002, got %d and %d", first, second)
+	}
+
+	client.vmIDs.release(first)
+
+	third, err := client.vmIDs.allocate(client.client, 9000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third != first {
+		t.Errorf("Expected the released VMID %d to be allocated again, got %d", first, third)
+	}
+}
@@ -1,16 +1,23 @@
 package proxmox
 
 import (
+	"context"
 	"fmt"
-	"regexp"
+	"net"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Telmate/proxmox-api-go/proxmox"
+	"github.com/lupinelab/kproximate/identity"
 )
 
 func NewProxmoxMock(clientMock ProxmoxClientMock) *ProxmoxClient {
 	return &ProxmoxClient{
 		client: &clientMock,
+		vmIDs:  newVmIDAllocator(),
 	}
 }
 
@@ -25,7 +32,7 @@ func TestGetAllKpNodes(t *testing.T) {
 		},
 	})
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
 	kpNodes, err := p.GetAllKpNodes(kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
@@ -58,7 +65,7 @@ func TestGetRunningKpNodes(t *testing.T) {
 		},
 	})
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
 	kpNodes, err := p.GetRunningKpNodes(kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
@@ -85,7 +92,7 @@ func TestGetKpNode(t *testing.T) {
 		},
 	})
 
-	kpNodeNameRegex := *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, "kp-node"))
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
 	kpNode, err := p.GetKpNode("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", kpNodeNameRegex)
 	if err != nil {
 		t.Error(err)
@@ -154,3 +161,548 @@ func TestGetKpNodeTemplateRefReturnsCorrectTemplateRefForLocalStorage(t *testing
 		t.Errorf("Expected %s, got %s", cloneTargetNode, vmRef.Node())
 	}
 }
+
+func TestGetKpNodeTemplateRefByVmID(t *testing.T) {
+	p := NewProxmoxMock(ProxmoxClientMock{
+		VmList: map[string]interface{}{
+			"data": []interface{}{
+				map[string]interface{}{"vmid": 9000, "name": "kp-template", "node": "host-01", "template": 1},
+				map[string]interface{}{"vmid": 9001, "name": "kp-template", "node": "host-02", "template": 1},
+			},
+		},
+	})
+
+	vmRef, err := p.GetKpNodeTemplateRef("9001@kproximate-v2", true, "host-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if vmRef.VmId() != 9001 || vmRef.Node() != "host-02" {
+		t.Errorf("Expected template 9001 on host-02, got %d on %s", vmRef.VmId(), vmRef.Node())
+	}
+
+	_, err = p.GetKpNodeTemplateRef("9002", false, "host-01")
+	if err == nil {
+		t.Error("Expected an error for a VMID which doesn't exist")
+	}
+}
+
+func TestGetKpNodeTemplateDigest(t *testing.T) {
+	templateRef := proxmox.NewVmRef(9000)
+	templateRef.SetNode("host-01")
+
+	p := NewProxmoxMock(ProxmoxClientMock{
+		VmRefsByName: map[string][]*proxmox.VmRef{
+			"kp-template": {
+				templateRef,
+			},
+		},
+		VmConfig: map[string]interface{}{
+			"digest": "8b2f5e3a",
+			"cores":  float64(2),
+		},
+	})
+
+	digest, err := p.GetKpNodeTemplateDigest("kp-template", false, "host-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if digest != "8b2f5e3a" {
+		t.Errorf("Expected digest 8b2f5e3a, got %s", digest)
+	}
+}
+
+func TestParseTemplateName(t *testing.T) {
+	name, snapshot := parseTemplateName("golden-vm@kproximate-v2")
+	if name != "golden-vm" || snapshot != "kproximate-v2" {
+		t.Errorf("Expected golden-vm and kproximate-v2, got %s and %s", name, snapshot)
+	}
+
+	name, snapshot = parseTemplateName("kproximate-template")
+	if name != "kproximate-template" || snapshot != "" {
+		t.Errorf("Expected kproximate-template and no snapshot, got %s and %s", name, snapshot)
+	}
+}
+
+func TestNewKpNodeClonesFromSnapshot(t *testing.T) {
+	templateRef := proxmox.NewVmRef(100)
+	templateRef.SetNode("host-01")
+
+	clientMock := &ProxmoxClientMock{
+		VmRefsByName: map[string][]*proxmox.VmRef{
+			"golden-vm": {
+				templateRef,
+			},
+		},
+	}
+
+	p := &ProxmoxClient{
+		client: clientMock,
+		vmIDs:  newVmIDAllocator(),
+	}
+
+	okChan := make(chan bool, 1)
+	errChan := make(chan error, 1)
+
+	p.NewKpNode(
+		context.Background(),
+		okChan,
+		errChan,
+		"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+		"host-01",
+		map[string]interface{}{},
+		KpNodeMetadata{},
+		RootDisk{},
+		nil,
+		Firewall{},
+		false,
+		false,
+		"golden-vm@kproximate-v2",
+		"",
+	)
+
+	select {
+	case err := <-errChan:
+		t.Fatal(err)
+	case <-okChan:
+	}
+
+	if clientMock.CloneParams["snapname"] != "kproximate-v2" {
+		t.Errorf("Expected snapname to be kproximate-v2, got %v", clientMock.CloneParams["snapname"])
+	}
+
+	if clientMock.CloneParams["full"] != 1 {
+		t.Errorf("Expected a full clone, got %v", clientMock.CloneParams["full"])
+	}
+}
+
+func TestSourceTemplates(t *testing.T) {
+	vmConfig := map[string]interface{}{
+		"description": "Some notes\nkproximate-source-template: 9001\n",
+		"scsi0":       "local-lvm:base-9000-disk-0/vm-101-disk-0,size=10G",
+		"cores":       float64(2),
+	}
+
+	templateIds := sourceTemplates(vmConfig)
+	slices.Sort(templateIds)
+
+	if !slices.Equal(templateIds, []int{9000, 9001}) {
+		t.Errorf("Expected source templates 9000 and 9001, got %v", templateIds)
+	}
+}
+
+func TestKpNodeMetadataRoundTrip(t *testing.T) {
+	metadata := KpNodeMetadata{
+		ClusterName:    "Home Lab",
+		NodeClass:      "large",
+		Instance:       "team-a",
+		Created:        time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		SourceTemplate: 9000,
+		TemplateDigest: "8b2f5e3a",
+	}
+
+	if metadata.Tags() != "kproximate;kp-cluster-home-lab;kp-class-large;kp-instance-team-a" {
+		t.Errorf("Unexpected tags: %s", metadata.Tags())
+	}
+
+	parsed := ParseKpNodeMetadata("Some notes\n" + metadata.Description())
+	if !reflect.DeepEqual(parsed, metadata) {
+		t.Errorf("Expected %+v, got %+v", metadata, parsed)
+	}
+
+	if !slices.Equal(sourceTemplates(map[string]interface{}{"description": metadata.Description()}), []int{9000}) {
+		t.Error("Expected the source template to be read from the description")
+	}
+
+	metadata.Hibernated = time.Date(2024, 2, 3, 4, 5, 6, 0, time.UTC)
+	if !strings.HasSuffix(metadata.Tags(), ";kp-hibernated") {
+		t.Errorf("Expected hibernated kpNodes to be tagged, got %s", metadata.Tags())
+	}
+
+	parsed = ParseKpNodeMetadata(metadata.Description())
+	if !reflect.DeepEqual(parsed, metadata) {
+		t.Errorf("Expected %+v, got %+v", metadata, parsed)
+	}
+
+	metadata.ExtraTags = []string{"k8s", "kproximate"}
+	if !strings.HasSuffix(metadata.Tags(), ";kp-hibernated;k8s") {
+		t.Errorf("Expected extra tags to follow those kproximate manages, got %s", metadata.Tags())
+	}
+}
+
+func TestGetAllKpNodesByTag(t *testing.T) {
+	p := NewProxmoxMock(ProxmoxClientMock{
+		VmList: map[string]interface{}{
+			"Data": []map[string]interface{}{
+				{"Name": "renamed-node", "Tags": "kproximate;kp-class-default"},
+				{"Name": "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"},
+				{"Name": "other-instance-node", "Tags": "kproximate;kp-instance-team-b"},
+				{"Name": "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a", "Tags": "kproximate;kp-instance-team-b"},
+				{"Name": "not-a-kp-node", "Tags": "web"},
+			},
+		},
+	})
+
+	kpNodeNameRegex := *identity.Naming{Prefix: "kp-node"}.Regex()
+	kpNodes, err := p.GetAllKpNodes(kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for _, kpNode := range kpNodes {
+		names = append(names, kpNode.Name)
+	}
+
+	if !slices.Equal(names, []string{"renamed-node", "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"}) {
+		t.Errorf("Expected the tagged and legacy kpNodes of the default instance, got %v", names)
+	}
+
+	p.instance = "team-b"
+	kpNodes, err = p.GetAllKpNodes(kpNodeNameRegex)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kpNodes) != 3 {
+		t.Errorf("Expected 3 kpNodes for team-b, got %d", len(kpNodes))
+	}
+}
+
+func TestDataDiskParamsNoFreeSlot(t *testing.T) {
+	vmConfig := map[string]interface{}{}
+	for slot := 0; slot < 6; slot++ {
+		vmConfig[fmt.Sprintf("sata%d", slot)] = "local-lvm:vm-100-disk-0"
+	}
+
+	_, err := dataDiskParams(vmConfig, []DataDisk{{Bus: "sata", Size: 10, Serial: "kp-data-0"}}, "sata0")
+	if err == nil {
+		t.Error("Expected an error when the bus has no free slots")
+	}
+}
+
+func TestBackupExclusionParams(t *testing.T) {
+	vmConfig := map[string]interface{}{
+		"scsi0":   "local-lvm:vm-100-disk-0,size=8G",
+		"scsi1":   "local-lvm:vm-100-disk-1,backup=1,size=100G",
+		"virtio0": "ceph:vm-100-disk-2,backup=0,size=20G",
+		"ide2":    "local-lvm:vm-100-cloudinit,media=cdrom",
+		"net0":    "virtio=BC:24:11:00:00:01,bridge=vmbr0",
+	}
+
+	params := backupExclusionParams(vmConfig)
+
+	expected := map[string]interface{}{
+		"scsi0": "local-lvm:vm-100-disk-0,size=8G,backup=0",
+		"scsi1": "local-lvm:vm-100-disk-1,size=100G,backup=0",
+	}
+
+	if !reflect.DeepEqual(params, expected) {
+		t.Errorf("Expected %v, got %v", expected, params)
+	}
+}
+
+func TestGetClusterStatusStandaloneHost(t *testing.T) {
+	p := NewProxmoxMock(ProxmoxClientMock{
+		ItemList: map[string]map[string]interface{}{
+			"/cluster/status": {
+				"data": []interface{}{
+					map[string]interface{}{"type": "node", "name": "pve-01", "online": 1},
+				},
+			},
+		},
+	})
+
+	status, err := p.GetClusterStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !status.Quorate {
+		t.Error("Expected a standalone host to be quorate")
+	}
+
+	if len(status.Hosts) != 1 || !status.Hosts[0].Online {
+		t.Errorf("Expected pve-01 to be online, got %+v", status.Hosts)
+	}
+}
+
+// Fails clones as if another client had taken their VMID first
+type collidingClientMock struct {
+	ProxmoxClientMock
+	collisions int
+}
+
+func (m *collidingClientMock) CloneQemuVm(vmr *proxmox.VmRef, vmParams map[string]interface{}) (string, error) {
+	if m.collisions > 0 {
+		m.collisions--
+		return "", fmt.Errorf("unable to create VM %d - VM %d already exists on node 'pve-01'", vmParams["newid"], vmParams["newid"])
+	}
+
+	return m.ProxmoxClientMock.CloneQemuVm(vmr, vmParams)
+}
+
+func TestCloneWithNewVmIDRetriesCollisions(t *testing.T) {
+	clientMock := &collidingClientMock{
+		ProxmoxClientMock: ProxmoxClientMock{NextID: 100},
+		collisions:        2,
+	}
+	p := &ProxmoxClient{
+		client: clientMock,
+		vmIDs:  newVmIDAllocator(),
+	}
+
+	collisions := []int{}
+	ctx := WithVmIDCollisionReporter(context.Background(), func(vmID int) {
+		collisions = append(collisions, vmID)
+	})
+
+	err := p.cloneWithNewVmID(ctx, proxmox.NewVmRef(9000), map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(collisions, []int{101, 102}) {
+		t.Errorf("Expected collisions with VMIDs 101 and 102, got %v", collisions)
+	}
+
+	if clientMock.CloneParams["newid"] != 103 {
+		t.Errorf("Expected the clone to use VMID 103, got %v", clientMock.CloneParams["newid"])
+	}
+}
+
+func TestCloneWithNewVmIDGivesUp(t *testing.T) {
+	p := &ProxmoxClient{
+		client: &collidingClientMock{collisions: maxVmIDAttempts},
+		vmIDs:  newVmIDAllocator(),
+	}
+
+	err := p.cloneWithNewVmID(context.Background(), proxmox.NewVmRef(9000), map[string]interface{}{})
+	if err == nil || !strings.Contains(err.Error(), "failed to find a free VMID") {
+		t.Errorf("Expected the clone to give up, got %v", err)
+	}
+
+	if len(p.vmIDs.reserved) != 0 {
+		t.Errorf("Expected the failed VMIDs to be released, got %v", p.vmIDs.reserved)
+	}
+}
+
+func TestGetKpNodeTemplateStorage(t *testing.T) {
+	templateRef := proxmox.NewVmRef(100)
+	templateRef.SetNode("host-01")
+
+	p := &ProxmoxClient{
+		client: &ProxmoxClientMock{
+			VmRefsByName: map[string][]*proxmox.VmRef{
+				"golden-vm": {
+					templateRef,
+				},
+			},
+			VmConfig: map[string]interface{}{
+				"scsi0": "ceph-rbd:base-100-disk-0,size=8G",
+			},
+		},
+	}
+
+	storage, err := p.GetKpNodeTemplateStorage("golden-vm", false, "host-01", "scsi0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if storage != "ceph-rbd" {
+		t.Errorf("Expected ceph-rbd, got: %s", storage)
+	}
+
+	_, err = p.GetKpNodeTemplateStorage("golden-vm", false, "host-01", "virtio0")
+	if err == nil {
+		t.Error("Expected an error for a template without the root disk")
+	}
+}
+
+func TestGetKpNodeAddresses(t *testing.T) {
+	vmRef := proxmox.NewVmRef(101)
+	client := &ProxmoxClientMock{
+		VmRefByName: map[string]*proxmox.VmRef{
+			"kp-node-a": vmRef,
+		},
+	}
+	p := &ProxmoxClient{client: client}
+
+	_, err := p.GetKpNodeAddresses("kp-node-a")
+	if err == nil {
+		t.Error("Expected an error while the guest agent is not running")
+	}
+
+	client.AgentNetworkInterfaces = []proxmox.AgentNetworkInterface{
+		{Name: "lo", IPAddresses: []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")}},
+		{Name: "eth0", IPAddresses: []net.IP{net.ParseIP("fe80::1")}},
+	}
+
+	addresses, err := p.GetKpNodeAddresses("kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addresses) != 0 {
+		t.Errorf("Expected loopback and link-local addresses to be ignored, got %v", addresses)
+	}
+
+	client.AgentNetworkInterfaces[1].IPAddresses = append(client.AgentNetworkInterfaces[1].IPAddresses, net.ParseIP("10.0.0.21"))
+
+	addresses, err = p.GetKpNodeAddresses("kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(addresses) != 1 || addresses[0].String() != "10.0.0.21" {
+		t.Errorf("Expected 10.0.0.21, got %v", addresses)
+	}
+}
+
+func TestGetDrainingHosts(t *testing.T) {
+	p := NewProxmoxMock(ProxmoxClientMock{
+		ItemList: map[string]map[string]interface{}{
+			"/cluster/status": {
+				"data": []interface{}{
+					map[string]interface{}{"type": "cluster", "quorate": 1},
+					map[string]interface{}{"type": "node", "name": "pve-01", "online": 1},
+					map[string]interface{}{"type": "node", "name": "pve-02", "online": 1},
+					map[string]interface{}{"type": "node", "name": "pve-03", "online": 1},
+					map[string]interface{}{"type": "node", "name": "pve-04", "online": 0},
+				},
+			},
+			"/cluster/ha/status/current": {
+				"data": []interface{}{
+					map[string]interface{}{"type": "quorum", "status": "OK"},
+					map[string]interface{}{"type": "node", "node": "pve-01", "status": "online"},
+					map[string]interface{}{"type": "node", "node": "pve-02", "status": "maintenance mode"},
+				},
+			},
+			"/nodes/pve-03/config": {
+				"data": map[string]interface{}{
+					"description": "Replacing PSU on Friday\nkproximate-drain",
+				},
+			},
+		},
+	})
+
+	draining, err := p.GetDrainingHosts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(draining, []string{"pve-02", "pve-03"}) {
+		t.Errorf("Expected pve-02 and pve-03 to be draining, got %v", draining)
+	}
+}
+
+func TestMigrateKpNode(t *testing.T) {
+	vmRef := proxmox.NewVmRef(101)
+	vmRef.SetNode("pve-01")
+
+	clientMock := &ProxmoxClientMock{
+		VmRefByName: map[string]*proxmox.VmRef{
+			"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": vmRef,
+		},
+	}
+	p := &ProxmoxClient{client: clientMock}
+
+	err := p.MigrateKpNode("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", "pve-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if clientMock.Migrations[101] != "pve-02" {
+		t.Errorf("Expected the kpNode to be migrated to pve-02, got %v", clientMock.Migrations)
+	}
+
+	err = p.MigrateKpNode("kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", "pve-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(clientMock.Migrations) != 1 {
+		t.Errorf("Expected no migration to the host the kpNode is already on, got %v", clientMock.Migrations)
+	}
+}
+
+func TestKpNodeHasLocalDisks(t *testing.T) {
+	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	storages := []interface{}{
+		map[string]interface{}{"storage": "local-lvm", "node": "pve-01", "shared": 0},
+		map[string]interface{}{"storage": "ceph", "node": "pve-01", "shared": 1},
+	}
+
+	testCases := []struct {
+		vmConfig map[string]interface{}
+		expected bool
+	}{
+		{
+			vmConfig: map[string]interface{}{
+				"scsi0": "ceph:vm-101-disk-0,size=20G",
+				"ide2":  "none,media=cdrom",
+			},
+			expected: false,
+		},
+		{
+			vmConfig: map[string]interface{}{
+				"scsi0": "ceph:vm-101-disk-0,size=20G",
+				"ide2":  "local-lvm:vm-101-cloudinit,media=cdrom",
+			},
+			expected: true,
+		},
+	}
+
+	for _, testCase := range testCases {
+		p := NewProxmoxMock(ProxmoxClientMock{
+			ResourceList: storages,
+			VmConfig:     testCase.vmConfig,
+			VmRefByName: map[string]*proxmox.VmRef{
+				kpNodeName: proxmox.NewVmRef(101),
+			},
+		})
+
+		local, err := p.KpNodeHasLocalDisks(kpNodeName)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if local != testCase.expected {
+			t.Errorf("Expected local disks to be %t for %v, got %t", testCase.expected, testCase.vmConfig, local)
+		}
+	}
+}
+
+func TestMissingPrivileges(t *testing.T) {
+	p := NewProxmoxMock(ProxmoxClientMock{
+		ItemList: map[string]map[string]interface{}{
+			"/access/permissions?path=%2Fvms": {
+				"data": map[string]interface{}{
+					"/vms": map[string]interface{}{"VM.Allocate": 1, "VM.Clone": 1},
+				},
+			},
+			"/access/permissions?path=%2Fstorage%2Flocal-lvm": {
+				"data": map[string]interface{}{},
+			},
+		},
+	})
+
+	missing, err := p.MissingPrivileges([]Privilege{
+		{Path: "/vms", Name: "VM.Allocate"},
+		{Path: "/vms", Name: "VM.Clone"},
+		{Path: "/vms", Name: "VM.PowerMgmt"},
+		{Path: "/storage/local-lvm", Name: "Datastore.AllocateSpace"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Privilege{
+		{Path: "/vms", Name: "VM.PowerMgmt"},
+		{Path: "/storage/local-lvm", Name: "Datastore.AllocateSpace"},
+	}
+	if !reflect.DeepEqual(missing, expected) {
+		t.Errorf("Expected %v to be missing, got %v", expected, missing)
+	}
+}
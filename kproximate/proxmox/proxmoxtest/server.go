@@ -0,0 +1,578 @@
+// Package proxmoxtest provides a fake Proxmox API server for tests which
+// exercise the real proxmox-api-go client rather than a mocked interface.
+package proxmoxtest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const apiPrefix = "/api2/json"
+
+var (
+	vmPath   = regexp.MustCompile(`^/nodes/([^/]+)/qemu/(\d+)(/.*)?$`)
+	taskPath = regexp.MustCompile(`^/nodes/([^/]+)/tasks/([^/]+)/status$`)
+)
+
+type Host struct {
+	Name   string
+	Cpu    float64
+	Maxcpu int
+	Mem    int64
+	Maxmem int64
+	Status string
+}
+
+type VM struct {
+	VmID     int
+	Name     string
+	Node     string
+	Status   string
+	Template bool
+	Config   map[string]string
+	// The VM level firewall options and rules
+	FirewallOptions map[string]string
+	FirewallRules   []map[string]string
+}
+
+type task struct {
+	node       string
+	exitStatus string
+}
+
+// An in-memory Proxmox cluster served over HTTP. All tasks complete as soon
+// as they are created.
+type Server struct {
+	*httptest.Server
+
+	mu     sync.Mutex
+	hosts  []Host
+	vms    map[int]*VM
+	tasks  map[string]task
+	nextID int
+	// Task types, e.g. "qmclone", which fail with the given exit status
+	failTasks map[string]string
+	requests  []string
+	// Reported by /cluster/status
+	quorumLost bool
+}
+
+func NewServer(hosts []Host, vms []VM) *Server {
+	s := &Server{
+		hosts:     hosts,
+		vms:       map[int]*VM{},
+		tasks:     map[string]task{},
+		nextID:    100,
+		failTasks: map[string]string{},
+	}
+
+	for _, vm := range vms {
+		vm := vm
+		if vm.Config == nil {
+			vm.Config = map[string]string{}
+		}
+		s.vms[vm.VmID] = &vm
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Sets whether /cluster/status reports the cluster as quorate.
+func (s *Server) SetQuorate(quorate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quorumLost = !quorate
+}
+
+// The URL to configure as the Proxmox API URL.
+func (s *Server) ApiUrl() string {
+	return s.URL + apiPrefix
+}
+
+// Causes tasks of the type, e.g. "qmclone", "qmstart" or "qmdestroy", to fail
+// with the exit status.
+func (s *Server) FailTask(taskType string, exitStatus string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failTasks[taskType] = exitStatus
+}
+
+// Tasks of every type complete successfully again.
+func (s *Server) ClearFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failTasks = map[string]string{}
+}
+
+func (s *Server) VM(name string) (VM, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, vm := range s.vms {
+		if vm.Name == name {
+			return vm.copy(), true
+		}
+	}
+
+	return VM{}, false
+}
+
+// All VMs, including templates, ordered by ID.
+func (s *Server) VMs() []VM {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	vms := make([]VM, 0, len(s.vms))
+	for _, vm := range s.vms {
+		vms = append(vms, vm.copy())
+	}
+
+	slices.SortFunc(vms, func(a VM, b VM) int {
+		return a.VmID - b.VmID
+	})
+
+	return vms
+}
+
+func (vm *VM) copy() VM {
+	vmCopy := *vm
+	vmCopy.Config = maps.Clone(vm.Config)
+	vmCopy.FirewallOptions = maps.Clone(vm.FirewallOptions)
+	vmCopy.FirewallRules = slices.Clone(vm.FirewallRules)
+	return vmCopy
+}
+
+// The requests received so far in the format "METHOD /path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string{}, s.requests...)
+}
+
+func writeData(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"data": nil, "message": message})
+}
+
+// Creates a completed task and returns its UPID. Must be called with the
+// lock held.
+func (s *Server) newTask(node string, taskType string, vmID int) string {
+	upid := fmt.Sprintf("UPID:%s:%08X:%08X:%08X:%s:%d:root@pam:", node, len(s.tasks)+1, 0, time.Now().Unix(), taskType, vmID)
+
+	exitStatus, fail := s.failTasks[taskType]
+	if !fail {
+		exitStatus = "OK"
+	}
+
+	s.tasks[upid] = task{
+		node:       node,
+		exitStatus: exitStatus,
+	}
+
+	return upid
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, apiPrefix)
+	s.requests = append(s.requests, fmt.Sprintf("%s %s", r.Method, path))
+
+	err := r.ParseForm()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if path == "/access/ticket" && r.Method == http.MethodPost {
+		writeData(w, map[string]interface{}{
+			"ticket":              "PVE:root@pam:fake",
+			"CSRFPreventionToken": "fake",
+			"username":            r.Form.Get("username"),
+		})
+		return
+	}
+
+	if r.Header.Get("Authorization") == "" {
+		writeError(w, http.StatusUnauthorized, "authentication failure")
+		return
+	}
+
+	switch {
+	case path == "/cluster/resources" && r.Method == http.MethodGet:
+		s.handleResources(w, r)
+	case path == "/cluster/status" && r.Method == http.MethodGet:
+		s.handleClusterStatus(w)
+	case path == "/cluster/nextid" && r.Method == http.MethodGet:
+		s.handleNextID(w, r)
+	case taskPath.MatchString(path) && r.Method == http.MethodGet:
+		s.handleTaskStatus(w, taskPath.FindStringSubmatch(path)[2])
+	case vmPath.MatchString(path):
+		match := vmPath.FindStringSubmatch(path)
+		vmID, _ := strconv.Atoi(match[2])
+		s.handleVM(w, r, match[1], vmID, match[3])
+	default:
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("Method '%s %s' not implemented", r.Method, path))
+	}
+}
+
+func (s *Server) handleResources(w http.ResponseWriter, r *http.Request) {
+	resources := []map[string]interface{}{}
+
+	resourceType := r.URL.Query().Get("type")
+
+	if resourceType == "" || resourceType == "node" {
+		for _, host := range s.hosts {
+			resources = append(resources, map[string]interface{}{
+				"id":     fmt.Sprintf("node/%s", host.Name),
+				"type":   "node",
+				"node":   host.Name,
+				"cpu":    host.Cpu,
+				"maxcpu": host.Maxcpu,
+				"mem":    host.Mem,
+				"maxmem": host.Maxmem,
+				"status": host.Status,
+			})
+		}
+	}
+
+	if resourceType == "" || resourceType == "vm" {
+		for _, vm := range s.vms {
+			template := 0
+			if vm.Template {
+				template = 1
+			}
+
+			resources = append(resources, map[string]interface{}{
+				"id":       fmt.Sprintf("qemu/%d", vm.VmID),
+				"type":     "qemu",
+				"vmid":     vm.VmID,
+				"name":     vm.Name,
+				"node":     vm.Node,
+				"status":   vm.Status,
+				"template": template,
+				"tags":     vm.Config["tags"],
+			})
+		}
+	}
+
+	writeData(w, resources)
+}
+
+// Hosts are online when their status is "online".
+func (s *Server) handleClusterStatus(w http.ResponseWriter) {
+	quorate := 1
+	if s.quorumLost {
+		quorate = 0
+	}
+
+	status := []map[string]interface{}{
+		{
+			"id":      "cluster",
+			"type":    "cluster",
+			"name":    "fake",
+			"nodes":   len(s.hosts),
+			"quorate": quorate,
+		},
+	}
+
+	for idx, host := range s.hosts {
+		online := 0
+		if host.Status == "online" {
+			online = 1
+		}
+
+		status = append(status, map[string]interface{}{
+			"id":     fmt.Sprintf("node/%s", host.Name),
+			"type":   "node",
+			"name":   host.Name,
+			"nodeid": idx + 1,
+			"online": online,
+		})
+	}
+
+	writeData(w, status)
+}
+
+// Proxmox rejects a requested VMID that is already in use, otherwise it
+// returns the lowest free VMID.
+func (s *Server) handleNextID(w http.ResponseWriter, r *http.Request) {
+	if requested := r.URL.Query().Get("vmid"); requested != "" {
+		vmID, err := strconv.Atoi(requested)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid vmid")
+			return
+		}
+
+		if _, exists := s.vms[vmID]; exists {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("VM %d already exists", vmID))
+			return
+		}
+
+		writeData(w, strconv.Itoa(vmID))
+		return
+	}
+
+	for {
+		if _, exists := s.vms[s.nextID]; !exists {
+			break
+		}
+		s.nextID++
+	}
+
+	writeData(w, strconv.Itoa(s.nextID))
+}
+
+func (s *Server) handleTaskStatus(w http.ResponseWriter, upid string) {
+	task, ok := s.tasks[upid]
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "no such task")
+		return
+	}
+
+	writeData(w, map[string]interface{}{
+		"node":       task.node,
+		"status":     "stopped",
+		"exitstatus": task.exitStatus,
+	})
+}
+
+func (s *Server) handleVM(w http.ResponseWriter, r *http.Request, node string, vmID int, action string) {
+	vm, ok := s.vms[vmID]
+	if !ok || vm.Node != node {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("Configuration file 'nodes/%s/qemu-server/%d.conf' does not exist", node, vmID))
+		return
+	}
+
+	switch {
+	case action == "/clone" && r.Method == http.MethodPost:
+		s.clone(w, r, vm)
+
+	case action == "/config" && r.Method == http.MethodGet:
+		config := map[string]interface{}{}
+		for key, value := range vm.Config {
+			config[key] = value
+		}
+		config["digest"] = configDigest(vm.Config)
+		writeData(w, config)
+
+	case action == "/config" && (r.Method == http.MethodPost || r.Method == http.MethodPut):
+		if digest := r.PostForm.Get("digest"); digest != "" && digest != configDigest(vm.Config) {
+			writeError(w, http.StatusInternalServerError, "detected modified configuration - file changed by other user? Try again.")
+			return
+		}
+
+		upid := s.newTask(node, "qmconfig", vmID)
+		if s.tasks[upid].exitStatus == "OK" {
+			for key := range r.PostForm {
+				if key == "digest" {
+					continue
+				}
+				vm.Config[key] = r.PostForm.Get(key)
+			}
+
+			if name, ok := vm.Config["name"]; ok {
+				vm.Name = name
+			}
+		}
+		writeData(w, upid)
+
+	case action == "/status/start" && r.Method == http.MethodPost:
+		upid := s.newTask(node, "qmstart", vmID)
+		if s.tasks[upid].exitStatus == "OK" {
+			vm.Status = "running"
+		}
+		writeData(w, upid)
+
+	case action == "/status/shutdown" && r.Method == http.MethodPost:
+		upid := s.newTask(node, "qmshutdown", vmID)
+		if s.tasks[upid].exitStatus == "OK" {
+			vm.Status = "stopped"
+		}
+		writeData(w, upid)
+
+	case action == "/status/stop" && r.Method == http.MethodPost:
+		upid := s.newTask(node, "qmstop", vmID)
+		if s.tasks[upid].exitStatus == "OK" {
+			vm.Status = "stopped"
+		}
+		writeData(w, upid)
+
+	case action == "" && r.Method == http.MethodDelete:
+		upid := s.newTask(node, "qmdestroy", vmID)
+		if s.tasks[upid].exitStatus == "OK" {
+			delete(s.vms, vmID)
+		}
+		writeData(w, upid)
+
+	case action == "/resize" && r.Method == http.MethodPut:
+		s.resize(w, r, vm)
+
+	case action == "/firewall/options" && r.Method == http.MethodPut:
+		if vm.FirewallOptions == nil {
+			vm.FirewallOptions = map[string]string{}
+		}
+		for key := range r.PostForm {
+			vm.FirewallOptions[key] = r.PostForm.Get(key)
+		}
+		writeData(w, nil)
+
+	case action == "/firewall/rules" && r.Method == http.MethodPost:
+		rule := map[string]string{}
+		for key := range r.PostForm {
+			rule[key] = r.PostForm.Get(key)
+		}
+		vm.FirewallRules = append(vm.FirewallRules, rule)
+		writeData(w, nil)
+
+	case action == "/agent/ping" && r.Method == http.MethodPost:
+		if vm.Status != "running" {
+			writeError(w, http.StatusInternalServerError, fmt.Sprintf("VM %d is not running", vmID))
+			return
+		}
+		writeData(w, map[string]interface{}{})
+
+	case action == "/agent/exec" && r.Method == http.MethodPost:
+		writeData(w, map[string]interface{}{"pid": 1})
+
+	case action == "/agent/exec-status" && r.Method == http.MethodGet:
+		writeData(w, map[string]interface{}{"exited": 1, "exitcode": 0})
+
+	default:
+		writeError(w, http.StatusNotImplemented, fmt.Sprintf("Method '%s %s' not implemented", r.Method, action))
+	}
+}
+
+// A digest of the VM config which changes whenever the config does, used by
+// Proxmox to reject concurrent modifications.
+func configDigest(config map[string]string) string {
+	keys := []string{}
+	for key := range config {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	hash := sha1.New()
+	for _, key := range keys {
+		fmt.Fprintf(hash, "%s=%s\n", key, config[key])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Sets the size of a disk, only absolute sizes in GiB are supported and disks
+// cannot be shrunk.
+func (s *Server) resize(w http.ResponseWriter, r *http.Request, vm *VM) {
+	disk := r.PostForm.Get("disk")
+	diskConfig, ok := vm.Config[disk]
+	if !ok {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("disk '%s' does not exist", disk))
+		return
+	}
+
+	size := r.PostForm.Get("size")
+	newSize, err := strconv.Atoi(strings.TrimSuffix(size, "G"))
+	if err != nil || !strings.HasSuffix(size, "G") {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid size '%s'", size))
+		return
+	}
+
+	options := []string{}
+	for _, option := range strings.Split(diskConfig, ",") {
+		currentSize, found := strings.CutPrefix(option, "size=")
+		if !found {
+			options = append(options, option)
+			continue
+		}
+
+		current, _ := strconv.Atoi(strings.TrimSuffix(currentSize, "G"))
+		if newSize < current {
+			writeError(w, http.StatusInternalServerError, "shrinking disks is not supported")
+			return
+		}
+	}
+
+	upid := s.newTask(vm.Node, "qmresize", vm.VmID)
+	if s.tasks[upid].exitStatus == "OK" {
+		vm.Config[disk] = strings.Join(append(options, "size="+size), ",")
+	}
+
+	writeData(w, upid)
+}
+
+// Clones a VM, the clone is a linked clone of the source's disk unless a full
+// clone is requested.
+func (s *Server) clone(w http.ResponseWriter, r *http.Request, source *VM) {
+	newID, err := strconv.Atoi(r.PostForm.Get("newid"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid newid")
+		return
+	}
+
+	if _, exists := s.vms[newID]; exists {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("VM %d already exists", newID))
+		return
+	}
+
+	if !source.Template && r.PostForm.Get("full") != "1" {
+		writeError(w, http.StatusInternalServerError, "linked clone feature is not supported for VMs which are not templates")
+		return
+	}
+
+	target := r.PostForm.Get("target")
+	if target == "" {
+		target = source.Node
+	}
+
+	upid := s.newTask(source.Node, "qmclone", source.VmID)
+	if s.tasks[upid].exitStatus != "OK" {
+		writeData(w, upid)
+		return
+	}
+
+	config := maps.Clone(source.Config)
+	config["name"] = r.PostForm.Get("name")
+	if r.PostForm.Get("full") == "1" {
+		config["scsi0"] = fmt.Sprintf("local-lvm:vm-%d-disk-0", newID)
+	} else {
+		config["scsi0"] = fmt.Sprintf("local-lvm:base-%d-disk-0/vm-%d-disk-0", source.VmID, newID)
+	}
+	// Disk options such as the size are kept by the clone
+	if _, options, found := strings.Cut(source.Config["scsi0"], ","); found {
+		config["scsi0"] += "," + options
+	}
+
+	s.vms[newID] = &VM{
+		VmID:   newID,
+		Name:   r.PostForm.Get("name"),
+		Node:   target,
+		Status: "stopped",
+		Config: config,
+	}
+
+	writeData(w, upid)
+}
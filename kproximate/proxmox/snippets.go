@@ -0,0 +1,27 @@
+package proxmox
+
+import (
+	"fmt"
+)
+
+// Returns the volume IDs of the snippets on the storage as the pHost sees
+// them, e.g. "cephfs:snippets/kp-node-1-user.yaml".
+func (p *ProxmoxClient) GetSnippets(host string, storage string) ([]string, error) {
+	result, err := p.client.GetItemList(fmt.Sprintf("/nodes/%s/storage/%s/content?content=snippets", host, storage))
+	if err != nil {
+		return nil, err
+	}
+
+	volumes, _ := result["data"].([]interface{})
+
+	volIDs := []string{}
+	for _, volume := range volumes {
+		volume, _ := volume.(map[string]interface{})
+		volID, ok := volume["volid"].(string)
+		if ok {
+			volIDs = append(volIDs, volID)
+		}
+	}
+
+	return volIDs, nil
+}
@@ -0,0 +1,91 @@
+package proxmox
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Returns the HTTP client used to reach the Proxmox API. caBundle holds PEM
+// encoded certificates trusted in addition to the system's, e.g. of a Proxmox
+// cluster's own CA or a TLS intercepting proxy. When proxyUrl, an http, https
+// or socks5 URL, is set requests are made through it, otherwise the API is
+// reached directly.
+func newHttpClient(allowInsecure bool, caBundle string, proxyUrl string) (*http.Client, error) {
+	tlsconf := &tls.Config{InsecureSkipVerify: allowInsecure}
+
+	if caBundle != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+
+		if !rootCAs.AppendCertsFromPEM([]byte(caBundle)) {
+			return nil, fmt.Errorf("pmCaBundle contains no PEM encoded certificates")
+		}
+
+		tlsconf.RootCAs = rootCAs
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:    tlsconf,
+		DisableCompression: true,
+	}
+
+	if proxyUrl != "" {
+		proxy, err := url.Parse(proxyUrl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pmProxyUrl: %w", err)
+		}
+
+		if proxy.Scheme != "http" && proxy.Scheme != "https" && proxy.Scheme != "socks5" {
+			return nil, fmt.Errorf("invalid pmProxyUrl: unsupported scheme %q, expected http, https or socks5", proxy.Scheme)
+		}
+
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
+
+// Fails requests with a 500 response with the probability, simulating an
+// unhealthy Proxmox API.
+type errorInjectingTransport struct {
+	http.RoundTripper
+	probability float64
+}
+
+func (t *errorInjectingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rand.Float64() >= t.probability {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	return &http.Response{
+		Status:     "500 Internal Server Error (injected)",
+		StatusCode: http.StatusInternalServerError,
+		Proto:      req.Proto,
+		ProtoMajor: req.ProtoMajor,
+		ProtoMinor: req.ProtoMinor,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+// Fails subsequent Proxmox API requests with a 500 response with the
+// probability, for testing failure handling.
+func (p *ProxmoxClient) InjectErrors(probability float64) {
+	if p.httpClient == nil || probability <= 0 {
+		return
+	}
+
+	p.httpClient.Transport = &errorInjectingTransport{
+		RoundTripper: p.httpClient.Transport,
+		probability:  probability,
+	}
+}
@@ -0,0 +1,95 @@
+package proxmox
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewHttpClientTrustsCaBundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := newHttpClient(false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.Get(server.URL)
+	if err == nil {
+		t.Error("Expected the server's self-signed certificate to be rejected")
+	}
+
+	caBundle := pem.EncodeToMemory(&pem.Block{
+		Type:  "CERTIFICATE",
+		Bytes: server.Certificate().Raw,
+	})
+
+	client, err = newHttpClient(false, string(caBundle), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the certificate in the CA bundle to be trusted, got %v", err)
+	}
+	resp.Body.Close()
+
+	_, err = newHttpClient(false, "not a certificate", "")
+	if err == nil {
+		t.Error("Expected an error for a CA bundle without certificates")
+	}
+}
+
+func TestNewHttpClientUsesProxy(t *testing.T) {
+	proxied := ""
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+	}))
+	defer proxy.Close()
+
+	client, err := newHttpClient(false, "", proxy.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Get("http://proxmox.invalid:8006/api2/json/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if proxied != "http://proxmox.invalid:8006/api2/json/version" {
+		t.Errorf("Expected the request to be made through the proxy, got %q", proxied)
+	}
+
+	_, err = newHttpClient(false, "", "ftp://proxy.local:21")
+	if err == nil {
+		t.Error("Expected an error for an unsupported proxy scheme")
+	}
+}
+
+func TestInjectErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	httpClient, err := newHttpClient(false, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &ProxmoxClient{httpClient: httpClient}
+	p.InjectErrors(1)
+
+	resp, err := httpClient.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("Expected an injected 500 response, got %d", resp.StatusCode)
+	}
+}
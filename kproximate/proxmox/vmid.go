@@ -0,0 +1,123 @@
+package proxmox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Telmate/proxmox-api-go/proxmox"
+)
+
+const (
+	// The number of times a clone is retried with a new VMID when the VMID
+	// is taken before the clone is made
+	maxVmIDAttempts = 5
+	// VMIDs stay reserved until the clone has had time to create the VM, after
+	// which the VMID is visible to the next free VMID query
+	vmIDReservation = time.Minute * 5
+)
+
+// Hands out the free VMIDs reported by Proxmox, skipping those already handed
+// out to a clone which has not yet created its VM. This prevents concurrent
+// clones by the same client racing on a VMID, other clients are detected by
+// the clone failing.
+type vmIDAllocator struct {
+	mu       sync.Mutex
+	reserved map[int]time.Time
+}
+
+func newVmIDAllocator() *vmIDAllocator {
+	return &vmIDAllocator{
+		reserved: map[int]time.Time{},
+	}
+}
+
+func (a *vmIDAllocator) allocate(client ProxmoxClientInterface, startID int) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for vmID, reserved := range a.reserved {
+		if time.Since(reserved) > vmIDReservation {
+			delete(a.reserved, vmID)
+		}
+	}
+
+	candidate := startID
+	for {
+		vmID, err := client.GetNextID(candidate)
+		if err != nil {
+			return 0, err
+		}
+
+		if _, reserved := a.reserved[vmID]; !reserved {
+			a.reserved[vmID] = time.Now()
+			return vmID, nil
+		}
+
+		candidate = vmID + 1
+	}
+}
+
+func (a *vmIDAllocator) release(vmID int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.reserved, vmID)
+}
+
+// Receives the VMIDs found to be taken when cloning a kpNode with a context
+// returned by WithVmIDCollisionReporter, the clone is retried with another.
+type VmIDCollisionReporter func(vmID int)
+
+type vmIDCollisionReporterKey struct{}
+
+func WithVmIDCollisionReporter(ctx context.Context, reporter VmIDCollisionReporter) context.Context {
+	return context.WithValue(ctx, vmIDCollisionReporterKey{}, reporter)
+}
+
+func reportVmIDCollision(ctx context.Context, vmID int) {
+	reporter, ok := ctx.Value(vmIDCollisionReporterKey{}).(VmIDCollisionReporter)
+	if !ok {
+		return
+	}
+
+	reporter(vmID)
+}
+
+// Whether a clone failed because a VM with its VMID already exists, e.g.
+// because another client created it after the VMID was allocated.
+func isVmIDCollision(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "already exists")
+}
+
+// Clones the template to a VM with a newly allocated VMID, retrying with
+// another VMID if the allocated one is taken by the time of the clone.
+func (p *ProxmoxClient) cloneWithNewVmID(ctx context.Context, template *proxmox.VmRef, cloneParams map[string]interface{}) error {
+	for attempt := 1; ; attempt++ {
+		vmID, err := p.vmIDs.allocate(p.client, template.VmId())
+		if err != nil {
+			return err
+		}
+
+		cloneParams["newid"] = vmID
+
+		_, err = p.client.CloneQemuVm(template, cloneParams)
+		if err == nil {
+			return nil
+		}
+
+		p.vmIDs.release(vmID)
+
+		if !isVmIDCollision(err) {
+			return err
+		}
+
+		reportVmIDCollision(ctx, vmID)
+
+		if attempt == maxVmIDAttempts {
+			return fmt.Errorf("failed to find a free VMID after %d attempts: %w", attempt, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package proxmox
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+// Returns the VMs of this instance with the tag.
+func (p *ProxmoxClient) getTaggedVms(tag string) ([]VmInformation, error) {
+	result, err := p.client.GetVmList()
+	if err != nil {
+		return nil, err
+	}
+
+	var vmlist vmList
+
+	err = mapstructure.Decode(result, &vmlist)
+	if err != nil {
+		return nil, err
+	}
+
+	var vms []VmInformation
+
+	for _, vm := range vmlist.Data {
+		tags := vm.tags()
+		if vm.Template != 1 && slices.Contains(tags, tag) && instanceFromTags(tags) == tagValue(p.instance) {
+			vms = append(vms, vm)
+		}
+	}
+
+	return vms, nil
+}
+
+// Returns the stopped VMs kept in the warm pool of this instance.
+func (p *ProxmoxClient) GetWarmKpNodes() ([]VmInformation, error) {
+	return p.getTaggedVms(WarmKpNodeTag)
+}
+
+// Applies the kpNode params to a stopped VM, e.g. to rename it or replace its
+// tags, and starts it. The config digest guards against several workers
+// starting the same VM, all but the first fail to apply their params.
+func (p *ProxmoxClient) StartKpNode(vmName string, kpNodeParams map[string]interface{}) error {
+	vmRef, err := p.client.GetVmRefByName(vmName)
+	if err != nil {
+		return err
+	}
+
+	vmConfig, err := p.client.GetVmConfig(vmRef)
+	if err != nil {
+		return err
+	}
+
+	kpNodeParams = maps.Clone(kpNodeParams)
+	if digest, ok := vmConfig["digest"]; ok {
+		kpNodeParams["digest"] = digest
+	}
+
+	_, err = p.client.SetVmConfig(vmRef, kpNodeParams)
+	if err != nil {
+		return fmt.Errorf("failed to claim %s: %w", vmName, err)
+	}
+
+	_, err = p.client.StartVm(vmRef)
+	return err
+}
+
+func (p *ProxmoxClient) DeleteWarmKpNode(warmKpNodeName string) error {
+	warmKpNodes, err := p.GetWarmKpNodes()
+	if err != nil {
+		return err
+	}
+
+	return p.deleteStoppedVm(warmKpNodeName, warmKpNodes)
+}
+
+// Deletes one of the listed VMs, which are expected to be stopped unless
+// they were started since they were listed.
+func (p *ProxmoxClient) deleteStoppedVm(name string, vms []VmInformation) error {
+	idx := slices.IndexFunc(vms, func(vm VmInformation) bool {
+		return vm.Name == name
+	})
+	if idx == -1 {
+		return fmt.Errorf("could not find %s", name)
+	}
+
+	if vms[idx].Status == "running" {
+		return fmt.Errorf("%s is running", name)
+	}
+
+	vmRef, err := p.client.GetVmRefByName(name)
+	if err != nil {
+		return err
+	}
+
+	exitStatus, err := p.client.DeleteVm(vmRef)
+	if err != nil {
+		return err
+	}
+
+	if !exitStatusSuccess.MatchString(exitStatus) {
+		return errors.New(exitStatus)
+	}
+
+	return nil
+}
@@ -1,21 +1,73 @@
 package rabbitmq
 
 import (
+	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"time"
 
 	"github.com/lupinelab/kproximate/config"
 	"github.com/lupinelab/kproximate/logger"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
+const (
+	// The number of failed deliveries of a scale event before it is dead lettered
+	DeliveryLimit = 2
+
+	DeadLetterExchange = "kproximate.deadletter"
+	DeadLetterQueue    = "deadLetterEvents"
+
+	// Workers publish the progress of scale events to this queue
+	StatusQueue = "scaleEventStatus"
+
+	failureReasonHeader = "x-failure-reason"
+
+	inFlightQueueSuffix = ".inFlight"
+)
+
 type queueInfo struct {
 	MessagesUnacknowledged int `json:"messages_unacknowledged,omitempty"`
 }
 
+type DeadLetterEvent struct {
+	Queue         string          `json:"queue"`
+	FailureReason string          `json:"failureReason"`
+	Payload       json.RawMessage `json:"payload"`
+}
+
+type queueMessage struct {
+	Payload    string `json:"payload"`
+	RoutingKey string `json:"routing_key"`
+	Properties struct {
+		Headers map[string]interface{} `json:"headers"`
+	} `json:"properties"`
+}
+
+// The operations on a RabbitMQ channel used to manage scale events, satisfied
+// by *amqp.Channel.
+type Channel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Get(queue string, autoAck bool) (amqp.Delivery, bool, error)
+}
+
+func scaleEventQueueArgs() amqp.Table {
+	return amqp.Table{
+		"x-queue-type":           "quorum",
+		"x-delivery-limit":       DeliveryLimit,
+		"x-dead-letter-exchange": DeadLetterExchange,
+	}
+}
+
 func NewRabbitmqConnection(rabbitConfig config.RabbitConfig) (*amqp.Connection, *http.Client) {
 	tls := &tls.Config{InsecureSkipVerify: true}
 
@@ -45,10 +97,19 @@ func NewChannel(conn *amqp.Connection) *amqp.Channel {
 	return ch
 }
 
-func DeclareQueue(ch *amqp.Channel, queueName string) *amqp.Queue {
-	args := amqp.Table{
-		"x-queue-type":     "quorum",
-		"x-delivery-limit": 2,
+// Declares a scale event queue, events which fail too many times are dead
+// lettered to deadLetterQueue.
+func DeclareQueue(ch Channel, queueName string, deadLetterQueue string) *amqp.Queue {
+	args := scaleEventQueueArgs()
+
+	err := declareDeadLetterQueue(ch, queueName, deadLetterQueue)
+	if err != nil {
+		logger.ErrorLog("Failed to declare dead letter queue", "error", err)
+	}
+
+	err = declareInFlightQueue(ch, queueName)
+	if err != nil {
+		logger.ErrorLog("Failed to declare in flight queue", "error", err)
 	}
 
 	q, err := ch.QueueDeclare(
@@ -66,11 +127,239 @@ func DeclareQueue(ch *amqp.Channel, queueName string) *amqp.Queue {
 	return &q
 }
 
-func GetPendingScaleEvents(ch *amqp.Channel, queueName string) (int, error) {
-	args := amqp.Table{
-		"x-queue-type":     "quorum",
-		"x-delivery-limit": 2,
+func inFlightQueue(queueName string) string {
+	return queueName + inFlightQueueSuffix
+}
+
+// Declares the queue holding a marker for each scale event published to
+// queueName which a worker has not yet settled. Unlike unacknowledged scale
+// events, which the management API reports with a delay, markers are counted
+// as soon as they are published, and they are shared by every controller and
+// worker and survive a controller restart.
+func declareInFlightQueue(ch Channel, queueName string) error {
+	_, err := ch.QueueDeclare(
+		inFlightQueue(queueName), // name
+		true,                     // durable
+		false,                    // delete when unused
+		false,                    // exclusive
+		false,                    // no-wait
+		nil,                      // arguments
+	)
+
+	return err
+}
+
+// Counts a scale event about to be published to queueName as in flight until
+// a worker settles it. Markers expire after expiry so that those left by a
+// crashed worker, or by an event the broker dead lettered, don't count
+// forever.
+func MarkInFlight(ctx context.Context, ch Channel, queueName string, expiry time.Duration) error {
+	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return ch.PublishWithContext(
+		publishCtx,
+		"",
+		inFlightQueue(queueName),
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			Expiration:   fmt.Sprintf("%d", expiry.Milliseconds()),
+		},
+	)
+}
+
+// Stops counting one scale event of queueName as in flight, once it has been
+// acknowledged or dead lettered.
+func SettleInFlight(ch Channel, queueName string) error {
+	_, _, err := ch.Get(inFlightQueue(queueName), true)
+	return err
+}
+
+// Returns the number of scale events published to queueName which have not
+// yet been settled by a worker.
+func GetInFlightScaleEvents(ch Channel, queueName string) (int, error) {
+	markers, err := ch.QueueDeclarePassive(
+		inFlightQueue(queueName),
+		true,  // durable
+		false, // delete when unused
+		false, // exclusive
+		false, // no-wait
+		nil,   // arguments
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return markers.Messages, nil
+}
+
+// Redeclares a scale event queue declared by an earlier version of kproximate
+// with different arguments, which RabbitMQ would otherwise refuse to redeclare.
+// Its events are parked in a temporary queue while it is recreated and then
+// moved back. Call before DeclareQueue, it does nothing once migrated.
+func MigrateQueue(ctx context.Context, conn *amqp.Connection, queueName string) error {
+	probe, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	_, err = probe.QueueDeclare(queueName, true, false, false, false, scaleEventQueueArgs())
+
+	var amqpErr *amqp.Error
+	if !errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed {
+		probe.Close()
+		return err
 	}
+
+	// The failed declaration closed the probe channel
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	logger.InfoLog("Migrating queue to current arguments", "queue", queueName)
+
+	parkingQueue := queueName + ".migrating"
+	_, err = ch.QueueDeclare(parkingQueue, true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	_, err = moveScaleEvents(ctx, ch, queueName, parkingQueue)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDelete(queueName, false, false, false)
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.QueueDeclare(queueName, true, false, false, false, scaleEventQueueArgs())
+	if err != nil {
+		return err
+	}
+
+	numMoved, err := moveScaleEvents(ctx, ch, parkingQueue, queueName)
+	if err != nil {
+		return err
+	}
+
+	// Another instance migrating at the same time may still be parking events
+	_, err = ch.QueueDelete(parkingQueue, false, true, false)
+	if err != nil {
+		logger.WarnLog("Failed to delete parking queue", "queue", parkingQueue, "error", err)
+	}
+
+	logger.InfoLog("Migrated queue", "queue", queueName, "events", numMoved)
+
+	return nil
+}
+
+// Moves all scale events from one queue to another and returns the number of
+// events moved. Each event is published before it is acknowledged so it is
+// never lost.
+func moveScaleEvents(ctx context.Context, ch Channel, fromQueue string, toQueue string) (int, error) {
+	numMoved := 0
+
+	for {
+		msg, ok, err := ch.Get(fromQueue, false)
+		if err != nil {
+			return numMoved, err
+		}
+
+		if !ok {
+			return numMoved, nil
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = ch.PublishWithContext(
+			publishCtx,
+			"",
+			toQueue,
+			false,
+			false,
+			amqp.Publishing{
+				DeliveryMode: amqp.Persistent,
+				ContentType:  msg.ContentType,
+				Headers:      msg.Headers,
+				Priority:     msg.Priority,
+				Body:         msg.Body,
+			},
+		)
+		cancel()
+		if err != nil {
+			msg.Nack(false, true)
+			return numMoved, err
+		}
+
+		msg.Ack(false)
+		numMoved++
+	}
+}
+
+// Declares the queue workers publish scale event progress to. Progress is only
+// of interest while kproximate is running so the queue is not durable.
+func DeclareStatusQueue(ch Channel, queueName string) *amqp.Queue {
+	q, err := ch.QueueDeclare(
+		queueName, // name
+		false,     // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		logger.ErrorLog("Failed to declare a queue", "error", err)
+	}
+
+	return &q
+}
+
+// Declares the dead letter exchange and queue and routes dead lettered
+// events from queueName to it.
+func declareDeadLetterQueue(ch Channel, queueName string, deadLetterQueue string) error {
+	err := ch.ExchangeDeclare(
+		DeadLetterExchange, // name
+		"direct",           // type
+		true,               // durable
+		false,              // auto-deleted
+		false,              // internal
+		false,              // no-wait
+		nil,                // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	// A classic queue is used so that inspecting dead lettered events does not
+	// count towards a delivery limit
+	_, err = ch.QueueDeclare(
+		deadLetterQueue, // name
+		true,            // durable
+		false,           // delete when unused
+		false,           // exclusive
+		false,           // no-wait
+		nil,             // arguments
+	)
+	if err != nil {
+		return err
+	}
+
+	return ch.QueueBind(
+		deadLetterQueue,    // queue name
+		queueName,          // routing key
+		DeadLetterExchange, // exchange
+		false,              // no-wait
+		nil,                // arguments
+	)
+}
+
+func GetPendingScaleEvents(ch Channel, queueName string) (int, error) {
+	args := scaleEventQueueArgs()
 	scaleEvents, err := ch.QueueDeclarePassive(
 		queueName,
 		true,  // durable
@@ -111,3 +400,199 @@ func GetRunningScaleEvents(client *http.Client, rabbitConfig config.RabbitConfig
 
 	return queueInfo.MessagesUnacknowledged, nil
 }
+
+// Returns the number of times a scale event has previously failed to be
+// processed, as recorded by the quorum queue.
+func DeliveryCount(msg amqp.Delivery) int64 {
+	switch count := msg.Headers["x-delivery-count"].(type) {
+	case int64:
+		return count
+	case int32:
+		return int64(count)
+	case int:
+		return int64(count)
+	}
+
+	return 0
+}
+
+// Publishes a failed scale event to the dead letter exchange recording the
+// reason it failed. The original message should be acknowledged afterwards.
+func DeadLetterScaleEvent(ctx context.Context, ch Channel, msg amqp.Delivery, failureReason string) error {
+	headers := amqp.Table{}
+	for key, value := range msg.Headers {
+		headers[key] = value
+	}
+	headers[failureReasonHeader] = failureReason
+
+	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	return ch.PublishWithContext(
+		publishCtx,
+		DeadLetterExchange,
+		msg.RoutingKey,
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  msg.ContentType,
+			Headers:      headers,
+			Priority:     msg.Priority,
+			Body:         msg.Body,
+		},
+	)
+}
+
+// Returns a scale event to the back of its queue without counting a failed
+// delivery, for a worker which cannot process it to leave it for another.
+// The event is republished before it is acknowledged so it is never lost.
+func ReleaseScaleEvent(ctx context.Context, ch Channel, msg amqp.Delivery) error {
+	publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	err := ch.PublishWithContext(
+		publishCtx,
+		"",
+		msg.RoutingKey,
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  msg.ContentType,
+			Headers:      msg.Headers,
+			Priority:     msg.Priority,
+			Body:         msg.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return msg.Ack(false)
+}
+
+func failureReason(headers map[string]interface{}) string {
+	if reason, ok := headers[failureReasonHeader].(string); ok {
+		return reason
+	}
+
+	// Events dead lettered by the broker record the reason in x-death
+	if deaths, ok := headers["x-death"].([]interface{}); ok && len(deaths) > 0 {
+		if death, ok := deaths[0].(map[string]interface{}); ok {
+			if reason, ok := death["reason"].(string); ok {
+				return reason
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// Lists the dead lettered scale events without removing them from the queue.
+func GetDeadLetterEvents(client *http.Client, rabbitConfig config.RabbitConfig, deadLetterQueue string) ([]DeadLetterEvent, error) {
+	endpoint := fmt.Sprintf("http://%s:15672/api/queues/%s/%s/get", rabbitConfig.Host, url.PathEscape("/"), deadLetterQueue)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"count":    1000,
+		"ackmode":  "ack_requeue_true",
+		"encoding": "auto",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Close = true
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(rabbitConfig.User, rabbitConfig.Password)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status getting dead letter events: %s", res.Status)
+	}
+
+	var messages []queueMessage
+
+	err = json.NewDecoder(res.Body).Decode(&messages)
+	if err != nil {
+		return nil, err
+	}
+
+	deadLetterEvents := []DeadLetterEvent{}
+	for _, message := range messages {
+		payload := json.RawMessage(message.Payload)
+		if !json.Valid(payload) {
+			payload, _ = json.Marshal(message.Payload)
+		}
+
+		deadLetterEvents = append(deadLetterEvents, DeadLetterEvent{
+			Queue:         message.RoutingKey,
+			FailureReason: failureReason(message.Properties.Headers),
+			Payload:       payload,
+		})
+	}
+
+	return deadLetterEvents, nil
+}
+
+// Moves all dead lettered scale events back onto the queue they came from and
+// returns the number of events requeued. Each is counted as in flight again
+// for inFlightExpiry, as the worker processing it will settle it.
+func RequeueDeadLetterEvents(ctx context.Context, ch Channel, deadLetterQueue string, inFlightExpiry time.Duration) (int, error) {
+	numRequeued := 0
+
+	for {
+		msg, ok, err := ch.Get(deadLetterQueue, false)
+		if err != nil {
+			return numRequeued, err
+		}
+
+		if !ok {
+			return numRequeued, nil
+		}
+
+		err = MarkInFlight(ctx, ch, msg.RoutingKey, inFlightExpiry)
+		if err != nil {
+			msg.Nack(false, true)
+			return numRequeued, err
+		}
+
+		publishCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		err = ch.PublishWithContext(
+			publishCtx,
+			"",
+			msg.RoutingKey,
+			false,
+			false,
+			amqp.Publishing{
+				DeliveryMode: amqp.Persistent,
+				ContentType:  msg.ContentType,
+				Priority:     msg.Priority,
+				Body:         msg.Body,
+			},
+		)
+		cancel()
+		if err != nil {
+			settleErr := SettleInFlight(ch, msg.RoutingKey)
+			if settleErr != nil {
+				logger.WarnLog("Failed to settle unpublished scale event", "error", settleErr)
+			}
+
+			msg.Nack(false, true)
+			return numRequeued, err
+		}
+
+		msg.Ack(false)
+		numRequeued++
+	}
+}
@@ -0,0 +1,213 @@
+package rabbitmq
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// An in memory stand in for a RabbitMQ channel. Messages are routed through
+// the default exchange and bound exchanges like the broker, and those rejected
+// more times than the delivery limit of their queue are dead lettered.
+type ChannelMock struct {
+	// The arguments each queue was declared with
+	Declared map[string]amqp.Table
+	// The messages waiting in each queue
+	Queues map[string][]amqp.Delivery
+	// The queue bound to each routing key of each exchange
+	Bindings map[string]map[string]string
+	// Returned by PublishWithContext for messages with the routing key
+	PublishErrs map[string]error
+	// Acknowledged deliveries by tag
+	Acked []uint64
+	// Deliveries rejected or nacked with requeue by tag
+	Requeued []uint64
+	// The time messages expire against, time.Now when unset
+	Now func() time.Time
+
+	nextTag uint64
+	unacked map[uint64]unackedDelivery
+}
+
+type unackedDelivery struct {
+	queue string
+	msg   amqp.Delivery
+}
+
+func NewChannelMock() *ChannelMock {
+	return &ChannelMock{
+		Declared: map[string]amqp.Table{},
+		Queues:   map[string][]amqp.Delivery{},
+		Bindings: map[string]map[string]string{},
+		unacked:  map[uint64]unackedDelivery{},
+	}
+}
+
+func (m *ChannelMock) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+
+	return time.Now()
+}
+
+func (m *ChannelMock) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	if _, ok := m.Bindings[name]; !ok {
+		m.Bindings[name] = map[string]string{}
+	}
+
+	return nil
+}
+
+func (m *ChannelMock) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	if _, ok := m.Declared[name]; !ok {
+		m.Declared[name] = args
+	}
+
+	return amqp.Queue{Name: name, Messages: len(m.live(name))}, nil
+}
+
+func (m *ChannelMock) QueueDeclarePassive(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	if _, ok := m.Declared[name]; !ok {
+		return amqp.Queue{}, &amqp.Error{Code: amqp.NotFound, Reason: "no queue '" + name + "'"}
+	}
+
+	return amqp.Queue{Name: name, Messages: len(m.live(name))}, nil
+}
+
+func (m *ChannelMock) QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error {
+	if _, ok := m.Bindings[exchange]; !ok {
+		return &amqp.Error{Code: amqp.NotFound, Reason: "no exchange '" + exchange + "'"}
+	}
+
+	m.Bindings[exchange][key] = name
+	return nil
+}
+
+func (m *ChannelMock) PublishWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if err, ok := m.PublishErrs[key]; ok {
+		return err
+	}
+
+	queueName := key
+	if exchange != "" {
+		queueName = m.Bindings[exchange][key]
+	}
+
+	// Unroutable messages are dropped
+	if _, ok := m.Declared[queueName]; !ok {
+		return nil
+	}
+
+	m.Queues[queueName] = append(m.Queues[queueName], amqp.Delivery{
+		Headers:      msg.Headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: msg.DeliveryMode,
+		Priority:     msg.Priority,
+		Expiration:   msg.Expiration,
+		Timestamp:    m.now(),
+		Exchange:     exchange,
+		RoutingKey:   key,
+		Body:         msg.Body,
+	})
+
+	return nil
+}
+
+func (m *ChannelMock) Get(queue string, autoAck bool) (amqp.Delivery, bool, error) {
+	if _, ok := m.Declared[queue]; !ok {
+		return amqp.Delivery{}, false, &amqp.Error{Code: amqp.NotFound, Reason: "no queue '" + queue + "'"}
+	}
+
+	msgs := m.live(queue)
+	if len(msgs) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+
+	msg := msgs[0]
+	m.Queues[queue] = msgs[1:]
+
+	m.nextTag++
+	msg.DeliveryTag = m.nextTag
+	msg.Acknowledger = m
+	if !autoAck {
+		m.unacked[msg.DeliveryTag] = unackedDelivery{queue: queue, msg: msg}
+	}
+
+	return msg, true, nil
+}
+
+// Drops the expired messages of the queue and returns those remaining.
+func (m *ChannelMock) live(queue string) []amqp.Delivery {
+	msgs := []amqp.Delivery{}
+	for _, msg := range m.Queues[queue] {
+		if msg.Expiration != "" {
+			expiration, _ := strconv.Atoi(msg.Expiration)
+			if !m.now().Before(msg.Timestamp.Add(time.Millisecond * time.Duration(expiration))) {
+				continue
+			}
+		}
+
+		msgs = append(msgs, msg)
+	}
+
+	m.Queues[queue] = msgs
+	return msgs
+}
+
+func (m *ChannelMock) Ack(tag uint64, multiple bool) error {
+	m.Acked = append(m.Acked, tag)
+	delete(m.unacked, tag)
+	return nil
+}
+
+func (m *ChannelMock) Nack(tag uint64, multiple bool, requeue bool) error {
+	return m.Reject(tag, requeue)
+}
+
+// Returns a requeued delivery to the front of its queue, counting the failed
+// delivery and dead lettering it once it exceeds the delivery limit of a
+// quorum queue.
+func (m *ChannelMock) Reject(tag uint64, requeue bool) error {
+	delivery, ok := m.unacked[tag]
+	delete(m.unacked, tag)
+	if !requeue {
+		return nil
+	}
+
+	m.Requeued = append(m.Requeued, tag)
+	if !ok {
+		return nil
+	}
+
+	queue, msg := delivery.queue, delivery.msg
+	args := m.Declared[queue]
+	if limit, ok := args["x-delivery-limit"].(int); ok {
+		headers := amqp.Table{}
+		for key, value := range msg.Headers {
+			headers[key] = value
+		}
+		deliveryCount := DeliveryCount(msg) + 1
+		headers["x-delivery-count"] = deliveryCount
+		msg.Headers = headers
+
+		if deliveryCount > int64(limit) {
+			exchange, _ := args["x-dead-letter-exchange"].(string)
+			headers["x-death"] = []interface{}{map[string]interface{}{"reason": "delivery_limit"}}
+
+			return m.PublishWithContext(context.Background(), exchange, queue, false, false, amqp.Publishing{
+				Headers:      headers,
+				ContentType:  msg.ContentType,
+				DeliveryMode: msg.DeliveryMode,
+				Priority:     msg.Priority,
+				Body:         msg.Body,
+			})
+		}
+	}
+
+	msg.Redelivered = true
+	m.Queues[queue] = append([]amqp.Delivery{msg}, m.Queues[queue]...)
+	return nil
+}
@@ -0,0 +1,177 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	testQueue           = "scaleUpEvents"
+	testDeadLetterQueue = "deadLetterEvents"
+)
+
+func publishTestEvent(t *testing.T, ch *ChannelMock, body string) {
+	err := MarkInFlight(context.Background(), ch, testQueue, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ch.PublishWithContext(context.Background(), "", testQueue, false, false, amqp.Publishing{Body: []byte(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func inFlight(t *testing.T, ch *ChannelMock) int {
+	numInFlight, err := GetInFlightScaleEvents(ch, testQueue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return numInFlight
+}
+
+func TestDeclareQueue(t *testing.T) {
+	ch := NewChannelMock()
+	DeclareQueue(ch, testQueue, testDeadLetterQueue)
+
+	args := ch.Declared[testQueue]
+	if args["x-delivery-limit"] != DeliveryLimit || args["x-dead-letter-exchange"] != DeadLetterExchange {
+		t.Errorf("Expected %s to be dead lettered to %s after %d deliveries, got %v", testQueue, DeadLetterExchange, DeliveryLimit, args)
+	}
+
+	deadLetterArgs, ok := ch.Declared[testDeadLetterQueue]
+	if !ok {
+		t.Fatalf("Expected %s to be declared", testDeadLetterQueue)
+	}
+
+	if _, ok := deadLetterArgs["x-delivery-limit"]; ok {
+		t.Errorf("Expected %s to have no delivery limit", testDeadLetterQueue)
+	}
+
+	if ch.Bindings[DeadLetterExchange][testQueue] != testDeadLetterQueue {
+		t.Errorf("Expected %s to route %s to %s, got %v", DeadLetterExchange, testQueue, testDeadLetterQueue, ch.Bindings)
+	}
+
+	if _, ok := ch.Declared[inFlightQueue(testQueue)]; !ok {
+		t.Errorf("Expected %s to be declared", inFlightQueue(testQueue))
+	}
+}
+
+func TestScaleEventDeadLetteredAtDeliveryLimit(t *testing.T) {
+	ch := NewChannelMock()
+	DeclareQueue(ch, testQueue, testDeadLetterQueue)
+	publishTestEvent(t, ch, "scaleEvent")
+
+	for i := 0; i <= DeliveryLimit; i++ {
+		msg, ok, err := ch.Get(testQueue, false)
+		if err != nil || !ok {
+			t.Fatalf("Expected delivery %d of the scale event, got %v", i+1, err)
+		}
+
+		if DeliveryCount(msg) != int64(i) {
+			t.Errorf("Expected delivery count %d, got %d", i, DeliveryCount(msg))
+		}
+
+		msg.Reject(true)
+	}
+
+	if pending, _ := GetPendingScaleEvents(ch, testQueue); pending != 0 {
+		t.Errorf("Expected the scale event to leave %s, %d remain", testQueue, pending)
+	}
+
+	deadLetters := ch.Queues[testDeadLetterQueue]
+	if len(deadLetters) != 1 || string(deadLetters[0].Body) != "scaleEvent" {
+		t.Fatalf("Expected the scale event to be dead lettered, got %v", deadLetters)
+	}
+
+	if reason := failureReason(deadLetters[0].Headers); reason != "delivery_limit" {
+		t.Errorf("Expected failure reason delivery_limit, got %s", reason)
+	}
+}
+
+func TestDeadLetterScaleEvent(t *testing.T) {
+	ch := NewChannelMock()
+	DeclareQueue(ch, testQueue, testDeadLetterQueue)
+	publishTestEvent(t, ch, "scaleEvent")
+
+	msg, _, _ := ch.Get(testQueue, false)
+	err := DeadLetterScaleEvent(context.Background(), ch, msg, "clone failed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadLetters := ch.Queues[testDeadLetterQueue]
+	if len(deadLetters) != 1 || failureReason(deadLetters[0].Headers) != "clone failed" {
+		t.Errorf("Expected the scale event to be dead lettered with its failure reason, got %v", deadLetters)
+	}
+}
+
+func TestRequeueDeadLetterEvents(t *testing.T) {
+	ch := NewChannelMock()
+	DeclareQueue(ch, testQueue, testDeadLetterQueue)
+
+	// The worker settles a dead lettered event
+	publishTestEvent(t, ch, "failed")
+	msg, _, _ := ch.Get(testQueue, false)
+	DeadLetterScaleEvent(context.Background(), ch, msg, "clone failed")
+	msg.Ack(false)
+	SettleInFlight(ch, testQueue)
+
+	publishTestEvent(t, ch, "pending")
+
+	numRequeued, err := RequeueDeadLetterEvents(context.Background(), ch, testDeadLetterQueue, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if numRequeued != 1 {
+		t.Errorf("Expected 1 requeued event, got %d", numRequeued)
+	}
+
+	if len(ch.Queues[testDeadLetterQueue]) != 0 {
+		t.Errorf("Expected %s to be empty, got %v", testDeadLetterQueue, ch.Queues[testDeadLetterQueue])
+	}
+
+	if pending, _ := GetPendingScaleEvents(ch, testQueue); pending != 2 {
+		t.Errorf("Expected 2 pending scale events, got %d", pending)
+	}
+
+	if numInFlight := inFlight(t, ch); numInFlight != 2 {
+		t.Fatalf("Expected the requeued event to be in flight along with the pending one, got %d", numInFlight)
+	}
+
+	// Settling the requeued event leaves the pending event counted
+	SettleInFlight(ch, testQueue)
+	if numInFlight := inFlight(t, ch); numInFlight != 1 {
+		t.Errorf("Expected 1 scale event in flight, got %d", numInFlight)
+	}
+}
+
+func TestRequeueDeadLetterEventsPublishFailure(t *testing.T) {
+	ch := NewChannelMock()
+	DeclareQueue(ch, testQueue, testDeadLetterQueue)
+	ch.Queues[testDeadLetterQueue] = []amqp.Delivery{{RoutingKey: testQueue, Body: []byte("failed")}}
+	ch.PublishErrs = map[string]error{testQueue: errors.New("channel closed")}
+
+	numRequeued, err := RequeueDeadLetterEvents(context.Background(), ch, testDeadLetterQueue, time.Minute)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	if numRequeued != 0 {
+		t.Errorf("Expected no requeued events, got %d", numRequeued)
+	}
+
+	if len(ch.Queues[testDeadLetterQueue]) != 1 {
+		t.Errorf("Expected the event to be left dead lettered, got %v", ch.Queues[testDeadLetterQueue])
+	}
+
+	if numInFlight := inFlight(t, ch); numInFlight != 0 {
+		t.Errorf("Expected the marker of the unpublished event to be settled, got %d in flight", numInFlight)
+	}
+}
@@ -0,0 +1,78 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// Returns scale events provisioning the first workers of a cluster which has
+// only control-plane nodes, without waiting for pods to fail to schedule.
+// Up to bootstrapKpNodes are provisioned, counting kpNode VMs which have not
+// yet become ready so that kpNodes which cannot become ready, e.g. as no CNI
+// is installed yet, are not provisioned over and over.
+func (scaler *ProxmoxScaler) bootstrapScaleEvents(
+	ctx context.Context,
+	nodeClasses []config.NodeClass,
+	numKpNodes map[string]int,
+	numCurrentEvents int,
+	explanation *ScaleUpExplanation,
+) ([]*ScaleEvent, error) {
+	workerNodes, err := scaler.Kubernetes.GetWorkerNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(workerNodes) > 0 {
+		return nil, nil
+	}
+
+	explanation.Bootstrapping = true
+
+	kpNodeVms, err := scaler.Proxmox.GetAllKpNodes(scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	numBootstrapEvents := scaler.currentConfig().BootstrapKpNodes - len(kpNodeVms) - numCurrentEvents
+	if numBootstrapEvents <= 0 {
+		explanation.Reasons = append(explanation.Reasons, fmt.Sprintf(
+			"The cluster only has control-plane nodes, waiting for %d bootstrap kpNodes to become ready",
+			len(kpNodeVms)+numCurrentEvents,
+		))
+		return nil, nil
+	}
+
+	if scaler.currentConfig().BootstrapNodeClass != "" {
+		nodeClasses = []config.NodeClass{scaler.currentConfig().NodeClass(scaler.currentConfig().BootstrapNodeClass)}
+	}
+
+	bootstrapScaleEvents := []*ScaleEvent{}
+	for range numBootstrapEvents {
+		nodeClass, ok := selectNodeClass(nodeClasses, numKpNodes)
+		if !ok {
+			explanation.Reasons = append(explanation.Reasons, "All node classes have reached maxNodes")
+			break
+		}
+
+		numKpNodes[nodeClass.Name]++
+
+		scaleEvent := ScaleEvent{
+			ScaleType: ScaleTypeUp,
+			NodeName:  scaler.newKpNodeName(),
+			NodeClass: nodeClass.Name,
+		}
+
+		bootstrapScaleEvents = append(bootstrapScaleEvents, &scaleEvent)
+		logger.DebugLog("Generated bootstrap scale event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+		explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+			NodeName:  scaleEvent.NodeName,
+			NodeClass: nodeClass.Name,
+			Reason:    "The cluster only has control-plane nodes, bootstrapping its first workers",
+		})
+	}
+
+	return bootstrapScaleEvents, nil
+}
@@ -0,0 +1,82 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func newBootstrapScaler(kubernetesMock *kubernetes.KubernetesMock, proxmoxMock *proxmox.ProxmoxMock) *ProxmoxScaler {
+	s := newExpanderScaler(ExpanderPriority, kubernetesMock, 20)
+	s.Proxmox = proxmoxMock
+	s.config.Bootstrap = true
+	s.config.BootstrapKpNodes = 2
+	return &s
+}
+
+func TestBootstrapProvisionsFirstWorkers(t *testing.T) {
+	s := newBootstrapScaler(&kubernetes.KubernetesMock{}, &proxmox.ProxmoxMock{})
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeClasses := nodeClassesOf(requiredScaleEvents)
+	if len(nodeClasses) != 2 || nodeClasses[0] != "small" || requiredScaleEvents[0].Cancellable {
+		t.Errorf("Expected 2 small bootstrap scale events, got %+v", requiredScaleEvents)
+	}
+
+	if !s.Explain().ScaleUp.Bootstrapping {
+		t.Error("Expected the explanation to report bootstrapping")
+	}
+}
+
+func TestBootstrapUsesBootstrapNodeClass(t *testing.T) {
+	s := newBootstrapScaler(&kubernetes.KubernetesMock{}, &proxmox.ProxmoxMock{})
+	s.config.BootstrapNodeClass = "large"
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeClasses := nodeClassesOf(requiredScaleEvents)
+	if len(nodeClasses) != 1 || nodeClasses[0] != "large" {
+		t.Errorf("Expected a single large bootstrap scale event, got %v", nodeClasses)
+	}
+}
+
+func TestBootstrapWaitsForUnreadyKpNodes(t *testing.T) {
+	s := newBootstrapScaler(&kubernetes.KubernetesMock{}, &proxmox.ProxmoxMock{
+		KpNodes: []proxmox.VmInformation{{Name: "kp-node-1"}, {Name: "kp-node-2"}},
+	})
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 {
+		t.Errorf("Expected no scale events while bootstrap kpNodes are not ready, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
+
+func TestBootstrapEndsOnceWorkersAreReady(t *testing.T) {
+	s := newBootstrapScaler(&kubernetes.KubernetesMock{
+		WorkerNodes: []apiv1.Node{{ObjectMeta: metav1.ObjectMeta{Name: "kp-node-1"}}},
+	}, &proxmox.ProxmoxMock{})
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 || s.Explain().ScaleUp.Bootstrapping {
+		t.Errorf("Expected no bootstrap scale events once the cluster has workers, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
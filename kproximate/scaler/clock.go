@@ -0,0 +1,31 @@
+package scaler
+
+import "time"
+
+// The source of time for the scaler's time dependent logic, e.g. claim
+// windows, patch intervals and retry timers, so that tests can simulate the
+// passing of time.
+type Clock interface {
+	Now() time.Time
+	// Sends the current time once the duration has passed
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// The clock, the system clock unless one is given.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return systemClock{}
+	}
+
+	return clock
+}
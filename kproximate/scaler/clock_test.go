@@ -0,0 +1,80 @@
+package scaler
+
+import (
+	"sync"
+	"time"
+)
+
+// A clock which only moves when advanced by the test.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+type fakeClockWaiter struct {
+	due time.Time
+	c   chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{
+		now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	waiter := fakeClockWaiter{due: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		waiter.c <- c.now
+		return waiter.c
+	}
+
+	c.waiters = append(c.waiters, waiter)
+	return waiter.c
+}
+
+// Moves the clock forward, firing the channels of any After calls that are
+// then due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiting := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.due.After(c.now) {
+			waiting = append(waiting, waiter)
+			continue
+		}
+
+		waiter.c <- c.now
+	}
+	c.waiters = waiting
+}
+
+// Waits until something is waiting on the clock.
+func (c *fakeClock) awaitWaiters(n int) {
+	for {
+		c.mu.Lock()
+		waiting := len(c.waiters)
+		c.mu.Unlock()
+
+		if waiting >= n {
+			return
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
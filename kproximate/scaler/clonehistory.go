@@ -0,0 +1,83 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// The number of recent clone durations kept for each storage
+	cloneHistorySize = 20
+	// Clones are only judged against the history once it has this many
+	minCloneSamples = 3
+	// A clone taking this many times longer than usual is abnormally slow
+	slowCloneFactor = 2
+)
+
+// Recent clone durations for each Proxmox storage, used to estimate how long
+// a clone will take and to spot abnormally slow clones, e.g. due to a
+// degraded storage backend.
+type cloneHistory struct {
+	mu        sync.Mutex
+	durations map[string][]time.Duration
+}
+
+func newCloneHistory() *cloneHistory {
+	return &cloneHistory{
+		durations: map[string][]time.Duration{},
+	}
+}
+
+func (h *cloneHistory) record(storage string, duration time.Duration) {
+	if h == nil {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	durations := append(h.durations[storage], duration)
+	if len(durations) > cloneHistorySize {
+		durations = durations[len(durations)-cloneHistorySize:]
+	}
+
+	h.durations[storage] = durations
+}
+
+// The median duration of recent clones to the storage, if there have been
+// enough to tell.
+func (h *cloneHistory) expected(storage string) (time.Duration, bool) {
+	if h == nil {
+		return 0, false
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.durations[storage]) < minCloneSamples {
+		return 0, false
+	}
+
+	durations := slices.Clone(h.durations[storage])
+	slices.Sort(durations)
+
+	return durations[len(durations)/2], true
+}
+
+// Whether the duration is abnormally slow for a clone to the storage
+func (h *cloneHistory) isSlow(storage string, duration time.Duration) bool {
+	expected, ok := h.expected(storage)
+	return ok && duration > expected*slowCloneFactor
+}
+
+// A context cancelled after the number of seconds, or only with its parent if
+// seconds is not positive.
+func withTimeoutSeconds(ctx context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, time.Second*time.Duration(seconds))
+}
@@ -0,0 +1,42 @@
+package scaler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCloneHistory(t *testing.T) {
+	h := newCloneHistory()
+
+	h.record("local-lvm", time.Second*20)
+	h.record("local-lvm", time.Second*30)
+	if _, ok := h.expected("local-lvm"); ok {
+		t.Error("Expected no estimate before enough clones were recorded")
+	}
+
+	h.record("local-lvm", time.Second*25)
+	expected, ok := h.expected("local-lvm")
+	if !ok || expected != time.Second*25 {
+		t.Errorf("Expected the median of 25s, got: %s", expected)
+	}
+
+	if h.isSlow("local-lvm", time.Second*40) {
+		t.Error("Expected a 40s clone not to be abnormally slow")
+	}
+
+	if !h.isSlow("local-lvm", time.Second*60) {
+		t.Error("Expected a 60s clone to be abnormally slow")
+	}
+
+	if h.isSlow("ceph-rbd", time.Hour) {
+		t.Error("Expected no judgement for a storage without history")
+	}
+
+	for range cloneHistorySize {
+		h.record("local-lvm", time.Minute)
+	}
+
+	if expected, _ := h.expected("local-lvm"); expected != time.Minute {
+		t.Errorf("Expected only the most recent clones to be kept, got: %s", expected)
+	}
+}
@@ -0,0 +1,91 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// The number of lines of console output captured from a kpNode which failed
+// to join, limited so that the output fits within a progress report
+const consoleLogLines = 100
+
+// How long capturing the console output of a kpNode may take
+const consoleLogTimeout = time.Second * 30
+
+// Implemented by provisioners able to retrieve the boot output of a machine,
+// which is attached to the failure of kpNodes that do not join the
+// kubernetes cluster.
+type ConsoleLogReader interface {
+	ConsoleLog(ctx context.Context, nodeName string) (string, error)
+}
+
+// A scale event error along with the console output captured from the kpNode
+// when it failed.
+type ConsoleLogError struct {
+	Err        error
+	ConsoleLog string
+}
+
+func (e *ConsoleLogError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConsoleLogError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the console output captured for a failed scale event, if any.
+func FailureConsoleLog(err error) string {
+	var consoleLogErr *ConsoleLogError
+	if errors.As(err, &consoleLogErr) {
+		return consoleLogErr.ConsoleLog
+	}
+
+	return ""
+}
+
+// Attaches the console output of the scale event's kpNode to the error if the
+// provisioner can read it. The kpNode is deleted once the scale event has
+// failed so this must happen beforehand.
+func (scaler *ProxmoxScaler) withConsoleLog(ctx context.Context, scaleEvent *ScaleEvent, err error) error {
+	reader, ok := scaler.Provisioner.(ConsoleLogReader)
+	if !ok {
+		return err
+	}
+
+	// The scale event's own deadline has usually passed by now
+	cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), consoleLogTimeout)
+	defer cancel()
+
+	consoleLog, logErr := reader.ConsoleLog(cctx, scaleEvent.NodeName)
+	if logErr != nil {
+		logger.WarnLog(fmt.Sprintf("Could not capture console output of %s", scaleEvent.NodeName), "error", logErr)
+		return err
+	}
+
+	consoleLog = lastLines(consoleLog, consoleLogLines)
+	if consoleLog == "" {
+		return err
+	}
+
+	logger.WarnLog(fmt.Sprintf("Console output of %s", scaleEvent.NodeName), "consoleLog", consoleLog)
+
+	return &ConsoleLogError{
+		Err:        err,
+		ConsoleLog: consoleLog,
+	}
+}
+
+func lastLines(output string, n int) string {
+	lines := strings.Split(strings.TrimRight(output, "\r\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return strings.Join(lines, "\n")
+}
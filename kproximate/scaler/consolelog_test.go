@@ -0,0 +1,62 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+type consoleLogProvisionerMock struct {
+	provisionerMock
+	consoleLog string
+}
+
+func (p *consoleLogProvisionerMock) ConsoleLog(ctx context.Context, nodeName string) (string, error) {
+	return p.consoleLog, nil
+}
+
+func TestScaleUpAttachesConsoleLogOnJoinTimeout(t *testing.T) {
+	s := newTestScaler(&consoleLogProvisionerMock{
+		consoleLog: "Cloud-init v. 23.4 running 'modules:final'\nfailed to run join command\n",
+	})
+	s.Kubernetes = &kubernetes.KubernetesMock{
+		NodeJoinErr: errors.New("timed out waiting for kp-node-a to join"),
+	}
+
+	var reported ScaleEventStatus
+	ctx := WithProgressReporter(context.Background(), func(status ScaleEventStatus) {
+		reported = status
+	})
+
+	scaleEvent := &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+	}
+
+	err := s.ScaleUp(ctx, scaleEvent)
+	if err == nil {
+		t.Fatal("Expected scale up to fail")
+	}
+
+	ReportFailure(ctx, scaleEvent, err)
+
+	if reported.Category != FailureJoinTimeout {
+		t.Errorf("Expected a join-timeout failure, got %s", reported.Category)
+	}
+
+	if reported.ConsoleLog != "Cloud-init v. 23.4 running 'modules:final'\nfailed to run join command" {
+		t.Errorf("Expected the console log to be reported, got %q", reported.ConsoleLog)
+	}
+}
+
+func TestLastLines(t *testing.T) {
+	output := strings.Repeat("line\n", consoleLogLines+10)
+
+	lines := strings.Split(lastLines(output, consoleLogLines), "\n")
+	if len(lines) != consoleLogLines {
+		t.Errorf("Expected %d lines, got %d", consoleLogLines, len(lines))
+	}
+}
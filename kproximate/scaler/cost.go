@@ -0,0 +1,74 @@
+package scaler
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+)
+
+// The estimated cost of a kpNode, from the cpu and memory of its node class
+type KpNodeCost struct {
+	NodeName  string  `json:"nodeName"`
+	NodeClass string  `json:"nodeClass"`
+	Cores     int     `json:"cores"`
+	MemoryGiB float64 `json:"memoryGiB"`
+	// The cost of running the kpNode for an hour
+	HourlyCost float64 `json:"hourlyCost"`
+	// The cost of the kpNode since it joined the cluster
+	AccruedCost float64   `json:"accruedCost"`
+	Created     time.Time `json:"created"`
+}
+
+// The estimated running cost of the kpNodes, at the configured cost per core
+// and GiB of memory per hour, as if their capacity were rented.
+type CostEstimate struct {
+	CostPerCoreHour float64 `json:"costPerCoreHour"`
+	CostPerGiBHour  float64 `json:"costPerGiBHour"`
+	// The cost of running all kpNodes for an hour
+	HourlyCost float64 `json:"hourlyCost"`
+	// The hourly cost of the kpNodes of each node class
+	NodeClassHourlyCost map[string]float64 `json:"nodeClassHourlyCost"`
+	KpNodes             []KpNodeCost       `json:"kpNodes"`
+}
+
+func (scaler *ProxmoxScaler) EstimateCost(ctx context.Context) (CostEstimate, error) {
+	estimate := CostEstimate{
+		CostPerCoreHour:     scaler.currentConfig().CostPerCoreHour,
+		CostPerGiBHour:      scaler.currentConfig().CostPerGiBHour,
+		NodeClassHourlyCost: map[string]float64{},
+		KpNodes:             []KpNodeCost{},
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return estimate, err
+	}
+
+	now := scaler.now()
+	for _, kpNode := range kpNodes {
+		nodeClass := scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel])
+		memoryGiB := float64(nodeClass.Memory) / 1024
+		hourlyCost := float64(nodeClass.Cores)*scaler.currentConfig().CostPerCoreHour + memoryGiB*scaler.currentConfig().CostPerGiBHour
+
+		created := kpNode.CreationTimestamp.Time
+		estimate.KpNodes = append(estimate.KpNodes, KpNodeCost{
+			NodeName:    kpNode.Name,
+			NodeClass:   nodeClass.Name,
+			Cores:       nodeClass.Cores,
+			MemoryGiB:   memoryGiB,
+			HourlyCost:  hourlyCost,
+			AccruedCost: hourlyCost * max(now.Sub(created).Hours(), 0),
+			Created:     created,
+		})
+
+		estimate.HourlyCost += hourlyCost
+		estimate.NodeClassHourlyCost[nodeClass.Name] += hourlyCost
+	}
+
+	slices.SortFunc(estimate.KpNodes, func(a, b KpNodeCost) int {
+		return cmp.Compare(a.NodeName, b.NodeName)
+	})
+
+	return estimate, nil
+}
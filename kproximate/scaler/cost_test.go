@@ -0,0 +1,66 @@
+package scaler
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEstimateCost(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "kp-node-2",
+						Labels:            map[string]string{nodeClassLabel: "large"},
+						CreationTimestamp: metav1.NewTime(time.Now().Add(-2 * time.Hour)),
+					},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:              "kp-node-1",
+						Labels:            map[string]string{nodeClassLabel: "small"},
+						CreationTimestamp: metav1.NewTime(time.Now()),
+					},
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			CostPerCoreHour: 0.02,
+			CostPerGiBHour:  0.005,
+			KpNodeClasses: config.NodeClasses{
+				{Name: "small", Cores: 2, Memory: 2048},
+				{Name: "large", Cores: 8, Memory: 16384},
+			},
+		},
+	}
+
+	estimate, err := s.EstimateCost(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(estimate.KpNodes) != 2 || estimate.KpNodes[0].NodeName != "kp-node-1" {
+		t.Fatalf("Expected both kpNodes sorted by name, got %+v", estimate.KpNodes)
+	}
+
+	// 8 cores at 0.02 and 16GiB at 0.005
+	if math.Abs(estimate.NodeClassHourlyCost["large"]-0.24) > 1e-9 {
+		t.Errorf("Expected large node class to cost 0.24 per hour, got %f", estimate.NodeClassHourlyCost["large"])
+	}
+
+	if math.Abs(estimate.HourlyCost-0.29) > 1e-9 {
+		t.Errorf("Expected a total hourly cost of 0.29, got %f", estimate.HourlyCost)
+	}
+
+	if math.Abs(estimate.KpNodes[1].AccruedCost-0.48) > 1e-3 {
+		t.Errorf("Expected kp-node-2 to have accrued 0.48, got %f", estimate.KpNodes[1].AccruedCost)
+	}
+}
@@ -0,0 +1,200 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// Leaves out pHosts which are draining, unless all of them are, so that
+// kpNodes are not provisioned only to be moved again.
+func (scaler *ProxmoxScaler) excludeDrainingHosts(hosts []proxmox.HostInformation) []proxmox.HostInformation {
+	if !scaler.currentConfig().DrainHosts {
+		return hosts
+	}
+
+	draining, err := scaler.Proxmox.GetDrainingHosts()
+	if err != nil {
+		logger.WarnLog("Failed to get draining hosts", "error", err)
+		return hosts
+	}
+
+	available := slices.DeleteFunc(slices.Clone(hosts), func(host proxmox.HostInformation) bool {
+		return slices.Contains(draining, host.Node)
+	})
+	if len(available) == 0 {
+		return hosts
+	}
+
+	return available
+}
+
+// Generates a migrate event for each running kpNode on a draining pHost,
+// targeting a pHost which is not draining. kpNodes are left where they are
+// when there is nowhere else for them to go.
+func (scaler *ProxmoxScaler) AssessDrainingHosts(ctx context.Context) ([]*ScaleEvent, error) {
+	if !scaler.currentConfig().DrainHosts {
+		return nil, nil
+	}
+
+	draining, err := scaler.Proxmox.GetDrainingHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(draining) == 0 {
+		return nil, nil
+	}
+
+	runningKpNodes, err := scaler.Proxmox.GetRunningKpNodes(scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeClasses := map[string]string{}
+	for _, kpNode := range kpNodes {
+		nodeClasses[kpNode.Name] = kpNode.Labels[nodeClassLabel]
+	}
+
+	migrateEvents := []*ScaleEvent{}
+	for _, vm := range runningKpNodes {
+		if !slices.Contains(draining, vm.Node) {
+			continue
+		}
+
+		migrateEvents = append(migrateEvents, &ScaleEvent{
+			ScaleType: ScaleTypeMigrate,
+			NodeName:  vm.Name,
+			NodeClass: scaler.currentConfig().NodeClass(nodeClasses[vm.Name]).Name,
+		})
+	}
+
+	if len(migrateEvents) == 0 {
+		return nil, nil
+	}
+
+	err = scaler.SelectTargetHosts(migrateEvents)
+	if err != nil && !errors.Is(err, errUnplaceable) {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(migrateEvents, func(scaleEvent *ScaleEvent) bool {
+		if scaleEvent.TargetHost.Node == "" {
+			logger.WarnLog(fmt.Sprintf("No host has capacity to move %s to, it is left on its draining host", scaleEvent.NodeName))
+			return true
+		}
+
+		if slices.Contains(draining, scaleEvent.TargetHost.Node) {
+			logger.WarnLog(fmt.Sprintf("No host to move %s to, it is left on draining host %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+			return true
+		}
+
+		logger.DebugLog("Generated migrate event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+		return false
+	}), nil
+}
+
+// Live migrates the kpNode to the target host. A kpNode with disks on local
+// storage is cordoned while they are copied, which can take some time. If the
+// kpNode cannot be migrated it is replaced by a kpNode on the target host
+// instead.
+func (scaler *ProxmoxScaler) Migrate(ctx context.Context, scaleEvent *ScaleEvent) error {
+	if scaleEvent.ScaleType != ScaleTypeMigrate {
+		return fmt.Errorf("expected ScaleEvent ScaleType to be '%d' but got: %d", ScaleTypeMigrate, scaleEvent.ScaleType)
+	}
+
+	cordon, err := scaler.Proxmox.KpNodeHasLocalDisks(scaleEvent.NodeName)
+	if err != nil {
+		logger.WarnLog(fmt.Sprintf("Failed to check the storage of %s, cordoning it", scaleEvent.NodeName), "error", err)
+		cordon = true
+	}
+
+	if cordon {
+		err = scaler.Kubernetes.CordonKpNode(ctx, scaleEvent.NodeName)
+		if err != nil {
+			return classifiedError(FailureKubernetesApi, err)
+		}
+	}
+
+	logger.InfoLog(fmt.Sprintf("Migrating %s to %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+
+	err = scaler.Proxmox.MigrateKpNode(scaleEvent.NodeName, scaleEvent.TargetHost.Node)
+	if err != nil {
+		logger.WarnLog(fmt.Sprintf("Failed to migrate %s, replacing it", scaleEvent.NodeName), "error", err)
+		return scaler.replaceUnmigrated(ctx, scaleEvent)
+	}
+
+	labels := scaler.topologyLabels(scaleEvent.TargetHost.Node)
+	if scaler.currentConfig().KpNodeLabels != "" {
+		renderedLabels, err := scaler.renderNodeLabels(scaleEvent)
+		if err != nil {
+			return err
+		}
+
+		maps.Copy(labels, renderedLabels)
+	}
+
+	if len(labels) > 0 {
+		err = scaler.Kubernetes.LabelKpNode(ctx, scaleEvent.NodeName, labels)
+		if err != nil {
+			return classifiedError(FailureKubernetesApi, err)
+		}
+	}
+
+	if cordon {
+		err = scaler.Kubernetes.UncordonKpNode(ctx, scaleEvent.NodeName)
+		if err != nil {
+			return classifiedError(FailureKubernetesApi, err)
+		}
+	}
+
+	logger.InfoLog(fmt.Sprintf("Migrated %s to %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+	ReportProgress(ctx, scaleEvent, ScaleEventMigrated, "")
+
+	return nil
+}
+
+// Provisions a kpNode of the same node class on the target host of the
+// migrate event before draining and removing the kpNode which could not be
+// migrated. The replacement is kept if only the removal fails, otherwise it
+// is deleted and the unmigrated kpNode uncordoned so it remains usable.
+func (scaler *ProxmoxScaler) replaceUnmigrated(ctx context.Context, scaleEvent *ScaleEvent) error {
+	replaceEvent := &ScaleEvent{
+		ScaleType:       ScaleTypeReplace,
+		NodeName:        scaler.newKpNodeName(),
+		NodeClass:       scaleEvent.NodeClass,
+		ReplaceNodeName: scaleEvent.NodeName,
+		TargetHost:      scaleEvent.TargetHost,
+	}
+
+	err := scaler.Replace(ctx, replaceEvent)
+	var replacedErr *ReplacedNodeError
+	if errors.As(err, &replacedErr) {
+		return err
+	}
+
+	if err != nil {
+		_ = scaler.DeleteNode(ctx, replaceEvent.NodeName)
+
+		uncordonErr := scaler.Kubernetes.UncordonKpNode(context.WithoutCancel(ctx), scaleEvent.NodeName)
+		if uncordonErr != nil {
+			logger.WarnLog(fmt.Sprintf("Failed to uncordon %s after it could not be replaced", scaleEvent.NodeName), "error", uncordonErr)
+		}
+
+		return err
+	}
+
+	ReportProgress(ctx, scaleEvent, ScaleEventDeleted, fmt.Sprintf("Replaced by %s", replaceEvent.NodeName))
+
+	return nil
+}
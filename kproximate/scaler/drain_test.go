@@ -0,0 +1,175 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestAssessDrainingHosts(t *testing.T) {
+	kpNode := apiv1.Node{}
+	kpNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	kpNode.Labels = map[string]string{nodeClassLabel: "large"}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{kpNode},
+		},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: weightedHosts(0),
+			RunningKpNodes: []proxmox.VmInformation{
+				{Name: kpNode.Name, Node: "host-01"},
+				{Name: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a", Node: "host-02"},
+			},
+			DrainingHosts: []string{"host-01", "nas"},
+		},
+		config: config.KproximateConfig{
+			DrainHosts: true,
+			KpNodeClasses: config.NodeClasses{
+				{Name: "small", Cores: 2, Memory: 2048},
+				{Name: "large", Cores: 4, Memory: 8192},
+			},
+		},
+	}
+
+	migrateEvents, err := s.AssessDrainingHosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrateEvents) != 1 {
+		t.Fatalf("Expected exactly 1 migrate event, got: %d", len(migrateEvents))
+	}
+
+	migrateEvent := migrateEvents[0]
+	if migrateEvent.ScaleType != ScaleTypeMigrate || migrateEvent.NodeName != kpNode.Name || migrateEvent.NodeClass != "large" {
+		t.Errorf("Expected a migrate event for %s of the large node class, got %+v", kpNode.Name, migrateEvent)
+	}
+
+	if migrateEvent.TargetHost.Node != "host-03" {
+		t.Errorf("Expected the kpNode to be moved to the empty host host-03, got %s", migrateEvent.TargetHost.Node)
+	}
+}
+
+func TestAssessDrainingHostsWithNowhereToGo(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: weightedHosts(0)[:1],
+			RunningKpNodes: []proxmox.VmInformation{
+				{Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", Node: "nas"},
+			},
+			DrainingHosts: []string{"nas"},
+		},
+		config: config.KproximateConfig{
+			DrainHosts:   true,
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	migrateEvents, err := s.AssessDrainingHosts(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(migrateEvents) != 0 {
+		t.Errorf("Expected no migrate events when every host is draining, got: %d", len(migrateEvents))
+	}
+}
+
+func TestSelectTargetHostsAvoidsDrainingHosts(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats:  weightedHosts(0),
+			DrainingHosts: []string{"nas", "host-01"},
+		},
+		config: config.KproximateConfig{
+			DrainHosts:   true,
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	scaleEvents := []*ScaleEvent{}
+	for idx := range 4 {
+		scaleEvents = append(scaleEvents, &ScaleEvent{ScaleType: ScaleTypeUp, NodeName: fmt.Sprintf("kp-node-%d", idx)})
+	}
+
+	err := s.SelectTargetHosts(scaleEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scaleEvent := range scaleEvents {
+		if slices.Contains([]string{"nas", "host-01"}, scaleEvent.TargetHost.Node) {
+			t.Errorf("Expected %s not to target draining host %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node)
+		}
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	kubernetesMock := &kubernetes.KubernetesMock{}
+	proxmoxMock := &proxmox.ProxmoxMock{LocalDisks: true}
+
+	s := ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		Proxmox:    proxmoxMock,
+	}
+
+	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	err := s.Migrate(context.Background(), &ScaleEvent{
+		ScaleType:  ScaleTypeMigrate,
+		NodeName:   kpNodeName,
+		TargetHost: proxmox.HostInformation{Node: "host-02"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proxmoxMock.MigratedKpNodes[kpNodeName] != "host-02" {
+		t.Errorf("Expected %s to be migrated to host-02, got %v", kpNodeName, proxmoxMock.MigratedKpNodes)
+	}
+
+	if !slices.Equal(kubernetesMock.CordonedNodes, []string{kpNodeName}) || !slices.Equal(kubernetesMock.UncordonedNodes, []string{kpNodeName}) {
+		t.Errorf("Expected %s to be cordoned while it was migrated, cordoned: %v, uncordoned: %v", kpNodeName, kubernetesMock.CordonedNodes, kubernetesMock.UncordonedNodes)
+	}
+
+	if len(kubernetesMock.DeletedNodes) != 0 {
+		t.Errorf("Expected no kpNodes to be deleted, got %v", kubernetesMock.DeletedNodes)
+	}
+}
+
+func TestMigrateWithSharedStorage(t *testing.T) {
+	kubernetesMock := &kubernetes.KubernetesMock{}
+	proxmoxMock := &proxmox.ProxmoxMock{}
+
+	s := ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		Proxmox:    proxmoxMock,
+	}
+
+	kpNodeName := "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	err := s.Migrate(context.Background(), &ScaleEvent{
+		ScaleType:  ScaleTypeMigrate,
+		NodeName:   kpNodeName,
+		TargetHost: proxmox.HostInformation{Node: "host-02"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proxmoxMock.MigratedKpNodes[kpNodeName] != "host-02" {
+		t.Errorf("Expected %s to be migrated to host-02, got %v", kpNodeName, proxmoxMock.MigratedKpNodes)
+	}
+
+	if len(kubernetesMock.CordonedNodes) != 0 {
+		t.Errorf("Expected a kpNode on shared storage not to be cordoned, got %v", kubernetesMock.CordonedNodes)
+	}
+}
@@ -0,0 +1,83 @@
+package scaler
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The latest version of the ScaleEvent encoding. Events published before
+// versioning was introduced have no version and are decoded as version 0,
+// which is otherwise identical to version 1. Version 2 added migrate events
+// and version 3 patch events.
+//
+// Optional fields may be added without a new version as unknown fields are
+// ignored when decoding, the version is only raised when older workers would
+// misinterpret an event.
+const ScaleEventVersion = 3
+
+// Returned when decoding a scale event published for a newer worker, which
+// should be left for a worker that supports it.
+var ErrUnsupportedScaleEventVersion = errors.New("unsupported scale event version")
+
+//go:embed scaleevent.schema.json
+var ScaleEventSchema []byte
+
+// The oldest version able to represent the scale event. Scale events are
+// published with this version so that workers of an older release can
+// still process them during a rolling upgrade.
+func RequiredScaleEventVersion(scaleEvent *ScaleEvent) int {
+	switch scaleEvent.ScaleType {
+	case ScaleTypeMigrate:
+		return 2
+	case ScaleTypePatch:
+		return 3
+	}
+
+	return 1
+}
+
+func EncodeScaleEvent(scaleEvent *ScaleEvent) ([]byte, error) {
+	scaleEvent.Version = RequiredScaleEventVersion(scaleEvent)
+	return json.Marshal(scaleEvent)
+}
+
+// Decodes and validates a scale event. Field names are matched case
+// insensitively so events encoded before the field names were fixed decode
+// correctly.
+func DecodeScaleEvent(data []byte) (*ScaleEvent, error) {
+	var scaleEvent ScaleEvent
+	err := json.Unmarshal(data, &scaleEvent)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode scale event: %w", err)
+	}
+
+	if scaleEvent.Version > ScaleEventVersion {
+		return nil, fmt.Errorf("%w %d, the latest supported version is %d", ErrUnsupportedScaleEventVersion, scaleEvent.Version, ScaleEventVersion)
+	}
+
+	switch scaleEvent.ScaleType {
+	case ScaleTypeUp:
+	case ScaleTypeDown:
+		if scaleEvent.NodeName == "" {
+			return nil, fmt.Errorf("scale down event has no nodeName")
+		}
+	case ScaleTypeReplace:
+		if scaleEvent.ReplaceNodeName == "" {
+			return nil, fmt.Errorf("replace event has no replaceNodeName")
+		}
+	case ScaleTypeMigrate:
+		if scaleEvent.NodeName == "" || scaleEvent.TargetHost.Node == "" {
+			return nil, fmt.Errorf("migrate event has no nodeName or targetHost")
+		}
+	case ScaleTypePatch:
+		if scaleEvent.NodeName == "" {
+			return nil, fmt.Errorf("patch event has no nodeName")
+		}
+	default:
+		return nil, fmt.Errorf("unknown scaleType %d", scaleEvent.ScaleType)
+	}
+
+	return &scaleEvent, nil
+}
@@ -0,0 +1,99 @@
+package scaler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestDecodeScaleEventBeforeVersioning(t *testing.T) {
+	scaleEvent, err := DecodeScaleEvent([]byte(`{"ScaleType":-1,"NodeName":"kp-node-1","NodeClass":"","TargetHost":{"node":"host-01"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.Version != 0 || scaleEvent.ScaleType != ScaleTypeDown || scaleEvent.NodeName != "kp-node-1" || scaleEvent.TargetHost.Node != "host-01" {
+		t.Errorf("Unexpected scale event: %+v", scaleEvent)
+	}
+}
+
+func TestEncodeScaleEventRoundTrip(t *testing.T) {
+	data, err := EncodeScaleEvent(&ScaleEvent{
+		ScaleType:       ScaleTypeReplace,
+		NodeName:        "kp-node-2",
+		NodeClass:       "large",
+		ReplaceNodeName: "kp-node-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scaleEvent, err := DecodeScaleEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.Version != 1 || scaleEvent.NodeClass != "large" || scaleEvent.ReplaceNodeName != "kp-node-1" {
+		t.Errorf("Unexpected scale event: %+v", scaleEvent)
+	}
+}
+
+func TestEncodeScaleEventUsesRequiredVersion(t *testing.T) {
+	data, err := EncodeScaleEvent(&ScaleEvent{
+		ScaleType:  ScaleTypeMigrate,
+		NodeName:   "kp-node-1",
+		TargetHost: proxmox.HostInformation{Node: "host-02"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scaleEvent, err := DecodeScaleEvent(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.Version != 2 {
+		t.Errorf("Expected migrate events to be encoded as version 2, got %d", scaleEvent.Version)
+	}
+}
+
+func TestDecodeScaleEventFromNewerVersion(t *testing.T) {
+	_, err := DecodeScaleEvent([]byte(fmt.Sprintf(`{"version":%d,"scaleType":1,"someNewField":true}`, ScaleEventVersion+1)))
+	if !errors.Is(err, ErrUnsupportedScaleEventVersion) {
+		t.Errorf("Expected ErrUnsupportedScaleEventVersion, got %v", err)
+	}
+
+	_, err = DecodeScaleEvent([]byte(fmt.Sprintf(`{"version":%d,"scaleType":1,"someNewField":true}`, ScaleEventVersion)))
+	if err != nil {
+		t.Errorf("Expected unknown fields to be ignored, got %v", err)
+	}
+}
+
+func TestDecodeScaleEventRejectsInvalidEvents(t *testing.T) {
+	invalidEvents := []string{
+		`{"version":4,"scaleType":1}`,
+		`{"version":1,"scaleType":5}`,
+		`{"version":3,"scaleType":4}`,
+		`{"version":1,"scaleType":3,"nodeName":"kp-node-3"}`,
+		`{"version":1,"scaleType":-1}`,
+		`{"version":1,"scaleType":2,"nodeName":"kp-node-2"}`,
+		`not json`,
+	}
+
+	for _, event := range invalidEvents {
+		_, err := DecodeScaleEvent([]byte(event))
+		if err == nil {
+			t.Errorf("Expected an error decoding %s", event)
+		}
+	}
+}
+
+func TestScaleEventSchemaIsValidJSON(t *testing.T) {
+	if !json.Valid(ScaleEventSchema) {
+		t.Error("Expected the scale event schema to be valid JSON")
+	}
+}
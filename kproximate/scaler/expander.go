@@ -0,0 +1,148 @@
+package scaler
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// Strategies for choosing the node class of a new kpNode when several could
+// satisfy pending pods, following the cluster-autoscaler expanders.
+const (
+	// The node class with the highest priority, then the first listed
+	ExpanderPriority = "priority"
+	// The node class which leaves the least cpu and memory unused
+	ExpanderLeastWaste = "least-waste"
+	// The node class which could schedule the most pending pods
+	ExpanderMostPods = "most-pods"
+	// Any node class
+	ExpanderRandom = "random"
+)
+
+// Returns the node classes which have not reached their maxNodes, highest
+// priority first and otherwise in the order they are listed.
+func eligibleNodeClasses(nodeClasses []config.NodeClass, numKpNodes map[string]int) []config.NodeClass {
+	eligible := []config.NodeClass{}
+	for _, nodeClass := range nodeClasses {
+		if nodeClass.MaxNodes == 0 || numKpNodes[nodeClass.Name] < nodeClass.MaxNodes {
+			eligible = append(eligible, nodeClass)
+		}
+	}
+
+	slices.SortStableFunc(eligible, func(a, b config.NodeClass) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+
+	return eligible
+}
+
+// The fraction of a kpNode's cpu and memory left unused, summed, when enough
+// kpNodes of the node class are added to satisfy the unaccounted resources.
+func (scaler *ProxmoxScaler) wastedResources(nodeClass config.NodeClass, unaccountedCpu float64, unaccountedMemory int64) float64 {
+	nodeCpu := scaler.schedulableCpu(nodeClass)
+	nodeMemory := float64(scaler.schedulableMemory(nodeClass))
+	if nodeCpu <= 0 || nodeMemory <= 0 {
+		return math.Inf(1)
+	}
+
+	requiredCpu := max(unaccountedCpu, 0)
+	requiredMemory := max(float64(unaccountedMemory), 0)
+
+	numNodes := max(math.Ceil(requiredCpu/nodeCpu), math.Ceil(requiredMemory/nodeMemory), 1)
+	totalCpu := numNodes * nodeCpu
+	totalMemory := numNodes * nodeMemory
+
+	return (totalCpu-min(requiredCpu, totalCpu))/totalCpu + (totalMemory-min(requiredMemory, totalMemory))/totalMemory
+}
+
+// Places pending pods on a single kpNode of the node class, up to its
+// maxPods, returning the number placed and the pods left over.
+func (scaler *ProxmoxScaler) fitPods(nodeClass config.NodeClass, pendingPods []kubernetes.UnschedulablePod) (int, []kubernetes.UnschedulablePod) {
+	freeCpu := scaler.schedulableCpu(nodeClass)
+	freeMemory := scaler.schedulableMemory(nodeClass)
+	freeExtended := nodeClassExtendedResources(nodeClass)
+	maxPods := nodeClassMaxPods(nodeClass)
+
+	placed := 0
+	remaining := []kubernetes.UnschedulablePod{}
+	for _, pod := range pendingPods {
+		if placed < maxPods && pod.Cpu <= freeCpu && pod.Memory <= freeMemory && fitsExtended(pod.Extended, freeExtended) && scaler.podMisfit(pod, nodeClass) == "" {
+			freeCpu -= pod.Cpu
+			freeMemory -= pod.Memory
+			for name, quantity := range pod.Extended {
+				freeExtended[name] -= quantity
+			}
+			placed++
+			continue
+		}
+
+		remaining = append(remaining, pod)
+	}
+
+	return placed, remaining
+}
+
+// Chooses the node class of the next kpNode from the eligible node classes
+// using the configured expander. Returns the pending pods which the new kpNode
+// would not schedule, which are only tracked by the most-pods expander and
+// when routing rules are configured.
+func (scaler *ProxmoxScaler) expand(
+	candidates []config.NodeClass,
+	unaccountedCpu float64,
+	unaccountedMemory int64,
+	pendingPods []kubernetes.UnschedulablePod,
+) (config.NodeClass, []kubernetes.UnschedulablePod) {
+	// Routed pods can only be scheduled by their node classes, so each kpNode
+	// is chosen for the first pod still to be placed and the pods it would
+	// schedule are set aside, as the most-pods expander does
+	routing := len(scaler.currentConfig().RoutingRules) > 0 && scaler.currentConfig().Expander != ExpanderMostPods && len(pendingPods) > 0
+	if routing {
+		if routed := scaler.fittingNodeClasses(candidates, pendingPods[:1]); len(routed) > 0 {
+			candidates = routed
+		}
+	}
+
+	var selected config.NodeClass
+	switch scaler.currentConfig().Expander {
+	case ExpanderLeastWaste:
+		selected = candidates[0]
+		leastWaste := scaler.wastedResources(selected, unaccountedCpu, unaccountedMemory)
+		for _, nodeClass := range candidates[1:] {
+			waste := scaler.wastedResources(nodeClass, unaccountedCpu, unaccountedMemory)
+			if waste < leastWaste {
+				selected = nodeClass
+				leastWaste = waste
+			}
+		}
+
+	case ExpanderMostPods:
+		selected = candidates[0]
+		mostPods, remaining := scaler.fitPods(selected, pendingPods)
+		for _, nodeClass := range candidates[1:] {
+			placed, nodeClassRemaining := scaler.fitPods(nodeClass, pendingPods)
+			if placed > mostPods {
+				selected = nodeClass
+				mostPods = placed
+				remaining = nodeClassRemaining
+			}
+		}
+
+		return selected, remaining
+
+	case ExpanderRandom:
+		selected = candidates[rand.IntN(len(candidates))]
+
+	default:
+		selected = candidates[0]
+	}
+
+	if routing {
+		_, pendingPods = scaler.fitPods(selected, pendingPods)
+	}
+
+	return selected, pendingPods
+}
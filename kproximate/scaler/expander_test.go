@@ -0,0 +1,157 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+func newExpanderScaler(expander string, kubernetesMock *kubernetes.KubernetesMock, smallPriority int) ProxmoxScaler {
+	return ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		config: config.KproximateConfig{
+			Expander: expander,
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:     "small",
+					Cores:    2,
+					Memory:   2048,
+					Priority: smallPriority,
+				},
+				{
+					Name:     "large",
+					Cores:    8,
+					Memory:   16384,
+					Priority: 10,
+				},
+			},
+			MaxKpNodes: 10,
+		},
+	}
+}
+
+func nodeClassesOf(scaleEvents []*ScaleEvent) []string {
+	nodeClasses := []string{}
+	for _, scaleEvent := range scaleEvents {
+		nodeClasses = append(nodeClasses, scaleEvent.NodeClass)
+	}
+
+	return nodeClasses
+}
+
+func TestPriorityExpanderPrefersHighestPriority(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 3,
+		},
+	}, 0)
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 1 || requiredScaleEvents[0].NodeClass != "large" {
+		t.Errorf("Expected a single large scaleEvent, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
+
+func TestPriorityExpanderUsesListOrderForEqualPriorities(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 3,
+		},
+	}, 10)
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 2 || requiredScaleEvents[0].NodeClass != "small" {
+		t.Errorf("Expected 2 small scaleEvents, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
+
+func TestLeastWasteExpander(t *testing.T) {
+	tests := []struct {
+		resources kubernetes.UnschedulableResources
+		expected  []string
+	}{
+		{
+			// 3 small nodes leave no cpu and a third of their memory unused
+			resources: kubernetes.UnschedulableResources{
+				Cpu:    6,
+				Memory: 4 << 30,
+			},
+			expected: []string{"small", "small", "small"},
+		},
+		{
+			resources: kubernetes.UnschedulableResources{
+				Cpu:    7.5,
+				Memory: 14 << 30,
+			},
+			expected: []string{"large"},
+		},
+	}
+
+	for _, test := range tests {
+		s := newExpanderScaler(ExpanderLeastWaste, &kubernetes.KubernetesMock{
+			UnschedulableResources: test.resources,
+		}, 0)
+
+		requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		nodeClasses := nodeClassesOf(requiredScaleEvents)
+		if len(nodeClasses) != len(test.expected) || nodeClasses[0] != test.expected[0] {
+			t.Errorf("Expected %v for %+v, got %v", test.expected, test.resources, nodeClasses)
+		}
+	}
+}
+
+func TestMostPodsExpander(t *testing.T) {
+	smallPod := kubernetes.UnschedulablePod{UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1, Memory: 1 << 30}}
+	largePod := kubernetes.UnschedulablePod{UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 6, Memory: 12 << 30}}
+
+	s := newExpanderScaler(ExpanderMostPods, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu:    10,
+			Memory: 16 << 30,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			smallPod, smallPod, smallPod, smallPod, largePod,
+		},
+	}, 20)
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeClasses := nodeClassesOf(requiredScaleEvents)
+	if len(nodeClasses) != 2 || nodeClasses[0] != "large" || nodeClasses[1] != "large" {
+		t.Errorf("Expected 2 large scaleEvents, got %v", nodeClasses)
+	}
+}
+
+func TestRandomExpanderSelectsEligibleNodeClass(t *testing.T) {
+	s := newExpanderScaler(ExpanderRandom, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 1,
+		},
+	}, 0)
+	s.config.KpNodeClasses[1].MaxNodes = 1
+
+	for i := 0; i < 20; i++ {
+		candidates := eligibleNodeClasses(s.config.KpNodeClasses, map[string]int{"large": 1})
+		nodeClass, _ := s.expand(candidates, 1, 0, nil)
+		if nodeClass.Name != "small" {
+			t.Fatalf("Expected only the small node class to be selected, got %s", nodeClass.Name)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package scaler
+
+import (
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// How the scaler arrived at its most recent scaling decisions, served by the
+// controller to explain why the cluster was or wasn't scaled.
+type Explanation struct {
+	ScaleUp   ScaleUpExplanation   `json:"scaleUp"`
+	ScaleDown ScaleDownExplanation `json:"scaleDown"`
+}
+
+type ScaleUpExplanation struct {
+	// The pending pods whose resource requests were summed
+	UnschedulablePods []kubernetes.UnschedulablePod `json:"unschedulablePods"`
+	UnschedulableCpu  float64                       `json:"unschedulableCpu"`
+	// Bytes
+	UnschedulableMemory int64 `json:"unschedulableMemory"`
+	// Extended resources such as nvidia.com/gpu, by name
+	UnschedulableExtended map[string]int64 `json:"unschedulableExtended,omitempty"`
+	// Scale up events already queued or in progress
+	InProgressScaleEvents int `json:"inProgressScaleEvents"`
+	// The resources the in-progress scale up events are expected to provide
+	ExpectedCpu    float64 `json:"expectedCpu"`
+	ExpectedMemory int64   `json:"expectedMemory"`
+	// The resources still required once in-progress scale up events complete
+	UnaccountedCpu    float64                 `json:"unaccountedCpu"`
+	UnaccountedMemory int64                   `json:"unaccountedMemory"`
+	ScaleEvents       []ScaleEventExplanation `json:"scaleEvents"`
+	Reasons           []string                `json:"reasons,omitempty"`
+	// Whether the cluster has only control-plane nodes and its first
+	// workers are being provisioned, see bootstrap
+	Bootstrapping bool `json:"bootstrapping,omitempty"`
+	// The gangs of the pending pods as namespace/gang, whose kpNodes are
+	// scaled up for all at once or not at all
+	Gangs []string `json:"gangs,omitempty"`
+}
+
+// Why a scale event was generated.
+type ScaleEventExplanation struct {
+	NodeName  string `json:"nodeName"`
+	NodeClass string `json:"nodeClass,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+type ScaleDownExplanation struct {
+	AllocatedCpu      float64 `json:"allocatedCpu"`
+	AllocatableCpu    int64   `json:"allocatableCpu"`
+	AllocatedMemory   float64 `json:"allocatedMemory"`
+	AllocatableMemory int64   `json:"allocatableMemory"`
+	// What kpNodes are using according to metrics-server, when it is more
+	// than their allocations it is used in their place, see scaleDownOnUsage
+	UsedCpu    float64 `json:"usedCpu,omitempty"`
+	UsedMemory float64 `json:"usedMemory,omitempty"`
+	// The percentage of each resource left free if a kpNode were removed,
+	// which must exceed LoadHeadroom for a scale down to be acceptable
+	CpuHeadroom    int64                   `json:"cpuHeadroom"`
+	MemoryHeadroom int64                   `json:"memoryHeadroom"`
+	LoadHeadroom   float64                 `json:"loadHeadroom"`
+	Acceptable     bool                    `json:"acceptable"`
+	ScaleEvents    []ScaleEventExplanation `json:"scaleEvents"`
+	Reasons        []string                `json:"reasons,omitempty"`
+}
+
+// Returns how the most recent call to RequiredScaleEvents and AssessScaleDown
+// arrived at their scale events.
+func (scaler *ProxmoxScaler) Explain() Explanation {
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	return scaler.explanation
+}
+
+// Explanations are replaced rather than modified once recorded, as Explain
+// shares them with its callers.
+func (scaler *ProxmoxScaler) explainScaleUp(explanation ScaleUpExplanation) {
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	scaler.explanation.ScaleUp = explanation
+}
+
+func (scaler *ProxmoxScaler) explainScaleDown(explanation ScaleDownExplanation) {
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	scaler.explanation.ScaleDown = explanation
+}
@@ -0,0 +1,114 @@
+package scaler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+func TestExplainScaleUp(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 1,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "default",
+				Name:                   "web-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+			},
+		},
+	}, 0)
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explanation := s.Explain().ScaleUp
+	if len(explanation.UnschedulablePods) != 1 || explanation.UnschedulablePods[0].Name != "web-0" {
+		t.Errorf("Expected web-0 to be considered unschedulable, got %+v", explanation.UnschedulablePods)
+	}
+
+	if explanation.UnschedulableCpu != 1 {
+		t.Errorf("Expected 1 unschedulable cpu, got %f", explanation.UnschedulableCpu)
+	}
+
+	if len(explanation.ScaleEvents) != len(scaleEvents) || explanation.ScaleEvents[0].NodeName != scaleEvents[0].NodeName {
+		t.Errorf("Expected each scale event to be explained, got %+v", explanation.ScaleEvents)
+	}
+}
+
+func TestExplainScaleDownRejected(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			AllocatedResources: map[string]kubernetes.AllocatedResources{
+				"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {
+					Cpu:    3.0,
+					Memory: 1073741824.0,
+				},
+			},
+			WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+				Cpu:    4,
+				Memory: 8589934592,
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Fatalf("Expected no scaleEvents, got %d", len(scaleEvents))
+	}
+
+	explanation := s.Explain().ScaleDown
+	if explanation.Acceptable {
+		t.Error("Expected scale down to be unacceptable")
+	}
+
+	if len(explanation.Reasons) != 1 || !strings.Contains(explanation.Reasons[0], "of cpu free") {
+		t.Errorf("Expected cpu headroom to be the reason, got %v", explanation.Reasons)
+	}
+}
+
+func TestExplainScaleUpForPreemptedOverprovisioningPods(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 1,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "kproximate",
+				Name:                   "kproximate-overprovisioning-5d8f9-abcde",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 0.5},
+			},
+			{
+				Namespace:              "default",
+				Name:                   "kproximate-overprovisioning-lookalike",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 0.5},
+			},
+		},
+	}, 0)
+	s.config.PodNamespace = "kproximate"
+
+	_, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reasons := strings.Join(s.Explain().ScaleUp.Reasons, "\n")
+	if !strings.Contains(reasons, "1 overprovisioning pods were preempted") {
+		t.Errorf("Expected the preempted overprovisioning pod to be explained, got %q", reasons)
+	}
+}
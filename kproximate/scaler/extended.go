@@ -0,0 +1,111 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// The extended resources a kpNode of the node class provides
+func nodeClassExtendedResources(nodeClass config.NodeClass) map[string]int64 {
+	extended := map[string]int64{}
+	for name, quantity := range nodeClass.ExtendedResources {
+		if quantity.Value() > 0 {
+			extended[name] = quantity.Value()
+		}
+	}
+
+	return extended
+}
+
+// The node classes which provide the extended resource
+func providingNodeClasses(nodeClasses []config.NodeClass, extended string) []config.NodeClass {
+	providing := []config.NodeClass{}
+	for _, nodeClass := range nodeClasses {
+		if nodeClassExtendedResources(nodeClass)[extended] > 0 {
+			providing = append(providing, nodeClass)
+		}
+	}
+
+	return providing
+}
+
+// The first of the unaccounted extended resources by name, so that scale
+// events are generated in a stable order
+func nextExtendedResource(unaccounted map[string]int64) (string, bool) {
+	if len(unaccounted) == 0 {
+		return "", false
+	}
+
+	names := make([]string, 0, len(unaccounted))
+	for name := range unaccounted {
+		names = append(names, name)
+	}
+
+	return slices.Min(names), true
+}
+
+// Whether the free extended resources satisfy the requested ones
+func fitsExtended(requested map[string]int64, free map[string]int64) bool {
+	for name, quantity := range requested {
+		if quantity > free[name] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the extended resources allocated across kpNodes and those each
+// kpNode provides.
+func (scaler *ProxmoxScaler) kpNodesExtendedResources(ctx context.Context) (map[string]int64, map[string]map[string]int64, error) {
+	allocatedResources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allocated := map[string]int64{}
+	for _, kpNode := range allocatedResources {
+		for name, quantity := range kpNode.Extended {
+			allocated[name] += quantity
+		}
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	provided := map[string]map[string]int64{}
+	for _, kpNode := range kpNodes {
+		provided[kpNode.Name] = kubernetes.NodeExtendedResources(kpNode)
+	}
+
+	return allocated, provided, nil
+}
+
+// Returns an extended resource, if any, of which less would be allocatable
+// than is allocated once the kpNodes are removed. Pods evicted from the
+// removed kpNodes would otherwise be left pending.
+func extendedResourceShortfall(allocated map[string]int64, allocatable map[string]int64, provided map[string]map[string]int64, removed []string) (string, bool) {
+	names := make([]string, 0, len(allocated))
+	for name := range allocated {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		remaining := allocatable[name]
+		for _, kpNode := range removed {
+			remaining -= provided[kpNode][name]
+		}
+
+		if allocated[name] > remaining {
+			return name, true
+		}
+	}
+
+	return "", false
+}
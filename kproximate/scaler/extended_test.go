@@ -0,0 +1,149 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func gpuNodeClasses() config.NodeClasses {
+	return config.NodeClasses{
+		{
+			Name:   "small",
+			Cores:  2,
+			Memory: 2048,
+		},
+		{
+			Name:   "gpu",
+			Cores:  4,
+			Memory: 8192,
+			ExtendedResources: map[string]resource.Quantity{
+				"nvidia.com/gpu": resource.MustParse("1"),
+			},
+		},
+	}
+}
+
+func TestRequiredScaleEventsForExtendedResources(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Extended: map[string]int64{
+					"nvidia.com/gpu": 2,
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: gpuNodeClasses(),
+			MaxKpNodes:    10,
+		},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 2 {
+		t.Fatalf("Expected exactly 2 scaleEvents, got: %d", len(requiredScaleEvents))
+	}
+
+	for _, scaleEvent := range requiredScaleEvents {
+		if scaleEvent.NodeClass != "gpu" {
+			t.Errorf("Expected scaleEvents for the gpu node class, got: %s", scaleEvent.NodeClass)
+		}
+	}
+}
+
+func TestRequiredScaleEventsForUnprovidedExtendedResource(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Extended: map[string]int64{
+					"example.com/fpga": 1,
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: gpuNodeClasses(),
+			MaxKpNodes:    10,
+		},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 {
+		t.Errorf("Expected no scaleEvents as no node class provides the resource, got: %d", len(requiredScaleEvents))
+	}
+
+	if len(s.Explain().ScaleUp.Reasons) == 0 {
+		t.Error("Expected a reason explaining why no kpNode was added")
+	}
+}
+
+func TestAssessScaleDownKeepsExtendedResources(t *testing.T) {
+	gpuNode := apiv1.Node{}
+	gpuNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	gpuNode.Status.Allocatable = apiv1.ResourceList{
+		"nvidia.com/gpu": resource.MustParse("1"),
+	}
+
+	otherNodes := []apiv1.Node{{}, {}}
+	otherNodes[0].Name = "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+	otherNodes[1].Name = "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38"
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{gpuNode, otherNodes[0], otherNodes[1]},
+			AllocatedResources: map[string]kubernetes.AllocatedResources{
+				gpuNode.Name: {
+					Cpu:    0.5,
+					Memory: 536870912.0,
+					Extended: map[string]int64{
+						"nvidia.com/gpu": 1,
+					},
+				},
+				otherNodes[0].Name: {
+					Cpu:    1.0,
+					Memory: 1073741824.0,
+				},
+				otherNodes[1].Name: {
+					Cpu:    1.0,
+					Memory: 1073741824.0,
+				},
+			},
+			WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+				Cpu:    6,
+				Memory: 6442450944,
+				Extended: map[string]int64{
+					"nvidia.com/gpu": 1,
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected the only kpNode with a gpu to be kept, got: %d scaleEvents", len(scaleEvents))
+	}
+
+	if s.Explain().ScaleDown.Acceptable {
+		t.Error("Expected the scale down to be explained as unacceptable")
+	}
+}
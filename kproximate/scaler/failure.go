@@ -0,0 +1,109 @@
+package scaler
+
+import (
+	"errors"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// The categories scale event failures are classified into
+const (
+	FailureProxmoxAuth   = "proxmox-auth"
+	FailureCloneTimeout  = "clone-timeout"
+	FailureStorageFull   = "storage-full"
+	FailureNoNetwork     = "no-network"
+	FailureJoinTimeout   = "join-timeout"
+	FailureKubernetesApi = "k8s-api"
+	FailureUnknown       = "unknown"
+)
+
+var FailureCategories = []string{
+	FailureProxmoxAuth,
+	FailureCloneTimeout,
+	FailureStorageFull,
+	FailureNoNetwork,
+	FailureJoinTimeout,
+	FailureKubernetesApi,
+	FailureUnknown,
+}
+
+// Proxmox errors are only available as messages, these are matched in lower
+// case against the error
+var (
+	proxmoxAuthMessages = []string{
+		"401 ",
+		"403 ",
+		"authentication failure",
+		"permission check failed",
+		"invalid token",
+	}
+	storageFullMessages = []string{
+		"no space left on device",
+		"not enough space",
+		"insufficient space",
+		"out of space",
+		"disk quota exceeded",
+	}
+)
+
+// A scale event error with a known failure category.
+type ScaleEventError struct {
+	Category string
+	Err      error
+}
+
+func (e *ScaleEventError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ScaleEventError) Unwrap() error {
+	return e.Err
+}
+
+func classifiedError(category string, err error) error {
+	return &ScaleEventError{
+		Category: category,
+		Err:      err,
+	}
+}
+
+func containsAny(message string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the failure category of a scale event error. Storage and
+// authentication failures reported by Proxmox take precedence over the stage
+// the scale event failed at, e.g. a clone which timed out because the
+// storage is full is a storage-full failure.
+func ClassifyFailure(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	message := strings.ToLower(err.Error())
+	switch {
+	case containsAny(message, storageFullMessages):
+		return FailureStorageFull
+	case containsAny(message, proxmoxAuthMessages):
+		return FailureProxmoxAuth
+	}
+
+	var scaleEventErr *ScaleEventError
+	if errors.As(err, &scaleEventErr) {
+		return scaleEventErr.Category
+	}
+
+	var apiStatus apierrors.APIStatus
+	if errors.As(err, &apiStatus) {
+		return FailureKubernetesApi
+	}
+
+	return FailureUnknown
+}
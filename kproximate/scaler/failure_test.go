@@ -0,0 +1,85 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyFailure(t *testing.T) {
+	tests := []struct {
+		err      error
+		category string
+	}{
+		{
+			err:      errors.New("401 authentication failure"),
+			category: FailureProxmoxAuth,
+		},
+		{
+			err:      errors.New("403 Permission check failed (/vms/100, VM.Clone)"),
+			category: FailureProxmoxAuth,
+		},
+		{
+			err:      errors.New("clone failed: No space left on device"),
+			category: FailureStorageFull,
+		},
+		{
+			err:      classifiedError(FailureCloneTimeout, errors.New("timed out waiting for kp-node-a to start")),
+			category: FailureCloneTimeout,
+		},
+		{
+			err:      classifiedError(FailureCloneTimeout, errors.New("lvcreate: insufficient space in thin pool")),
+			category: FailureStorageFull,
+		},
+		{
+			err:      fmt.Errorf("failed to label: %w", apierrors.NewServiceUnavailable("etcd is unavailable")),
+			category: FailureKubernetesApi,
+		},
+		{
+			err:      apierrors.NewNotFound(schema.GroupResource{Resource: "nodes"}, "kp-node-a"),
+			category: FailureKubernetesApi,
+		},
+		{
+			err:      errors.New("could not find template: kproximate-template"),
+			category: FailureUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		category := ClassifyFailure(test.err)
+		if category != test.category {
+			t.Errorf("Expected %q to be classified as %s, got %s", test.err, test.category, category)
+		}
+	}
+}
+
+func TestReportFailureClassifiesScaleUpError(t *testing.T) {
+	s := newTestScaler(&provisionerMock{
+		createErr: errors.New("clone failed: no space left on device"),
+	})
+
+	var reported ScaleEventStatus
+	ctx := WithProgressReporter(context.Background(), func(status ScaleEventStatus) {
+		reported = status
+	})
+
+	scaleEvent := &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+	}
+
+	err := s.ScaleUp(ctx, scaleEvent)
+	if err == nil {
+		t.Fatal("Expected scale up to fail")
+	}
+
+	ReportFailure(ctx, scaleEvent, err)
+
+	if reported.State != ScaleEventFailed || reported.Category != FailureStorageFull {
+		t.Errorf("Expected a storage-full failure, got %+v", reported)
+	}
+}
@@ -0,0 +1,256 @@
+package scaler
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// The default maxPods of the kubelet
+const defaultMaxPods = 110
+
+// The number of pods a kpNode of the node class can run
+func nodeClassMaxPods(nodeClass config.NodeClass) int {
+	if nodeClass.MaxPods <= 0 {
+		return defaultMaxPods
+	}
+
+	return nodeClass.MaxPods
+}
+
+// Whether the label is in a namespace reserved for Kubernetes, such as
+// kubernetes.io/os or node.kubernetes.io/instance-type. These are set by the
+// kubelet when a kpNode registers so are assumed to match.
+func isKubernetesLabel(key string) bool {
+	prefix, _, ok := strings.Cut(key, "/")
+	if !ok {
+		return false
+	}
+
+	return prefix == "kubernetes.io" || strings.HasSuffix(prefix, ".kubernetes.io") ||
+		prefix == "k8s.io" || strings.HasSuffix(prefix, ".k8s.io")
+}
+
+// Returns the labels kproximate applies to kpNodes of the node class, and
+// those whose value is not known until a target host is selected.
+func (scaler *ProxmoxScaler) forecastLabels(nodeClass config.NodeClass) (map[string]string, map[string]bool) {
+	labels := scaler.nodeClassLabels(nodeClass)
+	labels[nodeClassLabel] = nodeClass.Name
+
+	if scaler.currentConfig().InstanceID != "" {
+		labels[instanceLabel] = scaler.currentConfig().InstanceID
+	}
+
+	unknown := map[string]bool{}
+	if scaler.currentConfig().KpNodeLabels != "" {
+		renderedLabels, _ := scaler.renderNodeLabels(&ScaleEvent{
+			TargetHost: proxmox.HostInformation{Node: nodeClass.TargetHost},
+		})
+
+		for _, label := range strings.Split(scaler.currentConfig().KpNodeLabels, ",") {
+			key, value, _ := strings.Cut(label, "=")
+			if nodeClass.TargetHost == "" && strings.Contains(value, "{{") {
+				delete(renderedLabels, key)
+				unknown[key] = true
+			}
+		}
+
+		maps.Copy(labels, renderedLabels)
+	}
+
+	return labels, unknown
+}
+
+// Whether a node with the labels would satisfy the node selector requirement
+func requirementMatches(requirement apiv1.NodeSelectorRequirement, labels map[string]string, unknown map[string]bool) bool {
+	value, ok := labels[requirement.Key]
+	if unknown[requirement.Key] || (!ok && isKubernetesLabel(requirement.Key)) {
+		return true
+	}
+
+	switch requirement.Operator {
+	case apiv1.NodeSelectorOpIn:
+		return ok && slices.Contains(requirement.Values, value)
+	case apiv1.NodeSelectorOpNotIn:
+		return !ok || !slices.Contains(requirement.Values, value)
+	case apiv1.NodeSelectorOpExists:
+		return ok
+	case apiv1.NodeSelectorOpDoesNotExist:
+		return !ok
+	case apiv1.NodeSelectorOpGt, apiv1.NodeSelectorOpLt:
+		if !ok || len(requirement.Values) != 1 {
+			return false
+		}
+
+		actual, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return false
+		}
+
+		bound, err := strconv.ParseInt(requirement.Values[0], 10, 64)
+		if err != nil {
+			return false
+		}
+
+		if requirement.Operator == apiv1.NodeSelectorOpGt {
+			return actual > bound
+		}
+
+		return actual < bound
+	}
+
+	return false
+}
+
+// Whether a node with the labels would satisfy the pod's node selector and
+// required node affinity. Any one of the node affinity terms must match.
+func nodeSelectorMatches(pod kubernetes.UnschedulablePod, labels map[string]string, unknown map[string]bool) bool {
+	for key, value := range pod.NodeSelector {
+		requirement := apiv1.NodeSelectorRequirement{
+			Key:      key,
+			Operator: apiv1.NodeSelectorOpIn,
+			Values:   []string{value},
+		}
+
+		if !requirementMatches(requirement, labels, unknown) {
+			return false
+		}
+	}
+
+	if pod.NodeAffinity == nil {
+		return true
+	}
+
+TERMS:
+	for _, term := range pod.NodeAffinity.NodeSelectorTerms {
+		// Terms with neither match nothing, match fields select a node by
+		// name which a new kpNode could satisfy
+		if len(term.MatchExpressions) == 0 && len(term.MatchFields) == 0 {
+			continue
+		}
+
+		for _, requirement := range term.MatchExpressions {
+			if !requirementMatches(requirement, labels, unknown) {
+				continue TERMS
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// Returns why a kpNode of the node class could not schedule the pod, or an
+// empty string if it could.
+func (scaler *ProxmoxScaler) podMisfit(pod kubernetes.UnschedulablePod, nodeClass config.NodeClass) string {
+	rule, routed := scaler.currentConfig().RoutingRules.Route(pod.Namespace, pod.Labels, pod.PriorityClassName)
+	if routed && !slices.Contains(rule.NodeClasses, nodeClass.Name) {
+		return fmt.Sprintf("routed to %s by rule %s", strings.Join(rule.NodeClasses, ", "), rule.Name)
+	}
+
+	if pod.Cpu > scaler.schedulableCpu(nodeClass) {
+		return "insufficient cpu"
+	}
+
+	if pod.Memory > scaler.schedulableMemory(nodeClass) {
+		return "insufficient memory"
+	}
+
+	if !fitsExtended(pod.Extended, nodeClassExtendedResources(nodeClass)) {
+		return "insufficient extended resources"
+	}
+
+	for _, taint := range nodeClass.Taints {
+		if taint.Effect == apiv1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		tolerated := slices.ContainsFunc(pod.Tolerations, func(toleration apiv1.Toleration) bool {
+			return toleration.ToleratesTaint(&taint)
+		})
+		if !tolerated {
+			return fmt.Sprintf("untolerated taint %s", taint.ToString())
+		}
+	}
+
+	labels, unknown := scaler.forecastLabels(nodeClass)
+	if !nodeSelectorMatches(pod, labels, unknown) {
+		return "node selector or affinity does not match"
+	}
+
+	return ""
+}
+
+// A pending pod which no node class could schedule, and why
+type misfitPod struct {
+	kubernetes.UnschedulablePod
+	Reason string
+}
+
+// Splits the pending pods into those a kpNode of at least one of the node
+// classes could schedule and those none could, so that kpNodes are not
+// provisioned which would not unblock them.
+func (scaler *ProxmoxScaler) forecastPods(nodeClasses []config.NodeClass, pendingPods []kubernetes.UnschedulablePod) ([]kubernetes.UnschedulablePod, []misfitPod) {
+	schedulable := []kubernetes.UnschedulablePod{}
+	misfits := []misfitPod{}
+
+PODS:
+	for _, pod := range pendingPods {
+		reasons := []string{}
+		for _, nodeClass := range nodeClasses {
+			misfit := scaler.podMisfit(pod, nodeClass)
+			if misfit == "" {
+				schedulable = append(schedulable, pod)
+				continue PODS
+			}
+
+			reasons = append(reasons, fmt.Sprintf("%s: %s", nodeClass.Name, misfit))
+		}
+
+		misfits = append(misfits, misfitPod{
+			UnschedulablePod: pod,
+			Reason:           strings.Join(reasons, ", "),
+		})
+	}
+
+	return withoutPartialGangs(schedulable, misfits)
+}
+
+// The node classes which could schedule at least one of the pending pods
+func (scaler *ProxmoxScaler) fittingNodeClasses(nodeClasses []config.NodeClass, pendingPods []kubernetes.UnschedulablePod) []config.NodeClass {
+	return slices.DeleteFunc(slices.Clone(nodeClasses), func(nodeClass config.NodeClass) bool {
+		return !slices.ContainsFunc(pendingPods, func(pod kubernetes.UnschedulablePod) bool {
+			return scaler.podMisfit(pod, nodeClass) == ""
+		})
+	})
+}
+
+// Removes the resources of the pods which no node class could schedule from
+// the unschedulable resources.
+func withoutMisfits(requiredResources kubernetes.UnschedulableResources, misfits []misfitPod) kubernetes.UnschedulableResources {
+	requiredResources.Extended = maps.Clone(requiredResources.Extended)
+	for _, pod := range misfits {
+		requiredResources.Cpu = max(requiredResources.Cpu-pod.Cpu, 0)
+		requiredResources.Memory = max(requiredResources.Memory-pod.Memory, 0)
+		for name, quantity := range pod.Extended {
+			if _, ok := requiredResources.Extended[name]; !ok {
+				continue
+			}
+
+			requiredResources.Extended[name] -= quantity
+			if requiredResources.Extended[name] <= 0 {
+				delete(requiredResources.Extended, name)
+			}
+		}
+	}
+
+	return requiredResources
+}
@@ -0,0 +1,200 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func TestRequiredScaleEventsSkipsPodsNoNodeClassCanSchedule(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 1,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "default",
+				Name:                   "gpu-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+				NodeSelector:           map[string]string{"accelerator": "gpu"},
+			},
+		},
+	}, 0)
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 {
+		t.Errorf("Expected no scaleEvents, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+
+	explanation := s.Explain()
+	if len(explanation.ScaleUp.Reasons) == 0 || !strings.Contains(explanation.ScaleUp.Reasons[0], "default/gpu-0 would not fit any node class") {
+		t.Errorf("Expected the pod to be explained, got %v", explanation.ScaleUp.Reasons)
+	}
+}
+
+func TestRequiredScaleEventsAvoidsUntoleratedTaints(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 1,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "default",
+				Name:                   "web-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+			},
+		},
+	}, 0)
+	s.config.KpNodeClasses[1].Taints = []apiv1.Taint{
+		{Key: "dedicated", Value: "batch", Effect: apiv1.TaintEffectNoSchedule},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nodeClasses := nodeClassesOf(requiredScaleEvents)
+	if len(nodeClasses) != 1 || nodeClasses[0] != "small" {
+		t.Errorf("Expected a single small scaleEvent, got %v", nodeClasses)
+	}
+}
+
+func TestRequiredScaleEventsRespectsMaxPods(t *testing.T) {
+	pod := kubernetes.UnschedulablePod{UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 0.1}}
+
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 0.5,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{pod, pod, pod, pod, pod},
+	}, 20)
+	s.config.KpNodeClasses[0].MaxPods = 2
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 3 {
+		t.Errorf("Expected 3 scaleEvents, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
+
+func TestNodeSelectorMatches(t *testing.T) {
+	labels := map[string]string{
+		nodeClassLabel: "large",
+		"disktype":     "ssd",
+	}
+
+	tests := []struct {
+		name     string
+		pod      kubernetes.UnschedulablePod
+		expected bool
+	}{
+		{
+			name:     "no constraints",
+			pod:      kubernetes.UnschedulablePod{},
+			expected: true,
+		},
+		{
+			name:     "matching node selector",
+			pod:      kubernetes.UnschedulablePod{NodeSelector: map[string]string{"disktype": "ssd"}},
+			expected: true,
+		},
+		{
+			name:     "kubelet label",
+			pod:      kubernetes.UnschedulablePod{NodeSelector: map[string]string{"kubernetes.io/os": "linux"}},
+			expected: true,
+		},
+		{
+			name:     "missing label",
+			pod:      kubernetes.UnschedulablePod{NodeSelector: map[string]string{"accelerator": "gpu"}},
+			expected: false,
+		},
+		{
+			name: "second affinity term matches",
+			pod: kubernetes.UnschedulablePod{NodeAffinity: &apiv1.NodeSelector{
+				NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+					{MatchExpressions: []apiv1.NodeSelectorRequirement{{Key: nodeClassLabel, Operator: apiv1.NodeSelectorOpIn, Values: []string{"small"}}}},
+					{MatchExpressions: []apiv1.NodeSelectorRequirement{{Key: "disktype", Operator: apiv1.NodeSelectorOpExists}}},
+				},
+			}},
+			expected: true,
+		},
+		{
+			name: "affinity excludes node class",
+			pod: kubernetes.UnschedulablePod{NodeAffinity: &apiv1.NodeSelector{
+				NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+					{MatchExpressions: []apiv1.NodeSelectorRequirement{{Key: nodeClassLabel, Operator: apiv1.NodeSelectorOpNotIn, Values: []string{"large"}}}},
+				},
+			}},
+			expected: false,
+		},
+	}
+
+	for _, test := range tests {
+		if actual := nodeSelectorMatches(test.pod, labels, nil); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestRequiredScaleEventsRoutesPodsToNodeClasses(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 2,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "team-ml",
+				Name:                   "train-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+			},
+			{
+				Namespace:              "default",
+				Name:                   "web-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+			},
+			{
+				Namespace:              "default",
+				Name:                   "batch-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+				Labels:                 map[string]string{"accelerator": "tpu"},
+			},
+		},
+	}, 0)
+	s.config.RoutingRules = config.RoutingRules{
+		{Name: "ml", Namespaces: []string{"team-ml"}, NodeClasses: []string{"large"}},
+		{Name: "tpu", Selector: "accelerator=tpu", NodeClasses: []string{"tpu"}},
+		{Name: "default", NodeClasses: []string{"small"}},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The large node class has the highest priority, but only the team-ml pod
+	// is routed to it
+	nodeClasses := nodeClassesOf(requiredScaleEvents)
+	if !slices.Equal(nodeClasses, []string{"large", "small"}) {
+		t.Errorf("Expected large and small scaleEvents, got %v", nodeClasses)
+	}
+
+	explanation := s.Explain()
+	if !slices.ContainsFunc(explanation.ScaleUp.Reasons, func(reason string) bool {
+		return strings.Contains(reason, "default/batch-0 would not fit any node class") && strings.Contains(reason, "routed to tpu by rule tpu")
+	}) {
+		t.Errorf("Expected the pod routed to an unknown node class to be explained, got %v", explanation.ScaleUp.Reasons)
+	}
+}
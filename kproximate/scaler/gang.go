@@ -0,0 +1,56 @@
+package scaler
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+func gangKey(pod kubernetes.UnschedulablePod) string {
+	return fmt.Sprintf("%s/%s", pod.Namespace, pod.Gang)
+}
+
+// Moves the schedulable pods of gangs with a misfit to the misfits, as
+// scaling up for part of a gang only lets that part schedule to wait on the
+// rest.
+func withoutPartialGangs(schedulable []kubernetes.UnschedulablePod, misfits []misfitPod) ([]kubernetes.UnschedulablePod, []misfitPod) {
+	partial := map[string]bool{}
+	for _, misfit := range misfits {
+		if misfit.Gang != "" {
+			partial[gangKey(misfit.UnschedulablePod)] = true
+		}
+	}
+
+	if len(partial) == 0 {
+		return schedulable, misfits
+	}
+
+	whole := []kubernetes.UnschedulablePod{}
+	for _, pod := range schedulable {
+		if pod.Gang == "" || !partial[gangKey(pod)] {
+			whole = append(whole, pod)
+			continue
+		}
+
+		misfits = append(misfits, misfitPod{
+			UnschedulablePod: pod,
+			Reason:           fmt.Sprintf("other pods of gang %s would not fit any node class", pod.Gang),
+		})
+	}
+
+	return whole, misfits
+}
+
+// Returns the gangs of the pending pods, each as namespace/gang.
+func pendingGangs(pendingPods []kubernetes.UnschedulablePod) []string {
+	gangs := []string{}
+	for _, pod := range pendingPods {
+		if pod.Gang != "" && !slices.Contains(gangs, gangKey(pod)) {
+			gangs = append(gangs, gangKey(pod))
+		}
+	}
+	slices.Sort(gangs)
+
+	return gangs
+}
@@ -0,0 +1,101 @@
+package scaler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+func TestRequiredScaleEventsSkipsGangsWithAMisfit(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 2,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "batch",
+				Name:                   "train-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+				Gang:                   "job/train",
+			},
+			{
+				Namespace:              "batch",
+				Name:                   "train-1",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 1},
+				NodeSelector:           map[string]string{"accelerator": "gpu"},
+				Gang:                   "job/train",
+			},
+		},
+	}, 0)
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 {
+		t.Errorf("Expected no scaleEvents for part of a gang, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+
+	reasons := strings.Join(s.Explain().ScaleUp.Reasons, "\n")
+	if !strings.Contains(reasons, "batch/train-0 would not fit any node class (other pods of gang job/train would not fit any node class)") {
+		t.Errorf("Expected the rest of the gang to be explained, got %q", reasons)
+	}
+}
+
+func TestRequiredScaleEventsHoldsBackGangsExceedingMaxNodes(t *testing.T) {
+	s := newExpanderScaler(ExpanderPriority, &kubernetes.KubernetesMock{
+		UnschedulableResources: kubernetes.UnschedulableResources{
+			Cpu: 12,
+		},
+		UnschedulablePods: []kubernetes.UnschedulablePod{
+			{
+				Namespace:              "batch",
+				Name:                   "train-0",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 6},
+				Gang:                   "job/train",
+			},
+			{
+				Namespace:              "batch",
+				Name:                   "train-1",
+				UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 6},
+				Gang:                   "job/train",
+			},
+		},
+	}, 0)
+	s.config.KpNodeClasses[0].MaxNodes = 1
+	s.config.KpNodeClasses[1].MaxNodes = 1
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 0 {
+		t.Errorf("Expected the scaleEvents to be held back, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+
+	explanation := s.Explain().ScaleUp
+	if len(explanation.Gangs) != 1 || explanation.Gangs[0] != "batch/job/train" {
+		t.Errorf("Expected the gang to be explained, got %v", explanation.Gangs)
+	}
+
+	if !strings.Contains(strings.Join(explanation.Reasons, "\n"), "Holding back") {
+		t.Errorf("Expected the held back scaleEvents to be explained, got %v", explanation.Reasons)
+	}
+
+	// Without the limits the whole gang is scaled up for
+	s.config.KpNodeClasses[0].MaxNodes = 0
+	s.config.KpNodeClasses[1].MaxNodes = 0
+
+	requiredScaleEvents, err = s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 2 {
+		t.Errorf("Expected 2 scaleEvents, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
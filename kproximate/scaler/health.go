@@ -0,0 +1,37 @@
+package scaler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Returns why the Proxmox cluster is unfit to scale, or an empty string if it
+// is healthy. Clones and deletions on a cluster which has lost quorum hang
+// until they time out, as do those targeting a host which is offline.
+func (scaler *ProxmoxScaler) AssessProxmoxHealth() (string, error) {
+	if scaler.currentConfig().DisableProxmoxHealthCheck {
+		return "", nil
+	}
+
+	status, err := scaler.Proxmox.GetClusterStatus()
+	if err != nil {
+		return "", err
+	}
+
+	if !status.Quorate {
+		return "The Proxmox cluster has lost quorum", nil
+	}
+
+	var offline []string
+	for _, host := range status.Hosts {
+		if !host.Online {
+			offline = append(offline, host.Name)
+		}
+	}
+
+	if len(offline) > 0 {
+		return fmt.Sprintf("Proxmox hosts are offline: %s", strings.Join(offline, ", ")), nil
+	}
+
+	return "", nil
+}
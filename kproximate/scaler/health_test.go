@@ -0,0 +1,45 @@
+package scaler
+
+import (
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestAssessProxmoxHealth(t *testing.T) {
+	proxmoxMock := &proxmox.ProxmoxMock{
+		ClusterStats: []proxmox.HostInformation{
+			{Node: "pve-01", Status: "online"},
+			{Node: "pve-02", Status: "online"},
+		},
+	}
+	s := ProxmoxScaler{Proxmox: proxmoxMock}
+
+	degraded, err := s.AssessProxmoxHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if degraded != "" {
+		t.Errorf("Expected the cluster to be healthy, got %s", degraded)
+	}
+
+	proxmoxMock.ClusterStats[1].Status = "offline"
+	degraded, _ = s.AssessProxmoxHealth()
+	if degraded != "Proxmox hosts are offline: pve-02" {
+		t.Errorf("Expected pve-02 to be reported offline, got %s", degraded)
+	}
+
+	proxmoxMock.QuorumLost = true
+	degraded, _ = s.AssessProxmoxHealth()
+	if degraded != "The Proxmox cluster has lost quorum" {
+		t.Errorf("Expected the loss of quorum to be reported, got %s", degraded)
+	}
+
+	s.config = config.KproximateConfig{DisableProxmoxHealthCheck: true}
+	degraded, _ = s.AssessProxmoxHealth()
+	if degraded != "" {
+		t.Errorf("Expected the health check to be disabled, got %s", degraded)
+	}
+}
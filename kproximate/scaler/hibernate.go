@@ -0,0 +1,251 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// Implemented by provisioners able to shut down machines on scale down and
+// resume them on a later scale up, rather than destroying them.
+type Hibernator interface {
+	Hibernate(ctx context.Context, nodeName string) error
+	// Starts the hibernated machine named by the scale event, returning
+	// false if there is none.
+	Resume(ctx context.Context, scaleEvent *ScaleEvent) (bool, error)
+	HibernatedNodes() ([]HibernatedNode, error)
+	DestroyHibernated(ctx context.Context, name string) error
+}
+
+type HibernatedNode struct {
+	Name       string
+	NodeClass  string
+	Host       string
+	Hibernated time.Time
+}
+
+func (scaler *ProxmoxScaler) hibernator() (Hibernator, bool) {
+	hibernator, ok := scaler.Provisioner.(Hibernator)
+	return hibernator, ok && scaler.currentConfig().HibernateKpNodes > 0
+}
+
+// Hibernates a kpNode which has been removed from the cluster, returning
+// false if it should be destroyed instead.
+func (scaler *ProxmoxScaler) hibernate(ctx context.Context, nodeName string) bool {
+	hibernator, ok := scaler.hibernator()
+	if !ok {
+		return false
+	}
+
+	err := hibernator.Hibernate(ctx, nodeName)
+	if err != nil {
+		logger.WarnLog("Failed to hibernate kpNode, deleting instead", "node", nodeName, "error", err)
+		return false
+	}
+
+	logger.InfoLog(fmt.Sprintf("Hibernated %s", nodeName))
+	return true
+}
+
+// Renames scale up events after hibernated kpNodes of their node class so
+// that they are resumed rather than cloned. A kpNode is not assigned again
+// until its scale event has had time to complete.
+func (scaler *ProxmoxScaler) assignHibernatedKpNodes(scaleEvents []*ScaleEvent) {
+	hibernator, ok := scaler.hibernator()
+	if !ok || len(scaleEvents) == 0 {
+		return
+	}
+
+	hibernatedNodes, err := hibernator.HibernatedNodes()
+	if err != nil {
+		logger.WarnLog("Failed to get hibernated kpNodes", "error", err)
+		return
+	}
+
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	if scaler.resumeClaims == nil {
+		scaler.resumeClaims = map[string]time.Time{}
+	}
+
+	now := scaler.now()
+	claimWindow := time.Second * time.Duration(scaler.currentConfig().StuckScaleEventSeconds)
+	for name, claimed := range scaler.resumeClaims {
+		if now.Sub(claimed) > claimWindow {
+			delete(scaler.resumeClaims, name)
+		}
+	}
+
+	// Resume the most recently hibernated first, the oldest are the first
+	// to be collected
+	slices.SortFunc(hibernatedNodes, func(a, b HibernatedNode) int {
+		return b.Hibernated.Compare(a.Hibernated)
+	})
+
+	scaleUp := scaler.explanation.ScaleUp
+	scaleUp.ScaleEvents = slices.Clone(scaleUp.ScaleEvents)
+	defer func() {
+		scaler.explanation.ScaleUp = scaleUp
+	}()
+
+	for _, scaleEvent := range scaleEvents {
+		idx := slices.IndexFunc(hibernatedNodes, func(hibernatedNode HibernatedNode) bool {
+			_, claimed := scaler.resumeClaims[hibernatedNode.Name]
+			return !claimed && hibernatedNode.NodeClass == scaleEvent.NodeClass
+		})
+		if idx == -1 {
+			continue
+		}
+
+		hibernatedNode := hibernatedNodes[idx]
+		scaler.resumeClaims[hibernatedNode.Name] = now
+
+		for i := range scaleUp.ScaleEvents {
+			explanation := &scaleUp.ScaleEvents[i]
+			if explanation.NodeName == scaleEvent.NodeName {
+				explanation.NodeName = hibernatedNode.Name
+				explanation.Reason += ", resuming a hibernated kpNode"
+			}
+		}
+
+		scaleEvent.NodeName = hibernatedNode.Name
+	}
+}
+
+// Resumes the hibernated kpNode named by the scale event, if there is one.
+func (scaler *ProxmoxScaler) resume(ctx context.Context, scaleEvent *ScaleEvent) bool {
+	hibernator, ok := scaler.hibernator()
+	if !ok {
+		return false
+	}
+
+	resumed, err := hibernator.Resume(ctx, scaleEvent)
+	if err != nil {
+		logger.WarnLog("Failed to resume hibernated kpNode", "node", scaleEvent.NodeName, "error", err)
+		return false
+	}
+
+	if resumed {
+		logger.InfoLog(fmt.Sprintf("Resumed hibernated %s on %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+	}
+
+	return resumed
+}
+
+// Deletes the hibernated kpNodes older than hibernateMaxAgeSeconds and the
+// oldest of those beyond hibernateKpNodes, returning the deleted kpNodes.
+func (scaler *ProxmoxScaler) CollectHibernatedKpNodes(ctx context.Context) ([]string, error) {
+	hibernator, ok := scaler.Provisioner.(Hibernator)
+	if !ok {
+		return nil, nil
+	}
+
+	hibernatedNodes, err := hibernator.HibernatedNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(hibernatedNodes, func(a, b HibernatedNode) int {
+		return b.Hibernated.Compare(a.Hibernated)
+	})
+
+	now := scaler.now()
+	maxAge := time.Second * time.Duration(scaler.currentConfig().HibernateMaxAgeSeconds)
+	deleted := []string{}
+	for idx, hibernatedNode := range hibernatedNodes {
+		if idx < scaler.currentConfig().HibernateKpNodes && now.Sub(hibernatedNode.Hibernated) < maxAge {
+			continue
+		}
+
+		if scaler.resumeClaimed(hibernatedNode.Name) {
+			continue
+		}
+
+		err = hibernator.DestroyHibernated(ctx, hibernatedNode.Name)
+		if err != nil {
+			return deleted, err
+		}
+
+		deleted = append(deleted, hibernatedNode.Name)
+	}
+
+	return deleted, nil
+}
+
+func (p *ProxmoxProvisioner) Hibernate(ctx context.Context, nodeName string) error {
+	return p.Proxmox.HibernateKpNode(nodeName, p.config.KpNodeNameRegex)
+}
+
+func (p *ProxmoxProvisioner) HibernatedNodes() ([]HibernatedNode, error) {
+	kpNodes, err := p.Proxmox.GetHibernatedKpNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	hibernatedNodes := []HibernatedNode{}
+	for _, kpNode := range kpNodes {
+		hibernatedNodes = append(hibernatedNodes, HibernatedNode{
+			Name:       kpNode.Name,
+			NodeClass:  p.config.NodeClass(kpNode.Metadata.NodeClass).Name,
+			Host:       kpNode.Node,
+			Hibernated: kpNode.Metadata.Hibernated,
+		})
+	}
+
+	return hibernatedNodes, nil
+}
+
+// Clears the hibernated tag and description of the kpNode and starts it,
+// it rejoins the cluster under its original name.
+func (p *ProxmoxProvisioner) Resume(ctx context.Context, scaleEvent *ScaleEvent) (bool, error) {
+	kpNodes, err := p.Proxmox.GetHibernatedKpNodes()
+	if err != nil {
+		return false, err
+	}
+
+	idx := slices.IndexFunc(kpNodes, func(kpNode proxmox.HibernatedKpNode) bool {
+		return kpNode.Name == scaleEvent.NodeName
+	})
+	if idx == -1 {
+		return false, nil
+	}
+
+	metadata := kpNodes[idx].Metadata
+	metadata.Hibernated = time.Time{}
+	metadata.ExtraTags = p.config.KpNodeParams.Tags
+
+	err = p.Proxmox.StartKpNode(scaleEvent.NodeName, map[string]interface{}{
+		"description": metadata.Description(),
+		"tags":        metadata.Tags(),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	scaleEvent.TargetHost = proxmox.HostInformation{Node: kpNodes[idx].Node}
+	return true, nil
+}
+
+func (p *ProxmoxProvisioner) DestroyHibernated(ctx context.Context, name string) error {
+	err := p.Proxmox.DeleteHibernatedKpNode(name)
+	if err != nil {
+		return err
+	}
+
+	p.deleteSnippets(name)
+	return nil
+}
+
+// Whether the hibernated kpNode has been assigned to a scale event.
+func (scaler *ProxmoxScaler) resumeClaimed(name string) bool {
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	_, claimed := scaler.resumeClaims[name]
+	return claimed
+}
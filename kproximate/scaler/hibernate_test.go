@@ -0,0 +1,224 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type hibernatorMock struct {
+	provisionerMock
+	hibernatedNodes []HibernatedNode
+	hibernated      []string
+	resumed         []string
+}
+
+func (p *hibernatorMock) Hibernate(ctx context.Context, nodeName string) error {
+	p.hibernated = append(p.hibernated, nodeName)
+	return nil
+}
+
+func (p *hibernatorMock) Resume(ctx context.Context, scaleEvent *ScaleEvent) (bool, error) {
+	idx := slices.IndexFunc(p.hibernatedNodes, func(hibernatedNode HibernatedNode) bool {
+		return hibernatedNode.Name == scaleEvent.NodeName
+	})
+	if idx == -1 {
+		return false, nil
+	}
+
+	p.resumed = append(p.resumed, scaleEvent.NodeName)
+	p.hibernatedNodes = slices.Delete(p.hibernatedNodes, idx, idx+1)
+	return true, nil
+}
+
+func (p *hibernatorMock) HibernatedNodes() ([]HibernatedNode, error) {
+	return slices.Clone(p.hibernatedNodes), nil
+}
+
+func (p *hibernatorMock) DestroyHibernated(ctx context.Context, name string) error {
+	p.destroyed = append(p.destroyed, name)
+	return nil
+}
+
+func TestScaleDownHibernatesKpNode(t *testing.T) {
+	provisioner := &hibernatorMock{}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 2
+
+	err := s.ScaleDown(context.Background(), &ScaleEvent{ScaleType: ScaleTypeDown, NodeName: "kp-node-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.hibernated) != 1 || provisioner.hibernated[0] != "kp-node-a" {
+		t.Errorf("Expected kp-node-a to be hibernated, got %v", provisioner.hibernated)
+	}
+
+	if len(provisioner.destroyed) != 0 {
+		t.Errorf("Expected no kpNodes to be destroyed, got %v", provisioner.destroyed)
+	}
+}
+
+func TestScaleDownDestroysKpNodeWithoutHibernation(t *testing.T) {
+	provisioner := &hibernatorMock{}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 0
+
+	err := s.ScaleDown(context.Background(), &ScaleEvent{ScaleType: ScaleTypeDown, NodeName: "kp-node-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.hibernated) != 0 || len(provisioner.destroyed) != 1 {
+		t.Errorf("Expected kp-node-a to be destroyed, got hibernated %v and destroyed %v", provisioner.hibernated, provisioner.destroyed)
+	}
+}
+
+func TestAssignHibernatedKpNodes(t *testing.T) {
+	provisioner := &hibernatorMock{
+		hibernatedNodes: []HibernatedNode{
+			{Name: "kp-node-old", NodeClass: "default", Hibernated: time.Now().Add(-time.Hour)},
+			{Name: "kp-node-new", NodeClass: "default", Hibernated: time.Now().Add(-time.Minute)},
+			{Name: "kp-node-large", NodeClass: "large", Hibernated: time.Now()},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 3
+	s.config.HibernateMaxAgeSeconds = 3600
+	s.config.StuckScaleEventSeconds = 600
+
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-a", NodeClass: "default"},
+	}
+	s.assignHibernatedKpNodes(scaleEvents)
+
+	if scaleEvents[0].NodeName != "kp-node-new" {
+		t.Errorf("Expected the most recently hibernated kpNode to be assigned, got %s", scaleEvents[0].NodeName)
+	}
+
+	// kp-node-new is claimed until its scale event completes
+	scaleEvents = []*ScaleEvent{
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-b", NodeClass: "default"},
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-c", NodeClass: "default"},
+	}
+	s.assignHibernatedKpNodes(scaleEvents)
+
+	if scaleEvents[0].NodeName != "kp-node-old" || scaleEvents[1].NodeName != "kp-node-c" {
+		t.Errorf("Expected kp-node-old and kp-node-c, got %s and %s", scaleEvents[0].NodeName, scaleEvents[1].NodeName)
+	}
+}
+
+func TestHibernatedKpNodeClaimsExpire(t *testing.T) {
+	clock := newFakeClock()
+	provisioner := &hibernatorMock{
+		hibernatedNodes: []HibernatedNode{
+			{Name: "kp-node-old", NodeClass: "default", Hibernated: clock.Now().Add(-time.Hour)},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 1
+	s.config.HibernateMaxAgeSeconds = 3600
+	s.config.StuckScaleEventSeconds = 600
+	s.clock = clock
+
+	scaleEvents := []*ScaleEvent{{ScaleType: ScaleTypeUp, NodeName: "kp-node-a", NodeClass: "default"}}
+	s.assignHibernatedKpNodes(scaleEvents)
+
+	// The claim outlives the hibernated kpNode's max age
+	clock.Advance(time.Second * 590)
+	deleted, err := s.CollectHibernatedKpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 0 {
+		t.Errorf("Expected the claimed kpNode not to be deleted, got %v", deleted)
+	}
+
+	scaleEvents = []*ScaleEvent{{ScaleType: ScaleTypeUp, NodeName: "kp-node-b", NodeClass: "default"}}
+	s.assignHibernatedKpNodes(scaleEvents)
+	if scaleEvents[0].NodeName != "kp-node-b" {
+		t.Errorf("Expected kp-node-old to still be claimed, got %s", scaleEvents[0].NodeName)
+	}
+
+	clock.Advance(time.Second * 20)
+	s.assignHibernatedKpNodes(scaleEvents)
+	if scaleEvents[0].NodeName != "kp-node-old" {
+		t.Errorf("Expected kp-node-old to be assigned once its claim expired, got %s", scaleEvents[0].NodeName)
+	}
+}
+
+func TestHibernatedKpNodeClaimsAreSafeForConcurrentUse(t *testing.T) {
+	provisioner := &hibernatorMock{
+		hibernatedNodes: []HibernatedNode{
+			{Name: "kp-node-old", NodeClass: "default", Hibernated: time.Now()},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 1
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			s.assignHibernatedKpNodes([]*ScaleEvent{{ScaleType: ScaleTypeUp, NodeName: "kp-node-a", NodeClass: "default"}})
+			s.Explain()
+			s.resumeClaimed("kp-node-old")
+		}()
+	}
+	wg.Wait()
+
+	if !s.resumeClaimed("kp-node-old") {
+		t.Error("Expected kp-node-old to be claimed")
+	}
+}
+
+func TestScaleUpResumesHibernatedKpNode(t *testing.T) {
+	provisioner := &hibernatorMock{
+		hibernatedNodes: []HibernatedNode{
+			{Name: "kp-node-a", NodeClass: "default", Host: "pve-01", Hibernated: time.Now()},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 1
+
+	err := s.ScaleUp(context.Background(), &ScaleEvent{ScaleType: ScaleTypeUp, NodeName: "kp-node-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.resumed) != 1 {
+		t.Errorf("Expected kp-node-a to be resumed, got %v", provisioner.resumed)
+	}
+
+	if len(provisioner.created) != 0 {
+		t.Errorf("Expected no kpNodes to be cloned, got %v", provisioner.created)
+	}
+}
+
+func TestCollectHibernatedKpNodes(t *testing.T) {
+	provisioner := &hibernatorMock{
+		hibernatedNodes: []HibernatedNode{
+			{Name: "kp-node-expired", Hibernated: time.Now().Add(-2 * time.Hour)},
+			{Name: "kp-node-a", Hibernated: time.Now().Add(-time.Minute)},
+			{Name: "kp-node-b", Hibernated: time.Now().Add(-2 * time.Minute)},
+			{Name: "kp-node-c", Hibernated: time.Now().Add(-3 * time.Minute)},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.HibernateKpNodes = 2
+	s.config.HibernateMaxAgeSeconds = 3600
+
+	deleted, err := s.CollectHibernatedKpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(deleted, []string{"kp-node-c", "kp-node-expired"}) {
+		t.Errorf("Expected kp-node-c and kp-node-expired to be deleted, got %v", deleted)
+	}
+}
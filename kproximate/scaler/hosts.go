@@ -0,0 +1,97 @@
+package scaler
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// The weight of a pHost from hostWeights, 1 unless set
+func (scaler *ProxmoxScaler) hostWeight(host string) int {
+	weight, ok := scaler.currentConfig().HostWeights[host]
+	if !ok {
+		return 1
+	}
+
+	return weight
+}
+
+// The position of a pHost in hostPreference, pHosts not listed follow those
+// which are.
+func (scaler *ProxmoxScaler) hostRank(host string) int {
+	rank := slices.Index(scaler.currentConfig().HostPreference, host)
+	if rank == -1 {
+		return len(scaler.currentConfig().HostPreference)
+	}
+
+	return rank
+}
+
+// Orders the pHosts by preference, their weight then their position in
+// hostPreference. pHosts with a weight of 0 are left out unless only they have
+// capacity for a kpNode of the node class, when just the pHosts with capacity
+// are returned.
+func (scaler *ProxmoxScaler) preferredHosts(hosts []proxmox.HostInformation, nodeClass config.NodeClass, allocations map[string]hostAllocation) []proxmox.HostInformation {
+	canFit := func(host proxmox.HostInformation) bool {
+		return hostCanFit(host, nodeClass, allocations)
+	}
+
+	preferred := slices.DeleteFunc(slices.Clone(hosts), func(host proxmox.HostInformation) bool {
+		return scaler.hostWeight(host.Node) <= 0
+	})
+
+	if len(preferred) == 0 {
+		preferred = slices.Clone(hosts)
+	} else if !slices.ContainsFunc(preferred, canFit) && slices.ContainsFunc(hosts, canFit) {
+		preferred = slices.DeleteFunc(slices.Clone(hosts), func(host proxmox.HostInformation) bool {
+			return !canFit(host)
+		})
+	}
+
+	slices.SortStableFunc(preferred, func(a, b proxmox.HostInformation) int {
+		return cmp.Or(
+			cmp.Compare(scaler.hostWeight(b.Node), scaler.hostWeight(a.Node)),
+			cmp.Compare(scaler.hostRank(a.Node), scaler.hostRank(b.Node)),
+		)
+	})
+
+	return preferred
+}
+
+// The limit on kpNodes. With maxKpNodesAuto it follows the free capacity of
+// the Proxmox cluster as other VMs come and go, the kpNodes there already are
+// plus as many more of the largest node class as fit on the hosts while
+// keeping maxKpNodesHeadroom of each host's memory free. A maxKpNodes above 0
+// still caps it.
+func (scaler *ProxmoxScaler) MaxKpNodes() (int, error) {
+	if !scaler.currentConfig().MaxKpNodesAuto {
+		return scaler.currentConfig().MaxKpNodes, nil
+	}
+
+	hosts, err := scaler.Proxmox.GetClusterStats()
+	if err != nil {
+		return 0, err
+	}
+
+	numKpNodes, err := scaler.NumNodes()
+	if err != nil {
+		return 0, err
+	}
+
+	nodeClass := slices.MaxFunc(scaler.currentConfig().NodeClasses(), func(a config.NodeClass, b config.NodeClass) int {
+		return cmp.Compare(a.Memory, b.Memory)
+	})
+
+	maxKpNodes := numKpNodes
+	for _, host := range scaler.excludeDrainingHosts(hosts) {
+		maxKpNodes += KpNodesFitting(host, nodeClass, scaler.currentConfig().MaxKpNodesHeadroom)
+	}
+
+	if scaler.currentConfig().MaxKpNodes > 0 {
+		return min(maxKpNodes, scaler.currentConfig().MaxKpNodes), nil
+	}
+
+	return maxKpNodes, nil
+}
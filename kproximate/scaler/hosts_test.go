@@ -0,0 +1,183 @@
+package scaler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func weightedHosts(nasMem int64) []proxmox.HostInformation {
+	return []proxmox.HostInformation{
+		{Node: "nas", Maxcpu: 8, Maxmem: 34359738368, Mem: nasMem, Status: "online"},
+		{Node: "host-01", Maxcpu: 8, Maxmem: 34359738368, Mem: 8589934592, Status: "online"},
+		{Node: "host-02", Maxcpu: 8, Maxmem: 34359738368, Mem: 8589934592, Status: "online"},
+		{Node: "host-03", Maxcpu: 8, Maxmem: 34359738368, Mem: 8589934592, Status: "online"},
+	}
+}
+
+func TestSelectTargetHostsPrefersWeightedHosts(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: weightedHosts(0),
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:    2,
+			KpNodeMemory:   2048,
+			HostPreference: []string{"host-03", "host-01"},
+			HostWeights: map[string]int{
+				"nas": 0,
+			},
+		},
+	}
+
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-a"},
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-b"},
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-c"},
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-d"},
+	}
+
+	err := s.SelectTargetHosts(scaleEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"host-03", "host-01", "host-02"}
+	for idx, host := range expected {
+		if scaleEvents[idx].TargetHost.Node != host {
+			t.Errorf("Expected scale event %d to target %s, got %s", idx, host, scaleEvents[idx].TargetHost.Node)
+		}
+	}
+
+	if scaleEvents[3].TargetHost.Node == "nas" {
+		t.Error("Expected the host with a weight of 0 to be avoided while others have capacity")
+	}
+}
+
+func TestSelectTargetHostsUsesAvoidedHostWhenOthersAreFull(t *testing.T) {
+	hosts := weightedHosts(0)
+	for idx := range hosts[1:] {
+		hosts[idx+1].Mem = hosts[idx+1].Maxmem
+	}
+
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: hosts,
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+			HostWeights: map[string]int{
+				"nas": 0,
+			},
+		},
+	}
+
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: ScaleTypeUp, NodeName: "kp-node-a"},
+	}
+
+	err := s.SelectTargetHosts(scaleEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvents[0].TargetHost.Node != "nas" {
+		t.Errorf("Expected the avoided host to be used as the only one with capacity, got %s", scaleEvents[0].TargetHost.Node)
+	}
+}
+
+func TestMaxKpNodesAutoFollowsFreeCapacity(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				// 32GiB with 8GiB used and 3.2GiB of headroom leaves room for 5
+				{Node: "host-01", Maxcpu: 8, Maxmem: 34359738368, Mem: 8589934592, Status: "online"},
+				// Nearly full
+				{Node: "host-02", Maxcpu: 8, Maxmem: 34359738368, Mem: 32212254720, Status: "online"},
+				{Node: "host-03", Maxcpu: 8, Maxmem: 34359738368, Mem: 0, Status: "offline"},
+			},
+			KpNodes: []proxmox.VmInformation{{Name: "kp-node-1"}, {Name: "kp-node-2"}},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:        2,
+			KpNodeMemory:       4096,
+			MaxKpNodesAuto:     true,
+			MaxKpNodesHeadroom: 0.1,
+		},
+	}
+
+	maxKpNodes, err := s.MaxKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxKpNodes != 7 {
+		t.Errorf("Expected maxKpNodes to be 7, got %d", maxKpNodes)
+	}
+
+	s.config.MaxKpNodes = 4
+	maxKpNodes, err = s.MaxKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxKpNodes != 4 {
+		t.Errorf("Expected maxKpNodes to be capped at 4, got %d", maxKpNodes)
+	}
+
+	s.config.MaxKpNodesAuto = false
+	s.config.MaxKpNodes = 3
+	maxKpNodes, err = s.MaxKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxKpNodes != 3 {
+		t.Errorf("Expected the static maxKpNodes of 3, got %d", maxKpNodes)
+	}
+}
+
+// Run with -race to check that the config can be read while it is reloaded.
+func TestReloadConfigWhileReadingMaxKpNodes(t *testing.T) {
+	s := &ProxmoxScaler{
+		config: config.KproximateConfig{
+			MaxKpNodes: 3,
+		},
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := s.MaxKpNodes()
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	for maxKpNodes := 4; maxKpNodes <= 100; maxKpNodes++ {
+		s.ReloadConfig(config.KproximateConfig{MaxKpNodes: maxKpNodes})
+	}
+	wg.Wait()
+
+	maxKpNodes, err := s.MaxKpNodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if maxKpNodes != 100 {
+		t.Errorf("Expected the reloaded maxKpNodes of 100, got %d", maxKpNodes)
+	}
+
+	if s.config.MaxKpNodes != 3 {
+		t.Errorf("Expected the initial config to be left unmodified, got maxKpNodes %d", s.config.MaxKpNodes)
+	}
+}
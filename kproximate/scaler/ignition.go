@@ -0,0 +1,201 @@
+package scaler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const ignitionVersion = "3.3.0"
+
+// The subset of the Ignition config spec generated for kpNodes
+type ignitionConfig struct {
+	Ignition ignitionSection `json:"ignition"`
+	Passwd   *ignitionPasswd `json:"passwd,omitempty"`
+	Storage  ignitionStorage `json:"storage"`
+	Systemd  ignitionSystemd `json:"systemd"`
+}
+
+type ignitionSection struct {
+	Version string                `json:"version"`
+	Config  *ignitionConfigMerges `json:"config,omitempty"`
+}
+
+type ignitionConfigMerges struct {
+	Merge []ignitionResource `json:"merge"`
+}
+
+type ignitionResource struct {
+	Source string `json:"source"`
+}
+
+type ignitionPasswd struct {
+	Users []ignitionUser `json:"users"`
+}
+
+type ignitionUser struct {
+	Name              string   `json:"name"`
+	SshAuthorizedKeys []string `json:"sshAuthorizedKeys"`
+}
+
+type ignitionStorage struct {
+	Files       []ignitionFile       `json:"files"`
+	Filesystems []ignitionFilesystem `json:"filesystems,omitempty"`
+}
+
+type ignitionFile struct {
+	Path      string           `json:"path"`
+	Mode      int              `json:"mode"`
+	Overwrite bool             `json:"overwrite"`
+	Contents  ignitionResource `json:"contents"`
+}
+
+type ignitionFilesystem struct {
+	Device         string `json:"device"`
+	Format         string `json:"format"`
+	Path           string `json:"path"`
+	WipeFilesystem bool   `json:"wipeFilesystem"`
+}
+
+type ignitionSystemd struct {
+	Units []ignitionUnit `json:"units"`
+}
+
+type ignitionUnit struct {
+	Name     string `json:"name"`
+	Enabled  bool   `json:"enabled"`
+	Contents string `json:"contents"`
+}
+
+// Joins the kpNode once on first boot, the kubelet config exists afterwards
+const ignitionJoinUnit = `[Unit]
+Description=Join the kubernetes cluster
+Wants=network-online.target
+After=network-online.target
+ConditionPathExists=!/etc/kubernetes/kubelet.conf
+
+[Service]
+Type=oneshot
+RemainAfterExit=yes
+ExecStart=/bin/bash -c %s
+
+[Install]
+WantedBy=multi-user.target
+`
+
+const ignitionMountUnit = `[Unit]
+Before=local-fs.target
+
+[Mount]
+What=%s
+Where=%s
+Type=%s
+Options=defaults,nofail
+
+[Install]
+RequiredBy=local-fs.target
+`
+
+// The name systemd requires for the mount unit of a path, as given by
+// "systemd-escape --path --suffix=mount"
+func mountUnitName(path string) string {
+	var escaped strings.Builder
+	for idx, char := range strings.Trim(path, "/") {
+		switch {
+		case char == '/':
+			escaped.WriteRune('-')
+		case char == '.' && idx == 0,
+			!(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_' || char == '.' || char == ':'):
+			fmt.Fprintf(&escaped, `\x%02x`, char)
+		default:
+			escaped.WriteRune(char)
+		}
+	}
+
+	return escaped.String() + ".mount"
+}
+
+// Quotes a command for use as a single argument in a systemd unit
+func systemdQuote(command string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+	return `"` + replacer.Replace(command) + `"`
+}
+
+// Renders the Ignition config passed as user-data to kpNodes of node classes
+// using the ignition user-data format, for templates such as Flatcar which
+// have no cloud-init. It sets the hostname, authorizes the ssh key for the
+// core user, formats and mounts data disks and runs the join command on first
+// boot. A user supplied Ignition config is merged into it.
+func renderIgnitionConfig(values snippetValues, sshKey string, joinCommand string, userConfig []byte) ([]byte, error) {
+	config := ignitionConfig{
+		Ignition: ignitionSection{
+			Version: ignitionVersion,
+		},
+		Storage: ignitionStorage{
+			Files: []ignitionFile{
+				{
+					Path:      "/etc/hostname",
+					Mode:      0644,
+					Overwrite: true,
+					Contents: ignitionResource{
+						Source: "data:," + url.PathEscape(values.NodeName),
+					},
+				},
+			},
+		},
+		Systemd: ignitionSystemd{
+			Units: []ignitionUnit{},
+		},
+	}
+
+	if len(bytes.TrimSpace(userConfig)) > 0 {
+		if !json.Valid(userConfig) {
+			return nil, fmt.Errorf("kpNodeIgnitionConfig is not valid JSON")
+		}
+
+		config.Ignition.Config = &ignitionConfigMerges{
+			Merge: []ignitionResource{
+				{Source: "data:;base64," + base64.StdEncoding.EncodeToString(userConfig)},
+			},
+		}
+	}
+
+	if sshKey != "" {
+		config.Passwd = &ignitionPasswd{
+			Users: []ignitionUser{
+				{Name: "core", SshAuthorizedKeys: []string{strings.TrimSpace(sshKey)}},
+			},
+		}
+	}
+
+	for _, dataDisk := range values.DataDisks {
+		if dataDisk.MountPath == "" {
+			continue
+		}
+
+		config.Storage.Filesystems = append(config.Storage.Filesystems, ignitionFilesystem{
+			Device: dataDisk.Device,
+			Format: dataDisk.Filesystem,
+			Path:   dataDisk.MountPath,
+		})
+
+		config.Systemd.Units = append(config.Systemd.Units, ignitionUnit{
+			Name:     mountUnitName(dataDisk.MountPath),
+			Enabled:  true,
+			Contents: fmt.Sprintf(ignitionMountUnit, dataDisk.Device, dataDisk.MountPath, dataDisk.Filesystem),
+		})
+	}
+
+	if joinCommand != "" {
+		config.Systemd.Units = append(config.Systemd.Units, ignitionUnit{
+			Name:     "kproximate-join.service",
+			Enabled:  true,
+			Contents: fmt.Sprintf(ignitionJoinUnit, systemdQuote(joinCommand)),
+		})
+	}
+
+	return json.Marshal(config)
+}
@@ -0,0 +1,114 @@
+package scaler
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestMountUnitName(t *testing.T) {
+	tests := map[string]string{
+		"/var/lib/longhorn": "var-lib-longhorn.mount",
+		"/mnt/data-1":       `mnt-data\x2d1.mount`,
+	}
+
+	for path, expected := range tests {
+		name := mountUnitName(path)
+		if name != expected {
+			t.Errorf("Expected %s for %s, got %s", expected, path, name)
+		}
+	}
+}
+
+func TestWriteSnippetsIgnition(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{SnippetDir: snippetDir},
+		config: &config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:           "flatcar",
+					UserDataFormat: "ignition",
+					DataDisks: []config.DataDisk{
+						{Size: 100, Bus: "scsi", MountPath: "/var/lib/longhorn", Filesystem: "ext4"},
+					},
+				},
+			},
+			KpJoinCommand:         "kubeadm join --node-name {{ .NodeName }}",
+			KpJoinCommandTemplate: true,
+			KpNodeIgnitionConfig:  `{"ignition": {"version": "3.3.0"}}`,
+			KpNodeSnippetDir:      snippetDir,
+			KpNodeSnippetStorage:  "cephfs",
+			KpNodeVendorData:      "#cloud-config",
+			SshKey:                "ssh-ed25519 AAAA test",
+		},
+	}
+
+	cicustom, err := s.writeSnippets(context.TODO(), &ScaleEvent{
+		NodeName:  "kp-node-1",
+		NodeClass: "flatcar",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cicustom != "user=cephfs:snippets/kp-node-1-user.yaml" {
+		t.Errorf("Expected only the ignition config to be attached, got %s", cicustom)
+	}
+
+	userData, err := os.ReadFile(filepath.Join(snippetDir, "snippets", "kp-node-1-user.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rendered ignitionConfig
+	err = json.Unmarshal(userData, &rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.Ignition.Config == nil || len(rendered.Ignition.Config.Merge) != 1 {
+		t.Error("Expected kpNodeIgnitionConfig to be merged")
+	}
+
+	if rendered.Storage.Files[0].Contents.Source != "data:,kp-node-1" {
+		t.Errorf("Expected the hostname to be set, got %s", rendered.Storage.Files[0].Contents.Source)
+	}
+
+	if rendered.Passwd == nil || rendered.Passwd.Users[0].SshAuthorizedKeys[0] != "ssh-ed25519 AAAA test" {
+		t.Errorf("Expected the ssh key to be authorized, got %+v", rendered.Passwd)
+	}
+
+	if len(rendered.Storage.Filesystems) != 1 || rendered.Storage.Filesystems[0].Path != "/var/lib/longhorn" {
+		t.Errorf("Expected the data disk filesystem, got %+v", rendered.Storage.Filesystems)
+	}
+
+	units := map[string]string{}
+	for _, unit := range rendered.Systemd.Units {
+		units[unit.Name] = unit.Contents
+	}
+
+	if _, ok := units["var-lib-longhorn.mount"]; !ok {
+		t.Errorf("Expected a mount unit for the data disk, got %v", units)
+	}
+
+	joinUnit, ok := units["kproximate-join.service"]
+	if !ok {
+		t.Fatalf("Expected a join unit, got %v", units)
+	}
+
+	if !strings.Contains(joinUnit, `ExecStart=/bin/bash -c "kubeadm join --node-name kp-node-1"`) {
+		t.Errorf("Unexpected join unit: %s", joinUnit)
+	}
+}
@@ -0,0 +1,48 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// Returns scale down events recycling the kpNodes which joined the cluster
+// but never became schedulable within initFailedSeconds, e.g. because their
+// CNI failed to start. Such kpNodes would otherwise count towards maxKpNodes
+// forever while running no workloads, once removed any pods still pending
+// are scaled up for again.
+func (scaler *ProxmoxScaler) AssessInitFailedKpNodes(ctx context.Context) ([]*ScaleEvent, error) {
+	if scaler.currentConfig().InitFailedSeconds <= 0 {
+		return nil, nil
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	threshold := time.Second * time.Duration(scaler.currentConfig().InitFailedSeconds)
+	scaleEvents := []*ScaleEvent{}
+	for _, kpNode := range kpNodes {
+		if scaler.now().Sub(kpNode.CreationTimestamp.Time) < threshold {
+			continue
+		}
+
+		reason := kubernetes.NodeInitFailure(kpNode)
+		if reason == "" {
+			continue
+		}
+
+		logger.WarnLog(fmt.Sprintf("%s failed to initialise, recycling it", kpNode.Name), "reason", reason)
+		scaleEvents = append(scaleEvents, &ScaleEvent{
+			ScaleType: ScaleTypeDown,
+			NodeName:  kpNode.Name,
+			NodeClass: scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name,
+		})
+	}
+
+	return scaleEvents, nil
+}
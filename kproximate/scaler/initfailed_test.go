@@ -0,0 +1,71 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/identity"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAssessInitFailedKpNodes(t *testing.T) {
+	clock := newFakeClock()
+
+	kpNode := func(name string, age time.Duration, ready apiv1.ConditionStatus) apiv1.Node {
+		created := clock.Now().Add(-age)
+		return apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:              name,
+				CreationTimestamp: metav1.NewTime(created),
+				Labels:            map[string]string{nodeClassLabel: "default"},
+			},
+			Status: apiv1.NodeStatus{
+				Conditions: []apiv1.NodeCondition{
+					{
+						Type:               apiv1.NodeReady,
+						Status:             ready,
+						LastTransitionTime: metav1.NewTime(created),
+					},
+				},
+			},
+		}
+	}
+
+	s := &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{
+				kpNode("kp-node-healthy", time.Hour, apiv1.ConditionTrue),
+				kpNode("kp-node-failed", time.Hour, apiv1.ConditionFalse),
+				kpNode("kp-node-joining", time.Minute, apiv1.ConditionFalse),
+			},
+		},
+		config: config.KproximateConfig{
+			InitFailedSeconds: 600,
+			KpNodeNameRegex:   *identity.Naming{Prefix: "kp-node"}.Regex(),
+		},
+		clock: clock,
+	}
+
+	scaleEvents, err := s.AssessInitFailedKpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 || scaleEvents[0].NodeName != "kp-node-failed" || scaleEvents[0].ScaleType != ScaleTypeDown {
+		t.Errorf("Expected kp-node-failed to be scaled down, got %+v", scaleEvents)
+	}
+
+	s.config.InitFailedSeconds = 0
+	scaleEvents, err = s.AssessInitFailedKpNodes(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected no scale events when disabled, got %+v", scaleEvents)
+	}
+}
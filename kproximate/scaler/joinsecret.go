@@ -0,0 +1,85 @@
+package scaler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// The digest of the join secret last read, used to spot it being rotated.
+type joinSecretDigest struct {
+	mu     sync.Mutex
+	digest string
+}
+
+// Records the digest, returning whether it differs from the one previously
+// seen.
+func (d *joinSecretDigest) observe(digest string) bool {
+	if d == nil {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	rotated := d.digest != "" && d.digest != digest
+	d.digest = digest
+
+	return rotated
+}
+
+// A digest of the Secret's data which changes whenever any of its keys do.
+func secretDigest(data map[string]string) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	hash := sha256.New()
+	for _, key := range keys {
+		hash.Write([]byte(key))
+		hash.Write([]byte{0})
+		hash.Write([]byte(data[key]))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Reads the Secret named by kpJoinSecret, whose keys are rendered into the
+// join command and snippets as .JoinSecret. It is read for every kpNode, so a
+// rotated token or certificate key is used by the next kpNode provisioned
+// rather than after a restart. Returns nil when kpJoinSecret is unset.
+func (p *ProxmoxProvisioner) joinSecret(ctx context.Context) (map[string]string, error) {
+	if p.config.KpJoinSecret == "" {
+		return nil, nil
+	}
+
+	namespace, name, ok := strings.Cut(p.config.KpJoinSecret, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("kpJoinSecret should be namespace/name, got %s", p.config.KpJoinSecret)
+	}
+
+	if p.Kubernetes == nil {
+		return nil, fmt.Errorf("kpJoinSecret %s cannot be read without a kubernetes client", p.config.KpJoinSecret)
+	}
+
+	data, err := p.Kubernetes.GetSecretData(ctx, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kpJoinSecret %s: %w", p.config.KpJoinSecret, err)
+	}
+
+	digest := secretDigest(data)
+	if p.joinSecretDigest.observe(digest) {
+		logger.InfoLog("Join secret rotated, new kpNodes will join with the updated credentials", "secret", p.config.KpJoinSecret, "digest", digest[:12])
+	}
+
+	return data, nil
+}
@@ -0,0 +1,116 @@
+package scaler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestJoinSecretRenderedIntoSnippets(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kubernetesMock := &kubernetes.KubernetesMock{
+		Secrets: map[string]map[string]string{
+			"kproximate/k3s-join": {"token": "K10old"},
+		},
+	}
+
+	p := NewProxmoxProvisioner(&config.KproximateConfig{
+		KpJoinSecret:         "kproximate/k3s-join",
+		KpNodeSnippetDir:     snippetDir,
+		KpNodeSnippetStorage: "cephfs",
+		KpNodeUserData:       "#cloud-config\nruncmd:\n  - k3s agent --token {{ .JoinSecret.token }}\n",
+	}, &proxmox.ProxmoxMock{SnippetDir: snippetDir}, kubernetesMock)
+
+	for _, token := range []string{"K10old", "K10new"} {
+		kubernetesMock.Secrets["kproximate/k3s-join"]["token"] = token
+
+		_, err := p.writeSnippets(context.TODO(), &ScaleEvent{NodeName: "kp-node-1"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		userData, err := os.ReadFile(filepath.Join(snippetDir, "snippets", "kp-node-1-user.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "#cloud-config\nruncmd:\n  - k3s agent --token " + token + "\n"
+		if string(userData) != expected {
+			t.Errorf("Expected user data rendered with the current token %s, got %s", token, userData)
+		}
+	}
+
+	if p.joinSecretDigest.digest != secretDigest(map[string]string{"token": "K10new"}) {
+		t.Error("Expected the digest of the rotated join secret to be recorded")
+	}
+}
+
+func TestJoinSecretRenderedIntoJoinCommand(t *testing.T) {
+	p := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpJoinCommand:         "kubeadm join --token {{ .JoinSecret.token }} --certificate-key {{ index .JoinSecret \"certificate-key\" }}",
+			KpJoinCommandTemplate: true,
+		},
+	}
+
+	joinCommand, err := p.renderJoinCommand("kp-node-1", map[string]string{
+		"token":           "abcdef.0123456789abcdef",
+		"certificate-key": "f00d",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if joinCommand != "kubeadm join --token abcdef.0123456789abcdef --certificate-key f00d" {
+		t.Errorf("Unexpected join command: %s", joinCommand)
+	}
+}
+
+func TestJoinSecretMissingKeyFailsJoinCommand(t *testing.T) {
+	p := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpJoinCommand:         "kubeadm join --token {{ .JoinSecret.token }}",
+			KpJoinCommandTemplate: true,
+		},
+	}
+
+	joinCommand, err := p.renderJoinCommand("kp-node-1", map[string]string{
+		"certificate-key": "f00d",
+	})
+	if err == nil {
+		t.Errorf("Expected a key missing from the join secret to fail, got join command %s", joinCommand)
+	}
+}
+
+func TestJoinSecretErrors(t *testing.T) {
+	p := NewProxmoxProvisioner(&config.KproximateConfig{
+		KpJoinSecret: "k3s-join",
+	}, nil, &kubernetes.KubernetesMock{})
+
+	_, err := p.joinSecret(context.TODO())
+	if err == nil {
+		t.Error("Expected a join secret without a namespace to be rejected")
+	}
+
+	p.config.KpJoinSecret = "kproximate/missing"
+	_, err = p.joinSecret(context.TODO())
+	if err == nil {
+		t.Error("Expected a missing join secret to fail the provision")
+	}
+
+	p.config.KpJoinSecret = ""
+	data, err := p.joinSecret(context.TODO())
+	if err != nil || data != nil {
+		t.Errorf("Expected no join secret when kpJoinSecret is unset, got %v, %v", data, err)
+	}
+}
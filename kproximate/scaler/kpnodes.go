@@ -0,0 +1,74 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// A kpNode as seen by Kubernetes along with the Proxmox VM backing it.
+type KpNodeStatus struct {
+	Name      string    `json:"name"`
+	NodeClass string    `json:"nodeClass"`
+	Created   time.Time `json:"created"`
+	Ready     bool      `json:"ready"`
+	Cordoned  bool      `json:"cordoned"`
+	// The Proxmox VM, unset if it could not be found
+	VmID     int    `json:"vmid,omitempty"`
+	Host     string `json:"host,omitempty"`
+	VmStatus string `json:"vmStatus,omitempty"`
+	// In cores
+	Cpu float64 `json:"cpu"`
+	// In bytes
+	Memory int64 `json:"memory"`
+}
+
+// Returns the status of each kpNode, ordered by name.
+func (scaler *ProxmoxScaler) KpNodeStatuses(ctx context.Context) ([]KpNodeStatus, error) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	vms, err := scaler.Proxmox.GetAllKpNodes(scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := []KpNodeStatus{}
+	for _, kpNode := range kpNodes {
+		status := KpNodeStatus{
+			Name:      kpNode.Name,
+			NodeClass: scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name,
+			Created:   kpNode.CreationTimestamp.Time,
+			Cordoned:  kpNode.Spec.Unschedulable,
+			Cpu:       kpNode.Status.Capacity.Cpu().AsApproximateFloat64(),
+			Memory:    kpNode.Status.Capacity.Memory().Value(),
+		}
+
+		for _, condition := range kpNode.Status.Conditions {
+			if condition.Type == apiv1.NodeReady {
+				status.Ready = condition.Status == apiv1.ConditionTrue
+			}
+		}
+
+		index := slices.IndexFunc(vms, func(vm proxmox.VmInformation) bool { return vm.Name == kpNode.Name })
+		if index >= 0 {
+			status.VmID = vms[index].VmID
+			status.Host = vms[index].Node
+			status.VmStatus = vms[index].Status
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	slices.SortFunc(statuses, func(a, b KpNodeStatus) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return statuses, nil
+}
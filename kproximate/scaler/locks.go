@@ -0,0 +1,38 @@
+package scaler
+
+import (
+	"context"
+	"sync"
+)
+
+// Serializes operations sharing a key, eg clones targeting the same Proxmox
+// host, while allowing operations with different keys to run concurrently.
+type keyedLock struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}
+
+func newKeyedLock() *keyedLock {
+	return &keyedLock{
+		locks: map[string]chan struct{}{},
+	}
+}
+
+// Blocks until the lock for the key is acquired or the context is done,
+// returning a function that releases the lock.
+func (k *keyedLock) lock(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	lock, ok := k.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		k.locks[key] = lock
+	}
+	k.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,80 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestKeyedLockSerializesSameKey(t *testing.T) {
+	locks := newKeyedLock()
+
+	unlock, err := locks.lock(context.Background(), "host-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A different key is not blocked
+	unlockOther, err := locks.lock(context.Background(), "host-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlockOther()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	_, err = locks.lock(ctx, "host-01")
+	if err == nil {
+		t.Fatal("Expected the lock for host-01 to be held")
+	}
+
+	unlock()
+
+	unlock, err = locks.lock(context.Background(), "host-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestCreateReleasesCloneLockOnceCloned(t *testing.T) {
+	p := NewProxmoxProvisioner(&config.KproximateConfig{
+		KpNodeClasses: config.NodeClasses{{Name: "default"}},
+	}, &proxmox.ProxmoxMock{
+		TemplateStorage: "local-lvm",
+		KpNode:          proxmox.VmInformation{Status: "running"},
+	}, nil)
+
+	scaleEvent := &ScaleEvent{
+		NodeName:   "kp-node-1",
+		TargetHost: proxmox.HostInformation{Node: "host-01"},
+	}
+
+	err := p.Create(context.Background(), scaleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+
+	unlock, err := p.cloneLocks.lock(ctx, cloneLockKey("host-01", "local-lvm"))
+	if err != nil {
+		t.Fatal("Expected the clone lock to be released")
+	}
+	unlock()
+}
+
+func TestCloneLockKey(t *testing.T) {
+	if cloneLockKey("host-01", "ceph") == cloneLockKey("host-02", "ceph") {
+		t.Error("Expected clones to shared storage to be serialized per host")
+	}
+
+	if cloneLockKey("host-01", "ceph") == cloneLockKey("host-01", "local-lvm") {
+		t.Error("Expected clones to different storage to be serialized separately")
+	}
+}
@@ -0,0 +1,56 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/lupinelab/kproximate/config"
+)
+
+// Returned when an operator names a node which is not a kpNode
+var ErrUnknownKpNode = errors.New("unknown kpNode")
+
+// Returns a scale up event for a kpNode of the node class requested by an
+// operator rather than by unschedulable pods. The first node class is used if
+// none is named.
+func (scaler *ProxmoxScaler) ManualScaleEvent(nodeClass string) (*ScaleEvent, error) {
+	nodeClasses := scaler.currentConfig().NodeClasses()
+	if nodeClass == "" {
+		nodeClass = nodeClasses[0].Name
+	}
+
+	if !slices.ContainsFunc(nodeClasses, func(c config.NodeClass) bool { return c.Name == nodeClass }) {
+		return nil, fmt.Errorf("unknown node class %s", nodeClass)
+	}
+
+	return &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  scaler.newKpNodeName(),
+		NodeClass: nodeClass,
+	}, nil
+}
+
+// Returns a scale down event draining and removing the kpNode requested by an
+// operator, whatever the load on the cluster.
+func (scaler *ProxmoxScaler) ManualScaleDownEvent(ctx context.Context, kpNodeName string) (*ScaleEvent, error) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kpNode := range kpNodes {
+		if kpNode.Name != kpNodeName {
+			continue
+		}
+
+		return &ScaleEvent{
+			ScaleType: ScaleTypeDown,
+			NodeName:  kpNode.Name,
+			NodeClass: scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w %s", ErrUnknownKpNode, kpNodeName)
+}
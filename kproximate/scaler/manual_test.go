@@ -0,0 +1,126 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/identity"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestManualScaleEvent(t *testing.T) {
+	s := ProxmoxScaler{
+		config: config.KproximateConfig{
+			KpNodeClasses:    gpuNodeClasses(),
+			KpNodeNamePrefix: "kp-node",
+		},
+	}
+
+	scaleEvent, err := s.ManualScaleEvent("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.NodeClass != "small" {
+		t.Errorf("Expected the first node class, got: %s", scaleEvent.NodeClass)
+	}
+
+	if scaleEvent.ScaleType != ScaleTypeUp || scaleEvent.NodeName == "" {
+		t.Errorf("Expected a named scale up event, got: %+v", scaleEvent)
+	}
+
+	_, err = s.ManualScaleEvent("missing")
+	if err == nil {
+		t.Error("Expected an error for an unknown node class")
+	}
+}
+
+func TestManualScaleDownEvent(t *testing.T) {
+	s := &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "kp-node-a",
+						Labels: map[string]string{nodeClassLabel: "gpu"},
+					},
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses:   gpuNodeClasses(),
+			KpNodeNameRegex: *identity.Naming{Prefix: "kp-node"}.Regex(),
+		},
+	}
+
+	scaleEvent, err := s.ManualScaleDownEvent(context.Background(), "kp-node-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.ScaleType != ScaleTypeDown || scaleEvent.NodeName != "kp-node-a" || scaleEvent.NodeClass != "gpu" {
+		t.Errorf("Expected a scale down of kp-node-a, got: %+v", scaleEvent)
+	}
+
+	_, err = s.ManualScaleDownEvent(context.Background(), "kp-node-missing")
+	if !errors.Is(err, ErrUnknownKpNode) {
+		t.Errorf("Expected ErrUnknownKpNode, got: %v", err)
+	}
+}
+
+func TestKpNodeStatuses(t *testing.T) {
+	s := &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "kp-node-b"},
+				},
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "kp-node-a"},
+					Spec:       apiv1.NodeSpec{Unschedulable: true},
+					Status: apiv1.NodeStatus{
+						Capacity: apiv1.ResourceList{
+							apiv1.ResourceCPU:    resource.MustParse("2"),
+							apiv1.ResourceMemory: resource.MustParse("2Gi"),
+						},
+						Conditions: []apiv1.NodeCondition{
+							{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue},
+						},
+					},
+				},
+			},
+		},
+		Proxmox: &proxmox.ProxmoxMock{
+			KpNodes: []proxmox.VmInformation{
+				{Name: "kp-node-a", VmID: 101, Node: "host-01", Status: "running"},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeNameRegex: *identity.Naming{Prefix: "kp-node"}.Regex(),
+		},
+	}
+
+	statuses, err := s.KpNodeStatuses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statuses) != 2 || statuses[0].Name != "kp-node-a" || statuses[1].Name != "kp-node-b" {
+		t.Fatalf("Expected kp-node-a and kp-node-b in order, got: %+v", statuses)
+	}
+
+	a := statuses[0]
+	if !a.Ready || !a.Cordoned || a.VmID != 101 || a.Host != "host-01" || a.VmStatus != "running" || a.Cpu != 2 || a.Memory != 2<<30 {
+		t.Errorf("Unexpected status for kp-node-a: %+v", a)
+	}
+
+	if statuses[1].VmID != 0 || statuses[1].Ready {
+		t.Errorf("Expected kp-node-b to have no VM and not be ready, got: %+v", statuses[1])
+	}
+}
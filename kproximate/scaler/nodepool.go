@@ -0,0 +1,185 @@
+package scaler
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// The node classes whose kpNodes are managed by a NodePool. These are left
+// out of autoscaling so that the NodePool's replicas are not fought over.
+func (scaler *ProxmoxScaler) nodePoolClasses(ctx context.Context) (map[string]bool, error) {
+	nodePoolClasses := map[string]bool{}
+	if !scaler.currentConfig().NodePools {
+		return nodePoolClasses, nil
+	}
+
+	nodePools, err := scaler.Kubernetes.GetNodePools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node pools: %w", err)
+	}
+
+	for _, nodePool := range nodePools {
+		nodePoolClasses[nodePool.NodeClass] = true
+	}
+
+	return nodePoolClasses, nil
+}
+
+// The names of the kpNodes managed by node pools.
+func (scaler *ProxmoxScaler) nodePoolKpNodes(ctx context.Context) (map[string]bool, error) {
+	nodePoolKpNodes := map[string]bool{}
+
+	nodePoolClasses, err := scaler.nodePoolClasses(ctx)
+	if err != nil || len(nodePoolClasses) == 0 {
+		return nodePoolKpNodes, err
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kpNode := range kpNodes {
+		if nodePoolClasses[scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name] {
+			nodePoolKpNodes[kpNode.Name] = true
+		}
+	}
+
+	return nodePoolKpNodes, nil
+}
+
+// The node classes available to autoscaling.
+func (scaler *ProxmoxScaler) autoscaledNodeClasses(ctx context.Context) ([]config.NodeClass, error) {
+	nodePoolClasses, err := scaler.nodePoolClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeClasses := []config.NodeClass{}
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		if !nodePoolClasses[nodeClass.Name] {
+			nodeClasses = append(nodeClasses, nodeClass)
+		}
+	}
+
+	return nodeClasses, nil
+}
+
+func isNodeReady(node apiv1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == apiv1.NodeReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// Returns the scale events which bring the number of kpNodes of each
+// NodePool's node class to its replicas and records the current number in
+// each NodePool's status. When scaling a NodePool down its least loaded
+// kpNodes are removed.
+func (scaler *ProxmoxScaler) NodePoolScaleEvents(ctx context.Context) ([]*ScaleEvent, error) {
+	nodePools, err := scaler.Kubernetes.GetNodePools(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node pools: %w", err)
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	allocatedResources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	scaleEvents := []*ScaleEvent{}
+	reconciled := map[string]bool{}
+	for _, nodePool := range nodePools {
+		nodeClass := scaler.currentConfig().NodeClass(nodePool.NodeClass)
+		if nodeClass.Name != nodePool.NodeClass {
+			logger.WarnLog(fmt.Sprintf("Node pool %s references unknown node class %s", nodePool.Name, nodePool.NodeClass))
+			continue
+		}
+
+		if reconciled[nodeClass.Name] {
+			logger.WarnLog(fmt.Sprintf("Node pool %s references node class %s which is already managed by another node pool", nodePool.Name, nodeClass.Name))
+			continue
+		}
+		reconciled[nodeClass.Name] = true
+
+		status := kubernetes.NodePoolStatus{
+			ObservedGeneration: nodePool.Generation,
+		}
+		nodePoolKpNodes := []apiv1.Node{}
+		for _, kpNode := range kpNodes {
+			if scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name != nodeClass.Name {
+				continue
+			}
+
+			nodePoolKpNodes = append(nodePoolKpNodes, kpNode)
+			status.Replicas++
+			if isNodeReady(kpNode) {
+				status.ReadyReplicas++
+			}
+		}
+
+		err = scaler.Kubernetes.UpdateNodePoolStatus(ctx, nodePool.Name, status)
+		if err != nil {
+			logger.WarnLog(fmt.Sprintf("Failed to update the status of node pool %s", nodePool.Name), "error", err)
+		}
+
+		for i := status.Replicas; i < nodePool.Replicas; i++ {
+			scaleEvents = append(scaleEvents, &ScaleEvent{
+				ScaleType: ScaleTypeUp,
+				NodeName:  scaler.newKpNodeName(),
+				NodeClass: nodeClass.Name,
+			})
+		}
+
+		if status.Replicas <= nodePool.Replicas {
+			continue
+		}
+
+		// Remove the least loaded kpNodes first
+		slices.SortStableFunc(nodePoolKpNodes, func(a, b apiv1.Node) int {
+			return cmp.Compare(
+				kpNodeLoad(nodeClass, allocatedResources[a.Name]),
+				kpNodeLoad(nodeClass, allocatedResources[b.Name]),
+			)
+		})
+
+		for _, kpNode := range nodePoolKpNodes[:status.Replicas-nodePool.Replicas] {
+			scaleEvents = append(scaleEvents, &ScaleEvent{
+				ScaleType: ScaleTypeDown,
+				NodeName:  kpNode.Name,
+				NodeClass: nodeClass.Name,
+			})
+		}
+	}
+
+	return scaleEvents, nil
+}
+
+// The combined fraction of a kpNode's cpu and memory allocated
+func kpNodeLoad(nodeClass config.NodeClass, allocated kubernetes.AllocatedResources) float64 {
+	var load float64
+	if nodeClass.Cores > 0 {
+		load += allocated.Cpu / float64(nodeClass.Cores)
+	}
+
+	if nodeClass.Memory > 0 {
+		load += allocated.Memory / float64(int64(nodeClass.Memory)<<20)
+	}
+
+	return load
+}
@@ -0,0 +1,132 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func nodePoolKpNode(name string, nodeClass string) apiv1.Node {
+	return apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: map[string]string{nodeClassLabel: nodeClass},
+		},
+		Status: apiv1.NodeStatus{
+			Conditions: []apiv1.NodeCondition{
+				{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func newNodePoolScaler(kubernetesMock *kubernetes.KubernetesMock) *ProxmoxScaler {
+	return &ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{Name: "general", Cores: 2, Memory: 2048},
+				{Name: "gpu", Cores: 8, Memory: 16384},
+			},
+			KpNodeNamePrefix: "kp-node",
+			LoadHeadroom:     0.2,
+			NodePools:        true,
+		},
+	}
+}
+
+func TestNodePoolScaleEventsScaleUp(t *testing.T) {
+	kubernetesMock := &kubernetes.KubernetesMock{
+		KpNodes: []apiv1.Node{
+			nodePoolKpNode("kp-node-gpu-1", "gpu"),
+			nodePoolKpNode("kp-node-general-1", "general"),
+		},
+		NodePools: []kubernetes.NodePool{
+			{Name: "gpu", Generation: 3, NodeClass: "gpu", Replicas: 3},
+		},
+	}
+	s := newNodePoolScaler(kubernetesMock)
+
+	scaleEvents, err := s.NodePoolScaleEvents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 2 {
+		t.Fatalf("Expected 2 scaleEvents, got %d", len(scaleEvents))
+	}
+
+	for _, scaleEvent := range scaleEvents {
+		if scaleEvent.ScaleType != ScaleTypeUp || scaleEvent.NodeClass != "gpu" {
+			t.Errorf("Expected a gpu scale up event, got %+v", scaleEvent)
+		}
+	}
+
+	expectedStatus := kubernetes.NodePoolStatus{Replicas: 1, ReadyReplicas: 1, ObservedGeneration: 3}
+	if kubernetesMock.NodePoolStatuses["gpu"] != expectedStatus {
+		t.Errorf("Expected status %+v, got %+v", expectedStatus, kubernetesMock.NodePoolStatuses["gpu"])
+	}
+}
+
+func TestNodePoolScaleEventsScaleDownLeastLoaded(t *testing.T) {
+	s := newNodePoolScaler(&kubernetes.KubernetesMock{
+		KpNodes: []apiv1.Node{
+			nodePoolKpNode("kp-node-gpu-1", "gpu"),
+			nodePoolKpNode("kp-node-gpu-2", "gpu"),
+		},
+		AllocatedResources: map[string]kubernetes.AllocatedResources{
+			"kp-node-gpu-1": {Cpu: 4, Memory: 1 << 30},
+			"kp-node-gpu-2": {Cpu: 1, Memory: 1 << 30},
+		},
+		NodePools: []kubernetes.NodePool{
+			{Name: "gpu", NodeClass: "gpu", Replicas: 1},
+		},
+	})
+
+	scaleEvents, err := s.NodePoolScaleEvents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 || scaleEvents[0].ScaleType != ScaleTypeDown || scaleEvents[0].NodeName != "kp-node-gpu-2" {
+		t.Errorf("Expected kp-node-gpu-2 to be removed, got %+v", scaleEvents)
+	}
+}
+
+func TestScaleDownSkipsNodePoolKpNodes(t *testing.T) {
+	s := newNodePoolScaler(&kubernetes.KubernetesMock{
+		KpNodes: []apiv1.Node{
+			nodePoolKpNode("kp-node-gpu-1", "gpu"),
+			nodePoolKpNode("kp-node-general-1", "general"),
+		},
+		AllocatedResources: map[string]kubernetes.AllocatedResources{
+			"kp-node-general-1": {Cpu: 1, Memory: 1 << 30},
+		},
+		NodePools: []kubernetes.NodePool{
+			{Name: "gpu", NodeClass: "gpu", Replicas: 1},
+		},
+	})
+
+	scaleEvent := ScaleEvent{ScaleType: ScaleTypeDown}
+	err := s.selectScaleDownTarget(context.Background(), &scaleEvent, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.NodeName != "kp-node-general-1" {
+		t.Errorf("Expected kp-node-general-1 to be selected, got %s", scaleEvent.NodeName)
+	}
+
+	nodeClasses, err := s.autoscaledNodeClasses(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodeClasses) != 1 || nodeClasses[0].Name != "general" {
+		t.Errorf("Expected only the general node class to be autoscaled, got %+v", nodeClasses)
+	}
+}
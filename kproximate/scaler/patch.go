@@ -0,0 +1,193 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	// The time a kpNode was last patched
+	patchedAnnotation = "kproximate.io/patched"
+	// The time a kpNode was last drained to be patched, whether or not the
+	// patch succeeded, so that a failing patch is not retried every poll
+	patchAttemptedAnnotation = "kproximate.io/patch-attempted"
+)
+
+// Implemented by provisioners able to update a machine in place, rather than
+// it being replaced by a new machine cloned from an updated template.
+type KpNodePatcher interface {
+	PatchKpNode(ctx context.Context, nodeName string) error
+}
+
+// When the kpNode was last patched or attempted to be, or when it joined the
+// cluster if it never has been.
+func lastPatched(kpNode apiv1.Node) time.Time {
+	patched := kpNode.CreationTimestamp.Time
+	for _, annotation := range []string{patchedAnnotation, patchAttemptedAnnotation} {
+		value, err := time.Parse(time.RFC3339, kpNode.Annotations[annotation])
+		if err == nil && value.After(patched) {
+			patched = value
+		}
+	}
+
+	return patched
+}
+
+func kpNodeReady(kpNode apiv1.Node) bool {
+	for _, condition := range kpNode.Status.Conditions {
+		if condition.Type == apiv1.NodeReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// Whether kpNodes are patched by running patchCommand via the guest agent,
+// otherwise they are replaced. Talos kpNodes have no shell to run it in.
+func (scaler *ProxmoxScaler) patchesInPlace() bool {
+	if scaler.currentConfig().PatchCommand == "" || scaler.currentConfig().KpNodeOsType == "talos" {
+		return false
+	}
+
+	_, ok := scaler.Provisioner.(KpNodePatcher)
+	return ok
+}
+
+// Returns an event patching the ready kpNode which has gone the longest
+// without being patched, once that is more than patchIntervalHours, or nil if
+// every kpNode is up to date. The kpNode is patched in place when a
+// patchCommand is configured and replaced by a new kpNode of the same node
+// class otherwise.
+func (scaler *ProxmoxScaler) AssessPatching(ctx context.Context) (*ScaleEvent, error) {
+	if scaler.currentConfig().PatchIntervalHours == 0 {
+		return nil, nil
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	due := scaler.now().Add(-time.Hour * time.Duration(scaler.currentConfig().PatchIntervalHours))
+
+	var stalest *apiv1.Node
+	for idx := range kpNodes {
+		kpNode := kpNodes[idx]
+
+		// Cordoned kpNodes are being removed or are being looked after by
+		// someone else
+		if kpNode.Spec.Unschedulable || !kpNodeReady(kpNode) {
+			continue
+		}
+
+		patched := lastPatched(kpNode)
+		if patched.After(due) {
+			continue
+		}
+
+		if stalest == nil || patched.Before(lastPatched(*stalest)) {
+			stalest = &kpNodes[idx]
+		}
+	}
+
+	if stalest == nil {
+		return nil, nil
+	}
+
+	nodeClass := scaler.currentConfig().NodeClass(stalest.Labels[nodeClassLabel])
+
+	scaleEvent := ScaleEvent{
+		ScaleType: ScaleTypePatch,
+		NodeName:  stalest.Name,
+		NodeClass: nodeClass.Name,
+	}
+
+	if !scaler.patchesInPlace() {
+		scaleEvent = ScaleEvent{
+			ScaleType:       ScaleTypeReplace,
+			NodeName:        scaler.newKpNodeName(),
+			NodeClass:       nodeClass.Name,
+			ReplaceNodeName: stalest.Name,
+		}
+	}
+
+	logger.DebugLog("Generated patch event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+	return &scaleEvent, nil
+}
+
+// Drains the kpNode, updates it in place and waits for it to be ready again
+// before uncordoning it. The kpNode is uncordoned if the patch fails, it is
+// not patched again until patchIntervalHours has passed.
+func (scaler *ProxmoxScaler) Patch(ctx context.Context, scaleEvent *ScaleEvent) error {
+	if scaleEvent.ScaleType != ScaleTypePatch {
+		return fmt.Errorf("expected ScaleEvent ScaleType to be '%d' but got: %d", ScaleTypePatch, scaleEvent.ScaleType)
+	}
+
+	patcher, ok := scaler.Provisioner.(KpNodePatcher)
+	if !ok {
+		return fmt.Errorf("the provisioner cannot patch kpNodes in place")
+	}
+
+	err := scaler.Kubernetes.AnnotateKpNode(ctx, scaleEvent.NodeName, map[string]string{
+		patchAttemptedAnnotation: scaler.now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return classifiedError(FailureKubernetesApi, err)
+	}
+
+	pctx, cancel := withTimeoutSeconds(ctx, scaler.currentConfig().PatchTimeoutSeconds)
+	defer cancel()
+
+	logger.InfoLog(fmt.Sprintf("Draining %s to patch it", scaleEvent.NodeName))
+
+	err = scaler.Kubernetes.DrainKpNode(pctx, scaleEvent.NodeName)
+	if err != nil {
+		scaler.uncordonUnpatched(ctx, scaleEvent.NodeName)
+		return classifiedError(FailureKubernetesApi, err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Patching %s", scaleEvent.NodeName))
+
+	err = patcher.PatchKpNode(pctx, scaleEvent.NodeName)
+	if err != nil {
+		scaler.uncordonUnpatched(ctx, scaleEvent.NodeName)
+		return err
+	}
+
+	err = scaler.Kubernetes.CheckForNodeJoin(pctx, scaleEvent.NodeName)
+	if err != nil {
+		scaler.uncordonUnpatched(ctx, scaleEvent.NodeName)
+		return classifiedError(FailureJoinTimeout, err)
+	}
+
+	err = scaler.Kubernetes.AnnotateKpNode(ctx, scaleEvent.NodeName, map[string]string{
+		patchedAnnotation: scaler.now().UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return classifiedError(FailureKubernetesApi, err)
+	}
+
+	err = scaler.Kubernetes.UncordonKpNode(ctx, scaleEvent.NodeName)
+	if err != nil {
+		return classifiedError(FailureKubernetesApi, err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Patched %s", scaleEvent.NodeName))
+	ReportProgress(ctx, scaleEvent, ScaleEventPatched, "")
+
+	return nil
+}
+
+// Returns a kpNode which could not be patched to service rather than leaving
+// it cordoned until it is next patched.
+func (scaler *ProxmoxScaler) uncordonUnpatched(ctx context.Context, nodeName string) {
+	err := scaler.Kubernetes.UncordonKpNode(context.WithoutCancel(ctx), nodeName)
+	if err != nil {
+		logger.WarnLog(fmt.Sprintf("Failed to uncordon %s after it could not be patched", nodeName), "error", err)
+	}
+}
@@ -0,0 +1,160 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type patcherProvisionerMock struct {
+	provisionerMock
+	patchErr error
+	patched  []string
+}
+
+func (p *patcherProvisionerMock) PatchKpNode(ctx context.Context, nodeName string) error {
+	p.patched = append(p.patched, nodeName)
+	return p.patchErr
+}
+
+func patchTestKpNode(name string, age time.Duration, annotations map[string]string) apiv1.Node {
+	return apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Labels:            map[string]string{nodeClassLabel: "default"},
+			Annotations:       annotations,
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-age)),
+		},
+		Status: apiv1.NodeStatus{
+			Conditions: []apiv1.NodeCondition{
+				{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func newPatchScaler(provisioner Provisioner, kpNodes []apiv1.Node) *ProxmoxScaler {
+	return &ProxmoxScaler{
+		Kubernetes:  &kubernetes.KubernetesMock{KpNodes: kpNodes},
+		Provisioner: provisioner,
+		config: config.KproximateConfig{
+			KpNodeNamePrefix:   "kp-node",
+			PatchCommand:       "apt-get update && apt-get -y upgrade",
+			PatchIntervalHours: 24,
+		},
+	}
+}
+
+func TestAssessPatchingSelectsLongestUnpatchedKpNode(t *testing.T) {
+	recentlyPatched := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	cordoned := patchTestKpNode("kp-node-4", 96*time.Hour, nil)
+	cordoned.Spec.Unschedulable = true
+
+	s := newPatchScaler(&patcherProvisionerMock{}, []apiv1.Node{
+		patchTestKpNode("kp-node-1", 48*time.Hour, nil),
+		patchTestKpNode("kp-node-2", 72*time.Hour, map[string]string{patchedAnnotation: recentlyPatched}),
+		patchTestKpNode("kp-node-3", 60*time.Hour, nil),
+		cordoned,
+		patchTestKpNode("kp-node-5", time.Hour, nil),
+	})
+
+	scaleEvent, err := s.AssessPatching(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent == nil || scaleEvent.ScaleType != ScaleTypePatch || scaleEvent.NodeName != "kp-node-3" {
+		t.Fatalf("Expected a patch event for kp-node-3, got %+v", scaleEvent)
+	}
+
+	if RequiredScaleEventVersion(scaleEvent) != 3 {
+		t.Errorf("Expected patch events to require version 3, got %d", RequiredScaleEventVersion(scaleEvent))
+	}
+}
+
+func TestAssessPatchingReplacesWithoutPatchCommand(t *testing.T) {
+	s := newPatchScaler(&patcherProvisionerMock{}, []apiv1.Node{
+		patchTestKpNode("kp-node-1", 48*time.Hour, nil),
+	})
+	s.config.PatchCommand = ""
+
+	scaleEvent, err := s.AssessPatching(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent == nil || scaleEvent.ScaleType != ScaleTypeReplace || scaleEvent.ReplaceNodeName != "kp-node-1" || scaleEvent.NodeClass != "default" {
+		t.Fatalf("Expected kp-node-1 to be replaced, got %+v", scaleEvent)
+	}
+}
+
+func TestAssessPatchingNothingDue(t *testing.T) {
+	s := newPatchScaler(&patcherProvisionerMock{}, []apiv1.Node{
+		patchTestKpNode("kp-node-1", 48*time.Hour, map[string]string{
+			patchAttemptedAnnotation: time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+		}),
+	})
+
+	scaleEvent, err := s.AssessPatching(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent != nil {
+		t.Errorf("Expected no patch event, got %+v", scaleEvent)
+	}
+}
+
+func TestPatch(t *testing.T) {
+	provisioner := &patcherProvisionerMock{}
+	s := newPatchScaler(provisioner, nil)
+	kubernetesMock := s.Kubernetes.(*kubernetes.KubernetesMock)
+
+	var reported ScaleEventStatus
+	ctx := WithProgressReporter(context.Background(), func(status ScaleEventStatus) {
+		reported = status
+	})
+
+	err := s.Patch(ctx, &ScaleEvent{ScaleType: ScaleTypePatch, NodeName: "kp-node-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(kubernetesMock.DrainedNodes) != 1 || len(provisioner.patched) != 1 || len(kubernetesMock.UncordonedNodes) != 1 {
+		t.Errorf("Expected kp-node-1 to be drained, patched and uncordoned")
+	}
+
+	if kubernetesMock.Annotations["kp-node-1"][patchedAnnotation] == "" {
+		t.Error("Expected kp-node-1 to be annotated as patched")
+	}
+
+	if reported.State != ScaleEventPatched {
+		t.Errorf("Expected the patch to be reported, got %s", reported.State)
+	}
+}
+
+func TestPatchUncordonsOnFailure(t *testing.T) {
+	provisioner := &patcherProvisionerMock{patchErr: errors.New("dpkg lock held")}
+	s := newPatchScaler(provisioner, nil)
+	kubernetesMock := s.Kubernetes.(*kubernetes.KubernetesMock)
+
+	err := s.Patch(context.Background(), &ScaleEvent{ScaleType: ScaleTypePatch, NodeName: "kp-node-1"})
+	if err == nil {
+		t.Fatal("Expected the patch to fail")
+	}
+
+	if len(kubernetesMock.UncordonedNodes) != 1 {
+		t.Error("Expected kp-node-1 to be uncordoned")
+	}
+
+	annotations := kubernetesMock.Annotations["kp-node-1"]
+	if annotations[patchedAnnotation] != "" || annotations[patchAttemptedAnnotation] == "" {
+		t.Errorf("Expected only the patch attempt to be recorded, got %v", annotations)
+	}
+}
@@ -0,0 +1,81 @@
+package scaler
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// The privileges on /vms needed to clone, configure, start, stop and delete
+// kpNodes whatever the configuration
+var kpNodePrivileges = []string{
+	"VM.Allocate",
+	"VM.Audit",
+	"VM.Clone",
+	"VM.Config.CPU",
+	"VM.Config.Cloudinit",
+	"VM.Config.Disk",
+	"VM.Config.Memory",
+	"VM.Config.Network",
+	"VM.Config.Options",
+	"VM.PowerMgmt",
+}
+
+// Returns the Proxmox privileges the configuration needs.
+func (scaler *ProxmoxScaler) requiredPrivileges() []proxmox.Privilege {
+	required := []proxmox.Privilege{}
+	for _, name := range kpNodePrivileges {
+		required = append(required, proxmox.Privilege{Path: "/vms", Name: name})
+	}
+
+	// Host resources are only reported with Sys.Audit
+	required = append(required, proxmox.Privilege{Path: "/nodes", Name: "Sys.Audit"})
+
+	if scaler.currentConfig().DrainHosts || scaler.currentConfig().RebalanceSkew > 0 {
+		required = append(required, proxmox.Privilege{Path: "/vms", Name: "VM.Migrate"})
+	}
+
+	// Data disks are allocated on their storage after cloning
+	storages := []string{}
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		for _, dataDisk := range nodeClass.DataDisks {
+			if dataDisk.Storage != "" && !slices.Contains(storages, dataDisk.Storage) {
+				storages = append(storages, dataDisk.Storage)
+			}
+		}
+	}
+	slices.Sort(storages)
+
+	for _, storage := range storages {
+		required = append(required, proxmox.Privilege{Path: fmt.Sprintf("/storage/%s", storage), Name: "Datastore.AllocateSpace"})
+	}
+
+	return required
+}
+
+// Checks the Proxmox API user or token has every privilege the configuration
+// needs, so that a missing privilege is reported on startup rather than by
+// the first scale event to need it.
+func (scaler *ProxmoxScaler) CheckProxmoxPermissions() error {
+	if scaler.currentConfig().DisablePermissionCheck {
+		return nil
+	}
+
+	missing, err := scaler.Proxmox.MissingPrivileges(scaler.requiredPrivileges())
+	if err != nil {
+		return err
+	}
+
+	if len(missing) == 0 {
+		return nil
+	}
+
+	privileges := []string{}
+	for _, privilege := range missing {
+		privileges = append(privileges, privilege.String())
+	}
+
+	return fmt.Errorf("the Proxmox API user is missing privileges: %s", strings.Join(privileges, ", "))
+}
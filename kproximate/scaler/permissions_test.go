@@ -0,0 +1,58 @@
+package scaler
+
+import (
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestCheckProxmoxPermissions(t *testing.T) {
+	s := &ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{},
+		config: config.KproximateConfig{
+			DrainHosts: true,
+			KpNodeClasses: config.NodeClasses{
+				{Name: "storage", DataDisks: []config.DataDisk{{Size: 100, Storage: "ceph"}}},
+			},
+		},
+	}
+
+	err := s.CheckProxmoxPermissions()
+	if err != nil {
+		t.Fatalf("Expected every privilege to be granted, got %s", err)
+	}
+
+	s.Proxmox = &proxmox.ProxmoxMock{
+		Unprivileged: []proxmox.Privilege{
+			{Path: "/vms", Name: "VM.Migrate"},
+			{Path: "/storage/ceph", Name: "Datastore.AllocateSpace"},
+		},
+	}
+
+	err = s.CheckProxmoxPermissions()
+	if err == nil {
+		t.Fatal("Expected missing privileges to fail the check")
+	}
+
+	expected := "the Proxmox API user is missing privileges: VM.Migrate on /vms, Datastore.AllocateSpace on /storage/ceph"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+
+	s.config.DisablePermissionCheck = true
+	err = s.CheckProxmoxPermissions()
+	if err != nil {
+		t.Errorf("Expected the check to be skipped, got %s", err)
+	}
+}
+
+func TestRequiredPrivilegesWithoutMigration(t *testing.T) {
+	s := &ProxmoxScaler{}
+
+	for _, privilege := range s.requiredPrivileges() {
+		if privilege.Name == "VM.Migrate" {
+			t.Error("Expected VM.Migrate not to be required without drainHosts or rebalanceSkew")
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// Provisions a single kpNode of the node class, waits for it to join the
+// cluster and then removes it again, so that a template can be validated
+// before autoscaling is enabled. The kpNode is removed whether or not it
+// joined.
+func (scaler *ProxmoxScaler) Preflight(ctx context.Context, nodeClass string) error {
+	scaleEvent := &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  scaler.newKpNodeName(),
+		NodeClass: scaler.currentConfig().NodeClass(nodeClass).Name,
+	}
+
+	scaleUpErr := scaler.ScaleUp(ctx, scaleEvent)
+	if scaleUpErr != nil {
+		scaleUpErr = fmt.Errorf("%s failed to join the cluster: %w", scaleEvent.NodeName, scaleUpErr)
+	}
+
+	// Clean up even if the preflight was interrupted
+	dctx, cancel := context.WithTimeout(
+		context.WithoutCancel(ctx),
+		time.Second*time.Duration(scaler.currentConfig().WaitSecondsForProvision),
+	)
+	defer cancel()
+
+	logger.InfoLog(fmt.Sprintf("Removing preflight node %s", scaleEvent.NodeName))
+
+	deleteErr := scaler.DeleteNode(dctx, scaleEvent.NodeName)
+	if scaleUpErr != nil {
+		// The kpNode may never have been created
+		if deleteErr != nil {
+			logger.DebugLog("Failed to remove preflight node", "node", scaleEvent.NodeName, "error", deleteErr)
+		}
+
+		return scaleUpErr
+	}
+
+	if deleteErr != nil {
+		return fmt.Errorf("%s joined the cluster but could not be removed: %w", scaleEvent.NodeName, deleteErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPreflightRemovesNodeAfterJoin(t *testing.T) {
+	provisioner := &provisionerMock{}
+	s := newTestScaler(provisioner)
+
+	err := s.Preflight(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.created) != 1 {
+		t.Fatalf("Expected 1 node to be created, got %d", len(provisioner.created))
+	}
+
+	if len(provisioner.destroyed) != 1 || provisioner.destroyed[0] != provisioner.created[0] {
+		t.Errorf("Expected %s to be destroyed, got %v", provisioner.created[0], provisioner.destroyed)
+	}
+}
+
+func TestPreflightReportsFailure(t *testing.T) {
+	provisioner := &provisionerMock{
+		createErr: errors.New("clone failed"),
+	}
+	s := newTestScaler(provisioner)
+
+	err := s.Preflight(context.Background(), "")
+	if err == nil {
+		t.Fatal("Expected the preflight to fail")
+	}
+
+	if !errors.Is(err, provisioner.createErr) {
+		t.Errorf("Expected the clone failure to be reported, got %s", err.Error())
+	}
+
+	if len(provisioner.destroyed) != 1 {
+		t.Errorf("Expected the failed node to be cleaned up, got %v", provisioner.destroyed)
+	}
+}
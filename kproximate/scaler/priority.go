@@ -0,0 +1,49 @@
+package scaler
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// The priority of a scale up of the node class, the highest of the node
+// class's eventPriority and the scaleEventPriorities of the priority classes
+// of the pending pods a kpNode of the class could schedule.
+func (scaler *ProxmoxScaler) scaleEventPriority(nodeClassName string, pendingPods []kubernetes.UnschedulablePod) int {
+	nodeClass := scaler.currentConfig().NodeClass(nodeClassName)
+	priority := nodeClass.EventPriority
+
+	if len(scaler.currentConfig().ScaleEventPriorities) == 0 {
+		return priority
+	}
+
+	for _, pod := range pendingPods {
+		podPriority, ok := scaler.currentConfig().ScaleEventPriorities[pod.PriorityClassName]
+		if !ok || podPriority <= priority {
+			continue
+		}
+
+		if scaler.podMisfit(pod, nodeClass) == "" {
+			priority = podPriority
+		}
+	}
+
+	return priority
+}
+
+// Sets the priority of each scale up event from the pending pods it is for.
+func (scaler *ProxmoxScaler) prioritizeScaleEvents(scaleEvents []*ScaleEvent, pendingPods []kubernetes.UnschedulablePod) {
+	for _, scaleEvent := range scaleEvents {
+		scaleEvent.Priority = scaler.scaleEventPriority(scaleEvent.NodeClass, pendingPods)
+	}
+}
+
+// Orders scale events by descending priority, keeping the order of events of
+// equal priority, so that urgent capacity is published, and with priority
+// queues consumed, ahead of routine expansion.
+func orderByPriority(scaleEvents []*ScaleEvent) {
+	slices.SortStableFunc(scaleEvents, func(a *ScaleEvent, b *ScaleEvent) int {
+		return cmp.Compare(b.Priority, a.Priority)
+	})
+}
@@ -0,0 +1,67 @@
+package scaler
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+func TestPrioritizeAndOrderScaleEvents(t *testing.T) {
+	nodeClasses := gpuNodeClasses()
+	nodeClasses[0].EventPriority = 2
+
+	s := ProxmoxScaler{
+		config: config.KproximateConfig{
+			KpNodeClasses: nodeClasses,
+			ScaleEventPriorities: map[string]int{
+				"critical": 7,
+			},
+		},
+	}
+
+	pendingPods := []kubernetes.UnschedulablePod{
+		{
+			Namespace: "default",
+			Name:      "web-0",
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Cpu: 1,
+			},
+		},
+		{
+			Namespace:         "default",
+			Name:              "train-0",
+			PriorityClassName: "critical",
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Cpu:      1,
+				Extended: map[string]int64{"nvidia.com/gpu": 1},
+			},
+		},
+	}
+
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: 1, NodeClass: "small", NodeName: "kp-node-a"},
+		{ScaleType: 1, NodeClass: "gpu", NodeName: "kp-node-b"},
+		{ScaleType: 1, NodeClass: "small", NodeName: "kp-node-c"},
+	}
+
+	s.prioritizeScaleEvents(scaleEvents, pendingPods)
+	orderByPriority(scaleEvents)
+
+	// Only the gpu node class could schedule the critical pod
+	nodeNames := []string{}
+	priorities := []int{}
+	for _, scaleEvent := range scaleEvents {
+		nodeNames = append(nodeNames, scaleEvent.NodeName)
+		priorities = append(priorities, scaleEvent.Priority)
+	}
+
+	if !slices.Equal(nodeNames, []string{"kp-node-b", "kp-node-a", "kp-node-c"}) {
+		t.Errorf("Expected the gpu scaleEvent first, got %v", nodeNames)
+	}
+
+	if !slices.Equal(priorities, []int{7, 2, 2}) {
+		t.Errorf("Expected priorities [7 2 2], got %v", priorities)
+	}
+}
@@ -0,0 +1,661 @@
+package scaler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// Creates and destroys the machines backing kpNodes. Scaling decisions are
+// independent of the provisioner so other backends can be added alongside
+// Proxmox.
+type Provisioner interface {
+	// Creates and starts the machine for a scale up event.
+	Create(ctx context.Context, scaleEvent *ScaleEvent) error
+	// Waits until the machine is ready to join the kubernetes cluster, joining
+	// it if the provisioner is responsible for running the join command.
+	WaitReady(ctx context.Context, scaleEvent *ScaleEvent) error
+	// Removes the machine and anything created alongside it.
+	Destroy(ctx context.Context, nodeName string) error
+}
+
+// Provisions kpNodes by cloning a Proxmox template.
+type ProxmoxProvisioner struct {
+	// Shared with the scaler so reloaded settings apply to both
+	config  *config.KproximateConfig
+	Proxmox proxmox.Proxmox
+	// Reads the join secret, see kpJoinSecret
+	Kubernetes       kubernetes.WorkerKubernetes
+	cloneHistory     *cloneHistory
+	templateDigests  *templateDigests
+	joinSecretDigest *joinSecretDigest
+	// Serializes clones to the same pHost and storage, see cloneLockKey
+	cloneLocks *keyedLock
+	// The system clock unless set by tests
+	clock Clock
+}
+
+func NewProxmoxProvisioner(config *config.KproximateConfig, proxmox proxmox.Proxmox, kubernetes kubernetes.WorkerKubernetes) *ProxmoxProvisioner {
+	return &ProxmoxProvisioner{
+		config:           config,
+		Proxmox:          proxmox,
+		Kubernetes:       kubernetes,
+		cloneHistory:     newCloneHistory(),
+		templateDigests:  newTemplateDigests(),
+		joinSecretDigest: &joinSecretDigest{},
+		cloneLocks:       newKeyedLock(),
+	}
+}
+
+func (p *ProxmoxProvisioner) now() time.Time {
+	return clockOrSystem(p.clock).Now()
+}
+
+func (p *ProxmoxProvisioner) after(d time.Duration) <-chan time.Time {
+	return clockOrSystem(p.clock).After(d)
+}
+
+// How often the status of a started VM is checked
+const vmStatusInterval = time.Second * 2
+
+// The storage a kpNode for the scale event is cloned to, or an empty string if
+// it can't be determined.
+func (p *ProxmoxProvisioner) cloneStorage(scaleEvent *ScaleEvent) string {
+	nodeClass := p.config.NodeClass(scaleEvent.NodeClass)
+	storage, err := p.Proxmox.GetKpNodeTemplateStorage(
+		nodeClass.TemplateName,
+		p.config.KpLocalTemplateStorage,
+		scaleEvent.TargetHost.Node,
+		nodeClass.RootDisk,
+	)
+	if err != nil {
+		logger.DebugLog("Could not determine clone storage", "node", scaleEvent.NodeName, "error", err)
+		return ""
+	}
+
+	return storage
+}
+
+// Clones and starts the VM, each step bounded by the operation timeouts of the
+// storage it is cloned to.
+func (p *ProxmoxProvisioner) Create(ctx context.Context, scaleEvent *ScaleEvent) error {
+	storage := p.cloneStorage(scaleEvent)
+	timeouts := p.config.OperationTimeouts(storage)
+
+	if expected, ok := p.cloneHistory.expected(storage); ok {
+		ReportProgress(ctx, scaleEvent, ScaleEventCloning, fmt.Sprintf("cloning to %s usually takes %s", storage, expected.Round(time.Second)))
+	}
+
+	unlock, err := p.lockClone(ctx, scaleEvent, storage)
+	if err != nil {
+		return err
+	}
+
+	cctx, cancelCCtx := withTimeoutSeconds(ctx, timeouts.CloneSeconds)
+	defer cancelCCtx()
+
+	cloneStarted := p.now()
+	err = p.clone(cctx, scaleEvent, false)
+	unlock()
+	if err != nil {
+		if cctx.Err() != nil && ctx.Err() == nil {
+			return classifiedError(FailureCloneTimeout, fmt.Errorf("clone to %s exceeded %ds: %w", storage, timeouts.CloneSeconds, err))
+		}
+		return err
+	}
+
+	if config.Injected(p.config.FailureInjection.CloneFailure) {
+		return classifiedError(FailureCloneTimeout, fmt.Errorf("injected clone failure of %s", scaleEvent.NodeName))
+	}
+
+	cloneDuration := p.now().Sub(cloneStarted)
+	if p.cloneHistory.isSlow(storage, cloneDuration) {
+		expected, _ := p.cloneHistory.expected(storage)
+		logger.WarnLog(
+			fmt.Sprintf("Clone of %s was abnormally slow", scaleEvent.NodeName),
+			"storage", storage,
+			"duration", cloneDuration.Round(time.Second),
+			"expected", expected.Round(time.Second),
+		)
+	}
+	p.cloneHistory.record(storage, cloneDuration)
+
+	if timeouts.StartSeconds <= 0 {
+		return nil
+	}
+
+	sctx, cancelSCtx := withTimeoutSeconds(ctx, timeouts.StartSeconds)
+	defer cancelSCtx()
+
+	err = p.waitForRunning(sctx, scaleEvent.NodeName)
+	if err != nil && ctx.Err() == nil {
+		return classifiedError(FailureCloneTimeout, fmt.Errorf("%w within %ds", err, timeouts.StartSeconds))
+	}
+
+	return err
+}
+
+// Clones to the same storage on the same pHost are serialized to limit
+// contention, while clones to other pHosts or storage run concurrently. The
+// lock is held by each worker process for itself.
+func cloneLockKey(targetHost string, storage string) string {
+	return fmt.Sprintf("%s/%s", targetHost, storage)
+}
+
+// Blocks until the clone lock for the scale event's pHost and storage is
+// acquired, returning a function which releases it. It is released as soon
+// as the clone completes so the next clone need not wait for the VM to start.
+func (p *ProxmoxProvisioner) lockClone(ctx context.Context, scaleEvent *ScaleEvent, storage string) (func(), error) {
+	if p.cloneLocks == nil {
+		return func() {}, nil
+	}
+
+	unlock, err := p.cloneLocks.lock(ctx, cloneLockKey(scaleEvent.TargetHost.Node, storage))
+	if err != nil {
+		return nil, fmt.Errorf("timed out waiting to clone %s: %w", scaleEvent.NodeName, err)
+	}
+
+	return unlock, nil
+}
+
+// Waits for Proxmox to report the VM as running.
+func (p *ProxmoxProvisioner) waitForRunning(ctx context.Context, nodeName string) error {
+	for {
+		vm, err := p.Proxmox.GetKpNode(nodeName, p.config.KpNodeNameRegex)
+		if err == nil && vm.Status == "running" {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s was not running", nodeName)
+		case <-p.after(vmStatusInterval):
+		}
+	}
+}
+
+// Clones and configures the VM for a scale event, warm VMs are left stopped.
+func (p *ProxmoxProvisioner) clone(ctx context.Context, scaleEvent *ScaleEvent, warm bool) error {
+	nodeClass := p.config.NodeClass(scaleEvent.NodeClass)
+	kpNodeParams := p.kpNodeParams(nodeClass)
+
+	cicustom, err := p.writeSnippets(ctx, scaleEvent)
+	if err != nil {
+		return err
+	}
+
+	if cicustom != "" {
+		kpNodeParams["cicustom"] = cicustom
+	}
+
+	templateDigest := p.templateDigest(nodeClass.TemplateName, scaleEvent.TargetHost.Node)
+
+	okChan := make(chan bool)
+	defer close(okChan)
+
+	errChan := make(chan error)
+	defer close(errChan)
+
+	pctx, cancelPCtx := context.WithCancel(ctx)
+	defer cancelPCtx()
+
+	pctx = proxmox.WithVmIDCollisionReporter(pctx, func(vmID int) {
+		logger.WarnLog("VMID taken before clone, retrying with another", "node", scaleEvent.NodeName, "vmid", vmID)
+		ReportVmIDCollision(ctx, scaleEvent, vmID)
+	})
+
+	go p.Proxmox.NewKpNode(
+		pctx,
+		okChan,
+		errChan,
+		scaleEvent.NodeName,
+		scaleEvent.TargetHost.Node,
+		kpNodeParams,
+		proxmox.KpNodeMetadata{
+			ClusterName:    p.config.ClusterName,
+			NodeClass:      nodeClass.Name,
+			Instance:       p.config.InstanceID,
+			Created:        p.now(),
+			TemplateDigest: templateDigest,
+			Warm:           warm,
+			ExtraTags:      p.config.KpNodeParams.Tags,
+		},
+		proxmox.RootDisk{
+			Device: nodeClass.RootDisk,
+			Size:   nodeClass.DiskSize,
+		},
+		dataDisks(nodeClass),
+		proxmox.Firewall{
+			Enabled:        nodeClass.Firewall.Enabled,
+			SecurityGroups: nodeClass.Firewall.SecurityGroups,
+			PolicyIn:       nodeClass.Firewall.PolicyIn,
+			PolicyOut:      nodeClass.Firewall.PolicyOut,
+		},
+		p.config.KpNodeParams.ExcludeBackup(),
+		p.config.KpLocalTemplateStorage,
+		nodeClass.TemplateName,
+		p.config.KpJoinCommand,
+	)
+
+	return waitForNodeStart(pctx, cancelPCtx, scaleEvent, okChan, errChan)
+}
+
+// The digest of the template's configuration, recorded on kpNodes cloned from
+// it so that operators can tell exactly which template a kpNode came from.
+// Warns when the template has changed since a kpNode was last cloned from it,
+// as kpNodes of the node class may then differ. A digest that can't be read
+// doesn't prevent the clone.
+func (p *ProxmoxProvisioner) templateDigest(templateName string, targetNode string) string {
+	digest, err := p.Proxmox.GetKpNodeTemplateDigest(templateName, p.config.KpLocalTemplateStorage, targetNode)
+	if err != nil {
+		logger.WarnLog("Failed to read template digest", "template", templateName, "error", err)
+		return ""
+	}
+
+	if previous, changed := p.templateDigests.observe(templateName, digest); changed {
+		logger.WarnLog(
+			"Template changed since the last kpNode was cloned from it",
+			"template", templateName,
+			"previous", previous,
+			"digest", digest,
+		)
+	}
+
+	return digest
+}
+
+// The data disks created on kpNodes of the node class
+func dataDisks(nodeClass config.NodeClass) []proxmox.DataDisk {
+	dataDisks := []proxmox.DataDisk{}
+	for idx, dataDisk := range nodeClass.DataDisks {
+		dataDisks = append(dataDisks, proxmox.DataDisk{
+			Bus:     dataDisk.Bus,
+			Storage: dataDisk.Storage,
+			Size:    dataDisk.Size,
+			Serial:  dataDiskSerial(idx),
+		})
+	}
+
+	return dataDisks
+}
+
+// The Proxmox VM config applied to kpNodes of the node class
+func (p *ProxmoxProvisioner) kpNodeParams(nodeClass config.NodeClass) map[string]interface{} {
+	kpNodeParams := p.config.KpNodeParams.ProxmoxParams()
+	kpNodeParams["balloon"] = 0
+	kpNodeParams["cores"] = nodeClass.Cores
+	kpNodeParams["ipconfig0"] = "ip=dhcp"
+	kpNodeParams["memory"] = nodeClass.Memory
+
+	// SSH keys are not supported by cloudbase-init on windows templates
+	if !p.config.KpNodeDisableSsh && p.config.KpNodeOsType != "windows" {
+		kpNodeParams["sshkeys"] = strings.Replace(url.QueryEscape(p.config.SshKey), "+", "%20", 1)
+	}
+
+	// The balloon device is removed unless ballooning is enabled
+	if nodeClass.Balloon.Enabled {
+		kpNodeParams["balloon"] = nodeClass.Balloon.MinMemory
+		if nodeClass.Balloon.MinMemory == 0 {
+			kpNodeParams["balloon"] = nodeClass.Memory
+		}
+
+		if nodeClass.Balloon.Shares > 0 {
+			kpNodeParams["shares"] = nodeClass.Balloon.Shares
+		}
+	}
+
+	if nodeClass.Cpu.Type != "" {
+		kpNodeParams["cpu"] = nodeClass.Cpu.Type
+	}
+
+	// Proxmox configures the cores of each socket
+	if nodeClass.Cpu.Sockets > 0 {
+		kpNodeParams["sockets"] = nodeClass.Cpu.Sockets
+		kpNodeParams["cores"] = nodeClass.Cores / nodeClass.Cpu.Sockets
+	}
+
+	if nodeClass.Cpu.Numa {
+		kpNodeParams["numa"] = 1
+	}
+
+	if nodeClass.Cpu.Units > 0 {
+		kpNodeParams["cpuunits"] = nodeClass.Cpu.Units
+	}
+
+	if nodeClass.Cpu.Limit > 0 {
+		kpNodeParams["cpulimit"] = nodeClass.Cpu.Limit
+	}
+
+	return kpNodeParams
+}
+
+// Nodes are expected to join by themselves, eg via cloud-init, unless the
+// join command is executed via the qemu guest agent.
+func (p *ProxmoxProvisioner) WaitReady(ctx context.Context, scaleEvent *ScaleEvent) error {
+	if p.config.WaitSecondsForNetwork > 0 {
+		err := p.waitForNetwork(ctx, scaleEvent.NodeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if !p.config.KpQemuExecJoin {
+		return nil
+	}
+
+	okChan := make(chan bool)
+	defer close(okChan)
+
+	errChan := make(chan error)
+	defer close(errChan)
+
+	pctx, cancelPCtx := context.WithCancel(ctx)
+	defer cancelPCtx()
+
+	timeouts := p.config.OperationTimeouts(p.cloneStorage(scaleEvent))
+	actx, cancelACtx := withTimeoutSeconds(pctx, timeouts.AgentReadySeconds)
+	defer cancelACtx()
+
+	go p.Proxmox.CheckNodeReady(actx, okChan, errChan, scaleEvent.NodeName)
+
+	err := waitForNodeReady(actx, cancelACtx, scaleEvent, okChan, errChan)
+	if err != nil {
+		if actx.Err() != nil && ctx.Err() == nil {
+			return classifiedError(FailureJoinTimeout, fmt.Errorf("%w, the guest agent did not respond within %ds", err, timeouts.AgentReadySeconds))
+		}
+		return err
+	}
+
+	if p.config.KpNodeOsType == "windows" {
+		err = p.waitForWindowsSpecialize(pctx, scaleEvent.NodeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return p.joinByQemuExec(pctx, scaleEvent.NodeName)
+}
+
+// Waits for the guest agent to report that the kpNode has an IP address, so
+// that a kpNode which never gets connectivity, e.g. because of a wrong bridge
+// or VLAN or no DHCP lease, fails fast rather than after waitSecondsForJoin.
+func (p *ProxmoxProvisioner) waitForNetwork(ctx context.Context, nodeName string) error {
+	nctx, cancel := withTimeoutSeconds(ctx, p.config.WaitSecondsForNetwork)
+	defer cancel()
+
+	var lastErr error
+	for {
+		addresses, err := p.Proxmox.GetKpNodeAddresses(nodeName)
+		if err == nil && len(addresses) > 0 {
+			logger.DebugLog("kpNode has network connectivity", "node", nodeName, "addresses", addresses)
+			return nil
+		}
+		lastErr = err
+
+		select {
+		case <-nctx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			if lastErr != nil {
+				return classifiedError(FailureNoNetwork, fmt.Errorf("no network: %s did not report an IP address within %ds, the guest agent did not respond: %w", nodeName, p.config.WaitSecondsForNetwork, lastErr))
+			}
+
+			return classifiedError(FailureNoNetwork, fmt.Errorf("no network: %s did not get an IP address within %ds", nodeName, p.config.WaitSecondsForNetwork))
+		case <-p.after(vmStatusInterval):
+		}
+	}
+}
+
+// Reads the end of the cloud-init, or cloudbase-init on windows, output log
+// via the qemu guest agent. The agent must be running in the kpNode.
+func (p *ProxmoxProvisioner) ConsoleLog(ctx context.Context, nodeName string) (string, error) {
+	if p.config.KpNodeOsType == "talos" {
+		return "", fmt.Errorf("the console log of talos kpNodes cannot be read via the guest agent")
+	}
+
+	command := fmt.Sprintf("tail -n %d /var/log/cloud-init-output.log", consoleLogLines)
+	if p.config.KpNodeOsType == "windows" {
+		command = fmt.Sprintf(`Get-Content -Tail %d 'C:\Program Files\Cloudbase Solutions\Cloudbase-Init\log\cloudbase-init.log'`, consoleLogLines)
+	}
+
+	status, err := p.qemuExec(ctx, nodeName, p.shellCommand(command))
+	if err != nil {
+		return "", err
+	}
+
+	if status.ExitCode != 0 {
+		return "", fmt.Errorf("could not read the console log of %s: %s", nodeName, status.ErrData)
+	}
+
+	return status.OutData, nil
+}
+
+// Runs the patch command on a kpNode via the qemu guest agent, rebooting it
+// afterwards if patchReboot is set. The reboot is complete once the kpNode
+// reports a different boot ID.
+func (p *ProxmoxProvisioner) PatchKpNode(ctx context.Context, nodeName string) error {
+	bootID, err := p.bootID(ctx, nodeName)
+	if err != nil {
+		return err
+	}
+
+	status, err := p.qemuExec(ctx, nodeName, p.shellCommand(p.config.PatchCommand))
+	if err != nil {
+		return err
+	}
+
+	if status.ExitCode != 0 {
+		return fmt.Errorf("patch command exited with %d on %s: %s", status.ExitCode, nodeName, status.ErrData)
+	}
+
+	if !p.config.PatchReboot {
+		return nil
+	}
+
+	err = p.Proxmox.RebootKpNode(nodeName)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s to reboot", nodeName)
+		case <-p.after(time.Second * 5):
+		}
+
+		// The guest agent is unavailable while the kpNode reboots
+		rebootedID, err := p.bootID(ctx, nodeName)
+		if err == nil && rebootedID != bootID {
+			return nil
+		}
+	}
+}
+
+// Identifies the current boot of a kpNode.
+func (p *ProxmoxProvisioner) bootID(ctx context.Context, nodeName string) (string, error) {
+	command := "cat /proc/sys/kernel/random/boot_id"
+	if p.config.KpNodeOsType == "windows" {
+		command = "(Get-CimInstance Win32_OperatingSystem).LastBootUpTime.Ticks"
+	}
+
+	status, err := p.qemuExec(ctx, nodeName, p.shellCommand(command))
+	if err != nil {
+		return "", err
+	}
+
+	if status.ExitCode != 0 {
+		return "", fmt.Errorf("could not read the boot ID of %s: %s", nodeName, status.ErrData)
+	}
+
+	return strings.TrimSpace(status.OutData), nil
+}
+
+func (p *ProxmoxProvisioner) Destroy(ctx context.Context, nodeName string) error {
+	err := p.Proxmox.DeleteKpNode(nodeName, p.config.KpNodeNameRegex)
+	if err != nil {
+		return err
+	}
+
+	p.deleteSnippets(nodeName)
+	return nil
+}
+
+func waitForNodeStart(ctx context.Context, cancel context.CancelFunc, scaleEvent *ScaleEvent, ok chan (bool), errchan chan (error)) error {
+	select {
+	case <-ctx.Done():
+		cancel()
+		return fmt.Errorf("timed out waiting for %s to start", scaleEvent.NodeName)
+
+	case err := <-errchan:
+		return err
+
+	case <-ok:
+		return nil
+	}
+}
+
+func waitForNodeReady(ctx context.Context, cancel context.CancelFunc, scaleEvent *ScaleEvent, ok chan (bool), errchan chan (error)) error {
+	select {
+	case <-ctx.Done():
+		cancel()
+		return fmt.Errorf("timed out waiting for %s to be ready", scaleEvent.NodeName)
+
+	case err := <-errchan:
+		return err
+
+	case <-ok:
+		return nil
+	}
+}
+
+// Runs a command on a kpNode via the qemu guest agent and waits for it to exit.
+func (p *ProxmoxProvisioner) qemuExec(ctx context.Context, nodeName string, command []string) (proxmox.QemuExecStatus, error) {
+	pid, err := p.Proxmox.QemuExec(nodeName, command)
+	if err != nil {
+		return proxmox.QemuExecStatus{}, err
+	}
+
+	for {
+		status, err := p.Proxmox.GetQemuExecStatus(nodeName, pid)
+		if err != nil {
+			return status, err
+		}
+
+		if status.Exited == 1 {
+			return status, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return status, fmt.Errorf("timed out waiting for %v to exit on %s", command, nodeName)
+		case <-p.after(time.Second * 1):
+		}
+	}
+}
+
+// When kpJoinCommandTemplate is set the join command may reference the name
+// of the node being joined using go templating, eg "{{ .NodeName }}". A key
+// missing from the join secret fails the scale event rather than joining with
+// "<no value>".
+func (p *ProxmoxProvisioner) renderJoinCommand(nodeName string, joinSecret map[string]string) (string, error) {
+	if !p.config.KpJoinCommandTemplate {
+		return p.config.KpJoinCommand, nil
+	}
+
+	tmpl, err := template.New("joinCommand").Option("missingkey=error").Parse(p.config.KpJoinCommand)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse kpJoinCommand: %w", err)
+	}
+
+	templateValues := struct {
+		NodeName   string
+		JoinSecret map[string]string
+	}{
+		NodeName:   nodeName,
+		JoinSecret: joinSecret,
+	}
+
+	renderedCommand := new(bytes.Buffer)
+	err = tmpl.Execute(renderedCommand, templateValues)
+	if err != nil {
+		return "", fmt.Errorf("failed to render kpJoinCommand: %w", err)
+	}
+
+	return renderedCommand.String(), nil
+}
+
+func (p *ProxmoxProvisioner) shellCommand(command string) []string {
+	if p.config.KpNodeOsType == "windows" {
+		return []string{"powershell.exe", "-NoProfile", "-NonInteractive", "-Command", command}
+	}
+
+	return []string{"bash", "-c", command}
+}
+
+// Windows hostnames are truncated to 15 characters for NetBIOS compatibility
+func windowsHostname(nodeName string) string {
+	if len(nodeName) > 15 {
+		return nodeName[:15]
+	}
+
+	return nodeName
+}
+
+// The guest agent on a windows template is available before sysprep has
+// finished specializing the VM, during which it is rebooted. Once the hostname
+// set by cloudbase-init is reported it is safe to join the node.
+func (p *ProxmoxProvisioner) waitForWindowsSpecialize(ctx context.Context, nodeName string) error {
+	logger.InfoLog(fmt.Sprintf("Waiting for %s to finish specializing", nodeName))
+	expectedHostname := windowsHostname(nodeName)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for %s to finish specializing", nodeName)
+		default:
+			status, err := p.qemuExec(ctx, nodeName, []string{"hostname"})
+			if err == nil && strings.EqualFold(strings.TrimSpace(status.OutData), expectedHostname) {
+				return nil
+			}
+
+			<-p.after(time.Second * 5)
+		}
+	}
+}
+
+func (p *ProxmoxProvisioner) joinByQemuExec(ctx context.Context, nodeName string) error {
+	joinSecret, err := p.joinSecret(ctx)
+	if err != nil {
+		return err
+	}
+
+	joinCommand, err := p.renderJoinCommand(nodeName, joinSecret)
+	if err != nil {
+		return err
+	}
+
+	logger.InfoLog(fmt.Sprintf("Executing join command on %s", nodeName))
+	status, err := p.qemuExec(ctx, nodeName, p.shellCommand(joinCommand))
+	if err != nil {
+		return err
+	}
+
+	if status.ExitCode != 0 {
+		return fmt.Errorf("join command for %s failed:\n%s", nodeName, status.OutData)
+	} else {
+		logger.InfoLog(fmt.Sprintf("Join command for %s executed successfully", nodeName))
+		return nil
+	}
+}
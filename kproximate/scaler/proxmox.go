@@ -3,11 +3,16 @@ package scaler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"math"
-	"net/url"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"text/template"
 	"time"
 
@@ -15,135 +20,687 @@ import (
 	"github.com/lupinelab/kproximate/kubernetes"
 	"github.com/lupinelab/kproximate/logger"
 	"github.com/lupinelab/kproximate/proxmox"
-	"k8s.io/apimachinery/pkg/util/uuid"
+	apiv1 "k8s.io/api/core/v1"
 )
 
 type ProxmoxScaler struct {
-	config     config.KproximateConfig
-	Kubernetes kubernetes.Kubernetes
-	Proxmox    proxmox.Proxmox
+	config      config.KproximateConfig
+	Kubernetes  kubernetes.Kubernetes
+	Proxmox     proxmox.Proxmox
+	Provisioner Provisioner
+	// Evaluates scaling queries, nil unless prometheusUrl is configured
+	Metrics MetricsQuerier
+	// The system clock unless set by tests
+	clock Clock
+	// The config reloaded by ReloadConfig, see currentConfig
+	reloaded atomic.Pointer[config.KproximateConfig]
+	// Guards the state below, which is shared by the assessment loop and the
+	// status API, and serialises reloads
+	stateMu sync.Mutex
+	// Recorded by RequiredScaleEvents and AssessScaleDown
+	explanation Explanation
+	// When each hibernated kpNode was assigned to a scale event
+	resumeClaims map[string]time.Time
 }
 
-func NewProxmoxScaler(config config.KproximateConfig) (Scaler, error) {
-	kubernetes, err := kubernetes.NewKubernetesClient()
+// The options of the kubernetes client described by the config.
+func KubernetesClientOptions(config config.KproximateConfig) kubernetes.ClientOptions {
+	return kubernetes.ClientOptions{
+		Kubeconfig:     config.Kubeconfig,
+		Context:        config.KubeContext,
+		InCluster:      config.KubeInCluster,
+		QPS:            float32(config.KubeQps),
+		Burst:          config.KubeBurst,
+		RequestTimeout: time.Second * time.Duration(config.KubeRequestTimeoutSeconds),
+		Drain: kubernetes.DrainOptions{
+			GracePeriod:        time.Second * time.Duration(config.DrainGracePeriodSeconds),
+			ForceDeleteTimeout: time.Second * time.Duration(config.DrainForceDeleteSeconds),
+		},
+	}
+}
+
+// Scales using the kubernetes client, which the caller may share, see
+// KubernetesClientOptions.
+func NewProxmoxScaler(config config.KproximateConfig, kubernetes kubernetes.Kubernetes) (Scaler, error) {
+	proxmox, err := proxmox.NewProxmoxClient(config.PmUrl, config.PmAllowInsecure, config.PmCaBundle, config.PmProxyUrl, config.PmUserID, config.PmToken, config.PmPassword, config.InstanceID, config.PmDebug, time.Second*time.Duration(config.PmCacheSeconds))
 	if err != nil {
 		return nil, err
 	}
 
-	proxmox, err := proxmox.NewProxmoxClient(config.PmUrl, config.PmAllowInsecure, config.PmUserID, config.PmToken, config.PmPassword, config.PmDebug)
+	if config.FailureInjection.Enabled() {
+		logger.WarnLog("Failure injection is enabled, scaling events will fail at random", "failureInjection", config.FailureInjection)
+		proxmox.InjectErrors(config.FailureInjection.ProxmoxError)
+	}
+
+	scaler := &ProxmoxScaler{
+		config:     config,
+		Kubernetes: kubernetes,
+		Proxmox:    &proxmox,
+	}
+	scaler.Provisioner = NewProxmoxProvisioner(&scaler.config, scaler.Proxmox, scaler.Kubernetes)
+
+	err = scaler.validateTriggers()
 	if err != nil {
 		return nil, err
 	}
 
-	config.KpNodeNameRegex = *regexp.MustCompile(fmt.Sprintf(`^%s-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`, config.KpNodeNamePrefix))
+	if config.PrometheusUrl != "" {
+		scaler.Metrics, err = NewPrometheusQuerier(config.PrometheusUrl)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	config.KpNodeParams = map[string]interface{}{
-		"agent":     "enabled=1",
-		"balloon":   0,
-		"cores":     config.KpNodeCores,
-		"ipconfig0": "ip=dhcp",
-		"memory":    config.KpNodeMemory,
-		"onboot":    1,
+	return scaler, err
+}
+
+// The config in effect. ReloadConfig replaces it with an updated copy rather
+// than modifying it, so that it can be read while it is being reloaded.
+func (scaler *ProxmoxScaler) currentConfig() *config.KproximateConfig {
+	if reloaded := scaler.reloaded.Load(); reloaded != nil {
+		return reloaded
 	}
 
-	if !config.KpNodeDisableSsh {
-		config.KpNodeParams["sshkeys"] = strings.Replace(url.QueryEscape(config.SshKey), "+", "%20", 1)
+	return &scaler.config
+}
+
+func (scaler *ProxmoxScaler) now() time.Time {
+	return clockOrSystem(scaler.clock).Now()
+}
+
+func (scaler *ProxmoxScaler) newKpNodeName() string {
+	return scaler.currentConfig().KpNodeNaming().NewName()
+}
+
+// The label used to record which node class a kpNode belongs to
+const nodeClassLabel = "kproximate.io/node-class"
+
+// The label used to record which kproximate instance manages a kpNode
+const instanceLabel = "kproximate.io/instance"
+
+// Counts the kpNodes of each node class, kpNodes without a node class label
+// are counted as the first node class.
+func (scaler *ProxmoxScaler) numKpNodesByClass(ctx context.Context) (map[string]int, error) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
 	}
 
-	scaler := ProxmoxScaler{
-		config:     config,
-		Kubernetes: &kubernetes,
-		Proxmox:    &proxmox,
+	numKpNodes := map[string]int{}
+	for _, kpNode := range kpNodes {
+		nodeClass := scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel])
+		numKpNodes[nodeClass.Name]++
 	}
 
-	return &scaler, err
+	return numKpNodes, nil
 }
 
-func (scaler *ProxmoxScaler) newKpNodeName() string {
-	return fmt.Sprintf("%s-%s", scaler.config.KpNodeNamePrefix, uuid.NewUUID())
+// The number of in-progress scale events of each node class. Those whose node
+// class is unknown, eg published by another tool, are assumed to be of the
+// default node class.
+func currentEventsOfClasses(defaultNodeClass config.NodeClass, numCurrentEvents int, currentEventsByClass map[string]int) map[string]int {
+	currentEvents := map[string]int{}
+	unknown := numCurrentEvents
+	for nodeClass, numEvents := range currentEventsByClass {
+		numEvents = min(numEvents, unknown)
+		if numEvents <= 0 {
+			continue
+		}
+
+		currentEvents[nodeClass] += numEvents
+		unknown -= numEvents
+	}
+
+	if unknown > 0 {
+		currentEvents[defaultNodeClass.Name] += unknown
+	}
+
+	return currentEvents
 }
 
-func (scaler *ProxmoxScaler) requiredScaleEvents(requiredResources kubernetes.UnschedulableResources, numCurrentEvents int) ([]*ScaleEvent, error) {
+// Selects the highest priority node class which has not reached its maxNodes.
+func selectNodeClass(nodeClasses []config.NodeClass, numKpNodes map[string]int) (config.NodeClass, bool) {
+	eligible := eligibleNodeClasses(nodeClasses, numKpNodes)
+	if len(eligible) == 0 {
+		return config.NodeClass{}, false
+	}
+
+	return eligible[0], true
+}
+
+func (scaler *ProxmoxScaler) requiredScaleEvents(ctx context.Context, requiredResources kubernetes.UnschedulableResources, numCurrentEvents int, currentEventsByClass map[string]int) ([]*ScaleEvent, error) {
 	requiredScaleEvents := []*ScaleEvent{}
-	var numCpuNodesRequired int
-	var numMemoryNodesRequired int
+	nodeClasses, err := scaler.autoscaledNodeClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodeClasses) == 0 {
+		scaler.explainScaleUp(ScaleUpExplanation{
+			ScaleEvents: []ScaleEventExplanation{},
+			Reasons:     []string{"All node classes are managed by node pools"},
+		})
+		return requiredScaleEvents, nil
+	}
+
+	numKpNodes, err := scaler.numKpNodesByClass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// In-progress scale events count toward the maxNodes of their node class
+	// so that a burst of assessments can't exceed it
+	currentEvents := currentEventsOfClasses(nodeClasses[0], numCurrentEvents, currentEventsByClass)
+	for nodeClass, numEvents := range currentEvents {
+		numKpNodes[nodeClass] += numEvents
+	}
+
+	// Without the pendingPods trigger only the other triggers scale up
+	assessPendingPods := scaler.triggerEnabled(pendingPodsTrigger)
+	if !assessPendingPods {
+		requiredResources = kubernetes.UnschedulableResources{}
+	}
+
+	// The most-pods expander places individual pending pods, which are also
+	// listed when explaining the decision
+	var pendingPods []kubernetes.UnschedulablePod
+	if !requiredResources.IsZero() {
+		pendingPods, err = scaler.Kubernetes.GetUnschedulablePods(ctx, scaler.maxKpNodeCores(), scaler.currentConfig().KpNodeNameRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Pods which no node class could schedule, because of their taints,
+	// selectors or size, are not scaled up for
+	allPendingPods := pendingPods
+	pendingPods, misfits := scaler.forecastPods(nodeClasses, pendingPods)
+	// Pending pods are consumed as kpNodes are chosen for them
+	schedulablePods := pendingPods
+	if len(misfits) > 0 {
+		requiredResources = withoutMisfits(requiredResources, misfits)
+		if len(pendingPods) == 0 {
+			requiredResources = kubernetes.UnschedulableResources{}
+		}
+	}
+
+	// The expected cpu and memory resources, and pods that can be scheduled,
+	// after in-progress scaling events complete
+	expectedCpu := 0.0
+	expectedMemory := int64(0)
+	expectedPods := 0
+	for nodeClassName, numEvents := range currentEvents {
+		nodeClass := scaler.currentConfig().NodeClass(nodeClassName)
+		expectedCpu += scaler.schedulableCpu(nodeClass) * float64(numEvents)
+		expectedMemory += scaler.schedulableMemory(nodeClass) * int64(numEvents)
+		expectedPods += nodeClassMaxPods(nodeClass) * numEvents
+	}
+
+	// The expected amount of cpu resources still required after in-progress scaling events complete
+	unaccountedCpu := requiredResources.Cpu - expectedCpu
+
+	// The expected amount of memory resources still required after in-progress scaling events complete
+	unaccountedMemory := requiredResources.Memory - expectedMemory
+
+	// Extended resources are only provided by some node classes, so what
+	// in-progress scale events will provide is unknown
+	unaccountedExtended := map[string]int64{}
+	if numCurrentEvents == 0 {
+		maps.Copy(unaccountedExtended, requiredResources.Extended)
+	}
 
-	if requiredResources.Cpu != 0 {
-		// The expected cpu resources after in-progress scaling events complete
-		expectedCpu := float64(scaler.config.KpNodeCores) * float64(numCurrentEvents)
-		// The expected amount of cpu resources still required after in-progress scaling events complete
-		unaccountedCpu := requiredResources.Cpu - expectedCpu
-		// The least amount of nodes that will satisfy the unaccountedMemory
-		numCpuNodesRequired = int(math.Ceil(unaccountedCpu / float64(scaler.config.KpNodeCores)))
+	// The pending pods still unaccounted for, pods are limited by each
+	// kpNode's maxPods as well as its resources
+	unaccountedPods := len(pendingPods) - expectedPods
+
+	explanation := ScaleUpExplanation{
+		UnschedulablePods:     allPendingPods,
+		UnschedulableCpu:      requiredResources.Cpu,
+		UnschedulableMemory:   requiredResources.Memory,
+		UnschedulableExtended: requiredResources.Extended,
+		InProgressScaleEvents: numCurrentEvents,
+		Gangs:                 pendingGangs(pendingPods),
+		ExpectedCpu:           expectedCpu,
+		ExpectedMemory:        expectedMemory,
+		UnaccountedCpu:        unaccountedCpu,
+		UnaccountedMemory:     unaccountedMemory,
+		ScaleEvents:           []ScaleEventExplanation{},
 	}
+	defer func() {
+		scaler.explainScaleUp(explanation)
+	}()
 
-	if requiredResources.Memory != 0 {
-		// Bit shift mebibytes to bytes
-		kpNodeMemoryBytes := scaler.config.KpNodeMemory << 20
-		// The expected memory resources after in-progress scaling events complete
-		expectedMemory := int64(kpNodeMemoryBytes) * int64(numCurrentEvents)
-		// The expected amount of memory resources still required after in-progress scaling events complete
-		unaccountedMemory := requiredResources.Memory - expectedMemory
-		// The least amount of nodes that will satisfy the unaccountedMemory
-		numMemoryNodesRequired = int(math.Ceil(float64(unaccountedMemory) / float64(kpNodeMemoryBytes)))
+	if scaler.currentConfig().Bootstrap {
+		bootstrapScaleEvents, err := scaler.bootstrapScaleEvents(ctx, nodeClasses, numKpNodes, numCurrentEvents, &explanation)
+		if err != nil {
+			return nil, err
+		}
+
+		if explanation.Bootstrapping {
+			scaler.prioritizeScaleEvents(bootstrapScaleEvents, pendingPods)
+			return bootstrapScaleEvents, nil
+		}
 	}
 
-	// The largest of the above two node requirements
-	numNodesRequired := int(math.Max(float64(numCpuNodesRequired), float64(numMemoryNodesRequired)))
+	for _, pod := range misfits {
+		logger.DebugLog(fmt.Sprintf("Pod %s/%s would not fit any node class", pod.Namespace, pod.Name), "reason", pod.Reason)
+		explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("Pod %s/%s would not fit any node class (%s)", pod.Namespace, pod.Name, pod.Reason))
+	}
+
+	// Placeholder pods are pending once preempted by workloads, scaling up
+	// for them restores the spare capacity they reserve
+	preempted := 0
+	for _, pod := range pendingPods {
+		if kubernetes.IsOverprovisioningPod(scaler.currentConfig().PodNamespace, pod) {
+			preempted++
+		}
+	}
+	if preempted > 0 {
+		explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("%d overprovisioning pods were preempted, scaling up to restore spare capacity", preempted))
+	}
+
+	if numCurrentEvents > 0 && len(requiredResources.Extended) > 0 {
+		explanation.Reasons = append(explanation.Reasons, "Extended resources are only assessed when no scale events are in progress")
+	}
+
+	// Whether node class limits stopped the pending pods being scaled up for
+	limited := false
+
+	// Routed pods are only satisfied by kpNodes of their node classes, so the
+	// capacity of other node classes doesn't account for them. In-progress
+	// scale events are assumed to be for the pods they were routed to.
+	routing := len(scaler.currentConfig().RoutingRules) > 0 && numCurrentEvents == 0
+
+	// Add nodes until the unaccounted cpu, memory and extended resources are
+	// satisfied, using the expander to choose from the node classes that have
+	// not reached their maxNodes for each
+	for (requiredResources.Cpu != 0 && unaccountedCpu > 0) || (requiredResources.Memory != 0 && unaccountedMemory > 0) || len(unaccountedExtended) > 0 || unaccountedPods > 0 || (routing && len(pendingPods) > 0) {
+		candidates := eligibleNodeClasses(nodeClasses, numKpNodes)
+		if len(candidates) == 0 {
+			logger.DebugLog("All node classes have reached maxNodes")
+			explanation.Reasons = append(explanation.Reasons, "All node classes have reached maxNodes")
+			limited = true
+			break
+		}
+
+		reason := fmt.Sprintf(
+			"%.2f cpu and %d bytes of memory unaccounted for, node class selected by the %s expander",
+			max(unaccountedCpu, 0),
+			max(unaccountedMemory, 0),
+			scaler.currentConfig().Expander,
+		)
+
+		// Only node classes providing an extended resource can satisfy the
+		// pods waiting for it
+		if extended, ok := nextExtendedResource(unaccountedExtended); ok {
+			candidates = providingNodeClasses(candidates, extended)
+			if len(candidates) == 0 {
+				explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("No node class below its maxNodes provides %s", extended))
+				delete(unaccountedExtended, extended)
+				continue
+			}
+
+			reason = fmt.Sprintf(
+				"%d %s unaccounted for, node class selected from those providing it by the %s expander",
+				unaccountedExtended[extended],
+				extended,
+				scaler.currentConfig().Expander,
+			)
+		}
+
+		// Only node classes which could schedule some of the pending pods
+		// would unblock them
+		if len(pendingPods) > 0 {
+			candidates = scaler.fittingNodeClasses(candidates, pendingPods)
+			if len(candidates) == 0 {
+				explanation.Reasons = append(explanation.Reasons, "No node class below its maxNodes could schedule the pending pods")
+				limited = true
+				break
+			}
+		}
 
-	for kpNode := 1; kpNode <= numNodesRequired; kpNode++ {
-		newName := scaler.newKpNodeName()
+		var nodeClass config.NodeClass
+		nodeClass, pendingPods = scaler.expand(candidates, unaccountedCpu, unaccountedMemory, pendingPods)
+
+		if nodeClass.Cores <= 0 && nodeClass.Memory <= 0 {
+			return nil, fmt.Errorf("node class %s has no cpu or memory configured", nodeClass.Name)
+		}
 
 		scaleEvent := ScaleEvent{
-			ScaleType: 1,
-			NodeName:  newName,
+			ScaleType:   1,
+			NodeName:    scaler.newKpNodeName(),
+			NodeClass:   nodeClass.Name,
+			Cancellable: true,
 		}
 
 		requiredScaleEvents = append(requiredScaleEvents, &scaleEvent)
 		logger.DebugLog("Generated scale event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+		explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+			NodeName:  scaleEvent.NodeName,
+			NodeClass: nodeClass.Name,
+			Reason:    reason,
+		})
+
+		numKpNodes[nodeClass.Name]++
+		unaccountedPods -= nodeClassMaxPods(nodeClass)
+		unaccountedCpu -= scaler.schedulableCpu(nodeClass)
+		unaccountedMemory -= scaler.schedulableMemory(nodeClass)
+		for extended, quantity := range nodeClassExtendedResources(nodeClass) {
+			if _, ok := unaccountedExtended[extended]; !ok {
+				continue
+			}
+
+			unaccountedExtended[extended] -= quantity
+			if unaccountedExtended[extended] <= 0 {
+				delete(unaccountedExtended, extended)
+			}
+		}
 	}
 
-	// If there are no worker nodes then pods can fail to schedule due to a control-plane taint, trigger a scaling event
-	if len(requiredScaleEvents) == 0 && numCurrentEvents == 0 {
-		schedulingFailed, err := scaler.Kubernetes.IsUnschedulableDueToControlPlaneTaint()
+	// Scaling up for part of a gang only lets that part schedule to wait on
+	// the rest, so nothing is scaled up for until there is room for all of it
+	if limited && len(explanation.Gangs) > 0 && len(requiredScaleEvents) > 0 {
+		explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("Holding back %d scale events, node class limits leave too little room for the whole of gangs %s", len(requiredScaleEvents), strings.Join(explanation.Gangs, ", ")))
+		requiredScaleEvents = []*ScaleEvent{}
+		explanation.ScaleEvents = []ScaleEventExplanation{}
+	}
+
+	if !assessPendingPods {
+		explanation.Reasons = append(explanation.Reasons, "Pending pods are not assessed as the pendingPods trigger is disabled")
+	} else if numCurrentEvents == 0 {
+		topologyScaleEvents, err := scaler.volumeTopologyScaleEvents(ctx, nodeClasses, numKpNodes, requiredScaleEvents)
+		if err != nil {
+			return nil, err
+		}
+
+		requiredScaleEvents = append(requiredScaleEvents, topologyScaleEvents...)
+		for _, scaleEvent := range topologyScaleEvents {
+			explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+				NodeName:  scaleEvent.NodeName,
+				NodeClass: scaleEvent.NodeClass,
+				Reason:    "Pending pods' volumes are restricted to topology no kpNode has",
+			})
+		}
+	} else {
+		explanation.Reasons = append(explanation.Reasons, "Volume topology is only assessed when no scale events are in progress")
+	}
+
+	if numCurrentEvents > 0 && !requiredResources.IsZero() && explanation.UnaccountedCpu <= 0 && explanation.UnaccountedMemory <= 0 {
+		explanation.Reasons = append(explanation.Reasons, "In-progress scale events are expected to provide the unschedulable resources")
+	}
+
+	// Without bootstrap the first workers of a cluster are only provisioned
+	// once pods fail to schedule on its control-plane nodes
+	if len(requiredScaleEvents) == 0 && numCurrentEvents == 0 && !scaler.currentConfig().Bootstrap && assessPendingPods {
+		schedulingFailed, err := scaler.Kubernetes.IsUnschedulableDueToControlPlaneTaint(ctx)
 		if err != nil {
 			return nil, err
 		}
 
-		if schedulingFailed {
+		nodeClass, ok := selectNodeClass(nodeClasses, numKpNodes)
+
+		if schedulingFailed && ok {
 			newName := scaler.newKpNodeName()
 			scaleEvent := ScaleEvent{
-				ScaleType: 1,
-				NodeName:  newName,
+				ScaleType:   1,
+				NodeName:    newName,
+				NodeClass:   nodeClass.Name,
+				Cancellable: true,
 			}
 
 			requiredScaleEvents = append(requiredScaleEvents, &scaleEvent)
 			logger.DebugLog("Generated scale event due to control=plane taint", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+			explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+				NodeName:  scaleEvent.NodeName,
+				NodeClass: nodeClass.Name,
+				Reason:    "Pods failed to schedule due to the control-plane taint, there are no worker nodes",
+			})
 		}
 	}
 
+	if len(requiredScaleEvents) == 0 && numCurrentEvents == 0 {
+		requiredScaleEvents = append(requiredScaleEvents, scaler.triggerScaleEvents(ctx, nodeClasses, numKpNodes, &explanation)...)
+	}
+
+	scaler.prioritizeScaleEvents(requiredScaleEvents, schedulablePods)
+
 	return requiredScaleEvents, nil
 }
 
-func (scaler *ProxmoxScaler) RequiredScaleEvents(allScaleEvents int) ([]*ScaleEvent, error) {
-	unschedulableResources, err := scaler.Kubernetes.GetUnschedulableResources(int64(scaler.config.KpNodeCores), scaler.config.KpNodeNameRegex)
+const (
+	zoneLabel   = "topology.kubernetes.io/zone"
+	regionLabel = "topology.kubernetes.io/region"
+)
+
+// Returns the well known topology labels of a kpNode on the pHost, the zone
+// is the pHost and the region the kubernetes cluster.
+func (scaler *ProxmoxScaler) topologyLabels(targetHost string) map[string]string {
+	labels := map[string]string{}
+	if scaler.currentConfig().KpNodeDisableTopologyLabels {
+		return labels
+	}
+
+	if targetHost != "" {
+		labels[zoneLabel] = targetHost
+	}
+
+	if scaler.currentConfig().ClusterName != "" {
+		labels[regionLabel] = scaler.currentConfig().ClusterName
+	}
+
+	return labels
+}
+
+// Returns the labels kpNodes of the node class are known to have before they
+// are provisioned.
+func (scaler *ProxmoxScaler) nodeClassLabels(nodeClass config.NodeClass) map[string]string {
+	labels := scaler.topologyLabels(nodeClass.TargetHost)
+	maps.Copy(labels, nodeClass.Labels)
+	return labels
+}
+
+// Whether nodes with the labels would satisfy the volume topology
+func matchesVolumeTopology(labels map[string]string, topology kubernetes.VolumeTopology) bool {
+	for key, values := range topology {
+		value, ok := labels[key]
+		if !ok || !slices.Contains(values, value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Generates scale events for pods that cannot be scheduled because their
+// volumes are restricted to a topology no kpNode is in, using the first node
+// class whose labels match. Conflicts already covered by a scale event are
+// skipped.
+func (scaler *ProxmoxScaler) volumeTopologyScaleEvents(ctx context.Context, nodeClasses []config.NodeClass, numKpNodes map[string]int, requiredScaleEvents []*ScaleEvent) ([]*ScaleEvent, error) {
+	conflicts, err := scaler.Kubernetes.GetVolumeTopologyConflicts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	scaleEvents := []*ScaleEvent{}
+
+CONFLICTS:
+	for _, topology := range conflicts {
+		for _, scaleEvent := range slices.Concat(requiredScaleEvents, scaleEvents) {
+			if matchesVolumeTopology(scaler.nodeClassLabels(scaler.currentConfig().NodeClass(scaleEvent.NodeClass)), topology) {
+				continue CONFLICTS
+			}
+		}
+
+		matched := false
+		for _, nodeClass := range nodeClasses {
+			if !matchesVolumeTopology(scaler.nodeClassLabels(nodeClass), topology) {
+				continue
+			}
+
+			matched = true
+			if nodeClass.MaxNodes != 0 && numKpNodes[nodeClass.Name] >= nodeClass.MaxNodes {
+				continue
+			}
+
+			scaleEvent := ScaleEvent{
+				ScaleType:   1,
+				NodeName:    scaler.newKpNodeName(),
+				NodeClass:   nodeClass.Name,
+				Cancellable: true,
+			}
+
+			scaleEvents = append(scaleEvents, &scaleEvent)
+			logger.DebugLog("Generated scale event due to volume topology", "scaleEvent", fmt.Sprintf("%+v", scaleEvent), "topology", fmt.Sprintf("%v", topology))
+
+			numKpNodes[nodeClass.Name]++
+			continue CONFLICTS
+		}
+
+		if !matched {
+			logger.DebugLog("No node class matches volume topology", "topology", fmt.Sprintf("%v", topology))
+		}
+	}
+
+	return scaleEvents, nil
+}
+
+// The cpu a kpNode of the node class is assumed to provide to the scheduler
+// once the cpu overcommit ratio is applied
+func (scaler *ProxmoxScaler) schedulableCpu(nodeClass config.NodeClass) float64 {
+	return SchedulableCpu(nodeClass, scaler.currentConfig().CpuOvercommitRatio)
+}
+
+// The memory in bytes a kpNode of the node class is assumed to provide to the
+// scheduler once the memory overcommit ratio is applied
+func (scaler *ProxmoxScaler) schedulableMemory(nodeClass config.NodeClass) int64 {
+	return SchedulableMemory(nodeClass, scaler.currentConfig().MemoryOvercommitRatio)
+}
+
+// The cpu and memory the kpNode can allocate to pods according to its status,
+// which reflects its node class and any resources reserved for the system.
+// The capacity of its node class is assumed until the kpNode reports its own.
+func (scaler *ProxmoxScaler) kpNodeAllocatable(kpNode apiv1.Node) (float64, int64) {
+	nodeClass := scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel])
+
+	cpu := kpNode.Status.Allocatable.Cpu().AsApproximateFloat64()
+	if cpu == 0 {
+		cpu = scaler.schedulableCpu(nodeClass)
+	}
+
+	memory := kpNode.Status.Allocatable.Memory().Value()
+	if memory == 0 {
+		memory = scaler.schedulableMemory(nodeClass)
+	}
+
+	return cpu, memory
+}
+
+// Pods requesting more cpu than the largest node class can never be satisfied
+func (scaler *ProxmoxScaler) maxKpNodeCores() int64 {
+	maxKpNodeCores := 0.0
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		maxKpNodeCores = max(maxKpNodeCores, scaler.schedulableCpu(nodeClass))
+	}
+
+	return int64(maxKpNodeCores)
+}
+
+func (scaler *ProxmoxScaler) GetUnschedulableResources(ctx context.Context) (kubernetes.UnschedulableResources, error) {
+	return scaler.Kubernetes.GetUnschedulableResources(ctx, scaler.maxKpNodeCores(), scaler.currentConfig().KpNodeNameRegex)
+}
+
+// allScaleEvents is the number of in-progress scale up events, of which those
+// whose node class is known are counted by node class in scaleEventsByClass.
+func (scaler *ProxmoxScaler) RequiredScaleEvents(ctx context.Context, allScaleEvents int, scaleEventsByClass map[string]int) ([]*ScaleEvent, error) {
+	unschedulableResources, err := scaler.Kubernetes.GetUnschedulableResources(ctx, scaler.maxKpNodeCores(), scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
 		logger.ErrorLog("Failed to get unschedulable resources:", "error", err)
 	}
 
-	if unschedulableResources != (kubernetes.UnschedulableResources{}) {
+	if !unschedulableResources.IsZero() {
 		logger.DebugLog("Found unschedulable resources", "resources", fmt.Sprintf("%+v", unschedulableResources))
 	}
 
-	return scaler.requiredScaleEvents(unschedulableResources, allScaleEvents)
+	scaleEvents, err := scaler.requiredScaleEvents(ctx, unschedulableResources, allScaleEvents, scaleEventsByClass)
+	if err != nil {
+		return nil, err
+	}
+
+	scaleEvents = interleaveNodeClasses(scaleEvents)
+	orderByPriority(scaleEvents)
+	scaler.assignHibernatedKpNodes(scaleEvents)
+
+	return scaleEvents, nil
+}
+
+// Orders scale events round-robin across their node classes, so that a burst
+// of one class does not hold back the others when the events are queued or
+// limited by maxKpNodes. The order within each node class is kept.
+func interleaveNodeClasses(scaleEvents []*ScaleEvent) []*ScaleEvent {
+	nodeClasses := []string{}
+	byNodeClass := map[string][]*ScaleEvent{}
+	for _, scaleEvent := range scaleEvents {
+		if _, ok := byNodeClass[scaleEvent.NodeClass]; !ok {
+			nodeClasses = append(nodeClasses, scaleEvent.NodeClass)
+		}
+		byNodeClass[scaleEvent.NodeClass] = append(byNodeClass[scaleEvent.NodeClass], scaleEvent)
+	}
+
+	interleaved := make([]*ScaleEvent, 0, len(scaleEvents))
+	for len(interleaved) < len(scaleEvents) {
+		for _, nodeClass := range nodeClasses {
+			if len(byNodeClass[nodeClass]) > 0 {
+				interleaved = append(interleaved, byNodeClass[nodeClass][0])
+				byNodeClass[nodeClass] = byNodeClass[nodeClass][1:]
+			}
+		}
+	}
+
+	return interleaved
 }
 
-func selectTargetHost(hosts []proxmox.HostInformation, kpNodes []proxmox.VmInformation, scaleEvents []*ScaleEvent) proxmox.HostInformation {
+// Whether any pods are still waiting for resources. Once they have all been
+// scheduled, eg because capacity was freed elsewhere, queued scale up events
+// are no longer needed.
+func (scaler *ProxmoxScaler) HasUnschedulableResources(ctx context.Context) (bool, error) {
+	unschedulableResources, err := scaler.Kubernetes.GetUnschedulableResources(ctx, scaler.maxKpNodeCores(), scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return false, err
+	}
+
+	if !unschedulableResources.IsZero() {
+		return true, nil
+	}
+
+	conflicts, err := scaler.Kubernetes.GetVolumeTopologyConflicts(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if len(conflicts) > 0 {
+		return true, nil
+	}
+
+	return scaler.Kubernetes.IsUnschedulableDueToControlPlaneTaint(ctx)
+}
+
+// The resources already assigned to a pHost by scaleEvents earlier in the
+// same batch, which are not yet reflected in the pHost's reported usage.
+type hostAllocation struct {
+	Cores  int
+	Memory int64
+}
+
+// Returns the first of the hosts without a kpNode or a scale event placed
+// earlier in the batch, so kpNodes are spread across pHosts. Otherwise the
+// host with the most available memory among those with the highest weight is
+// returned.
+func selectTargetHost(hosts []proxmox.HostInformation, kpNodes []proxmox.VmInformation, placed []proxmox.HostInformation, allocations map[string]hostAllocation, weight func(host string) int) proxmox.HostInformation {
 skipHost:
 	for _, host := range hosts {
 		// Check for a scaleEvent targeting the pHost
-		for _, scaleEvent := range scaleEvents {
-			if scaleEvent.TargetHost.Node == host.Node {
+		for _, placedHost := range placed {
+			if placedHost.Node == host.Node {
 				continue skipHost
 			}
 		}
@@ -158,80 +715,155 @@ skipHost:
 		return host
 	}
 
-	return selectMaxAvailableMemHost(hosts)
+	topWeight := weight(hosts[0].Node)
+	for _, host := range hosts {
+		topWeight = max(topWeight, weight(host.Node))
+	}
+
+	return selectMaxAvailableMemHost(slices.DeleteFunc(slices.Clone(hosts), func(host proxmox.HostInformation) bool {
+		return weight(host.Node) < topWeight
+	}), allocations)
 }
 
-func selectMaxAvailableMemHost(hosts []proxmox.HostInformation) proxmox.HostInformation {
-	selectedHostHost := hosts[0]
+func availableMem(host proxmox.HostInformation, allocations map[string]hostAllocation) int64 {
+	return host.Maxmem - host.Mem - allocations[host.Node].Memory
+}
+
+func availableCores(host proxmox.HostInformation, allocations map[string]hostAllocation) float64 {
+	return float64(host.Maxcpu)*(1-host.Cpu) - float64(allocations[host.Node].Cores)
+}
+
+func selectMaxAvailableMemHost(hosts []proxmox.HostInformation, allocations map[string]hostAllocation) proxmox.HostInformation {
+	selectedHost := hosts[0]
 	for _, host := range hosts {
-		if (host.Maxmem - host.Mem) > (selectedHostHost.Maxmem - selectedHostHost.Mem) {
-			selectedHostHost = host
+		hostMem := availableMem(host, allocations)
+		selectedHostMem := availableMem(selectedHost, allocations)
+
+		if hostMem > selectedHostMem {
+			selectedHost = host
+			continue
+		}
+
+		// Break ties on memory using the remaining cpu capacity
+		if hostMem == selectedHostMem && availableCores(host, allocations) > availableCores(selectedHost, allocations) {
+			selectedHost = host
 		}
 	}
 
-	return selectedHostHost
+	return selectedHost
 }
 
-func (scaler *ProxmoxScaler) SelectTargetHosts(scaleEvents []*ScaleEvent) error {
+// Returned when no pHost can take a scale event
+var errUnplaceable = errors.New("scale event cannot be placed")
+
+// Places each of the scaleEvents, in order, on the pHost chosen by
+// selectTargetHost from the online pHosts of its node class with capacity for
+// it, accounting for the scaleEvents placed before it. Stops at the first
+// scale event which cannot be placed, returning the pHosts of those placed
+// along with an errUnplaceable.
+func (scaler *ProxmoxScaler) placeScaleEvents(scaleEvents []*ScaleEvent) ([]proxmox.HostInformation, error) {
 	hosts, err := scaler.Proxmox.GetClusterStats()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	hosts = scaler.excludeDrainingHosts(hosts)
 
-	kpNodes, err := scaler.Proxmox.GetRunningKpNodes(scaler.config.KpNodeNameRegex)
+	kpNodes, err := scaler.Proxmox.GetRunningKpNodes(scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	// Keep a running tally of the resources assigned to each pHost in this batch
+	// so that simultaneous scaleEvents do not all target the same pHost.
+	allocations := map[string]hostAllocation{}
+	placed := []proxmox.HostInformation{}
+
 	for _, scaleEvent := range scaleEvents {
-		scaleEvent.TargetHost = selectTargetHost(hosts, kpNodes, scaleEvents)
-		logger.DebugLog(fmt.Sprintf("Selected target host %s for %s", scaleEvent.TargetHost.Node, scaleEvent.NodeName))
+		nodeClass := scaler.currentConfig().NodeClass(scaleEvent.NodeClass)
+
+		candidateHosts, err := nodeClassHosts(hosts, nodeClass)
+		if err != nil {
+			return placed, fmt.Errorf("%w: %w", errUnplaceable, err)
+		}
+
+		candidateHosts = slices.DeleteFunc(slices.Clone(candidateHosts), func(host proxmox.HostInformation) bool {
+			return !hostCanFit(host, nodeClass, allocations)
+		})
+		if len(candidateHosts) == 0 {
+			return placed, fmt.Errorf("%w: no online pHost has capacity for a kpNode of node class %s", errUnplaceable, nodeClass.Name)
+		}
+
+		preferredHosts := scaler.preferredHosts(candidateHosts, nodeClass, allocations)
+		targetHost := selectTargetHost(preferredHosts, kpNodes, placed, allocations, scaler.hostWeight)
+
+		allocation := allocations[targetHost.Node]
+		allocation.Cores += nodeClass.Cores
+		allocation.Memory += int64(nodeClass.Memory << 20)
+		allocations[targetHost.Node] = allocation
+
+		placed = append(placed, targetHost)
 	}
 
-	return nil
+	return placed, nil
 }
 
-func waitForNodeStart(ctx context.Context, cancel context.CancelFunc, scaleEvent *ScaleEvent, ok chan (bool), errchan chan (error)) error {
-	select {
-	case <-ctx.Done():
-		cancel()
-		return fmt.Errorf("timed out waiting for %s to start", scaleEvent.NodeName)
-
-	case err := <-errchan:
-		return err
+// Sets the TargetHost of each of the scaleEvents, see placeScaleEvents. An
+// error is returned if any could not be placed, those before it are still
+// given a TargetHost.
+func (scaler *ProxmoxScaler) SelectTargetHosts(scaleEvents []*ScaleEvent) error {
+	placed, err := scaler.placeScaleEvents(scaleEvents)
 
-	case <-ok:
-		return nil
+	for idx, targetHost := range placed {
+		scaleEvents[idx].TargetHost = targetHost
+		logger.DebugLog(fmt.Sprintf("Selected target host %s for %s", targetHost.Node, scaleEvents[idx].NodeName))
 	}
+
+	return err
 }
 
-func waitForNodeReady(ctx context.Context, cancel context.CancelFunc, scaleEvent *ScaleEvent, ok chan (bool), errchan chan (error)) error {
-	select {
-	case <-ctx.Done():
-		cancel()
-		return fmt.Errorf("timed out waiting for %s to be ready", scaleEvent.NodeName)
+// Returns the pHosts kpNodes of the node class may be provisioned on
+func nodeClassHosts(hosts []proxmox.HostInformation, nodeClass config.NodeClass) ([]proxmox.HostInformation, error) {
+	if nodeClass.TargetHost == "" {
+		return hosts, nil
+	}
 
-	case err := <-errchan:
-		return err
+	for _, host := range hosts {
+		if host.Node == nodeClass.TargetHost {
+			return []proxmox.HostInformation{host}, nil
+		}
+	}
 
-	case <-ok:
-		return nil
+	return nil, fmt.Errorf("target host %s of node class %s not found", nodeClass.TargetHost, nodeClass.Name)
+}
+
+// Whether a pHost has the memory, and enough physical cores, to run a kpNode
+// of the node class on top of what it is already running.
+func hostCanFit(host proxmox.HostInformation, nodeClass config.NodeClass, allocations map[string]hostAllocation) bool {
+	if host.Status != "" && host.Status != "online" {
+		return false
 	}
+
+	if host.Maxcpu > 0 && nodeClass.Cores > host.Maxcpu {
+		return false
+	}
+
+	return availableMem(host, allocations) >= int64(nodeClass.Memory<<20)
 }
 
-func waitForNodeJoin(ctx context.Context, cancel context.CancelFunc, scaleEvent *ScaleEvent, ok chan (bool)) error {
-	select {
-	case <-ctx.Done():
-		cancel()
-		return fmt.Errorf("timed out waiting for %s to join kubernetes cluster", scaleEvent.NodeName)
-	case <-ok:
-		return nil
+// Returns how many of the scaleEvents, in order, the Proxmox cluster has
+// capacity for. Scale events beyond this would fail to provision.
+func (scaler *ProxmoxScaler) NumPlaceableScaleEvents(scaleEvents []*ScaleEvent) (int, error) {
+	placed, err := scaler.placeScaleEvents(scaleEvents)
+	if err != nil && !errors.Is(err, errUnplaceable) {
+		return 0, err
 	}
+
+	return len(placed), nil
 }
 
 func (scaler *ProxmoxScaler) renderNodeLabels(scaleEvent *ScaleEvent) (map[string]string, error) {
 	labels := map[string]string{}
-	for _, label := range strings.Split(scaler.config.KpNodeLabels, ",") {
+	for _, label := range strings.Split(scaler.currentConfig().KpNodeLabels, ",") {
 		key := strings.Split(label, "=")[0]
 		value := strings.Split(label, "=")[1]
 
@@ -260,134 +892,148 @@ func (scaler *ProxmoxScaler) renderNodeLabels(scaleEvent *ScaleEvent) (map[strin
 	return labels, nil
 }
 
+// Starts a warm kpNode for the scale event if there is one, otherwise creates
+// a new kpNode.
+func (scaler *ProxmoxScaler) create(ctx context.Context, scaleEvent *ScaleEvent) error {
+	if scaler.startWarm(ctx, scaleEvent) {
+		return nil
+	}
+
+	return scaler.Provisioner.Create(ctx, scaleEvent)
+}
+
 func (scaler *ProxmoxScaler) ScaleUp(ctx context.Context, scaleEvent *ScaleEvent) error {
-	logger.InfoLog(fmt.Sprintf("Provisioning %s on %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+	// Scale events published by external tools may leave these to kproximate
+	if scaleEvent.NodeName == "" {
+		scaleEvent.NodeName = scaler.newKpNodeName()
+	}
 
-	okChan := make(chan bool)
-	defer close(okChan)
+	if scaleEvent.Warm {
+		return scaler.cloneWarm(ctx, scaleEvent)
+	}
 
-	errChan := make(chan error)
-	defer close(errChan)
+	if scaleEvent.TargetHost.Node == "" {
+		err := scaler.SelectTargetHosts([]*ScaleEvent{scaleEvent})
+		if err != nil {
+			return err
+		}
+	}
+
+	nodeClass := scaler.currentConfig().NodeClass(scaleEvent.NodeClass)
+	logger.InfoLog(fmt.Sprintf("Provisioning %s (%s) on %s", scaleEvent.NodeName, nodeClass.Name, scaleEvent.TargetHost.Node))
 
 	pctx, cancelPCtx := context.WithTimeout(
 		ctx,
 		time.Duration(
 			time.Second*time.Duration(
-				scaler.config.WaitSecondsForProvision,
+				scaler.currentConfig().WaitSecondsForProvision,
 			),
-		),
-	)
-	defer cancelPCtx()
-
-	go scaler.Proxmox.NewKpNode(
-		pctx,
-		okChan,
-		errChan,
-		scaleEvent.NodeName,
-		scaleEvent.TargetHost.Node,
-		scaler.config.KpNodeParams,
-		scaler.config.KpLocalTemplateStorage,
-		scaler.config.KpNodeTemplateName,
-		scaler.config.KpJoinCommand,
-	)
-
-	err := waitForNodeStart(pctx, cancelPCtx, scaleEvent, okChan, errChan)
-	if err != nil {
-		return err
-	}
-
-	logger.InfoLog(fmt.Sprintf("Started %s", scaleEvent.NodeName))
+		),
+	)
+	defer cancelPCtx()
 
-	if scaler.config.KpQemuExecJoin {
-		go scaler.Proxmox.CheckNodeReady(pctx, okChan, errChan, scaleEvent.NodeName)
+	ReportProgress(ctx, scaleEvent, ScaleEventCloning, "")
 
-		// TODO could this call CheckNodeReady itself?
-		err := waitForNodeReady(pctx, cancelPCtx, scaleEvent, okChan, errChan)
+	// A resumed kpNode has already joined the cluster once and rejoins by
+	// itself when started
+	resumed := scaler.resume(pctx, scaleEvent)
+	if !resumed {
+		err := scaler.create(pctx, scaleEvent)
 		if err != nil {
+			if pctx.Err() != nil {
+				return classifiedError(FailureCloneTimeout, err)
+			}
 			return err
 		}
+	}
+
+	logger.InfoLog(fmt.Sprintf("Started %s", scaleEvent.NodeName))
+	ReportProgress(ctx, scaleEvent, ScaleEventStarted, "")
 
-		err = scaler.joinByQemuExec(scaleEvent.NodeName)
+	if !resumed {
+		err := scaler.Provisioner.WaitReady(pctx, scaleEvent)
 		if err != nil {
+			if ClassifyFailure(err) == FailureNoNetwork {
+				return scaler.withConsoleLog(ctx, scaleEvent, err)
+			}
+
+			if pctx.Err() != nil || ClassifyFailure(err) == FailureJoinTimeout {
+				return scaler.withConsoleLog(ctx, scaleEvent, classifiedError(FailureJoinTimeout, err))
+			}
 			return err
 		}
 	}
 
 	logger.InfoLog(fmt.Sprintf("Waiting for %s to join kubernetes cluster", scaleEvent.NodeName))
 
+	if config.Injected(scaler.currentConfig().FailureInjection.JoinTimeout) {
+		return scaler.withConsoleLog(ctx, scaleEvent, classifiedError(FailureJoinTimeout, fmt.Errorf("injected join timeout of %s", scaleEvent.NodeName)))
+	}
+
 	kctx, cancelKCtx := context.WithTimeout(
 		ctx,
 		time.Duration(
 			time.Second*time.Duration(
-				scaler.config.WaitSecondsForJoin,
+				scaler.currentConfig().WaitSecondsForJoin,
 			),
 		),
 	)
 	defer cancelKCtx()
 
-	go scaler.Kubernetes.CheckForNodeJoin(
-		kctx,
-		okChan,
-		scaleEvent.NodeName,
-	)
-
-	// TODO could this call CheckForNodeJoin itself?
-	err = waitForNodeJoin(kctx, cancelKCtx, scaleEvent, okChan)
+	err := scaler.Kubernetes.CheckForNodeJoin(kctx, scaleEvent.NodeName)
 	if err != nil {
-		return err
+		return scaler.withConsoleLog(ctx, scaleEvent, classifiedError(FailureJoinTimeout, err))
 	}
 
 	logger.InfoLog(fmt.Sprintf("%s joined kubernetes cluster", scaleEvent.NodeName))
+	ReportProgress(ctx, scaleEvent, ScaleEventJoined, "")
 
-	if scaler.config.KpNodeLabels != "" {
-		labels, err := scaler.renderNodeLabels(scaleEvent)
-		if err != nil {
-			return err
-		}
+	labels := scaler.topologyLabels(scaleEvent.TargetHost.Node)
+	labels[nodeClassLabel] = nodeClass.Name
+	maps.Copy(labels, nodeClass.Labels)
+
+	if scaler.currentConfig().InstanceID != "" {
+		labels[instanceLabel] = scaler.currentConfig().InstanceID
+	}
 
-		err = scaler.Kubernetes.LabelKpNode(scaleEvent.NodeName, labels)
+	if scaler.currentConfig().KpNodeLabels != "" {
+		renderedLabels, err := scaler.renderNodeLabels(scaleEvent)
 		if err != nil {
 			return err
 		}
 
-		logger.InfoLog(fmt.Sprintf("Set labels on %s", scaleEvent.NodeName))
+		maps.Copy(labels, renderedLabels)
 	}
 
-	return nil
-}
-
-func (scaler *ProxmoxScaler) joinByQemuExec(nodeName string) error {
-	logger.InfoLog(fmt.Sprintf("Executing join command on %s", nodeName))
-	joinExecPid, err := scaler.Proxmox.QemuExecJoin(nodeName, scaler.config.KpJoinCommand)
+	err = scaler.Kubernetes.LabelKpNode(ctx, scaleEvent.NodeName, labels)
 	if err != nil {
-		return err
+		return classifiedError(FailureKubernetesApi, err)
 	}
 
-	var status proxmox.QemuExecStatus
+	logger.InfoLog(fmt.Sprintf("Set labels on %s", scaleEvent.NodeName))
 
-	for {
-		status, err = scaler.Proxmox.GetQemuExecJoinStatus(nodeName, joinExecPid)
-		if err != nil {
-			return err
-		}
+	// The kpNode registered with the startup taint and is only opened up to
+	// workloads once it is healthy
+	if scaler.currentConfig().KpNodeStartupTaint {
+		hctx, cancelHCtx := context.WithTimeout(ctx, time.Second*time.Duration(scaler.currentConfig().WaitSecondsForJoin))
+		defer cancelHCtx()
 
-		if status.Exited == 1 {
-			break
+		err = scaler.Kubernetes.UntaintKpNode(hctx, scaleEvent.NodeName)
+		if err != nil {
+			if hctx.Err() != nil {
+				return classifiedError(FailureJoinTimeout, err)
+			}
+			return classifiedError(FailureKubernetesApi, err)
 		}
 
-		time.Sleep(time.Second * 1)
+		logger.InfoLog(fmt.Sprintf("Removed startup taint from %s", scaleEvent.NodeName))
 	}
 
-	if status.ExitCode != 0 {
-		return fmt.Errorf("join command for %s failed:\n%s", nodeName, status.OutData)
-	} else {
-		logger.InfoLog(fmt.Sprintf("Join command for %s executed successfully", nodeName))
-		return nil
-	}
+	return nil
 }
 
-func (scaler *ProxmoxScaler) NumReadyNodes() (int, error) {
-	kpNodes, err := scaler.Kubernetes.GetKpNodes(scaler.config.KpNodeNameRegex)
+func (scaler *ProxmoxScaler) NumReadyNodes(ctx context.Context) (int, error) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
 		return 0, err
 	}
@@ -395,13 +1041,24 @@ func (scaler *ProxmoxScaler) NumReadyNodes() (int, error) {
 	return len(kpNodes), err
 }
 
-func (scaler *ProxmoxScaler) AssessScaleDown() (*ScaleEvent, error) {
-	totalAllocatedResources, err := scaler.GetAllocatedResources()
+// Serves the nodes and pods used to assess scaling from an informer cache
+// rather than listing them from the apiserver on every poll.
+func (scaler *ProxmoxScaler) StartInformers(ctx context.Context) error {
+	return scaler.Kubernetes.StartInformers(ctx, time.Second*time.Duration(scaler.currentConfig().InformerResyncSeconds))
+}
+
+// Returns the kpNodes to remove, if any. The least loaded kpNode is removed
+// when the remaining kpNodes can take on its load, after which further kpNodes
+// running no workloads are removed up to MaxScaleDownPerInterval.
+func (scaler *ProxmoxScaler) AssessScaleDown(ctx context.Context) ([]*ScaleEvent, error) {
+	load, usage, err := scaler.kpNodesLoad(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get allocated resources: %w", err)
 	}
 
-	workerNodesAllocatable, err := scaler.Kubernetes.GetWorkerNodesAllocatableResources()
+	totalAllocatedResources := totalResources(load)
+
+	workerNodesAllocatable, err := scaler.Kubernetes.GetWorkerNodesAllocatableResources(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get worker nodes capacity: %w", err)
 	}
@@ -409,23 +1066,173 @@ func (scaler *ProxmoxScaler) AssessScaleDown() (*ScaleEvent, error) {
 	totalCpuAllocatable := workerNodesAllocatable.Cpu
 	totalMemoryAllocatable := workerNodesAllocatable.Memory
 
-	acceptCpuScaleDown := scaler.assessScaleDownForResourceType(totalAllocatedResources.Cpu, totalCpuAllocatable, int64(scaler.config.KpNodeCores))
-	acceptMemoryScaleDown := scaler.assessScaleDownForResourceType(totalAllocatedResources.Memory, totalMemoryAllocatable, int64(scaler.config.KpNodeMemory<<20))
+	explanation := ScaleDownExplanation{
+		AllocatedCpu:      totalAllocatedResources.Cpu,
+		AllocatableCpu:    totalCpuAllocatable,
+		AllocatedMemory:   totalAllocatedResources.Memory,
+		AllocatableMemory: totalMemoryAllocatable,
+		LoadHeadroom:      scaler.currentConfig().LoadHeadroom,
+		ScaleEvents:       []ScaleEventExplanation{},
+	}
+	if usage != nil {
+		totalUsage := totalResources(usage)
+		explanation.UsedCpu = totalUsage.Cpu
+		explanation.UsedMemory = totalUsage.Memory
+	}
+	defer func() {
+		scaler.explainScaleDown(explanation)
+	}()
 
-	if !(acceptCpuScaleDown && acceptMemoryScaleDown) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kpNodes) == 0 {
+		explanation.Reasons = append(explanation.Reasons, "There are no kpNodes")
 		return nil, nil
 	}
 
+	// Evicting pods using local storage would lose their data
+	localStorage := map[string]string{}
+	if !scaler.currentConfig().AllowLocalStorageEviction {
+		localStorage, err = scaler.Kubernetes.GetKpNodesWithLocalStorage(ctx, scaler.currentConfig().KpNodeNameRegex)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	localStorageReasons := []string{}
+	for kpNode, reason := range localStorage {
+		localStorageReasons = append(localStorageReasons, fmt.Sprintf("%s is not scaled down, %s", kpNode, reason))
+	}
+	slices.Sort(localStorageReasons)
+	explanation.Reasons = append(explanation.Reasons, localStorageReasons...)
+
 	scaleEvent := ScaleEvent{
 		ScaleType: -1,
 	}
 
-	err = scaler.selectScaleDownTarget(&scaleEvent)
+	err = scaler.selectScaleDownTarget(ctx, &scaleEvent, localStorage)
+	if err != nil {
+		return nil, err
+	}
+
+	if scaleEvent.NodeName == "" {
+		explanation.Reasons = append(explanation.Reasons, "All kpNodes are managed by node pools or use local storage")
+		return nil, nil
+	}
+
+	// The capacity removed along with each kpNode is what it actually
+	// provides, which differs between node classes and system reservations
+	kpNodesCpu := map[string]int64{}
+	kpNodesMemory := map[string]int64{}
+	for _, kpNode := range kpNodes {
+		cpu, memory := scaler.kpNodeAllocatable(kpNode)
+		kpNodesCpu[kpNode.Name] = int64(cpu)
+		kpNodesMemory[kpNode.Name] = memory
+	}
+
+	targetCpu := kpNodesCpu[scaleEvent.NodeName]
+	targetMemory := kpNodesMemory[scaleEvent.NodeName]
+	acceptCpuScaleDown := scaler.assessScaleDownForResourceType(totalAllocatedResources.Cpu, totalCpuAllocatable, targetCpu)
+	acceptMemoryScaleDown := scaler.assessScaleDownForResourceType(totalAllocatedResources.Memory, totalMemoryAllocatable, targetMemory)
+
+	explanation.CpuHeadroom = PostScaleDownHeadroom(totalAllocatedResources.Cpu, totalCpuAllocatable, targetCpu)
+	explanation.MemoryHeadroom = PostScaleDownHeadroom(totalAllocatedResources.Memory, totalMemoryAllocatable, targetMemory)
+	explanation.Acceptable = acceptCpuScaleDown && acceptMemoryScaleDown
+
+	if !acceptCpuScaleDown {
+		explanation.Reasons = append(explanation.Reasons, scaleDownRejectedReason("cpu", totalAllocatedResources.Cpu, explanation.CpuHeadroom, scaler.currentConfig().LoadHeadroom))
+	}
+
+	if !acceptMemoryScaleDown {
+		explanation.Reasons = append(explanation.Reasons, scaleDownRejectedReason("memory", totalAllocatedResources.Memory, explanation.MemoryHeadroom, scaler.currentConfig().LoadHeadroom))
+	}
+
+	if !(acceptCpuScaleDown && acceptMemoryScaleDown) {
+		return nil, nil
+	}
+
+	if reason := scaler.scaleDownHeldByTriggers(ctx, &scaleEvent); reason != "" {
+		explanation.Reasons = append(explanation.Reasons, reason)
+		return nil, nil
+	}
+
+	allocatedExtended, providedExtended, err := scaler.kpNodesExtendedResources(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if extended, short := extendedResourceShortfall(allocatedExtended, workerNodesAllocatable.Extended, providedExtended, []string{scaleEvent.NodeName}); short {
+		explanation.Acceptable = false
+		explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("Removing %s would leave too little %s for the pods requesting it", scaleEvent.NodeName, extended))
+		return nil, nil
+	}
+
+	scaleEvents := []*ScaleEvent{&scaleEvent}
+	explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+		NodeName: scaleEvent.NodeName,
+		Reason:   "The least loaded kpNode, the remaining nodes have enough headroom for its load",
+	})
+
+	if scaler.currentConfig().MaxScaleDownPerInterval <= 1 {
+		return scaleEvents, nil
+	}
+
+	emptyKpNodes, err := scaler.Kubernetes.GetEmptyKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	nodePoolKpNodes, err := scaler.nodePoolKpNodes(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return &scaleEvent, nil
+	for _, kpNode := range emptyKpNodes {
+		if len(scaleEvents) >= scaler.currentConfig().MaxScaleDownPerInterval {
+			break
+		}
+
+		if _, local := localStorage[kpNode]; local || kpNode == scaleEvent.NodeName || nodePoolKpNodes[kpNode] {
+			continue
+		}
+
+		// The headroom must still be acceptable once the kpNodes already
+		// selected have been removed
+		removedCpu, removedMemory := int64(0), int64(0)
+		for _, selected := range scaleEvents {
+			removedCpu += kpNodesCpu[selected.NodeName]
+			removedMemory += kpNodesMemory[selected.NodeName]
+		}
+
+		if !scaler.assessScaleDownForResourceType(totalAllocatedResources.Cpu, totalCpuAllocatable-removedCpu, kpNodesCpu[kpNode]) ||
+			!scaler.assessScaleDownForResourceType(totalAllocatedResources.Memory, totalMemoryAllocatable-removedMemory, kpNodesMemory[kpNode]) {
+			explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("Removing more than %d kpNodes would leave too little headroom", len(scaleEvents)))
+			break
+		}
+
+		removed := []string{kpNode}
+		for _, selected := range scaleEvents {
+			removed = append(removed, selected.NodeName)
+		}
+
+		if _, short := extendedResourceShortfall(allocatedExtended, workerNodesAllocatable.Extended, providedExtended, removed); short {
+			continue
+		}
+
+		scaleEvents = append(scaleEvents, &ScaleEvent{
+			ScaleType: ScaleTypeDown,
+			NodeName:  kpNode,
+		})
+		explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+			NodeName: kpNode,
+			Reason:   "Runs no workloads",
+		})
+	}
+
+	return scaleEvents, nil
 }
 
 // func (scaler *ProxmoxScaler) assessScaleDownForResourceType(currentResourceAllocated float64, totalResourceAllocatable int64, kpNodeResourceCapacity int64) bool {
@@ -439,29 +1246,31 @@ func (scaler *ProxmoxScaler) AssessScaleDown() (*ScaleEvent, error) {
 // 	// The expected allocatable resources of the cluster after scaledown minus the
 // 	// requested load headroom.
 // 	acceptableResourceLoadForScaleDown := (float64(totalResourceAllocatable-int64(kpNodeResourceCapacity)) / float64(totalResourceAllocatable)) -
-// 		(totalResourceLoad * scaler.config.LoadHeadroom)
+// 		(totalResourceLoad * scaler.currentConfig().LoadHeadroom)
 
 // 	return totalResourceLoad < acceptableResourceLoadForScaleDown
 // }
 
 func (scaler *ProxmoxScaler) assessScaleDownForResourceType(currentResourceAllocated float64, totalResourceAllocatable int64, kpNodeResourceCapacity int64) bool {
-	if currentResourceAllocated == 0 {
-		return false
-	}
+	return AcceptsScaleDown(currentResourceAllocated, totalResourceAllocatable, kpNodeResourceCapacity, scaler.currentConfig().LoadHeadroom)
+}
 
-	postScaledownCapacity := totalResourceAllocatable - kpNodeResourceCapacity
-	postScaleDownLoad := int64(math.Ceil(currentResourceAllocated) / float64(postScaledownCapacity) * 100)
-	postScaleDownHeadroom := 100 - postScaleDownLoad
+func scaleDownRejectedReason(resource string, allocated float64, headroom int64, loadHeadroom float64) string {
+	if allocated == 0 {
+		return fmt.Sprintf("No %s is allocated, allocations may not have been read yet", resource)
+	}
 
-	return postScaleDownHeadroom > int64(scaler.config.LoadHeadroom*100)
+	return fmt.Sprintf("Removing a kpNode would leave %d%% of %s free, loadHeadroom requires more than %d%%", headroom, resource, int64(loadHeadroom*100))
 }
 
-func (scaler *ProxmoxScaler) selectScaleDownTarget(scaleEvent *ScaleEvent) error {
+// Selects the least loaded kpNode which is not managed by a node pool or
+// excluded, leaving the scale event's NodeName empty if there is none.
+func (scaler *ProxmoxScaler) selectScaleDownTarget(ctx context.Context, scaleEvent *ScaleEvent, excluded map[string]string) error {
 	if scaleEvent.ScaleType != -1 {
 		return fmt.Errorf("expected ScaleEvent ScaleType to be '-1' but got: %d", scaleEvent.ScaleType)
 	}
 
-	kpNodes, err := scaler.Kubernetes.GetKpNodes(scaler.config.KpNodeNameRegex)
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
 		return err
 	}
@@ -470,7 +1279,21 @@ func (scaler *ProxmoxScaler) selectScaleDownTarget(scaleEvent *ScaleEvent) error
 		return fmt.Errorf("no nodes to scale down, how did we get here?")
 	}
 
-	allocatedResources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(scaler.config.KpNodeNameRegex)
+	// kpNodes managed by node pools are only removed by scaling the node pool
+	nodePoolClasses, err := scaler.nodePoolClasses(ctx)
+	if err != nil {
+		return err
+	}
+
+	kpNodes = slices.DeleteFunc(kpNodes, func(kpNode apiv1.Node) bool {
+		_, isExcluded := excluded[kpNode.Name]
+		return isExcluded || nodePoolClasses[scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name]
+	})
+	if len(kpNodes) == 0 {
+		return nil
+	}
+
+	allocatedResources, _, err := scaler.kpNodesLoad(ctx)
 	if err != nil {
 		return err
 	}
@@ -479,9 +1302,10 @@ func (scaler *ProxmoxScaler) selectScaleDownTarget(scaleEvent *ScaleEvent) error
 
 	// Calculate the combined load on each kpNode
 	for _, node := range kpNodes {
+		cpu, memory := scaler.kpNodeAllocatable(node)
 		nodeLoads[node.Name] =
-			(allocatedResources[node.Name].Cpu / float64(scaler.config.KpNodeCores)) +
-				(allocatedResources[node.Name].Memory / float64(scaler.config.KpNodeMemory))
+			(allocatedResources[node.Name].Cpu / cpu) +
+				(allocatedResources[node.Name].Memory / float64(memory))
 	}
 
 	targetNode := kpNodes[0].Name
@@ -497,7 +1321,7 @@ func (scaler *ProxmoxScaler) selectScaleDownTarget(scaleEvent *ScaleEvent) error
 }
 
 func (scaler *ProxmoxScaler) NumNodes() (int, error) {
-	nodes, err := scaler.Proxmox.GetAllKpNodes(scaler.config.KpNodeNameRegex)
+	nodes, err := scaler.Proxmox.GetAllKpNodes(scaler.currentConfig().KpNodeNameRegex)
 	return len(nodes), err
 }
 
@@ -507,7 +1331,11 @@ func (scaler *ProxmoxScaler) ScaleDown(ctx context.Context, scaleEvent *ScaleEve
 		return err
 	}
 
-	return scaler.Proxmox.DeleteKpNode(scaleEvent.NodeName, scaler.config.KpNodeNameRegex)
+	if scaler.hibernate(ctx, scaleEvent.NodeName) {
+		return nil
+	}
+
+	return scaler.Provisioner.Destroy(ctx, scaleEvent.NodeName)
 }
 
 // This function is only used when it is unclear whether a node has joined the kubernetes cluster
@@ -515,12 +1343,12 @@ func (scaler *ProxmoxScaler) ScaleDown(ctx context.Context, scaleEvent *ScaleEve
 func (scaler *ProxmoxScaler) DeleteNode(ctx context.Context, kpNodeName string) error {
 	_ = scaler.Kubernetes.DeleteKpNode(ctx, kpNodeName)
 
-	return scaler.Proxmox.DeleteKpNode(kpNodeName, scaler.config.KpNodeNameRegex)
+	return scaler.Provisioner.Destroy(ctx, kpNodeName)
 }
 
-func (scaler *ProxmoxScaler) GetAllocatableResources() (AllocatableResources, error) {
+func (scaler *ProxmoxScaler) GetAllocatableResources(ctx context.Context) (AllocatableResources, error) {
 	var allocatableResources AllocatableResources
-	kpNodes, err := scaler.Kubernetes.GetKpNodes(scaler.config.KpNodeNameRegex)
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
 		return allocatableResources, err
 	}
@@ -533,28 +1361,22 @@ func (scaler *ProxmoxScaler) GetAllocatableResources() (AllocatableResources, er
 	return allocatableResources, nil
 }
 
-func (scaler *ProxmoxScaler) GetAllocatedResources() (AllocatedResources, error) {
-	var allocatedResources AllocatedResources
-	resources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(scaler.config.KpNodeNameRegex)
+func (scaler *ProxmoxScaler) GetAllocatedResources(ctx context.Context) (AllocatedResources, error) {
+	resources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(ctx, scaler.currentConfig().KpNodeNameRegex)
 	if err != nil {
-		return allocatedResources, err
-	}
-
-	for _, kpNode := range resources {
-		allocatedResources.Cpu += kpNode.Cpu
-		allocatedResources.Memory += kpNode.Memory
+		return AllocatedResources{}, err
 	}
 
-	return allocatedResources, nil
+	return totalResources(resources), nil
 }
 
-func (scaler *ProxmoxScaler) GetResourceStatistics() (ResourceStatistics, error) {
-	allocatableResources, err := scaler.GetAllocatableResources()
+func (scaler *ProxmoxScaler) GetResourceStatistics(ctx context.Context) (ResourceStatistics, error) {
+	allocatableResources, err := scaler.GetAllocatableResources(ctx)
 	if err != nil {
 		return ResourceStatistics{}, err
 	}
 
-	allocatedResources, err := scaler.GetAllocatedResources()
+	allocatedResources, err := scaler.GetAllocatedResources(ctx)
 	if err != nil {
 		return ResourceStatistics{}, err
 	}
@@ -564,3 +1386,269 @@ func (scaler *ProxmoxScaler) GetResourceStatistics() (ResourceStatistics, error)
 		Allocated:   allocatedResources,
 	}, nil
 }
+
+func (scaler *ProxmoxScaler) ReloadConfig(updatedConfig config.KproximateConfig) []string {
+	scaler.stateMu.Lock()
+	defer scaler.stateMu.Unlock()
+
+	reloaded := *scaler.currentConfig()
+	changes := config.ApplyReloadableSettings(&reloaded, updatedConfig)
+	scaler.reloaded.Store(&reloaded)
+
+	return changes
+}
+
+// A kpNode's resources are stranded when one resource is almost fully
+// allocated while much of the other is left free and unusable.
+const (
+	strandedFreeThreshold = 0.5
+	strandedFullThreshold = 0.1
+)
+
+func isStranded(allocatable AllocatableResources, allocated kubernetes.AllocatedResources) bool {
+	if allocatable.Cpu == 0 || allocatable.Memory == 0 {
+		return false
+	}
+
+	freeCpu := 1 - (allocated.Cpu / allocatable.Cpu)
+	freeMemory := 1 - (allocated.Memory / allocatable.Memory)
+
+	return (freeCpu >= strandedFreeThreshold && freeMemory <= strandedFullThreshold) ||
+		(freeMemory >= strandedFreeThreshold && freeCpu <= strandedFullThreshold)
+}
+
+// How far a node class's memory to cpu ratio is from that of the allocated
+// resources, or false if the allocated resources would not fit.
+func nodeClassShapeDistance(nodeClass config.NodeClass, allocated kubernetes.AllocatedResources) (float64, bool) {
+	cores := float64(nodeClass.Cores)
+	memory := float64(int64(nodeClass.Memory) << 20)
+
+	if cores < allocated.Cpu || memory < allocated.Memory {
+		return 0, false
+	}
+
+	return math.Abs(math.Log((memory / cores) / (allocated.Memory / allocated.Cpu))), true
+}
+
+// Selects the node class whose shape best matches the allocated resources,
+// provided it is a better match than the current node class.
+func selectReplacementNodeClass(
+	nodeClasses []config.NodeClass,
+	currentNodeClass config.NodeClass,
+	allocated kubernetes.AllocatedResources,
+	numKpNodes map[string]int,
+) (config.NodeClass, bool) {
+	if allocated.Cpu == 0 || allocated.Memory == 0 {
+		return config.NodeClass{}, false
+	}
+
+	currentDistance, ok := nodeClassShapeDistance(currentNodeClass, allocated)
+	if !ok {
+		currentDistance = math.Inf(1)
+	}
+
+	var selectedNodeClass config.NodeClass
+	selectedDistance := currentDistance
+
+	for _, nodeClass := range nodeClasses {
+		if nodeClass.Name == currentNodeClass.Name {
+			continue
+		}
+
+		if nodeClass.MaxNodes != 0 && numKpNodes[nodeClass.Name] >= nodeClass.MaxNodes {
+			continue
+		}
+
+		distance, ok := nodeClassShapeDistance(nodeClass, allocated)
+		if ok && distance < selectedDistance {
+			selectedNodeClass = nodeClass
+			selectedDistance = distance
+		}
+	}
+
+	return selectedNodeClass, selectedDistance < currentDistance
+}
+
+// Looks for a kpNode with stranded resources which could be replaced by a node
+// of a better shaped node class.
+func (scaler *ProxmoxScaler) AssessReplacement(ctx context.Context) (*ScaleEvent, error) {
+	if !scaler.currentConfig().ReplaceStrandedNodes || len(scaler.currentConfig().NodeClasses()) < 2 {
+		return nil, nil
+	}
+
+	nodeClasses, err := scaler.autoscaledNodeClasses(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nodeClasses) < 2 {
+		return nil, nil
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	allocatedResources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	numKpNodes, err := scaler.numKpNodesByClass(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, kpNode := range kpNodes {
+		allocatable := AllocatableResources{
+			Cpu:    kpNode.Status.Allocatable.Cpu().AsApproximateFloat64(),
+			Memory: kpNode.Status.Allocatable.Memory().AsApproximateFloat64(),
+		}
+
+		if !isStranded(allocatable, allocatedResources[kpNode.Name]) {
+			continue
+		}
+
+		currentNodeClass := scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel])
+		if !slices.ContainsFunc(nodeClasses, func(nodeClass config.NodeClass) bool { return nodeClass.Name == currentNodeClass.Name }) {
+			continue
+		}
+
+		nodeClass, ok := selectReplacementNodeClass(nodeClasses, currentNodeClass, allocatedResources[kpNode.Name], numKpNodes)
+		if !ok {
+			logger.DebugLog(fmt.Sprintf("%s has stranded resources but no better node class is available", kpNode.Name))
+			continue
+		}
+
+		scaleEvent := ScaleEvent{
+			ScaleType:       ScaleTypeReplace,
+			NodeName:        scaler.newKpNodeName(),
+			NodeClass:       nodeClass.Name,
+			ReplaceNodeName: kpNode.Name,
+		}
+
+		logger.DebugLog("Generated replace event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+		return &scaleEvent, nil
+	}
+
+	return nil, nil
+}
+
+// Returned when a replacement kpNode has joined but the kpNode it replaces
+// could not be removed. The replacement is healthy and must be kept, only the
+// removal of NodeName needs retrying.
+type ReplacedNodeError struct {
+	NodeName string
+	Err      error
+}
+
+func (e *ReplacedNodeError) Error() string {
+	return fmt.Sprintf("failed to remove replaced node %s: %s", e.NodeName, e.Err)
+}
+
+func (e *ReplacedNodeError) Unwrap() error {
+	return e.Err
+}
+
+// Provisions the replacement kpNode before draining and removing the kpNode it
+// replaces so that the evicted pods have somewhere to go.
+func (scaler *ProxmoxScaler) Replace(ctx context.Context, scaleEvent *ScaleEvent) error {
+	if scaleEvent.ScaleType != ScaleTypeReplace {
+		return fmt.Errorf("expected ScaleEvent ScaleType to be '%d' but got: %d", ScaleTypeReplace, scaleEvent.ScaleType)
+	}
+
+	err := scaler.ScaleUp(ctx, scaleEvent)
+	if err != nil {
+		return err
+	}
+
+	return scaler.RemoveReplaced(ctx, scaleEvent.ReplaceNodeName)
+}
+
+// Drains and removes a kpNode once its replacement has joined, returning a
+// ReplacedNodeError if it could not be removed.
+func (scaler *ProxmoxScaler) RemoveReplaced(ctx context.Context, replacedNodeName string) error {
+	scaleDownCtx, cancel := context.WithTimeout(ctx, time.Second*300)
+	defer cancel()
+
+	err := scaler.ScaleDown(
+		scaleDownCtx,
+		&ScaleEvent{
+			ScaleType: ScaleTypeDown,
+			NodeName:  replacedNodeName,
+		},
+	)
+	if err != nil {
+		return &ReplacedNodeError{
+			NodeName: replacedNodeName,
+			Err:      err,
+		}
+	}
+
+	return nil
+}
+
+// Whether the kpNode has joined the kubernetes cluster and is ready, e.g. the
+// replacement provisioned by a previous attempt at a replace event.
+func (scaler *ProxmoxScaler) KpNodeJoined(ctx context.Context, kpNodeName string) (bool, error) {
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return false, err
+	}
+
+	for _, kpNode := range kpNodes {
+		if kpNode.Name == kpNodeName {
+			return kpNodeReady(kpNode), nil
+		}
+	}
+
+	return false, nil
+}
+
+// Deletes templates matching KpTemplateGCRegex which are neither configured
+// for a node class nor the source of an existing kpNode, e.g. superseded
+// versions of the kpNode template. Returns the names of deleted templates.
+func (scaler *ProxmoxScaler) DeleteObsoleteTemplates() ([]string, error) {
+	if scaler.currentConfig().KpTemplateGCRegex == "" {
+		return nil, nil
+	}
+
+	templateNameRegex, err := regexp.Compile(scaler.currentConfig().KpTemplateGCRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	templates, err := scaler.Proxmox.GetTemplates(*templateNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceTemplates, err := scaler.Proxmox.GetKpNodeSourceTemplates(scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	configuredTemplates := map[string]bool{}
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		templateName, _, _ := strings.Cut(nodeClass.TemplateName, "@")
+		configuredTemplates[templateName] = true
+	}
+
+	deletedTemplates := []string{}
+	for _, template := range templates {
+		// Templates may be configured by name or pinned by VMID
+		if configuredTemplates[template.Name] || configuredTemplates[strconv.Itoa(template.VmID)] || sourceTemplates[template.VmID] {
+			continue
+		}
+
+		err := scaler.Proxmox.DeleteTemplate(template)
+		if err != nil {
+			return deletedTemplates, err
+		}
+
+		deletedTemplates = append(deletedTemplates, fmt.Sprintf("%s (%d)", template.Name, template.VmID))
+	}
+
+	return deletedTemplates, nil
+}
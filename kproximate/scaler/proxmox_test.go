@@ -1,17 +1,48 @@
 package scaler
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net"
 	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/identity"
 	"github.com/lupinelab/kproximate/kubernetes"
 	"github.com/lupinelab/kproximate/proxmox"
 	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/uuid"
 )
 
+// A scaler for a cluster with a single pHost, provisioning kpNodes with the
+// provisioner.
+func newTestScaler(provisioner Provisioner) *ProxmoxScaler {
+	return &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				{Node: "pve-01", Maxmem: 17179869184, Status: "online"},
+			},
+		},
+		Provisioner: provisioner,
+		config: config.KproximateConfig{
+			KpNodeCores:             2,
+			KpNodeMemory:            2048,
+			KpNodeNamePrefix:        "kp-node",
+			WaitSecondsForJoin:      60,
+			WaitSecondsForProvision: 60,
+		},
+	}
+}
+
 func TestRequiredScaleEventsFor1CPU(t *testing.T) {
 	s := ProxmoxScaler{
 		Kubernetes: &kubernetes.KubernetesMock{
@@ -29,7 +60,7 @@ func TestRequiredScaleEventsFor1CPU(t *testing.T) {
 
 	currentEvents := 0
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -56,7 +87,7 @@ func TestRequiredScaleEventsFor3CPU(t *testing.T) {
 
 	currentEvents := 0
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -66,6 +97,39 @@ func TestRequiredScaleEventsFor3CPU(t *testing.T) {
 	}
 }
 
+func TestRequiredScaleEventsWithOvercommit(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Cpu:    3.0,
+				Memory: 3221225472,
+			},
+		},
+		config: config.KproximateConfig{
+			CpuOvercommitRatio:    2,
+			KpNodeCores:           2,
+			KpNodeMemory:          2048,
+			MaxKpNodes:            3,
+			MemoryOvercommitRatio: 1.5,
+		},
+	}
+
+	currentEvents := 0
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
+	if err != nil {
+		t.Errorf(err.Error())
+	}
+
+	if len(requiredScaleEvents) != 1 {
+		t.Errorf("Expected exactly 1 scaleEvent, got: %d", len(requiredScaleEvents))
+	}
+
+	if s.maxKpNodeCores() != 4 {
+		t.Errorf("Expected pods requesting up to 4 cpu to be satisfiable, got %d", s.maxKpNodeCores())
+	}
+}
+
 func TestRequiredScaleEventsFor1024MBMemory(t *testing.T) {
 	s := ProxmoxScaler{
 		Kubernetes: &kubernetes.KubernetesMock{
@@ -83,7 +147,7 @@ func TestRequiredScaleEventsFor1024MBMemory(t *testing.T) {
 
 	currentEvents := 0
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -110,7 +174,7 @@ func TestRequiredScaleEventsFor3072MBMemory(t *testing.T) {
 
 	currentEvents := 0
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -137,7 +201,7 @@ func TestRequiredScaleEventsFor1CPU3072MBMemory(t *testing.T) {
 
 	currentEvents := 0
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -164,7 +228,7 @@ func TestRequiredScaleEventsFor1CPU3072MBMemory1QueuedEvent(t *testing.T) {
 
 	currentEvents := 1
 
-	requiredScaleEvents, err := s.RequiredScaleEvents(currentEvents)
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), currentEvents, nil)
 	if err != nil {
 		t.Errorf(err.Error())
 	}
@@ -174,6 +238,243 @@ func TestRequiredScaleEventsFor1CPU3072MBMemory1QueuedEvent(t *testing.T) {
 	}
 }
 
+func TestRequiredScaleEventsRespectsNodeClassMaxNodes(t *testing.T) {
+	smallNode := apiv1.Node{}
+	smallNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	smallNode.Labels = map[string]string{
+		nodeClassLabel: "small",
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Cpu:    6,
+				Memory: 0,
+			},
+			KpNodes: []apiv1.Node{
+				smallNode,
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:     "small",
+					Cores:    2,
+					Memory:   2048,
+					MaxNodes: 2,
+				},
+				{
+					Name:     "large",
+					Cores:    4,
+					Memory:   8192,
+					MaxNodes: 1,
+				},
+			},
+			MaxKpNodes: 10,
+		},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if len(requiredScaleEvents) != 2 {
+		t.Fatalf("Expected exactly 2 scaleEvents, got: %d", len(requiredScaleEvents))
+	}
+
+	if requiredScaleEvents[0].NodeClass != "small" {
+		t.Errorf("Expected the first scaleEvent to be for the small node class, got: %s", requiredScaleEvents[0].NodeClass)
+	}
+
+	if requiredScaleEvents[1].NodeClass != "large" {
+		t.Errorf("Expected the second scaleEvent to be for the large node class, got: %s", requiredScaleEvents[1].NodeClass)
+	}
+}
+
+func TestRequiredScaleEventsCountsInProgressEventsByNodeClass(t *testing.T) {
+	smallNode := apiv1.Node{}
+	smallNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	smallNode.Labels = map[string]string{
+		nodeClassLabel: "small",
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{
+				Cpu:    6,
+				Memory: 0,
+			},
+			KpNodes: []apiv1.Node{
+				smallNode,
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:     "small",
+					Cores:    2,
+					Memory:   2048,
+					MaxNodes: 2,
+				},
+				{
+					Name:     "large",
+					Cores:    4,
+					Memory:   8192,
+					MaxNodes: 2,
+				},
+			},
+			MaxKpNodes: 10,
+		},
+	}
+
+	// The in-progress small kpNode reaches the small node class's maxNodes
+	// and provides 2 of the 6 cpu required
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 1, map[string]int{"small": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 1 || requiredScaleEvents[0].NodeClass != "large" {
+		t.Errorf("Expected a single large scaleEvent, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+
+	// The in-progress large kpNode provides 4 of the 6 cpu required
+	requiredScaleEvents, err = s.RequiredScaleEvents(context.Background(), 1, map[string]int{"large": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 1 || requiredScaleEvents[0].NodeClass != "small" {
+		t.Errorf("Expected a single small scaleEvent, got %v", nodeClassesOf(requiredScaleEvents))
+	}
+}
+
+func TestRequiredScaleEventsForVolumeTopology(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				{Node: "pve-01", Maxmem: 17179869184, Status: "online"},
+				{Node: "pve-02", Maxmem: 17179869184, Status: "online"},
+			},
+		},
+		Kubernetes: &kubernetes.KubernetesMock{
+			VolumeTopologyConflicts: []kubernetes.VolumeTopology{
+				{"topology.kubernetes.io/zone": {"pve-02"}},
+				{"topology.kubernetes.io/zone": {"pve-02"}},
+				{"topology.kubernetes.io/zone": {"pve-03"}},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:   "default",
+					Cores:  2,
+					Memory: 2048,
+				},
+				{
+					Name:       "pve-02",
+					Cores:      2,
+					Memory:     2048,
+					TargetHost: "pve-02",
+				},
+			},
+			MaxKpNodes: 10,
+		},
+	}
+
+	requiredScaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(requiredScaleEvents) != 1 {
+		t.Fatalf("Expected exactly 1 scaleEvent, got: %d", len(requiredScaleEvents))
+	}
+
+	if requiredScaleEvents[0].NodeClass != "pve-02" {
+		t.Errorf("Expected a scaleEvent for the pve-02 node class, got: %s", requiredScaleEvents[0].NodeClass)
+	}
+
+	err = s.SelectTargetHosts(requiredScaleEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if requiredScaleEvents[0].TargetHost.Node != "pve-02" {
+		t.Errorf("Expected the scaleEvent to target pve-02, got: %s", requiredScaleEvents[0].TargetHost.Node)
+	}
+}
+
+func TestInterleaveNodeClasses(t *testing.T) {
+	scaleEvents := []*ScaleEvent{
+		{NodeName: "default-1", NodeClass: "default"},
+		{NodeName: "default-2", NodeClass: "default"},
+		{NodeName: "default-3", NodeClass: "default"},
+		{NodeName: "gpu-1", NodeClass: "gpu"},
+		{NodeName: "large-1", NodeClass: "large"},
+		{NodeName: "gpu-2", NodeClass: "gpu"},
+	}
+
+	interleaved := interleaveNodeClasses(scaleEvents)
+
+	expected := []string{"default-1", "gpu-1", "large-1", "default-2", "gpu-2", "default-3"}
+	for idx, scaleEvent := range interleaved {
+		if scaleEvent.NodeName != expected[idx] {
+			t.Errorf("Expected %s at position %d, got %s", expected[idx], idx, scaleEvent.NodeName)
+		}
+	}
+}
+
+func TestTopologyLabels(t *testing.T) {
+	s := ProxmoxScaler{
+		config: config.KproximateConfig{
+			ClusterName: "homelab",
+		},
+	}
+
+	labels := s.topologyLabels("pve-01")
+	if labels[zoneLabel] != "pve-01" || labels[regionLabel] != "homelab" {
+		t.Errorf("Expected zone pve-01 and region homelab, got %v", labels)
+	}
+
+	s.config.KpNodeDisableTopologyLabels = true
+	if len(s.topologyLabels("pve-01")) != 0 {
+		t.Error("Expected no topology labels when disabled")
+	}
+}
+
+func TestHasUnschedulableResources(t *testing.T) {
+	k := &kubernetes.KubernetesMock{}
+	s := ProxmoxScaler{
+		Kubernetes: k,
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	required, err := s.HasUnschedulableResources(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if required {
+		t.Error("Expected no unschedulable resources")
+	}
+
+	k.UnschedulableResources = kubernetes.UnschedulableResources{Cpu: 0.5}
+
+	required, err = s.HasUnschedulableResources(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !required {
+		t.Error("Expected unschedulable resources")
+	}
+}
+
 func TestSelectTargetHosts(t *testing.T) {
 	s := ProxmoxScaler{
 		Proxmox: &proxmox.ProxmoxMock{
@@ -182,7 +483,7 @@ func TestSelectTargetHosts(t *testing.T) {
 					Id:     "node/host-01",
 					Node:   "host-01",
 					Cpu:    0.209377325725626,
-					Mem:    20394792448,
+					Mem:    12394792448,
 					Maxmem: 16647962624,
 					Status: "online",
 				},
@@ -190,7 +491,7 @@ func TestSelectTargetHosts(t *testing.T) {
 					Id:     "node/host-02",
 					Node:   "host-02",
 					Cpu:    0.209377325725626,
-					Mem:    20394792448,
+					Mem:    12394792448,
 					Maxmem: 16647962624,
 					Status: "online",
 				},
@@ -220,7 +521,7 @@ func TestSelectTargetHosts(t *testing.T) {
 			},
 		},
 		config: config.KproximateConfig{
-			KpNodeNameRegex:  *regexp.MustCompile(`^kp-node-\w{8}-\w{4}-\w{4}-\w{4}-\w{12}$`),
+			KpNodeNameRegex:  *identity.Naming{Prefix: "kp-node"}.Regex(),
 			KpNodeNamePrefix: "kp-node",
 		},
 	}
@@ -258,55 +559,232 @@ func TestSelectTargetHosts(t *testing.T) {
 	}
 }
 
-func TestAssessScaleDownForResourceTypeZeroLoad(t *testing.T) {
-	scaler := ProxmoxScaler{
+func TestSelectTargetHostsAccountsForBatchAllocations(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				{
+					Id:     "node/host-01",
+					Node:   "host-01",
+					Mem:    8589934592,
+					Maxmem: 17179869184,
+					Status: "online",
+				},
+				{
+					Id:     "node/host-02",
+					Node:   "host-02",
+					Mem:    9663676416,
+					Maxmem: 17179869184,
+					Status: "online",
+				},
+			},
+			RunningKpNodes: []proxmox.VmInformation{
+				{
+					Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+					Node: "host-01",
+				},
+				{
+					Name: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+					Node: "host-02",
+				},
+			},
+		},
 		config: config.KproximateConfig{
-			LoadHeadroom: 0.2,
+			KpNodeCores:      2,
+			KpNodeMemory:     2048,
+			KpNodeNameRegex:  *identity.Naming{Prefix: "kp-node"}.Regex(),
+			KpNodeNamePrefix: "kp-node",
 		},
 	}
 
-	scaleDownZeroLoad := scaler.assessScaleDownForResourceType(0, 5, 5)
-	if scaleDownZeroLoad {
-		t.Errorf("Expected false but got %t", scaleDownZeroLoad)
+	scaleEvents := []*ScaleEvent{
+		{
+			ScaleType: 1,
+			NodeName:  fmt.Sprintf("%s-%s", s.config.KpNodeNamePrefix, uuid.NewUUID()),
+		},
+		{
+			ScaleType: 1,
+			NodeName:  fmt.Sprintf("%s-%s", s.config.KpNodeNamePrefix, uuid.NewUUID()),
+		},
+		{
+			ScaleType: 1,
+			NodeName:  fmt.Sprintf("%s-%s", s.config.KpNodeNamePrefix, uuid.NewUUID()),
+		},
 	}
-}
 
-func TestAssessScaleDownForResourceTypeAcceptable(t *testing.T) {
-	scaler := ProxmoxScaler{
-		config: config.KproximateConfig{
-			LoadHeadroom: 0.2,
-		},
+	err := s.SelectTargetHosts(scaleEvents)
+	if err != nil {
+		t.Error(err)
 	}
 
-	scaleDownAcceptable := scaler.assessScaleDownForResourceType(6, 10, 2)
-	if !scaleDownAcceptable {
-		t.Errorf("Expected true but got %t", scaleDownAcceptable)
+	expectedHosts := []string{"host-01", "host-02", "host-01"}
+	for idx, scaleEvent := range scaleEvents {
+		if scaleEvent.TargetHost.Node != expectedHosts[idx] {
+			t.Errorf("Expected %s to be selected as target host for event %d, got %s", expectedHosts[idx], idx, scaleEvent.TargetHost.Node)
+		}
 	}
 }
 
-func TestAssessScaleDownForResourceTypeUnAcceptable(t *testing.T) {
-	scaler := ProxmoxScaler{
+func TestNumPlaceableScaleEventsStopsWhenClusterIsSaturated(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				{
+					Id:     "node/host-01",
+					Node:   "host-01",
+					Mem:    12884901888,
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "online",
+				},
+				{
+					Id:     "node/host-02",
+					Node:   "host-02",
+					Mem:    15032385536,
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "online",
+				},
+				{
+					Id:     "node/host-03",
+					Node:   "host-03",
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "offline",
+				},
+			},
+		},
 		config: config.KproximateConfig{
-			LoadHeadroom: 0.2,
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
 		},
 	}
 
-	scaleDownUnAcceptable := scaler.assessScaleDownForResourceType(7, 10, 2)
-	if scaleDownUnAcceptable {
-		t.Errorf("Expected false but got %t", scaleDownUnAcceptable)
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: 1},
+		{ScaleType: 1},
+		{ScaleType: 1},
+		{ScaleType: 1},
 	}
-}
 
-func TestSelectScaleDownTarget(t *testing.T) {
-	node1 := apiv1.Node{}
-	node1.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
-	node2 := apiv1.Node{}
-	node2.Name = "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
-	node3 := apiv1.Node{}
-	node3.Name = "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38"
+	numPlaceable, err := s.NumPlaceableScaleEvents(scaleEvents)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	scaler := ProxmoxScaler{
-		Kubernetes: &kubernetes.KubernetesMock{
+	// host-01 has room for 2 kpNodes and host-02 for 1, host-03 is offline
+	if numPlaceable != 3 {
+		t.Errorf("Expected 3 placeable scale events, got %d", numPlaceable)
+	}
+}
+
+func TestSelectTargetHostsSkipsFullAndOfflineHosts(t *testing.T) {
+	s := ProxmoxScaler{
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats: []proxmox.HostInformation{
+				{
+					Id:     "node/host-01",
+					Node:   "host-01",
+					Mem:    16106127360,
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "online",
+				},
+				{
+					Id:     "node/host-02",
+					Node:   "host-02",
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "offline",
+				},
+				{
+					Id:     "node/host-03",
+					Node:   "host-03",
+					Mem:    12884901888,
+					Maxmem: 17179869184,
+					Maxcpu: 8,
+					Status: "online",
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	scaleEvents := []*ScaleEvent{
+		{ScaleType: 1},
+		{ScaleType: 1},
+		{ScaleType: 1},
+	}
+
+	err := s.SelectTargetHosts(scaleEvents)
+	if !errors.Is(err, errUnplaceable) {
+		t.Fatalf("Expected the third scale event to be unplaceable, got %v", err)
+	}
+
+	// host-01 is full and host-02 is offline, host-03 has room for 2 kpNodes
+	for _, scaleEvent := range scaleEvents[:2] {
+		if scaleEvent.TargetHost.Node != "host-03" {
+			t.Errorf("Expected host-03 to be selected as target host, got %s", scaleEvent.TargetHost.Node)
+		}
+	}
+
+	if scaleEvents[2].TargetHost.Node != "" {
+		t.Errorf("Expected no target host, got %s", scaleEvents[2].TargetHost.Node)
+	}
+}
+
+func TestAssessScaleDownForResourceTypeZeroLoad(t *testing.T) {
+	scaler := ProxmoxScaler{
+		config: config.KproximateConfig{
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleDownZeroLoad := scaler.assessScaleDownForResourceType(0, 5, 5)
+	if scaleDownZeroLoad {
+		t.Errorf("Expected false but got %t", scaleDownZeroLoad)
+	}
+}
+
+func TestAssessScaleDownForResourceTypeAcceptable(t *testing.T) {
+	scaler := ProxmoxScaler{
+		config: config.KproximateConfig{
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleDownAcceptable := scaler.assessScaleDownForResourceType(6, 10, 2)
+	if !scaleDownAcceptable {
+		t.Errorf("Expected true but got %t", scaleDownAcceptable)
+	}
+}
+
+func TestAssessScaleDownForResourceTypeUnAcceptable(t *testing.T) {
+	scaler := ProxmoxScaler{
+		config: config.KproximateConfig{
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleDownUnAcceptable := scaler.assessScaleDownForResourceType(7, 10, 2)
+	if scaleDownUnAcceptable {
+		t.Errorf("Expected false but got %t", scaleDownUnAcceptable)
+	}
+}
+
+func TestSelectScaleDownTarget(t *testing.T) {
+	node1 := apiv1.Node{}
+	node1.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	node2 := apiv1.Node{}
+	node2.Name = "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+	node3 := apiv1.Node{}
+	node3.Name = "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38"
+
+	scaler := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
 			KpNodes: []apiv1.Node{
 				node1,
 				node2,
@@ -337,13 +815,68 @@ func TestSelectScaleDownTarget(t *testing.T) {
 		ScaleType: -1,
 	}
 
-	scaler.selectScaleDownTarget(&scaleEvent)
+	scaler.selectScaleDownTarget(context.Background(), &scaleEvent, nil)
 
 	if scaleEvent.NodeName != "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38" {
 		t.Errorf("Expected kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38 but got %s", scaleEvent.NodeName)
 	}
 }
 
+func TestAssessScaleDownSkipsKpNodesWithLocalStorage(t *testing.T) {
+	kubernetesMock := &kubernetes.KubernetesMock{
+		KpNodes: []apiv1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"}},
+		},
+		AllocatedResources: map[string]kubernetes.AllocatedResources{
+			"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {
+				Cpu:    0.5,
+				Memory: 536870912.0,
+			},
+			"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a": {
+				Cpu:    1.0,
+				Memory: 1073741824.0,
+			},
+		},
+		WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+			Cpu:    8,
+			Memory: 8589934592,
+		},
+		LocalStorageKpNodes: map[string]string{
+			"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": "pod default/db uses local PersistentVolume local-pv-1",
+		},
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 || scaleEvents[0].NodeName != "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a" {
+		t.Fatalf("Expected only kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a to be scaled down, got %+v", scaleEvents)
+	}
+
+	s.config.AllowLocalStorageEviction = true
+
+	scaleEvents, err = s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 || scaleEvents[0].NodeName != "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd" {
+		t.Errorf("Expected the least loaded kpNode to be scaled down, got %+v", scaleEvents)
+	}
+}
+
 func TestAssessScaleDownIsAcceptable(t *testing.T) {
 	s := ProxmoxScaler{
 		Kubernetes: &kubernetes.KubernetesMock{
@@ -373,16 +906,87 @@ func TestAssessScaleDownIsAcceptable(t *testing.T) {
 		},
 	}
 
-	scaleEvent, _ := s.AssessScaleDown()
+	scaleEvents, _ := s.AssessScaleDown(context.Background())
 
-	if scaleEvent == nil {
-		t.Error("AssessScaleDown returned nil")
-	} else if scaleEvent.NodeName == "" {
+	if len(scaleEvents) != 1 {
+		t.Errorf("Expected exactly 1 scaleEvent, got: %d", len(scaleEvents))
+	} else if scaleEvents[0].NodeName == "" {
 		t.Error("scaleEvent had no NodeName")
 	}
 
 }
 
+func TestAssessScaleDownOnUsage(t *testing.T) {
+	kubernetesMock := &kubernetes.KubernetesMock{
+		AllocatedResources: map[string]kubernetes.AllocatedResources{
+			"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {
+				Cpu:    0.5,
+				Memory: 536870912.0,
+			},
+			"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a": {
+				Cpu:    0.5,
+				Memory: 536870912.0,
+			},
+			"kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38": {
+				Cpu:    0.5,
+				Memory: 536870912.0,
+			},
+		},
+		Usage: map[string]kubernetes.AllocatedResources{
+			"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {
+				Cpu:    1.8,
+				Memory: 536870912.0,
+			},
+			"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a": {
+				Cpu:    1.8,
+				Memory: 536870912.0,
+			},
+			"kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38": {
+				Cpu:    0.1,
+				Memory: 536870912.0,
+			},
+		},
+		WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+			Cpu:    6,
+			Memory: 6442450944,
+		},
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: kubernetesMock,
+		config: config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 {
+		t.Fatalf("Expected a scale down on requests alone, got %d scale events", len(scaleEvents))
+	}
+
+	s.config.ScaleDownOnUsage = true
+
+	scaleEvents, err = s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected no scale down while kpNodes use more than they request, got %d scale events", len(scaleEvents))
+	}
+
+	explanation := s.Explain().ScaleDown
+	if explanation.UsedCpu < 3.69 || explanation.UsedCpu > 3.71 || explanation.AllocatedCpu < 4.09 || explanation.AllocatedCpu > 4.11 {
+		t.Errorf("Expected 3.7 cores used and a load of 4.1 cores, got %+v", explanation)
+	}
+}
+
 func TestAssessScaleDownIsUnacceptable(t *testing.T) {
 	s := ProxmoxScaler{
 		Kubernetes: &kubernetes.KubernetesMock{
@@ -424,15 +1028,302 @@ func TestAssessScaleDownIsUnacceptable(t *testing.T) {
 		},
 	}
 
-	scaleEvent, _ := s.AssessScaleDown()
+	scaleEvents, _ := s.AssessScaleDown(context.Background())
 
-	if scaleEvent != nil {
-		t.Error("AssessScaleDown did not return nil")
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected no scaleEvents, got: %d", len(scaleEvents))
 	}
 }
 
-func TestJoinByQemuExecSuccess(t *testing.T) {
+func TestAssessScaleDownRemovesEmptyNodes(t *testing.T) {
 	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			AllocatedResources: map[string]kubernetes.AllocatedResources{
+				"kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd": {
+					Cpu:    1.0,
+					Memory: 1073741824.0,
+				},
+				"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a": {},
+				"kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38": {},
+				"kp-node-a3c5e4ef-4713-473f-b9f7-3abe413c38ff": {},
+			},
+			EmptyKpNodes: []string{
+				"kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38",
+				"kp-node-a3c5e4ef-4713-473f-b9f7-3abe413c38ff",
+				"kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a",
+			},
+			WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+				Cpu:    8,
+				Memory: 8589934592,
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:             2,
+			KpNodeMemory:            2048,
+			LoadHeadroom:            0.2,
+			MaxScaleDownPerInterval: 3,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 3 {
+		t.Fatalf("Expected exactly 3 scaleEvents, got: %d", len(scaleEvents))
+	}
+
+	removed := map[string]bool{}
+	for _, scaleEvent := range scaleEvents {
+		removed[scaleEvent.NodeName] = true
+	}
+
+	if len(removed) != 3 {
+		t.Errorf("Expected 3 different kpNodes to be removed, got %v", removed)
+	}
+
+	if removed["kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"] {
+		t.Error("Did not expect a kpNode running workloads to be removed")
+	}
+}
+
+func TestAssessScaleDownUsesNodeAllocatable(t *testing.T) {
+	largeNode := apiv1.Node{}
+	largeNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	largeNode.Status.Allocatable = apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("8"),
+		apiv1.ResourceMemory: resource.MustParse("16Gi"),
+	}
+
+	smallNode := apiv1.Node{}
+	smallNode.Name = "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a"
+	smallNode.Status.Allocatable = apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("2"),
+		apiv1.ResourceMemory: resource.MustParse("4Gi"),
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{largeNode, smallNode},
+			AllocatedResources: map[string]kubernetes.AllocatedResources{
+				largeNode.Name: {
+					Cpu:    2.5,
+					Memory: 4294967296.0,
+				},
+				smallNode.Name: {
+					Cpu:    0.5,
+					Memory: 536870912.0,
+				},
+			},
+			WorkerNodesAllocatableResources: kubernetes.WorkerNodesAllocatableResources{
+				Cpu:    10,
+				Memory: 21474836480,
+			},
+		},
+		// Removing a kpNode of the configured size would not be acceptable
+		config: config.KproximateConfig{
+			KpNodeCores:  8,
+			KpNodeMemory: 16384,
+			LoadHeadroom: 0.2,
+		},
+	}
+
+	scaleEvents, err := s.AssessScaleDown(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 1 || scaleEvents[0].NodeName != smallNode.Name {
+		t.Fatalf("Expected the small kpNode to be removed, got: %v", scaleEvents)
+	}
+
+	if headroom := s.Explain().ScaleDown.CpuHeadroom; headroom != 63 {
+		t.Errorf("Expected 63%% cpu headroom without the small kpNode, got: %d", headroom)
+	}
+}
+
+// Reports the kpNode as running once it has been polled startPolls times.
+type startingProxmoxMock struct {
+	*proxmox.ProxmoxMock
+	polls      atomic.Int32
+	startPolls int32
+}
+
+func (p *startingProxmoxMock) GetKpNode(name string, kpNodeName regexp.Regexp) (proxmox.VmInformation, error) {
+	if p.polls.Add(1) < p.startPolls {
+		return proxmox.VmInformation{Name: name, Status: "stopped"}, nil
+	}
+
+	return proxmox.VmInformation{Name: name, Status: "running"}, nil
+}
+
+func TestWaitForRunningPollsOnTheClock(t *testing.T) {
+	clock := newFakeClock()
+	proxmoxMock := &startingProxmoxMock{ProxmoxMock: &proxmox.ProxmoxMock{}, startPolls: 3}
+	p := ProxmoxProvisioner{
+		config:  &config.KproximateConfig{},
+		Proxmox: proxmoxMock,
+		clock:   clock,
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- p.waitForRunning(context.Background(), "kp-node-a")
+	}()
+
+	for range 2 {
+		clock.awaitWaiters(1)
+		clock.Advance(vmStatusInterval)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	if polls := proxmoxMock.polls.Load(); polls != 3 {
+		t.Errorf("Expected the kpNode to be polled 3 times, got %d", polls)
+	}
+}
+
+func TestKpNodeParamsBalloon(t *testing.T) {
+	p := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	params := p.kpNodeParams(config.NodeClass{
+		Cores:  4,
+		Memory: 8192,
+	})
+
+	if params["balloon"] != 0 || params["cores"] != 4 || params["memory"] != 8192 {
+		t.Errorf("Expected ballooning to be disabled, got %v", params)
+	}
+
+	params = p.kpNodeParams(config.NodeClass{
+		Cores:  4,
+		Memory: 8192,
+		Balloon: config.Balloon{
+			Enabled:   true,
+			MinMemory: 4096,
+			Shares:    500,
+		},
+	})
+
+	if params["balloon"] != 4096 || params["shares"] != 500 || params["memory"] != 8192 {
+		t.Errorf("Expected ballooning between 4096 and 8192 MiB, got %v", params)
+	}
+
+	params = p.kpNodeParams(config.NodeClass{
+		Cores:  4,
+		Memory: 8192,
+	})
+
+	if params["balloon"] != 0 {
+		t.Error("Expected ballooning of one node class not to affect another")
+	}
+}
+
+func TestKpNodeParamsCpu(t *testing.T) {
+	p := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeCores:  2,
+			KpNodeMemory: 2048,
+		},
+	}
+
+	params := p.kpNodeParams(config.NodeClass{
+		Cores:  4,
+		Memory: 8192,
+	})
+
+	if _, ok := params["cpu"]; ok || params["cores"] != 4 {
+		t.Errorf("Expected the template's cpu settings to be kept, got %v", params)
+	}
+
+	params = p.kpNodeParams(config.NodeClass{
+		Cores:  8,
+		Memory: 8192,
+		Cpu: config.Cpu{
+			Type:    "x86-64-v3",
+			Numa:    true,
+			Sockets: 2,
+			Units:   2048,
+			Limit:   6,
+		},
+	})
+
+	if params["cpu"] != "x86-64-v3" || params["numa"] != 1 || params["cpuunits"] != 2048 || params["cpulimit"] != 6.0 {
+		t.Errorf("Expected the node class cpu settings, got %v", params)
+	}
+
+	if params["sockets"] != 2 || params["cores"] != 4 {
+		t.Errorf("Expected 2 sockets of 4 cores, got %v", params)
+	}
+}
+
+func TestKpNodeParamsOverrides(t *testing.T) {
+	onBoot := false
+	p := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeDisableSsh: true,
+			KpNodeParams: config.KpNodeParams{
+				Network: map[string]string{
+					"net0": "virtio,bridge=vmbr1,tag=20",
+				},
+				OnBoot:     &onBoot,
+				OsType:     "l26",
+				Nameserver: "10.0.0.53",
+			},
+		},
+	}
+
+	params := p.kpNodeParams(config.NodeClass{
+		Cores:  2,
+		Memory: 2048,
+	})
+
+	if params["net0"] != "virtio,bridge=vmbr1,tag=20" || params["onboot"] != 0 || params["ostype"] != "l26" || params["nameserver"] != "10.0.0.53" {
+		t.Errorf("Expected the kpNodeParams overrides, got %v", params)
+	}
+
+	if params["agent"] != "enabled=1" || params["ipconfig0"] != "ip=dhcp" {
+		t.Errorf("Expected kproximate's defaults for settings left unset, got %v", params)
+	}
+
+	if _, ok := params["sshkeys"]; ok {
+		t.Error("Expected no ssh keys when disabled")
+	}
+}
+
+func TestWaitReadyFailsFastWithoutNetwork(t *testing.T) {
+	p := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{},
+		config: &config.KproximateConfig{
+			WaitSecondsForNetwork: 1,
+		},
+	}
+
+	err := p.WaitReady(context.Background(), &ScaleEvent{NodeName: "kp-node-a"})
+	if ClassifyFailure(err) != FailureNoNetwork || !strings.Contains(err.Error(), "no network") {
+		t.Errorf("Expected a no-network failure, got %v", err)
+	}
+
+	p.Proxmox = &proxmox.ProxmoxMock{
+		KpNodeAddresses: []net.IP{net.ParseIP("10.0.0.21")},
+	}
+
+	err = p.WaitReady(context.Background(), &ScaleEvent{NodeName: "kp-node-a"})
+	if err != nil {
+		t.Errorf("Expected the kpNode to be ready once it has an address, got %v", err)
+	}
+}
+
+func TestJoinByQemuExecSuccess(t *testing.T) {
+	s := ProxmoxProvisioner{
 		Proxmox: &proxmox.ProxmoxMock{
 			JoinExecPid: 1,
 			QemuExecJoinStatus: proxmox.QemuExecStatus{
@@ -441,14 +1332,14 @@ func TestJoinByQemuExecSuccess(t *testing.T) {
 				OutData:  "We shouldnt see this!",
 			},
 		},
-		config: config.KproximateConfig{
+		config: &config.KproximateConfig{
 			KpJoinCommand: "echo test",
 		},
 	}
 
 	kpNodeName := "kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3"
 
-	err := s.joinByQemuExec(kpNodeName)
+	err := s.joinByQemuExec(context.Background(), kpNodeName)
 
 	if err != nil {
 		t.Errorf("Expected nil, Got %s", err)
@@ -456,7 +1347,7 @@ func TestJoinByQemuExecSuccess(t *testing.T) {
 }
 
 func TestJoinByQemuExecFail(t *testing.T) {
-	s := ProxmoxScaler{
+	s := ProxmoxProvisioner{
 		Proxmox: &proxmox.ProxmoxMock{
 			JoinExecPid: 1,
 			QemuExecJoinStatus: proxmox.QemuExecStatus{
@@ -465,14 +1356,14 @@ func TestJoinByQemuExecFail(t *testing.T) {
 				OutData:  "The join command failed!",
 			},
 		},
-		config: config.KproximateConfig{
+		config: &config.KproximateConfig{
 			KpJoinCommand: "echo test",
 		},
 	}
 
 	kpNodeName := "kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3"
 
-	err := s.joinByQemuExec(kpNodeName)
+	err := s.joinByQemuExec(context.Background(), kpNodeName)
 
 	if err == nil {
 		t.Error("Expected the join command to fail")
@@ -506,3 +1397,276 @@ func TestParseNodeLabels(t *testing.T) {
 		t.Errorf("Expected topology.kubernetes.io/zone label to have 'proxmox-node-01' as value, got %s", labels["topology.kubernetes.io/zone"])
 	}
 }
+
+func TestRenderJoinCommand(t *testing.T) {
+	s := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpJoinCommand:         "C:\\k\\join.ps1 -NodeName {{ .NodeName }}",
+			KpJoinCommandTemplate: true,
+		},
+	}
+
+	joinCommand, err := s.renderJoinCommand("kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if joinCommand != "C:\\k\\join.ps1 -NodeName kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3" {
+		t.Errorf("Unexpected join command: %s", joinCommand)
+	}
+
+	s.config.KpJoinCommand = "C:\\k\\join.ps1 -NodeName {{ .NodeName"
+	_, err = s.renderJoinCommand("kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3", nil)
+	if err == nil {
+		t.Error("Expected an invalid join command template to return an error")
+	}
+}
+
+func TestJoinCommandNotTemplatedByDefault(t *testing.T) {
+	s := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpJoinCommand: "curl -sfL https://get.k3s.io | sh -s - --node-label 'x={{ y }}'",
+		},
+	}
+
+	joinCommand, err := s.renderJoinCommand("kp-node-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if joinCommand != s.config.KpJoinCommand {
+		t.Errorf("Expected the join command to be left alone, got %s", joinCommand)
+	}
+}
+
+func TestShellCommandForWindows(t *testing.T) {
+	s := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeOsType: "windows",
+		},
+	}
+
+	command := s.shellCommand("echo test")
+
+	if command[0] != "powershell.exe" || command[len(command)-1] != "echo test" {
+		t.Errorf("Expected the command to be run by powershell, got %v", command)
+	}
+}
+
+func TestWaitForWindowsSpecialize(t *testing.T) {
+	s := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{
+			QemuExecJoinStatus: proxmox.QemuExecStatus{
+				Exited:  1,
+				OutData: "KP-NODE-96F665D\r\n",
+			},
+		},
+		config: &config.KproximateConfig{
+			KpNodeOsType: "windows",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	err := s.waitForWindowsSpecialize(ctx, "kp-node-96f665dd-21c3-4ce1-a1e4-c7717c5338a3")
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestIsStranded(t *testing.T) {
+	allocatable := AllocatableResources{
+		Cpu:    4,
+		Memory: 4294967296,
+	}
+
+	stranded := isStranded(allocatable, kubernetes.AllocatedResources{Cpu: 1, Memory: 4080218931})
+	if !stranded {
+		t.Error("Expected a node with free cpu and no free memory to be stranded")
+	}
+
+	stranded = isStranded(allocatable, kubernetes.AllocatedResources{Cpu: 2, Memory: 2147483648})
+	if stranded {
+		t.Error("Did not expect a node with balanced allocations to be stranded")
+	}
+}
+
+func TestAssessReplacement(t *testing.T) {
+	strandedNode := apiv1.Node{}
+	strandedNode.Name = "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd"
+	strandedNode.Labels = map[string]string{
+		nodeClassLabel: "balanced",
+	}
+	strandedNode.Status.Allocatable = apiv1.ResourceList{
+		apiv1.ResourceCPU:    resource.MustParse("4"),
+		apiv1.ResourceMemory: resource.MustParse("4Gi"),
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: []apiv1.Node{
+				strandedNode,
+			},
+			AllocatedResources: map[string]kubernetes.AllocatedResources{
+				strandedNode.Name: {
+					Cpu:    1,
+					Memory: 4080218931,
+				},
+			},
+		},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name:   "balanced",
+					Cores:  4,
+					Memory: 4096,
+				},
+				{
+					Name:   "memory",
+					Cores:  2,
+					Memory: 8192,
+				},
+			},
+			KpNodeNamePrefix:     "kp-node",
+			ReplaceStrandedNodes: true,
+		},
+	}
+
+	scaleEvent, err := s.AssessReplacement(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent == nil {
+		t.Fatal("Expected a replace event")
+	}
+
+	if scaleEvent.ScaleType != ScaleTypeReplace {
+		t.Errorf("Expected ScaleType %d, got %d", ScaleTypeReplace, scaleEvent.ScaleType)
+	}
+
+	if scaleEvent.NodeClass != "memory" {
+		t.Errorf("Expected the memory node class, got %s", scaleEvent.NodeClass)
+	}
+
+	if scaleEvent.ReplaceNodeName != strandedNode.Name {
+		t.Errorf("Expected %s to be replaced, got %s", strandedNode.Name, scaleEvent.ReplaceNodeName)
+	}
+}
+
+func TestDeleteObsoleteTemplates(t *testing.T) {
+	p := &proxmox.ProxmoxMock{
+		Templates: []proxmox.VmInformation{
+			{VmID: 9000, Name: "kp-template-v1", Template: 1},
+			{VmID: 9001, Name: "kp-template-v2", Template: 1},
+			{VmID: 9002, Name: "kp-template-v3", Template: 1},
+			{VmID: 9003, Name: "other-template", Template: 1},
+		},
+		SourceTemplates: map[int]bool{
+			9001: true,
+		},
+	}
+
+	s := ProxmoxScaler{
+		Proxmox: p,
+		config: config.KproximateConfig{
+			KpNodeTemplateName: "kp-template-v3",
+			KpTemplateGCRegex:  `^kp-template-v\d+$`,
+		},
+	}
+
+	deletedTemplates, err := s.DeleteObsoleteTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deletedTemplates) != 1 || len(p.DeletedTemplates) != 1 || p.DeletedTemplates[0] != 9000 {
+		t.Errorf("Expected only kp-template-v1 to be deleted, got %v", deletedTemplates)
+	}
+}
+
+func TestDeleteObsoleteTemplatesKeepsTemplatesPinnedByVmID(t *testing.T) {
+	p := &proxmox.ProxmoxMock{
+		Templates: []proxmox.VmInformation{
+			{VmID: 9000, Name: "kp-template", Template: 1},
+			{VmID: 9001, Name: "kp-template", Template: 1},
+		},
+	}
+
+	s := ProxmoxScaler{
+		Proxmox: p,
+		config: config.KproximateConfig{
+			KpNodeTemplateName: "9001",
+			KpTemplateGCRegex:  `^kp-template$`,
+		},
+	}
+
+	_, err := s.DeleteObsoleteTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(p.DeletedTemplates, []int{9000}) {
+		t.Errorf("Expected only the unpinned template to be deleted, got %v", p.DeletedTemplates)
+	}
+}
+
+type provisionerMock struct {
+	createErr error
+	created   []string
+	destroyed []string
+}
+
+func (p *provisionerMock) Create(ctx context.Context, scaleEvent *ScaleEvent) error {
+	p.created = append(p.created, scaleEvent.NodeName)
+	return p.createErr
+}
+
+func (p *provisionerMock) WaitReady(ctx context.Context, scaleEvent *ScaleEvent) error {
+	return nil
+}
+
+func (p *provisionerMock) Destroy(ctx context.Context, nodeName string) error {
+	p.destroyed = append(p.destroyed, nodeName)
+	return nil
+}
+
+func TestScaleDownDestroysNodeWithProvisioner(t *testing.T) {
+	provisioner := &provisionerMock{}
+	s := ProxmoxScaler{
+		Kubernetes:  &kubernetes.KubernetesMock{},
+		Provisioner: provisioner,
+	}
+
+	err := s.ScaleDown(context.Background(), &ScaleEvent{
+		ScaleType: ScaleTypeDown,
+		NodeName:  "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.destroyed) != 1 || provisioner.destroyed[0] != "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd" {
+		t.Errorf("Expected the node to be destroyed by the provisioner, got %v", provisioner.destroyed)
+	}
+}
+
+func TestScaleUpRemovesStartupTaint(t *testing.T) {
+	k := &kubernetes.KubernetesMock{}
+	s := newTestScaler(&provisionerMock{})
+	s.Kubernetes = k
+	s.config.KpNodeStartupTaint = true
+
+	err := s.ScaleUp(context.Background(), &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(k.UntaintedNodes) != 1 || k.UntaintedNodes[0] != "kp-node-a" {
+		t.Errorf("Expected the startup taint to be removed from kp-node-a, got %v", k.UntaintedNodes)
+	}
+}
@@ -0,0 +1,130 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+)
+
+const scalingQueryTimeout = 10 * time.Second
+
+// Evaluates the PromQL expressions of scaling queries.
+type MetricsQuerier interface {
+	Query(ctx context.Context, query string) (float64, error)
+}
+
+type PrometheusQuerier struct {
+	api promv1.API
+}
+
+func NewPrometheusQuerier(address string) (*PrometheusQuerier, error) {
+	client, err := api.NewClient(api.Config{Address: address})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PrometheusQuerier{api: promv1.NewAPI(client)}, nil
+}
+
+// Returns the value of a query that results in a scalar or a vector with a
+// single sample, aggregate with e.g. sum() to reduce a vector to one sample.
+func (querier *PrometheusQuerier) Query(ctx context.Context, query string) (float64, error) {
+	result, warnings, err := querier.api.Query(ctx, query, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if len(warnings) > 0 {
+		logger.WarnLog("Prometheus returned warnings", "query", query, "warnings", warnings)
+	}
+
+	switch value := result.(type) {
+	case *model.Scalar:
+		return float64(value.Value), nil
+	case model.Vector:
+		if len(value) != 1 {
+			return 0, fmt.Errorf("query returned %d samples, expected 1", len(value))
+		}
+		return float64(value[0].Value), nil
+	default:
+		return 0, fmt.Errorf("query returned a %s, expected a scalar or vector", result.Type())
+	}
+}
+
+func (scaler *ProxmoxScaler) evaluateScalingQuery(ctx context.Context, scalingQuery config.ScalingQuery) (float64, error) {
+	if scaler.Metrics == nil {
+		return 0, fmt.Errorf("prometheusUrl is not configured")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, scalingQueryTimeout)
+	defer cancel()
+
+	value, err := scaler.Metrics.Query(ctx, scalingQuery.Query)
+	if err != nil {
+		return 0, fmt.Errorf("failed to evaluate scaling query %s: %w", scalingQuery.Name, err)
+	}
+
+	return value, nil
+}
+
+// Requests a kpNode for each scaling query above its scale up threshold, and
+// holds off scale down while any is at or above its scale down threshold.
+type prometheusTrigger struct {
+	scaler *ProxmoxScaler
+}
+
+func (trigger *prometheusTrigger) Evaluate(ctx context.Context) []ScaleRequest {
+	requests := []ScaleRequest{}
+
+	for _, scalingQuery := range trigger.scaler.currentConfig().ScalingQueries {
+		if scalingQuery.ScaleUpThreshold == nil {
+			continue
+		}
+
+		value, err := trigger.scaler.evaluateScalingQuery(ctx, scalingQuery)
+		if err != nil {
+			logger.ErrorLog("Failed to evaluate scaling query", "error", err)
+			requests = append(requests, ScaleRequest{Reason: err.Error()})
+			continue
+		}
+
+		if value <= *scalingQuery.ScaleUpThreshold {
+			continue
+		}
+
+		requests = append(requests, ScaleRequest{
+			NodeClass: scalingQuery.NodeClass,
+			Count:     1,
+			Reason:    fmt.Sprintf("Scaling query %s is %g, above its scale up threshold of %g", scalingQuery.Name, value, *scalingQuery.ScaleUpThreshold),
+		})
+	}
+
+	return requests
+}
+
+// A query that can't be evaluated also holds off scale down.
+func (trigger *prometheusTrigger) HoldScaleDown(ctx context.Context, scaleEvent *ScaleEvent) string {
+	for _, scalingQuery := range trigger.scaler.currentConfig().ScalingQueries {
+		if scalingQuery.ScaleDownThreshold == nil {
+			continue
+		}
+
+		value, err := trigger.scaler.evaluateScalingQuery(ctx, scalingQuery)
+		if err != nil {
+			logger.ErrorLog("Failed to evaluate scaling query", "error", err)
+			return err.Error()
+		}
+
+		if value >= *scalingQuery.ScaleDownThreshold {
+			return fmt.Sprintf("Scaling query %s is %g, not below its scale down threshold of %g", scalingQuery.Name, value, *scalingQuery.ScaleDownThreshold)
+		}
+	}
+
+	return ""
+}
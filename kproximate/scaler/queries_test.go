@@ -0,0 +1,164 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+type metricsQuerierMock struct {
+	values map[string]float64
+}
+
+func (m *metricsQuerierMock) Query(ctx context.Context, query string) (float64, error) {
+	value, ok := m.values[query]
+	if !ok {
+		return 0, fmt.Errorf("no samples for %s", query)
+	}
+
+	return value, nil
+}
+
+func threshold(value float64) *float64 {
+	return &value
+}
+
+func newQueryScaler(values map[string]float64, scalingQueries config.ScalingQueries) *ProxmoxScaler {
+	return &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		Metrics:    &metricsQuerierMock{values: values},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{Name: "general", Cores: 2, Memory: 2048},
+				{Name: "gpu", Cores: 8, Memory: 16384},
+			},
+			KpNodeNamePrefix: "kp-node",
+			LoadHeadroom:     0.2,
+			ScalingQueries:   scalingQueries,
+		},
+	}
+}
+
+func TestRequiredScaleEventsScalingQueryAboveThreshold(t *testing.T) {
+	s := newQueryScaler(
+		map[string]float64{"queue_depth": 150, "gpu_utilization": 0.95},
+		config.ScalingQueries{
+			{Name: "queue", Query: "queue_depth", ScaleUpThreshold: threshold(100)},
+			{Name: "gpu", Query: "gpu_utilization", ScaleUpThreshold: threshold(0.9), NodeClass: "gpu"},
+		},
+	)
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 2 {
+		t.Fatalf("Expected 2 scaleEvents, got %d", len(scaleEvents))
+	}
+
+	if scaleEvents[0].NodeClass != "general" || scaleEvents[1].NodeClass != "gpu" {
+		t.Errorf("Expected general and gpu scale events, got %s and %s", scaleEvents[0].NodeClass, scaleEvents[1].NodeClass)
+	}
+
+	// The query would still be above its threshold when the worker checks
+	// for pending pods
+	if scaleEvents[0].Cancellable {
+		t.Errorf("Expected scale events from scaling queries not to be cancellable")
+	}
+}
+
+func TestRequiredScaleEventsScalingQueryBelowThreshold(t *testing.T) {
+	s := newQueryScaler(
+		map[string]float64{"queue_depth": 100},
+		config.ScalingQueries{
+			{Name: "queue", Query: "queue_depth", ScaleUpThreshold: threshold(100)},
+		},
+	)
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected 0 scaleEvents, got %d", len(scaleEvents))
+	}
+}
+
+func TestRequiredScaleEventsScalingQueryWithEventsInProgress(t *testing.T) {
+	s := newQueryScaler(
+		map[string]float64{"queue_depth": 150},
+		config.ScalingQueries{
+			{Name: "queue", Query: "queue_depth", ScaleUpThreshold: threshold(100)},
+		},
+	)
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected 0 scaleEvents, got %d", len(scaleEvents))
+	}
+}
+
+func TestScaleDownHeldByTriggers(t *testing.T) {
+	scalingQueries := config.ScalingQueries{
+		{Name: "queue", Query: "queue_depth", ScaleDownThreshold: threshold(10)},
+	}
+
+	held := newQueryScaler(map[string]float64{"queue_depth": 10}, scalingQueries)
+	if reason := held.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{}); reason == "" {
+		t.Errorf("Expected scale down to be held at the threshold")
+	}
+
+	permitted := newQueryScaler(map[string]float64{"queue_depth": 5}, scalingQueries)
+	if reason := permitted.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{}); reason != "" {
+		t.Errorf("Expected scale down to be permitted, got %s", reason)
+	}
+
+	failed := newQueryScaler(map[string]float64{}, scalingQueries)
+	if reason := failed.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{}); reason == "" {
+		t.Errorf("Expected scale down to be held when the query fails")
+	}
+}
+
+func TestPrometheusQuerier(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Form.Get("query") {
+		case "sum(queue_depth)":
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"42"]}]}}`)
+		default:
+			fmt.Fprint(w, `{"status":"success","data":{"resultType":"vector","result":[]}}`)
+		}
+	}))
+	defer server.Close()
+
+	querier, err := NewPrometheusQuerier(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := querier.Query(context.Background(), "sum(queue_depth)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if value != 42 {
+		t.Errorf("Expected 42, got %g", value)
+	}
+
+	_, err = querier.Query(context.Background(), "queue_depth")
+	if err == nil {
+		t.Errorf("Expected an error for a query without samples")
+	}
+}
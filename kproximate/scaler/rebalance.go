@@ -0,0 +1,98 @@
+package scaler
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// Looks for a pHost with rebalanceSkew more kpNodes than another and returns
+// a migrate event moving one of its kpNodes to the pHost with the fewest, or
+// nil if kpNodes are spread evenly enough. kpNodes of node classes pinned to
+// a pHost are never moved, nor are kpNodes moved to pHosts with a weight of 0.
+func (scaler *ProxmoxScaler) AssessRebalance(ctx context.Context) (*ScaleEvent, error) {
+	if scaler.currentConfig().RebalanceSkew == 0 {
+		return nil, nil
+	}
+
+	hosts, err := scaler.Proxmox.GetClusterStats()
+	if err != nil {
+		return nil, err
+	}
+
+	hosts = slices.DeleteFunc(scaler.excludeDrainingHosts(hosts), func(host proxmox.HostInformation) bool {
+		return host.Status != "" && host.Status != "online"
+	})
+
+	if len(hosts) < 2 {
+		return nil, nil
+	}
+
+	runningKpNodes, err := scaler.Proxmox.GetRunningKpNodes(scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	kpNodes, err := scaler.Kubernetes.GetKpNodes(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, err
+	}
+
+	nodeClasses := map[string]string{}
+	for _, kpNode := range kpNodes {
+		nodeClasses[kpNode.Name] = kpNode.Labels[nodeClassLabel]
+	}
+
+	numKpNodes := map[string]int{}
+	for _, vm := range runningKpNodes {
+		numKpNodes[vm.Node]++
+	}
+
+	// The busiest pHost first, ties broken by name so the same kpNode is
+	// chosen each poll
+	slices.SortFunc(hosts, func(a, b proxmox.HostInformation) int {
+		return cmp.Or(
+			cmp.Compare(numKpNodes[b.Node], numKpNodes[a.Node]),
+			cmp.Compare(a.Node, b.Node),
+		)
+	})
+
+	busiest := hosts[0]
+	for _, vm := range runningKpNodes {
+		if vm.Node != busiest.Node {
+			continue
+		}
+
+		nodeClass := scaler.currentConfig().NodeClass(nodeClasses[vm.Name])
+		if nodeClass.TargetHost != "" {
+			continue
+		}
+
+		for idx := len(hosts) - 1; idx > 0; idx-- {
+			host := hosts[idx]
+			if numKpNodes[busiest.Node]-numKpNodes[host.Node] < scaler.currentConfig().RebalanceSkew {
+				break
+			}
+
+			if scaler.hostWeight(host.Node) <= 0 || !hostCanFit(host, nodeClass, nil) {
+				continue
+			}
+
+			scaleEvent := ScaleEvent{
+				ScaleType:  ScaleTypeMigrate,
+				NodeName:   vm.Name,
+				NodeClass:  nodeClass.Name,
+				TargetHost: host,
+			}
+
+			logger.DebugLog("Generated rebalance event", "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+			return &scaleEvent, nil
+		}
+	}
+
+	return nil, nil
+}
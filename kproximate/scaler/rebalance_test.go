@@ -0,0 +1,114 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+func skewedKpNodes() []proxmox.VmInformation {
+	return []proxmox.VmInformation{
+		{Name: "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd", Node: "host-01"},
+		{Name: "kp-node-a4f77d63-a944-425d-a980-e7be925b8a6a", Node: "host-01"},
+		{Name: "kp-node-67944692-1de7-4bd0-ac8c-de6dc178cb38", Node: "host-01"},
+		{Name: "kp-node-9a9e9ea4-2d4b-4c4b-9c42-2e0f5c7c6b1f", Node: "host-02"},
+	}
+}
+
+func TestAssessRebalance(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats:   weightedHosts(0),
+			RunningKpNodes: skewedKpNodes(),
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:   2,
+			KpNodeMemory:  2048,
+			RebalanceSkew: 2,
+			HostWeights: map[string]int{
+				"nas": 0,
+			},
+		},
+	}
+
+	migrateEvent, err := s.AssessRebalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrateEvent == nil {
+		t.Fatal("Expected a migrate event")
+	}
+
+	if migrateEvent.ScaleType != ScaleTypeMigrate || migrateEvent.TargetHost.Node != "host-03" {
+		t.Errorf("Expected a kpNode to be migrated to host-03, got %+v", migrateEvent)
+	}
+
+	if migrateEvent.NodeName != "kp-node-163c3d58-4c4d-426d-baef-e0c30ecb5fcd" {
+		t.Errorf("Expected the first kpNode on host-01 to be migrated, got %s", migrateEvent.NodeName)
+	}
+}
+
+func TestAssessRebalanceWithinSkew(t *testing.T) {
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats:   weightedHosts(0)[1:],
+			RunningKpNodes: skewedKpNodes(),
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:   2,
+			KpNodeMemory:  2048,
+			RebalanceSkew: 4,
+		},
+	}
+
+	migrateEvent, err := s.AssessRebalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrateEvent != nil {
+		t.Errorf("Expected no migrate event while hosts are within rebalanceSkew, got %+v", migrateEvent)
+	}
+}
+
+func TestAssessRebalanceKeepsPinnedKpNodes(t *testing.T) {
+	kpNodes := []apiv1.Node{}
+	for _, vm := range skewedKpNodes() {
+		kpNode := apiv1.Node{}
+		kpNode.Name = vm.Name
+		kpNode.Labels = map[string]string{nodeClassLabel: "pinned"}
+		kpNodes = append(kpNodes, kpNode)
+	}
+
+	s := ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			KpNodes: kpNodes,
+		},
+		Proxmox: &proxmox.ProxmoxMock{
+			ClusterStats:   weightedHosts(0)[1:],
+			RunningKpNodes: skewedKpNodes(),
+		},
+		config: config.KproximateConfig{
+			RebalanceSkew: 2,
+			KpNodeClasses: config.NodeClasses{
+				{Name: "pinned", Cores: 2, Memory: 2048, TargetHost: "host-01"},
+			},
+		},
+	}
+
+	migrateEvent, err := s.AssessRebalance(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if migrateEvent != nil {
+		t.Errorf("Expected kpNodes of a node class pinned to a host not to be moved, got %+v", migrateEvent)
+	}
+}
@@ -0,0 +1,65 @@
+package scaler
+
+import (
+	"math"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func overcommitRatio(ratio float64) float64 {
+	if ratio <= 0 {
+		return 1
+	}
+
+	return ratio
+}
+
+// The cpu a kpNode of the node class provides to the scheduler once the cpu
+// overcommit ratio is applied, a ratio of 0 or less being taken as 1.
+func SchedulableCpu(nodeClass config.NodeClass, cpuOvercommitRatio float64) float64 {
+	return float64(nodeClass.Cores) * overcommitRatio(cpuOvercommitRatio)
+}
+
+// The memory in bytes a kpNode of the node class provides to the scheduler
+// once the memory overcommit ratio is applied, a ratio of 0 or less being
+// taken as 1.
+func SchedulableMemory(nodeClass config.NodeClass, memoryOvercommitRatio float64) int64 {
+	// Bit shift mebibytes to bytes
+	return int64(float64(int64(nodeClass.Memory)<<20) * overcommitRatio(memoryOvercommitRatio))
+}
+
+// The percentage of a resource left unallocated if a kpNode providing
+// kpNodeResourceCapacity of it were removed.
+func PostScaleDownHeadroom(currentResourceAllocated float64, totalResourceAllocatable int64, kpNodeResourceCapacity int64) int64 {
+	postScaledownCapacity := totalResourceAllocatable - kpNodeResourceCapacity
+	postScaleDownLoad := int64(math.Ceil(currentResourceAllocated) / float64(postScaledownCapacity) * 100)
+
+	return 100 - postScaleDownLoad
+}
+
+// Whether removing a kpNode would leave more than the loadHeadroom share of a
+// resource unallocated. Nothing is removed while none of the resource is
+// allocated, as allocations may not have been read yet.
+func AcceptsScaleDown(currentResourceAllocated float64, totalResourceAllocatable int64, kpNodeResourceCapacity int64, loadHeadroom float64) bool {
+	if currentResourceAllocated == 0 {
+		return false
+	}
+
+	return PostScaleDownHeadroom(currentResourceAllocated, totalResourceAllocatable, kpNodeResourceCapacity) > int64(loadHeadroom*100)
+}
+
+// How many more kpNodes of the node class fit in the free memory of the
+// pHost, less the headroom share of its memory.
+func KpNodesFitting(host proxmox.HostInformation, nodeClass config.NodeClass, headroom float64) int {
+	if nodeClass.Memory <= 0 || !hostCanFit(host, config.NodeClass{Cores: nodeClass.Cores}, nil) {
+		return 0
+	}
+
+	free := host.Maxmem - host.Mem - int64(float64(host.Maxmem)*headroom)
+	if free <= 0 {
+		return 0
+	}
+
+	return int(free / int64(nodeClass.Memory<<20))
+}
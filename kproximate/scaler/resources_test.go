@@ -0,0 +1,160 @@
+package scaler
+
+import (
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestSchedulableResources(t *testing.T) {
+	nodeClass := config.NodeClass{Cores: 2, Memory: 2048}
+
+	tests := []struct {
+		name           string
+		ratio          float64
+		expectedCpu    float64
+		expectedMemory int64
+	}{
+		{
+			name:           "unset ratio",
+			ratio:          0,
+			expectedCpu:    2,
+			expectedMemory: 2147483648,
+		},
+		{
+			name:           "negative ratio",
+			ratio:          -1,
+			expectedCpu:    2,
+			expectedMemory: 2147483648,
+		},
+		{
+			name:           "overcommitted",
+			ratio:          1.5,
+			expectedCpu:    3,
+			expectedMemory: 3221225472,
+		},
+	}
+
+	for _, test := range tests {
+		cpu := SchedulableCpu(nodeClass, test.ratio)
+		if cpu != test.expectedCpu {
+			t.Errorf("%s: expected %f cpu, got %f", test.name, test.expectedCpu, cpu)
+		}
+
+		memory := SchedulableMemory(nodeClass, test.ratio)
+		if memory != test.expectedMemory {
+			t.Errorf("%s: expected %d memory, got %d", test.name, test.expectedMemory, memory)
+		}
+	}
+}
+
+func TestAcceptsScaleDown(t *testing.T) {
+	tests := []struct {
+		name             string
+		allocated        float64
+		allocatable      int64
+		capacity         int64
+		loadHeadroom     float64
+		expectedHeadroom int64
+		expected         bool
+	}{
+		{
+			name:             "nothing allocated",
+			allocated:        0,
+			allocatable:      10,
+			capacity:         2,
+			loadHeadroom:     0.2,
+			expectedHeadroom: 100,
+			expected:         false,
+		},
+		{
+			name:             "headroom left",
+			allocated:        6,
+			allocatable:      10,
+			capacity:         2,
+			loadHeadroom:     0.2,
+			expectedHeadroom: 25,
+			expected:         true,
+		},
+		{
+			name:             "too little headroom left",
+			allocated:        7,
+			allocatable:      10,
+			capacity:         2,
+			loadHeadroom:     0.2,
+			expectedHeadroom: 13,
+			expected:         false,
+		},
+		{
+			name:             "allocations rounded up",
+			allocated:        5.5,
+			allocatable:      10,
+			capacity:         2,
+			loadHeadroom:     0.2,
+			expectedHeadroom: 25,
+			expected:         true,
+		},
+	}
+
+	for _, test := range tests {
+		headroom := PostScaleDownHeadroom(test.allocated, test.allocatable, test.capacity)
+		if headroom != test.expectedHeadroom {
+			t.Errorf("%s: expected a headroom of %d%%, got %d%%", test.name, test.expectedHeadroom, headroom)
+		}
+
+		accepted := AcceptsScaleDown(test.allocated, test.allocatable, test.capacity, test.loadHeadroom)
+		if accepted != test.expected {
+			t.Errorf("%s: expected scale down accepted to be %t", test.name, test.expected)
+		}
+	}
+}
+
+func TestKpNodesFitting(t *testing.T) {
+	nodeClass := config.NodeClass{Cores: 2, Memory: 4096}
+
+	tests := []struct {
+		name     string
+		host     proxmox.HostInformation
+		headroom float64
+		expected int
+	}{
+		{
+			name:     "empty host",
+			host:     proxmox.HostInformation{Maxcpu: 8, Maxmem: 34359738368, Status: "online"},
+			headroom: 0,
+			expected: 8,
+		},
+		{
+			name:     "headroom kept free",
+			host:     proxmox.HostInformation{Maxcpu: 8, Maxmem: 34359738368, Mem: 8589934592, Status: "online"},
+			headroom: 0.1,
+			expected: 5,
+		},
+		{
+			name:     "full host",
+			host:     proxmox.HostInformation{Maxcpu: 8, Maxmem: 34359738368, Mem: 32212254720, Status: "online"},
+			headroom: 0.1,
+			expected: 0,
+		},
+		{
+			name:     "offline host",
+			host:     proxmox.HostInformation{Maxcpu: 8, Maxmem: 34359738368, Status: "offline"},
+			headroom: 0.1,
+			expected: 0,
+		},
+		{
+			name:     "too few cores",
+			host:     proxmox.HostInformation{Maxcpu: 1, Maxmem: 34359738368, Status: "online"},
+			headroom: 0.1,
+			expected: 0,
+		},
+	}
+
+	for _, test := range tests {
+		fitting := KpNodesFitting(test.host, nodeClass, test.headroom)
+		if fitting != test.expected {
+			t.Errorf("%s: expected %d kpNodes to fit, got %d", test.name, test.expected, fitting)
+		}
+	}
+}
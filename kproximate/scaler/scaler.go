@@ -3,25 +3,83 @@ package scaler
 import (
 	"context"
 
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
 	"github.com/lupinelab/kproximate/proxmox"
 )
 
 type Scaler interface {
-	RequiredScaleEvents(numCurrentEvents int) ([]*ScaleEvent, error)
+	RequiredScaleEvents(ctx context.Context, numCurrentEvents int, currentEventsByClass map[string]int) ([]*ScaleEvent, error)
+	HasUnschedulableResources(ctx context.Context) (bool, error)
+	GetUnschedulableResources(ctx context.Context) (kubernetes.UnschedulableResources, error)
 	SelectTargetHosts(scaleEvents []*ScaleEvent) error
+	NumPlaceableScaleEvents(scaleEvents []*ScaleEvent) (int, error)
+	MaxKpNodes() (int, error)
 	ScaleUp(ctx context.Context, scaleEvent *ScaleEvent) error
-	NumReadyNodes() (int, error)
+	NumReadyNodes(ctx context.Context) (int, error)
 	NumNodes() (int, error)
-	AssessScaleDown() (*ScaleEvent, error)
+	AssessScaleDown(ctx context.Context) ([]*ScaleEvent, error)
 	ScaleDown(ctx context.Context, scaleEvent *ScaleEvent) error
 	DeleteNode(ctx context.Context, kpNodeName string) error
-	GetResourceStatistics() (ResourceStatistics, error)
+	GetResourceStatistics(ctx context.Context) (ResourceStatistics, error)
+	AssessReplacement(ctx context.Context) (*ScaleEvent, error)
+	Replace(ctx context.Context, scaleEvent *ScaleEvent) error
+	RemoveReplaced(ctx context.Context, replacedNodeName string) error
+	KpNodeJoined(ctx context.Context, kpNodeName string) (bool, error)
+	AssessDrainingHosts(ctx context.Context) ([]*ScaleEvent, error)
+	AssessInitFailedKpNodes(ctx context.Context) ([]*ScaleEvent, error)
+	Migrate(ctx context.Context, scaleEvent *ScaleEvent) error
+	AssessRebalance(ctx context.Context) (*ScaleEvent, error)
+	AssessPatching(ctx context.Context) (*ScaleEvent, error)
+	Patch(ctx context.Context, scaleEvent *ScaleEvent) error
+	ReloadConfig(updatedConfig config.KproximateConfig) []string
+	DeleteObsoleteTemplates() ([]string, error)
+	StartInformers(ctx context.Context) error
+	Preflight(ctx context.Context, nodeClass string) error
+	Explain() Explanation
+	NodePoolScaleEvents(ctx context.Context) ([]*ScaleEvent, error)
+	WarmPoolScaleEvents(ctx context.Context, queued map[string]int) ([]*ScaleEvent, error)
+	CollectHibernatedKpNodes(ctx context.Context) ([]string, error)
+	AssessProxmoxHealth() (string, error)
+	CheckProxmoxPermissions() error
+	ManualScaleEvent(nodeClass string) (*ScaleEvent, error)
+	ManualScaleDownEvent(ctx context.Context, kpNodeName string) (*ScaleEvent, error)
+	KpNodeStatuses(ctx context.Context) ([]KpNodeStatus, error)
+	EstimateCost(ctx context.Context) (CostEstimate, error)
 }
 
+const (
+	ScaleTypeDown = -1
+	ScaleTypeUp   = 1
+	// Provisions a new kpNode before draining and removing ReplaceNodeName
+	ScaleTypeReplace = 2
+	// Moves NodeName to the TargetHost, replacing it if it cannot be migrated
+	ScaleTypeMigrate = 3
+	// Drains NodeName and updates it in place before uncordoning it
+	ScaleTypePatch = 4
+)
+
+// A request to scale the cluster, passed from the controller to workers. The
+// JSON encoding is a stable API described by scaleevent.schema.json so that
+// external tools can publish their own scale events, see EncodeScaleEvent.
 type ScaleEvent struct {
-	ScaleType  int
-	NodeName   string
-	TargetHost proxmox.HostInformation
+	Version         int                     `json:"version"`
+	ScaleType       int                     `json:"scaleType"`
+	NodeName        string                  `json:"nodeName,omitempty"`
+	NodeClass       string                  `json:"nodeClass,omitempty"`
+	ReplaceNodeName string                  `json:"replaceNodeName,omitempty"`
+	TargetHost      proxmox.HostInformation `json:"targetHost"`
+	// Whether a worker may skip the event if there are no longer any
+	// unschedulable pods by the time it is picked up
+	Cancellable bool `json:"cancellable,omitempty"`
+	// Published while clearing a large backlog of pending pods, workers may
+	// exceed their usual concurrency to process the event
+	Burst bool `json:"burst,omitempty"`
+	// Events with a higher priority are consumed first, between 0 and 9
+	Priority int `json:"priority,omitempty"`
+	// Clones a stopped kpNode into the warm pool of the node class rather
+	// than a kpNode which joins the cluster
+	Warm bool `json:"warm,omitempty"`
 }
 
 type AllocatedResources struct {
@@ -9,7 +9,7 @@ import (
 type Mock struct {
 }
 
-func (m Mock) RequiredScaleEvents(requiredResources *kubernetes.UnschedulableResources, numCurrentEvents int) ([]*ScaleEvent, error) {
+func (m Mock) RequiredScaleEvents(requiredResources *kubernetes.UnschedulableResources, numCurrentEvents int, currentEventsByClass map[string]int) ([]*ScaleEvent, error) {
 	return nil, nil
 }
 
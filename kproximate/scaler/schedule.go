@@ -0,0 +1,167 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// Requests kpNodes to bring each node class up to the number of nodes of its
+// active scale schedules, and holds off scale down that would take it below.
+type scheduleTrigger struct {
+	scaler *ProxmoxScaler
+}
+
+// The minutes since midnight of a time of day given as "15:04".
+func minuteOfDay(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, err
+	}
+
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// Whether the schedule's window includes the time. The part of a window
+// spanning midnight which falls on the next day belongs to the day it started.
+func scheduleActive(scaleSchedule config.ScaleSchedule, now time.Time) (bool, error) {
+	start, err := minuteOfDay(scaleSchedule.Start)
+	if err != nil {
+		return false, fmt.Errorf("scale schedule %s has an invalid start: %w", scaleSchedule.Name, err)
+	}
+
+	end, err := minuteOfDay(scaleSchedule.End)
+	if err != nil {
+		return false, fmt.Errorf("scale schedule %s has an invalid end: %w", scaleSchedule.Name, err)
+	}
+
+	minute := now.Hour()*60 + now.Minute()
+	day := now.Weekday()
+
+	switch {
+	case start == end:
+	case start < end:
+		if minute < start || minute >= end {
+			return false, nil
+		}
+	default:
+		if minute < start && minute >= end {
+			return false, nil
+		}
+
+		if minute < end {
+			day = (day + 6) % 7
+		}
+	}
+
+	if len(scaleSchedule.Days) == 0 {
+		return true, nil
+	}
+
+	return slices.ContainsFunc(scaleSchedule.Days, func(scheduled string) bool {
+		return strings.EqualFold(scheduled, day.String()[:3])
+	}), nil
+}
+
+// The number of kpNodes of each node class required by the active schedules,
+// any schedule that can't be assessed is returned as an error.
+func (trigger *scheduleTrigger) requiredKpNodes() (map[string]int, map[string]string, []error) {
+	required := map[string]int{}
+	schedules := map[string]string{}
+	errs := []error{}
+
+	for _, scaleSchedule := range trigger.scaler.currentConfig().ScaleSchedules {
+		active, err := scheduleActive(scaleSchedule, trigger.scaler.now())
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		nodeClass := trigger.scaler.currentConfig().NodeClass(scaleSchedule.NodeClass).Name
+		if active && scaleSchedule.Nodes > required[nodeClass] {
+			required[nodeClass] = scaleSchedule.Nodes
+			schedules[nodeClass] = scaleSchedule.Name
+		}
+	}
+
+	return required, schedules, errs
+}
+
+func (trigger *scheduleTrigger) Evaluate(ctx context.Context) []ScaleRequest {
+	if len(trigger.scaler.currentConfig().ScaleSchedules) == 0 {
+		return nil
+	}
+
+	requests := []ScaleRequest{}
+
+	required, schedules, errs := trigger.requiredKpNodes()
+	for _, err := range errs {
+		logger.ErrorLog("Failed to assess scale schedule", "error", err)
+		requests = append(requests, ScaleRequest{Reason: err.Error()})
+	}
+
+	if len(required) == 0 {
+		return requests
+	}
+
+	numKpNodes, err := trigger.scaler.numKpNodesByClass(ctx)
+	if err != nil {
+		logger.ErrorLog("Failed to count kpNodes for scale schedules", "error", err)
+		return append(requests, ScaleRequest{Reason: fmt.Sprintf("Failed to count kpNodes for scale schedules: %s", err.Error())})
+	}
+
+	for _, nodeClass := range trigger.scaler.currentConfig().NodeClasses() {
+		missing := required[nodeClass.Name] - numKpNodes[nodeClass.Name]
+		if missing <= 0 {
+			continue
+		}
+
+		requests = append(requests, ScaleRequest{
+			NodeClass: nodeClass.Name,
+			Count:     missing,
+			Reason:    fmt.Sprintf("Scale schedule %s requires %d kpNodes of node class %s, there are %d", schedules[nodeClass.Name], required[nodeClass.Name], nodeClass.Name, numKpNodes[nodeClass.Name]),
+		})
+	}
+
+	return requests
+}
+
+func (trigger *scheduleTrigger) HoldScaleDown(ctx context.Context, scaleEvent *ScaleEvent) string {
+	if len(trigger.scaler.currentConfig().ScaleSchedules) == 0 {
+		return ""
+	}
+
+	required, schedules, _ := trigger.requiredKpNodes()
+	if len(required) == 0 {
+		return ""
+	}
+
+	kpNodes, err := trigger.scaler.Kubernetes.GetKpNodes(ctx, trigger.scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		logger.ErrorLog("Failed to count kpNodes for scale schedules", "error", err)
+		return fmt.Sprintf("Failed to count kpNodes for scale schedules: %s", err.Error())
+	}
+
+	// Scale down events don't record the node class of their kpNode
+	nodeClass := scaleEvent.NodeClass
+	numKpNodes := map[string]int{}
+	for _, kpNode := range kpNodes {
+		kpNodeClass := trigger.scaler.currentConfig().NodeClass(kpNode.Labels[nodeClassLabel]).Name
+		numKpNodes[kpNodeClass]++
+		if kpNode.Name == scaleEvent.NodeName {
+			nodeClass = kpNodeClass
+		}
+	}
+	nodeClass = trigger.scaler.currentConfig().NodeClass(nodeClass).Name
+
+	if required[nodeClass] > 0 && numKpNodes[nodeClass] <= required[nodeClass] {
+		return fmt.Sprintf("Scale schedule %s requires %d kpNodes of node class %s", schedules[nodeClass], required[nodeClass], nodeClass)
+	}
+
+	return ""
+}
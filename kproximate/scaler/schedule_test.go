@@ -0,0 +1,118 @@
+package scaler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/identity"
+	"github.com/lupinelab/kproximate/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestScheduleActive(t *testing.T) {
+	// A Monday
+	monday := func(hour int, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name     string
+		schedule config.ScaleSchedule
+		now      time.Time
+		active   bool
+	}{
+		{"within window", config.ScaleSchedule{Start: "08:00", End: "18:00"}, monday(9, 0), true},
+		{"at end of window", config.ScaleSchedule{Start: "08:00", End: "18:00"}, monday(18, 0), false},
+		{"other day", config.ScaleSchedule{Days: []string{"Tue"}, Start: "08:00", End: "18:00"}, monday(9, 0), false},
+		{"scheduled day", config.ScaleSchedule{Days: []string{"mon"}, Start: "08:00", End: "18:00"}, monday(9, 0), true},
+		{"whole day", config.ScaleSchedule{Days: []string{"Mon"}, Start: "00:00", End: "00:00"}, monday(23, 59), true},
+		{"overnight before midnight", config.ScaleSchedule{Days: []string{"Mon"}, Start: "22:00", End: "02:00"}, monday(23, 0), true},
+		// Past midnight the window belongs to the Sunday it started on
+		{"overnight after midnight", config.ScaleSchedule{Days: []string{"Mon"}, Start: "22:00", End: "02:00"}, monday(1, 0), false},
+		{"overnight from previous day", config.ScaleSchedule{Days: []string{"Sun"}, Start: "22:00", End: "02:00"}, monday(1, 0), true},
+	}
+
+	for _, test := range tests {
+		active, err := scheduleActive(test.schedule, test.now)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if active != test.active {
+			t.Errorf("%s: expected active to be %t", test.name, test.active)
+		}
+	}
+
+	_, err := scheduleActive(config.ScaleSchedule{Start: "8am", End: "18:00"}, monday(9, 0))
+	if err == nil {
+		t.Error("Expected an error for an invalid start")
+	}
+}
+
+func newScheduleScaler(kpNodes int, schedules config.ScaleSchedules) *ProxmoxScaler {
+	nodes := []apiv1.Node{}
+	for _, name := range []string{"kp-node-a", "kp-node-b", "kp-node-c"}[:kpNodes] {
+		nodes = append(nodes, apiv1.Node{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: map[string]string{nodeClassLabel: "general"},
+			},
+		})
+	}
+
+	return &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{KpNodes: nodes},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{Name: "general", Cores: 2, Memory: 2048},
+				{Name: "gpu", Cores: 8, Memory: 16384},
+			},
+			KpNodeNamePrefix: "kp-node",
+			KpNodeNameRegex:  *identity.Naming{Prefix: "kp-node"}.Regex(),
+			ScaleSchedules:   schedules,
+		},
+		// Monday 09:00
+		clock: &fakeClock{now: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)},
+	}
+}
+
+func TestRequiredScaleEventsScaleSchedule(t *testing.T) {
+	s := newScheduleScaler(1, config.ScaleSchedules{
+		{Name: "office-hours", Days: []string{"Mon"}, Start: "08:00", End: "18:00", Nodes: 3},
+		{Name: "weekend", Days: []string{"Sat"}, Start: "08:00", End: "18:00", Nodes: 5},
+	})
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 2 || scaleEvents[0].NodeClass != "general" || scaleEvents[1].NodeClass != "general" {
+		t.Errorf("Expected 2 general scale events, got %+v", scaleEvents)
+	}
+}
+
+func TestScaleDownHeldByScaleSchedule(t *testing.T) {
+	schedules := config.ScaleSchedules{
+		{Name: "office-hours", Start: "08:00", End: "18:00", Nodes: 2},
+	}
+
+	held := newScheduleScaler(2, schedules)
+	if reason := held.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{NodeName: "kp-node-a"}); reason == "" {
+		t.Error("Expected scale down to be held at the scheduled number of kpNodes")
+	}
+
+	permitted := newScheduleScaler(3, schedules)
+	if reason := permitted.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{NodeName: "kp-node-a"}); reason != "" {
+		t.Errorf("Expected scale down to be permitted above the scheduled number of kpNodes, got %s", reason)
+	}
+
+	evening := newScheduleScaler(2, schedules)
+	evening.clock = &fakeClock{now: time.Date(2024, 1, 1, 19, 0, 0, 0, time.UTC)}
+	if reason := evening.scaleDownHeldByTriggers(context.Background(), &ScaleEvent{NodeName: "kp-node-a"}); reason != "" {
+		t.Errorf("Expected scale down to be permitted outside of the window, got %s", reason)
+	}
+}
@@ -0,0 +1,290 @@
+package scaler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// The values available to cloud-init snippet templates
+type snippetValues struct {
+	NodeName   string
+	NodeClass  string
+	TargetHost string
+	DataDisks  []snippetDataDisk
+	// The data of the join secret by key, see kpJoinSecret
+	JoinSecret map[string]string
+}
+
+// A data disk as seen from within the kpNode
+type snippetDataDisk struct {
+	Device     string
+	MountPath  string
+	Filesystem string
+	Size       int
+}
+
+// The vendor data used to format and mount data disks when no vendor data
+// template is configured
+const dataDiskVendorData = `#cloud-config
+fs_setup:
+{{- range .DataDisks }}{{ if .MountPath }}
+  - device: {{ .Device }}
+    filesystem: {{ .Filesystem }}
+    partition: none
+{{- end }}{{ end }}
+mounts:
+{{- range .DataDisks }}{{ if .MountPath }}
+  - [ {{ .Device }}, {{ .MountPath }}, {{ .Filesystem }}, "defaults,nofail", "0", "2" ]
+{{- end }}{{ end }}
+`
+
+// Data disks are given a serial so that the guest can find them regardless
+// of which slot they were attached to
+func dataDiskSerial(idx int) string {
+	return fmt.Sprintf("kp-data-%d", idx)
+}
+
+// The path udev gives a disk with the serial in the guest
+func dataDiskDevice(bus string, serial string) string {
+	switch bus {
+	case "virtio":
+		return "/dev/disk/by-id/virtio-" + serial
+	case "sata":
+		return "/dev/disk/by-id/ata-QEMU_HARDDISK_" + serial
+	default:
+		return "/dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_" + serial
+	}
+}
+
+func snippetDataDisks(nodeClass config.NodeClass) []snippetDataDisk {
+	dataDisks := []snippetDataDisk{}
+	for idx, dataDisk := range nodeClass.DataDisks {
+		dataDisks = append(dataDisks, snippetDataDisk{
+			Device:     dataDiskDevice(dataDisk.Bus, dataDiskSerial(idx)),
+			MountPath:  dataDisk.MountPath,
+			Filesystem: dataDisk.Filesystem,
+			Size:       dataDisk.Size,
+		})
+	}
+
+	return dataDisks
+}
+
+func mountsDataDisks(dataDisks []snippetDataDisk) bool {
+	for _, dataDisk := range dataDisks {
+		if dataDisk.MountPath != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+type snippet struct {
+	// The cicustom key the snippet is attached with
+	kind     string
+	template string
+}
+
+func (p *ProxmoxProvisioner) snippets() []snippet {
+	userData := p.config.KpNodeUserData
+	if p.talosConfigured() {
+		userData = p.config.KpNodeTalosConfig
+	}
+
+	return []snippet{
+		{kind: "user", template: userData},
+		{kind: "vendor", template: p.config.KpNodeVendorData},
+		{kind: "network", template: p.config.KpNodeNetworkConfig},
+	}
+}
+
+// Talos kpNodes are passed a worker machine config as user-data rather than
+// a cloud-init snippet.
+func (p *ProxmoxProvisioner) talosConfigured() bool {
+	return p.config.KpNodeOsType == "talos" && p.config.KpNodeTalosConfig != ""
+}
+
+func snippetFileName(nodeName string, kind string) string {
+	return fmt.Sprintf("%s-%s.yaml", nodeName, kind)
+}
+
+func renderSnippet(kind string, snippetTemplate string, values snippetValues) ([]byte, error) {
+	// A key missing from the join secret fails the scale event
+	tmpl, err := template.New(kind).Option("missingkey=error").Parse(snippetTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s snippet template: %w", kind, err)
+	}
+
+	rendered := new(bytes.Buffer)
+	err = tmpl.Execute(rendered, values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render %s snippet template: %w", kind, err)
+	}
+
+	return rendered.Bytes(), nil
+}
+
+// Renders the configured snippets for a kpNode into the snippets directory of
+// the snippet storage, mounted at kpNodeSnippetDir, and returns the cicustom
+// value which attaches them. Returns an empty string if no snippets are
+// configured. An error is returned if the target host cannot see the written
+// snippets, as the kpNode would otherwise fail to start.
+func (p *ProxmoxProvisioner) writeSnippets(ctx context.Context, scaleEvent *ScaleEvent) (string, error) {
+	nodeClass := p.config.NodeClass(scaleEvent.NodeClass)
+	ignition := nodeClass.UserDataFormat == "ignition"
+
+	if p.config.KpNodeSnippetStorage == "" {
+		if p.talosConfigured() {
+			return "", fmt.Errorf("kpNodeSnippetStorage is required to pass the talos machine config to %s", scaleEvent.NodeName)
+		}
+
+		if ignition {
+			return "", fmt.Errorf("kpNodeSnippetStorage is required to pass the ignition config to %s", scaleEvent.NodeName)
+		}
+
+		return "", nil
+	}
+
+	joinSecret, err := p.joinSecret(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	values := snippetValues{
+		NodeName:   scaleEvent.NodeName,
+		NodeClass:  nodeClass.Name,
+		TargetHost: scaleEvent.TargetHost.Node,
+		DataDisks:  snippetDataDisks(nodeClass),
+		JoinSecret: joinSecret,
+	}
+
+	cicustom := []string{}
+	volIDs := []string{}
+	for _, snippet := range p.snippets() {
+		var rendered []byte
+		var err error
+
+		switch {
+		// Ignition configs are passed as user-data in place of any cloud-init
+		// snippets
+		case ignition && snippet.kind != "user":
+			continue
+
+		case ignition:
+			rendered, err = p.ignitionUserData(values)
+
+		case snippet.kind == "user" && p.talosConfigured():
+			rendered, err = talosMachineConfig(snippet.template, values)
+
+		default:
+			// Talos mounts data disks itself
+			if snippet.kind == "vendor" && snippet.template == "" && mountsDataDisks(values.DataDisks) && p.config.KpNodeOsType != "talos" {
+				snippet.template = dataDiskVendorData
+			}
+
+			if snippet.template == "" {
+				continue
+			}
+
+			rendered, err = renderSnippet(snippet.kind, snippet.template, values)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		fileName := snippetFileName(scaleEvent.NodeName, snippet.kind)
+		err = os.WriteFile(filepath.Join(p.config.KpNodeSnippetDir, "snippets", fileName), rendered, 0644)
+		if err != nil {
+			return "", err
+		}
+
+		volID := fmt.Sprintf("%s:snippets/%s", p.config.KpNodeSnippetStorage, fileName)
+		volIDs = append(volIDs, volID)
+		cicustom = append(cicustom, fmt.Sprintf("%s=%s", snippet.kind, volID))
+	}
+
+	err = p.checkSnippetsStored(scaleEvent, volIDs)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(cicustom, ","), nil
+}
+
+// Checks the target host can read the written snippets from the snippet
+// storage, which it cannot if kpNodeSnippetDir is not the storage's mount.
+func (p *ProxmoxProvisioner) checkSnippetsStored(scaleEvent *ScaleEvent, volIDs []string) error {
+	if len(volIDs) == 0 {
+		return nil
+	}
+
+	stored, err := p.Proxmox.GetSnippets(scaleEvent.TargetHost.Node, p.config.KpNodeSnippetStorage)
+	if err != nil {
+		return fmt.Errorf("failed to list the snippets of %s: %w", p.config.KpNodeSnippetStorage, err)
+	}
+
+	for _, volID := range volIDs {
+		if !slices.Contains(stored, volID) {
+			return fmt.Errorf("%s was written to %s but is not in Proxmox storage %s on %s, kpNodeSnippetDir must be where the storage is mounted", volID, p.config.KpNodeSnippetDir, p.config.KpNodeSnippetStorage, scaleEvent.TargetHost.Node)
+		}
+	}
+
+	return nil
+}
+
+// The Ignition config for a kpNode, the join command is included unless it is
+// executed via the qemu guest agent.
+func (p *ProxmoxProvisioner) ignitionUserData(values snippetValues) ([]byte, error) {
+	var userConfig []byte
+	if p.config.KpNodeIgnitionConfig != "" {
+		var err error
+		userConfig, err = renderSnippet("ignition", p.config.KpNodeIgnitionConfig, values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sshKey := p.config.SshKey
+	if p.config.KpNodeDisableSsh {
+		sshKey = ""
+	}
+
+	joinCommand := ""
+	if !p.config.KpQemuExecJoin {
+		var err error
+		joinCommand, err = p.renderJoinCommand(values.NodeName, values.JoinSecret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return renderIgnitionConfig(values, sshKey, joinCommand, userConfig)
+}
+
+// Removes the snippets of a deleted kpNode. A snippet which is already gone
+// counts as removed, and a failure to remove one is only logged since the
+// kpNode itself has been deleted.
+func (p *ProxmoxProvisioner) deleteSnippets(nodeName string) {
+	if p.config.KpNodeSnippetStorage == "" {
+		return
+	}
+
+	for _, snippet := range p.snippets() {
+		err := os.Remove(filepath.Join(p.config.KpNodeSnippetDir, "snippets", snippetFileName(nodeName, snippet.kind)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			logger.WarnLog(fmt.Sprintf("Failed to delete the %s snippet of %s", snippet.kind, nodeName), "error", err)
+		}
+	}
+}
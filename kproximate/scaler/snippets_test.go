@@ -0,0 +1,252 @@
+package scaler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+func TestWriteSnippets(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{SnippetDir: snippetDir},
+		config: &config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{Name: "large"},
+			},
+			KpNodeSnippetDir:     snippetDir,
+			KpNodeSnippetStorage: "cephfs",
+			KpNodeUserData:       "#cloud-config\nhostname: {{ .NodeName }}\n",
+			KpNodeVendorData:     "#cloud-config\nruncmd:\n  - echo {{ .NodeClass }} {{ .TargetHost }}\n",
+		},
+	}
+
+	scaleEvent := &ScaleEvent{
+		NodeName:  "kp-node-1",
+		NodeClass: "large",
+		TargetHost: proxmox.HostInformation{
+			Node: "host-01",
+		},
+	}
+
+	cicustom, err := s.writeSnippets(context.TODO(), scaleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedCicustom := "user=cephfs:snippets/kp-node-1-user.yaml,vendor=cephfs:snippets/kp-node-1-vendor.yaml"
+	if cicustom != expectedCicustom {
+		t.Errorf("Expected cicustom %s, got %s", expectedCicustom, cicustom)
+	}
+
+	vendorData, err := os.ReadFile(filepath.Join(snippetDir, "snippets", "kp-node-1-vendor.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(vendorData) != "#cloud-config\nruncmd:\n  - echo large host-01\n" {
+		t.Errorf("Unexpected vendor data: %s", vendorData)
+	}
+
+	s.deleteSnippets("kp-node-1")
+
+	entries, _ := os.ReadDir(filepath.Join(snippetDir, "snippets"))
+	if len(entries) != 0 {
+		t.Errorf("Expected snippets to be deleted, found %d files", len(entries))
+	}
+}
+
+func TestWriteSnippetsMountsDataDisks(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{SnippetDir: snippetDir},
+		config: &config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name: "storage",
+					DataDisks: []config.DataDisk{
+						{Size: 100, Bus: "scsi", MountPath: "/var/lib/longhorn", Filesystem: "ext4"},
+						{Size: 50, Bus: "virtio", Filesystem: "ext4"},
+					},
+				},
+			},
+			KpNodeSnippetDir:     snippetDir,
+			KpNodeSnippetStorage: "cephfs",
+		},
+	}
+
+	scaleEvent := &ScaleEvent{
+		NodeName:  "kp-node-1",
+		NodeClass: "storage",
+	}
+
+	cicustom, err := s.writeSnippets(context.TODO(), scaleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cicustom != "vendor=cephfs:snippets/kp-node-1-vendor.yaml" {
+		t.Errorf("Expected data disk vendor data to be attached, got %s", cicustom)
+	}
+
+	vendorData, err := os.ReadFile(filepath.Join(snippetDir, "snippets", "kp-node-1-vendor.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `#cloud-config
+fs_setup:
+  - device: /dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_kp-data-0
+    filesystem: ext4
+    partition: none
+mounts:
+  - [ /dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_kp-data-0, /var/lib/longhorn, ext4, "defaults,nofail", "0", "2" ]
+`
+	if string(vendorData) != expected {
+		t.Errorf("Unexpected vendor data: %s", vendorData)
+	}
+}
+
+func TestWriteSnippetsTalosMachineConfig(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ProxmoxProvisioner{
+		Proxmox: &proxmox.ProxmoxMock{SnippetDir: snippetDir},
+		config: &config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{
+					Name: "storage",
+					DataDisks: []config.DataDisk{
+						{Size: 100, Bus: "scsi", MountPath: "/var/mnt/longhorn", Filesystem: "ext4"},
+					},
+				},
+			},
+			KpNodeOsType:         "talos",
+			KpNodeSnippetDir:     snippetDir,
+			KpNodeSnippetStorage: "cephfs",
+			KpNodeTalosConfig: `version: v1alpha1
+machine:
+  type: worker
+  token: abc123
+cluster:
+  controlPlane:
+    endpoint: https://10.0.0.10:6443
+---
+apiVersion: v1alpha1
+kind: ExtensionServiceConfig
+name: example
+`,
+		},
+	}
+
+	cicustom, err := s.writeSnippets(context.TODO(), &ScaleEvent{
+		NodeName:  "kp-node-1",
+		NodeClass: "storage",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cicustom != "user=cephfs:snippets/kp-node-1-user.yaml" {
+		t.Errorf("Expected only the machine config to be attached, got %s", cicustom)
+	}
+
+	userData, err := os.ReadFile(filepath.Join(snippetDir, "snippets", "kp-node-1-user.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `cluster:
+  controlPlane:
+    endpoint: https://10.0.0.10:6443
+machine:
+  disks:
+  - device: /dev/disk/by-id/scsi-0QEMU_QEMU_HARDDISK_kp-data-0
+    partitions:
+    - mountpoint: /var/mnt/longhorn
+  network:
+    hostname: kp-node-1
+  token: abc123
+  type: worker
+version: v1alpha1
+
+---
+apiVersion: v1alpha1
+kind: ExtensionServiceConfig
+name: example
+`
+	if string(userData) != expected {
+		t.Errorf("Unexpected machine config: %s", userData)
+	}
+}
+
+func TestWriteSnippetsFailsWhenNotInSnippetStorage(t *testing.T) {
+	snippetDir := t.TempDir()
+	err := os.Mkdir(filepath.Join(snippetDir, "snippets"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ProxmoxProvisioner{
+		// The storage does not contain what is written to kpNodeSnippetDir
+		Proxmox: &proxmox.ProxmoxMock{SnippetDir: t.TempDir()},
+		config: &config.KproximateConfig{
+			KpNodeSnippetDir:     snippetDir,
+			KpNodeSnippetStorage: "cephfs",
+			KpNodeUserData:       "#cloud-config\nhostname: {{ .NodeName }}\n",
+		},
+	}
+
+	_, err = s.writeSnippets(context.TODO(), &ScaleEvent{NodeName: "kp-node-1"})
+	if err == nil {
+		t.Error("Expected an error when the snippet is not in the snippet storage")
+	}
+}
+
+func TestDeleteSnippetsIgnoresMissingSnippets(t *testing.T) {
+	s := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeSnippetDir:     t.TempDir(),
+			KpNodeSnippetStorage: "cephfs",
+			KpNodeUserData:       "#cloud-config",
+		},
+		Proxmox: &proxmox.ProxmoxMock{},
+	}
+
+	err := s.Destroy(context.TODO(), "kp-node-1")
+	if err != nil {
+		t.Errorf("Expected the delete to succeed without snippets, got %v", err)
+	}
+}
+
+func TestWriteSnippetsTalosRequiresSnippetStorage(t *testing.T) {
+	s := ProxmoxProvisioner{
+		config: &config.KproximateConfig{
+			KpNodeOsType:      "talos",
+			KpNodeTalosConfig: "machine:\n  type: worker\n",
+		},
+	}
+
+	_, err := s.writeSnippets(context.TODO(), &ScaleEvent{NodeName: "kp-node-1"})
+	if err == nil {
+		t.Error("Expected an error without kpNodeSnippetStorage")
+	}
+}
@@ -0,0 +1,119 @@
+package scaler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// The progress of a scale event as reported by the worker processing it
+const (
+	ScaleEventCloning = "cloning"
+	ScaleEventStarted = "started"
+	ScaleEventJoined  = "joined"
+	ScaleEventDeleted = "deleted"
+	ScaleEventFailed  = "failed"
+	// Moved to another pHost by a migrate event
+	ScaleEventMigrated = "migrated"
+	// Updated in place by a patch event
+	ScaleEventPatched = "patched"
+	// Cloned into the warm pool of its node class by a warm event
+	ScaleEventWarmed = "warmed"
+	// Skipped by the worker as it was no longer required
+	ScaleEventCancelled = "cancelled"
+)
+
+// A progress update for a scale event, published by workers back to the
+// controller.
+type ScaleEventStatus struct {
+	NodeName  string `json:"nodeName"`
+	NodeClass string `json:"nodeClass,omitempty"`
+	ScaleType int    `json:"scaleType"`
+	State     string `json:"state"`
+	Reason    string `json:"reason,omitempty"`
+	// The failure category of failed scale events
+	Category string `json:"category,omitempty"`
+	// The console output of kpNodes which failed to join
+	ConsoleLog string `json:"consoleLog,omitempty"`
+	// A VMID which was taken by the time the kpNode was cloned, the clone is
+	// retried with another
+	VmIDCollision int       `json:"vmIDCollision,omitempty"`
+	Updated       time.Time `json:"updated"`
+}
+
+// Whether the scale event will receive no further updates.
+func (s ScaleEventStatus) Finished() bool {
+	return s.State == ScaleEventJoined || s.State == ScaleEventDeleted || s.State == ScaleEventMigrated || s.State == ScaleEventPatched || s.State == ScaleEventWarmed || s.State == ScaleEventFailed || s.State == ScaleEventCancelled
+}
+
+func EncodeScaleEventStatus(status ScaleEventStatus) ([]byte, error) {
+	return json.Marshal(status)
+}
+
+func DecodeScaleEventStatus(data []byte) (ScaleEventStatus, error) {
+	var status ScaleEventStatus
+	err := json.Unmarshal(data, &status)
+	if err != nil {
+		return status, fmt.Errorf("failed to decode scale event status: %w", err)
+	}
+
+	if status.NodeName == "" || status.State == "" {
+		return status, fmt.Errorf("scale event status has no nodeName or state")
+	}
+
+	return status, nil
+}
+
+// Receives the progress of scale events processed with a context returned by
+// WithProgressReporter.
+type ProgressReporter func(status ScaleEventStatus)
+
+type progressReporterKey struct{}
+
+func WithProgressReporter(ctx context.Context, reporter ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressReporterKey{}, reporter)
+}
+
+func reportStatus(ctx context.Context, scaleEvent *ScaleEvent, status ScaleEventStatus) {
+	reporter, ok := ctx.Value(progressReporterKey{}).(ProgressReporter)
+	if !ok {
+		return
+	}
+
+	status.NodeName = scaleEvent.NodeName
+	status.NodeClass = scaleEvent.NodeClass
+	status.ScaleType = scaleEvent.ScaleType
+	status.Updated = time.Now().UTC()
+
+	reporter(status)
+}
+
+// Reports the progress of the scale event if the context has a reporter.
+func ReportProgress(ctx context.Context, scaleEvent *ScaleEvent, state string, reason string) {
+	reportStatus(ctx, scaleEvent, ScaleEventStatus{
+		State:  state,
+		Reason: reason,
+	})
+}
+
+// Reports that the VMID allocated to the scale event's kpNode was taken
+// before it could be cloned.
+func ReportVmIDCollision(ctx context.Context, scaleEvent *ScaleEvent, vmID int) {
+	reportStatus(ctx, scaleEvent, ScaleEventStatus{
+		State:         ScaleEventCloning,
+		Reason:        fmt.Sprintf("VMID %d is already in use, retrying with another", vmID),
+		VmIDCollision: vmID,
+	})
+}
+
+// Reports that the scale event failed with the error, classified by
+// ClassifyFailure, along with any console output captured from the kpNode.
+func ReportFailure(ctx context.Context, scaleEvent *ScaleEvent, err error) {
+	reportStatus(ctx, scaleEvent, ScaleEventStatus{
+		State:      ScaleEventFailed,
+		Reason:     err.Error(),
+		Category:   ClassifyFailure(err),
+		ConsoleLog: FailureConsoleLog(err),
+	})
+}
@@ -0,0 +1,65 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"testing"
+)
+
+func TestScaleUpReportsProgress(t *testing.T) {
+	s := newTestScaler(&provisionerMock{})
+
+	states := []string{}
+	ctx := WithProgressReporter(context.Background(), func(status ScaleEventStatus) {
+		if status.NodeName != "kp-node-a" {
+			t.Errorf("Expected progress for kp-node-a, got %s", status.NodeName)
+		}
+
+		states = append(states, status.State)
+	})
+
+	err := s.ScaleUp(ctx, &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{ScaleEventCloning, ScaleEventStarted, ScaleEventJoined}
+	if !slices.Equal(states, expected) {
+		t.Errorf("Expected progress %v, got %v", expected, states)
+	}
+}
+
+func TestScaleEventStatusRoundTrip(t *testing.T) {
+	status := ScaleEventStatus{
+		NodeName:  "kp-node-a",
+		ScaleType: ScaleTypeUp,
+		State:     ScaleEventFailed,
+		Reason:    "clone failed",
+	}
+
+	body, err := EncodeScaleEventStatus(status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeScaleEventStatus(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded != status {
+		t.Errorf("Expected %+v, got %+v", status, decoded)
+	}
+
+	if !decoded.Finished() {
+		t.Error("Expected a failed scale event to be finished")
+	}
+
+	_, err = DecodeScaleEventStatus([]byte(`{"nodeName": "kp-node-a"}`))
+	if err == nil {
+		t.Error("Expected a status without a state to be rejected")
+	}
+}
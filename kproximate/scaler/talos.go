@@ -0,0 +1,61 @@
+package scaler
+
+import (
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Patches a Talos worker machine config, as generated by "talosctl gen
+// config", for a kpNode. The hostname is set to the kpNode's name and data
+// disks with a mount path are partitioned and mounted by Talos. Further
+// documents in the config are left unchanged.
+func talosMachineConfig(workerConfig string, values snippetValues) ([]byte, error) {
+	documents := strings.Split(workerConfig, "\n---")
+
+	var machineConfig map[string]interface{}
+	err := yaml.Unmarshal([]byte(documents[0]), &machineConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse talos machine config: %w", err)
+	}
+
+	machine, ok := machineConfig["machine"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("talos machine config has no machine section")
+	}
+
+	network, _ := machine["network"].(map[string]interface{})
+	if network == nil {
+		network = map[string]interface{}{}
+	}
+	network["hostname"] = values.NodeName
+	machine["network"] = network
+
+	disks, _ := machine["disks"].([]interface{})
+	for _, dataDisk := range values.DataDisks {
+		if dataDisk.MountPath == "" {
+			continue
+		}
+
+		disks = append(disks, map[string]interface{}{
+			"device": dataDisk.Device,
+			"partitions": []interface{}{
+				map[string]interface{}{"mountpoint": dataDisk.MountPath},
+			},
+		})
+	}
+
+	if len(disks) > 0 {
+		machine["disks"] = disks
+	}
+
+	patched, err := yaml.Marshal(machineConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render talos machine config: %w", err)
+	}
+
+	documents[0] = string(patched)
+
+	return []byte(strings.Join(documents, "\n---")), nil
+}
@@ -0,0 +1,32 @@
+package scaler
+
+import "sync"
+
+// The configuration digest last seen for each configured kpNode template, used
+// to spot templates changed or replaced under the same name.
+type templateDigests struct {
+	mu      sync.Mutex
+	digests map[string]string
+}
+
+func newTemplateDigests() *templateDigests {
+	return &templateDigests{
+		digests: map[string]string{},
+	}
+}
+
+// Records the digest of the template, returning the digest previously seen
+// for it if it has changed since.
+func (d *templateDigests) observe(templateName string, digest string) (string, bool) {
+	if d == nil || digest == "" {
+		return "", false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous, seen := d.digests[templateName]
+	d.digests[templateName] = digest
+
+	return previous, seen && previous != digest
+}
@@ -0,0 +1,28 @@
+package scaler
+
+import "testing"
+
+func TestTemplateDigests(t *testing.T) {
+	d := newTemplateDigests()
+
+	if _, changed := d.observe("kp-template", "abc"); changed {
+		t.Error("Expected the first digest seen not to be a change")
+	}
+
+	if _, changed := d.observe("kp-template", "abc"); changed {
+		t.Error("Expected an unchanged digest not to be a change")
+	}
+
+	if _, changed := d.observe("kp-template", ""); changed {
+		t.Error("Expected a missing digest to be ignored")
+	}
+
+	previous, changed := d.observe("kp-template", "def")
+	if !changed || previous != "abc" {
+		t.Errorf("Expected a change from abc, got %q, %v", previous, changed)
+	}
+
+	if _, changed := d.observe("other-template", "abc"); changed {
+		t.Error("Expected templates to be tracked separately")
+	}
+}
@@ -0,0 +1,171 @@
+package scaler
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/logger"
+)
+
+// KpNodes requested by a trigger.
+type ScaleRequest struct {
+	// Chosen by priority when empty
+	NodeClass string
+	// A request for no kpNodes only explains why none were requested, e.g.
+	// because the trigger's signal could not be read
+	Count  int
+	Reason string
+}
+
+// A source of scaling signals, evaluated once the pending pods have been
+// assessed. Triggers are only evaluated when no scale events are required or
+// in progress, as their signals can't reflect a kpNode's capacity until it has
+// joined.
+type Trigger interface {
+	Evaluate(ctx context.Context) []ScaleRequest
+}
+
+// Implemented by triggers whose signal also holds off scale down. Returns why
+// the kpNode of the scale event may not be removed, or an empty string.
+type ScaleDownHolder interface {
+	HoldScaleDown(ctx context.Context, scaleEvent *ScaleEvent) string
+}
+
+// Creates a trigger for the scaler, from its config.
+type TriggerFactory func(scaler *ProxmoxScaler) Trigger
+
+// The scaler's own assessment of pending pods, which is enabled by name like
+// the triggers but is the scaler's core loop rather than a Trigger, as it
+// accounts for in-progress scale events and the expander.
+const pendingPodsTrigger = "pendingPods"
+
+var triggerFactories = map[string]TriggerFactory{
+	"prometheus": func(scaler *ProxmoxScaler) Trigger { return &prometheusTrigger{scaler: scaler} },
+	"schedule":   func(scaler *ProxmoxScaler) Trigger { return &scheduleTrigger{scaler: scaler} },
+}
+
+// Registers a trigger which can then be enabled by adding its name to
+// scaleTriggers, must be called before the scaler is created, e.g. from an
+// init function.
+func RegisterTrigger(name string, factory TriggerFactory) {
+	triggerFactories[name] = factory
+}
+
+// The names of the enabled triggers, every built-in trigger when scaleTriggers
+// is unset.
+func (scaler *ProxmoxScaler) triggerNames() []string {
+	if len(scaler.currentConfig().ScaleTriggers) > 0 {
+		return scaler.currentConfig().ScaleTriggers
+	}
+
+	return []string{pendingPodsTrigger, "prometheus", "schedule"}
+}
+
+// Returns an error for any name in scaleTriggers which isn't a registered
+// trigger.
+func (scaler *ProxmoxScaler) validateTriggers() error {
+	for _, name := range scaler.triggerNames() {
+		if _, ok := triggerFactories[name]; ok || name == pendingPodsTrigger {
+			continue
+		}
+
+		known := []string{pendingPodsTrigger}
+		for name := range triggerFactories {
+			known = append(known, name)
+		}
+		sort.Strings(known)
+
+		return fmt.Errorf("unknown scale trigger %s, expected one of %s", name, strings.Join(known, ", "))
+	}
+
+	return nil
+}
+
+func (scaler *ProxmoxScaler) triggerEnabled(name string) bool {
+	return slices.Contains(scaler.triggerNames(), name)
+}
+
+// The enabled triggers, in the order they are configured.
+func (scaler *ProxmoxScaler) triggers() []Trigger {
+	triggers := []Trigger{}
+	for _, name := range scaler.triggerNames() {
+		factory, ok := triggerFactories[name]
+		if !ok {
+			continue
+		}
+
+		triggers = append(triggers, factory(scaler))
+	}
+
+	return triggers
+}
+
+// Generates scale events for the requests of each trigger, from the node
+// classes that have not reached their maxNodes.
+func (scaler *ProxmoxScaler) triggerScaleEvents(ctx context.Context, nodeClasses []config.NodeClass, numKpNodes map[string]int, explanation *ScaleUpExplanation) []*ScaleEvent {
+	scaleEvents := []*ScaleEvent{}
+
+	for _, trigger := range scaler.triggers() {
+		for _, request := range trigger.Evaluate(ctx) {
+			if request.Count <= 0 {
+				if request.Reason != "" {
+					explanation.Reasons = append(explanation.Reasons, request.Reason)
+				}
+				continue
+			}
+
+			for range request.Count {
+				candidates := eligibleNodeClasses(nodeClasses, numKpNodes)
+				if request.NodeClass != "" {
+					candidates = slices.DeleteFunc(candidates, func(nodeClass config.NodeClass) bool {
+						return nodeClass.Name != request.NodeClass
+					})
+				}
+
+				if len(candidates) == 0 {
+					explanation.Reasons = append(explanation.Reasons, fmt.Sprintf("%s, but no node class is available to scale up", request.Reason))
+					break
+				}
+
+				nodeClass := candidates[0]
+				scaleEvent := ScaleEvent{
+					ScaleType: 1,
+					NodeName:  scaler.newKpNodeName(),
+					NodeClass: nodeClass.Name,
+				}
+
+				scaleEvents = append(scaleEvents, &scaleEvent)
+				numKpNodes[nodeClass.Name]++
+				logger.DebugLog("Generated scale event due to trigger", "reason", request.Reason, "scaleEvent", fmt.Sprintf("%+v", scaleEvent))
+				explanation.ScaleEvents = append(explanation.ScaleEvents, ScaleEventExplanation{
+					NodeName:  scaleEvent.NodeName,
+					NodeClass: nodeClass.Name,
+					Reason:    request.Reason,
+				})
+			}
+		}
+	}
+
+	return scaleEvents
+}
+
+// Returns why scale down of the scale event's kpNode is held off by a
+// trigger, or an empty string if none hold it.
+func (scaler *ProxmoxScaler) scaleDownHeldByTriggers(ctx context.Context, scaleEvent *ScaleEvent) string {
+	for _, trigger := range scaler.triggers() {
+		holder, ok := trigger.(ScaleDownHolder)
+		if !ok {
+			continue
+		}
+
+		if reason := holder.HoldScaleDown(ctx, scaleEvent); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
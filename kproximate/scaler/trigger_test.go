@@ -0,0 +1,108 @@
+package scaler
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+type staticTrigger struct {
+	requests []ScaleRequest
+}
+
+func (trigger *staticTrigger) Evaluate(ctx context.Context) []ScaleRequest {
+	return trigger.requests
+}
+
+func TestRequiredScaleEventsRegisteredTrigger(t *testing.T) {
+	RegisterTrigger("static", func(scaler *ProxmoxScaler) Trigger {
+		return &staticTrigger{
+			requests: []ScaleRequest{
+				{NodeClass: "gpu", Count: 2, Reason: "Static trigger requires gpus"},
+				{Reason: "Static trigger has nothing else to request"},
+			},
+		}
+	})
+	defer delete(triggerFactories, "static")
+
+	s := &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{},
+		config: config.KproximateConfig{
+			KpNodeClasses: config.NodeClasses{
+				{Name: "general", Cores: 2, Memory: 2048},
+				{Name: "gpu", Cores: 8, Memory: 16384, MaxNodes: 1},
+			},
+			KpNodeNamePrefix: "kp-node",
+			ScaleTriggers:    []string{"static"},
+		},
+	}
+
+	err := s.validateTriggers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The gpu node class is limited to a single kpNode
+	if len(scaleEvents) != 1 || scaleEvents[0].NodeClass != "gpu" {
+		t.Fatalf("Expected a single gpu scale event, got %+v", scaleEvents)
+	}
+
+	reasons := s.Explain().ScaleUp.Reasons
+	if !slices.Contains(reasons, "Static trigger has nothing else to request") {
+		t.Errorf("Expected the trigger's reason to be explained, got %v", reasons)
+	}
+
+	if !slices.Contains(reasons, "Static trigger requires gpus, but no node class is available to scale up") {
+		t.Errorf("Expected the limited request to be explained, got %v", reasons)
+	}
+}
+
+func TestValidateTriggers(t *testing.T) {
+	s := &ProxmoxScaler{
+		config: config.KproximateConfig{
+			ScaleTriggers: []string{"pendingPods", "cron"},
+		},
+	}
+
+	err := s.validateTriggers()
+	if err == nil {
+		t.Error("Expected an error for an unknown trigger")
+	}
+
+	s.config.ScaleTriggers = nil
+	err = s.validateTriggers()
+	if err != nil {
+		t.Errorf("Expected the built-in triggers to be valid, got %v", err)
+	}
+}
+
+func TestRequiredScaleEventsWithoutPendingPodsTrigger(t *testing.T) {
+	s := &ProxmoxScaler{
+		Kubernetes: &kubernetes.KubernetesMock{
+			UnschedulableResources: kubernetes.UnschedulableResources{Cpu: 4},
+		},
+		config: config.KproximateConfig{
+			KpNodeCores:      2,
+			KpNodeMemory:     2048,
+			KpNodeNamePrefix: "kp-node",
+			ScaleTriggers:    []string{"schedule"},
+		},
+	}
+
+	scaleEvents, err := s.RequiredScaleEvents(context.Background(), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(scaleEvents) != 0 {
+		t.Errorf("Expected pending pods not to be scaled up for, got %d scale events", len(scaleEvents))
+	}
+}
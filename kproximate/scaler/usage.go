@@ -0,0 +1,47 @@
+package scaler
+
+import (
+	"context"
+
+	"github.com/lupinelab/kproximate/kubernetes"
+)
+
+// The load on each kpNode used to assess scale down, the resources requested
+// by its pods or, with scaleDownOnUsage, the resources metrics-server reports
+// it using when that is more, so that kpNodes whose workloads use more than
+// they request aren't removed. Also returns the usage of each kpNode, nil
+// unless scaleDownOnUsage is set.
+func (scaler *ProxmoxScaler) kpNodesLoad(ctx context.Context) (map[string]kubernetes.AllocatedResources, map[string]kubernetes.AllocatedResources, error) {
+	allocatedResources, err := scaler.Kubernetes.GetKpNodesAllocatedResources(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !scaler.currentConfig().ScaleDownOnUsage {
+		return allocatedResources, nil, nil
+	}
+
+	usage, err := scaler.Kubernetes.GetKpNodesUsage(ctx, scaler.currentConfig().KpNodeNameRegex)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	load := map[string]kubernetes.AllocatedResources{}
+	for kpNode, resources := range allocatedResources {
+		resources.Cpu = max(resources.Cpu, usage[kpNode].Cpu)
+		resources.Memory = max(resources.Memory, usage[kpNode].Memory)
+		load[kpNode] = resources
+	}
+
+	return load, usage, nil
+}
+
+func totalResources(resources map[string]kubernetes.AllocatedResources) AllocatedResources {
+	var total AllocatedResources
+	for _, kpNode := range resources {
+		total.Cpu += kpNode.Cpu
+		total.Memory += kpNode.Memory
+	}
+
+	return total
+}
@@ -0,0 +1,279 @@
+package scaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+// Implemented by provisioners able to keep stopped machines cloned ahead of
+// time, so that scale up events only need to start one.
+type WarmPoolProvisioner interface {
+	// Creates a stopped machine for the scale event.
+	CreateWarm(ctx context.Context, scaleEvent *ScaleEvent) error
+	// Starts a warm machine of the scale event's node class as its kpNode,
+	// returning false if there are none.
+	StartWarm(ctx context.Context, scaleEvent *ScaleEvent) (bool, error)
+	WarmNodes() ([]WarmNode, error)
+	DestroyWarm(ctx context.Context, name string) error
+}
+
+type WarmNode struct {
+	Name string
+	// Empty if the node class is no longer configured
+	NodeClass string
+	Host      string
+}
+
+func (scaler *ProxmoxScaler) newWarmKpNodeName() string {
+	return scaler.currentConfig().KpNodeNaming().NewWarmName()
+}
+
+// Starts a warm kpNode for the scale event if its node class has a warm pool.
+func (scaler *ProxmoxScaler) startWarm(ctx context.Context, scaleEvent *ScaleEvent) bool {
+	warmPool, ok := scaler.Provisioner.(WarmPoolProvisioner)
+	if !ok || scaler.currentConfig().NodeClass(scaleEvent.NodeClass).WarmPoolSize == 0 {
+		return false
+	}
+
+	started, err := warmPool.StartWarm(ctx, scaleEvent)
+	if err != nil {
+		logger.WarnLog("Failed to start a warm kpNode, cloning instead", "node", scaleEvent.NodeName, "error", err)
+		return false
+	}
+
+	if started {
+		logger.InfoLog(fmt.Sprintf("Started %s from the warm pool on %s", scaleEvent.NodeName, scaleEvent.TargetHost.Node))
+	}
+
+	return started
+}
+
+// Removes warm kpNodes beyond the warm pool size of their node class, or of
+// node classes no longer configured, and returns a scale event cloning a warm
+// kpNode for each missing from a warm pool. Warm kpNodes of each node class
+// already being cloned by scale events are counted as in the pool, see
+// queued. Only the scale events with a pHost able to take them are returned.
+func (scaler *ProxmoxScaler) WarmPoolScaleEvents(ctx context.Context, queued map[string]int) ([]*ScaleEvent, error) {
+	warmPool, ok := scaler.Provisioner.(WarmPoolProvisioner)
+	if !ok {
+		return nil, nil
+	}
+
+	warmNodes, err := warmPool.WarmNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	warmPoolSizes := map[string]int{}
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		warmPoolSizes[nodeClass.Name] = nodeClass.WarmPoolSize
+	}
+
+	numWarmNodes := maps.Clone(queued)
+	if numWarmNodes == nil {
+		numWarmNodes = map[string]int{}
+	}
+
+	for _, warmNode := range warmNodes {
+		if numWarmNodes[warmNode.NodeClass] < warmPoolSizes[warmNode.NodeClass] {
+			numWarmNodes[warmNode.NodeClass]++
+			continue
+		}
+
+		err = warmPool.DestroyWarm(ctx, warmNode.Name)
+		if err != nil {
+			return nil, err
+		}
+		logger.InfoLog(fmt.Sprintf("Deleted %s from the warm pool", warmNode.Name))
+	}
+
+	warmEvents := []*ScaleEvent{}
+	for _, nodeClass := range scaler.currentConfig().NodeClasses() {
+		for range nodeClass.WarmPoolSize - numWarmNodes[nodeClass.Name] {
+			warmEvents = append(warmEvents, &ScaleEvent{
+				ScaleType: ScaleTypeUp,
+				NodeName:  scaler.newWarmKpNodeName(),
+				NodeClass: nodeClass.Name,
+				Warm:      true,
+			})
+		}
+	}
+
+	if len(warmEvents) == 0 {
+		return warmEvents, nil
+	}
+
+	err = scaler.SelectTargetHosts(warmEvents)
+	if err != nil && !errors.Is(err, errUnplaceable) {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(warmEvents, func(warmEvent *ScaleEvent) bool {
+		return warmEvent.TargetHost.Node == ""
+	}), nil
+}
+
+// Clones a stopped kpNode into the warm pool of the scale event's node class.
+// Any VM left behind by a previous attempt at the scale event is deleted
+// first, as is the VM if the clone fails.
+func (scaler *ProxmoxScaler) cloneWarm(ctx context.Context, scaleEvent *ScaleEvent) error {
+	warmPool, ok := scaler.Provisioner.(WarmPoolProvisioner)
+	if !ok {
+		return fmt.Errorf("the provisioner has no warm pool to add %s to", scaleEvent.NodeName)
+	}
+
+	warmNodes, err := warmPool.WarmNodes()
+	if err != nil {
+		return err
+	}
+
+	if slices.ContainsFunc(warmNodes, func(warmNode WarmNode) bool { return warmNode.Name == scaleEvent.NodeName }) {
+		err = warmPool.DestroyWarm(ctx, scaleEvent.NodeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if scaleEvent.TargetHost.Node == "" {
+		err = scaler.SelectTargetHosts([]*ScaleEvent{scaleEvent})
+		if err != nil {
+			return err
+		}
+	}
+
+	nodeClass := scaler.currentConfig().NodeClass(scaleEvent.NodeClass)
+	ReportProgress(ctx, scaleEvent, ScaleEventCloning, "")
+
+	pctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(scaler.currentConfig().WaitSecondsForProvision))
+	defer cancel()
+
+	err = warmPool.CreateWarm(pctx, scaleEvent)
+	if err != nil {
+		_ = warmPool.DestroyWarm(context.WithoutCancel(ctx), scaleEvent.NodeName)
+		if pctx.Err() != nil {
+			err = classifiedError(FailureCloneTimeout, err)
+		}
+		return fmt.Errorf("failed to clone warm kpNode %s: %w", scaleEvent.NodeName, err)
+	}
+
+	logger.InfoLog(fmt.Sprintf("Added %s (%s) to the warm pool on %s", scaleEvent.NodeName, nodeClass.Name, scaleEvent.TargetHost.Node))
+	ReportProgress(ctx, scaleEvent, ScaleEventWarmed, "")
+
+	return nil
+}
+
+func (p *ProxmoxProvisioner) CreateWarm(ctx context.Context, scaleEvent *ScaleEvent) error {
+	unlock, err := p.lockClone(ctx, scaleEvent, p.cloneStorage(scaleEvent))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	return p.clone(ctx, scaleEvent, true)
+}
+
+func (p *ProxmoxProvisioner) WarmNodes() ([]WarmNode, error) {
+	vms, err := p.Proxmox.GetWarmKpNodes()
+	if err != nil {
+		return nil, err
+	}
+
+	warmNodes := []WarmNode{}
+	for _, vm := range vms {
+		warmNode := WarmNode{
+			Name: vm.Name,
+			Host: vm.Node,
+		}
+
+		for _, nodeClass := range p.config.NodeClasses() {
+			if vm.HasNodeClass(nodeClass.Name) {
+				warmNode.NodeClass = nodeClass.Name
+				break
+			}
+		}
+
+		warmNodes = append(warmNodes, warmNode)
+	}
+
+	return warmNodes, nil
+}
+
+// Renames a warm VM of the node class to the scale event's node name,
+// preferring one on the scale event's target host, before starting it. The
+// snippets are rendered again for the new name as the VM has never booted.
+func (p *ProxmoxProvisioner) StartWarm(ctx context.Context, scaleEvent *ScaleEvent) (bool, error) {
+	warmNodes, err := p.WarmNodes()
+	if err != nil {
+		return false, err
+	}
+
+	nodeClass := p.config.NodeClass(scaleEvent.NodeClass)
+	warmNodes = slices.DeleteFunc(warmNodes, func(warmNode WarmNode) bool {
+		return warmNode.NodeClass != nodeClass.Name
+	})
+	preferred := slices.IndexFunc(warmNodes, func(warmNode WarmNode) bool {
+		return warmNode.Host == scaleEvent.TargetHost.Node
+	})
+	if preferred > 0 {
+		warmNodes[0], warmNodes[preferred] = warmNodes[preferred], warmNodes[0]
+	}
+
+	for _, warmNode := range warmNodes {
+		claim := *scaleEvent
+		claim.TargetHost = proxmox.HostInformation{Node: warmNode.Host}
+
+		cicustom, err := p.writeSnippets(ctx, &claim)
+		if err != nil {
+			return false, err
+		}
+
+		kpNodeParams := map[string]interface{}{
+			"name": scaleEvent.NodeName,
+			"tags": proxmox.KpNodeMetadata{
+				ClusterName: p.config.ClusterName,
+				NodeClass:   nodeClass.Name,
+				Instance:    p.config.InstanceID,
+				ExtraTags:   p.config.KpNodeParams.Tags,
+			}.Tags(),
+		}
+
+		if cicustom != "" {
+			kpNodeParams["cicustom"] = cicustom
+		}
+
+		err = p.Proxmox.StartKpNode(warmNode.Name, kpNodeParams)
+		if err != nil {
+			// Most likely claimed by another worker, try the next
+			logger.DebugLog("Failed to start warm kpNode", "warmNode", warmNode.Name, "error", err)
+			p.deleteSnippets(scaleEvent.NodeName)
+			continue
+		}
+
+		p.deleteSnippets(warmNode.Name)
+
+		if scaleEvent.TargetHost.Node != warmNode.Host {
+			scaleEvent.TargetHost = claim.TargetHost
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func (p *ProxmoxProvisioner) DestroyWarm(ctx context.Context, name string) error {
+	err := p.Proxmox.DeleteWarmKpNode(name)
+	if err != nil {
+		return err
+	}
+
+	p.deleteSnippets(name)
+	return nil
+}
@@ -0,0 +1,272 @@
+package scaler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/kubernetes"
+	"github.com/lupinelab/kproximate/proxmox"
+)
+
+type warmPoolProvisionerMock struct {
+	provisionerMock
+	warmNodes     []WarmNode
+	createdWarm   []*ScaleEvent
+	startedWarm   []string
+	destroyedWarm []string
+}
+
+func (p *warmPoolProvisionerMock) CreateWarm(ctx context.Context, scaleEvent *ScaleEvent) error {
+	p.createdWarm = append(p.createdWarm, scaleEvent)
+	return nil
+}
+
+func (p *warmPoolProvisionerMock) StartWarm(ctx context.Context, scaleEvent *ScaleEvent) (bool, error) {
+	for idx, warmNode := range p.warmNodes {
+		if warmNode.NodeClass == scaleEvent.NodeClass {
+			p.startedWarm = append(p.startedWarm, scaleEvent.NodeName)
+			p.warmNodes = append(p.warmNodes[:idx], p.warmNodes[idx+1:]...)
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (p *warmPoolProvisionerMock) WarmNodes() ([]WarmNode, error) {
+	return p.warmNodes, nil
+}
+
+func (p *warmPoolProvisionerMock) DestroyWarm(ctx context.Context, name string) error {
+	p.destroyedWarm = append(p.destroyedWarm, name)
+	return nil
+}
+
+func TestWarmPoolScaleEvents(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{
+		warmNodes: []WarmNode{
+			{Name: "kp-node-warm-1", NodeClass: "general", Host: "pve-01"},
+			{Name: "kp-node-warm-2", NodeClass: "large", Host: "pve-01"},
+			{Name: "kp-node-warm-3", Host: "pve-01"},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	warmEvents, err := s.WarmPoolScaleEvents(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.destroyedWarm) != 2 || provisioner.destroyedWarm[0] != "kp-node-warm-2" || provisioner.destroyedWarm[1] != "kp-node-warm-3" {
+		t.Errorf("Expected warm kpNodes of classes without a warm pool to be destroyed, got %v", provisioner.destroyedWarm)
+	}
+
+	if len(warmEvents) != 1 {
+		t.Fatalf("Expected 1 warm kpNode to be requested, got %d", len(warmEvents))
+	}
+
+	if !warmEvents[0].Warm || warmEvents[0].NodeClass != "general" || warmEvents[0].TargetHost.Node != "pve-01" {
+		t.Errorf("Expected a general warm kpNode on pve-01, got %+v", warmEvents[0])
+	}
+
+	if !strings.HasPrefix(warmEvents[0].NodeName, "kp-node-warm-") {
+		t.Errorf("Expected a warm kpNode name, got %s", warmEvents[0].NodeName)
+	}
+
+	if len(provisioner.createdWarm) != 0 {
+		t.Errorf("Expected warm kpNodes to be left for workers to clone, got %d", len(provisioner.createdWarm))
+	}
+}
+
+func TestWarmPoolScaleEventsCountsQueuedWarmKpNodes(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{
+		warmNodes: []WarmNode{
+			{Name: "kp-node-warm-1", NodeClass: "general", Host: "pve-01"},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	warmEvents, err := s.WarmPoolScaleEvents(context.Background(), map[string]int{"general": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warmEvents) != 0 {
+		t.Errorf("Expected no warm kpNodes to be requested while one is queued, got %d", len(warmEvents))
+	}
+}
+
+func TestScaleUpClonesWarmKpNode(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	err := s.ScaleUp(context.Background(), &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-warm-1",
+		NodeClass: "general",
+		Warm:      true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.createdWarm) != 1 || provisioner.createdWarm[0].TargetHost.Node != "pve-01" {
+		t.Errorf("Expected kp-node-warm-1 to be cloned into the warm pool on pve-01, got %v", provisioner.createdWarm)
+	}
+
+	if len(provisioner.created) != 0 || len(provisioner.startedWarm) != 0 {
+		t.Errorf("Expected no kpNodes to be provisioned, cloned: %v, started: %v", provisioner.created, provisioner.startedWarm)
+	}
+}
+
+func TestScaleUpStartsWarmKpNode(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{
+		warmNodes: []WarmNode{
+			{Name: "kp-node-warm-1", NodeClass: "general", Host: "pve-01"},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	err := s.ScaleUp(context.Background(), &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+		NodeClass: "general",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.startedWarm) != 1 || provisioner.startedWarm[0] != "kp-node-a" {
+		t.Errorf("Expected kp-node-a to be started from the warm pool, got %v", provisioner.startedWarm)
+	}
+
+	if len(provisioner.created) != 0 {
+		t.Errorf("Expected no kpNodes to be cloned, got %v", provisioner.created)
+	}
+}
+
+func TestScaleUpClonesWithoutWarmKpNode(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	err := s.ScaleUp(context.Background(), &ScaleEvent{
+		ScaleType: ScaleTypeUp,
+		NodeName:  "kp-node-a",
+		NodeClass: "general",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(provisioner.created) != 1 {
+		t.Errorf("Expected kp-node-a to be cloned, got %v", provisioner.created)
+	}
+}
+
+func TestProxmoxProvisionerStartWarmPrefersTargetHost(t *testing.T) {
+	proxmoxMock := &proxmox.ProxmoxMock{
+		WarmKpNodes: []proxmox.VmInformation{
+			{Name: "kp-node-warm-1", Node: "pve-01", Tags: "kproximate;kp-class-general;kp-warm"},
+			{Name: "kp-node-warm-2", Node: "pve-02", Tags: "kproximate;kp-class-large;kp-warm"},
+			{Name: "kp-node-warm-3", Node: "pve-02", Tags: "kproximate;kp-class-general;kp-warm"},
+		},
+	}
+	p := NewProxmoxProvisioner(&config.KproximateConfig{
+		ClusterName: "homelab",
+		KpNodeClasses: config.NodeClasses{
+			{Name: "general", WarmPoolSize: 2},
+			{Name: "large", WarmPoolSize: 1},
+		},
+	}, proxmoxMock, &kubernetes.KubernetesMock{})
+
+	scaleEvent := &ScaleEvent{
+		ScaleType:  ScaleTypeUp,
+		NodeName:   "kp-node-a",
+		NodeClass:  "general",
+		TargetHost: proxmox.HostInformation{Node: "pve-02"},
+	}
+
+	started, err := p.StartWarm(context.Background(), scaleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !started {
+		t.Fatal("Expected a warm kpNode to be started")
+	}
+
+	params, ok := proxmoxMock.StartedKpNodes["kp-node-warm-3"]
+	if !ok {
+		t.Fatalf("Expected kp-node-warm-3 to be started, got %v", proxmoxMock.StartedKpNodes)
+	}
+
+	if params["name"] != "kp-node-a" || params["tags"] != "kproximate;kp-cluster-homelab;kp-class-general" {
+		t.Errorf("Expected kp-node-warm-3 to be renamed and retagged, got %v", params)
+	}
+}
+
+func TestProxmoxProvisionerStartWarmMovesTargetHost(t *testing.T) {
+	proxmoxMock := &proxmox.ProxmoxMock{
+		WarmKpNodes: []proxmox.VmInformation{
+			{Name: "kp-node-warm-1", Node: "pve-01", Tags: "kproximate;kp-class-general;kp-warm"},
+		},
+	}
+	p := NewProxmoxProvisioner(&config.KproximateConfig{
+		KpNodeClasses: config.NodeClasses{{Name: "general", WarmPoolSize: 1}},
+	}, proxmoxMock, &kubernetes.KubernetesMock{})
+
+	scaleEvent := &ScaleEvent{
+		ScaleType:  ScaleTypeUp,
+		NodeName:   "kp-node-a",
+		NodeClass:  "general",
+		TargetHost: proxmox.HostInformation{Node: "pve-02"},
+	}
+
+	_, err := p.StartWarm(context.Background(), scaleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if scaleEvent.TargetHost.Node != "pve-01" {
+		t.Errorf("Expected the target host to be pve-01, got %s", scaleEvent.TargetHost.Node)
+	}
+}
+
+func TestStartWarmSkippedWithoutWarmPool(t *testing.T) {
+	provisioner := &warmPoolProvisionerMock{
+		warmNodes: []WarmNode{
+			{Name: "kp-node-warm-1", NodeClass: "large", Host: "pve-01"},
+		},
+	}
+	s := newTestScaler(provisioner)
+	s.config.KpNodeClasses = config.NodeClasses{
+		{Name: "general", Cores: 2, Memory: 2048, WarmPoolSize: 2},
+		{Name: "large", Cores: 8, Memory: 16384},
+	}
+
+	if s.startWarm(context.Background(), &ScaleEvent{NodeName: "kp-node-a", NodeClass: "large"}) {
+		t.Error("Expected node classes without a warm pool not to start warm kpNodes")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/lupinelab/kproximate/grpcqueue"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/rabbitmq"
+	"github.com/lupinelab/kproximate/scaler"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// A scale event received from the controller over either transport
+type scaleEventDelivery interface {
+	body() []byte
+	redelivered() bool
+	ack()
+	reject(ctx context.Context, scaleErr error)
+	release(ctx context.Context)
+}
+
+// Whether the scale event was published in a burst, see scaler.ScaleEvent
+func isBurst(delivery scaleEventDelivery) bool {
+	scaleEvent, err := scaler.DecodeScaleEvent(delivery.body())
+	return err == nil && scaleEvent.Burst
+}
+
+type rabbitDelivery struct {
+	channel rabbitmq.Channel
+	msg     amqp.Delivery
+}
+
+func (d *rabbitDelivery) body() []byte {
+	return d.msg.Body
+}
+
+func (d *rabbitDelivery) redelivered() bool {
+	return d.msg.Redelivered
+}
+
+func (d *rabbitDelivery) ack() {
+	d.msg.Ack(false)
+	d.settle()
+}
+
+// Stops counting the scale event as in flight toward maxKpNodes, scale events
+// are published to the queue named by their routing key.
+func (d *rabbitDelivery) settle() {
+	err := rabbitmq.SettleInFlight(d.channel, d.msg.RoutingKey)
+	if err != nil {
+		logger.WarnLog("Failed to settle in flight scale event", "error", err)
+	}
+}
+
+// Requeues a failed scale event for another attempt, or dead letters it along
+// with the reason it failed once it has reached the delivery limit.
+func (d *rabbitDelivery) reject(ctx context.Context, scaleErr error) {
+	if rabbitmq.DeliveryCount(d.msg) < rabbitmq.DeliveryLimit {
+		d.msg.Reject(true)
+		return
+	}
+
+	err := rabbitmq.DeadLetterScaleEvent(ctx, d.channel, d.msg, scaleErr.Error())
+	if err != nil {
+		// The broker will dead letter the event itself once the delivery limit
+		// is exceeded, albeit without the failure reason
+		logger.ErrorLog("Failed to dead letter scale event", "error", err)
+		d.msg.Reject(true)
+		return
+	}
+
+	d.ack()
+}
+
+func (d *rabbitDelivery) release(ctx context.Context) {
+	err := rabbitmq.ReleaseScaleEvent(ctx, d.channel, d.msg)
+	if err != nil {
+		logger.ErrorLog("Failed to release scale event", "error", err)
+		d.msg.Reject(true)
+	}
+}
+
+type grpcDelivery struct {
+	client   *grpcqueue.Client
+	delivery *grpcqueue.Delivery
+	// Stops renewing the lease once the scale event is settled
+	stopRenewing context.CancelFunc
+}
+
+// Renews the lease of the scale event until it is acknowledged, rejected or
+// released, so that the controller doesn't hand a slow provision to another
+// worker.
+func newGrpcDelivery(ctx context.Context, client *grpcqueue.Client, delivery *grpcqueue.Delivery) *grpcDelivery {
+	renewCtx, stopRenewing := context.WithCancel(ctx)
+
+	go func() {
+		ticker := time.NewTicker(grpcqueue.RenewInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-renewCtx.Done():
+				return
+			case <-ticker.C:
+				err := client.Renew(renewCtx, delivery.Id)
+				if err != nil && renewCtx.Err() == nil {
+					logger.WarnLog("Failed to renew scale event lease", "error", err)
+				}
+			}
+		}
+	}()
+
+	return &grpcDelivery{
+		client:       client,
+		delivery:     delivery,
+		stopRenewing: stopRenewing,
+	}
+}
+
+func (d *grpcDelivery) body() []byte {
+	return d.delivery.Body
+}
+
+func (d *grpcDelivery) redelivered() bool {
+	return d.delivery.Redelivered
+}
+
+func (d *grpcDelivery) ack() {
+	d.stopRenewing()
+	err := d.client.Ack(context.Background(), d.delivery.Id)
+	if err != nil {
+		logger.ErrorLog("Failed to acknowledge scale event", "error", err)
+	}
+}
+
+// The controller dead letters scale events which reach the delivery limit
+func (d *grpcDelivery) reject(ctx context.Context, scaleErr error) {
+	d.stopRenewing()
+	err := d.client.Requeue(context.Background(), d.delivery.Id, scaleErr.Error())
+	if err != nil {
+		logger.ErrorLog("Failed to requeue scale event", "error", err)
+	}
+}
+
+func (d *grpcDelivery) release(ctx context.Context) {
+	d.stopRenewing()
+	err := d.client.Release(context.Background(), d.delivery.Id)
+	if err != nil {
+		logger.ErrorLog("Failed to release scale event", "error", err)
+	}
+}
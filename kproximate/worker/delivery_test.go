@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lupinelab/kproximate/rabbitmq"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestRabbitDeliveryRejectDeadLettersAtDeliveryLimit(t *testing.T) {
+	queueName := "scaleUpEvents"
+	ch := rabbitmq.NewChannelMock()
+	rabbitmq.DeclareQueue(ch, queueName, "deadLetterEvents")
+
+	rabbitmq.MarkInFlight(context.Background(), ch, queueName, time.Minute)
+	ch.PublishWithContext(context.Background(), "", queueName, false, false, amqp.Publishing{Body: []byte("scaleEvent")})
+
+	for i := 0; i <= rabbitmq.DeliveryLimit; i++ {
+		msg, ok, err := ch.Get(queueName, false)
+		if err != nil || !ok {
+			t.Fatalf("Expected delivery %d of the scale event, got %v", i+1, err)
+		}
+
+		delivery := &rabbitDelivery{channel: ch, msg: msg}
+		delivery.reject(context.Background(), errors.New("clone failed"))
+	}
+
+	if len(ch.Requeued) != rabbitmq.DeliveryLimit {
+		t.Errorf("Expected the scale event to be requeued %d times, got %d", rabbitmq.DeliveryLimit, len(ch.Requeued))
+	}
+
+	deadLetters := ch.Queues["deadLetterEvents"]
+	if len(deadLetters) != 1 || deadLetters[0].Headers["x-failure-reason"] != "clone failed" {
+		t.Fatalf("Expected the scale event to be dead lettered with its failure reason, got %v", deadLetters)
+	}
+
+	if len(ch.Acked) != 1 {
+		t.Errorf("Expected the dead lettered scale event to be acknowledged, got %v", ch.Acked)
+	}
+
+	numInFlight, _ := rabbitmq.GetInFlightScaleEvents(ch, queueName)
+	if numInFlight != 0 {
+		t.Errorf("Expected the dead lettered scale event to be settled, got %d in flight", numInFlight)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lupinelab/kproximate/scaler"
+)
+
+// Validates the template of a node class, or the first node class if none is
+// given, by provisioning a kpNode and removing it once it has joined. Returns
+// the exit code for the process.
+func runPreflight(ctx context.Context, kpScaler scaler.Scaler, args []string) int {
+	nodeClass := ""
+	if len(args) > 0 {
+		nodeClass = args[0]
+	}
+
+	err := kpScaler.Preflight(ctx, nodeClass)
+	if err != nil {
+		fmt.Printf("Preflight failed: %s\n", err.Error())
+		return 1
+	}
+
+	fmt.Println("Preflight passed")
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Limits the number of scale events a worker processes concurrently
+type workerSlots struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newWorkerSlots(concurrency int) *workerSlots {
+	return &workerSlots{
+		slots: make(chan struct{}, concurrency),
+	}
+}
+
+// Blocks until a slot is free, returns false if the context is done first.
+func (w *workerSlots) acquire(ctx context.Context) bool {
+	select {
+	case w.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *workerSlots) release() {
+	<-w.slots
+}
+
+// Runs the function in an acquired slot, releasing it once done.
+func (w *workerSlots) run(f func()) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer w.release()
+		f()
+	}()
+}
+
+// Waits for running scale events to finish.
+func (w *workerSlots) wait() {
+	w.wg.Wait()
+}
+
+// Extra capacity for scale events published in a burst, beyond the worker's
+// usual concurrency. onBurst is called when the first burst slot is taken and
+// once the last is released, eg to let more scale events be delivered.
+type burstSlots struct {
+	slots   chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running int
+	onBurst func(bursting bool)
+}
+
+func newBurstSlots(concurrency int, onBurst func(bursting bool)) *burstSlots {
+	return &burstSlots{
+		slots:   make(chan struct{}, concurrency),
+		onBurst: onBurst,
+	}
+}
+
+// Runs the function in a burst slot if one is free, returns false otherwise.
+func (b *burstSlots) tryRun(f func()) bool {
+	select {
+	case b.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	b.track(1)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer func() {
+			<-b.slots
+			b.track(-1)
+		}()
+		f()
+	}()
+
+	return true
+}
+
+func (b *burstSlots) track(delta int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.running += delta
+	if b.onBurst != nil && (b.running == 0 || (delta > 0 && b.running == 1)) {
+		b.onBurst(b.running > 0)
+	}
+}
+
+// Waits for running burst scale events to finish.
+func (b *burstSlots) wait() {
+	b.wg.Wait()
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lupinelab/kproximate/grpcqueue"
+	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/scaler"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Publishes the progress of scale events back to the controller using the
+// given function. Failing to publish progress does not fail the scale event.
+func newProgressReporter(publish func(ctx context.Context, body []byte) error) scaler.ProgressReporter {
+	return func(status scaler.ScaleEventStatus) {
+		body, err := scaler.EncodeScaleEventStatus(status)
+		if err != nil {
+			logger.WarnLog("Failed to encode scale event progress", "error", err)
+			return
+		}
+
+		// Progress is still reported while the worker shuts down
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		err = publish(ctx, body)
+		if err != nil {
+			logger.WarnLog("Failed to report scale event progress", "node", status.NodeName, "state", status.State, "error", err)
+		}
+	}
+}
+
+func rabbitProgressReporter(channel *amqp.Channel, queueName string) scaler.ProgressReporter {
+	var mu sync.Mutex
+
+	return newProgressReporter(func(ctx context.Context, body []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return channel.PublishWithContext(
+			ctx,
+			"",
+			queueName,
+			false,
+			false,
+			amqp.Publishing{
+				ContentType: "application/json",
+				Body:        body,
+			},
+		)
+	})
+}
+
+func grpcProgressReporter(client *grpcqueue.Client) scaler.ProgressReporter {
+	return newProgressReporter(client.Report)
+}
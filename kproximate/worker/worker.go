@@ -2,15 +2,18 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/lupinelab/kproximate/config"
+	"github.com/lupinelab/kproximate/grpcqueue"
 	"github.com/lupinelab/kproximate/logger"
+	"github.com/lupinelab/kproximate/provision"
 	"github.com/lupinelab/kproximate/rabbitmq"
 	"github.com/lupinelab/kproximate/scaler"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -19,16 +22,59 @@ import (
 func main() {
 	kpConfig, err := config.GetKpConfig()
 	if err != nil {
-		logger.ErrorLog("Failed to get config", "error", err)
+		logger.FatalLog("Failed to get config", err)
 	}
 
 	logger.ConfigureLogger("worker", kpConfig.Debug)
 
-	scaler, err := scaler.NewProxmoxScaler(kpConfig)
+	provisioner, err := provision.New(kpConfig)
 	if err != nil {
-		logger.ErrorLog("Failed to initialise scaler", "error", err)
+		logger.FatalLog("Failed to initialise scaler", err)
 	}
 
+	err = provisioner.Scaler().CheckProxmoxPermissions()
+	if err != nil {
+		logger.FatalLog("Failed to check Proxmox permissions", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sigChan := make(chan os.Signal, 1)
+	go func() {
+		<-sigChan
+		cancel()
+	}()
+
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	if len(os.Args) > 1 && os.Args[1] == "preflight" {
+		os.Exit(runPreflight(ctx, provisioner.Scaler(), os.Args[2:]))
+	}
+
+	// Secrets are only read on startup, so restart to apply any changes
+	if kpConfig.SecretsDir != "" {
+		go func() {
+			err := config.WatchSecrets(ctx, kpConfig.SecretsDir, time.Second*10)
+			if err == nil {
+				logger.InfoLog("Secrets changed, restarting to apply them")
+				cancel()
+			} else if ctx.Err() == nil {
+				logger.WarnLog("Failed to watch secrets", "error", err)
+			}
+		}()
+	}
+
+	logger.InfoLog("Listening for scale events")
+
+	if kpConfig.Transport == "grpc" {
+		consumeGrpc(ctx, provisioner, kpConfig)
+		return
+	}
+
+	consumeRabbitmq(ctx, provisioner, kpConfig)
+}
+
+func consumeRabbitmq(ctx context.Context, provisioner *provision.Provisioner, kpConfig config.KproximateConfig) {
 	rabbitConfig, err := config.GetRabbitConfig()
 	if err != nil {
 		logger.ErrorLog("Failed to get rabbit config", "error", err)
@@ -37,11 +83,19 @@ func main() {
 	conn, _ := rabbitmq.NewRabbitmqConnection(rabbitConfig)
 	defer conn.Close()
 
+	for _, queueName := range []string{"scaleUpEvents", "scaleDownEvents"} {
+		err = rabbitmq.MigrateQueue(ctx, conn, kpConfig.QueueName(queueName))
+		if err != nil {
+			logger.FatalLog("Failed to migrate queue", err)
+		}
+	}
+
 	scaleUpChannel := rabbitmq.NewChannel(conn)
 	defer scaleUpChannel.Close()
-	scaleUpQueue := rabbitmq.DeclareQueue(scaleUpChannel, "scaleUpEvents")
+	deadLetterQueue := kpConfig.QueueName(rabbitmq.DeadLetterQueue)
+	scaleUpQueue := rabbitmq.DeclareQueue(scaleUpChannel, kpConfig.QueueName("scaleUpEvents"), deadLetterQueue)
 	err = scaleUpChannel.Qos(
-		1,
+		kpConfig.WorkerConcurrency,
 		0,
 		false,
 	)
@@ -51,9 +105,9 @@ func main() {
 
 	scaleDownChannel := rabbitmq.NewChannel(conn)
 	defer scaleDownChannel.Close()
-	scaleDownQueue := rabbitmq.DeclareQueue(scaleUpChannel, "scaleDownEvents")
+	scaleDownQueue := rabbitmq.DeclareQueue(scaleUpChannel, kpConfig.QueueName("scaleDownEvents"), deadLetterQueue)
 	err = scaleDownChannel.Qos(
-		1,
+		kpConfig.WorkerConcurrency,
 		0,
 		false,
 	)
@@ -87,73 +141,227 @@ func main() {
 		logger.ErrorLog("Failed to register scale down consumer", "error", err)
 	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	statusChannel := rabbitmq.NewChannel(conn)
+	defer statusChannel.Close()
+	statusQueue := rabbitmq.DeclareStatusQueue(statusChannel, kpConfig.QueueName(rabbitmq.StatusQueue))
+	ctx = scaler.WithProgressReporter(ctx, rabbitProgressReporter(statusChannel, statusQueue.Name))
 
-	sigChan := make(chan os.Signal, 1)
-	go func() {
-		<-sigChan
-		cancel()
-	}()
+	slots := newWorkerSlots(kpConfig.WorkerConcurrency)
+	defer slots.wait()
 
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	logger.InfoLog("Listening for scale events")
+	// More scale up events are delivered while processing a burst
+	burst := newBurstSlots(kpConfig.BurstConcurrency, func(bursting bool) {
+		prefetch := kpConfig.WorkerConcurrency
+		if bursting {
+			prefetch += kpConfig.BurstConcurrency
+		}
+
+		err := scaleUpChannel.Qos(prefetch, 0, false)
+		if err != nil {
+			logger.ErrorLog("Failed to set scale up QoS", "error", err)
+		}
+	})
+	defer burst.wait()
 
 	for {
+		// Only take a scale event from a queue once there is capacity to
+		// process it
+		if !slots.acquire(ctx) {
+			return
+		}
+
 		select {
-		case scaleUpMsg := <-scaleUpMsgs:
-			consumeScaleUpMsg(ctx, scaler, scaleUpMsg)
+		case scaleUpMsg, ok := <-scaleUpMsgs:
+			if !ok {
+				logger.ErrorLog("Lost connection to RabbitMQ, restarting")
+				slots.release()
+				return
+			}
+
+			if injectQueueDisconnect(kpConfig, conn) {
+				slots.release()
+				continue
+			}
+
+			delivery := &rabbitDelivery{channel: scaleUpChannel, msg: scaleUpMsg}
+			consume := func() {
+				consumeScaleUpMsg(ctx, provisioner, delivery)
+			}
+
+			// Burst scale events free the slot for another scale event
+			if isBurst(delivery) && burst.tryRun(consume) {
+				slots.release()
+				continue
+			}
+
+			slots.run(consume)
 
-		case scaleDownMsg := <-scaleDownMsgs:
-			consumeScaleDownMsg(ctx, scaler, scaleDownMsg)
+		case scaleDownMsg, ok := <-scaleDownMsgs:
+			if !ok {
+				logger.ErrorLog("Lost connection to RabbitMQ, restarting")
+				slots.release()
+				return
+			}
+
+			if injectQueueDisconnect(kpConfig, conn) {
+				slots.release()
+				continue
+			}
+
+			slots.run(func() {
+				consumeScaleDownMsg(ctx, provisioner, &rabbitDelivery{channel: scaleDownChannel, msg: scaleDownMsg})
+			})
 
 		case <-ctx.Done():
+			slots.release()
 			return
 		}
 	}
 }
 
-func consumeScaleUpMsg(ctx context.Context, kpScaler scaler.Scaler, scaleUpMsg amqp.Delivery) {
-	var scaleUpEvent *scaler.ScaleEvent
-	json.Unmarshal(scaleUpMsg.Body, &scaleUpEvent)
+// Simulates losing the connection to RabbitMQ when failure injection is
+// enabled. The scale event just received is left unacknowledged so that it is
+// redelivered to another worker, and the worker restarts once its deliveries
+// stop.
+func injectQueueDisconnect(kpConfig config.KproximateConfig, conn *amqp.Connection) bool {
+	if !config.Injected(kpConfig.FailureInjection.QueueDisconnect) {
+		return false
+	}
+
+	logger.WarnLog("Injected queue disconnect")
+	conn.Close()
 
-	if scaleUpMsg.Redelivered {
-		kpScaler.DeleteNode(ctx, scaleUpEvent.NodeName)
-		logger.InfoLog(fmt.Sprintf("Retrying scale up event: %s", scaleUpEvent.NodeName))
-	} else {
-		logger.InfoLog(fmt.Sprintf("Triggered scale up event: %s", scaleUpEvent.NodeName))
+	return true
+}
+
+func consumeGrpc(ctx context.Context, provisioner *provision.Provisioner, kpConfig config.KproximateConfig) {
+	tlsConfig, err := grpcqueue.NewTLSConfig(kpConfig.GrpcCertFile, kpConfig.GrpcKeyFile, kpConfig.GrpcCAFile, false)
+	if err != nil {
+		logger.FatalLog("Failed to load gRPC TLS config", err)
 	}
 
-	err := kpScaler.ScaleUp(ctx, scaleUpEvent)
+	client, err := grpcqueue.NewClient(kpConfig.GrpcAddress, tlsConfig)
 	if err != nil {
-		logger.WarnLog("Scale up event failed", "error", err.Error())
-		kpScaler.DeleteNode(ctx, scaleUpEvent.NodeName)
-		scaleUpMsg.Reject(true)
+		logger.FatalLog("Failed to create gRPC client", err)
+	}
+	defer client.Close()
+
+	scaleUpQueueName := kpConfig.QueueName("scaleUpEvents")
+	scaleDownQueueName := kpConfig.QueueName("scaleDownEvents")
+	ctx = scaler.WithProgressReporter(ctx, grpcProgressReporter(client))
+
+	burst := newBurstSlots(kpConfig.BurstConcurrency, nil)
+	defer burst.wait()
+
+	var wg sync.WaitGroup
+	for i := 0; i < kpConfig.WorkerConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consumeGrpcEvents(ctx, provisioner, client, burst, scaleUpQueueName, scaleDownQueueName, kpConfig.FailureInjection.QueueDisconnect)
+		}()
+	}
+
+	wg.Wait()
+}
+
+// Scale events are abandoned with the disconnectProbability, simulating a lost
+// connection, so that they are redelivered once their lease expires.
+func consumeGrpcEvents(ctx context.Context, provisioner *provision.Provisioner, client *grpcqueue.Client, burst *burstSlots, scaleUpQueueName string, scaleDownQueueName string, disconnectProbability float64) {
+	for {
+		delivery, err := client.Next(ctx, []string{scaleUpQueueName, scaleDownQueueName})
+		if err == nil && config.Injected(disconnectProbability) {
+			err = fmt.Errorf("injected queue disconnect")
+		}
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.WarnLog("Failed to get scale event", "error", err)
+			time.Sleep(time.Second * 5)
+			continue
+		}
+
+		switch delivery.Queue {
+		case scaleUpQueueName:
+			scaleUpMsg := newGrpcDelivery(ctx, client, delivery)
+			consume := func() {
+				consumeScaleUpMsg(ctx, provisioner, scaleUpMsg)
+			}
+
+			// Burst scale events are processed alongside the next scale event
+			if !isBurst(scaleUpMsg) || !burst.tryRun(consume) {
+				consume()
+			}
+		case scaleDownQueueName:
+			consumeScaleDownMsg(ctx, provisioner, newGrpcDelivery(ctx, client, delivery))
+		}
+	}
+}
+
+// How long a worker waits before returning a scale event it cannot process
+// to the queue, so that it is not immediately redelivered to the same worker
+const releaseDelay = time.Second * 10
+
+// Leaves a scale event published for a newer worker to be processed by one,
+// during a rolling upgrade, rather than failing it.
+func releaseUnsupportedMsg(ctx context.Context, msg scaleEventDelivery, err error) {
+	logger.WarnLog("Received scale event for a newer worker, returning it to the queue", "error", err)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(releaseDelay):
+	}
+
+	msg.release(ctx)
+}
+
+func consumeScaleUpMsg(ctx context.Context, provisioner *provision.Provisioner, scaleUpMsg scaleEventDelivery) {
+	scaleUpEvent, err := scaler.DecodeScaleEvent(scaleUpMsg.body())
+	if errors.Is(err, scaler.ErrUnsupportedScaleEventVersion) {
+		releaseUnsupportedMsg(ctx, scaleUpMsg, err)
+		return
+	}
+	if err != nil {
+		logger.ErrorLog("Received invalid scale event", "error", err, "event", string(scaleUpMsg.body()))
+		scaleUpMsg.reject(ctx, err)
+		return
+	}
+
+	err = provisioner.ScaleUp(ctx, scaleUpEvent, scaleUpMsg.redelivered())
+	if err != nil && !errors.Is(err, provision.ErrNotRequired) {
+		scaleUpMsg.reject(ctx, err)
 		return
 	}
 
-	scaleUpMsg.Ack(false)
+	scaleUpMsg.ack()
 }
 
-func consumeScaleDownMsg(ctx context.Context, kpScaler scaler.Scaler, scaleDownMsg amqp.Delivery) {
-	var scaleDownEvent *scaler.ScaleEvent
-	json.Unmarshal(scaleDownMsg.Body, &scaleDownEvent)
+func consumeScaleDownMsg(ctx context.Context, provisioner *provision.Provisioner, scaleDownMsg scaleEventDelivery) {
+	scaleDownEvent, err := scaler.DecodeScaleEvent(scaleDownMsg.body())
+	if errors.Is(err, scaler.ErrUnsupportedScaleEventVersion) {
+		releaseUnsupportedMsg(ctx, scaleDownMsg, err)
+		return
+	}
+	if err != nil {
+		logger.ErrorLog("Received invalid scale event", "error", err, "event", string(scaleDownMsg.body()))
+		scaleDownMsg.reject(ctx, err)
+		return
+	}
 
-	if scaleDownMsg.Redelivered {
+	if scaleDownMsg.redelivered() {
 		logger.InfoLog(fmt.Sprintf("Retrying scale down event: %s", scaleDownEvent.NodeName))
 	} else {
 		logger.InfoLog(fmt.Sprintf("Triggered scale down event: %s", scaleDownEvent.NodeName))
 	}
 
-	scaleCtx, scaleCancel := context.WithDeadline(ctx, time.Now().Add(time.Second*300))
-	defer scaleCancel()
-
-	err := kpScaler.ScaleDown(scaleCtx, scaleDownEvent)
+	err = provisioner.ScaleDown(ctx, scaleDownEvent)
 	if err != nil {
-		logger.WarnLog(fmt.Sprintf("Scale down event failed: %s", err.Error()))
-		scaleDownMsg.Reject(true)
+		scaleDownMsg.reject(ctx, err)
 		return
 	}
 
-	logger.InfoLog(fmt.Sprintf("Deleted %s", scaleDownEvent.NodeName))
-	scaleDownMsg.Ack(false)
+	scaleDownMsg.ack()
 }